@@ -162,5 +162,65 @@ var RelayProxy = env.String("RELAY_PROXY", "")
 var UserContentRequestProxy = env.String("USER_CONTENT_REQUEST_PROXY", "")
 var UserContentRequestTimeout = env.Int("USER_CONTENT_REQUEST_TIMEOUT", 30)
 
+// media of content parts fetched by the gateway, private addresses are refused unless allowed
+var MediaMaxSizeMB = env.Int("MEDIA_MAX_SIZE_MB", 20)
+var MediaCacheSize = env.Int("MEDIA_CACHE_SIZE", 32)
+var MediaCacheTTL = env.Int("MEDIA_CACHE_TTL", 600)
+var MediaAllowPrivateNetwork = env.Bool("MEDIA_ALLOW_PRIVATE_NETWORK", false)
+
 var EnforceIncludeUsage = env.Bool("ENFORCE_INCLUDE_USAGE", false)
 var TestPrompt = env.String("TEST_PROMPT", "Output only your specific model name with no additional text.")
+
+// FileStorageType is where uploaded files are kept, "local" or "s3"
+var FileStorageType = env.String("FILE_STORAGE_TYPE", "local")
+var FileStoragePath = env.String("FILE_STORAGE_PATH", "./data/files")
+var FileMaxSizeMB = env.Int("FILE_MAX_SIZE_MB", 200)
+
+// S3-compatible file storage, only used when FILE_STORAGE_TYPE is "s3"
+var S3Endpoint = env.String("S3_ENDPOINT", "")
+var S3Region = env.String("S3_REGION", "us-east-1")
+var S3Bucket = env.String("S3_BUCKET", "")
+var S3AccessKey = env.String("S3_ACCESS_KEY", "")
+var S3SecretKey = env.String("S3_SECRET_KEY", "")
+
+var BatchWorkerNum = env.Int("BATCH_WORKER_NUM", 8)
+var BatchRequestsPerMinute = env.Int("BATCH_REQUESTS_PER_MINUTE", 600)
+var BatchPollInterval = env.Int("BATCH_POLL_INTERVAL", 10) // unit is second
+var BatchRatio = env.Float64("BATCH_RATIO", 0.5)
+var BatchPassthroughEnabled = env.Bool("BATCH_PASSTHROUGH_ENABLED", true)
+
+// StoredCompletionRetentionDays is how long chat completions created with store=true are kept
+var StoredCompletionRetentionDays = env.Int("STORED_COMPLETION_RETENTION_DAYS", 30)
+
+// response cache, enabled per token or with the X-OneAPI-Cache request header
+var ResponseCacheTTL = env.Int("RESPONSE_CACHE_TTL", 3600) // unit is second
+var ResponseCacheLRUSize = env.Int("RESPONSE_CACHE_LRU_SIZE", 1000)
+var ResponseCacheHitRatio = env.Float64("RESPONSE_CACHE_HIT_RATIO", 0.1)
+var ResponseCacheReplayTiming = env.Bool("RESPONSE_CACHE_REPLAY_TIMING", false)
+
+// StructuredOutputMaxRetries is how many times a request is retried when its output doesn't match the json_schema
+var StructuredOutputMaxRetries = env.Int("STRUCTURED_OUTPUT_MAX_RETRIES", 1)
+
+// TokenizerVocabDir holds the tiktoken files of open-weight models, llama3.tiktoken and qwen.tiktoken, which are
+// not shipped because of their size and licenses. The token counts of these families are estimated without them.
+var TokenizerVocabDir = env.String("TOKENIZER_VOCAB_DIR", "")
+
+// GuardrailStreamLookbehind is how many bytes of a stream are held back so that a match split over chunks is found
+var GuardrailStreamLookbehind = env.Int("GUARDRAIL_STREAM_LOOKBEHIND", 64)
+
+// ChannelKeyCooldownSeconds is how long a key of a multi-key channel is skipped after the upstream rate limited it
+var ChannelKeyCooldownSeconds = env.Int("CHANNEL_KEY_COOLDOWN_SECONDS", 60)
+
+// video generations and the other submit-then-poll tasks, the final state is sent to the callback url of the task
+var TaskPollInterval = env.Int("TASK_POLL_INTERVAL", 10) // unit is second
+var TaskTimeout = env.Int("TASK_TIMEOUT", 3600)          // unit is second, the unfinished tasks fail and are refunded after it
+var TaskCallbackAllowPrivateNetwork = env.Bool("TASK_CALLBACK_ALLOW_PRIVATE_NETWORK", false)
+
+// TaskCallbackSecret signs the task callbacks, the key of the token which submitted the task is used when it is empty
+var TaskCallbackSecret = env.String("TASK_CALLBACK_SECRET", "")
+
+// tools of mcp servers run by the gateway, the model is called again with their results until it answers
+var MCPMaxIterations = env.Int("MCP_MAX_ITERATIONS", 5)            // the last call can't use the tools anymore
+var MCPToolTimeout = env.Int("MCP_TOOL_TIMEOUT", 30)               // unit is second, servers may set their own
+var MCPTimeout = env.Int("MCP_TIMEOUT", 300)                       // unit is second, neither the model nor the tools are called after it
+var MCPToolsCacheSeconds = env.Int("MCP_TOOLS_CACHE_SECONDS", 300) // the lists are refreshed sooner when a server says they changed
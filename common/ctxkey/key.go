@@ -15,10 +15,18 @@ const (
 	Group             = "group"
 	ModelMapping      = "model_mapping"
 	ChannelName       = "channel_name"
+	ChannelKeyId      = "channel_key_id"
 	TokenId           = "token_id"
 	TokenName         = "token_name"
 	BaseURL           = "base_url"
 	AvailableModels   = "available_models"
 	KeyRequestBody    = "key_request_body"
 	SystemPrompt      = "system_prompt"
+	BatchId           = "batch_id"
+	StoreCompletions  = "store_completions"
+	ExcludeReasoning  = "exclude_reasoning"
+	ResponseCache     = "response_cache"
+	GuardrailPolicy   = "guardrail_policy"
+	Preset            = "preset"
+	MCPServers        = "mcp_servers"
 )
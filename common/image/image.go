@@ -3,44 +3,48 @@ package image
 import (
 	"bytes"
 	"encoding/base64"
-	"github.com/songquanpeng/one-api/common/client"
+	"fmt"
 	"image"
 	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
+	"mime/multipart"
 	"net/http"
 	"regexp"
 	"strings"
 	"sync"
 
 	_ "golang.org/x/image/webp"
-)
 
-// Regex to match data URL pattern
-var dataURLPattern = regexp.MustCompile(`data:image/([^;]+);base64,(.*)`)
+	"github.com/songquanpeng/one-api/common/media"
+)
 
 func IsImageUrl(url string) (bool, error) {
-	resp, err := client.UserContentRequestHTTPClient.Head(url)
+	fetched, err := media.Fetch(url)
 	if err != nil {
 		return false, err
 	}
-	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "image/") {
-		return false, nil
+	return strings.HasPrefix(fetched.MimeType, "image/"), nil
+}
+
+// fetchImage gets the image through the media fetcher, which refuses the private network
+func fetchImage(url string) (*media.Media, error) {
+	fetched, err := media.Fetch(url)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(fetched.MimeType, "image/") {
+		return nil, fmt.Errorf("%s is not an image", url)
 	}
-	return true, nil
+	return fetched, nil
 }
 
 func GetImageSizeFromUrl(url string) (width int, height int, err error) {
-	isImage, err := IsImageUrl(url)
-	if !isImage {
-		return
-	}
-	resp, err := client.UserContentRequestHTTPClient.Get(url)
+	fetched, err := fetchImage(url)
 	if err != nil {
 		return
 	}
-	defer resp.Body.Close()
-	img, _, err := image.DecodeConfig(resp.Body)
+	img, _, err := image.DecodeConfig(bytes.NewReader(fetched.Data))
 	if err != nil {
 		return
 	}
@@ -48,32 +52,11 @@ func GetImageSizeFromUrl(url string) (width int, height int, err error) {
 }
 
 func GetImageFromUrl(url string) (mimeType string, data string, err error) {
-	// Check if the URL is a data URL
-	matches := dataURLPattern.FindStringSubmatch(url)
-	if len(matches) == 3 {
-		// URL is a data URL
-		mimeType = "image/" + matches[1]
-		data = matches[2]
-		return
-	}
-
-	isImage, err := IsImageUrl(url)
-	if !isImage {
-		return
-	}
-	resp, err := http.Get(url)
-	if err != nil {
-		return
-	}
-	defer resp.Body.Close()
-	buffer := bytes.NewBuffer(nil)
-	_, err = buffer.ReadFrom(resp.Body)
+	fetched, err := fetchImage(url)
 	if err != nil {
 		return
 	}
-	mimeType = resp.Header.Get("Content-Type")
-	data = base64.StdEncoding.EncodeToString(buffer.Bytes())
-	return
+	return fetched.MimeType, fetched.Base64(), nil
 }
 
 var (
@@ -110,3 +93,18 @@ func GetImageSize(image string) (width int, height int, err error) {
 	}
 	return GetImageSizeFromUrl(image)
 }
+
+// GetImageDataURLFromFileHeader encodes an uploaded image as a data URL
+func GetImageDataURLFromFileHeader(header *multipart.FileHeader) (string, error) {
+	file, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	buffer := bytes.NewBuffer(nil)
+	if _, err = buffer.ReadFrom(file); err != nil {
+		return "", err
+	}
+	mimeType := http.DetectContentType(buffer.Bytes())
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(buffer.Bytes()), nil
+}
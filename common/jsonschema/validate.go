@@ -0,0 +1,264 @@
+// Package jsonschema validates decoded json values against the subset of JSON Schema
+// used by structured outputs: types, enum, const, properties, required, additionalProperties,
+// items, length & range limits, anyOf/oneOf/allOf and local $ref.
+package jsonschema
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type validator struct {
+	root map[string]any
+}
+
+// Validate checks value, as decoded by encoding/json, against schema
+func Validate(schema map[string]any, value any) error {
+	v := &validator{root: schema}
+	return v.validate(schema, value, "$", 0)
+}
+
+const maxDepth = 64
+
+func (v *validator) validate(schema map[string]any, value any, path string, depth int) error {
+	if depth > maxDepth {
+		return fmt.Errorf("%s: schema is nested too deep", path)
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, err := v.resolve(ref)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err.Error())
+		}
+		return v.validate(resolved, value, path, depth+1)
+	}
+	if err := v.validateType(schema, value, path); err != nil {
+		return err
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, item := range enum {
+			if equal(item, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value is not one of the enum values", path)
+		}
+	}
+	if constant, ok := schema["const"]; ok && !equal(constant, value) {
+		return fmt.Errorf("%s: value does not match const", path)
+	}
+	switch value := value.(type) {
+	case map[string]any:
+		if err := v.validateObject(schema, value, path, depth); err != nil {
+			return err
+		}
+	case []any:
+		if err := v.validateArray(schema, value, path, depth); err != nil {
+			return err
+		}
+	case string:
+		length := len([]rune(value))
+		if min, ok := number(schema["minLength"]); ok && float64(length) < min {
+			return fmt.Errorf("%s: string is shorter than %v", path, min)
+		}
+		if max, ok := number(schema["maxLength"]); ok && float64(length) > max {
+			return fmt.Errorf("%s: string is longer than %v", path, max)
+		}
+	case float64:
+		if min, ok := number(schema["minimum"]); ok && value < min {
+			return fmt.Errorf("%s: %v is less than %v", path, value, min)
+		}
+		if max, ok := number(schema["maximum"]); ok && value > max {
+			return fmt.Errorf("%s: %v is greater than %v", path, value, max)
+		}
+		if min, ok := number(schema["exclusiveMinimum"]); ok && value <= min {
+			return fmt.Errorf("%s: %v is not greater than %v", path, value, min)
+		}
+		if max, ok := number(schema["exclusiveMaximum"]); ok && value >= max {
+			return fmt.Errorf("%s: %v is not less than %v", path, value, max)
+		}
+	}
+	return v.validateCombinators(schema, value, path, depth)
+}
+
+func (v *validator) validateType(schema map[string]any, value any, path string) error {
+	var types []string
+	switch t := schema["type"].(type) {
+	case string:
+		types = []string{t}
+	case []any:
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+	default:
+		return nil
+	}
+	actual := typeOf(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(types, " or "), actual)
+}
+
+func (v *validator) validateObject(schema map[string]any, value map[string]any, path string, depth int) error {
+	if required, ok := schema["required"].([]any); ok {
+		for _, item := range required {
+			name, _ := item.(string)
+			if _, ok := value[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+	}
+	properties, _ := schema["properties"].(map[string]any)
+	for name, item := range value {
+		propertyPath := path + "." + name
+		if propertySchema, ok := properties[name].(map[string]any); ok {
+			if err := v.validate(propertySchema, item, propertyPath, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				return fmt.Errorf("%s: additional property is not allowed", propertyPath)
+			}
+		case map[string]any:
+			if err := v.validate(additional, item, propertyPath, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *validator) validateArray(schema map[string]any, value []any, path string, depth int) error {
+	if min, ok := number(schema["minItems"]); ok && float64(len(value)) < min {
+		return fmt.Errorf("%s: array has fewer than %v items", path, min)
+	}
+	if max, ok := number(schema["maxItems"]); ok && float64(len(value)) > max {
+		return fmt.Errorf("%s: array has more than %v items", path, max)
+	}
+	if items, ok := schema["items"].(map[string]any); ok {
+		for i, item := range value {
+			if err := v.validate(items, item, fmt.Sprintf("%s[%d]", path, i), depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *validator) validateCombinators(schema map[string]any, value any, path string, depth int) error {
+	if allOf, ok := schema["allOf"].([]any); ok {
+		for _, item := range allOf {
+			if sub, ok := item.(map[string]any); ok {
+				if err := v.validate(sub, value, path, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok && v.countMatches(anyOf, value, path, depth) == 0 {
+		return fmt.Errorf("%s: value does not match any of the anyOf schemas", path)
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok && v.countMatches(oneOf, value, path, depth) != 1 {
+		return fmt.Errorf("%s: value does not match exactly one of the oneOf schemas", path)
+	}
+	return nil
+}
+
+func (v *validator) countMatches(schemas []any, value any, path string, depth int) int {
+	matches := 0
+	for _, item := range schemas {
+		if sub, ok := item.(map[string]any); ok && v.validate(sub, value, path, depth+1) == nil {
+			matches++
+		}
+	}
+	return matches
+}
+
+// resolve only supports references into the same document, like "#/$defs/item"
+func (v *validator) resolve(ref string) (map[string]any, error) {
+	if ref == "#" {
+		return v.root, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	var current any = v.root
+	for _, segment := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		segment = strings.ReplaceAll(strings.ReplaceAll(segment, "~1", "/"), "~0", "~")
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+		current = object[segment]
+	}
+	resolved, ok := current.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unresolvable $ref %q", ref)
+	}
+	return resolved, nil
+}
+
+func typeOf(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "unknown"
+}
+
+func number(value any) (float64, bool) {
+	n, ok := value.(float64)
+	return n, ok
+}
+
+func equal(a any, b any) bool {
+	switch a := a.(type) {
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			if !equal(value, b[key]) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
@@ -0,0 +1,64 @@
+package jsonschema_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common/jsonschema"
+)
+
+const schema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "minLength": 1},
+		"age": {"type": "integer", "minimum": 0},
+		"tags": {"type": "array", "items": {"$ref": "#/$defs/tag"}, "maxItems": 2},
+		"nickname": {"type": ["string", "null"]}
+	},
+	"required": ["name", "age"],
+	"additionalProperties": false,
+	"$defs": {
+		"tag": {"enum": ["a", "b"]}
+	}
+}`
+
+func decode(t *testing.T, data string) map[string]any {
+	var value map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(data), &value))
+	return value
+}
+
+func TestValidate(t *testing.T) {
+	s := decode(t, schema)
+	cases := []struct {
+		value string
+		valid bool
+	}{
+		{`{"name": "x", "age": 1}`, true},
+		{`{"name": "x", "age": 1, "tags": ["a", "b"], "nickname": null}`, true},
+		{`{"name": "x"}`, false},
+		{`{"name": "", "age": 1}`, false},
+		{`{"name": "x", "age": 1.5}`, false},
+		{`{"name": "x", "age": -1}`, false},
+		{`{"name": "x", "age": 1, "tags": ["c"]}`, false},
+		{`{"name": "x", "age": 1, "tags": ["a", "a", "a"]}`, false},
+		{`{"name": "x", "age": 1, "extra": true}`, false},
+	}
+	for _, c := range cases {
+		err := jsonschema.Validate(s, decode(t, c.value))
+		assert.Equal(t, c.valid, err == nil, c.value)
+	}
+}
+
+func TestValidateCombinators(t *testing.T) {
+	s := decode(t, `{"anyOf": [{"type": "string"}, {"type": "object", "required": ["id"]}]}`)
+	assert.NoError(t, jsonschema.Validate(s, "x"))
+	assert.NoError(t, jsonschema.Validate(s, map[string]any{"id": 1.0}))
+	assert.Error(t, jsonschema.Validate(s, map[string]any{}))
+
+	s = decode(t, `{"oneOf": [{"type": "number"}, {"type": "integer"}]}`)
+	assert.NoError(t, jsonschema.Validate(s, 1.5))
+	assert.Error(t, jsonschema.Validate(s, 1.0))
+}
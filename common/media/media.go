@@ -0,0 +1,203 @@
+package media
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/network"
+)
+
+const (
+	MimeTypePDF         = "application/pdf"
+	MimeTypeOctetStream = "application/octet-stream"
+)
+
+var ErrPrivateAddress = errors.New("media on private addresses is not allowed")
+
+// Media is the content of an image, file or audio part of a message
+type Media struct {
+	MimeType string
+	Data     []byte
+}
+
+func (m *Media) Base64() string {
+	return base64.StdEncoding.EncodeToString(m.Data)
+}
+
+func (m *Media) DataURL() string {
+	return "data:" + m.MimeType + ";base64," + m.Base64()
+}
+
+func (m *Media) IsPDF() bool {
+	return m.MimeType == MimeTypePDF
+}
+
+func (m *Media) IsText() bool {
+	return strings.HasPrefix(m.MimeType, "text/")
+}
+
+var (
+	httpClient     *http.Client
+	cache          *expirable.LRU[string, *Media]
+	httpClientOnce sync.Once
+)
+
+// refusePrivateAddress is checked on every connection, so that neither the resolved address of the url
+// nor the ones of redirects can reach the private network
+func refusePrivateAddress(_ string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || network.IsPrivateIP(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+func getHTTPClient() *http.Client {
+	httpClientOnce.Do(func() {
+		dialer := &net.Dialer{Timeout: 10 * time.Second}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if config.UserContentRequestProxy != "" {
+			// the proxy is trusted to fetch user content
+			proxyURL, err := url.Parse(config.UserContentRequestProxy)
+			if err == nil {
+				transport.Proxy = http.ProxyURL(proxyURL)
+			}
+		} else {
+			transport.Proxy = nil
+			if !config.MediaAllowPrivateNetwork {
+				dialer.Control = refusePrivateAddress
+			}
+		}
+		transport.DialContext = dialer.DialContext
+		httpClient = &http.Client{
+			Transport: transport,
+			Timeout:   time.Duration(config.UserContentRequestTimeout) * time.Second,
+		}
+		cache = expirable.NewLRU[string, *Media](config.MediaCacheSize, nil, time.Duration(config.MediaCacheTTL)*time.Second)
+	})
+	return httpClient
+}
+
+func maxSize() int64 {
+	return int64(config.MediaMaxSizeMB) << 20
+}
+
+// sniff trusts the content over the declared type, which is only used when the content isn't recognized
+func sniff(data []byte, declared string) string {
+	if declared != "" {
+		if mimeType, _, err := mime.ParseMediaType(declared); err == nil {
+			declared = mimeType
+		}
+	}
+	detected := http.DetectContentType(data)
+	if mimeType, _, err := mime.ParseMediaType(detected); err == nil {
+		detected = mimeType
+	}
+	if declared != "" && (detected == MimeTypeOctetStream || detected == "text/plain") {
+		return declared
+	}
+	if detected == "audio/wave" {
+		return "audio/wav"
+	}
+	return detected
+}
+
+// New sniffs the mime type of the data, declared is used when the content isn't recognized
+func New(data []byte, declared string) *Media {
+	return &Media{MimeType: sniff(data, declared), Data: data}
+}
+
+// FromBase64 decodes media given inline, the mime type is sniffed when not known
+func FromBase64(data string, mimeType string) (*Media, error) {
+	if int64(base64.StdEncoding.DecodedLen(len(data))) > maxSize()+2 {
+		return nil, fmt.Errorf("media is larger than %d MB", config.MediaMaxSizeMB)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 media: %w", err)
+	}
+	return New(decoded, mimeType), nil
+}
+
+func fromDataURL(dataURL string) (*Media, error) {
+	header, data, found := strings.Cut(strings.TrimPrefix(dataURL, "data:"), ",")
+	if !found || !strings.HasSuffix(header, ";base64") {
+		return nil, errors.New("only base64 data urls are supported")
+	}
+	return FromBase64(data, strings.TrimSuffix(header, ";base64"))
+}
+
+func download(rawURL string) (*Media, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := getHTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch media: status code %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxSize() {
+		return nil, fmt.Errorf("media is larger than %d MB", config.MediaMaxSizeMB)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize()+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize() {
+		return nil, fmt.Errorf("media is larger than %d MB", config.MediaMaxSizeMB)
+	}
+	return New(data, resp.Header.Get("Content-Type")), nil
+}
+
+// ValidateURL checks that the media can be fetched, only data urls and http urls are accepted
+func ValidateURL(rawURL string) error {
+	if strings.HasPrefix(rawURL, "data:") {
+		return nil
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid media url: %s", rawURL)
+	}
+	return nil
+}
+
+// Fetch gets the media of a data url or of a http url, downloaded media are cached for a while
+func Fetch(rawURL string) (*Media, error) {
+	if strings.HasPrefix(rawURL, "data:") {
+		return fromDataURL(rawURL)
+	}
+	if err := ValidateURL(rawURL); err != nil {
+		return nil, err
+	}
+	getHTTPClient()
+	if media, ok := cache.Get(rawURL); ok {
+		return media, nil
+	}
+	media, err := download(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	cache.Add(rawURL, media)
+	return media, nil
+}
@@ -0,0 +1,56 @@
+package media
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makePDF(t *testing.T, content string) []byte {
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	_, err := writer.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\n")
+	fmt.Fprintf(&pdf, "4 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", compressed.Len())
+	pdf.Write(compressed.Bytes())
+	pdf.WriteString("\nendstream\nendobj\n%%EOF\n")
+	return pdf.Bytes()
+}
+
+func TestExtractPDFText(t *testing.T) {
+	pdf := makePDF(t, "BT /F1 12 Tf 72 712 Td (Quarterly \\(Q3\\) report) Tj 0 -14 Td [(Rev)20(enue) -300 (grew)] TJ <00410042> Tj ET")
+	text, err := ExtractPDFText(pdf)
+	require.NoError(t, err)
+	assert.Equal(t, "Quarterly (Q3) report\nRevenue grewAB", text)
+
+	_, err = ExtractPDFText([]byte("hello"))
+	assert.Error(t, err)
+}
+
+func TestFromBase64(t *testing.T) {
+	pdf := makePDF(t, "BT (x) Tj ET")
+	media, err := Fetch((&Media{MimeType: MimeTypeOctetStream, Data: pdf}).DataURL())
+	require.NoError(t, err)
+	assert.True(t, media.IsPDF())
+
+	media, err = FromBase64("UklGRiQAAABXQVZFZm10IBAAAAABAAEAQB8AAIA+AAACABAAZGF0YQAAAAA=", "")
+	require.NoError(t, err)
+	assert.Equal(t, "audio/wav", media.MimeType)
+
+	_, err = Fetch("data:image/png,plain")
+	assert.Error(t, err)
+}
+
+func TestFetchRefusesPrivateAddresses(t *testing.T) {
+	_, err := Fetch("http://127.0.0.1:1/secret")
+	assert.ErrorIs(t, err, ErrPrivateAddress)
+	_, err = Fetch("file:///etc/passwd")
+	assert.Error(t, err)
+}
@@ -0,0 +1,205 @@
+package media
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var (
+	streamPattern     = regexp.MustCompile(`(?s)<<(.*?)>>\s*stream\r?\n`)
+	blankLinesPattern = regexp.MustCompile(`\n{3,}`)
+)
+
+// ExtractPDFText gets the text of the content streams of a pdf, for the models which can't read documents.
+// It is a best effort: the text of fonts with custom encodings, and of scanned pages, can't be read this way.
+func ExtractPDFText(data []byte) (string, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return "", errors.New("not a pdf file")
+	}
+	var text strings.Builder
+	for _, loc := range streamPattern.FindAllSubmatchIndex(data, -1) {
+		dict := data[loc[2]:loc[3]]
+		start := loc[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		content := data[start : start+end]
+		if bytes.Contains(dict, []byte("/Filter")) {
+			if !bytes.Contains(dict, []byte("/FlateDecode")) {
+				// images and fonts
+				continue
+			}
+			reader, err := zlib.NewReader(bytes.NewReader(content))
+			if err != nil {
+				continue
+			}
+			// truncated streams still give their first pages
+			content, _ = io.ReadAll(reader)
+		}
+		if !bytes.Contains(content, []byte("BT")) {
+			continue
+		}
+		extractContentText(content, &text)
+	}
+	result := strings.TrimSpace(blankLinesPattern.ReplaceAllString(text.String(), "\n\n"))
+	if result == "" {
+		return "", errors.New("no text found in the pdf file")
+	}
+	return result, nil
+}
+
+// extractContentText follows the text showing operators of a content stream
+func extractContentText(content []byte, text *strings.Builder) {
+	var operands []string
+	for i := 0; i < len(content); {
+		ch := content[i]
+		switch {
+		case ch == '(':
+			s, next := readLiteralString(content, i)
+			operands = append(operands, s)
+			i = next
+		case ch == '<' && i+1 < len(content) && content[i+1] != '<':
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				return
+			}
+			operands = append(operands, decodeHexString(content[i+1:i+end]))
+			i += end + 1
+		case ch == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case isOperatorChar(ch):
+			start := i
+			for i < len(content) && isOperatorChar(content[i]) {
+				i++
+			}
+			switch string(content[start:i]) {
+			case "Tj", "TJ":
+				text.WriteString(strings.Join(operands, ""))
+				operands = nil
+			case "'", "\"":
+				text.WriteString("\n" + strings.Join(operands, ""))
+				operands = nil
+			case "T*", "Td", "TD":
+				text.WriteString("\n")
+				operands = nil
+			case "ET":
+				text.WriteString("\n")
+				operands = nil
+			default:
+				operands = nil
+			}
+		case ch == '-' && i+1 < len(content) && isDigit(content[i+1]):
+			// kerning in TJ arrays, large negative offsets are spaces between words
+			start := i
+			i++
+			for i < len(content) && (isDigit(content[i]) || content[i] == '.') {
+				i++
+			}
+			if i-start > 3 {
+				operands = append(operands, " ")
+			}
+		default:
+			i++
+		}
+	}
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isOperatorChar(ch byte) bool {
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch == '*' || ch == '\'' || ch == '"'
+}
+
+func readLiteralString(content []byte, i int) (string, int) {
+	var s strings.Builder
+	depth := 0
+	for i < len(content) {
+		ch := content[i]
+		switch ch {
+		case '\\':
+			i++
+			if i >= len(content) {
+				break
+			}
+			switch escaped := content[i]; escaped {
+			case 'n':
+				s.WriteByte('\n')
+			case 'r', 't', 'b', 'f':
+				s.WriteByte(' ')
+			case '\r', '\n':
+			default:
+				if escaped >= '0' && escaped <= '7' {
+					value := 0
+					for j := 0; j < 3 && i < len(content) && content[i] >= '0' && content[i] <= '7'; j++ {
+						value = value*8 + int(content[i]-'0')
+						i++
+					}
+					writePDFByte(&s, byte(value))
+					continue
+				}
+				s.WriteByte(escaped)
+			}
+		case '(':
+			if depth > 0 {
+				s.WriteByte(ch)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return s.String(), i + 1
+			}
+			s.WriteByte(ch)
+		default:
+			writePDFByte(&s, ch)
+		}
+		i++
+	}
+	return s.String(), i
+}
+
+// writePDFByte writes a byte of the standard encodings, which match latin-1 for the printable characters
+func writePDFByte(s *strings.Builder, b byte) {
+	if b >= 0x20 && b != 0x7f {
+		s.WriteRune(rune(b))
+	}
+}
+
+func decodeHexString(data []byte) string {
+	data = bytes.Map(func(r rune) rune {
+		if r == ' ' || r == '\n' || r == '\r' || r == '\t' {
+			return -1
+		}
+		return r
+	}, data)
+	if len(data)%2 == 1 {
+		data = append(data, '0')
+	}
+	decoded := make([]byte, hex.DecodedLen(len(data)))
+	if _, err := hex.Decode(decoded, data); err != nil {
+		return ""
+	}
+	// two byte codes are used by identity encoded fonts, the latin characters have a zero high byte
+	twoBytes := len(decoded)%2 == 0 && len(decoded) > 0
+	for i := 0; twoBytes && i < len(decoded); i += 2 {
+		twoBytes = decoded[i] == 0
+	}
+	var s strings.Builder
+	for i, b := range decoded {
+		if twoBytes && i%2 == 0 {
+			continue
+		}
+		writePDFByte(&s, b)
+	}
+	return s.String()
+}
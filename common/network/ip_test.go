@@ -2,6 +2,7 @@ package network
 
 import (
 	"context"
+	"net"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -17,3 +18,14 @@ func TestIsIpInSubnet(t *testing.T) {
 		So(isIpInSubnet(ctx, ip2, subnet), ShouldBeFalse)
 	})
 }
+
+func TestIsPrivateIP(t *testing.T) {
+	Convey("TestIsPrivateIP", t, func() {
+		for _, ip := range []string{"127.0.0.1", "10.1.2.3", "192.168.0.5", "169.254.169.254", "100.64.0.1", "0.0.0.0", "::1", "fd00::1", "fe80::1"} {
+			So(IsPrivateIP(net.ParseIP(ip)), ShouldBeTrue)
+		}
+		for _, ip := range []string{"125.216.250.89", "8.8.8.8", "2001:4860:4860::8888"} {
+			So(IsPrivateIP(net.ParseIP(ip)), ShouldBeFalse)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// unsignedPayload lets us stream large bodies without hashing them first
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3Storage talks to any S3-compatible endpoint (AWS S3, MinIO, R2, OSS ...) with path-style urls
+type S3Storage struct {
+	endpoint    string
+	region      string
+	bucket      string
+	credentials aws.Credentials
+	signer      *v4.Signer
+	client      *http.Client
+}
+
+func NewS3Storage(endpoint string, region string, bucket string, accessKey string, secretKey string) *S3Storage {
+	return &S3Storage{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		region:   region,
+		bucket:   bucket,
+		credentials: aws.Credentials{
+			AccessKeyID:     accessKey,
+			SecretAccessKey: secretKey,
+		},
+		signer: v4.NewSigner(),
+		client: &http.Client{},
+	}
+}
+
+func (s *S3Storage) objectURL(key string) string {
+	return fmt.Sprintf("%s/%s/%s", s.endpoint, s.bucket, (&url.URL{Path: strings.TrimPrefix(key, "/")}).EscapedPath())
+}
+
+func (s *S3Storage) do(ctx context.Context, method string, key string, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	req.Header.Set("x-amz-content-sha256", unsignedPayload)
+	err = s.signer.SignHTTP(ctx, s.credentials, req, unsignedPayload, "s3", s.region, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s failed with status code %d: %s", method, key, resp.StatusCode, string(respBody))
+	}
+	return resp, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, reader io.Reader, size int64) error {
+	resp, err := s.do(ctx, http.MethodPut, key, reader, size)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,40 @@
+// Package storage keeps user uploaded files on local disk or an S3-compatible backend
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+type Storage interface {
+	Put(ctx context.Context, key string, reader io.Reader, size int64) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var defaultStorage Storage
+
+func Init() {
+	switch config.FileStorageType {
+	case "s3":
+		if config.S3Endpoint == "" || config.S3Bucket == "" {
+			logger.FatalLog("FILE_STORAGE_TYPE is s3 but S3_ENDPOINT or S3_BUCKET is not set")
+		}
+		logger.SysLog(fmt.Sprintf("using s3 bucket %s as file storage", config.S3Bucket))
+		defaultStorage = NewS3Storage(config.S3Endpoint, config.S3Region, config.S3Bucket, config.S3AccessKey, config.S3SecretKey)
+	default:
+		logger.SysLog(fmt.Sprintf("using %s as file storage", config.FileStoragePath))
+		defaultStorage = NewLocalStorage(config.FileStoragePath)
+	}
+}
+
+func GetStorage() Storage {
+	if defaultStorage == nil {
+		Init()
+	}
+	return defaultStorage
+}
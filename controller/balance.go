@@ -220,6 +220,8 @@ func AdminUpdateModelPricing(c *gin.Context) {
 		return
 	}
 
+	// the prices set by admins are kept by the model sync
+	pricing.Source = ""
 	err := model.CreateOrUpdateModelPricing(c.Request.Context(), &pricing)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -0,0 +1,425 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/common/storage"
+	"github.com/songquanpeng/one-api/middleware"
+	"github.com/songquanpeng/one-api/model"
+	smartRouter "github.com/songquanpeng/one-api/pkg/router"
+)
+
+type batchResultResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestId  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type batchResultError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// batchResultLine is one line of the batch output or error file
+type batchResultLine struct {
+	Id       string               `json:"id"`
+	CustomId string               `json:"custom_id"`
+	Response *batchResultResponse `json:"response"`
+	Error    *batchResultError    `json:"error"`
+}
+
+// batchResultWriter spools results to a temp file, workers write to it concurrently
+type batchResultWriter struct {
+	sync.Mutex
+	file  *os.File
+	count int
+}
+
+func newBatchResultWriter() (*batchResultWriter, error) {
+	file, err := os.CreateTemp("", "one-api-batch-*.jsonl")
+	if err != nil {
+		return nil, err
+	}
+	return &batchResultWriter{file: file}, nil
+}
+
+func (w *batchResultWriter) Write(line *batchResultLine) error {
+	jsonData, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	w.Lock()
+	defer w.Unlock()
+	w.count++
+	_, err = w.file.Write(append(jsonData, '\n'))
+	return err
+}
+
+// Save uploads the spooled results as a batch_output file, returns "" if nothing was written
+func (w *batchResultWriter) Save(ctx context.Context, batch *model.Batch, filename string) (string, error) {
+	defer os.Remove(w.file.Name())
+	defer w.file.Close()
+	if w.count == 0 {
+		return "", nil
+	}
+	size, err := w.file.Seek(0, 1)
+	if err != nil {
+		return "", err
+	}
+	if _, err = w.file.Seek(0, 0); err != nil {
+		return "", err
+	}
+	file, err := saveFile(ctx, batch.UserId, filename, model.FilePurposeBatchOutput, w.file, size)
+	if err != nil {
+		return "", err
+	}
+	return file.Id, nil
+}
+
+var runningBatches sync.Map
+
+// StartBatchExecutor picks up unfinished batches, it should only run on the master node
+func StartBatchExecutor() {
+	recoverInterruptedBatches()
+	for {
+		time.Sleep(time.Duration(config.BatchPollInterval) * time.Second)
+		batches, err := model.GetUnfinishedBatches()
+		if err != nil {
+			logger.SysError("failed to get unfinished batches: " + err.Error())
+			continue
+		}
+		for _, batch := range batches {
+			if _, running := runningBatches.LoadOrStore(batch.Id, true); running {
+				continue
+			}
+			go func(batch *model.Batch) {
+				defer runningBatches.Delete(batch.Id)
+				ctx := helper.SetRequestID(context.Background(), helper.GenRequestID())
+				if batch.UpstreamId != "" {
+					pollUpstreamBatch(ctx, batch)
+				} else {
+					runLocalBatch(ctx, batch)
+				}
+			}(batch)
+		}
+	}
+}
+
+// recoverInterruptedBatches fails local batches left running by the last process,
+// re-running them would bill the finished lines twice
+func recoverInterruptedBatches() {
+	batches, err := model.GetUnfinishedBatches()
+	if err != nil {
+		logger.SysError("failed to get unfinished batches: " + err.Error())
+		return
+	}
+	for _, batch := range batches {
+		if batch.UpstreamId == "" && batch.Status != model.BatchStatusValidating {
+			failBatch(context.Background(), batch, "batch was interrupted by a server restart")
+		}
+	}
+}
+
+func failBatch(ctx context.Context, batch *model.Batch, message string) {
+	logger.Errorf(ctx, "batch %s failed: %s", batch.Id, message)
+	batch.Status = model.BatchStatusFailed
+	batch.FailedAt = helper.GetTimestamp()
+	batch.ErrorMessage = message
+	if err := batch.Update(); err != nil {
+		logger.Errorf(ctx, "batch %s: failed to update: %s", batch.Id, err.Error())
+	}
+}
+
+func getBatchDistributor() gin.HandlerFunc {
+	if engine := smartRouter.GetGlobalEngine(); engine != nil {
+		return middleware.SmartDistribute(engine)
+	}
+	return middleware.Distribute()
+}
+
+// executeBatchLine runs one request through the normal relay pipeline, including distribution, retry & billing
+func executeBatchLine(ctx context.Context, batch *model.Batch, token *model.Token, line *BatchRequestLine) (int, []byte, string) {
+	// batch requests are never streamed
+	delete(line.Body, "stream")
+	delete(line.Body, "stream_options")
+	body, _ := json.Marshal(line.Body)
+	requestId := helper.GenRequestID()
+	req, err := http.NewRequestWithContext(helper.SetRequestID(ctx, requestId), http.MethodPost, line.Url, bytes.NewReader(body))
+	if err != nil {
+		return http.StatusInternalServerError, nil, requestId
+	}
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = req
+	modelName, _ := line.Body["model"].(string)
+	c.Set(helper.RequestIdKey, requestId)
+	c.Set(ctxkey.BatchId, batch.Id)
+	if err = middleware.SetTokenContext(c, token, modelName); err != nil {
+		relayErrorResponse(c, http.StatusForbidden, "model_not_allowed", err.Error())
+		return recorder.Code, recorder.Body.Bytes(), requestId
+	}
+	getBatchDistributor()(c)
+	if !c.IsAborted() {
+		Relay(c)
+	}
+	return recorder.Code, recorder.Body.Bytes(), requestId
+}
+
+func newBatchResultLine(customId string, statusCode int, body []byte, requestId string) *batchResultLine {
+	if !json.Valid(body) {
+		body, _ = json.Marshal(string(body))
+	}
+	return &batchResultLine{
+		Id:       "batch_req_" + random.GetUUID(),
+		CustomId: customId,
+		Response: &batchResultResponse{
+			StatusCode: statusCode,
+			RequestId:  requestId,
+			Body:       body,
+		},
+	}
+}
+
+// setBatchStatus moves the batch to status unless it was cancelled concurrently, the batch is then left cancelling
+// and false is returned. Only CancelBatch changes the status of a running local batch.
+func setBatchStatus(ctx context.Context, batch *model.Batch, status string) bool {
+	previous := batch.Status
+	batch.Status = status
+	updated, err := batch.UpdateIfStatus(previous)
+	if err != nil {
+		logger.Errorf(ctx, "batch %s: failed to update: %s", batch.Id, err.Error())
+		return true
+	}
+	if !updated {
+		logger.Infof(ctx, "batch %s: cancelled while %s", batch.Id, previous)
+		batch.Status = model.BatchStatusCancelling
+	}
+	return updated
+}
+
+func cancelLocalBatch(ctx context.Context, batch *model.Batch) {
+	batch.CancelledAt = helper.GetTimestamp()
+	setBatchStatus(ctx, batch, model.BatchStatusCancelled)
+}
+
+// batchStopper tells when a local batch has to stop sending requests, the status is read before every request
+type batchStopper struct {
+	sync.Mutex
+	batch  *model.Batch
+	status string
+}
+
+// stopped returns model.BatchStatusCancelled or model.BatchStatusExpired once the batch was found stopped
+func (s *batchStopper) stopped() string {
+	s.Lock()
+	defer s.Unlock()
+	return s.status
+}
+
+// check reads the status of the batch, unless it was found stopped already
+func (s *batchStopper) check() string {
+	s.Lock()
+	defer s.Unlock()
+	if s.status != "" {
+		return s.status
+	}
+	if status, err := model.GetBatchStatus(s.batch.Id); err == nil && status == model.BatchStatusCancelling {
+		s.status = model.BatchStatusCancelled
+	} else if helper.GetTimestamp() > s.batch.ExpiresAt {
+		s.status = model.BatchStatusExpired
+	}
+	return s.status
+}
+
+func (s *batchStopper) stop(status string) {
+	s.Lock()
+	defer s.Unlock()
+	s.status = status
+}
+
+func newBatchStoppedLine(customId string, status string) *batchResultLine {
+	code := "batch_cancelled"
+	if status == model.BatchStatusExpired {
+		code = "batch_expired"
+	}
+	return &batchResultLine{
+		Id:       "batch_req_" + random.GetUUID(),
+		CustomId: customId,
+		Error: &batchResultError{
+			Code:    code,
+			Message: fmt.Sprintf("This request could not be executed before the batch was %s.", status),
+		},
+	}
+}
+
+func runLocalBatch(ctx context.Context, batch *model.Batch) {
+	if batch.Status == model.BatchStatusCancelling {
+		cancelLocalBatch(ctx, batch)
+		return
+	}
+	token, err := model.GetTokenById(batch.TokenId)
+	if err != nil {
+		failBatch(ctx, batch, "token not found")
+		return
+	}
+	if _, err = model.ValidateUserToken(token.Key); err != nil {
+		failBatch(ctx, batch, err.Error())
+		return
+	}
+	inputFile, err := model.GetFileByIds(batch.InputFileId, batch.UserId)
+	if err != nil {
+		failBatch(ctx, batch, "input file not found")
+		return
+	}
+	reader, err := storage.GetStorage().Get(ctx, inputFile.StorageKey)
+	if err != nil {
+		failBatch(ctx, batch, "failed to read input file")
+		return
+	}
+	defer reader.Close()
+	batch.InProgressAt = helper.GetTimestamp()
+	if !setBatchStatus(ctx, batch, model.BatchStatusInProgress) {
+		// cancelled before the first request was sent
+		batch.InProgressAt = 0
+		cancelLocalBatch(ctx, batch)
+		return
+	}
+	logger.Infof(ctx, "batch %s started with %d requests", batch.Id, batch.TotalCount)
+	outputWriter, err := newBatchResultWriter()
+	if err != nil {
+		failBatch(ctx, batch, "failed to create output file")
+		return
+	}
+	errorWriter, err := newBatchResultWriter()
+	if err != nil {
+		failBatch(ctx, batch, "failed to create error file")
+		return
+	}
+
+	var completed, failed int64
+	writeResult := func(result *batchResultLine, ok bool) {
+		writer := errorWriter
+		if ok {
+			writer = outputWriter
+			atomic.AddInt64(&completed, 1)
+		} else {
+			atomic.AddInt64(&failed, 1)
+		}
+		if err := writer.Write(result); err != nil {
+			logger.Errorf(ctx, "batch %s: failed to write result: %s", batch.Id, err.Error())
+		}
+	}
+
+	requestsPerMinute := config.BatchRequestsPerMinute
+	if requestsPerMinute <= 0 {
+		requestsPerMinute = 60
+	}
+	limiter := time.NewTicker(time.Minute / time.Duration(requestsPerMinute))
+	defer limiter.Stop()
+	workerNum := config.BatchWorkerNum
+	if workerNum <= 0 {
+		workerNum = 1
+	}
+	stopper := &batchStopper{batch: batch}
+	lines := make(chan *BatchRequestLine, workerNum)
+	var wg sync.WaitGroup
+	for i := 0; i < workerNum; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for line := range lines {
+				// the lines left once the batch is stopped are answered without waiting for the limiter
+				if stopper.stopped() == "" {
+					<-limiter.C
+				}
+				if status := stopper.check(); status != "" {
+					writeResult(newBatchStoppedLine(line.CustomId, status), false)
+					continue
+				}
+				statusCode, body, requestId := executeBatchLine(ctx, batch, token, line)
+				writeResult(newBatchResultLine(line.CustomId, statusCode, body, requestId), statusCode/100 == 2)
+			}
+		}()
+	}
+
+	progressDone := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-progressDone:
+				return
+			case <-ticker.C:
+				_ = model.UpdateBatchProgress(batch.Id, int(atomic.LoadInt64(&completed)), int(atomic.LoadInt64(&failed)))
+			}
+		}
+	}()
+
+	err = readBatchLines(reader, func(lineNo int, raw []byte) error {
+		requestLine, err := parseBatchLine(raw)
+		if err != nil {
+			// the file was validated on creation, this should never happen
+			return err
+		}
+		lines <- requestLine
+		return nil
+	})
+	close(lines)
+	wg.Wait()
+	close(progressDone)
+	if err != nil {
+		failBatch(ctx, batch, fmt.Sprintf("failed to read input file: %s", err.Error()))
+		return
+	}
+
+	batch.FinalizingAt = helper.GetTimestamp()
+	batch.CompletedCount = int(atomic.LoadInt64(&completed))
+	batch.FailedCount = int(atomic.LoadInt64(&failed))
+	if !setBatchStatus(ctx, batch, model.BatchStatusFinalizing) {
+		// the cancel came after the last request, the results are still kept
+		stopper.stop(model.BatchStatusCancelled)
+	}
+
+	batch.OutputFileId, err = outputWriter.Save(ctx, batch, batch.Id+"_output.jsonl")
+	if err != nil {
+		failBatch(ctx, batch, "failed to save output file")
+		return
+	}
+	batch.ErrorFileId, err = errorWriter.Save(ctx, batch, batch.Id+"_error.jsonl")
+	if err != nil {
+		failBatch(ctx, batch, "failed to save error file")
+		return
+	}
+	now := helper.GetTimestamp()
+	status := model.BatchStatusCompleted
+	switch stopper.stopped() {
+	case model.BatchStatusCancelled:
+		status = model.BatchStatusCancelled
+		batch.CancelledAt = now
+	case model.BatchStatusExpired:
+		status = model.BatchStatusExpired
+		batch.ExpiredAt = now
+	default:
+		batch.CompletedAt = now
+	}
+	setBatchStatus(ctx, batch, status)
+	logger.Infof(ctx, "batch %s %s, %d completed, %d failed", batch.Id, batch.Status, batch.CompletedCount, batch.FailedCount)
+}
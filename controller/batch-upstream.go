@@ -0,0 +1,346 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/storage"
+	"github.com/songquanpeng/one-api/model"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// upstreamBatch is the subset of the OpenAI batch object we need
+type upstreamBatch struct {
+	Id            string             `json:"id"`
+	Status        string             `json:"status"`
+	OutputFileId  string             `json:"output_file_id"`
+	ErrorFileId   string             `json:"error_file_id"`
+	RequestCounts BatchRequestCounts `json:"request_counts"`
+	Errors        *struct {
+		Data []struct {
+			Message string `json:"message"`
+		} `json:"data"`
+	} `json:"errors"`
+	Error *relaymodel.Error `json:"error"`
+}
+
+type batchResponseLine struct {
+	CustomId string `json:"custom_id"`
+	Response *struct {
+		StatusCode int `json:"status_code"`
+		Body       struct {
+			Model string            `json:"model"`
+			Usage *relaymodel.Usage `json:"usage"`
+		} `json:"body"`
+	} `json:"response"`
+}
+
+// supportsBatchPassthrough reports whether the channel exposes an OpenAI compatible batch api
+func supportsBatchPassthrough(channelType int) bool {
+	return channelType == channeltype.OpenAI
+}
+
+func selectBatchPassthroughChannel(c *gin.Context, modelName string) *model.Channel {
+	group, err := model.CacheGetUserGroup(c.GetInt(ctxkey.Id))
+	if err != nil {
+		return nil
+	}
+	channel, err := model.CacheGetRandomSatisfiedChannel(group, modelName, false)
+	if err != nil || !supportsBatchPassthrough(channel.Type) {
+		return nil
+	}
+	// the input file would have to be rewritten for a mapped model, let the local executor handle it
+	if mapping := channel.GetModelMapping(); mapping != nil && mapping[modelName] != "" {
+		return nil
+	}
+	return channel
+}
+
+func getChannelBaseURL(channel *model.Channel) string {
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" {
+		baseURL = channeltype.ChannelBaseURLs[channel.Type]
+	}
+	return strings.TrimSuffix(baseURL, "/")
+}
+
+func doUpstreamBatchRequest(ctx context.Context, channel *model.Channel, method string, path string, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, getChannelBaseURL(channel)+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+channel.Key)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		responseBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("upstream %s %s failed with status code %d: %s", method, path, resp.StatusCode, string(responseBody))
+	}
+	return resp, nil
+}
+
+func doUpstreamBatchJSON(ctx context.Context, channel *model.Channel, method string, path string, request any, response any) error {
+	var body io.Reader
+	contentType := ""
+	if request != nil {
+		jsonData, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(jsonData)
+		contentType = "application/json"
+	}
+	resp, err := doUpstreamBatchRequest(ctx, channel, method, path, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+func uploadUpstreamFile(ctx context.Context, channel *model.Channel, file *model.File) (string, error) {
+	reader, err := storage.GetStorage().Get(ctx, file.StorageKey)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	_ = writer.WriteField("purpose", model.FilePurposeBatch)
+	part, err := writer.CreateFormFile("file", file.Filename)
+	if err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(part, reader); err != nil {
+		return "", err
+	}
+	if err = writer.Close(); err != nil {
+		return "", err
+	}
+	resp, err := doUpstreamBatchRequest(ctx, channel, http.MethodPost, "/v1/files", writer.FormDataContentType(), body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var uploaded OpenAIFile
+	if err = json.NewDecoder(resp.Body).Decode(&uploaded); err != nil {
+		return "", err
+	}
+	return uploaded.Id, nil
+}
+
+func createUpstreamBatch(ctx context.Context, channel *model.Channel, batch *model.Batch, inputFile *model.File) error {
+	upstreamFileId, err := uploadUpstreamFile(ctx, channel, inputFile)
+	if err != nil {
+		return err
+	}
+	request := BatchCreateRequest{
+		InputFileId:      upstreamFileId,
+		Endpoint:         batch.Endpoint,
+		CompletionWindow: batch.CompletionWindow,
+	}
+	var response upstreamBatch
+	err = doUpstreamBatchJSON(ctx, channel, http.MethodPost, "/v1/batches", request, &response)
+	if err != nil {
+		return err
+	}
+	if response.Id == "" {
+		return fmt.Errorf("upstream returned no batch id")
+	}
+	batch.ChannelId = channel.Id
+	batch.UpstreamId = response.Id
+	logger.Infof(ctx, "batch %s passed through to channel #%d as %s", batch.Id, channel.Id, response.Id)
+	return nil
+}
+
+// downloadUpstreamFile copies an upstream output file into our storage
+func downloadUpstreamFile(ctx context.Context, channel *model.Channel, batch *model.Batch, upstreamFileId string) (string, []byte, error) {
+	resp, err := doUpstreamBatchRequest(ctx, channel, http.MethodGet, fmt.Sprintf("/v1/files/%s/content", upstreamFileId), "", nil)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, err
+	}
+	file, err := saveFile(ctx, batch.UserId, fmt.Sprintf("%s_%s.jsonl", batch.Id, upstreamFileId), model.FilePurposeBatchOutput, bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", nil, err
+	}
+	return file.Id, content, nil
+}
+
+// saveUpstreamOutput keeps the output file and bills its lines, the output of a batch is billed once
+// even when the poll fails afterwards and the batch is polled again
+func saveUpstreamOutput(ctx context.Context, channel *model.Channel, batch *model.Batch, upstreamFileId string) error {
+	if batch.OutputBilled {
+		return nil
+	}
+	fileId, content, err := downloadUpstreamFile(ctx, channel, batch, upstreamFileId)
+	if err != nil {
+		return err
+	}
+	claimed, err := model.SetBatchOutputFile(batch.Id, fileId)
+	if err != nil {
+		return err
+	}
+	batch.OutputBilled = true
+	if !claimed {
+		// billed by a concurrent poll, keep the file it saved
+		stored, err := model.GetBatchById(batch.Id)
+		if err != nil {
+			return err
+		}
+		batch.OutputFileId = stored.OutputFileId
+		return nil
+	}
+	batch.OutputFileId = fileId
+	billBatchOutput(ctx, channel, batch, content)
+	return nil
+}
+
+func billBatchOutput(ctx context.Context, channel *model.Channel, batch *model.Batch, content []byte) {
+	_ = readBatchLines(bytes.NewReader(content), func(lineNo int, line []byte) error {
+		var responseLine batchResponseLine
+		if err := json.Unmarshal(line, &responseLine); err != nil {
+			logger.Warnf(ctx, "batch %s: failed to parse output line %d: %s", batch.Id, lineNo, err.Error())
+			return nil
+		}
+		if responseLine.Response != nil && responseLine.Response.Body.Usage != nil {
+			billBatchUsage(ctx, batch, channel, responseLine.Response.Body.Usage)
+		}
+		return nil
+	})
+}
+
+// billBatchUsage bills one passed through request, local requests are billed by the relay itself
+func billBatchUsage(ctx context.Context, batch *model.Batch, channel *model.Channel, usage *relaymodel.Usage) {
+	group, _ := model.CacheGetUserGroup(batch.UserId)
+	modelRatio := billingratio.GetModelRatio(batch.Model, channel.Type)
+	groupRatio := billingratio.GetGroupRatio(group)
+	completionRatio := billingratio.GetCompletionRatio(batch.Model, channel.Type)
+	ratio := modelRatio * groupRatio * config.BatchRatio
+	quota := int64(math.Ceil((float64(usage.PromptTokens) + float64(usage.CompletionTokens)*completionRatio) * ratio))
+	if ratio != 0 && quota <= 0 {
+		quota = 1
+	}
+	err := model.PostConsumeTokenQuota(batch.TokenId, quota)
+	if err != nil {
+		logger.Error(ctx, "error consuming token remain quota: "+err.Error())
+	}
+	err = model.CacheUpdateUserQuota(ctx, batch.UserId)
+	if err != nil {
+		logger.Error(ctx, "error update user quota cache: "+err.Error())
+	}
+	tokenName := ""
+	if token, err := model.GetTokenById(batch.TokenId); err == nil {
+		tokenName = token.Name
+	}
+	model.RecordConsumeLog(ctx, &model.Log{
+		UserId:           batch.UserId,
+		ChannelId:        channel.Id,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		ModelName:        batch.Model,
+		TokenName:        tokenName,
+		Quota:            int(quota),
+		Content:          fmt.Sprintf("倍率：%.2f × %.2f × %.2f，批处理 %s × %.2f", modelRatio, groupRatio, completionRatio, batch.Id, config.BatchRatio),
+	})
+	model.UpdateUserUsedQuotaAndRequestCount(batch.UserId, quota)
+	model.UpdateChannelUsedQuota(channel.Id, quota)
+}
+
+func pollUpstreamBatch(ctx context.Context, batch *model.Batch) {
+	channel, err := model.GetChannelById(batch.ChannelId, true)
+	if err != nil {
+		failBatch(ctx, batch, fmt.Sprintf("channel #%d not found", batch.ChannelId))
+		return
+	}
+	var upstream upstreamBatch
+	err = doUpstreamBatchJSON(ctx, channel, http.MethodGet, fmt.Sprintf("/v1/batches/%s", batch.UpstreamId), nil, &upstream)
+	if err != nil {
+		logger.Warnf(ctx, "batch %s: failed to poll upstream batch: %s", batch.Id, err.Error())
+		return
+	}
+	if batch.Status == model.BatchStatusCancelling &&
+		(upstream.Status == model.BatchStatusValidating || upstream.Status == model.BatchStatusInProgress) {
+		err = doUpstreamBatchJSON(ctx, channel, http.MethodPost, fmt.Sprintf("/v1/batches/%s/cancel", batch.UpstreamId), nil, &upstream)
+		if err != nil {
+			logger.Warnf(ctx, "batch %s: failed to cancel upstream batch: %s", batch.Id, err.Error())
+		}
+	}
+	status := batch.Status
+	now := helper.GetTimestamp()
+	batch.CompletedCount = upstream.RequestCounts.Completed
+	batch.FailedCount = upstream.RequestCounts.Failed
+	switch upstream.Status {
+	case model.BatchStatusValidating, model.BatchStatusFinalizing:
+		// keep our own status, especially cancelling
+	case model.BatchStatusInProgress:
+		if batch.Status == model.BatchStatusValidating {
+			batch.Status = model.BatchStatusInProgress
+			batch.InProgressAt = now
+		}
+	case model.BatchStatusCancelling:
+		batch.Status = model.BatchStatusCancelling
+	case model.BatchStatusCompleted, model.BatchStatusExpired, model.BatchStatusCancelled:
+		if upstream.OutputFileId != "" {
+			if err = saveUpstreamOutput(ctx, channel, batch, upstream.OutputFileId); err != nil {
+				logger.Errorf(ctx, "batch %s: failed to download output file: %s", batch.Id, err.Error())
+				return
+			}
+		}
+		if upstream.ErrorFileId != "" {
+			batch.ErrorFileId, _, err = downloadUpstreamFile(ctx, channel, batch, upstream.ErrorFileId)
+			if err != nil {
+				logger.Errorf(ctx, "batch %s: failed to download error file: %s", batch.Id, err.Error())
+				return
+			}
+		}
+		batch.Status = upstream.Status
+		switch upstream.Status {
+		case model.BatchStatusCompleted:
+			batch.CompletedAt = now
+		case model.BatchStatusExpired:
+			batch.ExpiredAt = now
+		case model.BatchStatusCancelled:
+			batch.CancelledAt = now
+		}
+	case model.BatchStatusFailed:
+		message := "upstream batch failed"
+		if upstream.Errors != nil && len(upstream.Errors.Data) > 0 {
+			message = upstream.Errors.Data[0].Message
+		}
+		failBatch(ctx, batch, message)
+		return
+	}
+	updated, err := batch.UpdateIfStatus(status)
+	if err != nil {
+		logger.Errorf(ctx, "batch %s: failed to update: %s", batch.Id, err.Error())
+	} else if !updated {
+		logger.Infof(ctx, "batch %s: status changed while polling, it is updated on the next poll", batch.Id)
+	}
+}
@@ -0,0 +1,374 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/common/storage"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// https://platform.openai.com/docs/api-reference/batch
+
+var batchEndpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/completions":      true,
+	"/v1/embeddings":       true,
+}
+
+const batchCompletionWindow = "24h"
+
+type BatchCreateRequest struct {
+	InputFileId      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+// BatchRequestLine is one line of the batch input file
+type BatchRequestLine struct {
+	CustomId string         `json:"custom_id"`
+	Method   string         `json:"method"`
+	Url      string         `json:"url"`
+	Body     map[string]any `json:"body"`
+}
+
+type BatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+type OpenAIBatch struct {
+	Id               string             `json:"id"`
+	Object           string             `json:"object"`
+	Endpoint         string             `json:"endpoint"`
+	Errors           any                `json:"errors"`
+	InputFileId      string             `json:"input_file_id"`
+	CompletionWindow string             `json:"completion_window"`
+	Status           string             `json:"status"`
+	OutputFileId     *string            `json:"output_file_id"`
+	ErrorFileId      *string            `json:"error_file_id"`
+	CreatedAt        int64              `json:"created_at"`
+	InProgressAt     *int64             `json:"in_progress_at"`
+	ExpiresAt        *int64             `json:"expires_at"`
+	FinalizingAt     *int64             `json:"finalizing_at"`
+	CompletedAt      *int64             `json:"completed_at"`
+	FailedAt         *int64             `json:"failed_at"`
+	ExpiredAt        *int64             `json:"expired_at"`
+	CancellingAt     *int64             `json:"cancelling_at"`
+	CancelledAt      *int64             `json:"cancelled_at"`
+	RequestCounts    BatchRequestCounts `json:"request_counts"`
+	Metadata         map[string]string  `json:"metadata"`
+}
+
+func nullableString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func nullableTimestamp(t int64) *int64 {
+	if t == 0 {
+		return nil
+	}
+	return &t
+}
+
+func toOpenAIBatch(batch *model.Batch) OpenAIBatch {
+	openaiBatch := OpenAIBatch{
+		Id:               batch.Id,
+		Object:           "batch",
+		Endpoint:         batch.Endpoint,
+		InputFileId:      batch.InputFileId,
+		CompletionWindow: batch.CompletionWindow,
+		Status:           batch.Status,
+		OutputFileId:     nullableString(batch.OutputFileId),
+		ErrorFileId:      nullableString(batch.ErrorFileId),
+		CreatedAt:        batch.CreatedAt,
+		InProgressAt:     nullableTimestamp(batch.InProgressAt),
+		ExpiresAt:        nullableTimestamp(batch.ExpiresAt),
+		FinalizingAt:     nullableTimestamp(batch.FinalizingAt),
+		CompletedAt:      nullableTimestamp(batch.CompletedAt),
+		FailedAt:         nullableTimestamp(batch.FailedAt),
+		ExpiredAt:        nullableTimestamp(batch.ExpiredAt),
+		CancellingAt:     nullableTimestamp(batch.CancellingAt),
+		CancelledAt:      nullableTimestamp(batch.CancelledAt),
+		RequestCounts: BatchRequestCounts{
+			Total:     batch.TotalCount,
+			Completed: batch.CompletedCount,
+			Failed:    batch.FailedCount,
+		},
+	}
+	if batch.ErrorMessage != "" {
+		openaiBatch.Errors = gin.H{
+			"object": "list",
+			"data": []gin.H{{
+				"code":    "batch_failed",
+				"message": batch.ErrorMessage,
+			}},
+		}
+	}
+	if batch.Metadata != "" {
+		_ = json.Unmarshal([]byte(batch.Metadata), &openaiBatch.Metadata)
+	}
+	return openaiBatch
+}
+
+// readBatchLines calls fn for every non-empty line of the input file, line numbers start from 1
+func readBatchLines(reader io.Reader, fn func(lineNo int, line []byte) error) error {
+	bufReader := bufio.NewReader(reader)
+	lineNo := 0
+	for {
+		line, err := bufReader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			lineNo++
+			if fnErr := fn(lineNo, bytes.TrimSpace(line)); fnErr != nil {
+				return fnErr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func parseBatchLine(line []byte) (*BatchRequestLine, error) {
+	var requestLine BatchRequestLine
+	err := json.Unmarshal(line, &requestLine)
+	if err != nil {
+		return nil, err
+	}
+	if requestLine.Body == nil {
+		return nil, errors.New("body is required")
+	}
+	return &requestLine, nil
+}
+
+// validateBatchInput checks every line of the input file and returns the line count & the models used
+func validateBatchInput(reader io.Reader, endpoint string, availableModels string) (int, map[string]bool, error) {
+	customIds := make(map[string]bool)
+	models := make(map[string]bool)
+	err := readBatchLines(reader, func(lineNo int, line []byte) error {
+		requestLine, err := parseBatchLine(line)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid json: %s", lineNo, err.Error())
+		}
+		if requestLine.CustomId == "" {
+			return fmt.Errorf("line %d: custom_id is required", lineNo)
+		}
+		if customIds[requestLine.CustomId] {
+			return fmt.Errorf("line %d: duplicated custom_id %s", lineNo, requestLine.CustomId)
+		}
+		customIds[requestLine.CustomId] = true
+		if strings.ToUpper(requestLine.Method) != http.MethodPost {
+			return fmt.Errorf("line %d: only POST method is supported", lineNo)
+		}
+		if requestLine.Url != endpoint {
+			return fmt.Errorf("line %d: url %s does not match the batch endpoint %s", lineNo, requestLine.Url, endpoint)
+		}
+		modelName, _ := requestLine.Body["model"].(string)
+		if modelName == "" {
+			return fmt.Errorf("line %d: model is required", lineNo)
+		}
+		if availableModels != "" && !isModelAvailable(modelName, availableModels) {
+			return fmt.Errorf("line %d: this token has no access to model %s", lineNo, modelName)
+		}
+		models[modelName] = true
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(customIds) == 0 {
+		return 0, nil, errors.New("input file is empty")
+	}
+	return len(customIds), models, nil
+}
+
+func isModelAvailable(modelName string, availableModels string) bool {
+	for _, m := range strings.Split(availableModels, ",") {
+		if m == modelName {
+			return true
+		}
+	}
+	return false
+}
+
+func CreateBatch(c *gin.Context) {
+	ctx := c.Request.Context()
+	userId := c.GetInt(ctxkey.Id)
+	var request BatchCreateRequest
+	err := c.ShouldBindJSON(&request)
+	if err != nil {
+		relayErrorResponse(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if !batchEndpoints[request.Endpoint] {
+		relayErrorResponse(c, http.StatusBadRequest, "invalid_endpoint", fmt.Sprintf("unsupported endpoint: %s", request.Endpoint))
+		return
+	}
+	if request.CompletionWindow != batchCompletionWindow {
+		relayErrorResponse(c, http.StatusBadRequest, "invalid_completion_window", "completion_window must be 24h")
+		return
+	}
+	inputFile, err := model.GetFileByIds(request.InputFileId, userId)
+	if err != nil {
+		relayErrorResponse(c, http.StatusBadRequest, "invalid_input_file", fmt.Sprintf("No such File object: %s", request.InputFileId))
+		return
+	}
+	if inputFile.Purpose != model.FilePurposeBatch {
+		relayErrorResponse(c, http.StatusBadRequest, "invalid_input_file", "input file must be uploaded with purpose batch")
+		return
+	}
+	userQuota, err := model.CacheGetUserQuota(ctx, userId)
+	if err != nil {
+		relayErrorResponse(c, http.StatusInternalServerError, "get_user_quota_failed", err.Error())
+		return
+	}
+	if userQuota <= 0 {
+		relayErrorResponse(c, http.StatusForbidden, "insufficient_user_quota", "user quota is not enough")
+		return
+	}
+
+	reader, err := storage.GetStorage().Get(ctx, inputFile.StorageKey)
+	if err != nil {
+		relayErrorResponse(c, http.StatusInternalServerError, "read_file_failed", err.Error())
+		return
+	}
+	total, models, err := validateBatchInput(reader, request.Endpoint, c.GetString(ctxkey.AvailableModels))
+	_ = reader.Close()
+	if err != nil {
+		relayErrorResponse(c, http.StatusBadRequest, "invalid_input_file", err.Error())
+		return
+	}
+
+	now := helper.GetTimestamp()
+	batch := &model.Batch{
+		Id:               "batch_" + random.GetUUID(),
+		UserId:           userId,
+		TokenId:          c.GetInt(ctxkey.TokenId),
+		Endpoint:         request.Endpoint,
+		InputFileId:      inputFile.Id,
+		CompletionWindow: request.CompletionWindow,
+		Status:           model.BatchStatusValidating,
+		CreatedAt:        now,
+		ExpiresAt:        now + 24*60*60,
+		TotalCount:       total,
+	}
+	if len(request.Metadata) > 0 {
+		metadata, _ := json.Marshal(request.Metadata)
+		batch.Metadata = string(metadata)
+	}
+	if len(models) == 1 {
+		for modelName := range models {
+			batch.Model = modelName
+		}
+	}
+	if config.BatchPassthroughEnabled && batch.Model != "" {
+		channel := selectBatchPassthroughChannel(c, batch.Model)
+		if channel != nil {
+			err = createUpstreamBatch(ctx, channel, batch, inputFile)
+			if err != nil {
+				// fallback to the local executor
+				logger.Warnf(ctx, "failed to create upstream batch on channel #%d, fallback to local executor: %s", channel.Id, err.Error())
+				batch.ChannelId = 0
+				batch.UpstreamId = ""
+			}
+		}
+	}
+	err = batch.Insert()
+	if err != nil {
+		relayErrorResponse(c, http.StatusInternalServerError, "create_batch_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIBatch(batch))
+}
+
+func ListBatches(c *gin.Context) {
+	userId := c.GetInt(ctxkey.Id)
+	limit := getListLimit(c, 20, 100)
+	batches, err := model.GetUserBatches(userId, c.Query("after"), limit+1)
+	if err != nil {
+		relayErrorResponse(c, http.StatusInternalServerError, "list_batches_failed", err.Error())
+		return
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	data := make([]OpenAIBatch, 0, len(batches))
+	for _, batch := range batches {
+		data = append(data, toOpenAIBatch(batch))
+	}
+	response := gin.H{
+		"object":   "list",
+		"data":     data,
+		"has_more": hasMore,
+	}
+	if len(data) > 0 {
+		response["first_id"] = data[0].Id
+		response["last_id"] = data[len(data)-1].Id
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func getUserBatch(c *gin.Context) (*model.Batch, bool) {
+	batch, err := model.GetBatchByIds(c.Param("id"), c.GetInt(ctxkey.Id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			relayErrorResponse(c, http.StatusNotFound, "batch_not_found", fmt.Sprintf("No such Batch object: %s", c.Param("id")))
+		} else {
+			relayErrorResponse(c, http.StatusInternalServerError, "get_batch_failed", err.Error())
+		}
+		return nil, false
+	}
+	return batch, true
+}
+
+func RetrieveBatch(c *gin.Context) {
+	batch, ok := getUserBatch(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIBatch(batch))
+}
+
+func CancelBatch(c *gin.Context) {
+	batch, ok := getUserBatch(c)
+	if !ok {
+		return
+	}
+	if batch.Status != model.BatchStatusValidating && batch.Status != model.BatchStatusInProgress {
+		relayErrorResponse(c, http.StatusConflict, "batch_not_cancellable", fmt.Sprintf("Cannot cancel a batch with status %s", batch.Status))
+		return
+	}
+	err := model.CancelBatch(batch.Id)
+	if err != nil {
+		relayErrorResponse(c, http.StatusInternalServerError, "cancel_batch_failed", err.Error())
+		return
+	}
+	batch, ok = getUserBatch(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIBatch(batch))
+}
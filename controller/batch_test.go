@@ -0,0 +1,252 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+func TestReadBatchLines(t *testing.T) {
+	var lines []string
+	var lineNos []int
+	err := readBatchLines(strings.NewReader("{\"a\": 1}\n\n  \r\n{\"b\": 2}\r\n{\"c\": 3}"), func(lineNo int, line []byte) error {
+		lineNos = append(lineNos, lineNo)
+		lines = append(lines, string(line))
+		return nil
+	})
+	require.NoError(t, err)
+	// blank lines are skipped and not counted, the last line needs no newline
+	assert.Equal(t, []int{1, 2, 3}, lineNos)
+	assert.Equal(t, []string{`{"a": 1}`, `{"b": 2}`, `{"c": 3}`}, lines)
+
+	stop := errors.New("stop")
+	calls := 0
+	err = readBatchLines(strings.NewReader("1\n2\n3\n"), func(lineNo int, line []byte) error {
+		calls++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestValidateBatchInput(t *testing.T) {
+	line := func(customId string, method string, url string, model string) string {
+		return `{"custom_id": "` + customId + `", "method": "` + method + `", "url": "` + url + `", "body": {"model": "` + model + `"}}` + "\n"
+	}
+	count, models, err := validateBatchInput(strings.NewReader(
+		line("1", "POST", "/v1/chat/completions", "gpt-4o")+line("2", "post", "/v1/chat/completions", "gpt-4o-mini")+line("3", "POST", "/v1/chat/completions", "gpt-4o"),
+	), "/v1/chat/completions", "")
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, map[string]bool{"gpt-4o": true, "gpt-4o-mini": true}, models)
+
+	for _, tc := range []struct {
+		name            string
+		input           string
+		availableModels string
+		err             string
+	}{
+		{"empty", "\n\n", "", "input file is empty"},
+		{"invalid json", "{\n", "", "line 1: invalid json"},
+		{"no body", `{"custom_id": "1", "method": "POST", "url": "/v1/chat/completions"}`, "", "line 1: invalid json: body is required"},
+		{"no custom id", line("", "POST", "/v1/chat/completions", "gpt-4o"), "", "line 1: custom_id is required"},
+		{"duplicated custom id", line("1", "POST", "/v1/chat/completions", "gpt-4o") + line("1", "POST", "/v1/chat/completions", "gpt-4o"), "", "line 2: duplicated custom_id 1"},
+		{"method", line("1", "GET", "/v1/chat/completions", "gpt-4o"), "", "line 1: only POST method is supported"},
+		{"url", line("1", "POST", "/v1/embeddings", "gpt-4o"), "", "line 1: url /v1/embeddings does not match"},
+		{"no model", line("1", "POST", "/v1/chat/completions", ""), "", "line 1: model is required"},
+		{"model not available", line("1", "POST", "/v1/chat/completions", "gpt-4o"), "gpt-4o-mini,o1", "line 1: this token has no access to model gpt-4o"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := validateBatchInput(strings.NewReader(tc.input), "/v1/chat/completions", tc.availableModels)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
+
+func TestPollUpstreamBatch(t *testing.T) {
+	client.Init()
+	common.RedisEnabled = false
+	filePath := config.FileStoragePath
+	config.FileStoragePath = t.TempDir()
+	defer func() { config.FileStoragePath = filePath }()
+
+	var errorFileRequests atomic.Int32
+	upstreamStatus := dbmodel.BatchStatusCompleted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/batches/batch_upstream":
+			_, _ = w.Write([]byte(`{"id": "batch_upstream", "status": "` + upstreamStatus + `", "output_file_id": "file-out", "error_file_id": "file-err",
+				"request_counts": {"total": 3, "completed": 2, "failed": 1}}`))
+		case "/v1/files/file-out/content":
+			_, _ = w.Write([]byte(`{"custom_id": "1", "response": {"status_code": 200, "body": {"model": "gpt-4o-mini", "usage": {"prompt_tokens": 1000, "completion_tokens": 1000, "total_tokens": 2000}}}}` + "\n" +
+				`{"custom_id": "2", "response": {"status_code": 200, "body": {"model": "gpt-4o-mini", "usage": {"prompt_tokens": 2000, "completion_tokens": 0, "total_tokens": 2000}}}}` + "\n"))
+		case "/v1/files/file-err/content":
+			// the first download of the error file fails, after the output was billed
+			if errorFileRequests.Add(1) == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			_, _ = w.Write([]byte(`{"custom_id": "3", "error": {"code": "invalid_request", "message": "bad"}}` + "\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&dbmodel.Channel{}, &dbmodel.Batch{}, &dbmodel.File{}, &dbmodel.Token{}, &dbmodel.User{}, &dbmodel.Log{}))
+	dbmodel.DB = db
+	dbmodel.LOG_DB = db
+	defer func() { dbmodel.DB, dbmodel.LOG_DB = nil, nil }()
+
+	channel := &dbmodel.Channel{Type: channeltype.OpenAI, Key: "sk-upstream", BaseURL: &server.URL}
+	require.NoError(t, db.Create(channel).Error)
+	user := &dbmodel.User{Username: "batches", Password: "password", Quota: 1000000}
+	require.NoError(t, db.Create(user).Error)
+	token := &dbmodel.Token{UserId: user.Id, Key: "batch-token", RemainQuota: 1000000}
+	require.NoError(t, db.Create(token).Error)
+	batch := &dbmodel.Batch{
+		Id:         "batch_local",
+		UserId:     user.Id,
+		TokenId:    token.Id,
+		Endpoint:   "/v1/chat/completions",
+		Status:     dbmodel.BatchStatusInProgress,
+		Model:      "gpt-4o-mini",
+		ChannelId:  channel.Id,
+		UpstreamId: "batch_upstream",
+	}
+	require.NoError(t, batch.Insert())
+	ctx := context.Background()
+	usedQuota := func() int64 {
+		require.NoError(t, db.First(user, user.Id).Error)
+		return user.UsedQuota
+	}
+	countLogs := func() int64 {
+		var count int64
+		require.NoError(t, db.Model(&dbmodel.Log{}).Count(&count).Error)
+		return count
+	}
+
+	// the output is billed and kept even though the poll fails on the error file
+	pollUpstreamBatch(ctx, batch)
+	stored, err := dbmodel.GetBatchById(batch.Id)
+	require.NoError(t, err)
+	assert.Equal(t, dbmodel.BatchStatusInProgress, stored.Status)
+	assert.NotEmpty(t, stored.OutputFileId)
+	assert.True(t, stored.OutputBilled)
+	billed := usedQuota()
+	assert.Positive(t, billed)
+	assert.EqualValues(t, 2, countLogs())
+
+	// the next poll only fetches the error file
+	pollUpstreamBatch(ctx, stored)
+	finished, err := dbmodel.GetBatchById(batch.Id)
+	require.NoError(t, err)
+	assert.Equal(t, dbmodel.BatchStatusCompleted, finished.Status)
+	assert.Equal(t, stored.OutputFileId, finished.OutputFileId)
+	assert.NotEmpty(t, finished.ErrorFileId)
+	assert.Equal(t, 2, finished.CompletedCount)
+	assert.Equal(t, billed, usedQuota())
+	assert.EqualValues(t, 2, countLogs())
+	assert.EqualValues(t, 2, errorFileRequests.Load())
+
+	// a stale poll doesn't undo a concurrent cancel
+	upstreamStatus = dbmodel.BatchStatusInProgress
+	stale := &dbmodel.Batch{Id: "batch_cancelled", UserId: user.Id, TokenId: token.Id, Status: dbmodel.BatchStatusInProgress, ChannelId: channel.Id, UpstreamId: "batch_upstream"}
+	require.NoError(t, stale.Insert())
+	require.NoError(t, dbmodel.CancelBatch(stale.Id))
+	pollUpstreamBatch(ctx, stale)
+	status, err := dbmodel.GetBatchStatus(stale.Id)
+	require.NoError(t, err)
+	assert.Equal(t, dbmodel.BatchStatusCancelling, status)
+}
+
+func TestRunLocalBatchStops(t *testing.T) {
+	common.RedisEnabled = false
+	filePath := config.FileStoragePath
+	config.FileStoragePath = t.TempDir()
+	defer func() { config.FileStoragePath = filePath }()
+	workerNum := config.BatchWorkerNum
+	defer func() { config.BatchWorkerNum = workerNum }()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&dbmodel.Batch{}, &dbmodel.File{}, &dbmodel.Token{}, &dbmodel.User{}))
+	dbmodel.DB = db
+	defer func() { dbmodel.DB = nil }()
+
+	user := &dbmodel.User{Username: "batches", Password: "password", Quota: 1000000}
+	require.NoError(t, db.Create(user).Error)
+	token := &dbmodel.Token{UserId: user.Id, Key: "batch-token", Status: dbmodel.TokenStatusEnabled, ExpiredTime: -1, RemainQuota: 1000000}
+	require.NoError(t, db.Create(token).Error)
+	input := `{"custom_id": "1", "method": "POST", "url": "/v1/chat/completions", "body": {"model": "gpt-4o-mini"}}` + "\n" +
+		`{"custom_id": "2", "method": "POST", "url": "/v1/chat/completions", "body": {"model": "gpt-4o-mini"}}` + "\n"
+	ctx := context.Background()
+	inputFile, err := saveFile(ctx, user.Id, "input.jsonl", dbmodel.FilePurposeBatch, strings.NewReader(input), int64(len(input)))
+	require.NoError(t, err)
+	newBatch := func(id string, expiresAt int64) *dbmodel.Batch {
+		batch := &dbmodel.Batch{
+			Id:          id,
+			UserId:      user.Id,
+			TokenId:     token.Id,
+			Endpoint:    "/v1/chat/completions",
+			InputFileId: inputFile.Id,
+			Status:      dbmodel.BatchStatusValidating,
+			ExpiresAt:   expiresAt,
+			TotalCount:  2,
+		}
+		require.NoError(t, batch.Insert())
+		return batch
+	}
+	run := func(batch *dbmodel.Batch) *dbmodel.Batch {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			runLocalBatch(ctx, batch)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("local batch did not finish")
+		}
+		finished, err := dbmodel.GetBatchById(batch.Id)
+		require.NoError(t, err)
+		return finished
+	}
+
+	// a cancel coming after the batch was picked up is not overwritten by the start of the batch
+	stale := newBatch("batch_cancelled", helper.GetTimestamp()+3600)
+	require.NoError(t, dbmodel.CancelBatch(stale.Id))
+	finished := run(stale)
+	assert.Equal(t, dbmodel.BatchStatusCancelled, finished.Status)
+	assert.Zero(t, finished.InProgressAt)
+	assert.Empty(t, finished.OutputFileId)
+
+	// no worker is configured, the batch still runs and answers every line once it has expired
+	config.BatchWorkerNum = 0
+	finished = run(newBatch("batch_expired", helper.GetTimestamp()-1))
+	assert.Equal(t, dbmodel.BatchStatusExpired, finished.Status)
+	assert.Equal(t, 2, finished.FailedCount)
+	assert.Equal(t, 0, finished.CompletedCount)
+	assert.Empty(t, finished.OutputFileId)
+	assert.NotEmpty(t, finished.ErrorFileId)
+}
@@ -0,0 +1,475 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/azure"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+// UpstreamModel is a model listed by the upstream of a channel, prices are in USD per token when the upstream
+// publishes them
+type UpstreamModel struct {
+	Id            string  `json:"id"`
+	Name          string  `json:"name,omitempty"`
+	Description   string  `json:"description,omitempty"`
+	ContextLength int     `json:"context_length,omitempty"`
+	PricingInput  float64 `json:"pricing_input,omitempty"`
+	PricingOutput float64 `json:"pricing_output,omitempty"`
+	// Deployment is the azure deployment serving the model
+	Deployment string `json:"deployment,omitempty"`
+}
+
+// ChannelModelsDiff is what a sync changes in the models of a channel
+type ChannelModelsDiff struct {
+	ChannelId int             `json:"channel_id"`
+	Added     []string        `json:"added"`
+	Removed   []string        `json:"removed"`
+	Kept      []string        `json:"kept"`
+	Upstream  []UpstreamModel `json:"upstream,omitempty"`
+}
+
+type ChannelModelsSyncRequest struct {
+	// RemoveMissing removes the models the upstream no longer lists, else models are only added
+	RemoveMissing bool `json:"remove_missing"`
+	// ImportPricing saves the prices published by the upstream in the model pricing
+	ImportPricing bool `json:"import_pricing"`
+}
+
+type OpenAIModelsResponse struct {
+	Data []struct {
+		Id string `json:"id"`
+	} `json:"data"`
+}
+
+type OpenRouterModelsResponse struct {
+	Data []struct {
+		Id            string `json:"id"`
+		Name          string `json:"name"`
+		Description   string `json:"description"`
+		ContextLength int    `json:"context_length"`
+		Pricing       struct {
+			Prompt     string `json:"prompt"`
+			Completion string `json:"completion"`
+		} `json:"pricing"`
+	} `json:"data"`
+}
+
+type OllamaTagsResponse struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+type GeminiModelsResponse struct {
+	Models []struct {
+		Name                       string   `json:"name"`
+		DisplayName                string   `json:"displayName"`
+		Description                string   `json:"description"`
+		InputTokenLimit            int      `json:"inputTokenLimit"`
+		SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+	} `json:"models"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+func fetchOpenAIModels(url string, headers http.Header, channel *model.Channel) ([]UpstreamModel, error) {
+	body, err := GetResponseBody("GET", url, channel, headers)
+	if err != nil {
+		return nil, err
+	}
+	response := OpenAIModelsResponse{}
+	if err = json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	models := make([]UpstreamModel, 0, len(response.Data))
+	for _, m := range response.Data {
+		models = append(models, UpstreamModel{Id: m.Id})
+	}
+	return models, nil
+}
+
+func fetchOpenRouterModels(baseURL string, channel *model.Channel) ([]UpstreamModel, error) {
+	body, err := GetResponseBody("GET", baseURL+"/v1/models", channel, GetAuthHeader(channel.Key))
+	if err != nil {
+		return nil, err
+	}
+	response := OpenRouterModelsResponse{}
+	if err = json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	models := make([]UpstreamModel, 0, len(response.Data))
+	for _, m := range response.Data {
+		prompt, _ := strconv.ParseFloat(m.Pricing.Prompt, 64)
+		completion, _ := strconv.ParseFloat(m.Pricing.Completion, 64)
+		models = append(models, UpstreamModel{
+			Id:            m.Id,
+			Name:          m.Name,
+			Description:   m.Description,
+			ContextLength: m.ContextLength,
+			PricingInput:  prompt,
+			PricingOutput: completion,
+		})
+	}
+	return models, nil
+}
+
+func fetchOllamaModels(baseURL string, channel *model.Channel) ([]UpstreamModel, error) {
+	body, err := GetResponseBody("GET", baseURL+"/api/tags", channel, nil)
+	if err != nil {
+		return nil, err
+	}
+	response := OllamaTagsResponse{}
+	if err = json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	models := make([]UpstreamModel, 0, len(response.Models))
+	for _, m := range response.Models {
+		models = append(models, UpstreamModel{Id: m.Name})
+	}
+	return models, nil
+}
+
+// fetchGeminiModels lists the models able to generate content or embeddings, page by page
+func fetchGeminiModels(baseURL string, channel *model.Channel) ([]UpstreamModel, error) {
+	cfg, _ := channel.LoadConfig()
+	version := helper.AssignOrDefault(cfg.APIVersion, "v1beta")
+	headers := http.Header{}
+	headers.Add("x-goog-api-key", channel.Key)
+	var models []UpstreamModel
+	pageToken := ""
+	for {
+		url := fmt.Sprintf("%s/%s/models?pageSize=1000", baseURL, version)
+		if pageToken != "" {
+			url += "&pageToken=" + neturl.QueryEscape(pageToken)
+		}
+		body, err := GetResponseBody("GET", url, channel, headers)
+		if err != nil {
+			return nil, err
+		}
+		response := GeminiModelsResponse{}
+		if err = json.Unmarshal(body, &response); err != nil {
+			return nil, err
+		}
+		for _, m := range response.Models {
+			supported := false
+			for _, method := range m.SupportedGenerationMethods {
+				if method == "generateContent" || method == "embedContent" {
+					supported = true
+				}
+			}
+			if !supported {
+				continue
+			}
+			models = append(models, UpstreamModel{
+				Id:            strings.TrimPrefix(m.Name, "models/"),
+				Name:          m.DisplayName,
+				Description:   m.Description,
+				ContextLength: m.InputTokenLimit,
+			})
+		}
+		if response.NextPageToken == "" {
+			return models, nil
+		}
+		pageToken = response.NextPageToken
+	}
+}
+
+type AzureDeploymentsResponse struct {
+	Data []struct {
+		Id     string `json:"id"`
+		Model  string `json:"model"`
+		Status string `json:"status"`
+	} `json:"data"`
+}
+
+// fetchAzureDeployments lists the deployments of the resource, the models are named after the deployed models
+func fetchAzureDeployments(baseURL string, channel *model.Channel) ([]UpstreamModel, error) {
+	cfg, _ := channel.LoadConfig()
+	headers := http.Header{}
+	err := azure.SetupAuthHeader(headers, channel.Id, azure.Credential{
+		AuthType: cfg.AzureAuthType,
+		TenantID: cfg.AzureTenantID,
+		ClientID: cfg.AzureClientID,
+		Key:      channel.Key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/openai/deployments?api-version=%s", baseURL, azure.ListDeploymentsAPIVersion)
+	body, err := GetResponseBody("GET", url, channel, headers)
+	if err != nil {
+		return nil, err
+	}
+	response := AzureDeploymentsResponse{}
+	if err = json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	models := make([]UpstreamModel, 0, len(response.Data))
+	for _, d := range response.Data {
+		if d.Status != "" && d.Status != "succeeded" {
+			continue
+		}
+		models = append(models, UpstreamModel{Id: d.Model, Deployment: d.Id})
+	}
+	return models, nil
+}
+
+// updateAzureDeployments maps the listed models to their deployments when the names differ, the deployments set by
+// hand are kept
+func updateAzureDeployments(channel *model.Channel, upstream []UpstreamModel) error {
+	cfg, err := channel.LoadConfig()
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, m := range upstream {
+		if m.Deployment == "" || m.Deployment == azure.GetDeploymentName(nil, m.Id) || cfg.AzureDeployments[m.Id] != "" {
+			continue
+		}
+		if cfg.AzureDeployments == nil {
+			cfg.AzureDeployments = make(map[string]string)
+		}
+		cfg.AzureDeployments[m.Id] = m.Deployment
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return channel.UpdateConfig(cfg)
+}
+
+// fetchChannelModels lists the models of the upstream of the channel with its own list endpoint
+func fetchChannelModels(channel *model.Channel) ([]UpstreamModel, error) {
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" && channel.Type < len(channeltype.ChannelBaseURLs) {
+		baseURL = channeltype.ChannelBaseURLs[channel.Type]
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	switch channel.Type {
+	case channeltype.OpenRouter:
+		return fetchOpenRouterModels(baseURL, channel)
+	case channeltype.Ollama:
+		return fetchOllamaModels(baseURL, channel)
+	case channeltype.Gemini:
+		return fetchGeminiModels(baseURL, channel)
+	case channeltype.Anthropic:
+		headers := http.Header{}
+		headers.Add("x-api-key", channel.Key)
+		headers.Add("anthropic-version", "2023-06-01")
+		return fetchOpenAIModels(baseURL+"/v1/models?limit=1000", headers, channel)
+	case channeltype.Azure:
+		return fetchAzureDeployments(baseURL, channel)
+	}
+	if channeltype.ToAPIType(channel.Type) != apitype.OpenAI || baseURL == "" {
+		return nil, errors.New("尚未实现")
+	}
+	return fetchOpenAIModels(baseURL+"/v1/models", GetAuthHeader(channel.Key), channel)
+}
+
+// diffChannelModels compares the models of the channel with the upstream ones. The names given to other models by
+// the model mapping are never removed, the upstream doesn't know them.
+func diffChannelModels(channel *model.Channel, upstream []UpstreamModel) *ChannelModelsDiff {
+	diff := &ChannelModelsDiff{ChannelId: channel.Id, Added: []string{}, Removed: []string{}, Kept: []string{}, Upstream: upstream}
+	listed := make(map[string]bool, len(upstream))
+	for _, m := range upstream {
+		listed[m.Id] = true
+	}
+	mapping := channel.GetModelMapping()
+	current := make(map[string]bool)
+	for _, name := range strings.Split(channel.Models, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || current[name] {
+			continue
+		}
+		current[name] = true
+		if _, mapped := mapping[name]; mapped || listed[name] {
+			diff.Kept = append(diff.Kept, name)
+		} else {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	for _, m := range upstream {
+		if !current[m.Id] {
+			current[m.Id] = true
+			diff.Added = append(diff.Added, m.Id)
+		}
+	}
+	sort.Strings(diff.Added)
+	return diff
+}
+
+// importModelPricing saves the published prices, the provider is the vendor part of ids like openai/gpt-4o. The
+// prices set by admins are kept.
+func importModelPricing(upstream []UpstreamModel) error {
+	var pricings []*model.ModelPricing
+	for _, m := range upstream {
+		if m.PricingInput <= 0 && m.PricingOutput <= 0 {
+			continue
+		}
+		provider := ""
+		if i := strings.Index(m.Id, "/"); i > 0 {
+			provider = m.Id[:i]
+		}
+		pricings = append(pricings, &model.ModelPricing{
+			ModelName:     m.Id,
+			DisplayName:   m.Name,
+			Provider:      provider,
+			Description:   m.Description,
+			ContextLength: m.ContextLength,
+			PricingInput:  m.PricingInput,
+			PricingOutput: m.PricingOutput,
+		})
+	}
+	if len(pricings) == 0 {
+		return nil
+	}
+	return model.UpsertSyncedModelPricings(pricings)
+}
+
+// syncChannelModels fetches the models of the upstream, and applies the diff unless it is a dry run
+func syncChannelModels(channel *model.Channel, request ChannelModelsSyncRequest, dryRun bool) (*ChannelModelsDiff, error) {
+	upstream, err := fetchChannelModels(channel)
+	if err != nil {
+		return nil, err
+	}
+	if len(upstream) == 0 {
+		return nil, errors.New("上游未返回任何模型")
+	}
+	diff := diffChannelModels(channel, upstream)
+	if dryRun {
+		return diff, nil
+	}
+	models := append(append([]string{}, diff.Kept...), diff.Added...)
+	if !request.RemoveMissing {
+		models = append(models, diff.Removed...)
+		diff.Removed = []string{}
+	}
+	if len(diff.Added) > 0 || len(diff.Removed) > 0 {
+		if err = channel.UpdateModels(models); err != nil {
+			return nil, err
+		}
+	}
+	if channel.Type == channeltype.Azure {
+		if err = updateAzureDeployments(channel, upstream); err != nil {
+			return nil, err
+		}
+	}
+	if request.ImportPricing {
+		if err = importModelPricing(upstream); err != nil {
+			return nil, err
+		}
+	}
+	return diff, nil
+}
+
+// SyncChannelModels shows what a sync of the models of a channel changes on GET, and applies it on POST
+func SyncChannelModels(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	var request ChannelModelsSyncRequest
+	if c.Request.Method == http.MethodPost && c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	diff, err := syncChannelModels(channel, request, c.Request.Method == http.MethodGet)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    diff,
+	})
+}
+
+// syncAllChannelsModels syncs the enabled channels which opted in with model_sync, removing the models the upstream
+// no longer lists and importing its prices
+func syncAllChannelsModels() ([]*ChannelModelsDiff, error) {
+	channels, err := model.GetAllChannels(0, 0, "all")
+	if err != nil {
+		return nil, err
+	}
+	diffs := make([]*ChannelModelsDiff, 0)
+	for _, channel := range channels {
+		cfg, _ := channel.LoadConfig()
+		if channel.Status != model.ChannelStatusEnabled || !cfg.ModelSync {
+			continue
+		}
+		diff, err := syncChannelModels(channel, ChannelModelsSyncRequest{RemoveMissing: true, ImportPricing: true}, false)
+		if err != nil {
+			logger.SysError(fmt.Sprintf("failed to sync models of channel #%d: %s", channel.Id, err.Error()))
+			continue
+		}
+		if len(diff.Added) > 0 || len(diff.Removed) > 0 {
+			logger.SysLog(fmt.Sprintf("models of channel #%d synced, added %v, removed %v", channel.Id, diff.Added, diff.Removed))
+		}
+		diff.Upstream = nil
+		diffs = append(diffs, diff)
+		time.Sleep(config.RequestInterval)
+	}
+	return diffs, nil
+}
+
+// SyncModels syncs the models of every channel with model_sync enabled
+func SyncModels(c *gin.Context) {
+	diffs, err := syncAllChannelsModels()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    diffs,
+	})
+}
+
+func AutomaticallySyncChannelModels(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Minute)
+		logger.SysLog("syncing models of channels")
+		_, _ = syncAllChannelsModels()
+		logger.SysLog("models of channels synced")
+	}
+}
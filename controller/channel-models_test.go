@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/client"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+func newModelsServer(t *testing.T) *httptest.Server {
+	client.Init()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/models":
+			assert.Equal(t, "Bearer sk-test", r.Header.Get("Authorization"))
+			_, _ = w.Write([]byte(`{"object":"list","data":[{"id":"gpt-4o"},{"id":"gpt-4o-mini"},{"id":"o3"}]}`))
+		case "/or/v1/models":
+			_, _ = w.Write([]byte(`{"data":[{"id":"openai/gpt-4o","name":"OpenAI: GPT-4o","context_length":128000,"pricing":{"prompt":"0.0000025","completion":"0.00001"}},{"id":"meta-llama/llama-3-8b:free","pricing":{"prompt":"0","completion":"0"}}]}`))
+		case "/api/tags":
+			_, _ = w.Write([]byte(`{"models":[{"name":"llama3.2:latest"},{"name":"qwen2.5:7b"}]}`))
+		case "/v1beta/models":
+			assert.Equal(t, "AIza-test", r.Header.Get("x-goog-api-key"))
+			switch r.URL.Query().Get("pageToken") {
+			case "":
+				_, _ = w.Write([]byte(`{"models":[{"name":"models/gemini-2.5-flash","inputTokenLimit":1048576,"supportedGenerationMethods":["generateContent","countTokens"]}],"nextPageToken":"Cg+p2/x=="}`))
+				return
+			case "Cg+p2/x==":
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(`{"models":[{"name":"models/text-embedding-004","supportedGenerationMethods":["embedContent"]},{"name":"models/aqa","supportedGenerationMethods":["generateAnswer"]}]}`))
+		case "/openai/deployments":
+			assert.Equal(t, "azure-key", r.Header.Get("api-key"))
+			assert.Equal(t, "2022-12-01", r.URL.Query().Get("api-version"))
+			_, _ = w.Write([]byte(`{"data":[{"id":"gpt-41","model":"gpt-4.1","status":"succeeded"},{"id":"prod-mini","model":"gpt-4o-mini","status":"succeeded"},{"id":"new","model":"o3","status":"running"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestFetchChannelModels(t *testing.T) {
+	server := newModelsServer(t)
+	defer server.Close()
+	ids := func(models []UpstreamModel) (ids []string) {
+		for _, m := range models {
+			ids = append(ids, m.Id)
+		}
+		return ids
+	}
+
+	models, err := fetchChannelModels(&dbmodel.Channel{Type: channeltype.Ollama, BaseURL: &server.URL})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"llama3.2:latest", "qwen2.5:7b"}, ids(models))
+
+	models, err = fetchChannelModels(&dbmodel.Channel{Type: channeltype.Gemini, Key: "AIza-test", BaseURL: &server.URL})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gemini-2.5-flash", "text-embedding-004"}, ids(models))
+	assert.Equal(t, 1048576, models[0].ContextLength)
+
+	openRouterURL := server.URL + "/or"
+	models, err = fetchChannelModels(&dbmodel.Channel{Type: channeltype.OpenRouter, Key: "sk-test", BaseURL: &openRouterURL})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"openai/gpt-4o", "meta-llama/llama-3-8b:free"}, ids(models))
+	assert.Equal(t, 0.0000025, models[0].PricingInput)
+	assert.Equal(t, 128000, models[0].ContextLength)
+
+	models, err = fetchChannelModels(&dbmodel.Channel{Type: channeltype.Azure, Key: "azure-key", BaseURL: &server.URL})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gpt-4.1", "gpt-4o-mini"}, ids(models))
+	assert.Equal(t, "prod-mini", models[1].Deployment)
+
+	_, err = fetchChannelModels(&dbmodel.Channel{Type: channeltype.Baidu, Key: "sk-test"})
+	assert.Error(t, err)
+}
+
+func TestSyncChannelModels(t *testing.T) {
+	server := newModelsServer(t)
+	defer server.Close()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&dbmodel.Channel{}, &dbmodel.Ability{}, &dbmodel.ModelPricing{}))
+	dbmodel.DB = db
+	defer func() { dbmodel.DB = nil }()
+
+	mapping := `{"gpt-4":"gpt-4o"}`
+	channel := &dbmodel.Channel{Type: channeltype.OpenAI, Key: "sk-test", BaseURL: &server.URL, Models: "gpt-4o,gpt-3.5-turbo,gpt-4", ModelMapping: &mapping, Group: "default"}
+	require.NoError(t, channel.Insert())
+
+	diff, err := syncChannelModels(channel, ChannelModelsSyncRequest{}, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gpt-4o-mini", "o3"}, diff.Added)
+	assert.Equal(t, []string{"gpt-3.5-turbo"}, diff.Removed)
+	assert.Equal(t, []string{"gpt-4o", "gpt-4"}, diff.Kept)
+	require.NoError(t, db.First(channel, channel.Id).Error)
+	assert.Equal(t, "gpt-4o,gpt-3.5-turbo,gpt-4", channel.Models)
+
+	_, err = syncChannelModels(channel, ChannelModelsSyncRequest{RemoveMissing: true}, false)
+	require.NoError(t, err)
+	require.NoError(t, db.First(channel, channel.Id).Error)
+	assert.Equal(t, "gpt-4o,gpt-4,gpt-4o-mini,o3", channel.Models)
+	var abilities int64
+	db.Model(&dbmodel.Ability{}).Where("channel_id = ?", channel.Id).Count(&abilities)
+	assert.EqualValues(t, 4, abilities)
+
+	openRouterURL := server.URL + "/or"
+	channel = &dbmodel.Channel{Type: channeltype.OpenRouter, Key: "sk-test", BaseURL: &openRouterURL, Models: "openai/gpt-4o", Group: "default"}
+	require.NoError(t, channel.Insert())
+	_, err = syncChannelModels(channel, ChannelModelsSyncRequest{ImportPricing: true}, false)
+	require.NoError(t, err)
+	var pricing dbmodel.ModelPricing
+	require.NoError(t, db.Where("model_name = ?", "openai/gpt-4o").First(&pricing).Error)
+	assert.Equal(t, "openai", pricing.Provider)
+	assert.Equal(t, 0.00001, pricing.PricingOutput)
+	assert.Error(t, db.Where("model_name = ?", "meta-llama/llama-3-8b:free").First(&pricing).Error)
+
+	// the prices set by admins are not overwritten
+	pricing.PricingOutput = 0.00002
+	pricing.Source = ""
+	require.NoError(t, dbmodel.CreateOrUpdateModelPricing(context.Background(), &pricing))
+	_, err = syncChannelModels(channel, ChannelModelsSyncRequest{ImportPricing: true}, false)
+	require.NoError(t, err)
+	require.NoError(t, db.Where("model_name = ?", "openai/gpt-4o").First(&pricing).Error)
+	assert.Equal(t, 0.00002, pricing.PricingOutput)
+	assert.Equal(t, "", pricing.Source)
+
+	config := `{"azure_deployments":{"gpt-4o":"prod-4o"}}`
+	channel = &dbmodel.Channel{Type: channeltype.Azure, Key: "azure-key", BaseURL: &server.URL, Models: "gpt-4o", Config: config, Group: "default"}
+	require.NoError(t, channel.Insert())
+	_, err = syncChannelModels(channel, ChannelModelsSyncRequest{}, false)
+	require.NoError(t, err)
+	require.NoError(t, db.First(channel, channel.Id).Error)
+	assert.Equal(t, "gpt-4.1,gpt-4o-mini,gpt-4o", channel.Models)
+	cfg, err := channel.LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"gpt-4o": "prod-4o", "gpt-4o-mini": "prod-mini"}, cfg.AzureDeployments)
+}
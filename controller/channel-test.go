@@ -65,7 +65,7 @@ func parseTestResponse(resp string) (*openai.TextResponse, string, error) {
 	return &response, stringContent, nil
 }
 
-func testChannel(ctx context.Context, channel *model.Channel, request *relaymodel.GeneralOpenAIRequest) (responseMessage string, err error, openaiErr *relaymodel.Error) {
+func testChannel(ctx context.Context, channel *model.Channel, request *relaymodel.GeneralOpenAIRequest) (responseMessage string, keyId int, err error, openaiErr *relaymodel.Error) {
 	startTime := time.Now()
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
@@ -81,12 +81,15 @@ func testChannel(ctx context.Context, channel *model.Channel, request *relaymode
 	c.Set(ctxkey.BaseURL, channel.GetBaseURL())
 	cfg, _ := channel.LoadConfig()
 	c.Set(ctxkey.Config, cfg)
-	middleware.SetupContextForSelectedChannel(c, channel, "")
+	if err := middleware.SetupContextForSelectedChannel(c, channel, ""); err != nil {
+		return "", 0, err, nil
+	}
+	keyId = c.GetInt(ctxkey.ChannelKeyId)
 	meta := meta.GetByContext(c)
 	apiType := channeltype.ToAPIType(channel.Type)
 	adaptor := relay.GetAdaptor(apiType)
 	if adaptor == nil {
-		return "", fmt.Errorf("invalid api type: %d, adaptor is nil", apiType), nil
+		return "", keyId, fmt.Errorf("invalid api type: %d, adaptor is nil", apiType), nil
 	}
 	adaptor.Init(meta)
 	modelName := request.Model
@@ -104,11 +107,11 @@ func testChannel(ctx context.Context, channel *model.Channel, request *relaymode
 	request.Model = modelName
 	convertedRequest, err := adaptor.ConvertRequest(c, relaymode.ChatCompletions, request)
 	if err != nil {
-		return "", err, nil
+		return "", keyId, err, nil
 	}
 	jsonData, err := json.Marshal(convertedRequest)
 	if err != nil {
-		return "", err, nil
+		return "", keyId, err, nil
 	}
 	defer func() {
 		logContent := fmt.Sprintf("渠道 %s 测试成功，响应：%s", channel.Name, responseMessage)
@@ -133,7 +136,7 @@ func testChannel(ctx context.Context, channel *model.Channel, request *relaymode
 	c.Request.Body = io.NopCloser(requestBody)
 	resp, err := adaptor.DoRequest(c, meta, requestBody)
 	if err != nil {
-		return "", err, nil
+		return "", keyId, err, nil
 	}
 	if resp != nil && resp.StatusCode != http.StatusOK {
 		err := controller.RelayErrorHandler(resp)
@@ -141,29 +144,29 @@ func testChannel(ctx context.Context, channel *model.Channel, request *relaymode
 		if errorMessage != "" {
 			errorMessage = ", error message: " + errorMessage
 		}
-		return "", fmt.Errorf("http status code: %d%s", resp.StatusCode, errorMessage), &err.Error
+		return "", keyId, fmt.Errorf("http status code: %d%s", resp.StatusCode, errorMessage), &err.Error
 	}
 	usage, respErr := adaptor.DoResponse(c, resp, meta)
 	if respErr != nil {
-		return "", fmt.Errorf("%s", respErr.Error.Message), &respErr.Error
+		return "", keyId, fmt.Errorf("%s", respErr.Error.Message), &respErr.Error
 	}
 	if usage == nil {
-		return "", errors.New("usage is nil"), nil
+		return "", keyId, errors.New("usage is nil"), nil
 	}
 	rawResponse := w.Body.String()
 	_, responseMessage, err = parseTestResponse(rawResponse)
 	if err != nil {
 		logger.SysError(fmt.Sprintf("failed to parse error: %s, \nresponse: %s", err.Error(), rawResponse))
-		return "", err, nil
+		return "", keyId, err, nil
 	}
 	result := w.Result()
 	// print result.Body
 	respBody, err := io.ReadAll(result.Body)
 	if err != nil {
-		return "", err, nil
+		return "", keyId, err, nil
 	}
 	logger.SysLog(fmt.Sprintf("testing channel #%d, response: \n%s", channel.Id, string(respBody)))
-	return responseMessage, nil, nil
+	return responseMessage, keyId, nil, nil
 }
 
 func TestChannel(c *gin.Context) {
@@ -187,7 +190,7 @@ func TestChannel(c *gin.Context) {
 	modelName := c.Query("model")
 	testRequest := buildTestRequest(modelName)
 	tik := time.Now()
-	responseMessage, err, _ := testChannel(ctx, channel, testRequest)
+	responseMessage, _, err, _ := testChannel(ctx, channel, testRequest)
 	tok := time.Now()
 	milliseconds := tok.Sub(tik).Milliseconds()
 	if err != nil {
@@ -213,6 +216,33 @@ func TestChannel(c *gin.Context) {
 	return
 }
 
+// recoverChannelKeys tests the auto disabled keys of a multi-key channel one by one and enables the ones which work
+// again, so that a channel disabled with its last key comes back with its keys
+func recoverChannelKeys(ctx context.Context, channel *model.Channel) {
+	if channel.KeyCount == 0 || channel.Status == model.ChannelStatusManuallyDisabled || !config.AutomaticEnableChannelEnabled {
+		return
+	}
+	keys, err := model.GetAutoDisabledChannelKeys(channel.Id)
+	if err != nil {
+		logger.Errorf(ctx, "failed to get the disabled keys of channel #%d: %s", channel.Id, err.Error())
+		return
+	}
+	for _, key := range keys {
+		keyChannel := *channel
+		keyChannel.Key = key.Key
+		keyChannel.KeyCount = 0
+		_, _, err, openaiErr := testChannel(ctx, &keyChannel, buildTestRequest(""))
+		if !monitor.ShouldEnableChannel(err, openaiErr) {
+			continue
+		}
+		if err = model.UpdateChannelKeyStatus(channel.Id, key.Id, model.ChannelStatusEnabled); err != nil {
+			logger.Errorf(ctx, "failed to enable key #%d of channel #%d: %s", key.Id, channel.Id, err.Error())
+			continue
+		}
+		logger.SysLog(fmt.Sprintf("key #%d of channel #%d has been enabled", key.Id, channel.Id))
+	}
+}
+
 var testAllChannelsLock sync.Mutex
 var testAllChannelsRunning bool = false
 
@@ -238,9 +268,10 @@ func testChannels(ctx context.Context, notify bool, scope string) error {
 	go func() {
 		for _, channel := range channels {
 			isChannelEnabled := channel.Status == model.ChannelStatusEnabled
+			recoverChannelKeys(ctx, channel)
 			tik := time.Now()
 			testRequest := buildTestRequest("")
-			_, err, openaiErr := testChannel(ctx, channel, testRequest)
+			_, keyId, err, openaiErr := testChannel(ctx, channel, testRequest)
 			tok := time.Now()
 			milliseconds := tok.Sub(tik).Milliseconds()
 			if isChannelEnabled && milliseconds > disableThreshold {
@@ -252,7 +283,11 @@ func testChannels(ctx context.Context, notify bool, scope string) error {
 				}
 			}
 			if isChannelEnabled && monitor.ShouldDisableChannel(openaiErr, -1) {
-				monitor.DisableChannel(channel.Id, channel.Name, err.Error())
+				if keyId != 0 {
+					monitor.DisableChannelKey(channel.Id, channel.Name, keyId, err.Error())
+				} else {
+					monitor.DisableChannel(channel.Id, channel.Name, err.Error())
+				}
 			}
 			if !isChannelEnabled && monitor.ShouldEnableChannel(err, openaiErr) {
 				monitor.EnableChannel(channel.Id, channel.Name)
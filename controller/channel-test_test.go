@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+func TestRecoverChannelKeys(t *testing.T) {
+	client.Init()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Authorization") != "Bearer sk-recovered-0001" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"message":"Incorrect API key provided","type":"invalid_request_error","code":"invalid_api_key"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}],
+			"usage":{"prompt_tokens":5,"completion_tokens":1,"total_tokens":6}}`))
+	}))
+	defer server.Close()
+	config.ApproximateTokenEnabled = true
+	automaticEnable := config.AutomaticEnableChannelEnabled
+	config.AutomaticEnableChannelEnabled = true
+	defer func() { config.AutomaticEnableChannelEnabled = automaticEnable }()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&dbmodel.Channel{}, &dbmodel.ChannelKey{}, &dbmodel.Log{}))
+	dbmodel.DB = db
+	dbmodel.LOG_DB = db
+	defer func() {
+		require.NoError(t, dbmodel.CloseDB())
+		dbmodel.DB, dbmodel.LOG_DB = nil, nil
+	}()
+
+	channel := &dbmodel.Channel{Type: channeltype.OpenAI, Key: "sk-revoked-0001", BaseURL: &server.URL, Models: "gpt-4o-mini", Status: dbmodel.ChannelStatusAutoDisabled}
+	require.NoError(t, db.Create(channel).Error)
+	_, err = dbmodel.AddChannelKeys(channel, []string{"sk-recovered-0001"})
+	require.NoError(t, err)
+	require.NoError(t, db.First(channel, channel.Id).Error)
+	keys, err := dbmodel.GetChannelKeys(channel.Id)
+	require.NoError(t, err)
+	for _, key := range keys {
+		_, err = dbmodel.DisableChannelKey(channel.Id, key.Id, "invalid api key")
+		require.NoError(t, err)
+	}
+
+	// without an enabled key the channel fails instead of using its own key
+	_, _, err, _ = testChannel(context.Background(), channel, buildTestRequest(""))
+	assert.Error(t, err)
+
+	// the keys which work again are enabled, the others stay disabled
+	recoverChannelKeys(context.Background(), channel)
+	keys, err = dbmodel.GetChannelKeys(channel.Id)
+	require.NoError(t, err)
+	assert.Equal(t, dbmodel.ChannelStatusAutoDisabled, keys[0].Status)
+	assert.Equal(t, dbmodel.ChannelStatusEnabled, keys[1].Status)
+	_, keyId, err, openaiErr := testChannel(context.Background(), channel, buildTestRequest(""))
+	require.NoError(t, err)
+	assert.Nil(t, openaiErr)
+	assert.Equal(t, keys[1].Id, keyId)
+
+	// the tests are logged in the background
+	assert.Eventually(t, func() bool {
+		var count int64
+		db.Model(&dbmodel.Log{}).Count(&count)
+		return count == 3
+	}, time.Second, 10*time.Millisecond)
+}
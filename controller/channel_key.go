@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+type ChannelKeysRequest struct {
+	// Keys are separated by new lines, like the keys of a new channel
+	Keys string `json:"keys"`
+}
+
+type ChannelKeyStatusRequest struct {
+	Status int `json:"status"`
+}
+
+func channelKeyError(c *gin.Context, err error) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": false,
+		"message": err.Error(),
+	})
+}
+
+func channelKeyIds(c *gin.Context) (channelId int, keyId int, err error) {
+	channelId, err = strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return 0, 0, errors.New("无效的渠道 Id")
+	}
+	if c.Param("key_id") == "" {
+		return channelId, 0, nil
+	}
+	keyId, err = strconv.Atoi(c.Param("key_id"))
+	if err != nil {
+		return 0, 0, errors.New("无效的密钥 Id")
+	}
+	return channelId, keyId, nil
+}
+
+// GetChannelKeys lists the keys of a channel with their health, the keys themselves are masked
+func GetChannelKeys(c *gin.Context) {
+	channelId, _, err := channelKeyIds(c)
+	if err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	keys, err := model.GetChannelKeys(channelId)
+	if err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    keys,
+	})
+}
+
+// AddChannelKeys turns a channel into a multi-key channel, or adds keys to one
+func AddChannelKeys(c *gin.Context) {
+	channelId, _, err := channelKeyIds(c)
+	if err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	var request ChannelKeysRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	channel, err := model.GetChannelById(channelId, true)
+	if err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	added, err := model.AddChannelKeys(channel, strings.Split(request.Keys, "\n"))
+	if err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    added,
+	})
+}
+
+func UpdateChannelKeyStatus(c *gin.Context) {
+	channelId, keyId, err := channelKeyIds(c)
+	if err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	var request ChannelKeyStatusRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	if err := model.UpdateChannelKeyStatus(channelId, keyId, request.Status); err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func DeleteChannelKey(c *gin.Context) {
+	channelId, keyId, err := channelKeyIds(c)
+	if err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	if err := model.DeleteChannelKey(channelId, keyId); err != nil {
+		channelKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
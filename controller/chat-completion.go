@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://platform.openai.com/docs/api-reference/chat/list
+
+type StoredCompletionMessage struct {
+	Id string `json:"id"`
+	relaymodel.Message
+}
+
+func toOpenAIChatCompletion(completion *model.StoredCompletion) map[string]any {
+	response := map[string]any{}
+	_ = json.Unmarshal([]byte(completion.Response), &response)
+	response["id"] = completion.Id
+	response["object"] = "chat.completion"
+	var metadata any
+	if completion.Metadata != "" {
+		_ = json.Unmarshal([]byte(completion.Metadata), &metadata)
+	}
+	response["metadata"] = metadata
+	return response
+}
+
+func ListChatCompletions(c *gin.Context) {
+	userId := c.GetInt(ctxkey.Id)
+	limit := getListLimit(c, 20, 100)
+	completions, err := model.GetUserStoredCompletions(userId, c.Query("model"), c.QueryMap("metadata"), c.Query("after"), c.Query("order"), limit+1)
+	if err != nil {
+		relayErrorResponse(c, http.StatusInternalServerError, "list_chat_completions_failed", err.Error())
+		return
+	}
+	hasMore := len(completions) > limit
+	if hasMore {
+		completions = completions[:limit]
+	}
+	data := make([]map[string]any, 0, len(completions))
+	for _, completion := range completions {
+		data = append(data, toOpenAIChatCompletion(completion))
+	}
+	response := gin.H{
+		"object":   "list",
+		"data":     data,
+		"has_more": hasMore,
+	}
+	if len(completions) > 0 {
+		response["first_id"] = completions[0].Id
+		response["last_id"] = completions[len(completions)-1].Id
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func getUserStoredCompletion(c *gin.Context) (*model.StoredCompletion, bool) {
+	completion, err := model.GetStoredCompletionByIds(c.Param("id"), c.GetInt(ctxkey.Id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			relayErrorResponse(c, http.StatusNotFound, "chat_completion_not_found", fmt.Sprintf("No such chat completion: %s", c.Param("id")))
+		} else {
+			relayErrorResponse(c, http.StatusInternalServerError, "get_chat_completion_failed", err.Error())
+		}
+		return nil, false
+	}
+	return completion, true
+}
+
+func RetrieveChatCompletion(c *gin.Context) {
+	completion, ok := getUserStoredCompletion(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIChatCompletion(completion))
+}
+
+// ListChatCompletionMessages returns the messages of the stored request, ids are "<completion id>-<index>"
+func ListChatCompletionMessages(c *gin.Context) {
+	completion, ok := getUserStoredCompletion(c)
+	if !ok {
+		return
+	}
+	var request relaymodel.GeneralOpenAIRequest
+	if err := json.Unmarshal([]byte(completion.Request), &request); err != nil {
+		relayErrorResponse(c, http.StatusInternalServerError, "parse_chat_completion_failed", err.Error())
+		return
+	}
+	messages := make([]StoredCompletionMessage, 0, len(request.Messages))
+	for i, message := range request.Messages {
+		messages = append(messages, StoredCompletionMessage{
+			Id:      fmt.Sprintf("%s-%d", completion.Id, i),
+			Message: message,
+		})
+	}
+	if c.Query("order") == "desc" {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	if after := c.Query("after"); after != "" {
+		for i, message := range messages {
+			if message.Id == after {
+				messages = messages[i+1:]
+				break
+			}
+		}
+	}
+	limit := getListLimit(c, 20, 100)
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	response := gin.H{
+		"object":   "list",
+		"data":     messages,
+		"has_more": hasMore,
+	}
+	if len(messages) > 0 {
+		response["first_id"] = messages[0].Id
+		response["last_id"] = messages[len(messages)-1].Id
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func DeleteChatCompletion(c *gin.Context) {
+	completion, ok := getUserStoredCompletion(c)
+	if !ok {
+		return
+	}
+	if err := completion.Delete(); err != nil {
+		relayErrorResponse(c, http.StatusInternalServerError, "delete_chat_completion_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      completion.Id,
+		"object":  "chat.completion.deleted",
+		"deleted": true,
+	})
+}
+
+// StartStoredCompletionCleaner removes stored completions past the retention, it should only run on the master node
+func StartStoredCompletionCleaner() {
+	if config.StoredCompletionRetentionDays <= 0 {
+		return
+	}
+	for {
+		before := time.Now().AddDate(0, 0, -config.StoredCompletionRetentionDays).Unix()
+		count, err := model.DeleteStoredCompletionsBefore(before)
+		if err != nil {
+			logger.SysError("failed to delete expired stored completions: " + err.Error())
+		} else if count > 0 {
+			logger.SysLog(fmt.Sprintf("deleted %d expired stored completions", count))
+		}
+		time.Sleep(time.Hour)
+	}
+}
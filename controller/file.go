@@ -0,0 +1,198 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/common/storage"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// https://platform.openai.com/docs/api-reference/files
+
+type OpenAIFile struct {
+	Id        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+}
+
+func toOpenAIFile(file *model.File) OpenAIFile {
+	return OpenAIFile{
+		Id:        file.Id,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+	}
+}
+
+var validFilePurposes = map[string]bool{
+	model.FilePurposeBatch:      true,
+	model.FilePurposeFineTune:   true,
+	model.FilePurposeAssistants: true,
+	model.FilePurposeVision:     true,
+	model.FilePurposeUserData:   true,
+}
+
+func getListLimit(c *gin.Context, defaultLimit int, maxLimit int) int {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		return defaultLimit
+	}
+	if limit > maxLimit {
+		return maxLimit
+	}
+	return limit
+}
+
+// saveFile stores the content and records it for the user
+func saveFile(ctx context.Context, userId int, filename string, purpose string, reader io.Reader, size int64) (*model.File, error) {
+	file := &model.File{
+		Id:        "file-" + random.GetUUID(),
+		UserId:    userId,
+		Bytes:     size,
+		CreatedAt: helper.GetTimestamp(),
+		Filename:  filename,
+		Purpose:   purpose,
+	}
+	file.StorageKey = fmt.Sprintf("%d/%s", userId, file.Id)
+	err := storage.GetStorage().Put(ctx, file.StorageKey, reader, size)
+	if err != nil {
+		return nil, err
+	}
+	err = file.Insert()
+	if err != nil {
+		_ = storage.GetStorage().Delete(ctx, file.StorageKey)
+		return nil, err
+	}
+	return file, nil
+}
+
+func UploadFile(c *gin.Context) {
+	userId := c.GetInt(ctxkey.Id)
+	purpose := c.PostForm("purpose")
+	if !validFilePurposes[purpose] {
+		relayErrorResponse(c, http.StatusBadRequest, "invalid_purpose", fmt.Sprintf("invalid purpose: %s", purpose))
+		return
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		relayErrorResponse(c, http.StatusBadRequest, "missing_file", err.Error())
+		return
+	}
+	if fileHeader.Size > int64(config.FileMaxSizeMB)*1024*1024 {
+		relayErrorResponse(c, http.StatusRequestEntityTooLarge, "file_too_large", fmt.Sprintf("file is larger than %d MB", config.FileMaxSizeMB))
+		return
+	}
+	reader, err := fileHeader.Open()
+	if err != nil {
+		relayErrorResponse(c, http.StatusBadRequest, "invalid_file", err.Error())
+		return
+	}
+	defer reader.Close()
+	file, err := saveFile(c.Request.Context(), userId, fileHeader.Filename, purpose, reader, fileHeader.Size)
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "failed to save file: %s", err.Error())
+		relayErrorResponse(c, http.StatusInternalServerError, "save_file_failed", "failed to save file")
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIFile(file))
+}
+
+func ListFiles(c *gin.Context) {
+	userId := c.GetInt(ctxkey.Id)
+	limit := getListLimit(c, 10000, 10000)
+	files, err := model.GetUserFiles(userId, c.Query("purpose"), c.Query("after"), limit+1)
+	if err != nil {
+		relayErrorResponse(c, http.StatusInternalServerError, "list_files_failed", err.Error())
+		return
+	}
+	hasMore := len(files) > limit
+	if hasMore {
+		files = files[:limit]
+	}
+	data := make([]OpenAIFile, 0, len(files))
+	for _, file := range files {
+		data = append(data, toOpenAIFile(file))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object":   "list",
+		"data":     data,
+		"has_more": hasMore,
+	})
+}
+
+func getUserFile(c *gin.Context) (*model.File, bool) {
+	file, err := model.GetFileByIds(c.Param("id"), c.GetInt(ctxkey.Id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			relayErrorResponse(c, http.StatusNotFound, "file_not_found", fmt.Sprintf("No such File object: %s", c.Param("id")))
+		} else {
+			relayErrorResponse(c, http.StatusInternalServerError, "get_file_failed", err.Error())
+		}
+		return nil, false
+	}
+	return file, true
+}
+
+func RetrieveFile(c *gin.Context) {
+	file, ok := getUserFile(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIFile(file))
+}
+
+func RetrieveFileContent(c *gin.Context) {
+	file, ok := getUserFile(c)
+	if !ok {
+		return
+	}
+	reader, err := storage.GetStorage().Get(c.Request.Context(), file.StorageKey)
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "failed to read file %s: %s", file.Id, err.Error())
+		relayErrorResponse(c, http.StatusInternalServerError, "read_file_failed", "failed to read file")
+		return
+	}
+	defer reader.Close()
+	c.DataFromReader(http.StatusOK, file.Bytes, "application/octet-stream", reader, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%s"`, file.Filename),
+	})
+}
+
+func DeleteFile(c *gin.Context) {
+	file, ok := getUserFile(c)
+	if !ok {
+		return
+	}
+	err := file.Delete()
+	if err != nil {
+		relayErrorResponse(c, http.StatusInternalServerError, "delete_file_failed", err.Error())
+		return
+	}
+	err = storage.GetStorage().Delete(c.Request.Context(), file.StorageKey)
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "failed to delete file content %s: %s", file.Id, err.Error())
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      file.Id,
+		"object":  "file",
+		"deleted": true,
+	})
+}
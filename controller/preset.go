@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+type PresetRequest struct {
+	Name  string `json:"name"`
+	Group string `json:"group"`
+	// Config is a json object of model.PresetConfig
+	Config json.RawMessage `json:"config"`
+}
+
+// checkPresetGroup tells if the user can see the presets of the group, or change them when write is set.
+// Group presets are managed by admins and visible to the users of the group.
+func checkPresetGroup(c *gin.Context, group string, write bool) error {
+	if group == "" || c.GetInt(ctxkey.Role) >= model.RoleAdminUser {
+		return nil
+	}
+	if write {
+		return fmt.Errorf("只有管理员可以管理分组预设")
+	}
+	userGroup, err := model.CacheGetUserGroup(c.GetInt(ctxkey.Id))
+	if err != nil {
+		return err
+	}
+	if userGroup != group {
+		return fmt.Errorf("无权访问分组 %s 的预设", group)
+	}
+	return nil
+}
+
+func presetError(c *gin.Context, err error) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": false,
+		"message": err.Error(),
+	})
+}
+
+// GetPresets lists the latest version of the presets of the user, or of the group given in the query
+func GetPresets(c *gin.Context) {
+	group := c.Query("group")
+	if err := checkPresetGroup(c, group, false); err != nil {
+		presetError(c, err)
+		return
+	}
+	presets, err := model.GetPresets(c.GetInt(ctxkey.Id), group)
+	if err != nil {
+		presetError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    presets,
+	})
+}
+
+// GetPresetVersions lists every version of a preset, the latest first
+func GetPresetVersions(c *gin.Context) {
+	group := c.Query("group")
+	if err := checkPresetGroup(c, group, false); err != nil {
+		presetError(c, err)
+		return
+	}
+	presets, err := model.GetPresetVersions(c.GetInt(ctxkey.Id), group, c.Param("name"))
+	if err != nil {
+		presetError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    presets,
+	})
+}
+
+// SavePreset creates a preset, or the next version of an existing one
+func SavePreset(c *gin.Context) {
+	var request PresetRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		presetError(c, err)
+		return
+	}
+	if request.Name == "" || len(request.Name) > 64 || strings.ContainsAny(request.Name, "@/") {
+		presetError(c, fmt.Errorf("预设名称不能为空，不能超过 64 个字符，且不能包含 @ 或 /"))
+		return
+	}
+	if err := checkPresetGroup(c, request.Group, true); err != nil {
+		presetError(c, err)
+		return
+	}
+	// unknown fields are rejected so that typos don't silently do nothing
+	var config model.PresetConfig
+	decoder := json.NewDecoder(bytes.NewReader(request.Config))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		presetError(c, fmt.Errorf("预设配置无效：%w", err))
+		return
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		presetError(c, err)
+		return
+	}
+	preset := model.Preset{
+		UserId: c.GetInt(ctxkey.Id),
+		Group:  request.Group,
+		Name:   request.Name,
+		Config: string(configJSON),
+	}
+	if err = preset.Insert(); err != nil {
+		presetError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    preset,
+	})
+}
+
+// DeletePreset removes every version of a preset
+func DeletePreset(c *gin.Context) {
+	group := c.Query("group")
+	if err := checkPresetGroup(c, group, true); err != nil {
+		presetError(c, err)
+		return
+	}
+	count, err := model.DeletePreset(c.GetInt(ctxkey.Id), group, c.Param("name"))
+	if err != nil {
+		presetError(c, err)
+		return
+	}
+	if count == 0 {
+		presetError(c, fmt.Errorf("预设 %s 不存在", c.Param("name")))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
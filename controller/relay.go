@@ -27,7 +27,9 @@ import (
 func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
 	var err *model.ErrorWithStatusCode
 	switch relayMode {
-	case relaymode.ImagesGenerations:
+	case relaymode.ImagesGenerations,
+		relaymode.ImagesEdits,
+		relaymode.ImagesVariations:
 		err = controller.RelayImageHelper(c, relayMode)
 	case relaymode.AudioSpeech:
 		fallthrough
@@ -37,6 +39,12 @@ func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
 		err = controller.RelayAudioHelper(c, relayMode)
 	case relaymode.Proxy:
 		err = controller.RelayProxyHelper(c, relayMode)
+	case relaymode.Realtime:
+		err = controller.RelayRealtimeHelper(c)
+	case relaymode.Rerank:
+		err = controller.RelayRerankHelper(c)
+	case relaymode.VideoGenerations:
+		err = controller.RelayVideoHelper(c)
 	default:
 		err = controller.RelayTextHelper(c)
 	}
@@ -55,6 +63,7 @@ func Relay(c *gin.Context) {
 	}
 	channelId := c.GetInt(ctxkey.ChannelId)
 	channelName := c.GetString(ctxkey.ChannelName)
+	keyId := c.GetInt(ctxkey.ChannelKeyId)
 	if channelId != 0 {
 		c.Header("X-OneAPI-Channel", fmt.Sprintf("%d", channelId))
 	}
@@ -79,16 +88,20 @@ func Relay(c *gin.Context) {
 		monitor.Emit(channelId, true)
 		return
 	}
-	if channelId != 0 {
+	// a request blocked by a guardrail is not a failure of the channel, and no other channel would take it
+	blocked := bizErr.Error.Code == controller.GuardrailBlockedErrorCode
+	if channelId != 0 && !blocked {
 		_ = dbmodel.OnRequestFailure(channelId, fmt.Sprintf("%v", bizErr.Error.Code))
 	}
 	lastFailedChannelId := channelId
 	group := c.GetString(ctxkey.Group)
 	originalModel := c.GetString(ctxkey.OriginalModel)
-	go processChannelRelayError(ctx, userId, channelId, channelName, *bizErr)
+	if !blocked {
+		go processChannelRelayError(ctx, userId, channelId, keyId, channelName, *bizErr)
+	}
 	requestId := c.GetString(helper.RequestIdKey)
 	retryTimes := config.RetryTimes
-	if !shouldRetry(c, bizErr.StatusCode) {
+	if blocked || !shouldRetry(c, bizErr.StatusCode) {
 		logger.Errorf(ctx, "relay error happen, status code is %d, won't retry in this case", bizErr.StatusCode)
 		retryTimes = 0
 	}
@@ -116,10 +129,14 @@ func Relay(c *gin.Context) {
 			break
 		}
 		logger.Infof(ctx, "using channel #%d to retry (remain times %d)", channel.Id, i)
-		if channel.Id == lastFailedChannelId {
+		// a multi-key channel is retried with another of its keys
+		if channel.Id == lastFailedChannelId && channel.KeyCount <= 1 {
+			continue
+		}
+		if err = middleware.SetupContextForSelectedChannel(c, channel, originalModel); err != nil {
+			logger.Errorf(ctx, "failed to set up channel #%d for retry: %s", channel.Id, err.Error())
 			continue
 		}
-		middleware.SetupContextForSelectedChannel(c, channel, originalModel)
 		c.Header("X-OneAPI-Channel", fmt.Sprintf("%d", channel.Id))
 		if channel.Name != "" {
 			c.Header("X-OneAPI-Channel-Name", channel.Name)
@@ -140,11 +157,15 @@ func Relay(c *gin.Context) {
 			}
 			return
 		}
+		if bizErr.Error.Code == controller.GuardrailBlockedErrorCode {
+			break
+		}
 		channelId := c.GetInt(ctxkey.ChannelId)
 		lastFailedChannelId = channelId
 		channelName := c.GetString(ctxkey.ChannelName)
+		keyId := c.GetInt(ctxkey.ChannelKeyId)
 		_ = dbmodel.OnRequestFailure(channelId, fmt.Sprintf("%v", bizErr.Error.Code))
-		go processChannelRelayError(ctx, userId, channelId, channelName, *bizErr)
+		go processChannelRelayError(ctx, userId, channelId, keyId, channelName, *bizErr)
 	}
 	if bizErr != nil {
 		if !c.Writer.Written() {
@@ -156,6 +177,10 @@ func Relay(c *gin.Context) {
 
 		// BUG: bizErr is in race condition
 		bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, requestId)
+		if c.Writer.Written() {
+			// the error ended a stream which was already sent
+			return
+		}
 		c.JSON(bizErr.StatusCode, gin.H{
 			"error": bizErr.Error,
 		})
@@ -166,13 +191,16 @@ func shouldRetry(c *gin.Context, statusCode int) bool {
 	if _, ok := c.Get(ctxkey.SpecificChannelId); ok {
 		return false
 	}
+	if c.Writer.Written() {
+		return false
+	}
 	if statusCode == http.StatusTooManyRequests {
 		return true
 	}
 	if statusCode/100 == 5 {
 		return true
 	}
-	if statusCode == http.StatusBadRequest {
+	if statusCode == http.StatusBadRequest || statusCode == http.StatusUnprocessableEntity {
 		return false
 	}
 	if statusCode/100 == 2 {
@@ -181,9 +209,23 @@ func shouldRetry(c *gin.Context, statusCode int) bool {
 	return true
 }
 
-func processChannelRelayError(ctx context.Context, userId int, channelId int, channelName string, err model.ErrorWithStatusCode) {
-	logger.Errorf(ctx, "relay error (channel id %d, user id: %d): %s", channelId, userId, err.Message)
+func processChannelRelayError(ctx context.Context, userId int, channelId int, keyId int, channelName string, err model.ErrorWithStatusCode) {
+	logger.Errorf(ctx, "relay error (channel id %d, key id %d, user id: %d): %s", channelId, keyId, userId, err.Message)
 	// https://platform.openai.com/docs/guides/error-codes/api-errors
+	if keyId != 0 {
+		// the failure belongs to the key, the other keys of the channel keep serving
+		switch {
+		case monitor.ShouldDisableChannel(&err.Error, err.StatusCode):
+			monitor.DisableChannelKey(channelId, channelName, keyId, err.Message)
+			return
+		case err.StatusCode == http.StatusTooManyRequests:
+			dbmodel.CooldownChannelKey(keyId, config.ChannelKeyCooldownSeconds, err.Message)
+			return
+		}
+		dbmodel.RecordChannelKeyFailure(keyId, err.Message)
+		monitor.Emit(channelId, false)
+		return
+	}
 	if monitor.ShouldDisableChannel(&err.Error, err.StatusCode) {
 		monitor.DisableChannel(channelId, channelName, err.Message)
 	} else {
@@ -241,3 +283,15 @@ func logCallMetadata(c *gin.Context, generationID string, attempt int, latency i
 		logger.Debugf(c.Request.Context(), "failed to insert call metadata: %v (code=%s)", err, errCode)
 	}
 }
+
+func relayErrorResponse(c *gin.Context, statusCode int, code string, message string) {
+	err := model.Error{
+		Message: helper.MessageWithRequestId(message, c.GetString(helper.RequestIdKey)),
+		Type:    "invalid_request_error",
+		Param:   "",
+		Code:    code,
+	}
+	c.JSON(statusCode, gin.H{
+		"error": err,
+	})
+}
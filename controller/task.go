@@ -0,0 +1,308 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/network"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	relaycontroller "github.com/songquanpeng/one-api/relay/controller"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// taskCallbackRetries is how many times a callback is sent before it is given up
+const taskCallbackRetries = 3
+
+// the callbacks are signed, so that the receivers can tell them from forged ones and refuse the replayed ones
+const (
+	TaskCallbackTimestampHeader = "X-Callback-Timestamp"
+	TaskCallbackSignatureHeader = "X-Callback-Signature"
+)
+
+var runningTasks sync.Map
+
+var (
+	taskCallbackClient     *http.Client
+	taskCallbackClientOnce sync.Once
+)
+
+func RetrieveTask(c *gin.Context) {
+	task, err := model.GetTaskByIds(c.Param("id"), c.GetInt(ctxkey.Id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			relayErrorResponse(c, http.StatusNotFound, "task_not_found", fmt.Sprintf("No such task: %s", c.Param("id")))
+		} else {
+			relayErrorResponse(c, http.StatusInternalServerError, "get_task_failed", err.Error())
+		}
+		return
+	}
+	c.JSON(http.StatusOK, relaycontroller.GetTaskResponse(task))
+}
+
+// StartTaskPoller polls the upstreams of the unfinished tasks, settles their quota once they finish and calls their callback urls
+func StartTaskPoller() {
+	for {
+		time.Sleep(time.Duration(config.TaskPollInterval) * time.Second)
+		tasks, err := model.GetUnfinishedTasks()
+		if err != nil {
+			logger.SysError("failed to get unfinished tasks: " + err.Error())
+			continue
+		}
+		for _, task := range tasks {
+			if _, running := runningTasks.LoadOrStore(task.Id, true); running {
+				continue
+			}
+			go func(task *model.Task) {
+				defer runningTasks.Delete(task.Id)
+				ctx := helper.SetRequestID(context.Background(), helper.GenRequestID())
+				pollTask(ctx, task)
+			}(task)
+		}
+	}
+}
+
+// getTaskMeta builds the meta of the channel the task was submitted to, with the key it was submitted with
+func getTaskMeta(task *model.Task) (*meta.Meta, error) {
+	channel, err := model.GetChannelById(task.ChannelId, true)
+	if err != nil {
+		return nil, fmt.Errorf("channel #%d not found", task.ChannelId)
+	}
+	cfg, _ := channel.LoadConfig()
+	taskMeta := &meta.Meta{
+		ChannelType:     channel.Type,
+		ChannelId:       channel.Id,
+		UserId:          task.UserId,
+		TokenId:         task.TokenId,
+		TokenName:       task.TokenName,
+		BaseURL:         getChannelBaseURL(channel),
+		APIKey:          channel.Key,
+		APIType:         channeltype.ToAPIType(channel.Type),
+		Config:          cfg,
+		OriginModelName: task.Model,
+		ActualModelName: task.Model,
+	}
+	// the tasks submitted before the mapped model was kept are polled with the requested one
+	if task.UpstreamModel != "" {
+		taskMeta.ActualModelName = task.UpstreamModel
+	}
+	if task.KeyId != 0 {
+		key, err := model.GetChannelKeyById(channel.Id, task.KeyId)
+		if err != nil {
+			return nil, fmt.Errorf("key #%d of channel #%d not found", task.KeyId, channel.Id)
+		}
+		taskMeta.APIKey = key.Key
+	}
+	return taskMeta, nil
+}
+
+func pollTask(ctx context.Context, task *model.Task) {
+	timedOut := helper.GetTimestamp()-task.CreatedAt > int64(config.TaskTimeout)
+	taskMeta, err := getTaskMeta(task)
+	if err != nil {
+		logger.Warnf(ctx, "task %s: %s", task.Id, err.Error())
+		if timedOut {
+			finishTask(ctx, task, &relaymodel.TaskResult{Status: relaymodel.TaskStatusFailed, Error: err.Error()})
+		}
+		return
+	}
+	taskAdaptor, ok := relay.GetAdaptor(taskMeta.APIType).(adaptor.TaskAdaptor)
+	if !ok {
+		finishTask(ctx, task, &relaymodel.TaskResult{Status: relaymodel.TaskStatusFailed, Error: "the channel does not support tasks anymore"})
+		return
+	}
+	taskAdaptor.Init(taskMeta)
+	result, err := taskAdaptor.FetchTask(taskMeta, task.UpstreamId)
+	if err != nil {
+		logger.Warnf(ctx, "task %s: failed to fetch upstream task: %s", task.Id, err.Error())
+		if timedOut {
+			finishTask(ctx, task, &relaymodel.TaskResult{Status: relaymodel.TaskStatusFailed, Error: "task timed out"})
+		}
+		return
+	}
+	if result.IsFinished() {
+		finishTask(ctx, task, result)
+		return
+	}
+	if timedOut {
+		finishTask(ctx, task, &relaymodel.TaskResult{Status: relaymodel.TaskStatusFailed, Error: "task timed out"})
+		return
+	}
+	if result.Status != task.Status {
+		task.Status = result.Status
+		task.UpdatedAt = helper.GetTimestamp()
+		if err = task.Update(); err != nil {
+			logger.Errorf(ctx, "task %s: failed to update status: %s", task.Id, err.Error())
+		}
+	}
+}
+
+// settledTaskQuota is the quota of the seconds of video generated, the reserved quota stands when the upstream doesn't
+// report the duration. A started second is charged in full, and so is a started unit of quota.
+func settledTaskQuota(task *model.Task, result *relaymodel.TaskResult) int64 {
+	if result.Duration <= 0 || task.Duration <= 0 {
+		return task.Quota
+	}
+	duration := int64(task.Duration)
+	return (task.Quota*int64(math.Ceil(result.Duration)) + duration - 1) / duration
+}
+
+// finishTask settles the quota of a succeeded task on the duration generated, or refunds it, then calls the callback url
+func finishTask(ctx context.Context, task *model.Task, result *relaymodel.TaskResult) {
+	now := helper.GetTimestamp()
+	reserved := task.Quota
+	if result.Status == relaymodel.TaskStatusSucceeded {
+		task.Quota = settledTaskQuota(task, result)
+	}
+	task.Status = result.Status
+	task.FailReason = result.Error
+	if len(result.Outputs) > 0 {
+		outputs, _ := json.Marshal(result.Outputs)
+		task.Outputs = string(outputs)
+	}
+	task.UpdatedAt = now
+	task.FinishedAt = now
+	finished, err := task.Finish()
+	if err != nil {
+		logger.Errorf(ctx, "task %s: failed to save the final state: %s", task.Id, err.Error())
+		return
+	}
+	if !finished {
+		return
+	}
+	if task.Status == relaymodel.TaskStatusSucceeded {
+		if task.Quota != reserved {
+			logger.Infof(ctx, "task %s generated %.1f seconds, settling %d quota instead of %d", task.Id, result.Duration, task.Quota, reserved)
+			relaycontroller.RefundTaskQuota(ctx, task.TokenId, task.UserId, reserved-task.Quota)
+		}
+		model.RecordConsumeLog(ctx, &model.Log{
+			UserId:      task.UserId,
+			ChannelId:   task.ChannelId,
+			ModelName:   task.Model,
+			TokenName:   task.TokenName,
+			Quota:       int(task.Quota),
+			Content:     fmt.Sprintf("视频任务 %s", task.Id),
+			ElapsedTime: (task.FinishedAt - task.CreatedAt) * 1000,
+		})
+		model.UpdateUserUsedQuotaAndRequestCount(task.UserId, task.Quota)
+		model.UpdateChannelUsedQuota(task.ChannelId, task.Quota)
+	} else {
+		logger.Infof(ctx, "task %s failed, refunding %d quota: %s", task.Id, task.Quota, task.FailReason)
+		relaycontroller.RefundTaskQuota(ctx, task.TokenId, task.UserId, task.Quota)
+	}
+	if task.CallbackURL != "" {
+		sendTaskCallback(ctx, task)
+	}
+}
+
+// refuseCallbackPrivateAddress is checked on every connection, the callback url was resolved when the task was submitted
+// but its host may point somewhere else now
+func refuseCallbackPrivateAddress(_ string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || network.IsPrivateIP(ip) {
+		return errors.New("callback url resolves to a private address")
+	}
+	return nil
+}
+
+func getTaskCallbackClient() *http.Client {
+	taskCallbackClientOnce.Do(func() {
+		dialer := &net.Dialer{Timeout: 10 * time.Second}
+		if !config.TaskCallbackAllowPrivateNetwork {
+			dialer.Control = refuseCallbackPrivateAddress
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = nil
+		transport.DialContext = dialer.DialContext
+		taskCallbackClient = &http.Client{
+			Transport: transport,
+			Timeout:   30 * time.Second,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	})
+	return taskCallbackClient
+}
+
+// getTaskCallbackSecret gives the configured secret, or else the key of the token which submitted the task as its
+// owner knows it, sk- included
+func getTaskCallbackSecret(task *model.Task) string {
+	if config.TaskCallbackSecret != "" {
+		return config.TaskCallbackSecret
+	}
+	token, err := model.GetTokenById(task.TokenId)
+	if err != nil {
+		return ""
+	}
+	return "sk-" + token.Key
+}
+
+// signTaskCallback is the hex HMAC-SHA256 of the timestamp and the body joined by a dot
+func signTaskCallback(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func sendTaskCallback(ctx context.Context, task *model.Task) {
+	body, err := json.Marshal(relaycontroller.GetTaskResponse(task))
+	if err != nil {
+		logger.Errorf(ctx, "task %s: failed to marshal callback: %s", task.Id, err.Error())
+		return
+	}
+	secret := getTaskCallbackSecret(task)
+	for i := 0; i < taskCallbackRetries; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(1<<i) * time.Second)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, task.CallbackURL, bytes.NewReader(body))
+		if err != nil {
+			logger.Errorf(ctx, "task %s: invalid callback url: %s", task.Id, err.Error())
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		timestamp := strconv.FormatInt(helper.GetTimestamp(), 10)
+		req.Header.Set(TaskCallbackTimestampHeader, timestamp)
+		req.Header.Set(TaskCallbackSignatureHeader, signTaskCallback(secret, timestamp, body))
+		resp, err := getTaskCallbackClient().Do(req)
+		if err != nil {
+			logger.Warnf(ctx, "task %s: callback failed: %s", task.Id, err.Error())
+			continue
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return
+		}
+		logger.Warnf(ctx, "task %s: callback returned status %d", task.Id, resp.StatusCode)
+	}
+	logger.Errorf(ctx, "task %s: callback given up after %d attempts", task.Id, taskCallbackRetries)
+}
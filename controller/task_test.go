@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	relaycontroller "github.com/songquanpeng/one-api/relay/controller"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// newAliTaskServer answers like dashscope for the tasks done, failed and running
+func newAliTaskServer(t *testing.T) *httptest.Server {
+	client.Init()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer sk-second", r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/tasks/done":
+			_, _ = w.Write([]byte(`{"output":{"task_id":"done","task_status":"SUCCEEDED","video_url":"https://cdn.example.com/done.mp4"},"usage":{"video_duration":3.2,"video_count":1}}`))
+		case "/api/v1/tasks/failed":
+			_, _ = w.Write([]byte(`{"output":{"task_id":"failed","task_status":"FAILED","code":"DataInspectionFailed","message":"inappropriate content"}}`))
+		case "/api/v1/tasks/running":
+			_, _ = w.Write([]byte(`{"output":{"task_id":"running","task_status":"RUNNING"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestPollTask(t *testing.T) {
+	server := newAliTaskServer(t)
+	defer server.Close()
+	var callbacks []relaymodel.Task
+	callbackServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		timestamp := r.Header.Get(TaskCallbackTimestampHeader)
+		assert.Equal(t, signTaskCallback("sk-task-token", timestamp, body), r.Header.Get(TaskCallbackSignatureHeader))
+		var task relaymodel.Task
+		require.NoError(t, json.Unmarshal(body, &task))
+		callbacks = append(callbacks, task)
+	}))
+	defer callbackServer.Close()
+	common.RedisEnabled = false
+	config.TaskCallbackAllowPrivateNetwork = true
+	defer func() { config.TaskCallbackAllowPrivateNetwork = false }()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&dbmodel.Channel{}, &dbmodel.ChannelKey{}, &dbmodel.Task{}, &dbmodel.Token{}, &dbmodel.User{}, &dbmodel.Log{}))
+	dbmodel.DB = db
+	dbmodel.LOG_DB = db
+	defer func() { dbmodel.DB, dbmodel.LOG_DB = nil, nil }()
+
+	channel := &dbmodel.Channel{Type: channeltype.Ali, Key: "sk-first", BaseURL: &server.URL}
+	require.NoError(t, db.Create(channel).Error)
+	key := &dbmodel.ChannelKey{ChannelId: channel.Id, Key: "sk-second", Status: dbmodel.ChannelStatusEnabled}
+	require.NoError(t, db.Create(key).Error)
+	user := &dbmodel.User{Username: "tasks", Password: "password", Quota: 1000}
+	require.NoError(t, db.Create(user).Error)
+	token := &dbmodel.Token{UserId: user.Id, Key: "task-token", RemainQuota: 1000}
+	require.NoError(t, db.Create(token).Error)
+
+	newTask := func(upstreamId string, createdAt int64) *dbmodel.Task {
+		task := &dbmodel.Task{
+			Id:          "task_" + upstreamId,
+			UserId:      user.Id,
+			TokenId:     token.Id,
+			ChannelId:   channel.Id,
+			KeyId:       key.Id,
+			Model:       "wanx2.1-t2v-turbo",
+			UpstreamId:  upstreamId,
+			Status:      relaymodel.TaskStatusQueued,
+			Quota:       100,
+			Duration:    5,
+			CallbackURL: callbackServer.URL,
+			CreatedAt:   createdAt,
+		}
+		require.NoError(t, task.Insert())
+		return task
+	}
+	now := helper.GetTimestamp()
+	ctx := context.Background()
+
+	// a running task is only updated
+	pollTask(ctx, newTask("running", now))
+	task, err := dbmodel.GetTaskByIds("task_running", user.Id)
+	require.NoError(t, err)
+	assert.Equal(t, relaymodel.TaskStatusInProgress, task.Status)
+	assert.Zero(t, task.FinishedAt)
+
+	// a succeeded task is charged for the 4 seconds started, out of the 5 reserved
+	pollTask(ctx, newTask("done", now))
+	task, err = dbmodel.GetTaskByIds("task_done", user.Id)
+	require.NoError(t, err)
+	assert.Equal(t, relaymodel.TaskStatusSucceeded, task.Status)
+	assert.NotZero(t, task.FinishedAt)
+	assert.Equal(t, []relaymodel.TaskOutput{{URL: "https://cdn.example.com/done.mp4"}}, relaycontroller.GetTaskResponse(task).Outputs)
+	assert.EqualValues(t, 80, task.Quota)
+	require.NoError(t, db.First(user, user.Id).Error)
+	assert.EqualValues(t, 1020, user.Quota)
+	assert.EqualValues(t, 80, user.UsedQuota)
+
+	// a failed task and a task running for too long are refunded
+	pollTask(ctx, newTask("failed", now))
+	pollTask(ctx, newTask("running-too-long", now-int64(config.TaskTimeout)-1))
+	require.NoError(t, db.First(user, user.Id).Error)
+	assert.EqualValues(t, 1220, user.Quota)
+	require.NoError(t, db.First(token, token.Id).Error)
+	assert.EqualValues(t, 1220, token.RemainQuota)
+	task, err = dbmodel.GetTaskByIds("task_failed", user.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "inappropriate content", task.FailReason)
+
+	// finishing twice doesn't refund twice
+	finishTask(ctx, task, &relaymodel.TaskResult{Status: relaymodel.TaskStatusFailed, Error: "again"})
+	require.NoError(t, db.First(user, user.Id).Error)
+	assert.EqualValues(t, 1220, user.Quota)
+
+	require.Len(t, callbacks, 3)
+	assert.Equal(t, "task_done", callbacks[0].Id)
+	assert.Equal(t, relaymodel.TaskStatusFailed, callbacks[1].Status)
+	assert.Equal(t, "inappropriate content", callbacks[1].Error.Message)
+	assert.Equal(t, "task timed out", callbacks[2].Error.Message)
+
+	// the task is polled with the model it was submitted as
+	taskMeta, err := getTaskMeta(&dbmodel.Task{ChannelId: channel.Id, Model: "video", UpstreamModel: "wanx2.1-t2v-turbo"})
+	require.NoError(t, err)
+	assert.Equal(t, "video", taskMeta.OriginModelName)
+	assert.Equal(t, "wanx2.1-t2v-turbo", taskMeta.ActualModelName)
+}
+
+func TestSettledTaskQuota(t *testing.T) {
+	task := &dbmodel.Task{Quota: 500, Duration: 5}
+	assert.EqualValues(t, 500, settledTaskQuota(task, &relaymodel.TaskResult{}))
+	assert.EqualValues(t, 300, settledTaskQuota(task, &relaymodel.TaskResult{Duration: 2.5}))
+	assert.EqualValues(t, 1000, settledTaskQuota(task, &relaymodel.TaskResult{Duration: 10}))
+	// the quota of a second isn't truncated
+	assert.EqualValues(t, 301, settledTaskQuota(&dbmodel.Task{Quota: 1001, Duration: 10}, &relaymodel.TaskResult{Duration: 3}))
+	// the tasks submitted before the duration was kept
+	assert.EqualValues(t, 500, settledTaskQuota(&dbmodel.Task{Quota: 500}, &relaymodel.TaskResult{Duration: 2}))
+}
+
+func TestSignTaskCallback(t *testing.T) {
+	config.TaskCallbackSecret = "whsec"
+	defer func() { config.TaskCallbackSecret = "" }()
+	assert.Equal(t, "whsec", getTaskCallbackSecret(&dbmodel.Task{}))
+	// echo -n '1700000000.{"id":"task_1"}' | openssl dgst -sha256 -hmac whsec
+	assert.Equal(t, "sha256=bab5cb556dc466bba2d746b85fe1fa449cb776dd486b7dd68ddc86f6d1deed8b",
+		signTaskCallback("whsec", "1700000000", []byte(`{"id":"task_1"}`)))
+}
@@ -9,8 +9,11 @@ import (
 	"github.com/songquanpeng/one-api/common/network"
 	"github.com/songquanpeng/one-api/common/random"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/guardrail"
+	"github.com/songquanpeng/one-api/relay/mcp"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 func GetAllTokens(c *gin.Context) {
@@ -117,9 +120,26 @@ func validateToken(c *gin.Context, token model.Token) error {
 			return fmt.Errorf("无效的网段：%s", err.Error())
 		}
 	}
+	if token.GuardrailPolicy != "" && !guardrail.PolicyExists(token.GuardrailPolicy) {
+		return fmt.Errorf("安全策略不存在：%s", token.GuardrailPolicy)
+	}
+	if !canSetMCPServers(c) {
+		return nil
+	}
+	for _, server := range strings.Split(token.MCPServers, ",") {
+		if server = strings.TrimSpace(server); server != "" && !mcp.ServerExists(server) {
+			return fmt.Errorf("MCP 服务器不存在：%s", server)
+		}
+	}
 	return nil
 }
 
+// canSetMCPServers tells if the user can link mcp servers to tokens, the servers run commands on the host of the
+// gateway and are called with the headers of the admin, so only admins can, the field is ignored for other users
+func canSetMCPServers(c *gin.Context) bool {
+	return c.GetInt(ctxkey.Role) >= model.RoleAdminUser
+}
+
 func AddToken(c *gin.Context) {
 	token := model.Token{}
 	err := c.ShouldBindJSON(&token)
@@ -140,16 +160,22 @@ func AddToken(c *gin.Context) {
 	}
 
 	cleanToken := model.Token{
-		UserId:         c.GetInt(ctxkey.Id),
-		Name:           token.Name,
-		Key:            random.GenerateKey(),
-		CreatedTime:    helper.GetTimestamp(),
-		AccessedTime:   helper.GetTimestamp(),
-		ExpiredTime:    token.ExpiredTime,
-		RemainQuota:    token.RemainQuota,
-		UnlimitedQuota: token.UnlimitedQuota,
-		Models:         token.Models,
-		Subnet:         token.Subnet,
+		UserId:           c.GetInt(ctxkey.Id),
+		Name:             token.Name,
+		Key:              random.GenerateKey(),
+		CreatedTime:      helper.GetTimestamp(),
+		AccessedTime:     helper.GetTimestamp(),
+		ExpiredTime:      token.ExpiredTime,
+		RemainQuota:      token.RemainQuota,
+		UnlimitedQuota:   token.UnlimitedQuota,
+		Models:           token.Models,
+		Subnet:           token.Subnet,
+		StoreCompletions: token.StoreCompletions,
+		ResponseCache:    token.ResponseCache,
+		GuardrailPolicy:  token.GuardrailPolicy,
+	}
+	if canSetMCPServers(c) {
+		cleanToken.MCPServers = token.MCPServers
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -239,6 +265,12 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.UnlimitedQuota = token.UnlimitedQuota
 		cleanToken.Models = token.Models
 		cleanToken.Subnet = token.Subnet
+		cleanToken.StoreCompletions = token.StoreCompletions
+		cleanToken.ResponseCache = token.ResponseCache
+		cleanToken.GuardrailPolicy = token.GuardrailPolicy
+		if canSetMCPServers(c) {
+			cleanToken.MCPServers = token.MCPServers
+		}
 	}
 	err = cleanToken.Update()
 	if err != nil {
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+type TokenizeRequest struct {
+	Model string `json:"model" binding:"required"`
+	// Input is a string, or an array of strings for count_tokens
+	Input    any                  `json:"input,omitempty"`
+	Messages []relaymodel.Message `json:"messages,omitempty"`
+}
+
+// Tokenize returns the tokens of the input with the tokenizer of the model, only the count is given when the
+// tokenizer is an estimate. Messages are counted the way requests are pre-consumed, without tokens.
+func Tokenize(c *gin.Context) {
+	var request TokenizeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		relayErrorResponse(c, http.StatusBadRequest, "invalid_tokenize_request", err.Error())
+		return
+	}
+	tokenizer := openai.GetTokenizer(request.Model)
+	response := gin.H{
+		"model":     request.Model,
+		"tokenizer": tokenizer.Name(),
+		"exact":     tokenizer.Exact(),
+	}
+	if len(request.Messages) > 0 {
+		response["exact"] = tokenizer.Exact() && !config.ApproximateTokenEnabled
+		response["count"] = openai.CountTokenMessages(request.Messages, request.Model)
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	input, ok := request.Input.(string)
+	if !ok {
+		relayErrorResponse(c, http.StatusBadRequest, "invalid_tokenize_request", "input must be a string, or messages must be given")
+		return
+	}
+	response["count"] = tokenizer.Count(input)
+	if tokens := tokenizer.Encode(input); tokens != nil {
+		response["tokens"] = tokens
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CountTokens counts the prompt tokens of messages or an input the same way requests are pre-consumed
+func CountTokens(c *gin.Context) {
+	var request TokenizeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		relayErrorResponse(c, http.StatusBadRequest, "invalid_count_tokens_request", err.Error())
+		return
+	}
+	var count int
+	switch {
+	case len(request.Messages) > 0:
+		count = openai.CountTokenMessages(request.Messages, request.Model)
+	case request.Input != nil:
+		switch input := request.Input.(type) {
+		case string:
+			count = openai.CountTokenText(input, request.Model)
+		case []any:
+			for _, item := range input {
+				text, _ := item.(string)
+				count += openai.CountTokenText(text, request.Model)
+			}
+		}
+	default:
+		relayErrorResponse(c, http.StatusBadRequest, "invalid_count_tokens_request", "messages or input is required")
+		return
+	}
+	tokenizer := openai.GetTokenizer(request.Model)
+	c.JSON(http.StatusOK, gin.H{
+		"model":        request.Model,
+		"tokenizer":    tokenizer.Name(),
+		"exact":        tokenizer.Exact() && !config.ApproximateTokenEnabled,
+		"input_tokens": count,
+	})
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/relay/tokenizer"
+)
+
+// wordTokenizer counts one token per word
+type wordTokenizer struct{}
+
+func (wordTokenizer) Name() string {
+	return "words"
+}
+
+func (wordTokenizer) Exact() bool {
+	return true
+}
+
+func (wordTokenizer) Encode(text string) []int {
+	tokens := make([]int, 0)
+	for i := range strings.Fields(text) {
+		tokens = append(tokens, i)
+	}
+	return tokens
+}
+
+func (t wordTokenizer) Count(text string) int {
+	return len(t.Encode(text))
+}
+
+func TestTokenize(t *testing.T) {
+	config.ApproximateTokenEnabled = false
+	tokenizer.Register([]string{"tokenize-test"}, func() tokenizer.Tokenizer {
+		return wordTokenizer{}
+	})
+	tokenize := func(body string) (int, map[string]any) {
+		gin.SetMode(gin.TestMode)
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/tokenize", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		Tokenize(c)
+		var response map[string]any
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		return recorder.Code, response
+	}
+
+	code, response := tokenize(`{"model": "tokenize-test", "input": "hello big world"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "words", response["tokenizer"])
+	assert.EqualValues(t, 3, response["count"])
+	assert.Equal(t, []any{0.0, 1.0, 2.0}, response["tokens"])
+
+	// messages are counted with the tokens of the chat format
+	code, response = tokenize(`{"model": "tokenize-test", "messages": [{"role": "user", "content": "hello big world"}]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Greater(t, response["count"], 3.0)
+	assert.NotContains(t, response, "tokens")
+
+	code, _ = tokenize(`{"model": "tokenize-test", "input": ["hello"]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
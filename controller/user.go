@@ -814,3 +814,43 @@ func AdminTopUp(c *gin.Context) {
 	})
 	return
 }
+
+func GetPreferences(c *gin.Context) {
+	preferences, err := model.GetUserPreferences(c.GetInt(ctxkey.Id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    preferences,
+	})
+}
+
+// UpdatePreferences saves the preferences of the user, the default model and parameters apply to the requests
+// which don't set them
+func UpdatePreferences(c *gin.Context) {
+	var preferences model.UserPreferences
+	err := json.NewDecoder(c.Request.Body).Decode(&preferences)
+	if err == nil && preferences.DefaultParameters != "" && !json.Valid([]byte(preferences.DefaultParameters)) {
+		err = fmt.Errorf("default_parameters 不是有效的 JSON")
+	}
+	if err == nil {
+		err = model.UpdateUserPreferences(c.GetInt(ctxkey.Id), &preferences)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
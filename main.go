@@ -16,6 +16,7 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/i18n"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/storage"
 	"github.com/songquanpeng/one-api/controller"
 	"github.com/songquanpeng/one-api/middleware"
 	"github.com/songquanpeng/one-api/model"
@@ -92,6 +93,13 @@ func main() {
 		}
 		go controller.AutomaticallyTestChannels(frequency)
 	}
+	if os.Getenv("CHANNEL_MODEL_SYNC_FREQUENCY") != "" && config.IsMasterNode {
+		frequency, err := strconv.Atoi(os.Getenv("CHANNEL_MODEL_SYNC_FREQUENCY"))
+		if err != nil {
+			logger.FatalLog("failed to parse CHANNEL_MODEL_SYNC_FREQUENCY: " + err.Error())
+		}
+		go controller.AutomaticallySyncChannelModels(frequency)
+	}
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
 		config.BatchUpdateEnabled = true
 		logger.SysLog("batch update enabled with interval " + strconv.Itoa(config.BatchUpdateInterval) + "s")
@@ -105,6 +113,12 @@ func main() {
 	}
 	openai.InitTokenEncoders()
 	client.Init()
+	storage.Init()
+	if config.IsMasterNode {
+		go controller.StartBatchExecutor()
+		go controller.StartTaskPoller()
+		go controller.StartStoredCompletionCleaner()
+	}
 
 	// Initialize i18n
 	if err := i18n.Init(); err != nil {
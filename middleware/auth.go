@@ -92,6 +92,9 @@ func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
 		key := c.Request.Header.Get("Authorization")
+		if key == "" {
+			key = getWebSocketProtocolKey(c)
+		}
 		key = strings.TrimPrefix(key, "Bearer ")
 		key = strings.TrimPrefix(key, "sk-")
 		parts := strings.Split(key, "-")
@@ -116,22 +119,19 @@ func TokenAuth() func(c *gin.Context) {
 			abortWithMessage(c, http.StatusForbidden, "用户已被封禁")
 			return
 		}
+		if err = applyPreset(c, token.UserId); err != nil {
+			abortWithMessage(c, http.StatusBadRequest, err.Error())
+			return
+		}
 		requestModel, err := getRequestModel(c)
 		if err != nil && shouldCheckModel(c) {
 			abortWithMessage(c, http.StatusBadRequest, err.Error())
 			return
 		}
-		c.Set(ctxkey.RequestModel, requestModel)
-		if token.Models != nil && *token.Models != "" {
-			c.Set(ctxkey.AvailableModels, *token.Models)
-			if requestModel != "" && !isModelInList(requestModel, *token.Models) {
-				abortWithMessage(c, http.StatusForbidden, fmt.Sprintf("该令牌无权使用模型：%s", requestModel))
-				return
-			}
+		if err = SetTokenContext(c, token, requestModel); err != nil {
+			abortWithMessage(c, http.StatusForbidden, err.Error())
+			return
 		}
-		c.Set(ctxkey.Id, token.UserId)
-		c.Set(ctxkey.TokenId, token.Id)
-		c.Set(ctxkey.TokenName, token.Name)
 		if len(parts) > 1 {
 			if model.IsAdmin(token.UserId) {
 				c.Set(ctxkey.SpecificChannelId, parts[1])
@@ -150,6 +150,27 @@ func TokenAuth() func(c *gin.Context) {
 	}
 }
 
+// SetTokenContext puts the token and its settings into the context, the requests made by the gateway on behalf of
+// a token, like the lines of a batch, are relayed the same as the ones of the token. An error is returned when the
+// token may not use the model.
+func SetTokenContext(c *gin.Context, token *model.Token, requestModel string) error {
+	c.Set(ctxkey.RequestModel, requestModel)
+	if token.Models != nil && *token.Models != "" {
+		c.Set(ctxkey.AvailableModels, *token.Models)
+		if requestModel != "" && !isModelInList(requestModel, *token.Models) {
+			return fmt.Errorf("该令牌无权使用模型：%s", requestModel)
+		}
+	}
+	c.Set(ctxkey.Id, token.UserId)
+	c.Set(ctxkey.TokenId, token.Id)
+	c.Set(ctxkey.TokenName, token.Name)
+	c.Set(ctxkey.StoreCompletions, token.StoreCompletions)
+	c.Set(ctxkey.ResponseCache, token.ResponseCache)
+	c.Set(ctxkey.GuardrailPolicy, token.GuardrailPolicy)
+	c.Set(ctxkey.MCPServers, token.MCPServers)
+	return nil
+}
+
 func shouldCheckModel(c *gin.Context) bool {
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/completions") {
 		return true
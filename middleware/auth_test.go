@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestTokenAuthWithoutBody(t *testing.T) {
+	common.RedisEnabled = false
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Token{}))
+	model.DB = db
+	t.Cleanup(func() { model.DB = nil })
+	require.NoError(t, db.Create(&model.User{Id: 1, Username: "user", Status: model.UserStatusEnabled}).Error)
+	require.NoError(t, db.Create(&model.Token{Id: 1, UserId: 1, Key: "testkey", Status: model.TokenStatusEnabled, ExpiredTime: -1, UnlimitedQuota: true}).Error)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(TokenAuth())
+	handler := func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(ctxkey.RequestModel))
+	}
+	router.GET("/v1/chat/completions", handler)
+	router.GET("/v1/chat/completions/:id", handler)
+	router.DELETE("/v1/chat/completions/:id", handler)
+	router.POST("/v1/chat/completions", handler)
+	router.GET("/v1/realtime", handler)
+
+	request := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer sk-testkey")
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// sdks send a json content type with an empty body
+	for _, r := range []struct{ method, path string }{
+		{http.MethodGet, "/v1/chat/completions"},
+		{http.MethodGet, "/v1/chat/completions/chatcmpl-1"},
+		{http.MethodDelete, "/v1/chat/completions/chatcmpl-1"},
+	} {
+		recorder := request(r.method, r.path, "")
+		assert.Equal(t, http.StatusOK, recorder.Code, r.path)
+	}
+
+	recorder := request(http.MethodGet, "/v1/realtime?model=gpt-4o-mini-realtime-preview", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "gpt-4o-mini-realtime-preview", recorder.Body.String())
+
+	recorder = request(http.MethodPost, "/v1/chat/completions", `{"model":"gpt-4o"}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "gpt-4o", recorder.Body.String())
+	recorder = request(http.MethodPost, "/v1/chat/completions", "")
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
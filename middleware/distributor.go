@@ -56,12 +56,17 @@ func Distribute() func(c *gin.Context) {
 			}
 		}
 		logger.Debugf(ctx, "user id %d, user group: %s, request model: %s, using channel #%d", userId, userGroup, requestModel, channel.Id)
-		SetupContextForSelectedChannel(c, channel, requestModel)
+		if err := SetupContextForSelectedChannel(c, channel, requestModel); err != nil {
+			abortWithMessage(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
 		c.Next()
 	}
 }
 
-func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, modelName string) {
+// SetupContextForSelectedChannel sets the channel used by the request, it fails when a multi-key channel has no
+// enabled key left
+func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, modelName string) error {
 	c.Set(ctxkey.Channel, channel.Type)
 	c.Set(ctxkey.ChannelId, channel.Id)
 	c.Set(ctxkey.ChannelName, channel.Name)
@@ -70,7 +75,6 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	}
 	c.Set(ctxkey.ModelMapping, channel.GetModelMapping())
 	c.Set(ctxkey.OriginalModel, modelName) // for retry
-	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
 	c.Set(ctxkey.BaseURL, channel.GetBaseURL())
 	cfg, _ := channel.LoadConfig()
 	// this is for backward compatibility
@@ -98,5 +102,27 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 			}
 		}
 	}
+	key, err := selectChannelKey(c, channel, cfg)
+	if err != nil {
+		return err
+	}
+	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
 	c.Set(ctxkey.Config, cfg)
+	return nil
+}
+
+// selectChannelKey gives the key of the channel, for a multi-key channel the key is picked by its key selection and
+// remembered so that a failure is charged to that key only
+func selectChannelKey(c *gin.Context, channel *model.Channel, cfg model.ChannelConfig) (string, error) {
+	c.Set(ctxkey.ChannelKeyId, 0)
+	if channel.KeyCount == 0 {
+		return channel.Key, nil
+	}
+	key, err := model.SelectChannelKey(channel.Id, cfg.KeySelection)
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to select a key of channel #%d: %s", channel.Id, err.Error()))
+		return "", fmt.Errorf("渠道 #%d 没有可用的密钥", channel.Id)
+	}
+	c.Set(ctxkey.ChannelKeyId, key.Id)
+	return key.Key, nil
 }
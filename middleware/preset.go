@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// presetModelPrefix references a preset in place of the model, like "@preset/name" or "@preset/name@2"
+const presetModelPrefix = "@preset/"
+
+func isPresetPath(path string) bool {
+	return strings.HasPrefix(path, "/v1/chat/completions") || strings.HasPrefix(path, "/v1/completions")
+}
+
+// parsePresetRef splits name@version, the version is 0 when not given
+func parsePresetRef(ref string) (string, int, error) {
+	name, version, found := strings.Cut(ref, "@")
+	if name == "" {
+		return "", 0, fmt.Errorf("预设名称为空")
+	}
+	if !found {
+		return name, 0, nil
+	}
+	v, err := strconv.Atoi(version)
+	if err != nil || v <= 0 {
+		return "", 0, fmt.Errorf("无效的预设版本：%s", version)
+	}
+	return name, v, nil
+}
+
+// setDefaults sets the fields of defaults which the request doesn't have, it tells whether one was set
+func setDefaults(request map[string]any, defaults map[string]any) bool {
+	set := false
+	for key, value := range defaults {
+		if _, ok := request[key]; !ok {
+			request[key] = value
+			set = true
+		}
+	}
+	return set
+}
+
+// addSystemPrompt puts the system prompt before the messages of a chat, or before the prompt of a completion.
+// The prompts given as tokens can't take it, such requests are refused rather than sent without it.
+func addSystemPrompt(request map[string]any, systemPrompt string) error {
+	if messages, ok := request["messages"].([]any); ok {
+		request["messages"] = append([]any{map[string]any{"role": "system", "content": systemPrompt}}, messages...)
+		return nil
+	}
+	switch prompt := request["prompt"].(type) {
+	case nil:
+	case string:
+		request["prompt"] = systemPrompt + "\n\n" + prompt
+	case []any:
+		for i, item := range prompt {
+			text, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("预设的系统提示词无法用于以 token 给出的 prompt")
+			}
+			prompt[i] = systemPrompt + "\n\n" + text
+		}
+	default:
+		return fmt.Errorf("预设的系统提示词无法用于以 token 给出的 prompt")
+	}
+	return nil
+}
+
+func mergePreset(request map[string]any, config *model.PresetConfig) error {
+	if config.SystemPrompt != "" {
+		if err := addSystemPrompt(request, config.SystemPrompt); err != nil {
+			return err
+		}
+	}
+	if _, ok := request["model"]; !ok && config.Model != "" {
+		request["model"] = config.Model
+	}
+	parameters := *config
+	parameters.SystemPrompt = ""
+	parameters.Model = ""
+	jsonBytes, err := json.Marshal(parameters)
+	if err != nil {
+		return err
+	}
+	var defaults map[string]any
+	if err = json.Unmarshal(jsonBytes, &defaults); err != nil {
+		return err
+	}
+	setDefaults(request, defaults)
+	return nil
+}
+
+// applyPreset merges the preset referenced by the request, then the defaults from the preferences of the user,
+// into the request body. It runs before the model is read, so that the channel is chosen for the merged request.
+func applyPreset(c *gin.Context, userId int) error {
+	if !isPresetPath(c.Request.URL.Path) || !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		return nil
+	}
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil
+	}
+	var request map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(requestBody))
+	decoder.UseNumber()
+	if err = decoder.Decode(&request); err != nil || request == nil {
+		// invalid requests are reported by the relay
+		return nil
+	}
+	changed := false
+	ref, _ := request["preset"].(string)
+	if _, ok := request["preset"]; ok {
+		delete(request, "preset")
+		changed = true
+	}
+	if modelName, _ := request["model"].(string); strings.HasPrefix(modelName, presetModelPrefix) {
+		ref = strings.TrimPrefix(modelName, presetModelPrefix)
+		delete(request, "model")
+	}
+	if ref != "" {
+		name, version, err := parsePresetRef(ref)
+		if err != nil {
+			return err
+		}
+		group, err := model.CacheGetUserGroup(userId)
+		if err != nil {
+			return err
+		}
+		preset, err := model.ResolvePreset(userId, group, name, version)
+		if err != nil {
+			return err
+		}
+		config, err := preset.GetConfig()
+		if err != nil {
+			return fmt.Errorf("预设 %s 的配置无效：%w", preset.Ref(), err)
+		}
+		if err = mergePreset(request, config); err != nil {
+			return err
+		}
+		c.Set(ctxkey.Preset, preset.Ref())
+		changed = true
+	}
+	if defaults, err := model.CacheGetUserDefaults(userId); err == nil {
+		if modelName, _ := request["model"].(string); modelName == "" && defaults.DefaultModel != "" {
+			request["model"] = defaults.DefaultModel
+			changed = true
+		}
+		if defaults.DefaultParameters != "" {
+			var parameters map[string]any
+			if json.Unmarshal([]byte(defaults.DefaultParameters), &parameters) == nil {
+				delete(parameters, "model")
+				delete(parameters, "messages")
+				delete(parameters, "prompt")
+				if setDefaults(request, parameters) {
+					changed = true
+				}
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if _, ok := request["model"]; !ok && ref != "" {
+		return fmt.Errorf("预设 %s 未指定模型", ref)
+	}
+	requestBody, err = json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	c.Set(ctxkey.KeyRequestBody, requestBody)
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	c.Request.ContentLength = int64(len(requestBody))
+	return nil
+}
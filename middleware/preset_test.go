@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestParsePresetRef(t *testing.T) {
+	name, version, err := parsePresetRef("translator")
+	require.NoError(t, err)
+	assert.Equal(t, "translator", name)
+	assert.Equal(t, 0, version)
+
+	name, version, err = parsePresetRef("translator@2")
+	require.NoError(t, err)
+	assert.Equal(t, "translator", name)
+	assert.Equal(t, 2, version)
+
+	for _, ref := range []string{"", "@1", "translator@", "translator@0", "translator@-1", "translator@x"} {
+		_, _, err = parsePresetRef(ref)
+		assert.Error(t, err, ref)
+	}
+}
+
+func TestMergePreset(t *testing.T) {
+	temperature := 0.2
+	config := &model.PresetConfig{
+		SystemPrompt: "You are a translator.",
+		Model:        "gpt-4o",
+		Temperature:  &temperature,
+		MaxTokens:    100,
+	}
+
+	request := map[string]any{
+		"messages": []any{map[string]any{"role": "user", "content": "Bonjour"}},
+	}
+	require.NoError(t, mergePreset(request, config))
+	assert.Equal(t, []any{
+		map[string]any{"role": "system", "content": "You are a translator."},
+		map[string]any{"role": "user", "content": "Bonjour"},
+	}, request["messages"])
+	assert.Equal(t, "gpt-4o", request["model"])
+	assert.Equal(t, 0.2, request["temperature"])
+	assert.EqualValues(t, 100, request["max_tokens"])
+	assert.NotContains(t, request, "system_prompt")
+	assert.NotContains(t, request, "top_p")
+
+	// the fields of the request are kept
+	request = map[string]any{
+		"model":       "gpt-4o-mini",
+		"temperature": 1,
+		"messages":    []any{},
+	}
+	require.NoError(t, mergePreset(request, config))
+	assert.Equal(t, "gpt-4o-mini", request["model"])
+	assert.Equal(t, 1, request["temperature"])
+	assert.EqualValues(t, 100, request["max_tokens"])
+	assert.Len(t, request["messages"], 1)
+
+	// requests without messages or prompt don't get the system prompt
+	request = map[string]any{"input": "Bonjour"}
+	require.NoError(t, mergePreset(request, config))
+	assert.NotContains(t, request, "messages")
+	assert.Equal(t, "gpt-4o", request["model"])
+
+	// the completions get it before their prompt
+	request = map[string]any{"prompt": "Bonjour"}
+	require.NoError(t, mergePreset(request, config))
+	assert.Equal(t, "You are a translator.\n\nBonjour", request["prompt"])
+	request = map[string]any{"prompt": []any{"Bonjour", "Salut"}}
+	require.NoError(t, mergePreset(request, config))
+	assert.Equal(t, []any{"You are a translator.\n\nBonjour", "You are a translator.\n\nSalut"}, request["prompt"])
+	request = map[string]any{"prompt": []any{json.Number("9906"), json.Number("1917")}}
+	assert.Error(t, mergePreset(request, config))
+}
+
+func TestSetDefaults(t *testing.T) {
+	request := map[string]any{"temperature": 1}
+	assert.False(t, setDefaults(request, map[string]any{"temperature": 0.5}))
+	assert.True(t, setDefaults(request, map[string]any{"temperature": 0.5, "top_p": 0.9}))
+	assert.Equal(t, map[string]any{"temperature": 1, "top_p": 0.9}, request)
+}
@@ -73,7 +73,10 @@ func SmartDistribute(routerEngine *router.Engine) func(c *gin.Context) {
 		logger.Debugf(ctx, "user id %d, user group: %s, request model: %s, using channel #%d",
 			userId, userGroup, requestModel, channel.Id)
 
-		SetupContextForSelectedChannel(c, channel, requestModel)
+		if err := SetupContextForSelectedChannel(c, channel, requestModel); err != nil {
+			abortWithMessage(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
 		c.Next()
 	}
 }
\ No newline at end of file
@@ -3,9 +3,11 @@ package middleware
 import (
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	"net/http"
 	"strings"
 )
 
@@ -22,9 +24,15 @@ func abortWithMessage(c *gin.Context, statusCode int, message string) {
 
 func getRequestModel(c *gin.Context) (string, error) {
 	var modelRequest ModelRequest
-	err := common.UnmarshalBodyReusable(c, &modelRequest)
-	if err != nil {
-		return "", fmt.Errorf("common.UnmarshalBodyReusable failed: %w", err)
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodDelete:
+		// these requests carry no body, even when sdks send a json content type
+		modelRequest.Model = c.Query("model")
+	default:
+		err := common.UnmarshalBodyReusable(c, &modelRequest)
+		if err != nil {
+			return "", fmt.Errorf("common.UnmarshalBodyReusable failed: %w", err)
+		}
 	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/moderations") {
 		if modelRequest.Model == "" {
@@ -36,11 +44,16 @@ func getRequestModel(c *gin.Context) (string, error) {
 			modelRequest.Model = c.Param("model")
 		}
 	}
-	if strings.HasPrefix(c.Request.URL.Path, "/v1/images/generations") {
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/images/") {
 		if modelRequest.Model == "" {
 			modelRequest.Model = "dall-e-2"
 		}
 	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/realtime") {
+		if modelRequest.Model == "" {
+			modelRequest.Model = "gpt-4o-realtime-preview"
+		}
+	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/audio/transcriptions") || strings.HasPrefix(c.Request.URL.Path, "/v1/audio/translations") {
 		if modelRequest.Model == "" {
 			modelRequest.Model = "whisper-1"
@@ -58,3 +71,14 @@ func isModelInList(modelName string, models string) bool {
 	}
 	return false
 }
+
+// getWebSocketProtocolKey reads the key that browser clients of the realtime api
+// can only pass as a subprotocol, e.g. "openai-insecure-api-key.sk-xxx"
+func getWebSocketProtocolKey(c *gin.Context) string {
+	for _, protocol := range websocket.Subprotocols(c.Request) {
+		if key, ok := strings.CutPrefix(protocol, "openai-insecure-api-key."); ok {
+			return key
+		}
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+// https://platform.openai.com/docs/api-reference/batch/object
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+type Batch struct {
+	Id               string `json:"id" gorm:"primaryKey;type:varchar(64)"`
+	UserId           int    `json:"user_id" gorm:"index"`
+	TokenId          int    `json:"token_id"`
+	Endpoint         string `json:"endpoint"`
+	InputFileId      string `json:"input_file_id" gorm:"type:varchar(64)"`
+	CompletionWindow string `json:"completion_window"`
+	Status           string `json:"status" gorm:"type:varchar(32);index"`
+	OutputFileId     string `json:"output_file_id" gorm:"type:varchar(64)"`
+	ErrorFileId      string `json:"error_file_id" gorm:"type:varchar(64)"`
+	ErrorMessage     string `json:"error_message" gorm:"type:text"`
+	Metadata         string `json:"metadata" gorm:"type:text"`
+	CreatedAt        int64  `json:"created_at" gorm:"bigint"`
+	InProgressAt     int64  `json:"in_progress_at" gorm:"bigint"`
+	ExpiresAt        int64  `json:"expires_at" gorm:"bigint"`
+	FinalizingAt     int64  `json:"finalizing_at" gorm:"bigint"`
+	CompletedAt      int64  `json:"completed_at" gorm:"bigint"`
+	FailedAt         int64  `json:"failed_at" gorm:"bigint"`
+	ExpiredAt        int64  `json:"expired_at" gorm:"bigint"`
+	CancellingAt     int64  `json:"cancelling_at" gorm:"bigint"`
+	CancelledAt      int64  `json:"cancelled_at" gorm:"bigint"`
+	TotalCount       int    `json:"total_count"`
+	CompletedCount   int    `json:"completed_count"`
+	FailedCount      int    `json:"failed_count"`
+	// Model is set when every request in the input file uses the same model
+	Model string `json:"model"`
+	// ChannelId & UpstreamId are only set when the batch is passed through to an upstream batch api
+	ChannelId  int    `json:"channel_id"`
+	UpstreamId string `json:"upstream_id"`
+	// OutputBilled is set together with the output file of a passed through batch, so it is billed once
+	OutputBilled bool `json:"-" gorm:"default:false"`
+}
+
+func (batch *Batch) Insert() error {
+	return DB.Create(batch).Error
+}
+
+func (batch *Batch) Update() error {
+	return DB.Save(batch).Error
+}
+
+// UpdateIfStatus saves the batch unless its status changed since it was read, e.g. by a concurrent cancel
+func (batch *Batch) UpdateIfStatus(status string) (bool, error) {
+	result := DB.Model(batch).Where("status = ?", status).Select("*").Updates(batch)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (batch *Batch) IsFinished() bool {
+	switch batch.Status {
+	case BatchStatusFailed, BatchStatusCompleted, BatchStatusExpired, BatchStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func GetBatchByIds(id string, userId int) (*Batch, error) {
+	if id == "" || userId == 0 {
+		return nil, errors.New("id 或 userId 为空！")
+	}
+	var batch Batch
+	err := DB.First(&batch, "id = ? and user_id = ?", id, userId).Error
+	return &batch, err
+}
+
+func GetBatchById(id string) (*Batch, error) {
+	var batch Batch
+	err := DB.First(&batch, "id = ?", id).Error
+	return &batch, err
+}
+
+func GetUserBatches(userId int, after string, limit int) ([]*Batch, error) {
+	var batches []*Batch
+	query := DB.Where("user_id = ?", userId)
+	if after != "" {
+		query = query.Where("created_at < (?)", DB.Model(&Batch{}).Select("created_at").Where("id = ?", after))
+	}
+	err := query.Order("created_at desc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+func GetUnfinishedBatches() ([]*Batch, error) {
+	var batches []*Batch
+	err := DB.Where("status in ?", []string{BatchStatusValidating, BatchStatusInProgress, BatchStatusFinalizing, BatchStatusCancelling}).
+		Order("created_at asc").Find(&batches).Error
+	return batches, err
+}
+
+// UpdateBatchProgress only touches the counters so that it won't overwrite a concurrent cancel
+func UpdateBatchProgress(id string, completed int, failed int) error {
+	return DB.Model(&Batch{}).Where("id = ?", id).Updates(map[string]any{
+		"completed_count": completed,
+		"failed_count":    failed,
+	}).Error
+}
+
+// SetBatchOutputFile keeps the output file of a passed through batch and marks it billed in one statement,
+// it returns false when the output was already billed, so the caller must not bill it again
+func SetBatchOutputFile(id string, outputFileId string) (bool, error) {
+	result := DB.Model(&Batch{}).Where("id = ? and output_billed = ?", id, false).Updates(map[string]any{
+		"output_file_id": outputFileId,
+		"output_billed":  true,
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+func GetBatchStatus(id string) (string, error) {
+	var batch Batch
+	err := DB.Select("status").First(&batch, "id = ?", id).Error
+	return batch.Status, err
+}
+
+func CancelBatch(id string) error {
+	return DB.Model(&Batch{}).Where("id = ? and status in ?", id, []string{BatchStatusValidating, BatchStatusInProgress}).Updates(map[string]any{
+		"status":        BatchStatusCancelling,
+		"cancelling_at": helper.GetTimestamp(),
+	}).Error
+}
@@ -216,6 +216,36 @@ func InitChannelCache() {
 	logger.SysLog("channels synced from database")
 }
 
+// CacheUpdateChannel applies a change to the cached channel without waiting for the next sync. The cached channels
+// are read without the lock once returned, so the channel is replaced by an updated copy.
+func CacheUpdateChannel(channelId int, update func(channel *Channel)) {
+	if !config.MemoryCacheEnabled {
+		return
+	}
+	channelSyncLock.Lock()
+	defer channelSyncLock.Unlock()
+	var updated *Channel
+	for _, model2channels := range group2model2channels {
+		for model, channels := range model2channels {
+			for i, channel := range channels {
+				if channel.Id != channelId {
+					continue
+				}
+				if updated == nil {
+					copied := *channel
+					update(&copied)
+					updated = &copied
+				}
+				replaced := make([]*Channel, len(channels))
+				copy(replaced, channels)
+				replaced[i] = updated
+				model2channels[model] = replaced
+				break
+			}
+		}
+	}
+}
+
 func SyncChannelCache(frequency int) {
 	for {
 		time.Sleep(time.Duration(frequency) * time.Second)
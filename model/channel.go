@@ -2,7 +2,9 @@ package model
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
@@ -38,6 +40,8 @@ type Channel struct {
 	Priority           *int64  `json:"priority" gorm:"bigint;default:0"`
 	Config             string  `json:"config"`
 	SystemPrompt       *string `json:"system_prompt" gorm:"type:text"`
+	// KeyCount is the number of keys in channel_keys, the channel only uses Key when it is 0
+	KeyCount int `json:"key_count" gorm:"default:0"`
 }
 
 type ChannelConfig struct {
@@ -50,6 +54,28 @@ type ChannelConfig struct {
 	Plugin            string `json:"plugin,omitempty"`
 	VertexAIProjectID string `json:"vertex_ai_project_id,omitempty"`
 	VertexAIADC       string `json:"vertex_ai_adc,omitempty"`
+	// ToolEmulation describes tools in the prompt instead of sending them, for all models or only the listed ones
+	ToolEmulation       bool     `json:"tool_emulation,omitempty"`
+	ToolEmulationModels []string `json:"tool_emulation_models,omitempty"`
+	// ModelSync lets the scheduled model sync update the models of the channel from the upstream
+	ModelSync bool `json:"model_sync,omitempty"`
+	// AzureAuthType is api_key by default, client_credentials signs in with the key as the client secret and
+	// managed_identity with the identity of the host
+	AzureAuthType string `json:"azure_auth_type,omitempty"`
+	AzureTenantID string `json:"azure_tenant_id,omitempty"`
+	AzureClientID string `json:"azure_client_id,omitempty"`
+	// AzureDeployments maps the models to their deployments, the deployment is the model without dots otherwise
+	AzureDeployments map[string]string `json:"azure_deployments,omitempty"`
+	// KeySelection is how a multi-key channel picks its key: round_robin (the default), random or least_used
+	KeySelection string `json:"key_selection,omitempty"`
+	// AnthropicBeta lists the beta features enabled for the claude models of the channel
+	AnthropicBeta []string `json:"anthropic_beta,omitempty"`
+	// GeminiSafetySettings maps the harm categories to their thresholds, GEMINI_SAFETY_SETTING is used for the others
+	GeminiSafetySettings map[string]string `json:"gemini_safety_settings,omitempty"`
+	// DifyAppType is chat for the chat-messages api of the chatbot, agent and chatflow apps, or workflow
+	DifyAppType string `json:"dify_app_type,omitempty"`
+	// DifyInputs are the default inputs of the app, the inputs of the requests are merged over them
+	DifyInputs map[string]any `json:"dify_inputs,omitempty"`
 }
 
 func GetAllChannels(startIdx int, num int, scope string) ([]*Channel, error) {
@@ -134,9 +160,24 @@ func (channel *Channel) Insert() error {
 	return err
 }
 
+// ErrMultiKeyChannelKey is returned when the key of a multi-key channel is edited like the one of a single key
+// channel, its keys are managed one by one
+var ErrMultiKeyChannelKey = errors.New("多密钥渠道的密钥需要在密钥管理中添加或删除")
+
 func (channel *Channel) Update() error {
 	var err error
-	err = DB.Model(channel).Updates(channel).Error
+	if channel.Key != "" {
+		var stored Channel
+		err = DB.Select("key", "key_count").First(&stored, "id = ?", channel.Id).Error
+		if err != nil {
+			return err
+		}
+		if stored.KeyCount > 0 && channel.Key != stored.Key {
+			return ErrMultiKeyChannelKey
+		}
+	}
+	// the key count is kept by the keys of the channel
+	err = DB.Model(channel).Omit("key_count").Updates(channel).Error
 	if err != nil {
 		return err
 	}
@@ -145,6 +186,26 @@ func (channel *Channel) Update() error {
 	return err
 }
 
+// UpdateModels replaces the models of the channel and its abilities, the channel must be complete
+func (channel *Channel) UpdateModels(models []string) error {
+	channel.Models = strings.Join(models, ",")
+	err := DB.Model(channel).Update("models", channel.Models).Error
+	if err != nil {
+		return err
+	}
+	return channel.UpdateAbilities()
+}
+
+// UpdateConfig saves the config of the channel
+func (channel *Channel) UpdateConfig(cfg ChannelConfig) error {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	channel.Config = string(data)
+	return DB.Model(channel).Update("config", channel.Config).Error
+}
+
 func (channel *Channel) UpdateResponseTime(responseTime int64) {
 	err := DB.Model(channel).Select("response_time", "test_time").Updates(Channel{
 		TestTime:     helper.GetTimestamp(),
@@ -172,7 +233,10 @@ func (channel *Channel) Delete() error {
 		return err
 	}
 	err = channel.DeleteAbilities()
-	return err
+	if err != nil {
+		return err
+	}
+	return DB.Where("channel_id = ?", channel.Id).Delete(&ChannelKey{}).Error
 }
 
 func (channel *Channel) LoadConfig() (ChannelConfig, error) {
@@ -215,10 +279,16 @@ func updateChannelUsedQuota(id int, quota int64) {
 
 func DeleteChannelByStatus(status int64) (int64, error) {
 	result := DB.Where("status = ?", status).Delete(&Channel{})
+	if result.Error == nil {
+		deleteOrphanChannelKeys()
+	}
 	return result.RowsAffected, result.Error
 }
 
 func DeleteDisabledChannel() (int64, error) {
 	result := DB.Where("status = ? or status = ?", ChannelStatusAutoDisabled, ChannelStatusManuallyDisabled).Delete(&Channel{})
+	if result.Error == nil {
+		deleteOrphanChannelKeys()
+	}
 	return result.RowsAffected, result.Error
 }
@@ -0,0 +1,381 @@
+package model
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+const (
+	KeySelectionRoundRobin = "round_robin"
+	KeySelectionRandom     = "random"
+	KeySelectionLeastUsed  = "least_used"
+)
+
+// ChannelKey is one of the keys of a multi-key channel. Every key has its own health: a rate limited key cools down
+// for a while, and a key refused by the upstream is disabled without disabling the channel.
+type ChannelKey struct {
+	Id            int    `json:"id"`
+	ChannelId     int    `json:"channel_id" gorm:"index"`
+	Key           string `json:"-" gorm:"type:text"`
+	MaskedKey     string `json:"key" gorm:"-"`
+	Status        int    `json:"status" gorm:"default:1"`
+	UsedCount     int64  `json:"used_count" gorm:"bigint;default:0"`
+	FailureCount  int64  `json:"failure_count" gorm:"bigint;default:0"`
+	CooldownUntil int64  `json:"cooldown_until" gorm:"bigint;default:0"`
+	LastError     string `json:"last_error" gorm:"type:text"`
+	LastUsedTime  int64  `json:"last_used_time" gorm:"bigint"`
+	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
+}
+
+// keyCursors are the round robin positions of the channels
+var keyCursors sync.Map
+
+// ChannelKeyCacheSeconds is how long the enabled keys of a channel are selected from memory before they are read
+// again, and how often their usage is written back. The changes made on this node apply at once.
+var ChannelKeyCacheSeconds = 10
+
+var ErrNoEnabledChannelKey = errors.New("no enabled key")
+
+type cachedChannelKeys struct {
+	keys     []*ChannelKey
+	loadedAt int64
+}
+
+var (
+	channelKeyCache     = make(map[int]*cachedChannelKeys)
+	channelKeyCacheLock sync.Mutex
+	// channelKeyUsage is the usage of the keys not written to the database yet, by key id
+	channelKeyUsage     = make(map[int]*ChannelKey)
+	channelKeyUsageOnce sync.Once
+)
+
+// MaskKey keeps only the ends of a key, so that admins can tell the keys apart
+func MaskKey(key string) string {
+	if len(key) <= 8 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:4] + "..." + key[len(key)-4:]
+}
+
+// GetChannelKeys lists the keys of the channel with their secrets masked
+func GetChannelKeys(channelId int) ([]*ChannelKey, error) {
+	var keys []*ChannelKey
+	err := DB.Where("channel_id = ?", channelId).Order("id").Find(&keys).Error
+	for _, key := range keys {
+		key.MaskedKey = MaskKey(key.Key)
+	}
+	return keys, err
+}
+
+// GetChannelKeyById returns a key of the channel with its secret, for the jobs going on with the key they started with
+func GetChannelKeyById(channelId int, id int) (*ChannelKey, error) {
+	var key ChannelKey
+	err := DB.First(&key, "id = ? and channel_id = ?", id, channelId).Error
+	return &key, err
+}
+
+// AddChannelKeys adds the keys the channel doesn't have yet and returns how many were added. The first time, the
+// key of the channel itself becomes the first of its keys.
+func AddChannelKeys(channel *Channel, keys []string) (int, error) {
+	added := 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var existing []string
+		if err := tx.Model(&ChannelKey{}).Where("channel_id = ?", channel.Id).Pluck("key", &existing).Error; err != nil {
+			return err
+		}
+		if len(existing) == 0 && channel.Key != "" {
+			keys = append([]string{channel.Key}, keys...)
+		}
+		seen := make(map[string]bool)
+		for _, key := range existing {
+			seen[key] = true
+		}
+		for _, key := range keys {
+			key = strings.TrimSpace(key)
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			channelKey := &ChannelKey{
+				ChannelId:   channel.Id,
+				Key:         key,
+				Status:      ChannelStatusEnabled,
+				CreatedTime: helper.GetTimestamp(),
+			}
+			if err := tx.Create(channelKey).Error; err != nil {
+				return err
+			}
+			added++
+		}
+		return syncChannelKeys(tx, channel.Id)
+	})
+	invalidateChannelKeys(channel.Id)
+	if err == nil {
+		refreshCachedChannel(channel.Id)
+	}
+	return added, err
+}
+
+// DeleteChannelKey removes a key, the last key of a channel can't be removed
+func DeleteChannelKey(channelId int, id int) error {
+	defer invalidateChannelKeys(channelId)
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&ChannelKey{}).Where("channel_id = ?", channelId).Count(&count).Error; err != nil {
+			return err
+		}
+		if count <= 1 {
+			return errors.New("渠道至少需要保留一个密钥")
+		}
+		result := tx.Where("id = ? and channel_id = ?", id, channelId).Delete(&ChannelKey{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("密钥不存在")
+		}
+		return syncChannelKeys(tx, channelId)
+	})
+	if err == nil {
+		refreshCachedChannel(channelId)
+	}
+	return err
+}
+
+// UpdateChannelKeyStatus enables or disables a key by hand, enabling it also ends its cooldown
+func UpdateChannelKeyStatus(channelId int, id int, status int) error {
+	if status != ChannelStatusEnabled && status != ChannelStatusManuallyDisabled {
+		return errors.New("无效的密钥状态")
+	}
+	result := DB.Model(&ChannelKey{}).Where("id = ? and channel_id = ?", id, channelId).
+		Updates(map[string]any{"status": status, "cooldown_until": 0})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("密钥不存在")
+	}
+	invalidateChannelKeys(channelId)
+	return nil
+}
+
+// syncChannelKeys keeps the key count of the channel, and its key set to the first one for the balance and tests
+func syncChannelKeys(tx *gorm.DB, channelId int) error {
+	var keys []*ChannelKey
+	if err := tx.Where("channel_id = ?", channelId).Order("id").Find(&keys).Error; err != nil {
+		return err
+	}
+	updates := map[string]any{"key_count": len(keys)}
+	if len(keys) > 0 {
+		updates["key"] = keys[0].Key
+	}
+	return tx.Model(&Channel{}).Where("id = ?", channelId).Updates(updates).Error
+}
+
+// refreshCachedChannel applies the key and the key count kept by syncChannelKeys to the cached channel at once, so
+// that the channel doesn't go on with its single key until the next sync of the channels
+func refreshCachedChannel(channelId int) {
+	var channel Channel
+	if err := DB.Select("id", "key", "key_count").First(&channel, "id = ?", channelId).Error; err != nil {
+		logger.SysError("failed to refresh the cached channel: " + err.Error())
+		return
+	}
+	CacheUpdateChannel(channelId, func(cached *Channel) {
+		cached.Key = channel.Key
+		cached.KeyCount = channel.KeyCount
+	})
+}
+
+func deleteOrphanChannelKeys() {
+	err := DB.Where("channel_id not in (?)", DB.Model(&Channel{}).Select("id")).Delete(&ChannelKey{}).Error
+	if err != nil {
+		logger.SysError("failed to delete keys of deleted channels: " + err.Error())
+	}
+}
+
+// invalidateChannelKeys drops the cached keys of the channel, they are read again by the next selection
+func invalidateChannelKeys(channelId int) {
+	channelKeyCacheLock.Lock()
+	delete(channelKeyCache, channelId)
+	channelKeyCacheLock.Unlock()
+}
+
+// updateCachedChannelKey applies a change made in the database to the cached key, if any
+func updateCachedChannelKey(id int, update func(key *ChannelKey)) {
+	channelKeyCacheLock.Lock()
+	defer channelKeyCacheLock.Unlock()
+	for _, cached := range channelKeyCache {
+		for _, key := range cached.keys {
+			if key.Id == id {
+				update(key)
+				return
+			}
+		}
+	}
+}
+
+// getEnabledChannelKeys gives the cached enabled keys of the channel, they are read without holding the lock
+func getEnabledChannelKeys(channelId int) ([]*ChannelKey, error) {
+	now := helper.GetTimestamp()
+	channelKeyCacheLock.Lock()
+	cached, ok := channelKeyCache[channelId]
+	channelKeyCacheLock.Unlock()
+	if ok && now-cached.loadedAt < int64(ChannelKeyCacheSeconds) {
+		return cached.keys, nil
+	}
+	var keys []*ChannelKey
+	err := DB.Where("channel_id = ? and status = ?", channelId, ChannelStatusEnabled).Order("id").Find(&keys).Error
+	if err != nil {
+		return nil, err
+	}
+	channelKeyCacheLock.Lock()
+	defer channelKeyCacheLock.Unlock()
+	for _, key := range keys {
+		// the usage not written yet still counts for the least used selection
+		if usage, ok := channelKeyUsage[key.Id]; ok {
+			key.UsedCount += usage.UsedCount
+		}
+	}
+	channelKeyCache[channelId] = &cachedChannelKeys{keys: keys, loadedAt: now}
+	return keys, nil
+}
+
+// SelectChannelKey picks the key of a multi-key channel for a request among the enabled keys out of cooldown. When
+// all of them cool down, the one available first is used rather than failing the request. The keys are selected
+// from memory and their usage is written back in the background.
+func SelectChannelKey(channelId int, selection string) (*ChannelKey, error) {
+	keys, err := getEnabledChannelKeys(channelId)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, ErrNoEnabledChannelKey
+	}
+	channelKeyCacheLock.Lock()
+	defer channelKeyCacheLock.Unlock()
+	now := helper.GetTimestamp()
+	var available []*ChannelKey
+	for _, key := range keys {
+		if key.CooldownUntil <= now {
+			available = append(available, key)
+		}
+	}
+	var selected *ChannelKey
+	switch {
+	case len(available) == 0:
+		selected = keys[0]
+		for _, key := range keys[1:] {
+			if key.CooldownUntil < selected.CooldownUntil {
+				selected = key
+			}
+		}
+	case selection == KeySelectionRandom:
+		selected = available[rand.Intn(len(available))]
+	case selection == KeySelectionLeastUsed:
+		selected = available[0]
+		for _, key := range available[1:] {
+			if key.UsedCount < selected.UsedCount {
+				selected = key
+			}
+		}
+	default:
+		cursor, _ := keyCursors.LoadOrStore(channelId, new(uint64))
+		next := atomic.AddUint64(cursor.(*uint64), 1) - 1
+		selected = available[next%uint64(len(available))]
+	}
+	selected.UsedCount++
+	selected.LastUsedTime = now
+	usage, ok := channelKeyUsage[selected.Id]
+	if !ok {
+		usage = &ChannelKey{}
+		channelKeyUsage[selected.Id] = usage
+	}
+	usage.UsedCount++
+	usage.LastUsedTime = now
+	channelKeyUsageOnce.Do(func() {
+		go func() {
+			for {
+				time.Sleep(time.Duration(ChannelKeyCacheSeconds) * time.Second)
+				flushChannelKeyUsage()
+			}
+		}()
+	})
+	key := *selected
+	return &key, nil
+}
+
+// flushChannelKeyUsage writes the usage counted since the last flush
+func flushChannelKeyUsage() {
+	channelKeyCacheLock.Lock()
+	usages := channelKeyUsage
+	channelKeyUsage = make(map[int]*ChannelKey)
+	channelKeyCacheLock.Unlock()
+	for id, usage := range usages {
+		err := DB.Model(&ChannelKey{}).Where("id = ?", id).Updates(map[string]any{
+			"used_count":     gorm.Expr("used_count + ?", usage.UsedCount),
+			"last_used_time": usage.LastUsedTime,
+		}).Error
+		if err != nil {
+			logger.SysError("failed to update channel key usage: " + err.Error())
+		}
+	}
+}
+
+// GetAutoDisabledChannelKeys lists the keys disabled after an upstream refusal, with their secrets, to test them
+func GetAutoDisabledChannelKeys(channelId int) ([]*ChannelKey, error) {
+	var keys []*ChannelKey
+	err := DB.Where("channel_id = ? and status = ?", channelId, ChannelStatusAutoDisabled).Order("id").Find(&keys).Error
+	return keys, err
+}
+
+// CooldownChannelKey keeps a rate limited key out of the selection for the given seconds
+func CooldownChannelKey(id int, seconds int, reason string) {
+	cooldownUntil := helper.GetTimestamp() + int64(seconds)
+	updateCachedChannelKey(id, func(key *ChannelKey) {
+		key.CooldownUntil = cooldownUntil
+	})
+	err := DB.Model(&ChannelKey{}).Where("id = ?", id).Updates(map[string]any{
+		"cooldown_until": cooldownUntil,
+		"failure_count":  gorm.Expr("failure_count + 1"),
+		"last_error":     reason,
+	}).Error
+	if err != nil {
+		logger.SysError("failed to cool down channel key: " + err.Error())
+	}
+}
+
+// RecordChannelKeyFailure keeps the last error of a key
+func RecordChannelKeyFailure(id int, reason string) {
+	err := DB.Model(&ChannelKey{}).Where("id = ?", id).Updates(map[string]any{
+		"failure_count": gorm.Expr("failure_count + 1"),
+		"last_error":    reason,
+	}).Error
+	if err != nil {
+		logger.SysError("failed to record channel key failure: " + err.Error())
+	}
+}
+
+// DisableChannelKey disables a key refused by the upstream and returns how many enabled keys the channel has left
+func DisableChannelKey(channelId int, id int, reason string) (int64, error) {
+	defer invalidateChannelKeys(channelId)
+	err := DB.Model(&ChannelKey{}).Where("id = ?", id).Updates(map[string]any{
+		"status":        ChannelStatusAutoDisabled,
+		"failure_count": gorm.Expr("failure_count + 1"),
+		"last_error":    reason,
+	}).Error
+	if err != nil {
+		return 0, err
+	}
+	var enabled int64
+	err = DB.Model(&ChannelKey{}).Where("channel_id = ? and status = ?", channelId, ChannelStatusEnabled).Count(&enabled).Error
+	return enabled, err
+}
@@ -0,0 +1,162 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func setupChannelKeys(t *testing.T, selection string) *Channel {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&Channel{}, &ChannelKey{}))
+	DB = db
+	t.Cleanup(func() {
+		flushChannelKeyUsage()
+		DB = nil
+	})
+	channel := &Channel{Key: "sk-first-key-0001", Config: `{"key_selection":"` + selection + `"}`}
+	require.NoError(t, DB.Create(channel).Error)
+	keyCursors.Delete(channel.Id)
+	added, err := AddChannelKeys(channel, []string{"sk-second-key-0002", "sk-third-key-0003", "sk-second-key-0002"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, added)
+	require.NoError(t, DB.First(channel, channel.Id).Error)
+	assert.Equal(t, 3, channel.KeyCount)
+	return channel
+}
+
+func selectKeys(t *testing.T, channel *Channel, selection string, n int) []string {
+	var selected []string
+	for i := 0; i < n; i++ {
+		key, err := SelectChannelKey(channel.Id, selection)
+		require.NoError(t, err)
+		selected = append(selected, key.Key)
+	}
+	return selected
+}
+
+func TestSelectChannelKeyRoundRobin(t *testing.T) {
+	channel := setupChannelKeys(t, KeySelectionRoundRobin)
+	assert.Equal(t, []string{"sk-first-key-0001", "sk-second-key-0002", "sk-third-key-0003", "sk-first-key-0001"},
+		selectKeys(t, channel, KeySelectionRoundRobin, 4))
+}
+
+func TestSelectChannelKeyLeastUsed(t *testing.T) {
+	channel := setupChannelKeys(t, KeySelectionLeastUsed)
+	selected := selectKeys(t, channel, KeySelectionLeastUsed, 6)
+	assert.ElementsMatch(t, []string{"sk-first-key-0001", "sk-second-key-0002", "sk-third-key-0003"}, selected[:3])
+	assert.ElementsMatch(t, selected[:3], selected[3:])
+}
+
+func TestChannelKeyHealth(t *testing.T) {
+	channel := setupChannelKeys(t, KeySelectionRoundRobin)
+	keys, err := GetChannelKeys(channel.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-f...0001", keys[0].MaskedKey)
+
+	CooldownChannelKey(keys[0].Id, 60, "rate limited")
+	enabled, err := DisableChannelKey(channel.Id, keys[1].Id, "invalid api key")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, enabled)
+	assert.Equal(t, []string{"sk-third-key-0003", "sk-third-key-0003"}, selectKeys(t, channel, "", 2))
+
+	// every key cooling down, the one available first is used
+	CooldownChannelKey(keys[2].Id, 120, "rate limited")
+	assert.Equal(t, []string{"sk-first-key-0001"}, selectKeys(t, channel, "", 1))
+
+	require.NoError(t, UpdateChannelKeyStatus(channel.Id, keys[1].Id, ChannelStatusEnabled))
+	assert.Equal(t, []string{"sk-second-key-0002"}, selectKeys(t, channel, "", 1))
+
+	require.NoError(t, DeleteChannelKey(channel.Id, keys[0].Id))
+	require.NoError(t, DB.First(channel, channel.Id).Error)
+	assert.Equal(t, 2, channel.KeyCount)
+	assert.Equal(t, "sk-second-key-0002", channel.Key)
+}
+
+func TestChannelKeyUsage(t *testing.T) {
+	channel := setupChannelKeys(t, KeySelectionRoundRobin)
+	keys, err := GetChannelKeys(channel.Id)
+	require.NoError(t, err)
+	selectKeys(t, channel, "", 4)
+
+	// the usage is counted in memory and written by the flush
+	require.NoError(t, DB.First(keys[0], keys[0].Id).Error)
+	assert.Zero(t, keys[0].UsedCount)
+	flushChannelKeyUsage()
+	for i, used := range []int64{2, 1, 1} {
+		require.NoError(t, DB.First(keys[i], keys[i].Id).Error)
+		assert.Equal(t, used, keys[i].UsedCount)
+		assert.NotZero(t, keys[i].LastUsedTime)
+	}
+	flushChannelKeyUsage()
+	require.NoError(t, DB.First(keys[0], keys[0].Id).Error)
+	assert.EqualValues(t, 2, keys[0].UsedCount)
+
+	// a channel without enabled keys can't be used
+	for _, key := range keys {
+		_, err = DisableChannelKey(channel.Id, key.Id, "invalid api key")
+		require.NoError(t, err)
+	}
+	_, err = SelectChannelKey(channel.Id, "")
+	assert.Equal(t, ErrNoEnabledChannelKey, err)
+	disabled, err := GetAutoDisabledChannelKeys(channel.Id)
+	require.NoError(t, err)
+	assert.Len(t, disabled, 3)
+	assert.Equal(t, "sk-first-key-0001", disabled[0].Key)
+}
+
+func TestUpdateMultiKeyChannelKey(t *testing.T) {
+	channel := setupChannelKeys(t, KeySelectionRoundRobin)
+	require.NoError(t, DB.AutoMigrate(&Ability{}))
+
+	// the keys of a multi-key channel can't be replaced by the key of the channel
+	update := &Channel{Id: channel.Id, Key: "sk-other-key-0004"}
+	assert.ErrorIs(t, update.Update(), ErrMultiKeyChannelKey)
+
+	// the other fields are updated as usual
+	name := "multi"
+	update = &Channel{Id: channel.Id, Name: name}
+	require.NoError(t, update.Update())
+	assert.Equal(t, "sk-first-key-0001", update.Key)
+	assert.Equal(t, 3, update.KeyCount)
+}
+
+func TestAddChannelKeysRefreshesCache(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&Channel{}, &ChannelKey{}, &Ability{}))
+	DB = db
+	memoryCacheEnabled := config.MemoryCacheEnabled
+	config.MemoryCacheEnabled = true
+	t.Cleanup(func() {
+		config.MemoryCacheEnabled = memoryCacheEnabled
+		group2model2channels = nil
+		DB = nil
+	})
+	channel := &Channel{Key: "sk-first-key-0001", Group: "default", Models: "gpt-4o,gpt-4o-mini", Status: ChannelStatusEnabled}
+	require.NoError(t, DB.Create(channel).Error)
+	require.NoError(t, channel.AddAbilities())
+	InitChannelCache()
+
+	_, err = AddChannelKeys(channel, []string{"sk-second-key-0002"})
+	require.NoError(t, err)
+	for _, model := range []string{"gpt-4o", "gpt-4o-mini"} {
+		channels, err := CacheGetSatisfiedChannels("default", model)
+		require.NoError(t, err)
+		require.Len(t, channels, 1)
+		assert.Equal(t, 2, channels[0].KeyCount)
+	}
+
+	keys, err := GetChannelKeys(channel.Id)
+	require.NoError(t, err)
+	require.NoError(t, DeleteChannelKey(channel.Id, keys[1].Id))
+	cached, err := CacheGetRandomSatisfiedChannel("default", "gpt-4o", false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, cached.KeyCount)
+}
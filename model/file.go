@@ -0,0 +1,55 @@
+package model
+
+import (
+	"errors"
+)
+
+const (
+	FilePurposeBatch       = "batch"
+	FilePurposeBatchOutput = "batch_output"
+	FilePurposeFineTune    = "fine-tune"
+	FilePurposeAssistants  = "assistants"
+	FilePurposeVision      = "vision"
+	FilePurposeUserData    = "user_data"
+)
+
+// File is a user uploaded file, the content itself lives in common/storage under StorageKey
+type File struct {
+	Id         string `json:"id" gorm:"primaryKey;type:varchar(64)"`
+	UserId     int    `json:"user_id" gorm:"index"`
+	Bytes      int64  `json:"bytes" gorm:"bigint"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint"`
+	Filename   string `json:"filename"`
+	Purpose    string `json:"purpose" gorm:"type:varchar(32);index"`
+	StorageKey string `json:"-"`
+}
+
+func (file *File) Insert() error {
+	return DB.Create(file).Error
+}
+
+func (file *File) Delete() error {
+	return DB.Delete(file).Error
+}
+
+func GetFileByIds(id string, userId int) (*File, error) {
+	if id == "" || userId == 0 {
+		return nil, errors.New("id 或 userId 为空！")
+	}
+	var file File
+	err := DB.First(&file, "id = ? and user_id = ?", id, userId).Error
+	return &file, err
+}
+
+func GetUserFiles(userId int, purpose string, after string, limit int) ([]*File, error) {
+	var files []*File
+	query := DB.Where("user_id = ?", userId)
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	if after != "" {
+		query = query.Where("created_at < (?)", DB.Model(&File{}).Select("created_at").Where("id = ?", after))
+	}
+	err := query.Order("created_at desc").Limit(limit).Find(&files).Error
+	return files, err
+}
@@ -170,6 +170,27 @@ func migrateDB() error {
 	if err = DB.AutoMigrate(&ModelPricing{}); err != nil {
 		return err
 	}
+	if err = DB.AutoMigrate(&File{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Batch{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&StoredCompletion{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Preset{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&UserPreferences{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&ChannelKey{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Task{}); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -237,6 +258,8 @@ func closeDB(db *gorm.DB) error {
 }
 
 func CloseDB() error {
+	// the key usage counted in memory is written before the database goes away
+	flushChannelKeyUsage()
 	if LOG_DB != DB {
 		err := closeDB(LOG_DB)
 		if err != nil {
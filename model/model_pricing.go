@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/songquanpeng/one-api/common"
@@ -23,8 +25,12 @@ type ModelPricing struct {
 	IsActive      bool    `json:"is_active" gorm:"default:true;index:idx_active"`
 	CreatedAt     int64   `json:"created_at" gorm:"bigint"`
 	UpdatedAt     int64   `json:"updated_at" gorm:"bigint"`
+	// Source 为 sync 表示定价来自渠道模型同步，其余为管理员设置，同步不会覆盖管理员设置的定价
+	Source string `json:"source" gorm:"type:varchar(20);default:''"`
 }
 
+const ModelPricingSourceSync = "sync"
+
 func (ModelPricing) TableName() string {
 	return "model_pricing"
 }
@@ -34,6 +40,9 @@ var (
 	modelPricingCache     map[string]*ModelPricing
 	modelPricingCacheTime time.Time
 	modelPricingCacheTTL  = 5 * time.Minute
+	modelPricingCacheLock sync.RWMutex
+	// modelPricingRefreshing makes sure only one refresh runs in the background
+	modelPricingRefreshing atomic.Bool
 )
 
 // InitModelPricingCache 初始化模型定价缓存
@@ -49,21 +58,35 @@ func InitModelPricingCache() error {
 		cache[pricing.ModelName] = pricing
 	}
 
+	modelPricingCacheLock.Lock()
 	modelPricingCache = cache
 	modelPricingCacheTime = time.Now()
+	modelPricingCacheLock.Unlock()
 	logger.SysLog(fmt.Sprintf("loaded %d model pricings into cache", len(cache)))
 	return nil
 }
 
-// GetModelPricing 获取模型定价（带缓存）
-func GetModelPricing(modelName string) (*ModelPricing, error) {
-	// 检查缓存是否过期
-	if time.Since(modelPricingCacheTime) > modelPricingCacheTTL {
-		_ = InitModelPricingCache()
+// getCachedModelPricing 从缓存获取模型定价，缓存过期时在后台刷新，请求不等待数据库
+func getCachedModelPricing(modelName string) (*ModelPricing, bool) {
+	modelPricingCacheLock.RLock()
+	pricing, ok := modelPricingCache[modelName]
+	expired := time.Since(modelPricingCacheTime) > modelPricingCacheTTL
+	modelPricingCacheLock.RUnlock()
+	if expired && modelPricingRefreshing.CompareAndSwap(false, true) {
+		go func() {
+			defer modelPricingRefreshing.Store(false)
+			if err := InitModelPricingCache(); err != nil {
+				logger.SysError("failed to refresh model pricing cache: " + err.Error())
+			}
+		}()
 	}
+	return pricing, ok
+}
 
+// GetModelPricing 获取模型定价（带缓存）
+func GetModelPricing(modelName string) (*ModelPricing, error) {
 	// 从缓存获取
-	if pricing, ok := modelPricingCache[modelName]; ok {
+	if pricing, ok := getCachedModelPricing(modelName); ok {
 		return pricing, nil
 	}
 
@@ -75,10 +98,23 @@ func GetModelPricing(modelName string) (*ModelPricing, error) {
 	}
 
 	// 更新缓存
+	modelPricingCacheLock.Lock()
+	if modelPricingCache == nil {
+		modelPricingCache = make(map[string]*ModelPricing)
+	}
 	modelPricingCache[modelName] = &pricing
+	modelPricingCacheLock.Unlock()
 	return &pricing, nil
 }
 
+// GetModelContextLength 获取模型上下文长度，仅查询缓存，未配置时返回 0
+func GetModelContextLength(modelName string) int {
+	if pricing, ok := getCachedModelPricing(modelName); ok {
+		return pricing.ContextLength
+	}
+	return 0
+}
+
 // GetAllModelPricings 获取所有模型定价
 func GetAllModelPricings(provider string) ([]*ModelPricing, error) {
 	var pricings []*ModelPricing
@@ -116,10 +152,10 @@ func CreateOrUpdateModelPricing(ctx context.Context, pricing *ModelPricing) erro
 	err := DB.Where("model_name = ?", pricing.ModelName).First(&existing).Error
 
 	if err == nil {
-		// 已存在，更新
+		// 已存在，更新，管理员修改过的定价不再被同步覆盖
 		pricing.Id = existing.Id
 		pricing.CreatedAt = existing.CreatedAt
-		err = DB.Model(&ModelPricing{}).Where("id = ?", pricing.Id).Updates(pricing).Error
+		err = DB.Model(&ModelPricing{}).Where("id = ?", pricing.Id).Updates(pricing).Update("source", pricing.Source).Error
 	} else {
 		// 不存在，创建
 		pricing.CreatedAt = GetTimestamp()
@@ -136,6 +172,32 @@ func CreateOrUpdateModelPricing(ctx context.Context, pricing *ModelPricing) erro
 	return nil
 }
 
+// UpsertSyncedModelPricings 批量保存同步得到的模型定价，只刷新一次缓存，管理员设置的定价保持不变
+func UpsertSyncedModelPricings(pricings []*ModelPricing) error {
+	for _, pricing := range pricings {
+		pricing.UpdatedAt = GetTimestamp()
+		pricing.Source = ModelPricingSourceSync
+		var existing ModelPricing
+		err := DB.Where("model_name = ?", pricing.ModelName).First(&existing).Error
+		if err == nil {
+			if existing.Source != ModelPricingSourceSync {
+				continue
+			}
+			pricing.Id = existing.Id
+			pricing.CreatedAt = existing.CreatedAt
+			err = DB.Model(&ModelPricing{}).Where("id = ?", pricing.Id).Updates(pricing).Error
+		} else {
+			pricing.CreatedAt = pricing.UpdatedAt
+			pricing.IsActive = true
+			err = DB.Create(pricing).Error
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return InitModelPricingCache()
+}
+
 // GetTimestamp 获取当前时间戳
 func GetTimestamp() int64 {
 	if common.UsingSQLite {
@@ -4,6 +4,9 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/guardrail"
+	"github.com/songquanpeng/one-api/relay/mcp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -70,6 +73,10 @@ func InitOptionMap() {
 	config.OptionMap["ModelRatio"] = billingratio.ModelRatio2JSONString()
 	config.OptionMap["GroupRatio"] = billingratio.GroupRatio2JSONString()
 	config.OptionMap["CompletionRatio"] = billingratio.CompletionRatio2JSONString()
+	config.OptionMap["GuardrailPolicies"] = guardrail.Policies2JSONString()
+	config.OptionMap["GroupGuardrailPolicy"] = guardrail.GroupPolicy2JSONString()
+	config.OptionMap["MCPServers"] = mcp.Servers2JSONString()
+	config.OptionMap["GroupMCPServers"] = mcp.GroupServers2JSONString()
 	config.OptionMap["TopUpLink"] = config.TopUpLink
 	config.OptionMap["ChatLink"] = config.ChatLink
 	config.OptionMap["QuotaPerUnit"] = strconv.FormatFloat(config.QuotaPerUnit, 'f', -1, 64)
@@ -81,6 +88,10 @@ func InitOptionMap() {
 
 func loadOptionsFromDatabase() {
 	options, _ := AllOption()
+	// the group guardrail policy refers to the guardrail policies, which are loaded first
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].Key != "GroupGuardrailPolicy" && options[j].Key == "GroupGuardrailPolicy"
+	})
 	for _, option := range options {
 		if option.Key == "ModelRatio" {
 			option.Value = billingratio.AddNewMissingRatio(option.Value)
@@ -229,6 +240,14 @@ func updateOptionMap(key string, value string) (err error) {
 		err = billingratio.UpdateGroupRatioByJSONString(value)
 	case "CompletionRatio":
 		err = billingratio.UpdateCompletionRatioByJSONString(value)
+	case "GuardrailPolicies":
+		err = guardrail.UpdatePoliciesByJSONString(value)
+	case "GroupGuardrailPolicy":
+		err = guardrail.UpdateGroupPolicyByJSONString(value)
+	case "MCPServers":
+		err = mcp.UpdateServersByJSONString(value)
+	case "GroupMCPServers":
+		err = mcp.UpdateGroupServersByJSONString(value)
 	case "TopUpLink":
 		config.TopUpLink = value
 	case "ChatLink":
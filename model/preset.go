@@ -0,0 +1,203 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Preset is a named set of request defaults owned by a user, or shared with the users of a group when Group is set.
+// Every save adds a version, requests use the latest one unless they ask for name@version.
+type Preset struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	Group       string `json:"group" gorm:"type:varchar(32);index;default:''"`
+	Name        string `json:"name" gorm:"type:varchar(64);index"`
+	Version     int    `json:"version"`
+	Config      string `json:"config" gorm:"type:text"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+// PresetConfig is what a preset sets on a request, the fields given by the request itself take precedence
+type PresetConfig struct {
+	SystemPrompt   string   `json:"system_prompt,omitempty"`
+	Model          string   `json:"model,omitempty"`
+	Temperature    *float64 `json:"temperature,omitempty"`
+	TopP           *float64 `json:"top_p,omitempty"`
+	MaxTokens      int      `json:"max_tokens,omitempty"`
+	Tools          []any    `json:"tools,omitempty"`
+	ToolChoice     any      `json:"tool_choice,omitempty"`
+	ResponseFormat any      `json:"response_format,omitempty"`
+}
+
+func (preset *Preset) GetConfig() (*PresetConfig, error) {
+	var config PresetConfig
+	err := json.Unmarshal([]byte(preset.Config), &config)
+	return &config, err
+}
+
+// Ref is how the version of the preset is named in logs
+func (preset *Preset) Ref() string {
+	return fmt.Sprintf("%s@%d", preset.Name, preset.Version)
+}
+
+func presetScope(db *gorm.DB, userId int, group string) *gorm.DB {
+	if group == "" {
+		return db.Model(&Preset{}).Where("user_id = ?", userId)
+	}
+	groupCol := "`group`"
+	if common.UsingPostgreSQL {
+		groupCol = `"group"`
+	}
+	return db.Model(&Preset{}).Where("user_id = 0 and "+groupCol+" = ?", group)
+}
+
+// Insert saves the preset as the next version of its name
+func (preset *Preset) Insert() error {
+	if preset.Group != "" {
+		preset.UserId = 0
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var latest int
+		err := presetScope(tx, preset.UserId, preset.Group).Where("name = ?", preset.Name).
+			Select("COALESCE(MAX(version), 0)").Scan(&latest).Error
+		if err != nil {
+			return err
+		}
+		preset.Id = 0
+		preset.Version = latest + 1
+		preset.CreatedTime = helper.GetTimestamp()
+		return tx.Create(preset).Error
+	})
+}
+
+// GetPresets lists the latest version of every preset of a user, or of a group
+func GetPresets(userId int, group string) ([]*Preset, error) {
+	var versions []*Preset
+	err := presetScope(DB, userId, group).Order("name, version desc").Find(&versions).Error
+	if err != nil {
+		return nil, err
+	}
+	presets := make([]*Preset, 0, len(versions))
+	for _, preset := range versions {
+		if len(presets) == 0 || presets[len(presets)-1].Name != preset.Name {
+			presets = append(presets, preset)
+		}
+	}
+	return presets, nil
+}
+
+func GetPresetVersions(userId int, group string, name string) ([]*Preset, error) {
+	var presets []*Preset
+	err := presetScope(DB, userId, group).Where("name = ?", name).Order("version desc").Find(&presets).Error
+	return presets, err
+}
+
+func DeletePreset(userId int, group string, name string) (int64, error) {
+	result := presetScope(DB, userId, group).Where("name = ?", name).Delete(&Preset{})
+	return result.RowsAffected, result.Error
+}
+
+func getPreset(userId int, group string, name string, version int) (*Preset, error) {
+	var preset Preset
+	query := presetScope(DB, userId, group).Where("name = ?", name)
+	if version > 0 {
+		query = query.Where("version = ?", version)
+	}
+	err := query.Order("version desc").First(&preset).Error
+	return &preset, err
+}
+
+// ResolvePreset finds the preset of a user by name, falling back to the presets of the group of the user.
+// A version of 0 is the latest one.
+func ResolvePreset(userId int, group string, name string, version int) (*Preset, error) {
+	preset, err := getPreset(userId, "", name, version)
+	if err == nil {
+		return preset, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if group != "" {
+		preset, err = getPreset(0, group, name, version)
+		if err == nil {
+			return preset, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+	if version > 0 {
+		return nil, fmt.Errorf("预设 %s@%d 不存在", name, version)
+	}
+	return nil, fmt.Errorf("预设 %s 不存在", name)
+}
+
+// UserDefaults are the default model and parameters from the preferences of a user
+type UserDefaults struct {
+	DefaultModel      string `json:"default_model"`
+	DefaultParameters string `json:"default_parameters"`
+}
+
+func getUserDefaults(userId int) (*UserDefaults, error) {
+	var defaults UserDefaults
+	err := DB.Model(&UserPreferences{}).Select("default_model", "default_parameters").
+		Where("user_id = ?", userId).Limit(1).Scan(&defaults).Error
+	return &defaults, err
+}
+
+// userDefaultsCache keeps the defaults of the users in memory when redis is not enabled, they are read on every request
+var userDefaultsCache = cache.New(time.Duration(UserId2GroupCacheSeconds)*time.Second, time.Minute)
+
+func getUserDefaultsCacheKey(userId int) string {
+	return fmt.Sprintf("user_defaults:%d", userId)
+}
+
+// invalidateUserDefaults drops the cached defaults of the user once the preferences changed
+func invalidateUserDefaults(userId int) {
+	key := getUserDefaultsCacheKey(userId)
+	if common.RedisEnabled {
+		_ = common.RedisDel(key)
+		return
+	}
+	userDefaultsCache.Delete(key)
+}
+
+func CacheGetUserDefaults(userId int) (*UserDefaults, error) {
+	key := getUserDefaultsCacheKey(userId)
+	if !common.RedisEnabled {
+		if cached, ok := userDefaultsCache.Get(key); ok {
+			return cached.(*UserDefaults), nil
+		}
+		defaults, err := getUserDefaults(userId)
+		if err != nil {
+			return nil, err
+		}
+		userDefaultsCache.SetDefault(key, defaults)
+		return defaults, nil
+	}
+	if cached, err := common.RedisGet(key); err == nil {
+		var defaults UserDefaults
+		if err = json.Unmarshal([]byte(cached), &defaults); err == nil {
+			return &defaults, nil
+		}
+	}
+	defaults, err := getUserDefaults(userId)
+	if err != nil {
+		return nil, err
+	}
+	jsonBytes, _ := json.Marshal(defaults)
+	err = common.RedisSet(key, string(jsonBytes), time.Duration(UserId2GroupCacheSeconds)*time.Second)
+	if err != nil {
+		logger.SysError("Redis set user defaults error: " + err.Error())
+	}
+	return defaults, nil
+}
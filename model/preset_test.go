@@ -0,0 +1,38 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+func TestCacheGetUserDefaults(t *testing.T) {
+	common.RedisEnabled = false
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&UserPreferences{}))
+	DB = db
+	t.Cleanup(func() { DB = nil })
+
+	preferences := &UserPreferences{DefaultModel: "gpt-4o", DefaultParameters: `{"temperature": 0.5}`}
+	require.NoError(t, UpdateUserPreferences(7, preferences))
+	defaults, err := CacheGetUserDefaults(7)
+	require.NoError(t, err)
+	assert.Equal(t, &UserDefaults{DefaultModel: "gpt-4o", DefaultParameters: `{"temperature": 0.5}`}, defaults)
+
+	// the defaults are read from memory, until the preferences are updated
+	require.NoError(t, DB.Model(&UserPreferences{}).Where("user_id = ?", 7).Update("default_model", "gpt-4o-mini").Error)
+	defaults, err = CacheGetUserDefaults(7)
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o", defaults.DefaultModel)
+	preferences.DefaultModel = "o1"
+	require.NoError(t, UpdateUserPreferences(7, preferences))
+	defaults, err = CacheGetUserDefaults(7)
+	require.NoError(t, err)
+	assert.Equal(t, "o1", defaults.DefaultModel)
+}
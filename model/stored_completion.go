@@ -0,0 +1,86 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// StoredCompletion is a chat completion created with store=true, it has its own id since the ids of the upstreams
+// are not unique across channels
+type StoredCompletion struct {
+	Id         string `json:"id" gorm:"primaryKey;type:varchar(64)"`
+	UpstreamId string `json:"upstream_id" gorm:"type:varchar(128);index"`
+	UserId     int    `json:"user_id" gorm:"index"`
+	TokenId    int    `json:"token_id"`
+	Model      string `json:"model" gorm:"index"`
+	Request    string `json:"request" gorm:"type:text"`
+	Response   string `json:"response" gorm:"type:text"`
+	Metadata   string `json:"metadata" gorm:"type:text"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func (completion *StoredCompletion) Insert() error {
+	return DB.Create(completion).Error
+}
+
+func (completion *StoredCompletion) Delete() error {
+	return DB.Delete(completion).Error
+}
+
+func GetStoredCompletionByIds(id string, userId int) (*StoredCompletion, error) {
+	if id == "" || userId == 0 {
+		return nil, errors.New("id 或 userId 为空！")
+	}
+	var completion StoredCompletion
+	err := DB.First(&completion, "id = ? and user_id = ?", id, userId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// the clients only know the id returned by the upstream, the latest completion with it is the one they mean
+		err = DB.Order("created_at desc").First(&completion, "upstream_id = ? and user_id = ?", id, userId).Error
+	}
+	return &completion, err
+}
+
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// metadataCondition matches the stored metadata having the pair, the metadata is compact json so the pair
+// is either the whole object or starts, ends or sits between the other pairs
+func metadataCondition(key string, value string) (string, []any) {
+	keyJSON, _ := json.Marshal(key)
+	valueJSON, _ := json.Marshal(value)
+	pair := likeEscaper.Replace(string(keyJSON) + ":" + string(valueJSON))
+	return "metadata LIKE ? ESCAPE '!' or metadata LIKE ? ESCAPE '!' or metadata LIKE ? ESCAPE '!' or metadata LIKE ? ESCAPE '!'",
+		[]any{"{" + pair + "}", "{" + pair + ",%", "%," + pair + ",%", "%," + pair + "}"}
+}
+
+// GetUserStoredCompletions lists the stored completions of a user, metadata is matched against the pairs of the stored json
+func GetUserStoredCompletions(userId int, modelName string, metadata map[string]string, after string, order string, limit int) ([]*StoredCompletion, error) {
+	var completions []*StoredCompletion
+	query := DB.Omit("request").Where("user_id = ?", userId)
+	if modelName != "" {
+		query = query.Where("model = ?", modelName)
+	}
+	for key, value := range metadata {
+		condition, args := metadataCondition(key, value)
+		query = query.Where(condition, args...)
+	}
+	if order != "asc" {
+		order = "desc"
+	}
+	if after != "" {
+		operator := "<"
+		if order == "asc" {
+			operator = ">"
+		}
+		query = query.Where("created_at "+operator+" (?)", DB.Model(&StoredCompletion{}).Select("created_at").Where("id = ?", after))
+	}
+	err := query.Order("created_at " + order).Limit(limit).Find(&completions).Error
+	return completions, err
+}
+
+func DeleteStoredCompletionsBefore(timestamp int64) (int64, error) {
+	result := DB.Where("created_at < ?", timestamp).Delete(&StoredCompletion{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestGetUserStoredCompletions(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&StoredCompletion{}))
+	DB = db
+	t.Cleanup(func() { DB = nil })
+
+	for i, metadata := range []string{
+		`{"env":"prod"}`,
+		`{"env":"production","team":"a"}`,
+		`{"env":"p%d","team":"a_b"}`,
+		`{"stage":"prod","team":"ab"}`,
+		`{"note":"{\"env\":\"prod\"}"}`,
+	} {
+		completion := &StoredCompletion{Id: string(rune('a' + i)), UpstreamId: "chatcmpl-upstream", UserId: 1, Metadata: metadata, CreatedAt: int64(i + 1)}
+		require.NoError(t, completion.Insert())
+	}
+	ids := func(metadata map[string]string) []string {
+		completions, err := GetUserStoredCompletions(1, "", metadata, "", "asc", 10)
+		require.NoError(t, err)
+		var ids []string
+		for _, completion := range completions {
+			ids = append(ids, completion.Id)
+		}
+		return ids
+	}
+	// the values are matched whole, the wildcards of like are taken literally
+	assert.Equal(t, []string{"a"}, ids(map[string]string{"env": "prod"}))
+	assert.Equal(t, []string{"c"}, ids(map[string]string{"env": "p%d"}))
+	assert.Equal(t, []string{"c"}, ids(map[string]string{"team": "a_b"}))
+	assert.Equal(t, []string{"b"}, ids(map[string]string{"env": "production", "team": "a"}))
+	assert.Empty(t, ids(map[string]string{"env": "p%"}))
+	assert.Len(t, ids(nil), 5)
+
+	// the completions are found by their own id, or by the latest one with the id of the upstream
+	completion, err := GetStoredCompletionByIds("b", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "b", completion.Id)
+	completion, err = GetStoredCompletionByIds("chatcmpl-upstream", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "e", completion.Id)
+	_, err = GetStoredCompletionByIds("chatcmpl-upstream", 2)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"errors"
+)
+
+// Task is a submit-then-poll job run by an upstream, like a video generation.
+// The status is one of the task statuses of the relay, the task is finished once FinishedAt is set.
+type Task struct {
+	Id        string `json:"id" gorm:"primaryKey;type:varchar(64)"`
+	UserId    int    `json:"user_id" gorm:"index"`
+	TokenId   int    `json:"token_id"`
+	TokenName string `json:"token_name"`
+	ChannelId int    `json:"channel_id"`
+	// KeyId is the key of a multi-key channel the task was submitted with, it is polled with the same key
+	KeyId      int    `json:"key_id"`
+	Model      string `json:"model"`
+	UpstreamId string `json:"upstream_id" gorm:"type:varchar(255)"`
+	Status     string `json:"status" gorm:"type:varchar(32)"`
+	// Quota is reserved at submit for Duration seconds, it is settled on the duration generated or refunded when the
+	// task finishes
+	Quota    int64 `json:"quota" gorm:"bigint"`
+	Duration int   `json:"duration"`
+	// Outputs are the urls of the generated files, as a json array
+	Outputs     string `json:"outputs" gorm:"type:text"`
+	FailReason  string `json:"fail_reason" gorm:"type:text"`
+	CallbackURL string `json:"callback_url" gorm:"type:text"`
+	Request     string `json:"request" gorm:"type:text"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint"`
+	UpdatedAt   int64  `json:"updated_at" gorm:"bigint"`
+	FinishedAt  int64  `json:"finished_at" gorm:"bigint;index"`
+	// UpstreamModel is the model the task was submitted as, after the model mapping of the channel
+	UpstreamModel string `json:"upstream_model"`
+}
+
+func (task *Task) Insert() error {
+	return DB.Create(task).Error
+}
+
+func (task *Task) Update() error {
+	return DB.Save(task).Error
+}
+
+// Finish saves the final state of the task, it returns false when the task was already finished,
+// so that the quota is settled only once
+func (task *Task) Finish() (bool, error) {
+	result := DB.Model(&Task{}).Where("id = ? and finished_at = 0", task.Id).Updates(map[string]any{
+		"status":      task.Status,
+		"quota":       task.Quota,
+		"outputs":     task.Outputs,
+		"fail_reason": task.FailReason,
+		"updated_at":  task.UpdatedAt,
+		"finished_at": task.FinishedAt,
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+func GetTaskByIds(id string, userId int) (*Task, error) {
+	if id == "" || userId == 0 {
+		return nil, errors.New("id 或 userId 为空！")
+	}
+	var task Task
+	err := DB.First(&task, "id = ? and user_id = ?", id, userId).Error
+	return &task, err
+}
+
+func GetUnfinishedTasks() ([]*Task, error) {
+	var tasks []*Task
+	err := DB.Where("finished_at = 0").Order("created_at asc").Find(&tasks).Error
+	return tasks, err
+}
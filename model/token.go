@@ -34,6 +34,15 @@ type Token struct {
 	UsedQuota      int64   `json:"used_quota" gorm:"bigint;default:0"` // used quota
 	Models         *string `json:"models" gorm:"type:text"`            // allowed models
 	Subnet         *string `json:"subnet" gorm:"default:''"`           // allowed subnet
+	// StoreCompletions is the default of the store parameter for chat completions made with this token
+	StoreCompletions bool `json:"store_completions" gorm:"default:false"`
+	// ResponseCache serves identical requests from the response cache
+	ResponseCache bool `json:"response_cache" gorm:"default:false"`
+	// GuardrailPolicy is applied on top of the guardrail policy of the group
+	GuardrailPolicy string `json:"guardrail_policy" gorm:"default:''"`
+	// MCPServers are the comma separated names of the mcp servers whose tools are added to the requests,
+	// along with the ones of the group
+	MCPServers string `json:"mcp_servers" gorm:"default:''"`
 }
 
 func GetAllUserTokens(userId int, startIdx int, num int, order string) ([]*Token, error) {
@@ -132,7 +141,7 @@ func (t *Token) Insert() error {
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (t *Token) Update() error {
 	var err error
-	err = DB.Model(t).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet").Updates(t).Error
+	err = DB.Model(t).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet", "store_completions", "response_cache", "guardrail_policy", "mcp_servers").Updates(t).Error
 	return err
 }
 
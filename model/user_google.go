@@ -164,7 +164,7 @@ type UserPreferences struct {
 	EmailNotifications bool   `json:"email_notifications" gorm:"default:true"`
 	WebhookURL         string `json:"webhook_url"`
 	DefaultModel       string `json:"default_model"`
-	DefaultParameters  string `json:"default_parameters" gorm:"type:json"`
+	DefaultParameters  string `json:"default_parameters" gorm:"type:text"`
 	CreatedAt          int64  `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt          int64  `json:"updated_at" gorm:"autoUpdateTime"`
 }
@@ -200,6 +200,7 @@ func GetUserPreferences(userId int) (*UserPreferences, error) {
 // UpdateUserPreferences 更新用户偏好设置
 func UpdateUserPreferences(userId int, preferences *UserPreferences) error {
 	preferences.UserId = userId
+	defer invalidateUserDefaults(userId)
 	return DB.Save(preferences).Error
 }
 
@@ -75,3 +75,28 @@ func EnableChannel(channelId int, channelName string) {
 	)
 	notifyRootUser(subject, content)
 }
+
+// DisableChannelKey disables one key of a multi-key channel, the channel is disabled with its last key
+func DisableChannelKey(channelId int, channelName string, keyId int, reason string) {
+	enabled, err := model.DisableChannelKey(channelId, keyId, reason)
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to disable key #%d of channel #%d: %s", keyId, channelId, err.Error()))
+		return
+	}
+	if enabled == 0 {
+		DisableChannel(channelId, channelName, reason)
+		return
+	}
+	logger.SysLog(fmt.Sprintf("key #%d of channel #%d has been disabled, %d keys left: %s", keyId, channelId, enabled, reason))
+	subject := fmt.Sprintf("渠道密钥状态变更提醒")
+	content := message.EmailTemplate(
+		subject,
+		fmt.Sprintf(`
+			<p>您好！</p>
+			<p>渠道「<strong>%s</strong>」（#%d）的密钥 #%d 已被禁用，该渠道还有 %d 个可用密钥。</p>
+			<p>禁用原因：</p>
+			<p style="background-color: #f8f8f8; padding: 10px; border-radius: 4px;">%s</p>
+		`, channelName, channelId, keyId, enabled, reason),
+	)
+	notifyRootUser(subject, content)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/alibailian"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/relaymode"
@@ -29,6 +30,10 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 		fullRequestURL = fmt.Sprintf("%s/api/v1/services/embeddings/text-embedding/text-embedding", meta.BaseURL)
 	case relaymode.ImagesGenerations:
 		fullRequestURL = fmt.Sprintf("%s/api/v1/services/aigc/text2image/image-synthesis", meta.BaseURL)
+	case relaymode.ImagesEdits:
+		fullRequestURL = fmt.Sprintf("%s/api/v1/services/aigc/image2image/image-synthesis", meta.BaseURL)
+	case relaymode.Rerank:
+		fullRequestURL = fmt.Sprintf("%s/api/v1/services/rerank/text-rerank/text-rerank", meta.BaseURL)
 	default:
 		fullRequestURL = fmt.Sprintf("%s/api/v1/services/aigc/text-generation/generation", meta.BaseURL)
 	}
@@ -44,9 +49,13 @@ func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *me
 	}
 	req.Header.Set("Authorization", "Bearer "+meta.APIKey)
 
-	if meta.Mode == relaymode.ImagesGenerations {
+	if meta.Mode == relaymode.ImagesGenerations || meta.Mode == relaymode.ImagesEdits {
 		req.Header.Set("X-DashScope-Async", "enable")
 	}
+	if meta.Mode == relaymode.ImagesEdits {
+		// the client sent multipart, the converted request is json
+		req.Header.Set("Content-Type", "application/json")
+	}
 	if a.meta.Config.Plugin != "" {
 		req.Header.Set("X-DashScope-Plugin", a.meta.Config.Plugin)
 	}
@@ -71,11 +80,25 @@ func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error)
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
+	switch a.meta.Mode {
+	case relaymode.ImagesEdits:
+		return ConvertImageEditRequest(*request)
+	case relaymode.ImagesVariations:
+		return nil, fmt.Errorf("image variations are %w by ali", adaptor.ErrUnsupportedRequest)
+	}
 
 	aliRequest := ConvertImageRequest(*request)
 	return aliRequest, nil
 }
 
+func (a *Adaptor) ConvertRerankRequest(meta *meta.Meta, request *model.RerankRequest) (any, error) {
+	return alibailian.ConvertRerankRequest(*request), nil
+}
+
+func (a *Adaptor) ConvertRerankResponse(meta *meta.Meta, responseBody []byte) (*model.RerankResponse, error) {
+	return alibailian.ConvertRerankResponse(responseBody)
+}
+
 func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Reader) (*http.Response, error) {
 	return adaptor.DoRequestHelper(a, c, meta, requestBody)
 }
@@ -87,7 +110,7 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 		switch meta.Mode {
 		case relaymode.Embeddings:
 			err, usage = EmbeddingHandler(c, resp)
-		case relaymode.ImagesGenerations:
+		case relaymode.ImagesGenerations, relaymode.ImagesEdits:
 			err, usage = ImageHandler(c, resp)
 		default:
 			err, usage = Handler(c, resp)
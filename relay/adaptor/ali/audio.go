@@ -0,0 +1,211 @@
+package ali
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://help.aliyun.com/zh/model-studio/cosyvoice-websocket-api
+// https://help.aliyun.com/zh/model-studio/websocket-for-paraformer-real-time-service
+
+const audioChunkSize = 32 * 1024
+
+var speechContentTypes = map[string]string{
+	"mp3":  "audio/mpeg",
+	"wav":  "audio/wav",
+	"pcm":  "audio/pcm",
+	"opus": "audio/opus",
+}
+
+// openAIVoices are read by cosyvoice as its default voice
+var openAIVoices = map[string]bool{
+	"alloy": true, "ash": true, "ballad": true, "coral": true, "echo": true, "fable": true,
+	"onyx": true, "nova": true, "sage": true, "shimmer": true, "verse": true,
+}
+
+// dashScopeTask runs a duplex task on the websocket api of dashscope
+type dashScopeTask struct {
+	conn   *websocket.Conn
+	taskId string
+}
+
+func startDashScopeTask(meta *meta.Meta, payload Payload) (*dashScopeTask, *model.ErrorWithStatusCode) {
+	wsURL := strings.Replace(meta.BaseURL, "http", "ws", 1) + "/api-ws/v1/inference"
+	dialer := websocket.Dialer{HandshakeTimeout: 10 * time.Second}
+	conn, resp, err := dialer.Dial(wsURL, http.Header{"Authorization": {"bearer " + meta.APIKey}})
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+		return nil, openai.ErrorWrapper(err, "dashscope_connect_failed", statusCode)
+	}
+	task := &dashScopeTask{conn: conn, taskId: random.GetUUID()}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Minute))
+	err = task.send("run-task", payload)
+	if err == nil {
+		_, err = task.waitEvent("task-started", nil)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, openai.ErrorWrapper(err, "dashscope_run_task_failed", http.StatusInternalServerError)
+	}
+	return task, nil
+}
+
+func (t *dashScopeTask) send(action string, payload Payload) error {
+	return t.conn.WriteJSON(WSSMessage{
+		Header:  Header{Action: action, TaskID: t.taskId, Streaming: "duplex"},
+		Payload: payload,
+	})
+}
+
+// waitEvent reads the messages until the event, the binary messages and the other events are given to onMessage
+func (t *dashScopeTask) waitEvent(event string, onMessage func(message *WSSMessage, data []byte)) (*WSSMessage, error) {
+	for {
+		messageType, data, err := t.conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		if messageType == websocket.BinaryMessage {
+			if onMessage != nil {
+				onMessage(nil, data)
+			}
+			continue
+		}
+		var message WSSMessage
+		if err = json.Unmarshal(data, &message); err != nil {
+			return nil, err
+		}
+		switch message.Header.Event {
+		case event:
+			return &message, nil
+		case "task-failed":
+			return nil, fmt.Errorf("%s: %s", message.Header.ErrorCode, message.Header.ErrorMessage)
+		}
+		if onMessage != nil {
+			onMessage(&message, nil)
+		}
+	}
+}
+
+func (a *Adaptor) CreateSpeech(meta *meta.Meta, request *model.SpeechRequest) (*model.SpeechResult, *model.ErrorWithStatusCode) {
+	format := request.ResponseFormat
+	if format == "" {
+		format = "mp3"
+	}
+	contentType, ok := speechContentTypes[format]
+	if !ok {
+		return nil, openai.ErrorWrapper(fmt.Errorf("response_format %s is not supported by cosyvoice", format), "invalid_response_format", http.StatusBadRequest)
+	}
+	voice := request.Voice
+	if openAIVoices[voice] {
+		voice = "longxiaochun"
+		if meta.ActualModelName == "cosyvoice-v2" {
+			voice = "longxiaochun_v2"
+		}
+	}
+	payload := Payload{Model: meta.ActualModelName, TaskGroup: "audio", Task: "tts", Function: "SpeechSynthesizer"}
+	payload.Parameters.TextType = "PlainText"
+	payload.Parameters.Voice = voice
+	payload.Parameters.Format = format
+	payload.Parameters.SampleRate = 22050
+	payload.Parameters.Rate = request.Speed
+	task, bizErr := startDashScopeTask(meta, payload)
+	if bizErr != nil {
+		return nil, bizErr
+	}
+	defer task.conn.Close()
+
+	input := Payload{}
+	input.Input.Text = request.Input
+	err := task.send("continue-task", input)
+	if err == nil {
+		err = task.send("finish-task", Payload{})
+	}
+	var audio []byte
+	if err == nil {
+		_, err = task.waitEvent("task-finished", func(_ *WSSMessage, data []byte) {
+			audio = append(audio, data...)
+		})
+	}
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "cosyvoice_failed", http.StatusInternalServerError)
+	}
+	return &model.SpeechResult{Audio: audio, ContentType: contentType}, nil
+}
+
+func (a *Adaptor) CreateTranscription(meta *meta.Meta, request *model.TranscriptionRequest) (*model.TranscriptionResult, *model.ErrorWithStatusCode) {
+	if request.Translate {
+		return nil, openai.ErrorWrapper(errors.New("paraformer does not translate"), "translation_not_supported", http.StatusBadRequest)
+	}
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(request.Filename)), ".")
+	if format == "" {
+		format = "wav"
+	}
+	payload := Payload{Model: meta.ActualModelName, TaskGroup: "audio", Task: "asr", Function: "recognition"}
+	payload.Parameters.Format = format
+	payload.Parameters.SampleRate = 16000
+	if strings.Contains(meta.ActualModelName, "-8k-") {
+		payload.Parameters.SampleRate = 8000
+	}
+	if request.Language != "" {
+		payload.Parameters.LanguageHints = []string{request.Language}
+	}
+	task, bizErr := startDashScopeTask(meta, payload)
+	if bizErr != nil {
+		return nil, bizErr
+	}
+	defer task.conn.Close()
+
+	var err error
+	for start := 0; start < len(request.Audio) && err == nil; start += audioChunkSize {
+		end := start + audioChunkSize
+		if end > len(request.Audio) {
+			end = len(request.Audio)
+		}
+		err = task.conn.WriteMessage(websocket.BinaryMessage, request.Audio[start:end])
+	}
+	if err == nil {
+		err = task.send("finish-task", Payload{})
+	}
+	result := &model.TranscriptionResult{Language: request.Language}
+	var texts []string
+	if err == nil {
+		_, err = task.waitEvent("task-finished", func(message *WSSMessage, _ []byte) {
+			if message == nil || message.Payload.Output == nil || message.Payload.Output.Sentence == nil {
+				return
+			}
+			sentence := message.Payload.Output.Sentence
+			if !sentence.SentenceEnd {
+				return
+			}
+			texts = append(texts, sentence.Text)
+			result.Segments = append(result.Segments, model.TranscriptionSegment{
+				Start: float64(sentence.BeginTime) / 1000,
+				End:   float64(sentence.EndTime) / 1000,
+				Text:  sentence.Text,
+			})
+			result.Duration = float64(sentence.EndTime) / 1000
+			if message.Payload.Usage != nil && float64(message.Payload.Usage.Duration) > result.Duration {
+				result.Duration = float64(message.Payload.Usage.Duration)
+			}
+		})
+	}
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "paraformer_failed", http.StatusInternalServerError)
+	}
+	result.Text = strings.Join(texts, "")
+	return result, nil
+}
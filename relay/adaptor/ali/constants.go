@@ -21,7 +21,10 @@ var ModelList = []string{
 	"qwen2.5-math-72b-instruct", "qwen2.5-math-7b-instruct", "qwen2.5-math-1.5b-instruct", "qwen2-math-72b-instruct", "qwen2-math-7b-instruct", "qwen2-math-1.5b-instruct",
 	"qwen2.5-coder-32b-instruct", "qwen2.5-coder-14b-instruct", "qwen2.5-coder-7b-instruct", "qwen2.5-coder-3b-instruct", "qwen2.5-coder-1.5b-instruct", "qwen2.5-coder-0.5b-instruct",
 	"text-embedding-v1", "text-embedding-v3", "text-embedding-v2", "text-embedding-async-v2", "text-embedding-async-v1",
-	"ali-stable-diffusion-xl", "ali-stable-diffusion-v1.5", "wanx-v1",
+	"ali-stable-diffusion-xl", "ali-stable-diffusion-v1.5", "wanx-v1", "wanx2.1-imageedit",
+	"wanx2.1-t2v-turbo", "wanx2.1-t2v-plus", "wanx2.1-i2v-turbo", "wanx2.1-i2v-plus",
+	"cosyvoice-v1", "cosyvoice-v2", "paraformer-realtime-v2", "paraformer-realtime-8k-v2",
+	"gte-rerank",
 	"qwen-mt-plus", "qwen-mt-turbo",
 	"deepseek-r1", "deepseek-v3", "deepseek-r1-distill-qwen-1.5b", "deepseek-r1-distill-qwen-7b", "deepseek-r1-distill-qwen-14b", "deepseek-r1-distill-qwen-32b", "deepseek-r1-distill-llama-8b", "deepseek-r1-distill-llama-70b",
 }
@@ -12,6 +12,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/image"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/model"
@@ -37,6 +38,10 @@ func ConvertRequest(request model.GeneralOpenAIRequest) *ChatRequest {
 		aliModel = strings.TrimSuffix(aliModel, EnableSearchModelSuffix)
 	}
 	request.TopP = helper.Float64PtrMax(request.TopP, 0.9999)
+	var responseFormat *model.ResponseFormat
+	if request.ResponseFormat != nil && request.ResponseFormat.Type == "json_object" {
+		responseFormat = &model.ResponseFormat{Type: "json_object"}
+	}
 	return &ChatRequest{
 		Model: aliModel,
 		Input: Input{
@@ -52,6 +57,7 @@ func ConvertRequest(request model.GeneralOpenAIRequest) *ChatRequest {
 			TopK:              request.TopK,
 			ResultFormat:      "message",
 			Tools:             request.Tools,
+			ResponseFormat:    responseFormat,
 		},
 	}
 }
@@ -78,6 +84,28 @@ func ConvertImageRequest(request model.ImageRequest) *ImageRequest {
 	return &imageRequest
 }
 
+func ConvertImageEditRequest(request model.ImageRequest) (*ImageEditRequest, error) {
+	var imageRequest ImageEditRequest
+	baseImage, err := image.GetImageDataURLFromFileHeader(request.Image)
+	if err != nil {
+		return nil, err
+	}
+	imageRequest.Model = request.Model
+	imageRequest.Input.Function = "description_edit"
+	imageRequest.Input.Prompt = request.Prompt
+	imageRequest.Input.BaseImageUrl = baseImage
+	if request.Mask != nil {
+		maskImage, err := image.GetImageDataURLFromFileHeader(request.Mask)
+		if err != nil {
+			return nil, err
+		}
+		imageRequest.Input.Function = "description_edit_with_mask"
+		imageRequest.Input.MaskImageUrl = maskImage
+	}
+	imageRequest.Parameters.N = request.N
+	return &imageRequest, nil
+}
+
 func EmbeddingHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
 	var aliResponse EmbeddingResponse
 	err := json.NewDecoder(resp.Body).Decode(&aliResponse)
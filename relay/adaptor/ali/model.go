@@ -25,6 +25,8 @@ type Parameters struct {
 	Temperature       *float64     `json:"temperature,omitempty"`
 	ResultFormat      string       `json:"result_format,omitempty"`
 	Tools             []model.Tool `json:"tools,omitempty"`
+	// ResponseFormat only supports json_object
+	ResponseFormat *model.ResponseFormat `json:"response_format,omitempty"`
 }
 
 type ChatRequest struct {
@@ -48,6 +50,22 @@ type ImageRequest struct {
 	ResponseFormat string `json:"response_format,omitempty"`
 }
 
+// ImageEditRequest is the wanx image2image request
+//
+// https://help.aliyun.com/zh/model-studio/developer-reference/wanx-image-edit-api-reference
+type ImageEditRequest struct {
+	Model string `json:"model"`
+	Input struct {
+		Function     string `json:"function"`
+		Prompt       string `json:"prompt"`
+		BaseImageUrl string `json:"base_image_url"`
+		MaskImageUrl string `json:"mask_image_url,omitempty"`
+	} `json:"input"`
+	Parameters struct {
+		N int `json:"n,omitempty"`
+	} `json:"parameters,omitempty"`
+}
+
 type TaskResponse struct {
 	StatusCode int    `json:"status_code,omitempty"`
 	RequestId  string `json:"request_id,omitempty"`
@@ -58,6 +76,7 @@ type TaskResponse struct {
 		TaskStatus string `json:"task_status,omitempty"`
 		Code       string `json:"code,omitempty"`
 		Message    string `json:"message,omitempty"`
+		VideoUrl   string `json:"video_url,omitempty"`
 		Results    []struct {
 			B64Image string `json:"b64_image,omitempty"`
 			Url      string `json:"url,omitempty"`
@@ -89,18 +108,34 @@ type Payload struct {
 	TaskGroup  string `json:"task_group,omitempty"`
 	Function   string `json:"function,omitempty"`
 	Parameters struct {
-		SampleRate int     `json:"sample_rate,omitempty"`
-		Rate       float64 `json:"rate,omitempty"`
-		Format     string  `json:"format,omitempty"`
+		SampleRate    int      `json:"sample_rate,omitempty"`
+		Rate          float64  `json:"rate,omitempty"`
+		Format        string   `json:"format,omitempty"`
+		TextType      string   `json:"text_type,omitempty"`
+		Voice         string   `json:"voice,omitempty"`
+		LanguageHints []string `json:"language_hints,omitempty"`
 	} `json:"parameters,omitempty"`
 	Input struct {
 		Text string `json:"text,omitempty"`
-	} `json:"input,omitempty"`
-	Usage struct {
+	} `json:"input"`
+	Output *struct {
+		Sentence *Sentence `json:"sentence,omitempty"`
+	} `json:"output,omitempty"`
+	Usage *struct {
 		Characters int `json:"characters,omitempty"`
+		// Duration is in seconds
+		Duration int `json:"duration,omitempty"`
 	} `json:"usage,omitempty"`
 }
 
+// Sentence is recognized by paraformer, the times are in milliseconds
+type Sentence struct {
+	BeginTime   int64  `json:"begin_time"`
+	EndTime     int64  `json:"end_time"`
+	Text        string `json:"text"`
+	SentenceEnd bool   `json:"sentence_end"`
+}
+
 type WSSMessage struct {
 	Header  Header  `json:"header,omitempty"`
 	Payload Payload `json:"payload,omitempty"`
@@ -139,6 +174,8 @@ type Usage struct {
 	InputTokens  int `json:"input_tokens"`
 	OutputTokens int `json:"output_tokens"`
 	TotalTokens  int `json:"total_tokens"`
+	// VideoDuration is the seconds of video generated by a video task
+	VideoDuration float64 `json:"video_duration,omitempty"`
 }
 
 type Output struct {
@@ -152,3 +189,21 @@ type ChatResponse struct {
 	Usage  Usage  `json:"usage"`
 	Error
 }
+
+type VideoInput struct {
+	Prompt         string `json:"prompt"`
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+	ImgUrl         string `json:"img_url,omitempty"`
+}
+
+type VideoParameters struct {
+	Size     string `json:"size,omitempty"`
+	Duration int    `json:"duration,omitempty"`
+	Seed     *int   `json:"seed,omitempty"`
+}
+
+type VideoRequest struct {
+	Model      string          `json:"model"`
+	Input      VideoInput      `json:"input"`
+	Parameters VideoParameters `json:"parameters,omitempty"`
+}
@@ -0,0 +1,78 @@
+package ali
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://help.aliyun.com/zh/model-studio/developer-reference/video-generation-wanx
+
+func (a *Adaptor) SubmitTask(meta *meta.Meta, request *model.VideoRequest) (string, *model.ErrorWithStatusCode) {
+	aliRequest := VideoRequest{
+		Model: meta.ActualModelName,
+		Input: VideoInput{
+			Prompt:         request.Prompt,
+			NegativePrompt: request.NegativePrompt,
+			ImgUrl:         request.Image,
+		},
+		Parameters: VideoParameters{
+			// dashscope writes the sizes as 1280*720
+			Size:     strings.Replace(request.Size, "x", "*", 1),
+			Duration: request.Duration,
+			Seed:     request.Seed,
+		},
+	}
+	var aliResponse TaskResponse
+	err := adaptor.DoJSONRequest(http.MethodPost,
+		fmt.Sprintf("%s/api/v1/services/aigc/video-generation/video-synthesis", meta.BaseURL),
+		map[string]string{
+			"Authorization":     "Bearer " + meta.APIKey,
+			"X-DashScope-Async": "enable",
+		}, aliRequest, &aliResponse)
+	if err != nil {
+		return "", adaptor.UpstreamErrorWrapper(err, "ali_submit_task_failed")
+	}
+	if aliResponse.Output.TaskId == "" {
+		return "", adaptor.UpstreamErrorWrapper(fmt.Errorf("no task id: %s", aliResponse.Message), "ali_submit_task_failed")
+	}
+	return aliResponse.Output.TaskId, nil
+}
+
+func (a *Adaptor) FetchTask(meta *meta.Meta, upstreamId string) (*model.TaskResult, error) {
+	var aliResponse TaskResponse
+	err := adaptor.DoJSONRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/tasks/%s", meta.BaseURL, upstreamId),
+		map[string]string{"Authorization": "Bearer " + meta.APIKey}, nil, &aliResponse)
+	if err != nil {
+		return nil, err
+	}
+	result := &model.TaskResult{}
+	switch aliResponse.Output.TaskStatus {
+	case "PENDING":
+		result.Status = model.TaskStatusQueued
+	case "RUNNING":
+		result.Status = model.TaskStatusInProgress
+	case "SUCCEEDED":
+		result.Status = model.TaskStatusSucceeded
+		if aliResponse.Output.VideoUrl == "" {
+			return nil, errors.New("no video url in the finished task")
+		}
+		result.Outputs = []string{aliResponse.Output.VideoUrl}
+		result.Duration = aliResponse.Usage.VideoDuration
+	case "FAILED", "CANCELED", "UNKNOWN":
+		// UNKNOWN means the task expired at the upstream
+		result.Status = model.TaskStatusFailed
+		result.Error = aliResponse.Output.Message
+		if result.Error == "" {
+			result.Error = "task " + strings.ToLower(aliResponse.Output.TaskStatus)
+		}
+	default:
+		return nil, fmt.Errorf("unknown task status %q", aliResponse.Output.TaskStatus)
+	}
+	return result, nil
+}
@@ -13,6 +13,8 @@ func GetRequestURL(meta *meta.Meta) (string, error) {
 		return fmt.Sprintf("%s/compatible-mode/v1/chat/completions", meta.BaseURL), nil
 	case relaymode.Embeddings:
 		return fmt.Sprintf("%s/compatible-mode/v1/embeddings", meta.BaseURL), nil
+	case relaymode.Rerank:
+		return fmt.Sprintf("%s/api/v1/services/rerank/text-rerank/text-rerank", meta.BaseURL), nil
 	default:
 	}
 	return "", fmt.Errorf("unsupported relay mode %d for ali bailian", meta.Mode)
@@ -0,0 +1,64 @@
+package alibailian
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://help.aliyun.com/zh/model-studio/developer-reference/text-rerank-api
+
+type RerankRequest struct {
+	Model string `json:"model"`
+	Input struct {
+		Query     string   `json:"query"`
+		Documents []string `json:"documents"`
+	} `json:"input"`
+	Parameters struct {
+		ReturnDocuments bool `json:"return_documents,omitempty"`
+		TopN            int  `json:"top_n,omitempty"`
+	} `json:"parameters"`
+}
+
+type RerankResponse struct {
+	Output struct {
+		Results []model.RerankResult `json:"results"`
+	} `json:"output"`
+	Usage struct {
+		TotalTokens int `json:"total_tokens"`
+	} `json:"usage"`
+	RequestId string `json:"request_id"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+}
+
+// ConvertRerankRequest converts the request to the dashscope rerank api, which is shared by ali & ali bailian
+func ConvertRerankRequest(request model.RerankRequest) *RerankRequest {
+	rerankRequest := RerankRequest{
+		Model: request.Model,
+	}
+	rerankRequest.Input.Query = request.Query
+	rerankRequest.Input.Documents = request.GetDocuments()
+	rerankRequest.Parameters.ReturnDocuments = request.IsReturnDocuments()
+	rerankRequest.Parameters.TopN = request.TopN
+	return &rerankRequest
+}
+
+func ConvertRerankResponse(responseBody []byte) (*model.RerankResponse, error) {
+	var rerankResponse RerankResponse
+	if err := json.Unmarshal(responseBody, &rerankResponse); err != nil {
+		return nil, err
+	}
+	if rerankResponse.Code != "" {
+		return nil, errors.New(rerankResponse.Message)
+	}
+	return &model.RerankResponse{
+		Id:      rerankResponse.RequestId,
+		Results: rerankResponse.Output.Results,
+		Usage: model.RerankUsage{
+			PromptTokens: rerankResponse.Usage.TotalTokens,
+			TotalTokens:  rerankResponse.Usage.TotalTokens,
+		},
+	}, nil
+}
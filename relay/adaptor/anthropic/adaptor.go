@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -32,22 +33,39 @@ func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *me
 		anthropicVersion = "2023-06-01"
 	}
 	req.Header.Set("anthropic-version", anthropicVersion)
-	req.Header.Set("anthropic-beta", "messages-2023-12-15")
 
+	// the beta features are chosen by the channel, those asked for by the clients may not be allowed on the account
+	betas := GetBetas(meta.Config.AnthropicBeta)
 	// https://x.com/alexalbert__/status/1812921642143900036
 	// claude-3-5-sonnet can support 8k context
 	if strings.HasPrefix(meta.ActualModelName, "claude-3-5-sonnet") {
-		req.Header.Set("anthropic-beta", "max-tokens-3-5-sonnet-2024-07-15")
+		betas = GetBetas(betas, "max-tokens-3-5-sonnet-2024-07-15")
 	}
+	if len(betas) == 0 {
+		betas = append(betas, "messages-2023-12-15")
+	}
+	req.Header.Set("anthropic-beta", strings.Join(betas, ","))
 
 	return nil
 }
 
+// GetBetas merges the beta features of the channel with the given ones, without duplicates
+func GetBetas(configured []string, more ...string) []string {
+	var betas []string
+	for _, beta := range append(slices.Clone(configured), more...) {
+		beta = strings.TrimSpace(beta)
+		if beta != "" && !slices.Contains(betas, beta) {
+			betas = append(betas, beta)
+		}
+	}
+	return betas
+}
+
 func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.GeneralOpenAIRequest) (any, error) {
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
-	return ConvertRequest(*request), nil
+	return ConvertRequest(*request)
 }
 
 func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
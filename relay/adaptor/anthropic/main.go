@@ -11,9 +11,10 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/helper"
-	"github.com/songquanpeng/one-api/common/image"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/media"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/model"
 )
@@ -36,7 +37,51 @@ func stopReasonClaude2OpenAI(reason *string) string {
 	}
 }
 
-func ConvertRequest(textRequest model.GeneralOpenAIRequest) *Request {
+// convertToolChoice maps the tool_choice of openai, the claude ones are passed as they are
+func convertToolChoice(textRequest *model.GeneralOpenAIRequest) *ToolChoice {
+	// default value https://docs.anthropic.com/en/docs/build-with-claude/tool-use#controlling-claudes-output
+	toolChoice := &ToolChoice{Type: "auto"}
+	switch choice := textRequest.ToolChoice.(type) {
+	case string:
+		switch choice {
+		case "none", "any":
+			toolChoice.Type = choice
+		case "required":
+			toolChoice.Type = "any"
+		}
+	case map[string]any:
+		if function, ok := choice["function"].(map[string]any); ok {
+			toolChoice.Type = "tool"
+			toolChoice.Name, _ = function["name"].(string)
+		} else if choiceType, ok := choice["type"].(string); ok && choiceType != "function" {
+			toolChoice.Type = choiceType
+			toolChoice.Name, _ = choice["name"].(string)
+			toolChoice.DisableParallelToolUse, _ = choice["disable_parallel_tool_use"].(bool)
+		}
+	}
+	if textRequest.ParallelTooCalls != nil && !*textRequest.ParallelTooCalls && toolChoice.Type != "none" {
+		toolChoice.DisableParallelToolUse = true
+	}
+	return toolChoice
+}
+
+// convertSystem keeps every text part of the system messages as its own block, so that they can be cached
+func convertSystem(message model.Message) []Content {
+	var system []Content
+	for _, part := range message.ParseContent() {
+		if part.Type != model.ContentTypeText || part.Text == "" {
+			continue
+		}
+		system = append(system, Content{
+			Type:         "text",
+			Text:         part.Text,
+			CacheControl: part.CacheControl,
+		})
+	}
+	return system
+}
+
+func ConvertRequest(textRequest model.GeneralOpenAIRequest) (*Request, error) {
 	claudeTools := make([]Tool, 0, len(textRequest.Tools))
 
 	for _, tool := range textRequest.Tools {
@@ -49,6 +94,7 @@ func ConvertRequest(textRequest model.GeneralOpenAIRequest) *Request {
 					Properties: params["properties"],
 					Required:   params["required"],
 				},
+				CacheControl: tool.CacheControl,
 			})
 		}
 	}
@@ -63,25 +109,12 @@ func ConvertRequest(textRequest model.GeneralOpenAIRequest) *Request {
 		Tools:       claudeTools,
 	}
 	if len(claudeTools) > 0 {
-		claudeToolChoice := struct {
-			Type string `json:"type"`
-			Name string `json:"name,omitempty"`
-		}{Type: "auto"} // default value https://docs.anthropic.com/en/docs/build-with-claude/tool-use#controlling-claudes-output
-		if choice, ok := textRequest.ToolChoice.(map[string]any); ok {
-			if function, ok := choice["function"].(map[string]any); ok {
-				claudeToolChoice.Type = "tool"
-				claudeToolChoice.Name = function["name"].(string)
-			}
-		} else if toolChoiceType, ok := textRequest.ToolChoice.(string); ok {
-			if toolChoiceType == "any" {
-				claudeToolChoice.Type = toolChoiceType
-			}
-		}
-		claudeRequest.ToolChoice = claudeToolChoice
+		claudeRequest.ToolChoice = convertToolChoice(&textRequest)
 	}
 	if claudeRequest.MaxTokens == 0 {
 		claudeRequest.MaxTokens = 4096
 	}
+	setThinking(&claudeRequest, &textRequest)
 	// legacy model name mapping
 	if claudeRequest.Model == "claude-instant-1" {
 		claudeRequest.Model = "claude-instant-1.1"
@@ -89,39 +122,55 @@ func ConvertRequest(textRequest model.GeneralOpenAIRequest) *Request {
 		claudeRequest.Model = "claude-2.1"
 	}
 	for _, message := range textRequest.Messages {
-		if message.Role == "system" && claudeRequest.System == "" {
-			claudeRequest.System = message.StringContent()
+		if message.Role == "system" {
+			claudeRequest.System = append(claudeRequest.System, convertSystem(message)...)
 			continue
 		}
 		claudeMessage := Message{
 			Role: message.Role,
 		}
-		var content Content
-		if message.IsStringContent() {
-			content.Type = "text"
-			content.Text = message.StringContent()
-			if message.Role == "tool" {
-				claudeMessage.Role = "user"
-				content.Type = "tool_result"
-				content.Content = content.Text
-				content.Text = ""
-				content.ToolUseId = message.ToolCallId
+		if message.Role == "tool" {
+			content := Content{
+				Type:      "tool_result",
+				Content:   message.StringContent(),
+				ToolUseId: message.ToolCallId,
+			}
+			if parts := message.ParseContent(); len(parts) > 0 {
+				content.CacheControl = parts[len(parts)-1].CacheControl
 			}
+			claudeMessage.Role = "user"
 			claudeMessage.Content = append(claudeMessage.Content, content)
+			claudeRequest.Messages = append(claudeRequest.Messages, claudeMessage)
+			continue
+		}
+		// thinking blocks have to be passed back unmodified, which is only possible with their signature
+		if reasoning, ok := message.ReasoningContent.(string); ok && message.ReasoningSignature != "" {
+			claudeMessage.Content = append(claudeMessage.Content, Content{
+				Type:      "thinking",
+				Thinking:  reasoning,
+				Signature: message.ReasoningSignature,
+			})
+		}
+		if message.IsStringContent() {
+			claudeMessage.Content = append(claudeMessage.Content, Content{
+				Type: "text",
+				Text: message.StringContent(),
+			})
 			for i := range message.ToolCalls {
 				inputParam := make(map[string]any)
 				_ = json.Unmarshal([]byte(message.ToolCalls[i].Function.Arguments.(string)), &inputParam)
 				claudeMessage.Content = append(claudeMessage.Content, Content{
-					Type:  "tool_use",
-					Id:    message.ToolCalls[i].Id,
-					Name:  message.ToolCalls[i].Function.Name,
-					Input: inputParam,
+					Type:         "tool_use",
+					Id:           message.ToolCalls[i].Id,
+					Name:         message.ToolCalls[i].Function.Name,
+					Input:        inputParam,
+					CacheControl: message.ToolCalls[i].CacheControl,
 				})
 			}
 			claudeRequest.Messages = append(claudeRequest.Messages, claudeMessage)
 			continue
 		}
-		var contents []Content
+		contents := claudeMessage.Content
 		openaiContent := message.ParseContent()
 		for _, part := range openaiContent {
 			var content Content
@@ -129,26 +178,116 @@ func ConvertRequest(textRequest model.GeneralOpenAIRequest) *Request {
 				content.Type = "text"
 				content.Text = part.Text
 			} else if part.Type == model.ContentTypeImageURL {
+				image, err := media.Fetch(part.ImageURL.Url)
+				if err != nil {
+					return nil, err
+				}
 				content.Type = "image"
 				content.Source = &ImageSource{
-					Type: "base64",
+					Type:      "base64",
+					MediaType: image.MimeType,
+					Data:      image.Base64(),
+				}
+			} else if part.Type == model.ContentTypeFile {
+				document, err := media.Fetch(part.File.URL())
+				if err != nil {
+					return nil, err
 				}
-				mimeType, data, _ := image.GetImageFromUrl(part.ImageURL.Url)
-				content.Source.MediaType = mimeType
-				content.Source.Data = data
+				content.Type = "document"
+				content.Title = part.File.Filename
+				if document.IsText() {
+					content.Source = &ImageSource{Type: "text", MediaType: "text/plain", Data: string(document.Data)}
+				} else {
+					content.Source = &ImageSource{Type: "base64", MediaType: document.MimeType, Data: document.Base64()}
+				}
+			} else {
+				continue
 			}
+			content.CacheControl = part.CacheControl
 			contents = append(contents, content)
 		}
 		claudeMessage.Content = contents
 		claudeRequest.Messages = append(claudeRequest.Messages, claudeMessage)
 	}
-	return &claudeRequest
+	return &claudeRequest, nil
+}
+
+// setThinking enables extended thinking when the request asks for reasoning
+func setThinking(claudeRequest *Request, textRequest *model.GeneralOpenAIRequest) {
+	budget, ok := textRequest.GetReasoningBudget(claudeRequest.MaxTokens)
+	if !ok || budget <= 0 {
+		return
+	}
+	if budget < minThinkingBudget {
+		budget = minThinkingBudget
+	}
+	// the budget counts into max_tokens, leave room for the answer
+	if budget >= claudeRequest.MaxTokens {
+		claudeRequest.MaxTokens = budget + 4096
+	}
+	claudeRequest.Thinking = &Thinking{
+		Type:         "enabled",
+		BudgetTokens: budget,
+	}
+	// thinking is not compatible with sampling parameters or forced tool use
+	claudeRequest.Temperature = nil
+	claudeRequest.TopP = nil
+	claudeRequest.TopK = 0
+	if claudeRequest.ToolChoice != nil && (claudeRequest.ToolChoice.Type == "any" || claudeRequest.ToolChoice.Type == "tool") {
+		claudeRequest.ToolChoice.Type = "auto"
+		claudeRequest.ToolChoice.Name = ""
+	}
+}
+
+// ConvertUsage counts the tokens read from and written into the cache as prompt tokens,
+// claude reports them apart from the input tokens
+func ConvertUsage(claudeUsage Usage) model.Usage {
+	usage := model.Usage{
+		PromptTokens:     claudeUsage.InputTokens + claudeUsage.CacheReadInputTokens + claudeUsage.CacheCreationInputTokens,
+		CompletionTokens: claudeUsage.OutputTokens,
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	if claudeUsage.CacheReadInputTokens > 0 || claudeUsage.CacheCreationInputTokens > 0 {
+		usage.PromptTokensDetails = &model.PromptTokensDetails{
+			CachedTokens:        claudeUsage.CacheReadInputTokens,
+			CacheCreationTokens: claudeUsage.CacheCreationInputTokens,
+		}
+	}
+	return usage
+}
+
+// MergeUsage updates the usage with the one of a stream event, the counts of the events are cumulative
+func MergeUsage(usage *Usage, event Usage) {
+	if event.InputTokens > 0 {
+		usage.InputTokens = event.InputTokens
+	}
+	if event.OutputTokens > 0 {
+		usage.OutputTokens = event.OutputTokens
+	}
+	if event.CacheCreationInputTokens > 0 {
+		usage.CacheCreationInputTokens = event.CacheCreationInputTokens
+	}
+	if event.CacheReadInputTokens > 0 {
+		usage.CacheReadInputTokens = event.CacheReadInputTokens
+	}
+}
+
+// SetReasoningTokens estimates the reasoning tokens, claude only reports them as part of the output tokens
+func SetReasoningTokens(usage *model.Usage, reasoningText string, modelName string) {
+	if reasoningText == "" {
+		return
+	}
+	usage.CompletionTokensDetails = &model.CompletionTokensDetails{
+		ReasoningTokens: openai.CountTokenText(reasoningText, modelName),
+	}
 }
 
 // https://docs.anthropic.com/claude/reference/messages-streaming
 func StreamResponseClaude2OpenAI(claudeResponse *StreamResponse) (*openai.ChatCompletionsStreamResponse, *Response) {
 	var response *Response
 	var responseText string
+	var reasoningText string
+	var signature string
 	var stopReason string
 	tools := make([]model.Tool, 0)
 
@@ -172,6 +311,8 @@ func StreamResponseClaude2OpenAI(claudeResponse *StreamResponse) (*openai.ChatCo
 	case "content_block_delta":
 		if claudeResponse.Delta != nil {
 			responseText = claudeResponse.Delta.Text
+			reasoningText = claudeResponse.Delta.Thinking
+			signature = claudeResponse.Delta.Signature
 			if claudeResponse.Delta.Type == "input_json_delta" {
 				tools = append(tools, model.Tool{
 					Function: model.Function{
@@ -192,6 +333,10 @@ func StreamResponseClaude2OpenAI(claudeResponse *StreamResponse) (*openai.ChatCo
 	}
 	var choice openai.ChatCompletionsStreamResponseChoice
 	choice.Delta.Content = responseText
+	if reasoningText != "" {
+		choice.Delta.ReasoningContent = reasoningText
+	}
+	choice.Delta.ReasoningSignature = signature
 	if len(tools) > 0 {
 		choice.Delta.Content = nil // compatible with other OpenAI derivative applications, like LobeOpenAICompatibleFactory ...
 		choice.Delta.ToolCalls = tools
@@ -209,12 +354,17 @@ func StreamResponseClaude2OpenAI(claudeResponse *StreamResponse) (*openai.ChatCo
 
 func ResponseClaude2OpenAI(claudeResponse *Response) *openai.TextResponse {
 	var responseText string
-	if len(claudeResponse.Content) > 0 {
-		responseText = claudeResponse.Content[0].Text
-	}
+	var reasoningText string
+	var signature string
 	tools := make([]model.Tool, 0)
 	for _, v := range claudeResponse.Content {
-		if v.Type == "tool_use" {
+		switch v.Type {
+		case "text":
+			responseText += v.Text
+		case "thinking":
+			reasoningText += v.Thinking
+			signature = v.Signature
+		case "tool_use":
 			args, _ := json.Marshal(v.Input)
 			tools = append(tools, model.Tool{
 				Id:   v.Id,
@@ -229,13 +379,17 @@ func ResponseClaude2OpenAI(claudeResponse *Response) *openai.TextResponse {
 	choice := openai.TextResponseChoice{
 		Index: 0,
 		Message: model.Message{
-			Role:      "assistant",
-			Content:   responseText,
-			Name:      nil,
-			ToolCalls: tools,
+			Role:               "assistant",
+			Content:            responseText,
+			Name:               nil,
+			ToolCalls:          tools,
+			ReasoningSignature: signature,
 		},
 		FinishReason: stopReasonClaude2OpenAI(claudeResponse.StopReason),
 	}
+	if reasoningText != "" {
+		choice.Message.ReasoningContent = reasoningText
+	}
 	fullTextResponse := openai.TextResponse{
 		Id:      fmt.Sprintf("chatcmpl-%s", claudeResponse.Id),
 		Model:   claudeResponse.Model,
@@ -264,10 +418,12 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 
 	common.SetEventStreamHeaders(c)
 
-	var usage model.Usage
+	var claudeUsage Usage
 	var modelName string
 	var id string
+	var reasoningText string
 	var lastToolCallChoice openai.ChatCompletionsStreamResponseChoice
+	excludeReasoning := c.GetBool(ctxkey.ExcludeReasoning)
 
 	for scanner.Scan() {
 		data := scanner.Text()
@@ -286,8 +442,7 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 
 		response, meta := StreamResponseClaude2OpenAI(&claudeResponse)
 		if meta != nil {
-			usage.PromptTokens += meta.Usage.InputTokens
-			usage.CompletionTokens += meta.Usage.OutputTokens
+			MergeUsage(&claudeUsage, meta.Usage)
 			if len(meta.Id) > 0 { // only message_start has an id, otherwise it's a finish_reason event.
 				modelName = meta.Model
 				id = fmt.Sprintf("chatcmpl-%s", meta.Id)
@@ -315,7 +470,10 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 			if len(choice.Delta.ToolCalls) > 0 {
 				lastToolCallChoice = choice
 			}
+			reasoning, _ := choice.Delta.ReasoningContent.(string)
+			reasoningText += reasoning
 		}
+		response.NormalizeReasoning(excludeReasoning)
 		err = render.ObjectData(c, response)
 		if err != nil {
 			logger.SysError(err.Error())
@@ -332,6 +490,8 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 	if err != nil {
 		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
 	}
+	usage := ConvertUsage(claudeUsage)
+	SetReasoningTokens(&usage, reasoningText, modelName)
 	return nil, &usage
 }
 
@@ -362,11 +522,10 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 	}
 	fullTextResponse := ResponseClaude2OpenAI(&claudeResponse)
 	fullTextResponse.Model = modelName
-	usage := model.Usage{
-		PromptTokens:     claudeResponse.Usage.InputTokens,
-		CompletionTokens: claudeResponse.Usage.OutputTokens,
-		TotalTokens:      claudeResponse.Usage.InputTokens + claudeResponse.Usage.OutputTokens,
-	}
+	usage := ConvertUsage(claudeResponse.Usage)
+	reasoningText, _ := fullTextResponse.Choices[0].ReasoningContent.(string)
+	SetReasoningTokens(&usage, reasoningText, modelName)
+	fullTextResponse.NormalizeReasoning(c.GetBool(ctxkey.ExcludeReasoning))
 	fullTextResponse.Usage = usage
 	jsonResponse, err := json.Marshal(fullTextResponse)
 	if err != nil {
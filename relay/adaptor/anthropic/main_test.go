@@ -0,0 +1,167 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func parseRequest(t *testing.T, body string) model.GeneralOpenAIRequest {
+	var request model.GeneralOpenAIRequest
+	require.NoError(t, json.Unmarshal([]byte(body), &request))
+	return request
+}
+
+func convertRequest(t *testing.T, request model.GeneralOpenAIRequest) *Request {
+	claudeRequest, err := ConvertRequest(request)
+	require.NoError(t, err)
+	return claudeRequest
+}
+
+func TestConvertRequestKeepsCacheControl(t *testing.T) {
+	request := parseRequest(t, `{
+		"model": "claude-3-7-sonnet-20250219",
+		"messages": [
+			{"role": "system", "content": [
+				{"type": "text", "text": "You are a librarian."},
+				{"type": "text", "text": "The catalogue: ...", "cache_control": {"type": "ephemeral", "ttl": "1h"}}
+			]},
+			{"role": "system", "content": "Answer briefly."},
+			{"role": "user", "content": [{"type": "text", "text": "Which books?", "cache_control": {"type": "ephemeral"}}]},
+			{"role": "assistant", "content": "", "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "search", "arguments": "{\"q\":\"go\"}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": [{"type": "text", "text": "3 books", "cache_control": {"type": "ephemeral"}}]}
+		],
+		"tools": [{"type": "function", "function": {"name": "search", "parameters": {"type": "object", "properties": {}}}, "cache_control": {"type": "ephemeral"}}]
+	}`)
+	claudeRequest := convertRequest(t, request)
+
+	require.Len(t, claudeRequest.System, 3)
+	assert.Nil(t, claudeRequest.System[0].CacheControl)
+	assert.Equal(t, &model.CacheControl{Type: "ephemeral", TTL: "1h"}, claudeRequest.System[1].CacheControl)
+	assert.Equal(t, "Answer briefly.", claudeRequest.System[2].Text)
+
+	require.Len(t, claudeRequest.Messages, 3)
+	assert.Equal(t, "ephemeral", claudeRequest.Messages[0].Content[0].CacheControl.Type)
+	toolResult := claudeRequest.Messages[2]
+	assert.Equal(t, "user", toolResult.Role)
+	assert.Equal(t, "tool_result", toolResult.Content[0].Type)
+	assert.Equal(t, "3 books", toolResult.Content[0].Content)
+	assert.Equal(t, "call_1", toolResult.Content[0].ToolUseId)
+	assert.NotNil(t, toolResult.Content[0].CacheControl)
+
+	require.Len(t, claudeRequest.Tools, 1)
+	assert.Equal(t, "ephemeral", claudeRequest.Tools[0].CacheControl.Type)
+
+	body, err := json.Marshal(claudeRequest)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"system":[{"type":"text","text":"You are a librarian."}`)
+	assert.Contains(t, string(body), `"cache_control":{"type":"ephemeral","ttl":"1h"}`)
+}
+
+func TestConvertRequestMediaError(t *testing.T) {
+	for _, part := range []string{
+		`{"type": "image_url", "image_url": {"url": "ftp://example.com/cat.png"}}`,
+		`{"type": "file", "file": {"file_data": "data:application/pdf;base64,%%%"}}`,
+	} {
+		request := parseRequest(t, `{"model": "claude-3-5-haiku-20241022", "messages": [{"role": "user", "content": [`+part+`]}]}`)
+		_, err := ConvertRequest(request)
+		assert.Error(t, err, part)
+	}
+}
+
+func TestConvertToolChoice(t *testing.T) {
+	tools := `"tools": [{"type": "function", "function": {"name": "search", "parameters": {"type": "object"}}}]`
+	cases := []struct {
+		choice   string
+		expected ToolChoice
+	}{
+		{`"tool_choice": "auto"`, ToolChoice{Type: "auto"}},
+		{`"tool_choice": "none"`, ToolChoice{Type: "none"}},
+		{`"tool_choice": "required"`, ToolChoice{Type: "any"}},
+		{`"tool_choice": {"type": "function", "function": {"name": "search"}}`, ToolChoice{Type: "tool", Name: "search"}},
+		{`"tool_choice": {"type": "tool", "name": "search", "disable_parallel_tool_use": true}`, ToolChoice{Type: "tool", Name: "search", DisableParallelToolUse: true}},
+		{`"tool_choice": "auto", "parallel_tool_calls": false`, ToolChoice{Type: "auto", DisableParallelToolUse: true}},
+	}
+	for _, c := range cases {
+		request := parseRequest(t, `{"model": "claude-3-5-haiku-20241022", "messages": [{"role": "user", "content": "hi"}], `+tools+`, `+c.choice+`}`)
+		claudeRequest := convertRequest(t, request)
+		require.NotNil(t, claudeRequest.ToolChoice, c.choice)
+		assert.Equal(t, c.expected, *claudeRequest.ToolChoice, c.choice)
+	}
+
+	request := parseRequest(t, `{"model": "claude-3-7-sonnet-20250219", "reasoning_effort": "high", "messages": [{"role": "user", "content": "hi"}], `+tools+`, "tool_choice": "required"}`)
+	claudeRequest := convertRequest(t, request)
+	require.NotNil(t, claudeRequest.Thinking)
+	assert.Equal(t, "auto", claudeRequest.ToolChoice.Type)
+}
+
+func TestConvertUsage(t *testing.T) {
+	usage := ConvertUsage(Usage{InputTokens: 20, OutputTokens: 10, CacheCreationInputTokens: 1000, CacheReadInputTokens: 3000})
+	assert.Equal(t, 4020, usage.PromptTokens)
+	assert.Equal(t, 4030, usage.TotalTokens)
+	assert.Equal(t, &model.PromptTokensDetails{CachedTokens: 3000, CacheCreationTokens: 1000}, usage.PromptTokensDetails)
+
+	assert.Nil(t, ConvertUsage(Usage{InputTokens: 20, OutputTokens: 10}).PromptTokensDetails)
+}
+
+func TestStreamHandlerUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude-3-7-sonnet-20250219","usage":{"input_tokens":12,"output_tokens":1,"cache_creation_input_tokens":0,"cache_read_input_tokens":2048}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":15}}`,
+		`{"type":"message_stop"}`,
+	}
+	var body strings.Builder
+	for _, event := range events {
+		body.WriteString("data: " + event + "\n\n")
+	}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body.String()))}
+
+	errWithStatus, usage := StreamHandler(c, resp)
+	require.Nil(t, errWithStatus)
+	assert.Equal(t, 2060, usage.PromptTokens)
+	assert.Equal(t, 15, usage.CompletionTokens)
+	assert.Equal(t, 2048, usage.PromptTokensDetails.CachedTokens)
+	assert.Contains(t, w.Body.String(), `"content":"Hello"`)
+}
+
+func TestSetupRequestHeaderBetas(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	c.Request.Header.Set("anthropic-beta", "token-efficient-tools-2025-02-19, extended-cache-ttl-2025-04-11")
+	req := httptest.NewRequest(http.MethodPost, "https://api.anthropic.com/v1/messages", nil)
+	relayMeta := &meta.Meta{
+		ActualModelName: "claude-3-7-sonnet-20250219",
+		Config:          dbmodel.ChannelConfig{AnthropicBeta: []string{"extended-cache-ttl-2025-04-11", " output-128k-2025-02-19", "extended-cache-ttl-2025-04-11"}},
+	}
+	adaptor := &Adaptor{}
+	require.NoError(t, adaptor.SetupRequestHeader(c, req, relayMeta))
+	// the betas of the client are not forwarded
+	assert.Equal(t, "extended-cache-ttl-2025-04-11,output-128k-2025-02-19", req.Header.Get("anthropic-beta"))
+
+	c.Request.Header.Del("anthropic-beta")
+	relayMeta.Config = dbmodel.ChannelConfig{}
+	require.NoError(t, adaptor.SetupRequestHeader(c, req, relayMeta))
+	assert.Equal(t, "messages-2023-12-15", req.Header.Get("anthropic-beta"))
+
+	relayMeta.ActualModelName = "claude-3-5-sonnet-20240620"
+	require.NoError(t, adaptor.SetupRequestHeader(c, req, relayMeta))
+	assert.Equal(t, "max-tokens-3-5-sonnet-2024-07-15", req.Header.Get("anthropic-beta"))
+}
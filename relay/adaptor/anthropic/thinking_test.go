@@ -0,0 +1,72 @@
+package anthropic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestConvertRequestThinking(t *testing.T) {
+	effort := "medium"
+	temperature := 0.7
+	claudeRequest := convertRequest(t, model.GeneralOpenAIRequest{
+		Model:           "claude-3-7-sonnet-latest",
+		MaxTokens:       10000,
+		Temperature:     &temperature,
+		ReasoningEffort: &effort,
+		Messages:        []model.Message{{Role: "user", Content: "hi"}},
+	})
+	require.NotNil(t, claudeRequest.Thinking)
+	assert.Equal(t, "enabled", claudeRequest.Thinking.Type)
+	assert.Equal(t, 5000, claudeRequest.Thinking.BudgetTokens)
+	assert.Equal(t, 10000, claudeRequest.MaxTokens)
+	// sampling parameters are not allowed with thinking
+	assert.Nil(t, claudeRequest.Temperature)
+
+	// the budget is raised to the minimum and max_tokens leaves room for the answer
+	budget := 100
+	claudeRequest = convertRequest(t, model.GeneralOpenAIRequest{
+		Model:     "claude-3-7-sonnet-latest",
+		MaxTokens: 500,
+		Reasoning: &model.Reasoning{MaxTokens: &budget},
+		Messages:  []model.Message{{Role: "user", Content: "hi"}},
+	})
+	require.NotNil(t, claudeRequest.Thinking)
+	assert.Equal(t, minThinkingBudget, claudeRequest.Thinking.BudgetTokens)
+	assert.Equal(t, minThinkingBudget+4096, claudeRequest.MaxTokens)
+
+	claudeRequest = convertRequest(t, model.GeneralOpenAIRequest{
+		Model:    "claude-3-7-sonnet-latest",
+		Messages: []model.Message{{Role: "user", Content: "hi"}},
+	})
+	assert.Nil(t, claudeRequest.Thinking)
+}
+
+func TestResponseClaude2OpenAIThinking(t *testing.T) {
+	response := ResponseClaude2OpenAI(&Response{
+		Id:    "msg_1",
+		Model: "claude-3-7-sonnet-latest",
+		Content: []Content{
+			{Type: "thinking", Thinking: "2+2 is 4", Signature: "sig"},
+			{Type: "text", Text: "4"},
+		},
+	})
+	require.Len(t, response.Choices, 1)
+	message := response.Choices[0].Message
+	assert.Equal(t, "4", message.Content)
+	assert.Equal(t, "2+2 is 4", message.ReasoningContent)
+	assert.Equal(t, "sig", message.ReasoningSignature)
+
+	// the thinking block is sent back with its signature
+	claudeRequest := convertRequest(t, model.GeneralOpenAIRequest{
+		Model:    "claude-3-7-sonnet-latest",
+		Messages: []model.Message{{Role: "user", Content: "2+2?"}, message, {Role: "user", Content: "and 3+3?"}},
+	})
+	require.Len(t, claudeRequest.Messages, 3)
+	require.Len(t, claudeRequest.Messages[1].Content, 2)
+	assert.Equal(t, "thinking", claudeRequest.Messages[1].Content[0].Type)
+	assert.Equal(t, "sig", claudeRequest.Messages[1].Content[0].Signature)
+}
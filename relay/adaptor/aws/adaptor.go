@@ -10,6 +10,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/aws/converse"
 	"github.com/songquanpeng/one-api/relay/adaptor/aws/utils"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
@@ -57,6 +58,7 @@ func (a *Adaptor) GetModelList() (models []string) {
 	for model := range adaptors {
 		models = append(models, model)
 	}
+	models = append(models, converse.ModelList...)
 	return
 }
 
@@ -21,6 +21,7 @@ import (
 	"github.com/songquanpeng/one-api/relay/adaptor/anthropic"
 	"github.com/songquanpeng/one-api/relay/adaptor/aws/utils"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
 )
 
@@ -36,6 +37,8 @@ var AwsModelIDMap = map[string]string{
 	"claude-3-5-sonnet-20241022": "anthropic.claude-3-5-sonnet-20241022-v2:0",
 	"claude-3-5-sonnet-latest":   "anthropic.claude-3-5-sonnet-20241022-v2:0",
 	"claude-3-5-haiku-20241022":  "anthropic.claude-3-5-haiku-20241022-v1:0",
+	"claude-3-7-sonnet-20250219": "anthropic.claude-3-7-sonnet-20250219-v1:0",
+	"claude-3-7-sonnet-latest":   "anthropic.claude-3-7-sonnet-20250219-v1:0",
 }
 
 func awsModelID(requestModel string) (string, error) {
@@ -69,6 +72,8 @@ func Handler(c *gin.Context, awsCli *bedrockruntime.Client, modelName string) (*
 	if err = copier.Copy(awsClaudeReq, claudeReq); err != nil {
 		return utils.WrapErr(errors.Wrap(err, "copy request")), nil
 	}
+	// the beta headers are not forwarded to claude by bedrock
+	awsClaudeReq.AnthropicBeta = meta.GetByContext(c).Config.AnthropicBeta
 
 	awsReq.Body, err = json.Marshal(awsClaudeReq)
 	if err != nil {
@@ -88,11 +93,10 @@ func Handler(c *gin.Context, awsCli *bedrockruntime.Client, modelName string) (*
 
 	openaiResp := anthropic.ResponseClaude2OpenAI(claudeResponse)
 	openaiResp.Model = modelName
-	usage := relaymodel.Usage{
-		PromptTokens:     claudeResponse.Usage.InputTokens,
-		CompletionTokens: claudeResponse.Usage.OutputTokens,
-		TotalTokens:      claudeResponse.Usage.InputTokens + claudeResponse.Usage.OutputTokens,
-	}
+	usage := anthropic.ConvertUsage(claudeResponse.Usage)
+	reasoningText, _ := openaiResp.Choices[0].ReasoningContent.(string)
+	anthropic.SetReasoningTokens(&usage, reasoningText, modelName)
+	openaiResp.NormalizeReasoning(c.GetBool(ctxkey.ExcludeReasoning))
 	openaiResp.Usage = usage
 
 	c.JSON(http.StatusOK, openaiResp)
@@ -124,6 +128,8 @@ func StreamHandler(c *gin.Context, awsCli *bedrockruntime.Client) (*relaymodel.E
 	if err = copier.Copy(awsClaudeReq, claudeReq); err != nil {
 		return utils.WrapErr(errors.Wrap(err, "copy request")), nil
 	}
+	// the beta headers are not forwarded to claude by bedrock
+	awsClaudeReq.AnthropicBeta = meta.GetByContext(c).Config.AnthropicBeta
 	awsReq.Body, err = json.Marshal(awsClaudeReq)
 	if err != nil {
 		return utils.WrapErr(errors.Wrap(err, "marshal request")), nil
@@ -137,9 +143,11 @@ func StreamHandler(c *gin.Context, awsCli *bedrockruntime.Client) (*relaymodel.E
 	defer stream.Close()
 
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
-	var usage relaymodel.Usage
+	var claudeUsage anthropic.Usage
 	var id string
+	var reasoningText string
 	var lastToolCallChoice openai.ChatCompletionsStreamResponseChoice
+	excludeReasoning := c.GetBool(ctxkey.ExcludeReasoning)
 
 	c.Stream(func(w io.Writer) bool {
 		event, ok := <-stream.Events()
@@ -159,8 +167,7 @@ func StreamHandler(c *gin.Context, awsCli *bedrockruntime.Client) (*relaymodel.E
 
 			response, meta := anthropic.StreamResponseClaude2OpenAI(claudeResp)
 			if meta != nil {
-				usage.PromptTokens += meta.Usage.InputTokens
-				usage.CompletionTokens += meta.Usage.OutputTokens
+				anthropic.MergeUsage(&claudeUsage, meta.Usage)
 				if len(meta.Id) > 0 { // only message_start has an id, otherwise it's a finish_reason event.
 					id = fmt.Sprintf("chatcmpl-%s", meta.Id)
 					return true
@@ -186,7 +193,10 @@ func StreamHandler(c *gin.Context, awsCli *bedrockruntime.Client) (*relaymodel.E
 				if len(choice.Delta.ToolCalls) > 0 {
 					lastToolCallChoice = choice
 				}
+				reasoning, _ := choice.Delta.ReasoningContent.(string)
+				reasoningText += reasoning
 			}
+			response.NormalizeReasoning(excludeReasoning)
 			jsonStr, err := json.Marshal(response)
 			if err != nil {
 				logger.SysError("error marshalling stream response: " + err.Error())
@@ -203,5 +213,7 @@ func StreamHandler(c *gin.Context, awsCli *bedrockruntime.Client) (*relaymodel.E
 		}
 	})
 
+	usage := anthropic.ConvertUsage(claudeUsage)
+	anthropic.SetReasoningTokens(&usage, reasoningText, c.GetString(ctxkey.OriginalModel))
 	return nil, &usage
 }
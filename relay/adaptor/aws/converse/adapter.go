@@ -0,0 +1,67 @@
+package converse
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/aws/utils"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+var _ utils.AwsAdapter = new(Adaptor)
+var _ utils.AwsAdapter = new(EmbeddingAdaptor)
+
+// Adaptor sends the requests itself, converse is newer than the bedrock client of the sdk
+type Adaptor struct {
+	request *Request
+}
+
+func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.GeneralOpenAIRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	converseRequest, err := ConvertRequest(*request)
+	if err != nil {
+		return nil, err
+	}
+	a.request = converseRequest
+	return converseRequest, nil
+}
+
+func (a *Adaptor) DoResponse(c *gin.Context, _ *bedrockruntime.Client, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if meta.IsStream {
+		err, usage = StreamHandler(c, meta, a.request)
+	} else {
+		err, usage = Handler(c, meta, a.request)
+	}
+	return
+}
+
+const (
+	EmbeddingTitan = iota
+	EmbeddingCohere
+)
+
+type EmbeddingAdaptor struct {
+	Family  int
+	request *model.GeneralOpenAIRequest
+}
+
+func (a *EmbeddingAdaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.GeneralOpenAIRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	a.request = request
+	return request, nil
+}
+
+func (a *EmbeddingAdaptor) DoResponse(c *gin.Context, _ *bedrockruntime.Client, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if a.Family == EmbeddingCohere {
+		err, usage = CohereEmbeddingHandler(c, meta, a.request)
+	} else {
+		err, usage = TitanEmbeddingHandler(c, meta, a.request)
+	}
+	return
+}
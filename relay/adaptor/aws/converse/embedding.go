@@ -0,0 +1,79 @@
+package converse
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/aws/utils"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// invoke posts a native request of the model and decodes its response
+func invoke(c *gin.Context, meta *meta.Meta, request any, response any) *model.ErrorWithStatusCode {
+	resp, err := utils.SendRequest(c, meta, meta.ActualModelName, "invoke", request)
+	if err != nil {
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return utils.RelayError(resp)
+	}
+	defer resp.Body.Close()
+	if err = json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+	return nil
+}
+
+func embeddingResponse(meta *meta.Meta, embeddings [][]float64, promptTokens int) *openai.EmbeddingResponse {
+	response := openai.EmbeddingResponse{
+		Object: "list",
+		Model:  meta.ActualModelName,
+		Data:   make([]openai.EmbeddingResponseItem, 0, len(embeddings)),
+		Usage: model.Usage{
+			PromptTokens: promptTokens,
+			TotalTokens:  promptTokens,
+		},
+	}
+	for i, embedding := range embeddings {
+		response.Data = append(response.Data, openai.EmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: embedding,
+		})
+	}
+	return &response
+}
+
+// TitanEmbeddingHandler embeds the inputs one by one, titan only takes a single text
+func TitanEmbeddingHandler(c *gin.Context, meta *meta.Meta, request *model.GeneralOpenAIRequest) (*model.ErrorWithStatusCode, *model.Usage) {
+	var embeddings [][]float64
+	promptTokens := 0
+	for _, input := range request.ParseInput() {
+		var titanResponse TitanEmbeddingResponse
+		titanRequest := TitanEmbeddingRequest{InputText: input, Dimensions: request.Dimensions}
+		if err := invoke(c, meta, &titanRequest, &titanResponse); err != nil {
+			return err, nil
+		}
+		embeddings = append(embeddings, titanResponse.Embedding)
+		promptTokens += titanResponse.InputTextTokenCount
+	}
+	response := embeddingResponse(meta, embeddings, promptTokens)
+	c.JSON(http.StatusOK, response)
+	return nil, &response.Usage
+}
+
+// CohereEmbeddingHandler embeds the inputs as documents, cohere doesn't return the number of tokens
+func CohereEmbeddingHandler(c *gin.Context, meta *meta.Meta, request *model.GeneralOpenAIRequest) (*model.ErrorWithStatusCode, *model.Usage) {
+	var cohereResponse CohereEmbeddingResponse
+	cohereRequest := CohereEmbeddingRequest{Texts: request.ParseInput(), InputType: "search_document"}
+	if err := invoke(c, meta, &cohereRequest, &cohereResponse); err != nil {
+		return err, nil
+	}
+	response := embeddingResponse(meta, cohereResponse.Embeddings, meta.PromptTokens)
+	c.JSON(http.StatusOK, response)
+	return nil, &response.Usage
+}
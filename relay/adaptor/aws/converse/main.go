@@ -0,0 +1,454 @@
+// Package converse relays chat completions to any model of bedrock with the Converse and ConverseStream apis,
+// and embeddings with the native requests of the titan and cohere models.
+package converse
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/media"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/common/render"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/aws/utils"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// ModelList is a selection of the bedrock model ids, any other id of a known family works too, as well as the
+// cross-region inference profiles like us.amazon.nova-pro-v1:0
+var ModelList = []string{
+	"amazon.nova-micro-v1:0",
+	"amazon.nova-lite-v1:0",
+	"amazon.nova-pro-v1:0",
+	"amazon.nova-premier-v1:0",
+	"amazon.titan-text-premier-v1:0",
+	"amazon.titan-text-express-v1",
+	"anthropic.claude-3-5-haiku-20241022-v1:0",
+	"anthropic.claude-3-7-sonnet-20250219-v1:0",
+	"anthropic.claude-sonnet-4-20250514-v1:0",
+	"mistral.mistral-large-2407-v1:0",
+	"mistral.mistral-small-2402-v1:0",
+	"mistral.pixtral-large-2502-v1:0",
+	"cohere.command-r-v1:0",
+	"cohere.command-r-plus-v1:0",
+	"deepseek.r1-v1:0",
+	"meta.llama3-1-70b-instruct-v1:0",
+	"meta.llama3-3-70b-instruct-v1:0",
+	"amazon.titan-embed-text-v2:0",
+	"amazon.titan-embed-text-v1",
+	"cohere.embed-english-v3",
+	"cohere.embed-multilingual-v3",
+}
+
+var documentNameUnsafe = regexp.MustCompile(`[^a-zA-Z0-9\s\-()\[\]]+|\s{2,}`)
+
+func stopSequences(stop any) []string {
+	switch v := stop.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var sequences []string
+		for _, sequence := range v {
+			if s, ok := sequence.(string); ok {
+				sequences = append(sequences, s)
+			}
+		}
+		return sequences
+	}
+	return nil
+}
+
+// documentFormat is the format of a document block for a mime type, "" when bedrock doesn't read it
+func documentFormat(mimeType string) string {
+	switch mimeType {
+	case media.MimeTypePDF:
+		return "pdf"
+	case "text/csv":
+		return "csv"
+	case "text/html":
+		return "html"
+	case "text/markdown":
+		return "md"
+	case "application/msword":
+		return "doc"
+	case "application/vnd.openxmlformats-officedocument.wordprocessingml.document":
+		return "docx"
+	case "application/vnd.ms-excel":
+		return "xls"
+	case "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":
+		return "xlsx"
+	}
+	if strings.HasPrefix(mimeType, "text/") {
+		return "txt"
+	}
+	return ""
+}
+
+// documentName removes the extension and the characters bedrock doesn't allow in the names of documents
+func documentName(filename string, index int) string {
+	if i := strings.LastIndexByte(filename, '.'); i > 0 {
+		filename = filename[:i]
+	}
+	name := strings.TrimSpace(documentNameUnsafe.ReplaceAllString(filename, " "))
+	if name == "" {
+		return fmt.Sprintf("document %d", index+1)
+	}
+	return name
+}
+
+func convertContent(message model.Message, documents *int) ([]ContentBlock, error) {
+	var blocks []ContentBlock
+	for _, part := range message.ParseContent() {
+		switch part.Type {
+		case model.ContentTypeText:
+			if strings.TrimSpace(part.Text) != "" {
+				blocks = append(blocks, ContentBlock{Text: part.Text})
+			}
+		case model.ContentTypeImageURL:
+			image, err := media.Fetch(part.ImageURL.Url)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, ContentBlock{Image: &ImageBlock{
+				Format: strings.TrimPrefix(image.MimeType, "image/"),
+				Source: Source{Bytes: image.Data},
+			}})
+		case model.ContentTypeFile:
+			document, err := media.Fetch(part.File.URL())
+			if err != nil {
+				return nil, err
+			}
+			format := documentFormat(document.MimeType)
+			if format == "" {
+				return nil, fmt.Errorf("files of type %s are not supported by bedrock", document.MimeType)
+			}
+			blocks = append(blocks, ContentBlock{Document: &DocumentBlock{
+				Format: format,
+				Name:   documentName(part.File.Filename, *documents),
+				Source: Source{Bytes: document.Data},
+			}})
+			*documents++
+		}
+	}
+	return blocks, nil
+}
+
+func convertTools(request *model.GeneralOpenAIRequest) *ToolConfig {
+	if len(request.Tools) == 0 || request.ToolChoice == "none" {
+		return nil
+	}
+	toolConfig := ToolConfig{}
+	for _, tool := range request.Tools {
+		parameters := tool.Function.Parameters
+		if parameters == nil {
+			parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		toolConfig.Tools = append(toolConfig.Tools, Tool{ToolSpec: ToolSpec{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: InputSchema{Json: parameters},
+		}})
+	}
+	switch choice := request.ToolChoice.(type) {
+	case string:
+		if choice == "required" {
+			toolConfig.ToolChoice = map[string]any{"any": map[string]any{}}
+		} else {
+			toolConfig.ToolChoice = map[string]any{"auto": map[string]any{}}
+		}
+	case map[string]any:
+		if function, ok := choice["function"].(map[string]any); ok {
+			toolConfig.ToolChoice = map[string]any{"tool": map[string]any{"name": function["name"]}}
+		}
+	}
+	return &toolConfig
+}
+
+// appendMessage merges the consecutive messages of a role, the roles have to alternate in converse
+func appendMessage(messages []Message, role string, blocks []ContentBlock) []Message {
+	if len(blocks) == 0 {
+		return messages
+	}
+	if len(messages) > 0 && messages[len(messages)-1].Role == role {
+		messages[len(messages)-1].Content = append(messages[len(messages)-1].Content, blocks...)
+		return messages
+	}
+	return append(messages, Message{Role: role, Content: blocks})
+}
+
+func ConvertRequest(request model.GeneralOpenAIRequest) (*Request, error) {
+	converseRequest := Request{
+		InferenceConfig: &InferenceConfig{
+			MaxTokens:     request.MaxTokens,
+			Temperature:   request.Temperature,
+			TopP:          request.TopP,
+			StopSequences: stopSequences(request.Stop),
+		},
+		ToolConfig: convertTools(&request),
+	}
+	if request.MaxCompletionTokens != nil {
+		converseRequest.InferenceConfig.MaxTokens = *request.MaxCompletionTokens
+	}
+	documents := 0
+	for _, message := range request.Messages {
+		switch message.Role {
+		case "system", "developer":
+			converseRequest.System = append(converseRequest.System, SystemContent{Text: message.StringContent()})
+		case "tool":
+			converseRequest.Messages = appendMessage(converseRequest.Messages, "user", []ContentBlock{{
+				ToolResult: &ToolResultBlock{
+					ToolUseId: message.ToolCallId,
+					Content:   []ToolResultContent{{Text: message.StringContent()}},
+				},
+			}})
+		case "assistant":
+			var blocks []ContentBlock
+			if reasoning, ok := message.ReasoningContent.(string); ok && message.ReasoningSignature != "" {
+				blocks = append(blocks, ContentBlock{ReasoningContent: &ReasoningContent{
+					ReasoningText: &ReasoningText{Text: reasoning, Signature: message.ReasoningSignature},
+				}})
+			}
+			if text := message.StringContent(); strings.TrimSpace(text) != "" {
+				blocks = append(blocks, ContentBlock{Text: text})
+			}
+			for _, toolCall := range message.ToolCalls {
+				input := map[string]any{}
+				if arguments, ok := toolCall.Function.Arguments.(string); ok && arguments != "" {
+					_ = json.Unmarshal([]byte(arguments), &input)
+				}
+				blocks = append(blocks, ContentBlock{ToolUse: &ToolUseBlock{
+					ToolUseId: toolCall.Id,
+					Name:      toolCall.Function.Name,
+					Input:     input,
+				}})
+			}
+			converseRequest.Messages = appendMessage(converseRequest.Messages, "assistant", blocks)
+		default:
+			blocks, err := convertContent(message, &documents)
+			if err != nil {
+				return nil, err
+			}
+			converseRequest.Messages = appendMessage(converseRequest.Messages, "user", blocks)
+		}
+	}
+	return &converseRequest, nil
+}
+
+// convertUsage counts the cached tokens as prompt tokens, they are not part of the input tokens
+func convertUsage(usage Usage) model.Usage {
+	promptTokens := usage.InputTokens + usage.CacheReadInputTokens + usage.CacheWriteInputTokens
+	result := model.Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: usage.OutputTokens,
+		TotalTokens:      promptTokens + usage.OutputTokens,
+	}
+	if usage.CacheReadInputTokens > 0 || usage.CacheWriteInputTokens > 0 {
+		result.PromptTokensDetails = &model.PromptTokensDetails{
+			CachedTokens:        usage.CacheReadInputTokens,
+			CacheCreationTokens: usage.CacheWriteInputTokens,
+		}
+	}
+	return result
+}
+
+func responseConverse2OpenAI(response *Response, modelName string) *openai.TextResponse {
+	message := model.Message{Role: "assistant"}
+	var content, reasoning string
+	for _, block := range response.Output.Message.Content {
+		switch {
+		case block.ToolUse != nil:
+			arguments, _ := json.Marshal(block.ToolUse.Input)
+			message.ToolCalls = append(message.ToolCalls, model.Tool{
+				Id:   block.ToolUse.ToolUseId,
+				Type: "function",
+				Function: model.Function{
+					Name:      block.ToolUse.Name,
+					Arguments: string(arguments),
+				},
+			})
+		case block.ReasoningContent != nil && block.ReasoningContent.ReasoningText != nil:
+			reasoning += block.ReasoningContent.ReasoningText.Text
+			message.ReasoningSignature = block.ReasoningContent.ReasoningText.Signature
+		default:
+			content += block.Text
+		}
+	}
+	message.Content = content
+	if reasoning != "" {
+		message.ReasoningContent = reasoning
+	}
+	return &openai.TextResponse{
+		Id:      "chatcmpl-" + random.GetUUID(),
+		Model:   modelName,
+		Object:  "chat.completion",
+		Created: helper.GetTimestamp(),
+		Choices: []openai.TextResponseChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: adaptor.MapFinishReason(response.StopReason),
+		}},
+		Usage: convertUsage(response.Usage),
+	}
+}
+
+func Handler(c *gin.Context, meta *meta.Meta, request *Request) (*model.ErrorWithStatusCode, *model.Usage) {
+	resp, err := utils.SendRequest(c, meta, meta.ActualModelName, "converse", request)
+	if err != nil {
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError), nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return utils.RelayError(resp), nil
+	}
+	defer resp.Body.Close()
+	var converseResponse Response
+	if err = json.NewDecoder(resp.Body).Decode(&converseResponse); err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	textResponse := responseConverse2OpenAI(&converseResponse, meta.ActualModelName)
+	textResponse.NormalizeReasoning(c.GetBool(ctxkey.ExcludeReasoning))
+	c.JSON(http.StatusOK, textResponse)
+	return nil, &textResponse.Usage
+}
+
+// streamError is an exception sent in the stream, like a throttling or a validation error
+func streamError(message eventstream.Message) *model.ErrorWithStatusCode {
+	var exception struct {
+		Message string `json:"message"`
+	}
+	_ = json.Unmarshal(message.Payload, &exception)
+	exceptionType := ""
+	if header := message.Headers.Get(":exception-type"); header != nil {
+		exceptionType = header.String()
+	}
+	statusCode := http.StatusInternalServerError
+	switch exceptionType {
+	case "throttlingException":
+		statusCode = http.StatusTooManyRequests
+	case "validationException":
+		statusCode = http.StatusBadRequest
+	}
+	return &model.ErrorWithStatusCode{
+		StatusCode: statusCode,
+		Error: model.Error{
+			Message: exception.Message,
+			Type:    "aws_error",
+			Code:    exceptionType,
+		},
+	}
+}
+
+func StreamHandler(c *gin.Context, meta *meta.Meta, request *Request) (*model.ErrorWithStatusCode, *model.Usage) {
+	resp, err := utils.SendRequest(c, meta, meta.ActualModelName, "converse-stream", request)
+	if err != nil {
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError), nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return utils.RelayError(resp), nil
+	}
+	defer resp.Body.Close()
+	common.SetEventStreamHeaders(c)
+
+	response := openai.ChatCompletionsStreamResponse{
+		Id:      "chatcmpl-" + random.GetUUID(),
+		Object:  "chat.completion.chunk",
+		Created: helper.GetTimestamp(),
+		Model:   meta.ActualModelName,
+	}
+	excludeReasoning := c.GetBool(ctxkey.ExcludeReasoning)
+	send := func(delta model.Message, finishReason *string) {
+		chunk := response
+		chunk.Choices = []openai.ChatCompletionsStreamResponseChoice{{Delta: delta, FinishReason: finishReason}}
+		chunk.NormalizeReasoning(excludeReasoning)
+		if err := render.ObjectData(c, chunk); err != nil {
+			logger.SysError(err.Error())
+		}
+	}
+	var usage model.Usage
+	// the tool calls are numbered apart from the other content blocks
+	toolIndexes := map[int]int{}
+	decoder := eventstream.NewDecoder()
+	payload := make([]byte, 0, 1024)
+	for {
+		message, err := decoder.Decode(resp.Body, payload)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return openai.ErrorWrapper(err, "read_stream_failed", http.StatusInternalServerError), &usage
+		}
+		if header := message.Headers.Get(":message-type"); header != nil && header.String() == "exception" {
+			return streamError(message), &usage
+		}
+		eventType := ""
+		if header := message.Headers.Get(":event-type"); header != nil {
+			eventType = header.String()
+		}
+		switch eventType {
+		case "messageStart":
+			send(model.Message{Role: "assistant", Content: ""}, nil)
+		case "contentBlockStart":
+			var event ContentBlockStartEvent
+			if json.Unmarshal(message.Payload, &event) != nil || event.Start.ToolUse == nil {
+				continue
+			}
+			index := len(toolIndexes)
+			toolIndexes[event.ContentBlockIndex] = index
+			send(model.Message{ToolCalls: []model.Tool{{
+				Index: &index,
+				Id:    event.Start.ToolUse.ToolUseId,
+				Type:  "function",
+				Function: model.Function{
+					Name:      event.Start.ToolUse.Name,
+					Arguments: "",
+				},
+			}}}, nil)
+		case "contentBlockDelta":
+			var event ContentBlockDeltaEvent
+			if json.Unmarshal(message.Payload, &event) != nil {
+				continue
+			}
+			delta := event.Delta
+			switch {
+			case delta.ToolUse != nil:
+				index := toolIndexes[event.ContentBlockIndex]
+				send(model.Message{ToolCalls: []model.Tool{{
+					Index:    &index,
+					Function: model.Function{Arguments: delta.ToolUse.Input},
+				}}}, nil)
+			case delta.ReasoningContent != nil:
+				send(model.Message{
+					ReasoningContent:   delta.ReasoningContent.Text,
+					ReasoningSignature: delta.ReasoningContent.Signature,
+				}, nil)
+			case delta.Text != "":
+				send(model.Message{Content: delta.Text}, nil)
+			}
+		case "messageStop":
+			var event MessageStopEvent
+			_ = json.Unmarshal(message.Payload, &event)
+			finishReason := adaptor.MapFinishReason(event.StopReason)
+			send(model.Message{}, &finishReason)
+		case "metadata":
+			var event MetadataEvent
+			if json.Unmarshal(message.Payload, &event) == nil {
+				usage = convertUsage(event.Usage)
+			}
+		}
+	}
+	render.Done(c)
+	return nil, &usage
+}
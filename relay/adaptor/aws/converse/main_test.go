@@ -0,0 +1,156 @@
+package converse
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/client"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+const testModelId = "us.amazon.nova-pro-v1:0"
+
+// newMockServer replays the recorded responses of bedrock
+func newMockServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		switch {
+		case !strings.HasPrefix(r.URL.EscapedPath(), "/model/us.amazon.nova-pro-v1%3A0/"):
+			w.Header().Set("X-Amzn-ErrorType", "ValidationException:http://internal.amazon.com/coral/com.amazon.bedrock/")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"message":"The provided model identifier is invalid."}`))
+		case strings.HasSuffix(r.URL.Path, "/converse"):
+			recorded, err := os.ReadFile("testdata/converse.json")
+			require.NoError(t, err)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(recorded)
+		case strings.HasSuffix(r.URL.Path, "/converse-stream"):
+			file, err := os.Open("testdata/converse-stream.jsonl")
+			require.NoError(t, err)
+			defer file.Close()
+			w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+			encoder := eventstream.NewEncoder()
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				var event struct {
+					Event   string          `json:"event"`
+					Payload json.RawMessage `json:"payload"`
+				}
+				require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+				message := eventstream.Message{Payload: event.Payload}
+				message.Headers.Set(":message-type", eventstream.StringValue("event"))
+				message.Headers.Set(":event-type", eventstream.StringValue(event.Event))
+				require.NoError(t, encoder.Encode(w, message))
+			}
+		}
+	}))
+}
+
+func newTestContext(server *httptest.Server, stream bool) (*gin.Context, *httptest.ResponseRecorder, *meta.Meta) {
+	client.Init()
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	relayMeta := &meta.Meta{
+		BaseURL:         server.URL,
+		ActualModelName: testModelId,
+		IsStream:        stream,
+		Config:          dbmodel.ChannelConfig{Region: "us-east-1", AK: "AKID", SK: "SECRET"},
+	}
+	return c, recorder, relayMeta
+}
+
+func TestConvertRequest(t *testing.T) {
+	request, err := ConvertRequest(model.GeneralOpenAIRequest{
+		MaxTokens: 256,
+		Stop:      "END",
+		Messages: []model.Message{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: "Weather in Paris and Rome?"},
+			{Role: "assistant", ToolCalls: []model.Tool{
+				{Id: "call_1", Type: "function", Function: model.Function{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+				{Id: "call_2", Type: "function", Function: model.Function{Name: "get_weather", Arguments: `{"city":"Rome"}`}},
+			}},
+			{Role: "tool", ToolCallId: "call_1", Content: "18C"},
+			{Role: "tool", ToolCallId: "call_2", Content: "24C"},
+		},
+		Tools:      []model.Tool{{Type: "function", Function: model.Function{Name: "get_weather", Parameters: map[string]any{"type": "object"}}}},
+		ToolChoice: "required",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []SystemContent{{Text: "Be brief."}}, request.System)
+	assert.Equal(t, 256, request.InferenceConfig.MaxTokens)
+	assert.Equal(t, []string{"END"}, request.InferenceConfig.StopSequences)
+	require.Len(t, request.Messages, 3)
+	assert.Len(t, request.Messages[1].Content, 2)
+	// the results of the tools are sent back in a single user message
+	assert.Equal(t, "user", request.Messages[2].Role)
+	assert.Equal(t, "call_2", request.Messages[2].Content[1].ToolResult.ToolUseId)
+	assert.Equal(t, map[string]any{"any": map[string]any{}}, request.ToolConfig.ToolChoice)
+}
+
+func TestHandler(t *testing.T) {
+	server := newMockServer(t)
+	defer server.Close()
+	c, recorder, relayMeta := newTestContext(server, false)
+	err, usage := Handler(c, relayMeta, &Request{Messages: []Message{{Role: "user", Content: []ContentBlock{{Text: "Weather?"}}}}})
+	require.Nil(t, err)
+	assert.Equal(t, 469, usage.TotalTokens)
+	var response struct {
+		Choices []struct {
+			Message      model.Message `json:"message"`
+			FinishReason string        `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, "tool_calls", response.Choices[0].FinishReason)
+	assert.Equal(t, "Let me check the weather.", response.Choices[0].Message.Content)
+	assert.Equal(t, `{"city":"Paris"}`, response.Choices[0].Message.ToolCalls[0].Function.Arguments)
+}
+
+func TestStreamHandler(t *testing.T) {
+	server := newMockServer(t)
+	defer server.Close()
+	c, recorder, relayMeta := newTestContext(server, true)
+	err, usage := StreamHandler(c, relayMeta, &Request{Messages: []Message{{Role: "user", Content: []ContentBlock{{Text: "Hi"}}}}})
+	require.Nil(t, err)
+	assert.Equal(t, 37, usage.TotalTokens)
+	body := recorder.Body.String()
+	assert.Contains(t, body, `"content":"Hello"`)
+	assert.Contains(t, body, `"tool_calls":[{"index":0,"id":"tooluse_1","type":"function","function":{"name":"get_weather","arguments":""}}]`)
+	assert.Contains(t, body, `"arguments":"{\"city\": \"Paris\"}"`)
+	assert.Contains(t, body, `"finish_reason":"tool_calls"`)
+	assert.True(t, strings.HasSuffix(body, "data: [DONE]\n\n"))
+}
+
+func TestHandlerError(t *testing.T) {
+	server := newMockServer(t)
+	defer server.Close()
+	c, _, relayMeta := newTestContext(server, false)
+	relayMeta.ActualModelName = "amazon.nova-unknown-v1:0"
+	err, _ := Handler(c, relayMeta, &Request{})
+	require.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode)
+	assert.Equal(t, "ValidationException", err.Error.Code)
+}
+
+func TestConvertUsageCache(t *testing.T) {
+	var usage Usage
+	require.NoError(t, json.Unmarshal([]byte(`{"inputTokens":12,"outputTokens":30,"totalTokens":3090,"cacheReadInputTokens":2048,"cacheWriteInputTokens":1000}`), &usage))
+	converted := convertUsage(usage)
+	assert.Equal(t, 3060, converted.PromptTokens)
+	assert.Equal(t, 3090, converted.TotalTokens)
+	assert.Equal(t, &model.PromptTokensDetails{CachedTokens: 2048, CacheCreationTokens: 1000}, converted.PromptTokensDetails)
+}
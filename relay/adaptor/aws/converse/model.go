@@ -0,0 +1,162 @@
+package converse
+
+// https://docs.aws.amazon.com/bedrock/latest/APIReference/API_runtime_Converse.html
+
+type Request struct {
+	Messages        []Message        `json:"messages"`
+	System          []SystemContent  `json:"system,omitempty"`
+	InferenceConfig *InferenceConfig `json:"inferenceConfig,omitempty"`
+	ToolConfig      *ToolConfig      `json:"toolConfig,omitempty"`
+}
+
+type SystemContent struct {
+	Text string `json:"text"`
+}
+
+type InferenceConfig struct {
+	MaxTokens     int      `json:"maxTokens,omitempty"`
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          *float64 `json:"topP,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+}
+
+type Message struct {
+	Role    string         `json:"role"`
+	Content []ContentBlock `json:"content"`
+}
+
+// ContentBlock is a union, only one of the fields is set
+type ContentBlock struct {
+	Text             string            `json:"text,omitempty"`
+	Image            *ImageBlock       `json:"image,omitempty"`
+	Document         *DocumentBlock    `json:"document,omitempty"`
+	ToolUse          *ToolUseBlock     `json:"toolUse,omitempty"`
+	ToolResult       *ToolResultBlock  `json:"toolResult,omitempty"`
+	ReasoningContent *ReasoningContent `json:"reasoningContent,omitempty"`
+}
+
+type Source struct {
+	Bytes []byte `json:"bytes"`
+}
+
+type ImageBlock struct {
+	Format string `json:"format"`
+	Source Source `json:"source"`
+}
+
+type DocumentBlock struct {
+	Format string `json:"format"`
+	Name   string `json:"name"`
+	Source Source `json:"source"`
+}
+
+type ToolUseBlock struct {
+	ToolUseId string `json:"toolUseId"`
+	Name      string `json:"name"`
+	Input     any    `json:"input"`
+}
+
+type ToolResultBlock struct {
+	ToolUseId string              `json:"toolUseId"`
+	Content   []ToolResultContent `json:"content"`
+}
+
+type ToolResultContent struct {
+	Text string `json:"text"`
+}
+
+type ReasoningContent struct {
+	ReasoningText *ReasoningText `json:"reasoningText,omitempty"`
+}
+
+type ReasoningText struct {
+	Text      string `json:"text"`
+	Signature string `json:"signature,omitempty"`
+}
+
+type ToolConfig struct {
+	Tools      []Tool `json:"tools"`
+	ToolChoice any    `json:"toolChoice,omitempty"`
+}
+
+type Tool struct {
+	ToolSpec ToolSpec `json:"toolSpec"`
+}
+
+type ToolSpec struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	InputSchema InputSchema `json:"inputSchema"`
+}
+
+type InputSchema struct {
+	Json any `json:"json"`
+}
+
+type Usage struct {
+	InputTokens           int `json:"inputTokens"`
+	OutputTokens          int `json:"outputTokens"`
+	TotalTokens           int `json:"totalTokens"`
+	CacheReadInputTokens  int `json:"cacheReadInputTokens,omitempty"`
+	CacheWriteInputTokens int `json:"cacheWriteInputTokens,omitempty"`
+}
+
+type Response struct {
+	Output struct {
+		Message Message `json:"message"`
+	} `json:"output"`
+	StopReason string `json:"stopReason"`
+	Usage      Usage  `json:"usage"`
+}
+
+// stream events, the type of an event is in its :event-type header
+
+type ContentBlockStartEvent struct {
+	ContentBlockIndex int `json:"contentBlockIndex"`
+	Start             struct {
+		ToolUse *ToolUseBlock `json:"toolUse,omitempty"`
+	} `json:"start"`
+}
+
+type ContentBlockDeltaEvent struct {
+	ContentBlockIndex int `json:"contentBlockIndex"`
+	Delta             struct {
+		Text    string `json:"text,omitempty"`
+		ToolUse *struct {
+			Input string `json:"input"`
+		} `json:"toolUse,omitempty"`
+		ReasoningContent *struct {
+			Text      string `json:"text,omitempty"`
+			Signature string `json:"signature,omitempty"`
+		} `json:"reasoningContent,omitempty"`
+	} `json:"delta"`
+}
+
+type MessageStopEvent struct {
+	StopReason string `json:"stopReason"`
+}
+
+type MetadataEvent struct {
+	Usage Usage `json:"usage"`
+}
+
+// embeddings are not part of converse, they are invoked with the native request of the model
+
+type TitanEmbeddingRequest struct {
+	InputText  string `json:"inputText"`
+	Dimensions int    `json:"dimensions,omitempty"`
+}
+
+type TitanEmbeddingResponse struct {
+	Embedding           []float64 `json:"embedding"`
+	InputTextTokenCount int       `json:"inputTextTokenCount"`
+}
+
+type CohereEmbeddingRequest struct {
+	Texts     []string `json:"texts"`
+	InputType string   `json:"input_type"`
+}
+
+type CohereEmbeddingResponse struct {
+	Embeddings [][]float64 `json:"embeddings"`
+}
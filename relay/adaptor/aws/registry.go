@@ -1,7 +1,10 @@
 package aws
 
 import (
+	"strings"
+
 	claude "github.com/songquanpeng/one-api/relay/adaptor/aws/claude"
+	"github.com/songquanpeng/one-api/relay/adaptor/aws/converse"
 	llama3 "github.com/songquanpeng/one-api/relay/adaptor/aws/llama3"
 	"github.com/songquanpeng/one-api/relay/adaptor/aws/utils"
 )
@@ -11,12 +14,38 @@ type AwsModelType int
 const (
 	AwsClaude AwsModelType = iota + 1
 	AwsLlama3
+	AwsConverse
+	AwsTitanEmbedding
+	AwsCohereEmbedding
 )
 
 var (
+	// adaptors are the short model names of the adaptors invoking the native apis of the models
 	adaptors = map[string]AwsModelType{}
 )
 
+// modelFamilies picks the adaptor of a bedrock model id by its provider and family, the first match wins
+var modelFamilies = []struct {
+	prefix    string
+	modelType AwsModelType
+}{
+	{"amazon.titan-embed", AwsTitanEmbedding},
+	{"cohere.embed", AwsCohereEmbedding},
+	{"amazon.", AwsConverse},
+	{"anthropic.", AwsConverse},
+	{"mistral.", AwsConverse},
+	{"cohere.command", AwsConverse},
+	{"deepseek.", AwsConverse},
+	{"meta.", AwsConverse},
+	{"ai21.", AwsConverse},
+	{"writer.", AwsConverse},
+	{"qwen.", AwsConverse},
+	{"openai.", AwsConverse},
+}
+
+// inferenceProfilePrefixes are the geographies of the cross-region inference profiles, like us.amazon.nova-pro-v1:0
+var inferenceProfilePrefixes = []string{"us.", "us-gov.", "eu.", "apac.", "jp.", "au.", "global."}
+
 func init() {
 	for model := range claude.AwsModelIDMap {
 		adaptors[model] = AwsClaude
@@ -26,13 +55,36 @@ func init() {
 	}
 }
 
+func getModelType(model string) AwsModelType {
+	if modelType, ok := adaptors[model]; ok {
+		return modelType
+	}
+	for _, prefix := range inferenceProfilePrefixes {
+		if strings.HasPrefix(model, prefix) {
+			model = strings.TrimPrefix(model, prefix)
+			break
+		}
+	}
+	for _, family := range modelFamilies {
+		if strings.HasPrefix(model, family.prefix) {
+			return family.modelType
+		}
+	}
+	return 0
+}
+
 func GetAdaptor(model string) utils.AwsAdapter {
-	adaptorType := adaptors[model]
-	switch adaptorType {
+	switch getModelType(model) {
 	case AwsClaude:
 		return &claude.Adaptor{}
 	case AwsLlama3:
 		return &llama3.Adaptor{}
+	case AwsConverse:
+		return &converse.Adaptor{}
+	case AwsTitanEmbedding:
+		return &converse.EmbeddingAdaptor{Family: converse.EmbeddingTitan}
+	case AwsCohereEmbedding:
+		return &converse.EmbeddingAdaptor{Family: converse.EmbeddingCohere}
 	default:
 		return nil
 	}
@@ -0,0 +1,17 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetModelType(t *testing.T) {
+	assert.Equal(t, AwsClaude, getModelType("claude-3-5-sonnet-20241022"))
+	assert.Equal(t, AwsConverse, getModelType("anthropic.claude-3-5-sonnet-20241022-v2:0"))
+	assert.Equal(t, AwsConverse, getModelType("us.amazon.nova-pro-v1:0"))
+	assert.Equal(t, AwsConverse, getModelType("mistral.mistral-large-2407-v1:0"))
+	assert.Equal(t, AwsTitanEmbedding, getModelType("amazon.titan-embed-text-v2:0"))
+	assert.Equal(t, AwsCohereEmbedding, getModelType("cohere.embed-multilingual-v3"))
+	assert.Equal(t, AwsModelType(0), getModelType("gpt-4o"))
+}
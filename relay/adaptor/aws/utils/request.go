@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+var signer = v4.NewSigner()
+
+// GetEndpoint is the base url of the channel when set, so that a mock server can stand in for bedrock
+func GetEndpoint(meta *meta.Meta) string {
+	if meta.BaseURL != "" {
+		return strings.TrimSuffix(meta.BaseURL, "/")
+	}
+	return fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com", meta.Config.Region)
+}
+
+// SendRequest posts the body to an action of the bedrock runtime api, like converse or invoke, signed with the
+// keys of the channel
+func SendRequest(c *gin.Context, meta *meta.Meta, modelId string, action string, body any) (*http.Response, error) {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	// the model id is escaped once in the path, the signer escapes it again as bedrock expects
+	escapedModelId := strings.ReplaceAll(url.PathEscape(modelId), ":", "%3A")
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPost, GetEndpoint(meta)+"/model/"+escapedModelId+"/"+action, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	hash := sha256.Sum256(jsonBody)
+	credentials := aws.Credentials{AccessKeyID: meta.Config.AK, SecretAccessKey: meta.Config.SK}
+	err = signer.SignHTTP(req.Context(), credentials, req, hex.EncodeToString(hash[:]), "bedrock", meta.Config.Region, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return client.HTTPClient.Do(req)
+}
+
+// RelayError turns an error response of bedrock into an openai error, keeping its status code
+func RelayError(resp *http.Response) *relaymodel.ErrorWithStatusCode {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	var bedrockError struct {
+		Message string `json:"message"`
+	}
+	_ = json.Unmarshal(body, &bedrockError)
+	if bedrockError.Message == "" {
+		bedrockError.Message = string(body)
+	}
+	errorType := resp.Header.Get("X-Amzn-ErrorType")
+	if i := strings.IndexByte(errorType, ':'); i >= 0 {
+		errorType = errorType[:i]
+	}
+	return &relaymodel.ErrorWithStatusCode{
+		StatusCode: resp.StatusCode,
+		Error: relaymodel.Error{
+			Message: bedrockError.Message,
+			Type:    "aws_error",
+			Code:    errorType,
+		},
+	}
+}
@@ -0,0 +1,16 @@
+package azure
+
+const (
+	AuthTypeAPIKey            = "api_key"
+	AuthTypeClientCredentials = "client_credentials"
+	AuthTypeManagedIdentity   = "managed_identity"
+)
+
+// https://learn.microsoft.com/en-us/azure/ai-services/openai/how-to/managed-identity
+const (
+	scope    = "https://cognitiveservices.azure.com/.default"
+	resource = "https://cognitiveservices.azure.com"
+)
+
+// ListDeploymentsAPIVersion is the last api version listing the deployments on the data plane
+const ListDeploymentsAPIVersion = "2022-12-01"
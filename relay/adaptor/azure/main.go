@@ -0,0 +1,42 @@
+package azure
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/songquanpeng/one-api/relay/meta"
+)
+
+// GetDeploymentName looks the model up in the deployments of the channel, the deployments are named after the models
+// without dots otherwise
+func GetDeploymentName(deployments map[string]string, modelName string) string {
+	if deployment := deployments[modelName]; deployment != "" {
+		return deployment
+	}
+	//https://github.com/songquanpeng/one-api/issues/1191
+	return strings.Replace(modelName, ".", "", -1)
+}
+
+// GetCredential reads the credential of the channel from its config and key
+func GetCredential(meta *meta.Meta) Credential {
+	return Credential{
+		AuthType: meta.Config.AzureAuthType,
+		TenantID: meta.Config.AzureTenantID,
+		ClientID: meta.Config.AzureClientID,
+		Key:      meta.APIKey,
+	}
+}
+
+// SetupAuthHeader sets the api-key header, or a bearer token of microsoft entra id
+func SetupAuthHeader(header http.Header, channelId int, credential Credential) error {
+	if credential.AuthType == "" || credential.AuthType == AuthTypeAPIKey {
+		header.Set("api-key", credential.Key)
+		return nil
+	}
+	token, err := GetToken(channelId, credential)
+	if err != nil {
+		return err
+	}
+	header.Set("Authorization", "Bearer "+token)
+	return nil
+}
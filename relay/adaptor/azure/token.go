@@ -0,0 +1,148 @@
+package azure
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+
+	"github.com/songquanpeng/one-api/common/client"
+)
+
+// Credential is how a channel signs in to microsoft entra id
+type Credential struct {
+	AuthType string
+	TenantID string
+	ClientID string
+	// Key is the api key, or the client secret for client_credentials
+	Key string
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	// ExpiresIn is a number for the client credentials and a string for the managed identities
+	ExpiresIn        json.Number `json:"expires_in"`
+	Error            string      `json:"error,omitempty"`
+	ErrorDescription string      `json:"error_description,omitempty"`
+}
+
+var Cache = cache.New(50*time.Minute, 55*time.Minute)
+
+// the tokens are refreshed this long before they expire
+const refreshMargin = 5 * time.Minute
+
+var (
+	AuthorityHost = "https://login.microsoftonline.com"
+	// IMDSEndpoint is the instance metadata service of the virtual machines, app service and container apps
+	// give their own endpoint in IDENTITY_ENDPOINT
+	IMDSEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+)
+
+// tokenCacheKey tells the credentials apart, so that a token is not reused once the tenant or the secret of the channel
+// is changed. The secret is hashed to keep it out of the cache.
+func tokenCacheKey(channelId int, credential Credential) string {
+	secret := sha256.Sum256([]byte(credential.Key))
+	return fmt.Sprintf("azure-token-%d-%s-%s-%s-%s", channelId, credential.AuthType, credential.TenantID, credential.ClientID,
+		hex.EncodeToString(secret[:]))
+}
+
+// GetToken returns a cached token of the credential, a new one is acquired when it is about to expire
+func GetToken(channelId int, credential Credential) (string, error) {
+	cacheKey := tokenCacheKey(channelId, credential)
+	if token, found := Cache.Get(cacheKey); found {
+		return token.(string), nil
+	}
+	var req *http.Request
+	var err error
+	switch credential.AuthType {
+	case AuthTypeClientCredentials:
+		req, err = newClientCredentialsRequest(credential)
+	case AuthTypeManagedIdentity:
+		req, err = newManagedIdentityRequest(credential)
+	default:
+		return "", fmt.Errorf("unknown azure auth type %q", credential.AuthType)
+	}
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request token failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read token response failed: %w", err)
+	}
+	var response tokenResponse
+	if err = json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("status %d, unmarshal token response failed: %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || response.AccessToken == "" {
+		return "", fmt.Errorf("status %d, %s: %s", resp.StatusCode, response.Error, response.ErrorDescription)
+	}
+	expiresIn, _ := response.ExpiresIn.Int64()
+	expiration := time.Duration(expiresIn)*time.Second - refreshMargin
+	if expiration <= 0 {
+		expiration = time.Minute
+	}
+	Cache.Set(cacheKey, response.AccessToken, expiration)
+	return response.AccessToken, nil
+}
+
+// https://learn.microsoft.com/en-us/entra/identity-platform/v2-oauth2-client-creds-grant-flow#get-a-token
+func newClientCredentialsRequest(credential Credential) (*http.Request, error) {
+	if credential.TenantID == "" || credential.ClientID == "" || credential.Key == "" {
+		return nil, errors.New("the tenant id, client id and client secret are required")
+	}
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", credential.ClientID)
+	form.Set("client_secret", credential.Key)
+	form.Set("scope", scope)
+	req, err := http.NewRequest(http.MethodPost,
+		fmt.Sprintf("%s/%s/oauth2/v2.0/token", AuthorityHost, url.PathEscape(credential.TenantID)), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// https://learn.microsoft.com/en-us/entra/identity/managed-identities-azure-resources/how-to-use-vm-token#get-a-token-using-http
+// https://learn.microsoft.com/en-us/azure/app-service/overview-managed-identity#rest-endpoint-reference
+func newManagedIdentityRequest(credential Credential) (*http.Request, error) {
+	query := url.Values{}
+	query.Set("resource", resource)
+	// the client id picks a user assigned identity, the system assigned one is used without it
+	if credential.ClientID != "" {
+		query.Set("client_id", credential.ClientID)
+	}
+	endpoint := IMDSEndpoint
+	identityEndpoint, identityHeader := os.Getenv("IDENTITY_ENDPOINT"), os.Getenv("IDENTITY_HEADER")
+	if identityEndpoint != "" && identityHeader != "" {
+		endpoint = identityEndpoint
+		query.Set("api-version", "2019-08-01")
+	} else {
+		query.Set("api-version", "2018-02-01")
+	}
+	req, err := http.NewRequest(http.MethodGet, endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint == identityEndpoint {
+		req.Header.Set("X-IDENTITY-HEADER", identityHeader)
+	} else {
+		req.Header.Set("Metadata", "true")
+	}
+	return req, nil
+}
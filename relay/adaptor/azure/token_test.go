@@ -0,0 +1,79 @@
+package azure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/client"
+)
+
+func TestGetToken(t *testing.T) {
+	client.Init()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/tenant/oauth2/v2.0/token":
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+			assert.Equal(t, "https://cognitiveservices.azure.com/.default", r.PostForm.Get("scope"))
+			if r.PostForm.Get("client_secret") != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte(`{"error":"invalid_client","error_description":"AADSTS7000215: Invalid client secret provided."}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"token_type":"Bearer","expires_in":3599,"access_token":"client-token"}`))
+		case "/imds":
+			assert.Equal(t, "true", r.Header.Get("Metadata"))
+			assert.Equal(t, "https://cognitiveservices.azure.com", r.URL.Query().Get("resource"))
+			assert.Equal(t, "identity", r.URL.Query().Get("client_id"))
+			_, _ = w.Write([]byte(`{"access_token":"identity-token","expires_in":"86399","token_type":"Bearer"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	AuthorityHost = server.URL
+	IMDSEndpoint = server.URL + "/imds"
+	t.Setenv("IDENTITY_ENDPOINT", "")
+
+	credential := Credential{AuthType: AuthTypeClientCredentials, TenantID: "tenant", ClientID: "app", Key: "secret"}
+	token, err := GetToken(1, credential)
+	require.NoError(t, err)
+	assert.Equal(t, "client-token", token)
+	token, err = GetToken(1, credential)
+	require.NoError(t, err)
+	assert.Equal(t, "client-token", token)
+	assert.Equal(t, 1, requests)
+
+	_, err = GetToken(2, Credential{AuthType: AuthTypeClientCredentials, TenantID: "tenant", ClientID: "app", Key: "wrong"})
+	assert.ErrorContains(t, err, "invalid_client")
+
+	// the token of the channel is not reused once its secret or its tenant changes
+	_, err = GetToken(1, Credential{AuthType: AuthTypeClientCredentials, TenantID: "tenant", ClientID: "app", Key: "wrong"})
+	assert.ErrorContains(t, err, "invalid_client")
+	_, err = GetToken(1, Credential{AuthType: AuthTypeClientCredentials, TenantID: "other", ClientID: "app", Key: "secret"})
+	assert.Error(t, err)
+	assert.NotContains(t, tokenCacheKey(1, credential), "secret")
+
+	header := http.Header{}
+	require.NoError(t, SetupAuthHeader(header, 3, Credential{AuthType: AuthTypeManagedIdentity, ClientID: "identity"}))
+	assert.Equal(t, "Bearer identity-token", header.Get("Authorization"))
+	assert.Empty(t, header.Get("api-key"))
+
+	header = http.Header{}
+	require.NoError(t, SetupAuthHeader(header, 4, Credential{Key: "api-key"}))
+	assert.Equal(t, "api-key", header.Get("api-key"))
+}
+
+func TestGetDeploymentName(t *testing.T) {
+	deployments := map[string]string{"gpt-4o": "prod-4o"}
+	assert.Equal(t, "prod-4o", GetDeploymentName(deployments, "gpt-4o"))
+	assert.Equal(t, "gpt-35-turbo", GetDeploymentName(deployments, "gpt-3.5-turbo"))
+	assert.Equal(t, "gpt-41", GetDeploymentName(nil, "gpt-4.1"))
+}
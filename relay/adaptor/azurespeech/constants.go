@@ -0,0 +1,25 @@
+package azurespeech
+
+// azure-tts runs the text to speech api, azure-stt the fast transcription api
+var ModelList = []string{
+	"azure-tts",
+	"azure-stt",
+}
+
+// DefaultVoice is used for the voices of openai
+const DefaultVoice = "en-US-AvaMultilingualNeural"
+
+// https://learn.microsoft.com/en-us/azure/ai-services/speech-service/rest-text-to-speech#audio-outputs
+var outputFormats = map[string]string{
+	"mp3":  "audio-24khz-48kbitrate-mono-mp3",
+	"opus": "ogg-24khz-16bit-mono-opus",
+	"wav":  "riff-24khz-16bit-mono-pcm",
+	"pcm":  "raw-24khz-16bit-mono-pcm",
+}
+
+var contentTypes = map[string]string{
+	"mp3":  "audio/mpeg",
+	"opus": "audio/ogg",
+	"wav":  "audio/wav",
+	"pcm":  "audio/pcm",
+}
@@ -0,0 +1,200 @@
+package azurespeech
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://learn.microsoft.com/en-us/azure/ai-services/speech-service/rest-text-to-speech
+// https://learn.microsoft.com/en-us/azure/ai-services/speech-service/fast-transcription-create
+
+const transcriptionAPIVersion = "2024-11-15"
+
+// getRegionAndKey reads the key of the channel, written as region|key
+func getRegionAndKey(meta *meta.Meta) (string, string) {
+	if meta.Config.Region != "" {
+		return meta.Config.Region, meta.APIKey
+	}
+	region, key, found := strings.Cut(meta.APIKey, "|")
+	if !found {
+		return "", meta.APIKey
+	}
+	return region, key
+}
+
+// getEndpoint uses the base url of the channel when it is set, the hosts of the region otherwise
+func getEndpoint(meta *meta.Meta, region string, service string) (string, error) {
+	if meta.BaseURL != "" {
+		return strings.TrimSuffix(meta.BaseURL, "/"), nil
+	}
+	if region == "" {
+		return "", errors.New("no region, the key should be written as region|key")
+	}
+	switch service {
+	case "tts":
+		return fmt.Sprintf("https://%s.tts.speech.microsoft.com", region), nil
+	default:
+		return fmt.Sprintf("https://%s.api.cognitive.microsoft.com", region), nil
+	}
+}
+
+func doRequest(req *http.Request) ([]byte, error) {
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response body failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &adaptor.UpstreamError{StatusCode: resp.StatusCode, Body: string(responseBody)}
+	}
+	return responseBody, nil
+}
+
+// voiceLocale reads the locale from the voice name, like en-US from en-US-AvaMultilingualNeural
+func voiceLocale(voice string) string {
+	parts := strings.SplitN(voice, "-", 3)
+	if len(parts) < 3 {
+		return "en-US"
+	}
+	return parts[0] + "-" + parts[1]
+}
+
+func buildSSML(text string, voice string, speed float64) (string, error) {
+	var escaped bytes.Buffer
+	if err := xml.EscapeText(&escaped, []byte(text)); err != nil {
+		return "", err
+	}
+	content := escaped.String()
+	if speed > 0 && speed != 1 {
+		content = fmt.Sprintf(`<prosody rate="%+.0f%%">%s</prosody>`, (speed-1)*100, content)
+	}
+	return fmt.Sprintf(`<speak version="1.0" xmlns="http://www.w3.org/2001/10/synthesis" xml:lang="%s"><voice name="%s">%s</voice></speak>`,
+		voiceLocale(voice), voice, content), nil
+}
+
+func (a *Adaptor) CreateSpeech(meta *meta.Meta, request *model.SpeechRequest) (*model.SpeechResult, *model.ErrorWithStatusCode) {
+	format := request.ResponseFormat
+	if format == "" {
+		format = "mp3"
+	}
+	outputFormat, ok := outputFormats[format]
+	if !ok {
+		return nil, openai.ErrorWrapper(fmt.Errorf("response_format %s is not supported by azure speech", format), "invalid_response_format", http.StatusBadRequest)
+	}
+	voice := request.Voice
+	// the azure voices are written as locale-name, the others are the voices of openai
+	if strings.Count(voice, "-") < 2 {
+		voice = DefaultVoice
+	}
+	ssml, err := buildSSML(request.Input, voice, request.Speed)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "build_ssml_failed", http.StatusInternalServerError)
+	}
+	region, key := getRegionAndKey(meta)
+	endpoint, err := getEndpoint(meta, region, "tts")
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "invalid_channel_key", http.StatusInternalServerError)
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint+"/cognitiveservices/v1", strings.NewReader(ssml))
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	req.Header.Set("Content-Type", "application/ssml+xml")
+	req.Header.Set("Ocp-Apim-Subscription-Key", key)
+	req.Header.Set("X-Microsoft-OutputFormat", outputFormat)
+	req.Header.Set("User-Agent", "one-api")
+	audio, err := doRequest(req)
+	if err != nil {
+		return nil, adaptor.UpstreamErrorWrapper(err, "azure_speech_failed")
+	}
+	return &model.SpeechResult{Audio: audio, ContentType: contentTypes[format]}, nil
+}
+
+func (a *Adaptor) CreateTranscription(meta *meta.Meta, request *model.TranscriptionRequest) (*model.TranscriptionResult, *model.ErrorWithStatusCode) {
+	if request.Translate {
+		return nil, openai.ErrorWrapper(errors.New("the fast transcription of azure does not translate"), "translation_not_supported", http.StatusBadRequest)
+	}
+	definition := TranscriptionDefinition{}
+	// azure wants locales like en-US, the language is identified by azure for the iso-639-1 codes of openai
+	if strings.Contains(request.Language, "-") {
+		definition.Locales = []string{request.Language}
+	}
+	definitionJSON, err := json.Marshal(definition)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "marshal_definition_failed", http.StatusInternalServerError)
+	}
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("audio", request.Filename)
+	if err == nil {
+		_, err = part.Write(request.Audio)
+	}
+	if err == nil {
+		err = writer.WriteField("definition", string(definitionJSON))
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "build_form_failed", http.StatusInternalServerError)
+	}
+
+	region, key := getRegionAndKey(meta)
+	endpoint, err := getEndpoint(meta, region, "stt")
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "invalid_channel_key", http.StatusInternalServerError)
+	}
+	url := fmt.Sprintf("%s/speechtotext/transcriptions:transcribe?api-version=%s", endpoint, transcriptionAPIVersion)
+	req, err := http.NewRequest(http.MethodPost, url, &body)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Ocp-Apim-Subscription-Key", key)
+	responseBody, err := doRequest(req)
+	if err != nil {
+		return nil, adaptor.UpstreamErrorWrapper(err, "azure_speech_failed")
+	}
+	var azureResponse TranscriptionResponse
+	if err = json.Unmarshal(responseBody, &azureResponse); err != nil {
+		return nil, openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+
+	result := &model.TranscriptionResult{
+		Language: request.Language,
+		Duration: float64(azureResponse.DurationMilliseconds) / 1000,
+	}
+	var texts []string
+	for _, phrase := range azureResponse.CombinedPhrases {
+		texts = append(texts, phrase.Text)
+	}
+	result.Text = strings.Join(texts, " ")
+	for _, phrase := range azureResponse.Phrases {
+		result.Segments = append(result.Segments, model.TranscriptionSegment{
+			Start: float64(phrase.OffsetMilliseconds) / 1000,
+			End:   float64(phrase.OffsetMilliseconds+phrase.DurationMilliseconds) / 1000,
+			Text:  phrase.Text,
+		})
+		if result.Language == "" {
+			result.Language = phrase.Locale
+		}
+	}
+	return result, nil
+}
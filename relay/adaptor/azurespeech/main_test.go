@@ -0,0 +1,95 @@
+package azurespeech
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func newMockServer(t *testing.T) *httptest.Server {
+	client.Init()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Ocp-Apim-Subscription-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/cognitiveservices/v1":
+			body, _ := io.ReadAll(r.Body)
+			assert.Equal(t, "audio-24khz-48kbitrate-mono-mp3", r.Header.Get("X-Microsoft-OutputFormat"))
+			assert.Equal(t, `<speak version="1.0" xmlns="http://www.w3.org/2001/10/synthesis" xml:lang="en-US"><voice name="en-US-AvaMultilingualNeural"><prosody rate="+50%">a &lt; b</prosody></voice></speak>`, string(body))
+			_, _ = w.Write([]byte("mp3 data"))
+		case "/speechtotext/transcriptions:transcribe":
+			require.NoError(t, r.ParseMultipartForm(1<<20))
+			assert.Equal(t, `{"locales":["zh-CN"]}`, r.FormValue("definition"))
+			file, header, err := r.FormFile("audio")
+			require.NoError(t, err)
+			data, _ := io.ReadAll(file)
+			assert.Equal(t, "speech.wav", header.Filename)
+			assert.Equal(t, "wav data", string(data))
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"durationMilliseconds": 2500,
+				"combinedPhrases":      []map[string]any{{"text": "你好。世界。"}},
+				"phrases": []map[string]any{
+					{"offsetMilliseconds": 100, "durationMilliseconds": 900, "text": "你好。", "locale": "zh-CN"},
+					{"offsetMilliseconds": 1200, "durationMilliseconds": 1300, "text": "世界。", "locale": "zh-CN"},
+				},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestCreateSpeech(t *testing.T) {
+	server := newMockServer(t)
+	defer server.Close()
+	a := &Adaptor{}
+	result, err := a.CreateSpeech(&meta.Meta{BaseURL: server.URL, APIKey: "eastus|secret"},
+		&model.SpeechRequest{Model: "azure-tts", Input: "a < b", Voice: "alloy", Speed: 1.5})
+	require.Nil(t, err)
+	assert.Equal(t, "audio/mpeg", result.ContentType)
+	assert.Equal(t, "mp3 data", string(result.Audio))
+
+	_, err = a.CreateSpeech(&meta.Meta{BaseURL: server.URL, APIKey: "eastus|secret"},
+		&model.SpeechRequest{Model: "azure-tts", Input: "hi", Voice: "alloy", ResponseFormat: "flac"})
+	require.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode)
+}
+
+func TestCreateTranscription(t *testing.T) {
+	server := newMockServer(t)
+	defer server.Close()
+	a := &Adaptor{}
+	result, err := a.CreateTranscription(&meta.Meta{BaseURL: server.URL, APIKey: "eastus|secret"},
+		&model.TranscriptionRequest{Model: "azure-stt", Audio: []byte("wav data"), Filename: "speech.wav", Language: "zh-CN"})
+	require.Nil(t, err)
+	assert.Equal(t, "你好。世界。", result.Text)
+	assert.Equal(t, 2.5, result.Duration)
+	assert.Equal(t, []model.TranscriptionSegment{{Start: 0.1, End: 1, Text: "你好。"}, {Start: 1.2, End: 2.5, Text: "世界。"}}, result.Segments)
+
+	_, err = a.CreateTranscription(&meta.Meta{BaseURL: server.URL, APIKey: "eastus|wrong"},
+		&model.TranscriptionRequest{Model: "azure-stt", Audio: []byte("wav data"), Filename: "speech.wav"})
+	require.NotNil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, err.StatusCode)
+}
+
+func TestGetRegionAndKey(t *testing.T) {
+	region, key := getRegionAndKey(&meta.Meta{APIKey: "eastus|secret"})
+	assert.Equal(t, "eastus", region)
+	assert.Equal(t, "secret", key)
+	endpoint, err := getEndpoint(&meta.Meta{}, region, "tts")
+	require.NoError(t, err)
+	assert.Equal(t, "https://eastus.tts.speech.microsoft.com", endpoint)
+	_, err = getEndpoint(&meta.Meta{}, "", "stt")
+	assert.Error(t, err)
+}
@@ -0,0 +1,20 @@
+package azurespeech
+
+type TranscriptionDefinition struct {
+	Locales []string `json:"locales,omitempty"`
+}
+
+type Phrase struct {
+	OffsetMilliseconds   int64  `json:"offsetMilliseconds"`
+	DurationMilliseconds int64  `json:"durationMilliseconds"`
+	Text                 string `json:"text"`
+	Locale               string `json:"locale,omitempty"`
+}
+
+type TranscriptionResponse struct {
+	DurationMilliseconds int64 `json:"durationMilliseconds"`
+	CombinedPhrases      []struct {
+		Text string `json:"text"`
+	} `json:"combinedPhrases"`
+	Phrases []Phrase `json:"phrases"`
+}
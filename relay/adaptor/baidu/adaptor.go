@@ -113,6 +113,9 @@ func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error)
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
+	if request.Image != nil {
+		return nil, fmt.Errorf("image edits and variations are %w by baidu", adaptor.ErrUnsupportedRequest)
+	}
 	return request, nil
 }
 
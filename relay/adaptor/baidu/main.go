@@ -44,6 +44,8 @@ type ChatRequest struct {
 	EnableCitation  bool      `json:"enable_citation,omitempty"`
 	MaxOutputTokens int       `json:"max_output_tokens,omitempty"`
 	UserId          string    `json:"user_id,omitempty"`
+	// ResponseFormat is "text" or "json_object"
+	ResponseFormat string `json:"response_format,omitempty"`
 }
 
 type Error struct {
@@ -65,6 +67,9 @@ func ConvertRequest(request model.GeneralOpenAIRequest) *ChatRequest {
 		MaxOutputTokens: request.MaxTokens,
 		UserId:          request.User,
 	}
+	if request.ResponseFormat != nil && request.ResponseFormat.Type == "json_object" {
+		baiduRequest.ResponseFormat = "json_object"
+	}
 	for _, message := range request.Messages {
 		if message.Role == "system" {
 			baiduRequest.System = message.StringContent()
@@ -46,6 +46,17 @@ func ConvertRequest(textRequest model.GeneralOpenAIRequest) *Request {
 		PresencePenalty:  textRequest.PresencePenalty,
 		Seed:             int(textRequest.Seed),
 	}
+	if textRequest.ResponseFormat != nil {
+		switch textRequest.ResponseFormat.Type {
+		case "json_object":
+			cohereRequest.ResponseFormat = &ResponseFormat{Type: "json_object"}
+		case "json_schema":
+			cohereRequest.ResponseFormat = &ResponseFormat{Type: "json_object"}
+			if textRequest.ResponseFormat.JsonSchema != nil {
+				cohereRequest.ResponseFormat.Schema = textRequest.ResponseFormat.JsonSchema.Schema
+			}
+		}
+	}
 	if cohereRequest.Model == "" {
 		cohereRequest.Model = "command-r"
 	}
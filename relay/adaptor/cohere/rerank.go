@@ -0,0 +1,52 @@
+package cohere
+
+import (
+	"encoding/json"
+
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://docs.cohere.com/v1/reference/rerank
+
+type RerankRequest struct {
+	Model           string   `json:"model"`
+	Query           string   `json:"query"`
+	Documents       []string `json:"documents"`
+	TopN            int      `json:"top_n,omitempty"`
+	ReturnDocuments bool     `json:"return_documents"`
+}
+
+type RerankResponse struct {
+	Id      string               `json:"id"`
+	Results []model.RerankResult `json:"results"`
+	Meta    struct {
+		BilledUnits struct {
+			SearchUnits int `json:"search_units"`
+		} `json:"billed_units"`
+	} `json:"meta"`
+}
+
+func (a *Adaptor) ConvertRerankRequest(meta *meta.Meta, request *model.RerankRequest) (any, error) {
+	return &RerankRequest{
+		Model:           request.Model,
+		Query:           request.Query,
+		Documents:       request.GetDocuments(),
+		TopN:            request.TopN,
+		ReturnDocuments: request.IsReturnDocuments(),
+	}, nil
+}
+
+func (a *Adaptor) ConvertRerankResponse(meta *meta.Meta, responseBody []byte) (*model.RerankResponse, error) {
+	var rerankResponse RerankResponse
+	if err := json.Unmarshal(responseBody, &rerankResponse); err != nil {
+		return nil, err
+	}
+	return &model.RerankResponse{
+		Id:      rerankResponse.Id,
+		Results: rerankResponse.Results,
+		Usage: model.RerankUsage{
+			SearchUnits: rerankResponse.Meta.BilledUnits.SearchUnits,
+		},
+	}, nil
+}
@@ -0,0 +1,31 @@
+package cohere
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestConvertRerankRequest(t *testing.T) {
+	converted, err := (&Adaptor{}).ConvertRerankRequest(&meta.Meta{}, &model.RerankRequest{
+		Model:     "rerank-v3.5",
+		Query:     "q",
+		Documents: []any{"a", map[string]any{"text": "b"}},
+		TopN:      1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &RerankRequest{Model: "rerank-v3.5", Query: "q", Documents: []string{"a", "b"}, TopN: 1}, converted)
+}
+
+func TestConvertRerankResponse(t *testing.T) {
+	response, err := (&Adaptor{}).ConvertRerankResponse(&meta.Meta{},
+		[]byte(`{"id":"r1","results":[{"index":1,"relevance_score":0.9}],"meta":{"billed_units":{"search_units":1}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, "r1", response.Id)
+	assert.Equal(t, []model.RerankResult{{Index: 1, RelevanceScore: 0.9}}, response.Results)
+	assert.Equal(t, 1, response.Usage.SearchUnits)
+}
@@ -10,6 +10,10 @@ import (
 	"net/http"
 )
 
+// ErrUnsupportedRequest is wrapped by the adaptors when their channel can't serve the kind of request,
+// it is answered with a bad request since the client has to change it
+var ErrUnsupportedRequest = errors.New("not supported")
+
 func SetupCommonRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) {
 	req.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
 	req.Header.Set("Accept", c.Request.Header.Get("Accept"))
@@ -0,0 +1,129 @@
+package dify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+type Adaptor struct {
+	meta *meta.Meta
+	// conversationKey is where the conversation of the request is kept, empty for the workflows
+	conversationKey string
+	// conversationId is the kept conversation continued by the request
+	conversationId string
+	// historyQuery is the query sent when the kept conversation is gone
+	historyQuery string
+}
+
+func (a *Adaptor) Init(meta *meta.Meta) {
+	a.meta = meta
+}
+
+func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
+	if meta.Config.DifyAppType == AppTypeWorkflow {
+		return fmt.Sprintf("%s/v1/workflows/run", meta.BaseURL), nil
+	}
+	return fmt.Sprintf("%s/v1/chat-messages", meta.BaseURL), nil
+}
+
+func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) error {
+	adaptor.SetupCommonRequestHeader(c, req, meta)
+	req.Header.Set("Authorization", "Bearer "+meta.APIKey)
+	return nil
+}
+
+func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.GeneralOpenAIRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	appType := a.meta.Config.DifyAppType
+	difyRequest := ConvertRequest(*request, appType, a.meta.Config.DifyInputs)
+	difyRequest.User = getUser(a.meta.TokenId, request.User)
+	if appType != AppTypeWorkflow {
+		a.conversationKey = getConversationKey(a.meta.ChannelId, difyRequest.User, getLastTurn(request.Messages))
+		// a new chat starts a new conversation, the others continue the one kept for the same history
+		if previous := getPreviousTurn(request.Messages); previous != nil {
+			difyRequest.ConversationId = getConversationId(getConversationKey(a.meta.ChannelId, difyRequest.User, previous))
+		}
+		a.conversationId = difyRequest.ConversationId
+		if a.conversationId != "" {
+			a.historyQuery = difyRequest.Query
+			difyRequest.Query, _ = getQuery(request.Messages)
+		}
+	}
+	return difyRequest, nil
+}
+
+func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	return request, nil
+}
+
+func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Reader) (*http.Response, error) {
+	if a.conversationId == "" {
+		return adaptor.DoRequestHelper(a, c, meta, requestBody)
+	}
+	requestBytes, err := io.ReadAll(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("read request body failed: %w", err)
+	}
+	resp, err := adaptor.DoRequestHelper(a, c, meta, bytes.NewReader(requestBytes))
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		return resp, err
+	}
+	responseBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("read response body failed: %w", err)
+	}
+	if !isConversationNotFound(responseBody) {
+		resp.Body = io.NopCloser(bytes.NewReader(responseBody))
+		return resp, nil
+	}
+	// the kept conversation was deleted on dify, the request starts a new one with the whole history
+	var request map[string]any
+	if err = json.Unmarshal(requestBytes, &request); err != nil {
+		return nil, fmt.Errorf("unmarshal request body failed: %w", err)
+	}
+	delete(request, "conversation_id")
+	request["query"] = a.historyQuery
+	requestBytes, err = json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request body failed: %w", err)
+	}
+	a.conversationId = ""
+	return adaptor.DoRequestHelper(a, c, meta, bytes.NewReader(requestBytes))
+}
+
+func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	var conversationId string
+	if meta.IsStream {
+		err, conversationId, usage = StreamHandler(c, resp, meta)
+	} else {
+		err, conversationId, usage = Handler(c, resp, meta)
+	}
+	if a.conversationKey != "" {
+		setConversationId(a.conversationKey, conversationId)
+	}
+	return
+}
+
+func (a *Adaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *Adaptor) GetChannelName() string {
+	return "dify"
+}
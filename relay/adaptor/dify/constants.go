@@ -0,0 +1,13 @@
+package dify
+
+// the app of a channel is chosen by its key, any model name is relayed to it
+var ModelList = []string{}
+
+const (
+	// AppTypeChat covers the chatbot, agent and chatflow apps, it is the default
+	AppTypeChat     = "chat"
+	AppTypeWorkflow = "workflow"
+)
+
+// QueryInput is the input the workflows receive the last user message in
+const QueryInput = "query"
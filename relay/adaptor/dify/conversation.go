@@ -0,0 +1,118 @@
+package dify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/patrickmn/go-cache"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+const conversationKeyPrefix = "dify_conversation:"
+
+// ConversationTTL is how long an idle conversation is continued
+var ConversationTTL = 24 * time.Hour
+
+var conversations = cache.New(ConversationTTL, time.Hour)
+
+// getUser is the user sent to dify, the users of the requests are scoped to their token
+func getUser(tokenId int, user string) string {
+	if user == "" {
+		return fmt.Sprintf("token-%d", tokenId)
+	}
+	return fmt.Sprintf("token-%d-%s", tokenId, user)
+}
+
+// getConversationKey identifies a conversation by the channel, the user and the messages up to its last user turn,
+// the clients of the openai api send the whole history instead of an id
+func getConversationKey(channelId int, user string, messages []model.Message) string {
+	hash := sha256.New()
+	for _, message := range messages {
+		hash.Write([]byte(message.Role))
+		hash.Write([]byte{0})
+		hash.Write([]byte(message.StringContent()))
+		hash.Write([]byte{0})
+	}
+	return fmt.Sprintf("%s%d:%s:%s", conversationKeyPrefix, channelId, user, hex.EncodeToString(hash.Sum(nil)[:8]))
+}
+
+// getLastTurn is the messages up to the last user message, they are what dify answers
+func getLastTurn(messages []model.Message) []model.Message {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return messages[:i+1]
+		}
+	}
+	return messages
+}
+
+// getPreviousTurn is the messages up to the user message answered before the last one, that is the turn kept
+// by the request which got the answer. It is nil for a new chat, where dify answered nothing yet.
+func getPreviousTurn(messages []model.Message) []model.Message {
+	history := getLastTurn(messages)
+	if len(history) == 0 {
+		return nil
+	}
+	history = history[:len(history)-1]
+	answered := false
+	for i := len(history) - 1; i >= 0; i-- {
+		switch history[i].Role {
+		case "user":
+			if answered {
+				return history[:i+1]
+			}
+			return nil
+		case "assistant":
+			answered = true
+		}
+	}
+	return nil
+}
+
+// isConversationNotFound tells whether dify failed the request because the conversation doesn't exist anymore
+func isConversationNotFound(responseBody []byte) bool {
+	var errorResponse ErrorResponse
+	if err := json.Unmarshal(responseBody, &errorResponse); err != nil {
+		return false
+	}
+	return errorResponse.Code == "not_found" && strings.Contains(strings.ToLower(errorResponse.Message), "conversation")
+}
+
+func getConversationId(key string) string {
+	if !common.RedisEnabled {
+		id, ok := conversations.Get(key)
+		if !ok {
+			return ""
+		}
+		return id.(string)
+	}
+	id, err := common.RedisGet(key)
+	if err != nil {
+		if err != redis.Nil {
+			logger.SysError("failed to get dify conversation: " + err.Error())
+		}
+		return ""
+	}
+	return id
+}
+
+func setConversationId(key string, id string) {
+	if id == "" {
+		return
+	}
+	if !common.RedisEnabled {
+		conversations.Set(key, id, ConversationTTL)
+		return
+	}
+	if err := common.RedisSet(key, id, ConversationTTL); err != nil {
+		logger.SysError("failed to save dify conversation: " + err.Error())
+	}
+}
@@ -0,0 +1,295 @@
+package dify
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/common/render"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/constant"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// getQuery is the last user message, its images are given to dify by their url
+func getQuery(messages []model.Message) (string, []File) {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != "user" {
+			continue
+		}
+		var files []File
+		for _, part := range messages[i].ParseContent() {
+			// the inline images would have to be uploaded first, they are left out
+			if part.Type == model.ContentTypeImageURL && strings.HasPrefix(part.ImageURL.Url, "http") {
+				files = append(files, File{Type: "image", TransferMethod: "remote_url", URL: part.ImageURL.Url})
+			}
+		}
+		return messages[i].StringContent(), files
+	}
+	return "", nil
+}
+
+// getHistoryQuery is the query of a request continuing no conversation, dify knows nothing of the messages
+// before the last user one so the system prompt and the earlier turns are given as a transcript before it
+func getHistoryQuery(messages []model.Message) string {
+	history := getLastTurn(messages)
+	if len(history) == 1 {
+		return history[0].StringContent()
+	}
+	var builder strings.Builder
+	for i, message := range history {
+		if i > 0 {
+			builder.WriteString("\n\n")
+		}
+		builder.WriteString(message.Role)
+		builder.WriteString(": ")
+		builder.WriteString(message.StringContent())
+	}
+	return builder.String()
+}
+
+// ConvertRequest sends the whole history as the query, the adaptor sends only the last user message
+// when the earlier ones are known to dify by the conversation.
+// The inputs of the request are merged over the default ones of the channel.
+func ConvertRequest(textRequest model.GeneralOpenAIRequest, appType string, inputs map[string]any) *Request {
+	difyRequest := Request{
+		Inputs:       make(map[string]any, len(inputs)+len(textRequest.Inputs)),
+		ResponseMode: "blocking",
+		User:         textRequest.User,
+	}
+	if textRequest.Stream {
+		difyRequest.ResponseMode = "streaming"
+	}
+	for name, value := range inputs {
+		difyRequest.Inputs[name] = value
+	}
+	for name, value := range textRequest.Inputs {
+		difyRequest.Inputs[name] = value
+	}
+	_, files := getQuery(textRequest.Messages)
+	query := getHistoryQuery(textRequest.Messages)
+	if appType == AppTypeWorkflow {
+		// the workflows take their files as inputs too
+		if _, ok := difyRequest.Inputs[QueryInput]; !ok {
+			difyRequest.Inputs[QueryInput] = query
+		}
+		return &difyRequest
+	}
+	difyRequest.Query = query
+	difyRequest.Files = files
+	return &difyRequest
+}
+
+// getWorkflowText is the text output of a workflow, or all the outputs as json when there is none
+func getWorkflowText(outputs map[string]any) string {
+	if text, ok := outputs["text"].(string); ok {
+		return text
+	}
+	if len(outputs) == 1 {
+		for _, output := range outputs {
+			if text, ok := output.(string); ok {
+				return text
+			}
+		}
+	}
+	if len(outputs) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(outputs)
+	return string(data)
+}
+
+// getUsage uses the usage reported by dify, the workflows only report their total tokens
+// so the output is counted and the rest taken as the prompt
+func getUsage(difyUsage *Usage, totalTokens int, responseText string, meta *meta.Meta) *model.Usage {
+	if difyUsage != nil && difyUsage.TotalTokens > 0 {
+		return &model.Usage{
+			PromptTokens:     difyUsage.PromptTokens,
+			CompletionTokens: difyUsage.CompletionTokens,
+			TotalTokens:      difyUsage.TotalTokens,
+		}
+	}
+	usage := openai.ResponseText2Usage(responseText, meta.ActualModelName, meta.PromptTokens)
+	if totalTokens > usage.CompletionTokens {
+		usage.PromptTokens = totalTokens - usage.CompletionTokens
+		usage.TotalTokens = totalTokens
+	}
+	return usage
+}
+
+func textResponse(id string, modelName string, text string) *openai.TextResponse {
+	return &openai.TextResponse{
+		Id:      fmt.Sprintf("chatcmpl-%s", id),
+		Model:   modelName,
+		Object:  "chat.completion",
+		Created: helper.GetTimestamp(),
+		Choices: []openai.TextResponseChoice{{
+			Index: 0,
+			Message: model.Message{
+				Role:    "assistant",
+				Content: text,
+			},
+			FinishReason: constant.StopFinishReason,
+		}},
+	}
+}
+
+func workflowError(data *WorkflowData) *model.ErrorWithStatusCode {
+	return &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: data.Error,
+			Type:    "dify_error",
+			Code:    "workflow_" + data.Status,
+		},
+		StatusCode: http.StatusInternalServerError,
+	}
+}
+
+// Handler relays a blocking response, it returns the id of the conversation to continue
+func Handler(c *gin.Context, resp *http.Response, meta *meta.Meta) (*model.ErrorWithStatusCode, string, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), "", nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), "", nil
+	}
+	var fullTextResponse *openai.TextResponse
+	var conversationId string
+	var usage *model.Usage
+	if meta.Config.DifyAppType == AppTypeWorkflow {
+		var workflowResponse WorkflowResponse
+		if err = json.Unmarshal(responseBody, &workflowResponse); err != nil {
+			return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), "", nil
+		}
+		if workflowResponse.Data.Status != "succeeded" {
+			return workflowError(&workflowResponse.Data), "", nil
+		}
+		text := getWorkflowText(workflowResponse.Data.Outputs)
+		fullTextResponse = textResponse(workflowResponse.WorkflowRunId, meta.ActualModelName, text)
+		usage = getUsage(nil, workflowResponse.Data.TotalTokens, text, meta)
+	} else {
+		var chatResponse ChatResponse
+		if err = json.Unmarshal(responseBody, &chatResponse); err != nil {
+			return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), "", nil
+		}
+		conversationId = chatResponse.ConversationId
+		fullTextResponse = textResponse(chatResponse.MessageId, meta.ActualModelName, chatResponse.Answer)
+		usage = getUsage(chatResponse.Metadata.Usage, 0, chatResponse.Answer, meta)
+	}
+	fullTextResponse.Usage = *usage
+	jsonResponse, err := json.Marshal(fullTextResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), "", nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, conversationId, usage
+}
+
+// StreamHandler relays the events of the chat-messages and the workflows apis,
+// it returns the id of the conversation to continue
+func StreamHandler(c *gin.Context, resp *http.Response, meta *meta.Meta) (*model.ErrorWithStatusCode, string, *model.Usage) {
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	common.SetEventStreamHeaders(c)
+
+	response := openai.ChatCompletionsStreamResponse{
+		Id:      "chatcmpl-" + random.GetUUID(),
+		Object:  "chat.completion.chunk",
+		Created: helper.GetTimestamp(),
+		Model:   meta.ActualModelName,
+	}
+	send := func(content string, finishReason *string) {
+		chunk := response
+		chunk.Choices = []openai.ChatCompletionsStreamResponseChoice{{
+			Delta:        model.Message{Role: "assistant", Content: content},
+			FinishReason: finishReason,
+		}}
+		if err := render.ObjectData(c, chunk); err != nil {
+			logger.SysError(err.Error())
+		}
+	}
+
+	var conversationId string
+	var responseText string
+	var difyUsage *Usage
+	totalTokens := 0
+	for scanner.Scan() {
+		data := scanner.Text()
+		if !strings.HasPrefix(data, "data:") {
+			continue
+		}
+		data = strings.TrimSpace(strings.TrimPrefix(data, "data:"))
+		var event StreamResponse
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			logger.SysError("error unmarshalling stream response: " + err.Error())
+			continue
+		}
+		if event.ConversationId != "" {
+			conversationId = event.ConversationId
+		}
+		switch event.Event {
+		case "message", "agent_message":
+			if event.Answer != "" {
+				responseText += event.Answer
+				send(event.Answer, nil)
+			}
+		case "text_chunk":
+			if event.Data != nil && event.Data.Text != "" {
+				responseText += event.Data.Text
+				send(event.Data.Text, nil)
+			}
+		case "message_end":
+			if event.Metadata != nil {
+				difyUsage = event.Metadata.Usage
+			}
+		case "workflow_finished":
+			if event.Data == nil {
+				continue
+			}
+			if event.Data.Status != "succeeded" {
+				return workflowError(event.Data), conversationId, getUsage(nil, event.Data.TotalTokens, responseText, meta)
+			}
+			totalTokens = event.Data.TotalTokens
+			// the workflows without an answer node stream nothing, their outputs come at the end
+			if responseText == "" && meta.Config.DifyAppType == AppTypeWorkflow {
+				if text := getWorkflowText(event.Data.Outputs); text != "" {
+					responseText = text
+					send(text, nil)
+				}
+			}
+		case "error":
+			if event.Status == 0 {
+				event.Status = http.StatusInternalServerError
+			}
+			return &model.ErrorWithStatusCode{
+				Error: model.Error{
+					Message: event.Message,
+					Type:    "dify_error",
+					Code:    event.Code,
+				},
+				StatusCode: event.Status,
+			}, conversationId, getUsage(nil, 0, responseText, meta)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logger.SysError("error reading stream: " + err.Error())
+	}
+	send("", &constant.StopFinishReason)
+	render.Done(c)
+	return nil, conversationId, getUsage(difyUsage, totalTokens, responseText, meta)
+}
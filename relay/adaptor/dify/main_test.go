@@ -0,0 +1,210 @@
+package dify
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func parseRequest(t *testing.T, body string) *model.GeneralOpenAIRequest {
+	var request model.GeneralOpenAIRequest
+	require.NoError(t, json.Unmarshal([]byte(body), &request))
+	return &request
+}
+
+func newContext() (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	return c, w
+}
+
+func newResponse(body string) *http.Response {
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}
+}
+
+func TestConvertRequest(t *testing.T) {
+	request := parseRequest(t, `{
+		"model": "support-bot",
+		"stream": true,
+		"inputs": {"language": "en"},
+		"messages": [
+			{"role": "system", "content": "Be nice."},
+			{"role": "user", "content": [
+				{"type": "text", "text": "What is on this picture?"},
+				{"type": "image_url", "image_url": {"url": "https://example.com/cat.png"}},
+				{"type": "image_url", "image_url": {"url": "data:image/png;base64,iVBORw0KGgo="}}
+			]}
+		]
+	}`)
+	difyRequest := ConvertRequest(*request, AppTypeChat, map[string]any{"language": "zh", "tone": "formal"})
+	// no conversation knows the system prompt yet
+	assert.Equal(t, "system: Be nice.\n\nuser: What is on this picture?", difyRequest.Query)
+	assert.Equal(t, "streaming", difyRequest.ResponseMode)
+	assert.Equal(t, map[string]any{"language": "en", "tone": "formal"}, difyRequest.Inputs)
+	assert.Equal(t, []File{{Type: "image", TransferMethod: "remote_url", URL: "https://example.com/cat.png"}}, difyRequest.Files)
+
+	difyRequest = ConvertRequest(*request, AppTypeWorkflow, nil)
+	assert.Empty(t, difyRequest.Query)
+	assert.Nil(t, difyRequest.Files)
+	assert.Equal(t, "system: Be nice.\n\nuser: What is on this picture?", difyRequest.Inputs[QueryInput])
+}
+
+func TestConversation(t *testing.T) {
+	common.RedisEnabled = false
+	relayMeta := &meta.Meta{ChannelId: 7, TokenId: 3, ActualModelName: "support-bot", PromptTokens: 5}
+	chat := func(messages string, expectedConversationId string, expectedQuery string, answer string) {
+		c, w := newContext()
+		adaptor := &Adaptor{}
+		adaptor.Init(relayMeta)
+		converted, err := adaptor.ConvertRequest(c, 0, parseRequest(t, `{"model": "support-bot", "user": "alice", "messages": `+messages+`}`))
+		require.NoError(t, err)
+		difyRequest := converted.(*Request)
+		assert.Equal(t, "token-3-alice", difyRequest.User)
+		assert.Equal(t, expectedConversationId, difyRequest.ConversationId)
+		assert.Equal(t, expectedQuery, difyRequest.Query)
+
+		usage, errWithStatus := adaptor.DoResponse(c, newResponse(`{
+			"message_id": "msg-1", "conversation_id": "conv-1", "answer": "`+answer+`",
+			"metadata": {"usage": {"prompt_tokens": 30, "completion_tokens": 4, "total_tokens": 34}}
+		}`), relayMeta)
+		require.Nil(t, errWithStatus)
+		assert.Equal(t, 30, usage.PromptTokens)
+		assert.Contains(t, w.Body.String(), `"content":"`+answer+`"`)
+	}
+	chat(`[{"role": "user", "content": "Hi"}]`, "", "Hi", "Hello!")
+	chat(`[{"role": "user", "content": "Hi"}, {"role": "assistant", "content": "Hello!"}, {"role": "user", "content": "How are you?"}]`, "conv-1", "How are you?", "Fine.")
+	chat(`[{"role": "user", "content": "Hi"}, {"role": "assistant", "content": "Hello!"}, {"role": "user", "content": "How are you?"},
+		{"role": "assistant", "content": "Fine."}, {"role": "user", "content": "Bye"}]`, "conv-1", "Bye", "Bye!")
+	// another history is another conversation, even with the same first message, it is given whole to dify
+	chat(`[{"role": "user", "content": "Hey"}, {"role": "assistant", "content": "Hello!"}, {"role": "user", "content": "How are you?"}]`, "",
+		"user: Hey\n\nassistant: Hello!\n\nuser: How are you?", "Fine.")
+	chat(`[{"role": "user", "content": "Hi"}, {"role": "assistant", "content": "Hello!"}, {"role": "user", "content": "What time is it?"},
+		{"role": "assistant", "content": "Noon."}, {"role": "user", "content": "Thanks"}]`, "",
+		"user: Hi\n\nassistant: Hello!\n\nuser: What time is it?\n\nassistant: Noon.\n\nuser: Thanks", "You are welcome.")
+}
+
+func TestConversationNotFound(t *testing.T) {
+	common.RedisEnabled = false
+	client.Init()
+	var conversationIds, queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request Request
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		conversationIds = append(conversationIds, request.ConversationId)
+		queries = append(queries, request.Query)
+		if request.ConversationId != "" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code": "not_found", "message": "Conversation Not Exists.", "status": 404}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"message_id": "msg-2", "conversation_id": "conv-new", "answer": "Hello again!",
+			"metadata": {"usage": {"prompt_tokens": 20, "completion_tokens": 3, "total_tokens": 23}}}`))
+	}))
+	defer server.Close()
+
+	relayMeta := &meta.Meta{ChannelId: 8, TokenId: 3, ActualModelName: "support-bot", BaseURL: server.URL, APIKey: "app-key"}
+	first := getConversationKey(relayMeta.ChannelId, "token-3", []model.Message{{Role: "user", Content: "Hi"}})
+	setConversationId(first, "conv-deleted")
+
+	c, w := newContext()
+	adaptor := &Adaptor{}
+	adaptor.Init(relayMeta)
+	converted, err := adaptor.ConvertRequest(c, 0, parseRequest(t, `{"model": "support-bot", "messages": [
+		{"role": "user", "content": "Hi"}, {"role": "assistant", "content": "Hello!"}, {"role": "user", "content": "Are you there?"}]}`))
+	require.NoError(t, err)
+	requestBody, err := json.Marshal(converted)
+	require.NoError(t, err)
+	resp, err := adaptor.DoRequest(c, relayMeta, bytes.NewReader(requestBody))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_, errWithStatus := adaptor.DoResponse(c, resp, relayMeta)
+	require.Nil(t, errWithStatus)
+	assert.Equal(t, []string{"conv-deleted", ""}, conversationIds)
+	// the new conversation is given the history the deleted one knew
+	assert.Equal(t, []string{"Are you there?", "user: Hi\n\nassistant: Hello!\n\nuser: Are you there?"}, queries)
+	assert.Contains(t, w.Body.String(), `"content":"Hello again!"`)
+
+	// the next turn continues the new conversation
+	previous := getConversationKey(relayMeta.ChannelId, "token-3", []model.Message{
+		{Role: "user", Content: "Hi"}, {Role: "assistant", Content: "Hello!"}, {Role: "user", Content: "Are you there?"},
+	})
+	assert.Equal(t, "conv-new", getConversationId(previous))
+}
+
+func TestStreamHandler(t *testing.T) {
+	config.ApproximateTokenEnabled = true
+	events := []string{
+		`event: ping`,
+		`data: {"event": "workflow_started", "conversation_id": "conv-2", "data": {"id": "run-1"}}`,
+		`data: {"event": "message", "conversation_id": "conv-2", "message_id": "msg-2", "answer": "Hel"}`,
+		`data: {"event": "agent_message", "conversation_id": "conv-2", "message_id": "msg-2", "answer": "lo"}`,
+		`data: {"event": "message_end", "conversation_id": "conv-2", "metadata": {"usage": {"prompt_tokens": 12, "completion_tokens": 2, "total_tokens": 14}}}`,
+	}
+	c, w := newContext()
+	relayMeta := &meta.Meta{ActualModelName: "support-bot", IsStream: true}
+	errWithStatus, conversationId, usage := StreamHandler(c, newResponse(strings.Join(events, "\n\n")), relayMeta)
+	require.Nil(t, errWithStatus)
+	assert.Equal(t, "conv-2", conversationId)
+	assert.Equal(t, &model.Usage{PromptTokens: 12, CompletionTokens: 2, TotalTokens: 14}, usage)
+	assert.Contains(t, w.Body.String(), `"content":"Hel"`)
+	assert.Contains(t, w.Body.String(), `"content":"lo"`)
+	assert.Contains(t, w.Body.String(), `"finish_reason":"stop"`)
+	assert.True(t, strings.HasSuffix(w.Body.String(), "data: [DONE]\n\n"))
+
+	c, _ = newContext()
+	errWithStatus, _, _ = StreamHandler(c, newResponse(`data: {"event": "error", "status": 429, "code": "rate_limit", "message": "too many requests"}`), relayMeta)
+	require.NotNil(t, errWithStatus)
+	assert.Equal(t, http.StatusTooManyRequests, errWithStatus.StatusCode)
+	assert.Equal(t, "too many requests", errWithStatus.Message)
+}
+
+func TestWorkflow(t *testing.T) {
+	config.ApproximateTokenEnabled = true
+	relayMeta := &meta.Meta{
+		ActualModelName: "summarizer",
+		PromptTokens:    10,
+		Config:          dbmodel.ChannelConfig{DifyAppType: AppTypeWorkflow},
+	}
+	c, w := newContext()
+	errWithStatus, conversationId, usage := Handler(c, newResponse(`{
+		"workflow_run_id": "run-2", "task_id": "task-2",
+		"data": {"id": "run-2", "status": "succeeded", "outputs": {"summary": "A short text."}, "total_tokens": 120}
+	}`), relayMeta)
+	require.Nil(t, errWithStatus)
+	assert.Empty(t, conversationId)
+	assert.Equal(t, 120, usage.TotalTokens)
+	assert.Equal(t, 120, usage.PromptTokens+usage.CompletionTokens)
+	assert.Contains(t, w.Body.String(), `"content":"A short text."`)
+
+	relayMeta.IsStream = true
+	c, w = newContext()
+	events := `data: {"event": "workflow_started", "workflow_run_id": "run-3", "data": {"id": "run-3"}}
+
+data: {"event": "workflow_finished", "workflow_run_id": "run-3", "data": {"id": "run-3", "status": "succeeded", "outputs": {"a": 1, "b": "two"}, "total_tokens": 50}}`
+	errWithStatus, _, usage = StreamHandler(c, newResponse(events), relayMeta)
+	require.Nil(t, errWithStatus)
+	assert.Equal(t, 50, usage.TotalTokens)
+	assert.Contains(t, w.Body.String(), `"content":"{\"a\":1,\"b\":\"two\"}"`)
+
+	c, _ = newContext()
+	errWithStatus, _, _ = Handler(c, newResponse(`{"workflow_run_id": "run-4", "data": {"status": "failed", "error": "node failed"}}`), &meta.Meta{Config: dbmodel.ChannelConfig{DifyAppType: AppTypeWorkflow}})
+	require.NotNil(t, errWithStatus)
+	assert.Equal(t, "node failed", errWithStatus.Message)
+}
@@ -0,0 +1,77 @@
+package dify
+
+// https://docs.dify.ai/guides/application-publishing/developing-with-apis
+
+type File struct {
+	Type           string `json:"type"`
+	TransferMethod string `json:"transfer_method"`
+	URL            string `json:"url,omitempty"`
+}
+
+// Request is the request of the chat-messages api, the workflows take the same fields except for the query
+type Request struct {
+	Inputs         map[string]any `json:"inputs"`
+	Query          string         `json:"query,omitempty"`
+	ResponseMode   string         `json:"response_mode"`
+	ConversationId string         `json:"conversation_id,omitempty"`
+	User           string         `json:"user"`
+	Files          []File         `json:"files,omitempty"`
+}
+
+// ErrorResponse is the body of the failed requests
+type ErrorResponse struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type Metadata struct {
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// ChatResponse is the blocking response of the chat-messages api
+type ChatResponse struct {
+	MessageId      string   `json:"message_id"`
+	ConversationId string   `json:"conversation_id"`
+	Answer         string   `json:"answer"`
+	Metadata       Metadata `json:"metadata"`
+	CreatedAt      int64    `json:"created_at"`
+}
+
+type WorkflowData struct {
+	Id          string         `json:"id"`
+	Status      string         `json:"status"`
+	Outputs     map[string]any `json:"outputs"`
+	Error       string         `json:"error,omitempty"`
+	TotalTokens int            `json:"total_tokens"`
+	// Text is set on the text_chunk events
+	Text string `json:"text,omitempty"`
+}
+
+// WorkflowResponse is the blocking response of the workflows api
+type WorkflowResponse struct {
+	WorkflowRunId string       `json:"workflow_run_id"`
+	TaskId        string       `json:"task_id"`
+	Data          WorkflowData `json:"data"`
+}
+
+// StreamResponse is an event of the chat-messages and the workflows apis
+type StreamResponse struct {
+	Event          string        `json:"event"`
+	MessageId      string        `json:"message_id,omitempty"`
+	ConversationId string        `json:"conversation_id,omitempty"`
+	WorkflowRunId  string        `json:"workflow_run_id,omitempty"`
+	Answer         string        `json:"answer,omitempty"`
+	Metadata       *Metadata     `json:"metadata,omitempty"`
+	Data           *WorkflowData `json:"data,omitempty"`
+	// the fields of the error event
+	Status  int    `json:"status,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
@@ -10,4 +10,7 @@ var ModelList = []string{
 	"Doubao-lite-32k",
 	"Doubao-lite-4k",
 	"Doubao-embedding",
+	"doubao-seedance-1-0-pro-250528",
+	"doubao-seedance-1-0-lite-t2v-250428",
+	"doubao-seedance-1-0-lite-i2v-250428",
 }
@@ -0,0 +1,119 @@
+package doubao
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://www.volcengine.com/docs/82379/1520757
+
+type VideoContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url,omitempty"`
+}
+
+type VideoRequest struct {
+	Model   string         `json:"model"`
+	Content []VideoContent `json:"content"`
+}
+
+type VideoTaskResponse struct {
+	Id      string `json:"id"`
+	Status  string `json:"status"`
+	Content struct {
+		VideoURL string `json:"video_url"`
+	} `json:"content"`
+	// Duration is the seconds of the generated video
+	Duration float64 `json:"duration"`
+	Error    *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func SubmitTask(meta *meta.Meta, request *model.VideoRequest) (string, *model.ErrorWithStatusCode) {
+	// the parameters of seedance are written as commands after the prompt
+	prompt := request.Prompt
+	if request.Duration > 0 {
+		prompt += fmt.Sprintf(" --duration %d", request.Duration)
+	}
+	if request.Seed != nil {
+		prompt += fmt.Sprintf(" --seed %d", *request.Seed)
+	}
+	if request.Size != "" {
+		if ratio := sizeToRatio(request.Size); ratio != "" {
+			prompt += " --ratio " + ratio
+		}
+	}
+	doubaoRequest := VideoRequest{
+		Model:   meta.ActualModelName,
+		Content: []VideoContent{{Type: "text", Text: strings.TrimSpace(prompt)}},
+	}
+	if request.Image != "" {
+		image := VideoContent{Type: "image_url", ImageURL: &struct {
+			URL string `json:"url"`
+		}{URL: request.Image}}
+		doubaoRequest.Content = append(doubaoRequest.Content, image)
+	}
+	var doubaoResponse VideoTaskResponse
+	err := adaptor.DoJSONRequest(http.MethodPost, fmt.Sprintf("%s/api/v3/contents/generations/tasks", meta.BaseURL),
+		map[string]string{"Authorization": "Bearer " + meta.APIKey}, doubaoRequest, &doubaoResponse)
+	if err != nil {
+		return "", adaptor.UpstreamErrorWrapper(err, "doubao_submit_task_failed")
+	}
+	if doubaoResponse.Id == "" {
+		return "", adaptor.UpstreamErrorWrapper(errors.New("no task id in the response"), "doubao_submit_task_failed")
+	}
+	return doubaoResponse.Id, nil
+}
+
+func FetchTask(meta *meta.Meta, upstreamId string) (*model.TaskResult, error) {
+	var doubaoResponse VideoTaskResponse
+	err := adaptor.DoJSONRequest(http.MethodGet, fmt.Sprintf("%s/api/v3/contents/generations/tasks/%s", meta.BaseURL, upstreamId),
+		map[string]string{"Authorization": "Bearer " + meta.APIKey}, nil, &doubaoResponse)
+	if err != nil {
+		return nil, err
+	}
+	result := &model.TaskResult{}
+	switch doubaoResponse.Status {
+	case "queued":
+		result.Status = model.TaskStatusQueued
+	case "running":
+		result.Status = model.TaskStatusInProgress
+	case "succeeded":
+		result.Status = model.TaskStatusSucceeded
+		result.Outputs = []string{doubaoResponse.Content.VideoURL}
+		result.Duration = doubaoResponse.Duration
+	case "failed", "cancelled":
+		result.Status = model.TaskStatusFailed
+		result.Error = "task " + doubaoResponse.Status
+		if doubaoResponse.Error != nil {
+			result.Error = doubaoResponse.Error.Message
+		}
+	default:
+		return nil, fmt.Errorf("unknown task status %q", doubaoResponse.Status)
+	}
+	return result, nil
+}
+
+// sizeToRatio maps the sizes to the ratios seedance knows, the resolution is chosen by the model
+func sizeToRatio(size string) string {
+	switch size {
+	case "1280x720", "1920x1080", "864x480":
+		return "16:9"
+	case "720x1280", "1080x1920", "480x864":
+		return "9:16"
+	case "960x960", "1440x1440", "640x640":
+		return "1:1"
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package gemini
+
+import (
+	"encoding/base64"
+	"errors"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://ai.google.dev/gemini-api/docs/audio
+
+func (a *Adaptor) CreateSpeech(meta *meta.Meta, request *model.SpeechRequest) (*model.SpeechResult, *model.ErrorWithStatusCode) {
+	return nil, openai.ErrorWrapper(errors.New("speech is not supported by gemini channels"), "speech_not_supported", http.StatusBadRequest)
+}
+
+// CreateTranscription asks the model to write down the audio, gemini has no dedicated transcription api
+func (a *Adaptor) CreateTranscription(meta *meta.Meta, request *model.TranscriptionRequest) (*model.TranscriptionResult, *model.ErrorWithStatusCode) {
+	mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(request.Filename)))
+	if !strings.HasPrefix(mimeType, "audio/") {
+		mimeType = http.DetectContentType(request.Audio)
+	}
+	instruction := "Generate a transcript of the speech. Only output the transcript."
+	if request.Translate {
+		instruction = "Translate the speech into English. Only output the translation."
+	} else if request.Language != "" {
+		instruction += " The speech is in the language " + request.Language + "."
+	}
+	if request.Prompt != "" {
+		instruction += " Context of the speech: " + request.Prompt
+	}
+	geminiRequest := ChatRequest{
+		Contents: []ChatContent{{
+			Role: "user",
+			Parts: []Part{
+				{Text: instruction},
+				{InlineData: &InlineData{MimeType: mimeType, Data: base64.StdEncoding.EncodeToString(request.Audio)}},
+			},
+		}},
+	}
+	if request.Temperature > 0 {
+		geminiRequest.GenerationConfig.Temperature = &request.Temperature
+	}
+
+	requestMeta := *meta
+	requestMeta.IsStream = false
+	url, err := a.GetRequestURL(&requestMeta)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "get_request_url_failed", http.StatusInternalServerError)
+	}
+	var geminiResponse ChatResponse
+	err = adaptor.DoJSONRequest(http.MethodPost, url, map[string]string{"x-goog-api-key": meta.APIKey}, geminiRequest, &geminiResponse)
+	if err != nil {
+		return nil, adaptor.UpstreamErrorWrapper(err, "gemini_transcription_failed")
+	}
+	if len(geminiResponse.Candidates) == 0 {
+		return nil, openai.ErrorWrapper(errors.New("no candidates returned"), "gemini_transcription_failed", http.StatusInternalServerError)
+	}
+	result := &model.TranscriptionResult{
+		Text:     strings.TrimSpace(geminiResponse.GetResponseText()),
+		Language: request.Language,
+	}
+	if geminiResponse.UsageMetadata != nil {
+		result.Usage = geminiResponse.UsageMetadata.toUsage()
+	}
+	return result, nil
+}
@@ -6,15 +6,19 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/songquanpeng/one-api/common/render"
 
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/helper"
-	"github.com/songquanpeng/one-api/common/image"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/media"
 	"github.com/songquanpeng/one-api/common/random"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/constant"
@@ -27,6 +31,9 @@ import (
 
 const (
 	VisionMaxImageNum = 16
+	// reasoning efforts are relative to this when max_tokens is not set
+	defaultThinkingMaxTokens = 32768
+	maxThinkingBudget        = 24576
 )
 
 var mimeTypeMap = map[string]string{
@@ -34,64 +41,146 @@ var mimeTypeMap = map[string]string{
 	"text":        "text/plain",
 }
 
-// Setting safety to the lowest possible values since Gemini is already powerless enough
-func ConvertRequest(textRequest model.GeneralOpenAIRequest) *ChatRequest {
+var safetyCategories = []string{
+	"HARM_CATEGORY_HARASSMENT",
+	"HARM_CATEGORY_HATE_SPEECH",
+	"HARM_CATEGORY_SEXUALLY_EXPLICIT",
+	"HARM_CATEGORY_DANGEROUS_CONTENT",
+	"HARM_CATEGORY_CIVIC_INTEGRITY",
+}
+
+// getSafetySettings takes the thresholds of the request first, then the ones of the channel,
+// GEMINI_SAFETY_SETTING is used for the categories set by neither
+func getSafetySettings(channelSettings map[string]string, requestSettings []model.SafetySetting) []ChatSafetySettings {
+	thresholds := make(map[string]string)
+	for category, threshold := range channelSettings {
+		thresholds[category] = threshold
+	}
+	for _, setting := range requestSettings {
+		thresholds[setting.Category] = setting.Threshold
+	}
+	safetySettings := make([]ChatSafetySettings, 0, len(safetyCategories))
+	for _, category := range safetyCategories {
+		threshold, ok := thresholds[category]
+		if !ok {
+			threshold = config.GeminiSafetySetting
+		}
+		safetySettings = append(safetySettings, ChatSafetySettings{Category: category, Threshold: threshold})
+		delete(thresholds, category)
+	}
+	// categories unknown here, like the image ones of vertex ai
+	others := make([]string, 0, len(thresholds))
+	for category := range thresholds {
+		others = append(others, category)
+	}
+	sort.Strings(others)
+	for _, category := range others {
+		safetySettings = append(safetySettings, ChatSafetySettings{Category: category, Threshold: thresholds[category]})
+	}
+	return safetySettings
+}
+
+// unsupportedSchemaKeys are the json schema keywords refused by the openapi schemas of gemini
+var unsupportedSchemaKeys = []string{"additionalProperties", "$schema", "strict"}
+
+// schemaMapKeys are the keywords whose value maps names to schemas, the names are kept whatever they are
+var schemaMapKeys = []string{"properties", "patternProperties", "$defs", "definitions"}
+
+// cleanSchema removes the keywords gemini does not know from a json schema, strict openai schemas always have some
+func cleanSchema(schema any) any {
+	switch value := schema.(type) {
+	case map[string]any:
+		cleaned := make(map[string]any, len(value))
+		for key, item := range value {
+			if slices.Contains(unsupportedSchemaKeys, key) {
+				continue
+			}
+			if schemas, ok := item.(map[string]any); ok && slices.Contains(schemaMapKeys, key) {
+				cleanedSchemas := make(map[string]any, len(schemas))
+				for name, propertySchema := range schemas {
+					cleanedSchemas[name] = cleanSchema(propertySchema)
+				}
+				cleaned[key] = cleanedSchemas
+				continue
+			}
+			cleaned[key] = cleanSchema(item)
+		}
+		return cleaned
+	case []any:
+		cleaned := make([]any, len(value))
+		for i, item := range value {
+			cleaned[i] = cleanSchema(item)
+		}
+		return cleaned
+	default:
+		return schema
+	}
+}
+
+// convertTools maps the function tools to declarations, and the tools of the types
+// google_search, code_execution and url_context to the built-in tools of gemini,
+// the other types are rejected rather than sent as functions without a declaration
+func convertTools(textRequest *model.GeneralOpenAIRequest) ([]ChatTools, error) {
+	var tools []ChatTools
+	googleSearch := textRequest.WebSearchOptions != nil
+	functions := make([]model.Function, 0, len(textRequest.Tools))
+	for _, tool := range textRequest.Tools {
+		switch tool.Type {
+		case "google_search", "googleSearch":
+			googleSearch = true
+		case "code_execution", "codeExecution":
+			tools = append(tools, ChatTools{CodeExecution: &struct{}{}})
+		case "url_context", "urlContext":
+			tools = append(tools, ChatTools{URLContext: &struct{}{}})
+		case "function", "":
+			function := tool.Function
+			function.Parameters = cleanSchema(function.Parameters)
+			functions = append(functions, function)
+		default:
+			return nil, fmt.Errorf("tool type %q is not supported by gemini", tool.Type)
+		}
+	}
+	if googleSearch {
+		tools = append(tools, ChatTools{GoogleSearch: &struct{}{}})
+	}
+	if len(functions) > 0 {
+		tools = append(tools, ChatTools{FunctionDeclarations: functions})
+	} else if textRequest.Functions != nil {
+		tools = append(tools, ChatTools{FunctionDeclarations: textRequest.Functions})
+	}
+	return tools, nil
+}
+
+// ConvertRequest converts the request, channelSafetySettings are the thresholds configured on the channel
+func ConvertRequest(textRequest model.GeneralOpenAIRequest, channelSafetySettings map[string]string) (*ChatRequest, error) {
+	tools, err := convertTools(&textRequest)
+	if err != nil {
+		return nil, err
+	}
 	geminiRequest := ChatRequest{
-		Contents: make([]ChatContent, 0, len(textRequest.Messages)),
-		SafetySettings: []ChatSafetySettings{
-			{
-				Category:  "HARM_CATEGORY_HARASSMENT",
-				Threshold: config.GeminiSafetySetting,
-			},
-			{
-				Category:  "HARM_CATEGORY_HATE_SPEECH",
-				Threshold: config.GeminiSafetySetting,
-			},
-			{
-				Category:  "HARM_CATEGORY_SEXUALLY_EXPLICIT",
-				Threshold: config.GeminiSafetySetting,
-			},
-			{
-				Category:  "HARM_CATEGORY_DANGEROUS_CONTENT",
-				Threshold: config.GeminiSafetySetting,
-			},
-			{
-				Category:  "HARM_CATEGORY_CIVIC_INTEGRITY",
-				Threshold: config.GeminiSafetySetting,
-			},
-		},
+		Contents:       make([]ChatContent, 0, len(textRequest.Messages)),
+		SafetySettings: getSafetySettings(channelSafetySettings, textRequest.SafetySettings),
 		GenerationConfig: ChatGenerationConfig{
 			Temperature:     textRequest.Temperature,
 			TopP:            textRequest.TopP,
 			MaxOutputTokens: textRequest.MaxTokens,
 		},
+		Tools: tools,
 	}
 	if textRequest.ResponseFormat != nil {
 		if mimeType, ok := mimeTypeMap[textRequest.ResponseFormat.Type]; ok {
 			geminiRequest.GenerationConfig.ResponseMimeType = mimeType
 		}
 		if textRequest.ResponseFormat.JsonSchema != nil {
-			geminiRequest.GenerationConfig.ResponseSchema = textRequest.ResponseFormat.JsonSchema.Schema
+			geminiRequest.GenerationConfig.ResponseSchema = cleanSchema(textRequest.ResponseFormat.JsonSchema.Schema)
 			geminiRequest.GenerationConfig.ResponseMimeType = mimeTypeMap["json_object"]
 		}
 	}
-	if textRequest.Tools != nil {
-		functions := make([]model.Function, 0, len(textRequest.Tools))
-		for _, tool := range textRequest.Tools {
-			functions = append(functions, tool.Function)
-		}
-		geminiRequest.Tools = []ChatTools{
-			{
-				FunctionDeclarations: functions,
-			},
-		}
-	} else if textRequest.Functions != nil {
-		geminiRequest.Tools = []ChatTools{
-			{
-				FunctionDeclarations: textRequest.Functions,
-			},
-		}
+	if slices.Contains(textRequest.Modalities, "image") {
+		// the image models always answer with some text, they refuse an image only modality
+		geminiRequest.GenerationConfig.ResponseModalities = []string{"TEXT", "IMAGE"}
 	}
+	geminiRequest.GenerationConfig.ThinkingConfig = convertThinkingConfig(&textRequest)
 	shouldAddDummyModelMessage := false
 	for _, message := range textRequest.Messages {
 		content := ChatContent{
@@ -115,11 +204,32 @@ func ConvertRequest(textRequest model.GeneralOpenAIRequest) *ChatRequest {
 				if imageNum > VisionMaxImageNum {
 					continue
 				}
-				mimeType, data, _ := image.GetImageFromUrl(part.ImageURL.Url)
+				image, err := media.Fetch(part.ImageURL.Url)
+				if err != nil {
+					continue
+				}
 				parts = append(parts, Part{
 					InlineData: &InlineData{
-						MimeType: mimeType,
-						Data:     data,
+						MimeType: image.MimeType,
+						Data:     image.Base64(),
+					},
+				})
+			} else if part.Type == model.ContentTypeFile {
+				file, err := media.Fetch(part.File.URL())
+				if err != nil {
+					continue
+				}
+				parts = append(parts, Part{
+					InlineData: &InlineData{
+						MimeType: file.MimeType,
+						Data:     file.Base64(),
+					},
+				})
+			} else if part.Type == model.ContentTypeInputAudio {
+				parts = append(parts, Part{
+					InlineData: &InlineData{
+						MimeType: part.InputAudio.MimeType(),
+						Data:     part.InputAudio.Data,
 					},
 				})
 			}
@@ -158,7 +268,25 @@ func ConvertRequest(textRequest model.GeneralOpenAIRequest) *ChatRequest {
 		}
 	}
 
-	return &geminiRequest
+	return &geminiRequest, nil
+}
+
+func convertThinkingConfig(textRequest *model.GeneralOpenAIRequest) *ThinkingConfig {
+	maxTokens := textRequest.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = defaultThinkingMaxTokens
+	}
+	budget, ok := textRequest.GetReasoningBudget(maxTokens)
+	if !ok {
+		return nil
+	}
+	if budget > maxThinkingBudget {
+		budget = maxThinkingBudget
+	}
+	return &ThinkingConfig{
+		ThinkingBudget:  &budget,
+		IncludeThoughts: !textRequest.IsReasoningExcluded() && budget > 0,
+	}
 }
 
 func ConvertEmbeddingRequest(request model.GeneralOpenAIRequest) *BatchEmbeddingRequest {
@@ -187,23 +315,128 @@ func ConvertEmbeddingRequest(request model.GeneralOpenAIRequest) *BatchEmbedding
 type ChatResponse struct {
 	Candidates     []ChatCandidate    `json:"candidates"`
 	PromptFeedback ChatPromptFeedback `json:"promptFeedback"`
+	UsageMetadata  *UsageMetadata     `json:"usageMetadata,omitempty"`
 }
 
 func (g *ChatResponse) GetResponseText() string {
-	if g == nil {
+	if g == nil || len(g.Candidates) == 0 {
 		return ""
 	}
-	if len(g.Candidates) > 0 && len(g.Candidates[0].Content.Parts) > 0 {
-		return g.Candidates[0].Content.Parts[0].Text
+	text, _ := g.Candidates[0].GetText()
+	return text
+}
+
+// partText is the text of a part, the code execution parts are written as markdown code blocks
+func partText(part Part) string {
+	switch {
+	case part.ExecutableCode != nil:
+		return fmt.Sprintf("\n```%s\n%s\n```\n", strings.ToLower(part.ExecutableCode.Language), part.ExecutableCode.Code)
+	case part.CodeExecutionResult != nil:
+		return fmt.Sprintf("\n```output\n%s\n```\n", part.CodeExecutionResult.Output)
+	default:
+		return part.Text
+	}
+}
+
+// GetText splits the text parts into the answer and the thoughts
+func (c *ChatCandidate) GetText() (text string, thoughts string) {
+	for _, part := range c.Content.Parts {
+		if part.Thought {
+			thoughts += part.Text
+		} else {
+			text += partText(part)
+		}
+	}
+	return
+}
+
+// getContent is the answer as a string, or as content parts when the model answered with images
+func (c *ChatCandidate) getContent() (content any, thoughts string) {
+	var contents []model.MessageContent
+	text := ""
+	for _, part := range c.Content.Parts {
+		if part.Thought {
+			thoughts += part.Text
+			continue
+		}
+		if part.InlineData != nil && strings.HasPrefix(part.InlineData.MimeType, "image/") {
+			if text != "" {
+				contents = append(contents, model.MessageContent{Type: model.ContentTypeText, Text: text})
+				text = ""
+			}
+			contents = append(contents, model.MessageContent{
+				Type:     model.ContentTypeImageURL,
+				ImageURL: &model.ImageURL{Url: fmt.Sprintf("data:%s;base64,%s", part.InlineData.MimeType, part.InlineData.Data)},
+			})
+			continue
+		}
+		text += partText(part)
+	}
+	if len(contents) == 0 {
+		return text, thoughts
+	}
+	if text != "" {
+		contents = append(contents, model.MessageContent{Type: model.ContentTypeText, Text: text})
+	}
+	return contents, thoughts
+}
+
+// runeOffset converts a byte offset given by gemini into a character offset in text
+func runeOffset(text string, offset int) int {
+	if offset <= 0 {
+		return 0
+	}
+	if offset > len(text) {
+		offset = len(text)
+	}
+	return utf8.RuneCountInString(text[:offset])
+}
+
+// getAnnotations cites the web sources of the grounding, gemini gives the segments in bytes
+// of the answer text, they are converted to character offsets as openai counts them
+func (c *ChatCandidate) getAnnotations(text string) []model.Annotation {
+	if c.GroundingMetadata == nil {
+		return nil
+	}
+	chunks := c.GroundingMetadata.GroundingChunks
+	var annotations []model.Annotation
+	cited := make(map[int]bool)
+	for _, support := range c.GroundingMetadata.GroundingSupports {
+		for _, index := range support.GroundingChunkIndices {
+			if index < 0 || index >= len(chunks) || chunks[index].Web == nil {
+				continue
+			}
+			cited[index] = true
+			annotations = append(annotations, model.Annotation{
+				Type: "url_citation",
+				URLCitation: &model.URLCitation{
+					URL:        chunks[index].Web.URI,
+					Title:      chunks[index].Web.Title,
+					StartIndex: runeOffset(text, support.Segment.StartIndex),
+					EndIndex:   runeOffset(text, support.Segment.EndIndex),
+				},
+			})
+		}
+	}
+	// the sources supporting no segment are cited for the whole answer
+	for i, chunk := range chunks {
+		if cited[i] || chunk.Web == nil {
+			continue
+		}
+		annotations = append(annotations, model.Annotation{
+			Type:        "url_citation",
+			URLCitation: &model.URLCitation{URL: chunk.Web.URI, Title: chunk.Web.Title},
+		})
 	}
-	return ""
+	return annotations
 }
 
 type ChatCandidate struct {
-	Content       ChatContent        `json:"content"`
-	FinishReason  string             `json:"finishReason"`
-	Index         int64              `json:"index"`
-	SafetyRatings []ChatSafetyRating `json:"safetyRatings"`
+	Content           ChatContent        `json:"content"`
+	FinishReason      string             `json:"finishReason"`
+	Index             int64              `json:"index"`
+	SafetyRatings     []ChatSafetyRating `json:"safetyRatings"`
+	GroundingMetadata *GroundingMetadata `json:"groundingMetadata,omitempty"`
 }
 
 type ChatSafetyRating struct {
@@ -218,24 +451,25 @@ type ChatPromptFeedback struct {
 func getToolCalls(candidate *ChatCandidate) []model.Tool {
 	var toolCalls []model.Tool
 
-	item := candidate.Content.Parts[0]
-	if item.FunctionCall == nil {
-		return toolCalls
-	}
-	argsBytes, err := json.Marshal(item.FunctionCall.Arguments)
-	if err != nil {
-		logger.FatalLog("getToolCalls failed: " + err.Error())
-		return toolCalls
-	}
-	toolCall := model.Tool{
-		Id:   fmt.Sprintf("call_%s", random.GetUUID()),
-		Type: "function",
-		Function: model.Function{
-			Arguments: string(argsBytes),
-			Name:      item.FunctionCall.FunctionName,
-		},
+	for _, item := range candidate.Content.Parts {
+		if item.FunctionCall == nil {
+			continue
+		}
+		argsBytes, err := json.Marshal(item.FunctionCall.Arguments)
+		if err != nil {
+			logger.SysError("getToolCalls failed: " + err.Error())
+			continue
+		}
+		toolCall := model.Tool{
+			Id:   fmt.Sprintf("call_%s", random.GetUUID()),
+			Type: "function",
+			Function: model.Function{
+				Arguments: string(argsBytes),
+				Name:      item.FunctionCall.FunctionName,
+			},
+		}
+		toolCalls = append(toolCalls, toolCall)
 	}
-	toolCalls = append(toolCalls, toolCall)
 	return toolCalls
 }
 
@@ -255,17 +489,15 @@ func responseGeminiChat2OpenAI(response *ChatResponse) *openai.TextResponse {
 			FinishReason: constant.StopFinishReason,
 		}
 		if len(candidate.Content.Parts) > 0 {
-			if candidate.Content.Parts[0].FunctionCall != nil {
-				choice.Message.ToolCalls = getToolCalls(&candidate)
-			} else {
-				var builder strings.Builder
-				for _, part := range candidate.Content.Parts {
-					if i > 0 {
-						builder.WriteString("\n")
-					}
-					builder.WriteString(part.Text)
-				}
-				choice.Message.Content = builder.String()
+			choice.Message.ToolCalls = getToolCalls(&candidate)
+			content, thoughts := candidate.getContent()
+			if len(choice.Message.ToolCalls) == 0 {
+				choice.Message.Content = content
+			}
+			text, _ := candidate.GetText()
+			choice.Message.Annotations = candidate.getAnnotations(text)
+			if thoughts != "" {
+				choice.Message.ReasoningContent = thoughts
 			}
 		} else {
 			choice.Message.Content = ""
@@ -276,9 +508,37 @@ func responseGeminiChat2OpenAI(response *ChatResponse) *openai.TextResponse {
 	return &fullTextResponse
 }
 
-func streamResponseGeminiChat2OpenAI(geminiResponse *ChatResponse) *openai.ChatCompletionsStreamResponse {
+// toUsage counts the thoughts into the completion tokens, they are billed as output
+func (u *UsageMetadata) toUsage() *model.Usage {
+	usage := &model.Usage{
+		PromptTokens:     u.PromptTokenCount,
+		CompletionTokens: u.CandidatesTokenCount + u.ThoughtsTokenCount,
+		TotalTokens:      u.TotalTokenCount,
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	if u.ThoughtsTokenCount > 0 {
+		usage.CompletionTokensDetails = &model.CompletionTokensDetails{
+			ReasoningTokens: u.ThoughtsTokenCount,
+		}
+	}
+	return usage
+}
+
+// streamResponseGeminiChat2OpenAI converts a chunk, streamedText is the answer sent before it
+// as the grounding segments are offsets in the whole answer
+func streamResponseGeminiChat2OpenAI(geminiResponse *ChatResponse, streamedText string) *openai.ChatCompletionsStreamResponse {
 	var choice openai.ChatCompletionsStreamResponseChoice
-	choice.Delta.Content = geminiResponse.GetResponseText()
+	if len(geminiResponse.Candidates) > 0 {
+		content, thoughts := geminiResponse.Candidates[0].getContent()
+		choice.Delta.Content = content
+		if thoughts != "" {
+			choice.Delta.ReasoningContent = thoughts
+		}
+		text, _ := geminiResponse.Candidates[0].GetText()
+		choice.Delta.Annotations = geminiResponse.Candidates[0].getAnnotations(streamedText + text)
+	}
 	//choice.FinishReason = &constant.StopFinishReason
 	var response openai.ChatCompletionsStreamResponse
 	response.Id = fmt.Sprintf("chatcmpl-%s", random.GetUUID())
@@ -306,10 +566,14 @@ func embeddingResponseGemini2OpenAI(response *EmbeddingResponse) *openai.Embeddi
 	return &openAIEmbeddingResponse
 }
 
-func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, string) {
+func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, string, *model.Usage) {
 	responseText := ""
+	var usage *model.Usage
 	scanner := bufio.NewScanner(resp.Body)
+	// the images generated by the model come whole in one event
+	scanner.Buffer(make([]byte, 64*1024), 32*1024*1024)
 	scanner.Split(bufio.ScanLines)
+	excludeReasoning := c.GetBool(ctxkey.ExcludeReasoning)
 
 	common.SetEventStreamHeaders(c)
 
@@ -329,13 +593,17 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 			continue
 		}
 
-		response := streamResponseGeminiChat2OpenAI(&geminiResponse)
+		response := streamResponseGeminiChat2OpenAI(&geminiResponse, responseText)
 		if response == nil {
 			continue
 		}
 
 		responseText += response.Choices[0].Delta.StringContent()
+		if geminiResponse.UsageMetadata != nil {
+			usage = geminiResponse.UsageMetadata.toUsage()
+		}
 
+		response.NormalizeReasoning(excludeReasoning)
 		err = render.ObjectData(c, response)
 		if err != nil {
 			logger.SysError(err.Error())
@@ -350,10 +618,10 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 
 	err := resp.Body.Close()
 	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), ""
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), "", nil
 	}
 
-	return nil, responseText
+	return nil, responseText, usage
 }
 
 func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
@@ -383,12 +651,18 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 	}
 	fullTextResponse := responseGeminiChat2OpenAI(&geminiResponse)
 	fullTextResponse.Model = modelName
-	completionTokens := openai.CountTokenText(geminiResponse.GetResponseText(), modelName)
-	usage := model.Usage{
-		PromptTokens:     promptTokens,
-		CompletionTokens: completionTokens,
-		TotalTokens:      promptTokens + completionTokens,
+	var usage model.Usage
+	if geminiResponse.UsageMetadata != nil {
+		usage = *geminiResponse.UsageMetadata.toUsage()
+	} else {
+		completionTokens := openai.CountTokenText(geminiResponse.GetResponseText(), modelName)
+		usage = model.Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		}
 	}
+	fullTextResponse.NormalizeReasoning(c.GetBool(ctxkey.ExcludeReasoning))
 	fullTextResponse.Usage = usage
 	jsonResponse, err := json.Marshal(fullTextResponse)
 	if err != nil {
@@ -0,0 +1,174 @@
+package gemini
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func parseRequest(t *testing.T, body string) model.GeneralOpenAIRequest {
+	var request model.GeneralOpenAIRequest
+	require.NoError(t, json.Unmarshal([]byte(body), &request))
+	return request
+}
+
+func TestConvertRequestTools(t *testing.T) {
+	request := parseRequest(t, `{
+		"model": "gemini-2.5-flash",
+		"messages": [{"role": "user", "content": "What happened today?"}],
+		"web_search_options": {},
+		"tools": [
+			{"type": "code_execution"},
+			{"type": "url_context"},
+			{"type": "function", "function": {"name": "lookup", "parameters": {"type": "object", "additionalProperties": false, "properties": {"q": {"type": "string"}}}}}
+		]
+	}`)
+	geminiRequest, err := ConvertRequest(request, nil)
+	require.NoError(t, err)
+	body, err := json.Marshal(geminiRequest.Tools)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"codeExecution": {}},
+		{"urlContext": {}},
+		{"googleSearch": {}},
+		{"function_declarations": [{"name": "lookup", "parameters": {"type": "object", "properties": {"q": {"type": "string"}}}}]}
+	]`, string(body))
+}
+
+func TestConvertRequestUnknownTool(t *testing.T) {
+	request := parseRequest(t, `{
+		"model": "gemini-2.5-flash",
+		"messages": [{"role": "user", "content": "What happened today?"}],
+		"tools": [{"type": "file_search"}]
+	}`)
+	_, err := ConvertRequest(request, nil)
+	assert.ErrorContains(t, err, "file_search")
+}
+
+func TestConvertRequestGenerationConfig(t *testing.T) {
+	request := parseRequest(t, `{
+		"model": "gemini-2.0-flash-preview-image-generation",
+		"messages": [{"role": "user", "content": "Draw a cat"}],
+		"modalities": ["image"],
+		"response_format": {"type": "json_schema", "json_schema": {"name": "cat", "strict": true, "schema": {"type": "object", "additionalProperties": false, "properties": {"items": {"type": "array", "items": {"type": "object", "additionalProperties": false}}}}}}
+	}`)
+	geminiRequest, err := ConvertRequest(request, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"TEXT", "IMAGE"}, geminiRequest.GenerationConfig.ResponseModalities)
+	assert.Equal(t, "application/json", geminiRequest.GenerationConfig.ResponseMimeType)
+	assert.Equal(t, map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"items": map[string]any{"type": "array", "items": map[string]any{"type": "object"}},
+		},
+	}, geminiRequest.GenerationConfig.ResponseSchema)
+}
+
+func TestCleanSchema(t *testing.T) {
+	var schema any
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"type": "object",
+		"additionalProperties": false,
+		"properties": {
+			"strict": {"type": "boolean", "strict": true},
+			"additionalProperties": {"type": "object", "additionalProperties": false, "properties": {"$schema": {"type": "string"}}}
+		},
+		"required": ["strict", "additionalProperties"]
+	}`), &schema))
+	// the keywords are removed from the schemas, not from the names of the properties
+	assert.Equal(t, map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"strict":               map[string]any{"type": "boolean"},
+			"additionalProperties": map[string]any{"type": "object", "properties": map[string]any{"$schema": map[string]any{"type": "string"}}},
+		},
+		"required": []any{"strict", "additionalProperties"},
+	}, cleanSchema(schema))
+}
+
+func TestGetSafetySettings(t *testing.T) {
+	config.GeminiSafetySetting = "BLOCK_NONE"
+	request := parseRequest(t, `{
+		"model": "gemini-2.5-flash",
+		"messages": [{"role": "user", "content": "hi"}],
+		"safety_settings": [{"category": "HARM_CATEGORY_HARASSMENT", "threshold": "BLOCK_LOW_AND_ABOVE"}]
+	}`)
+	channelSettings := map[string]string{
+		"HARM_CATEGORY_HARASSMENT":        "BLOCK_ONLY_HIGH",
+		"HARM_CATEGORY_DANGEROUS_CONTENT": "BLOCK_MEDIUM_AND_ABOVE",
+		"HARM_CATEGORY_IMAGE_HATE":        "BLOCK_ONLY_HIGH",
+	}
+	geminiRequest, err := ConvertRequest(request, channelSettings)
+	require.NoError(t, err)
+	assert.Equal(t, []ChatSafetySettings{
+		{Category: "HARM_CATEGORY_HARASSMENT", Threshold: "BLOCK_LOW_AND_ABOVE"},
+		{Category: "HARM_CATEGORY_HATE_SPEECH", Threshold: "BLOCK_NONE"},
+		{Category: "HARM_CATEGORY_SEXUALLY_EXPLICIT", Threshold: "BLOCK_NONE"},
+		{Category: "HARM_CATEGORY_DANGEROUS_CONTENT", Threshold: "BLOCK_MEDIUM_AND_ABOVE"},
+		{Category: "HARM_CATEGORY_CIVIC_INTEGRITY", Threshold: "BLOCK_NONE"},
+		{Category: "HARM_CATEGORY_IMAGE_HATE", Threshold: "BLOCK_ONLY_HIGH"},
+	}, geminiRequest.SafetySettings)
+}
+
+func TestResponseGeminiChat2OpenAI(t *testing.T) {
+	var response ChatResponse
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"candidates": [{
+			"content": {"role": "model", "parts": [
+				{"text": "Here is your cat."},
+				{"inlineData": {"mimeType": "image/png", "data": "iVBORw0KGgo="}},
+				{"executableCode": {"language": "PYTHON", "code": "print(1 + 1)"}},
+				{"codeExecutionResult": {"outcome": "OUTCOME_OK", "output": "2\n"}}
+			]},
+			"finishReason": "STOP",
+			"groundingMetadata": {
+				"webSearchQueries": ["cats"],
+				"groundingChunks": [{"web": {"uri": "https://example.com/cats", "title": "example.com"}}, {"web": {"uri": "https://example.org", "title": "example.org"}}],
+				"groundingSupports": [{"segment": {"startIndex": 0, "endIndex": 17, "text": "Here is your cat."}, "groundingChunkIndices": [0]}]
+			}
+		}]
+	}`), &response))
+	textResponse := responseGeminiChat2OpenAI(&response)
+	message := textResponse.Choices[0].Message
+	assert.Equal(t, []model.MessageContent{
+		{Type: model.ContentTypeText, Text: "Here is your cat."},
+		{Type: model.ContentTypeImageURL, ImageURL: &model.ImageURL{Url: "data:image/png;base64,iVBORw0KGgo="}},
+		{Type: model.ContentTypeText, Text: "\n```python\nprint(1 + 1)\n```\n\n```output\n2\n\n```\n"},
+	}, message.Content)
+	assert.Equal(t, []model.Annotation{
+		{Type: "url_citation", URLCitation: &model.URLCitation{URL: "https://example.com/cats", Title: "example.com", StartIndex: 0, EndIndex: 17}},
+		{Type: "url_citation", URLCitation: &model.URLCitation{URL: "https://example.org", Title: "example.org"}},
+	}, message.Annotations)
+
+	response.Candidates[0].Content.Parts = response.Candidates[0].Content.Parts[:1]
+	textResponse = responseGeminiChat2OpenAI(&response)
+	assert.Equal(t, "Here is your cat.", textResponse.Choices[0].Message.Content)
+}
+
+func TestGetAnnotationsRuneOffsets(t *testing.T) {
+	var response ChatResponse
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"candidates": [{
+			"content": {"role": "model", "parts": [{"text": "猫很可爱。Cats are cute."}]},
+			"groundingMetadata": {
+				"groundingChunks": [{"web": {"uri": "https://example.com/cats", "title": "example.com"}}],
+				"groundingSupports": [{"segment": {"startIndex": 15, "endIndex": 29, "text": "Cats are cute."}, "groundingChunkIndices": [0]}]
+			}
+		}]
+	}`), &response))
+	want := []model.Annotation{
+		{Type: "url_citation", URLCitation: &model.URLCitation{URL: "https://example.com/cats", Title: "example.com", StartIndex: 5, EndIndex: 19}},
+	}
+	assert.Equal(t, want, responseGeminiChat2OpenAI(&response).Choices[0].Message.Annotations)
+
+	// in a stream the segments are offsets in the whole answer
+	response.Candidates[0].Content.Parts[0].Text = "Cats are cute."
+	streamResponse := streamResponseGeminiChat2OpenAI(&response, "猫很可爱。")
+	assert.Equal(t, want, streamResponse.Choices[0].Delta.Annotations)
+}
@@ -45,10 +45,25 @@ type FunctionCall struct {
 	Arguments    any    `json:"args"`
 }
 
+// https://ai.google.dev/gemini-api/docs/code-execution
+type ExecutableCode struct {
+	Language string `json:"language"`
+	Code     string `json:"code"`
+}
+
+type CodeExecutionResult struct {
+	Outcome string `json:"outcome"`
+	Output  string `json:"output,omitempty"`
+}
+
 type Part struct {
-	Text         string        `json:"text,omitempty"`
-	InlineData   *InlineData   `json:"inlineData,omitempty"`
-	FunctionCall *FunctionCall `json:"functionCall,omitempty"`
+	Text                string               `json:"text,omitempty"`
+	InlineData          *InlineData          `json:"inlineData,omitempty"`
+	FunctionCall        *FunctionCall        `json:"functionCall,omitempty"`
+	ExecutableCode      *ExecutableCode      `json:"executableCode,omitempty"`
+	CodeExecutionResult *CodeExecutionResult `json:"codeExecutionResult,omitempty"`
+	// Thought marks the part as a thought summary of a thinking model
+	Thought bool `json:"thought,omitempty"`
 }
 
 type ChatContent struct {
@@ -61,8 +76,12 @@ type ChatSafetySettings struct {
 	Threshold string `json:"threshold"`
 }
 
+// ChatTools holds one kind of tool, the built-in tools take no options
 type ChatTools struct {
-	FunctionDeclarations any `json:"function_declarations,omitempty"`
+	FunctionDeclarations any       `json:"function_declarations,omitempty"`
+	GoogleSearch         *struct{} `json:"googleSearch,omitempty"`
+	CodeExecution        *struct{} `json:"codeExecution,omitempty"`
+	URLContext           *struct{} `json:"urlContext,omitempty"`
 }
 
 type ChatGenerationConfig struct {
@@ -74,4 +93,43 @@ type ChatGenerationConfig struct {
 	MaxOutputTokens  int      `json:"maxOutputTokens,omitempty"`
 	CandidateCount   int      `json:"candidateCount,omitempty"`
 	StopSequences    []string `json:"stopSequences,omitempty"`
+	// https://ai.google.dev/gemini-api/docs/image-generation
+	ResponseModalities []string `json:"responseModalities,omitempty"`
+	// https://ai.google.dev/gemini-api/docs/thinking
+	ThinkingConfig *ThinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+type ThinkingConfig struct {
+	ThinkingBudget  *int `json:"thinkingBudget,omitempty"`
+	IncludeThoughts bool `json:"includeThoughts,omitempty"`
+}
+
+type UsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+	ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+}
+
+// https://ai.google.dev/gemini-api/docs/grounding
+type GroundingMetadata struct {
+	WebSearchQueries  []string           `json:"webSearchQueries,omitempty"`
+	GroundingChunks   []GroundingChunk   `json:"groundingChunks,omitempty"`
+	GroundingSupports []GroundingSupport `json:"groundingSupports,omitempty"`
+}
+
+type GroundingChunk struct {
+	Web *struct {
+		URI   string `json:"uri"`
+		Title string `json:"title"`
+	} `json:"web,omitempty"`
+}
+
+type GroundingSupport struct {
+	Segment struct {
+		StartIndex int    `json:"startIndex"`
+		EndIndex   int    `json:"endIndex"`
+		Text       string `json:"text"`
+	} `json:"segment"`
+	GroundingChunkIndices []int `json:"groundingChunkIndices"`
 }
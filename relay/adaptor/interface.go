@@ -19,3 +19,26 @@ type Adaptor interface {
 	GetModelList() []string
 	GetChannelName() string
 }
+
+// RerankAdaptor is implemented by the adaptors of channels that can rerank documents
+type RerankAdaptor interface {
+	Adaptor
+	ConvertRerankRequest(meta *meta.Meta, request *model.RerankRequest) (any, error)
+	ConvertRerankResponse(meta *meta.Meta, responseBody []byte) (*model.RerankResponse, error)
+}
+
+// TaskAdaptor is implemented by the adaptors of channels running submit-then-poll jobs, like video generations.
+// The tasks are polled in the background, out of any request, so FetchTask only gets the meta of the channel.
+type TaskAdaptor interface {
+	Adaptor
+	SubmitTask(meta *meta.Meta, request *model.VideoRequest) (upstreamId string, err *model.ErrorWithStatusCode)
+	FetchTask(meta *meta.Meta, upstreamId string) (*model.TaskResult, error)
+}
+
+// AudioAdaptor is implemented by the adaptors of channels with their own speech apis.
+// The OpenAI shaped channels are sent the audio requests as they are.
+type AudioAdaptor interface {
+	Adaptor
+	CreateSpeech(meta *meta.Meta, request *model.SpeechRequest) (*model.SpeechResult, *model.ErrorWithStatusCode)
+	CreateTranscription(meta *meta.Meta, request *model.TranscriptionRequest) (*model.TranscriptionResult, *model.ErrorWithStatusCode)
+}
@@ -0,0 +1,79 @@
+package adaptor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// UpstreamError is returned when the upstream answers with an error status
+type UpstreamError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("upstream status %d: %s", e.StatusCode, e.Body)
+}
+
+// DoJSONRequest sends a json request to the upstream and decodes the json response into response.
+// It does not need a client request, the tasks are polled in the background.
+func DoJSONRequest(method string, url string, headers map[string]string, request any, response any) error {
+	var body io.Reader
+	if request != nil {
+		jsonData, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("marshal request failed: %w", err)
+		}
+		body = bytes.NewReader(jsonData)
+	}
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return fmt.Errorf("new request failed: %w", err)
+	}
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("do request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response body failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return &UpstreamError{StatusCode: resp.StatusCode, Body: string(responseBody)}
+	}
+	if err = json.Unmarshal(responseBody, response); err != nil {
+		return fmt.Errorf("unmarshal response body failed: %w", err)
+	}
+	return nil
+}
+
+// UpstreamErrorWrapper keeps the status of the upstream, so that the relay retries or disables the channel like for the other requests
+func UpstreamErrorWrapper(err error, code string) *model.ErrorWithStatusCode {
+	statusCode := http.StatusInternalServerError
+	var upstreamErr *UpstreamError
+	if errors.As(err, &upstreamErr) {
+		statusCode = upstreamErr.StatusCode
+	}
+	return &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: err.Error(),
+			Type:    "upstream_error",
+			Code:    code,
+		},
+		StatusCode: statusCode,
+	}
+}
@@ -0,0 +1,11 @@
+package kling
+
+// https://app.klingai.com/global/dev/document-api/apiReference/model/textToVideo
+
+var ModelList = []string{
+	"kling-v1",
+	"kling-v1-6",
+	"kling-v2-master",
+	"kling-v2-1",
+	"kling-v2-1-master",
+}
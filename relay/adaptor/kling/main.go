@@ -0,0 +1,120 @@
+package kling
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// GetToken signs a short-lived token from the key, written as "access key|secret key"
+func GetToken(apiKey string) (string, error) {
+	accessKey, secretKey, ok := strings.Cut(apiKey, "|")
+	if !ok {
+		return "", errors.New("invalid kling key, it should be like access_key|secret_key")
+	}
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": accessKey,
+		"exp": now.Add(30 * time.Minute).Unix(),
+		"nbf": now.Add(-5 * time.Second).Unix(),
+	})
+	return token.SignedString([]byte(secretKey))
+}
+
+// sizeToAspectRatio maps the sizes to the aspect ratios kling knows
+func sizeToAspectRatio(size string) string {
+	width, height, ok := strings.Cut(size, "x")
+	if !ok {
+		return ""
+	}
+	w, _ := strconv.Atoi(width)
+	h, _ := strconv.Atoi(height)
+	switch {
+	case w == 0 || h == 0:
+		return ""
+	case w > h:
+		return "16:9"
+	case w < h:
+		return "9:16"
+	}
+	return "1:1"
+}
+
+func (a *Adaptor) SubmitTask(meta *meta.Meta, request *model.VideoRequest) (string, *model.ErrorWithStatusCode) {
+	token, err := GetToken(meta.APIKey)
+	if err != nil {
+		return "", adaptor.UpstreamErrorWrapper(err, "kling_submit_task_failed")
+	}
+	klingRequest := VideoRequest{
+		ModelName:      meta.ActualModelName,
+		Prompt:         request.Prompt,
+		NegativePrompt: request.NegativePrompt,
+		AspectRatio:    sizeToAspectRatio(request.Size),
+	}
+	if request.Duration > 0 {
+		klingRequest.Duration = strconv.Itoa(request.Duration)
+	}
+	// the task id is prefixed with the endpoint, the tasks are queried on the endpoint they were created by
+	endpoint := "text2video"
+	if request.Image != "" {
+		endpoint = "image2video"
+		klingRequest.Image = request.Image
+		if strings.HasPrefix(request.Image, "data:") {
+			_, klingRequest.Image, _ = strings.Cut(request.Image, ",")
+		}
+	}
+	var klingResponse TaskResponse
+	err = adaptor.DoJSONRequest(http.MethodPost, fmt.Sprintf("%s/v1/videos/%s", meta.BaseURL, endpoint),
+		map[string]string{"Authorization": "Bearer " + token}, klingRequest, &klingResponse)
+	if err != nil {
+		return "", adaptor.UpstreamErrorWrapper(err, "kling_submit_task_failed")
+	}
+	if klingResponse.Code != 0 || klingResponse.Data.TaskId == "" {
+		return "", adaptor.UpstreamErrorWrapper(fmt.Errorf("kling error %d: %s", klingResponse.Code, klingResponse.Message), "kling_submit_task_failed")
+	}
+	return endpoint + "/" + klingResponse.Data.TaskId, nil
+}
+
+func (a *Adaptor) FetchTask(meta *meta.Meta, upstreamId string) (*model.TaskResult, error) {
+	token, err := GetToken(meta.APIKey)
+	if err != nil {
+		return nil, err
+	}
+	var klingResponse TaskResponse
+	err = adaptor.DoJSONRequest(http.MethodGet, fmt.Sprintf("%s/v1/videos/%s", meta.BaseURL, upstreamId),
+		map[string]string{"Authorization": "Bearer " + token}, nil, &klingResponse)
+	if err != nil {
+		return nil, err
+	}
+	if klingResponse.Code != 0 {
+		return nil, fmt.Errorf("kling error %d: %s", klingResponse.Code, klingResponse.Message)
+	}
+	result := &model.TaskResult{}
+	switch klingResponse.Data.TaskStatus {
+	case "submitted":
+		result.Status = model.TaskStatusQueued
+	case "processing":
+		result.Status = model.TaskStatusInProgress
+	case "succeed":
+		result.Status = model.TaskStatusSucceeded
+		for _, video := range klingResponse.Data.TaskResult.Videos {
+			result.Outputs = append(result.Outputs, video.Url)
+			duration, _ := strconv.ParseFloat(video.Duration, 64)
+			result.Duration += duration
+		}
+	case "failed":
+		result.Status = model.TaskStatusFailed
+		result.Error = klingResponse.Data.TaskStatusMsg
+	default:
+		return nil, fmt.Errorf("unknown task status %q", klingResponse.Data.TaskStatus)
+	}
+	return result, nil
+}
@@ -0,0 +1,81 @@
+package kling
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func newMockServer(t *testing.T) *httptest.Server {
+	client.Init()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := jwt.Parse(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), func(token *jwt.Token) (any, error) {
+			return []byte("sk"), nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "ak", token.Claims.(jwt.MapClaims)["iss"])
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/videos/image2video":
+			var request VideoRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+			assert.Equal(t, "kling-v2-1", request.ModelName)
+			assert.Equal(t, "aGVsbG8=", request.Image)
+			assert.Equal(t, "10", request.Duration)
+			assert.Equal(t, "9:16", request.AspectRatio)
+			_, _ = w.Write([]byte(`{"code":0,"message":"SUCCEED","data":{"task_id":"t1","task_status":"submitted"}}`))
+		case r.URL.Path == "/v1/videos/image2video/t1":
+			_, _ = w.Write([]byte(`{"code":0,"data":{"task_id":"t1","task_status":"succeed","task_result":{"videos":[{"id":"v1","url":"https://cdn.example.com/v1.mp4","duration":"10"}]}}}`))
+		case r.URL.Path == "/v1/videos/text2video/t2":
+			_, _ = w.Write([]byte(`{"code":0,"data":{"task_id":"t2","task_status":"failed","task_status_msg":"risk control"}}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"code":1000,"message":"unauthorized"}`))
+		}
+	}))
+}
+
+func TestSubmitAndFetchTask(t *testing.T) {
+	server := newMockServer(t)
+	defer server.Close()
+	a := &Adaptor{}
+	taskMeta := &meta.Meta{BaseURL: server.URL, APIKey: "ak|sk", ActualModelName: "kling-v2-1"}
+
+	upstreamId, bizErr := a.SubmitTask(taskMeta, &model.VideoRequest{
+		Prompt:   "a cat",
+		Image:    "data:image/png;base64,aGVsbG8=",
+		Duration: 10,
+		Size:     "720x1280",
+	})
+	require.Nil(t, bizErr)
+	assert.Equal(t, "image2video/t1", upstreamId)
+
+	result, err := a.FetchTask(taskMeta, upstreamId)
+	require.NoError(t, err)
+	assert.Equal(t, model.TaskStatusSucceeded, result.Status)
+	assert.Equal(t, []string{"https://cdn.example.com/v1.mp4"}, result.Outputs)
+	assert.Equal(t, 10.0, result.Duration)
+
+	result, err = a.FetchTask(taskMeta, "text2video/t2")
+	require.NoError(t, err)
+	assert.Equal(t, model.TaskStatusFailed, result.Status)
+	assert.Equal(t, "risk control", result.Error)
+
+	// the status of the upstream is kept, so that the relay disables the channel
+	_, bizErr = a.SubmitTask(taskMeta, &model.VideoRequest{Prompt: "a dog"})
+	require.NotNil(t, bizErr)
+	assert.Equal(t, http.StatusUnauthorized, bizErr.StatusCode)
+
+	_, bizErr = a.SubmitTask(&meta.Meta{BaseURL: server.URL, APIKey: "no-secret"}, &model.VideoRequest{Prompt: "a dog"})
+	require.NotNil(t, bizErr)
+}
@@ -0,0 +1,29 @@
+package kling
+
+type VideoRequest struct {
+	ModelName      string `json:"model_name"`
+	Prompt         string `json:"prompt,omitempty"`
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+	// Image is an url or the base64 of the image, without the data url prefix
+	Image       string `json:"image,omitempty"`
+	Duration    string `json:"duration,omitempty"`
+	AspectRatio string `json:"aspect_ratio,omitempty"`
+}
+
+type TaskResponse struct {
+	Code      int    `json:"code"`
+	Message   string `json:"message"`
+	RequestId string `json:"request_id"`
+	Data      struct {
+		TaskId        string `json:"task_id"`
+		TaskStatus    string `json:"task_status"`
+		TaskStatusMsg string `json:"task_status_msg"`
+		TaskResult    struct {
+			Videos []struct {
+				Id       string `json:"id"`
+				Url      string `json:"url"`
+				Duration string `json:"duration"`
+			} `json:"videos"`
+		} `json:"task_result"`
+	} `json:"data"`
+}
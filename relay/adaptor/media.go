@@ -0,0 +1,23 @@
+package adaptor
+
+import (
+	"github.com/songquanpeng/one-api/relay/apitype"
+)
+
+// SupportsFileInput tells whether the provider reads file parts, the text of the documents is sent to the others
+func SupportsFileInput(apiType int) bool {
+	switch apiType {
+	case apitype.OpenAI, apitype.Anthropic, apitype.AwsClaude, apitype.Gemini, apitype.VertexAI:
+		return true
+	}
+	return false
+}
+
+// SupportsAudioInput tells whether the provider reads input_audio parts
+func SupportsAudioInput(apiType int) bool {
+	switch apiType {
+	case apitype.OpenAI, apitype.Gemini, apitype.VertexAI:
+		return true
+	}
+	return false
+}
@@ -15,8 +15,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common"
-	"github.com/songquanpeng/one-api/common/image"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/media"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/constant"
 	"github.com/songquanpeng/one-api/relay/model"
@@ -36,6 +36,16 @@ func ConvertRequest(request model.GeneralOpenAIRequest) *ChatRequest {
 		},
 		Stream: request.Stream,
 	}
+	if request.ResponseFormat != nil {
+		switch request.ResponseFormat.Type {
+		case "json_object":
+			ollamaRequest.Format = "json"
+		case "json_schema":
+			if request.ResponseFormat.JsonSchema != nil {
+				ollamaRequest.Format = request.ResponseFormat.JsonSchema.Schema
+			}
+		}
+	}
 	for _, message := range request.Messages {
 		openaiContent := message.ParseContent()
 		var imageUrls []string
@@ -43,10 +53,11 @@ func ConvertRequest(request model.GeneralOpenAIRequest) *ChatRequest {
 		for _, part := range openaiContent {
 			switch part.Type {
 			case model.ContentTypeText:
-				contentText = part.Text
+				contentText += part.Text
 			case model.ContentTypeImageURL:
-				_, data, _ := image.GetImageFromUrl(part.ImageURL.Url)
-				imageUrls = append(imageUrls, data)
+				if image, err := media.Fetch(part.ImageURL.Url); err == nil {
+					imageUrls = append(imageUrls, image.Base64())
+				}
 			}
 		}
 		ollamaRequest.Messages = append(ollamaRequest.Messages, Message{
@@ -22,6 +22,8 @@ type ChatRequest struct {
 	Messages []Message `json:"messages,omitempty"`
 	Stream   bool      `json:"stream"`
 	Options  *Options  `json:"options,omitempty"`
+	// Format is "json" or a json schema
+	Format any `json:"format,omitempty"`
 }
 
 type ChatResponse struct {
@@ -11,6 +11,7 @@ import (
 
 	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/adaptor/alibailian"
+	"github.com/songquanpeng/one-api/relay/adaptor/azure"
 	"github.com/songquanpeng/one-api/relay/adaptor/baiduv2"
 	"github.com/songquanpeng/one-api/relay/adaptor/doubao"
 	"github.com/songquanpeng/one-api/relay/adaptor/geminiv2"
@@ -36,7 +37,8 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 		if meta.Mode == relaymode.ImagesGenerations {
 			// https://learn.microsoft.com/en-us/azure/ai-services/openai/dall-e-quickstart?tabs=dalle3%2Ccommand-line&pivots=rest-api
 			// https://{resource_name}.openai.azure.com/openai/deployments/dall-e-3/images/generations?api-version=2024-03-01-preview
-			fullRequestURL := fmt.Sprintf("%s/openai/deployments/%s/images/generations?api-version=%s", meta.BaseURL, meta.ActualModelName, meta.Config.APIVersion)
+			deployment := azure.GetDeploymentName(meta.Config.AzureDeployments, meta.ActualModelName)
+			fullRequestURL := fmt.Sprintf("%s/openai/deployments/%s/images/generations?api-version=%s", meta.BaseURL, deployment, meta.Config.APIVersion)
 			return fullRequestURL, nil
 		}
 
@@ -44,11 +46,9 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 		requestURL := strings.Split(meta.RequestURLPath, "?")[0]
 		requestURL = fmt.Sprintf("%s?api-version=%s", requestURL, meta.Config.APIVersion)
 		task := strings.TrimPrefix(requestURL, "/v1/")
-		model_ := meta.ActualModelName
-		model_ = strings.Replace(model_, ".", "", -1)
-		//https://github.com/songquanpeng/one-api/issues/1191
+		deployment := azure.GetDeploymentName(meta.Config.AzureDeployments, meta.ActualModelName)
 		// {your endpoint}/openai/deployments/{your azure_model}/chat/completions?api-version={api_version}
-		requestURL = fmt.Sprintf("/openai/deployments/%s/%s", model_, task)
+		requestURL = fmt.Sprintf("/openai/deployments/%s/%s", deployment, task)
 		return GetFullRequestURL(meta.BaseURL, requestURL, meta.ChannelType), nil
 	case channeltype.Minimax:
 		return minimax.GetRequestURL(meta)
@@ -70,8 +70,7 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) error {
 	adaptor.SetupCommonRequestHeader(c, req, meta)
 	if meta.ChannelType == channeltype.Azure {
-		req.Header.Set("api-key", meta.APIKey)
-		return nil
+		return azure.SetupAuthHeader(req.Header, meta.ChannelId, azure.GetCredential(meta))
 	}
 	req.Header.Set("Authorization", "Bearer "+meta.APIKey)
 	if meta.ChannelType == channeltype.OpenRouter {
@@ -92,9 +91,54 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 		}
 		request.StreamOptions.IncludeUsage = true
 	}
+	// transforms are applied by the gateway, except for openrouter which knows them
+	if a.ChannelType != channeltype.OpenRouter {
+		request.Transforms = nil
+	}
+	// the safety settings are a gemini extension and the inputs one of the agent apps
+	request.SafetySettings = nil
+	request.Inputs = nil
+	// the cache breakpoints of the tools are claude's, the others reject the unknown field
+	for i := range request.Tools {
+		request.Tools[i].CacheControl = nil
+	}
+	// openrouter passes the ones of the messages to the models caching this way
+	if a.ChannelType != channeltype.OpenRouter {
+		removeMessageCacheControl(request)
+	}
+	// only openrouter understands the reasoning object, the others take reasoning_effort
+	if request.Reasoning != nil && a.ChannelType != channeltype.OpenRouter {
+		effort := request.GetReasoningEffort()
+		if effort == "" {
+			effort = request.GetReasoningEffortByBudget()
+		}
+		if effort != "" {
+			request.ReasoningEffort = &effort
+		}
+		request.Reasoning = nil
+	}
 	return request, nil
 }
 
+// removeMessageCacheControl drops the cache breakpoints of the content parts and of the tool calls
+func removeMessageCacheControl(request *model.GeneralOpenAIRequest) {
+	for i := range request.Messages {
+		message := &request.Messages[i]
+		for j := range message.ToolCalls {
+			message.ToolCalls[j].CacheControl = nil
+		}
+		parts, ok := message.Content.([]any)
+		if !ok {
+			continue
+		}
+		for _, part := range parts {
+			if part, ok := part.(map[string]any); ok {
+				delete(part, "cache_control")
+			}
+		}
+	}
+}
+
 func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
 	if request == nil {
 		return nil, errors.New("request is nil")
@@ -0,0 +1,41 @@
+package openai
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestConvertRequestCacheControl(t *testing.T) {
+	body := `{
+		"model": "claude-3-7-sonnet",
+		"messages": [
+			{"role": "system", "content": [{"type": "text", "text": "The catalogue: ...", "cache_control": {"type": "ephemeral"}}]},
+			{"role": "assistant", "content": "", "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "search", "arguments": "{}"}, "cache_control": {"type": "ephemeral"}}]},
+			{"role": "user", "content": "Which books?"}
+		],
+		"tools": [{"type": "function", "function": {"name": "search"}, "cache_control": {"type": "ephemeral"}}]
+	}`
+	convert := func(channelType int) string {
+		var request model.GeneralOpenAIRequest
+		require.NoError(t, json.Unmarshal([]byte(body), &request))
+		adaptor := &Adaptor{ChannelType: channelType}
+		converted, err := adaptor.ConvertRequest(nil, relaymode.ChatCompletions, &request)
+		require.NoError(t, err)
+		data, err := json.Marshal(converted)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	assert.NotContains(t, convert(channeltype.OpenAI), "cache_control")
+	assert.NotContains(t, convert(channeltype.DeepSeek), "cache_control")
+	// openrouter forwards the breakpoints of the messages to claude
+	converted := convert(channeltype.OpenRouter)
+	assert.Contains(t, converted, `{"cache_control":{"type":"ephemeral"},"text":"The catalogue: ...","type":"text"}`)
+}
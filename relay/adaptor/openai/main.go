@@ -13,6 +13,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/relaymode"
@@ -32,6 +33,7 @@ func StreamHandler(c *gin.Context, resp *http.Response, relayMode int) (*model.E
 
 	common.SetEventStreamHeaders(c)
 
+	excludeReasoning := c.GetBool(ctxkey.ExcludeReasoning)
 	doneRendered := false
 	for scanner.Scan() {
 		data := scanner.Text()
@@ -59,6 +61,12 @@ func StreamHandler(c *gin.Context, resp *http.Response, relayMode int) (*model.E
 				// but for empty choice and no usage, we should not pass it to client, this is for azure
 				continue // just ignore empty choice
 			}
+			for _, choice := range streamResponse.Choices {
+				if choice.Delta.Reasoning != nil || (excludeReasoning && hasReasoning(&choice.Delta)) {
+					data = dataPrefix + string(rewriteReasoning([]byte(data[dataPrefixLength:]), "delta", excludeReasoning))
+					break
+				}
+			}
 			render.StringData(c, data)
 			for _, choice := range streamResponse.Choices {
 				responseText += conv.AsString(choice.Delta.Content)
@@ -116,6 +124,15 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 			StatusCode: resp.StatusCode,
 		}, nil
 	}
+	excludeReasoning := c.GetBool(ctxkey.ExcludeReasoning)
+	rewritten := false
+	for _, choice := range textResponse.Choices {
+		if choice.Message.Reasoning != nil || (excludeReasoning && hasReasoning(&choice.Message)) {
+			responseBody = rewriteReasoning(responseBody, "message", excludeReasoning)
+			rewritten = true
+			break
+		}
+	}
 	// Reset response body
 	resp.Body = io.NopCloser(bytes.NewBuffer(responseBody))
 
@@ -126,6 +143,9 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 	for k, v := range resp.Header {
 		c.Writer.Header().Set(k, v[0])
 	}
+	if rewritten {
+		c.Writer.Header().Del("Content-Length")
+	}
 	c.Writer.WriteHeader(resp.StatusCode)
 	_, err = io.Copy(c.Writer, resp.Body)
 	if err != nil {
@@ -0,0 +1,81 @@
+package openai
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/azure"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+)
+
+// https://platform.openai.com/docs/api-reference/realtime-server-events
+
+type RealtimeUsage struct {
+	TotalTokens       int `json:"total_tokens"`
+	InputTokens       int `json:"input_tokens"`
+	OutputTokens      int `json:"output_tokens"`
+	InputTokenDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+		TextTokens   int `json:"text_tokens"`
+		AudioTokens  int `json:"audio_tokens"`
+	} `json:"input_token_details"`
+	OutputTokenDetails struct {
+		TextTokens  int `json:"text_tokens"`
+		AudioTokens int `json:"audio_tokens"`
+	} `json:"output_token_details"`
+}
+
+type RealtimeEvent struct {
+	Type     string `json:"type"`
+	EventId  string `json:"event_id,omitempty"`
+	Response *struct {
+		Usage *RealtimeUsage `json:"usage"`
+	} `json:"response,omitempty"`
+	Error *RealtimeError `json:"error,omitempty"`
+}
+
+type RealtimeError struct {
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// EventId is the id of the client event which caused the error
+	EventId string `json:"event_id,omitempty"`
+}
+
+// GetRealtimeRequest returns the upstream websocket url & handshake headers
+func GetRealtimeRequest(c *gin.Context, meta *meta.Meta) (string, http.Header, error) {
+	baseURL := strings.TrimSuffix(meta.BaseURL, "/")
+	baseURL = strings.Replace(baseURL, "https://", "wss://", 1)
+	baseURL = strings.Replace(baseURL, "http://", "ws://", 1)
+	header := http.Header{}
+	if meta.ChannelType == channeltype.Azure {
+		// https://learn.microsoft.com/en-us/azure/ai-services/openai/how-to/realtime-audio-websockets
+		if err := azure.SetupAuthHeader(header, meta.ChannelId, azure.GetCredential(meta)); err != nil {
+			return "", nil, err
+		}
+		query := url.Values{}
+		query.Set("api-version", meta.Config.APIVersion)
+		query.Set("deployment", azure.GetDeploymentName(meta.Config.AzureDeployments, meta.ActualModelName))
+		return fmt.Sprintf("%s/openai/realtime?%s", baseURL, query.Encode()), header, nil
+	}
+	header.Set("Authorization", "Bearer "+meta.APIKey)
+	// the beta interface is opted in with a header, browsers can only send it as a subprotocol
+	beta := c.Request.Header.Get("OpenAI-Beta")
+	for _, protocol := range websocket.Subprotocols(c.Request) {
+		if protocol == "openai-beta.realtime-v1" {
+			beta = "realtime=v1"
+		}
+	}
+	if beta != "" {
+		header.Set("OpenAI-Beta", beta)
+	}
+	query := url.Values{}
+	query.Set("model", meta.ActualModelName)
+	return fmt.Sprintf("%s/v1/realtime?%s", baseURL, query.Encode()), header, nil
+}
@@ -0,0 +1,69 @@
+package openai
+
+import (
+	"encoding/json"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// normalizeReasoning moves the reasoning into reasoning_content, all reasoning output is dropped when excluded
+func normalizeReasoning(message *model.Message, exclude bool) {
+	if message.Reasoning != nil {
+		if message.ReasoningContent == nil || message.ReasoningContent == "" {
+			message.ReasoningContent = *message.Reasoning
+		}
+		message.Reasoning = nil
+	}
+	if exclude {
+		message.ReasoningContent = nil
+		message.ReasoningSignature = ""
+	}
+}
+
+func (r *TextResponse) NormalizeReasoning(exclude bool) {
+	for i := range r.Choices {
+		normalizeReasoning(&r.Choices[i].Message, exclude)
+	}
+}
+
+func (r *ChatCompletionsStreamResponse) NormalizeReasoning(exclude bool) {
+	for i := range r.Choices {
+		normalizeReasoning(&r.Choices[i].Delta, exclude)
+	}
+}
+
+func hasReasoning(message *model.Message) bool {
+	return message.Reasoning != nil || (message.ReasoningContent != nil && message.ReasoningContent != "")
+}
+
+// rewriteReasoning normalizes the reasoning of a raw upstream response, key is "message" or "delta".
+// The response is decoded as a map so that fields unknown to us are kept.
+func rewriteReasoning(data []byte, key string, exclude bool) []byte {
+	var response map[string]any
+	if err := json.Unmarshal(data, &response); err != nil {
+		return data
+	}
+	choices, _ := response["choices"].([]any)
+	for _, choice := range choices {
+		choiceMap, _ := choice.(map[string]any)
+		message, _ := choiceMap[key].(map[string]any)
+		if message == nil {
+			continue
+		}
+		if reasoning, ok := message["reasoning"]; ok {
+			if content, _ := message["reasoning_content"].(string); content == "" && reasoning != nil {
+				message["reasoning_content"] = reasoning
+			}
+			delete(message, "reasoning")
+		}
+		if exclude {
+			delete(message, "reasoning_content")
+			delete(message, "reasoning_signature")
+		}
+	}
+	rewritten, err := json.Marshal(response)
+	if err != nil {
+		return data
+	}
+	return rewritten
+}
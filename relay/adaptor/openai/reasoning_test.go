@@ -0,0 +1,118 @@
+package openai
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestRewriteReasoning(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		data     string
+		key      string
+		exclude  bool
+		expected string
+	}{
+		{
+			name:     "reasoning is renamed",
+			data:     `{"id": "1", "choices": [{"index": 0, "message": {"role": "assistant", "content": "4", "reasoning": "2+2", "refusal": null}}]}`,
+			key:      "message",
+			expected: `{"id": "1", "choices": [{"index": 0, "message": {"role": "assistant", "content": "4", "reasoning_content": "2+2", "refusal": null}}]}`,
+		},
+		{
+			name:     "reasoning content is kept",
+			data:     `{"choices": [{"delta": {"reasoning": "a", "reasoning_content": "b"}}]}`,
+			key:      "delta",
+			expected: `{"choices": [{"delta": {"reasoning_content": "b"}}]}`,
+		},
+		{
+			name:     "excluded",
+			data:     `{"choices": [{"delta": {"content": "4", "reasoning_content": "2+2", "reasoning_signature": "sig"}}]}`,
+			key:      "delta",
+			exclude:  true,
+			expected: `{"choices": [{"delta": {"content": "4"}}]}`,
+		},
+		{
+			name:     "invalid json is passed through",
+			data:     `{"choices": [`,
+			key:      "message",
+			expected: `{"choices": [`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rewritten := rewriteReasoning([]byte(tc.data), tc.key, tc.exclude)
+			if !json.Valid([]byte(tc.expected)) {
+				assert.Equal(t, tc.expected, string(rewritten))
+				return
+			}
+			assert.JSONEq(t, tc.expected, string(rewritten))
+		})
+	}
+}
+
+func TestNormalizeReasoning(t *testing.T) {
+	reasoning := "2+2"
+	response := TextResponse{Choices: []TextResponseChoice{{Message: model.Message{Content: "4", Reasoning: &reasoning}}}}
+	response.NormalizeReasoning(false)
+	assert.Nil(t, response.Choices[0].Message.Reasoning)
+	assert.Equal(t, "2+2", response.Choices[0].Message.ReasoningContent)
+
+	stream := ChatCompletionsStreamResponse{Choices: []ChatCompletionsStreamResponseChoice{{Delta: model.Message{ReasoningContent: "2+2", ReasoningSignature: "sig"}}}}
+	stream.NormalizeReasoning(true)
+	assert.Nil(t, stream.Choices[0].Delta.ReasoningContent)
+	assert.Empty(t, stream.Choices[0].Delta.ReasoningSignature)
+}
+
+func TestConvertReasoningRequest(t *testing.T) {
+	effort := "high"
+	newRequest := func() *model.GeneralOpenAIRequest {
+		return &model.GeneralOpenAIRequest{Model: "o3-mini", Reasoning: &model.Reasoning{Effort: &effort}}
+	}
+
+	adaptor := &Adaptor{ChannelType: channeltype.OpenAI}
+	converted, err := adaptor.ConvertRequest(nil, relaymode.ChatCompletions, newRequest())
+	require.NoError(t, err)
+	request := converted.(*model.GeneralOpenAIRequest)
+	assert.Nil(t, request.Reasoning)
+	require.NotNil(t, request.ReasoningEffort)
+	assert.Equal(t, "high", *request.ReasoningEffort)
+
+	// the budget is mapped to an effort by its share of the max tokens
+	budget := 3000
+	for _, tc := range []struct {
+		maxTokens int
+		expected  string
+	}{
+		{maxTokens: 20000, expected: "low"},
+		{maxTokens: 5000, expected: "medium"},
+		{maxTokens: 3200, expected: "high"},
+		{maxTokens: 0, expected: "medium"},
+	} {
+		adaptor = &Adaptor{ChannelType: channeltype.DeepSeek}
+		converted, err = adaptor.ConvertRequest(nil, relaymode.ChatCompletions, &model.GeneralOpenAIRequest{
+			Model:     "o3-mini",
+			MaxTokens: tc.maxTokens,
+			Reasoning: &model.Reasoning{MaxTokens: &budget},
+		})
+		require.NoError(t, err)
+		request = converted.(*model.GeneralOpenAIRequest)
+		assert.Nil(t, request.Reasoning)
+		require.NotNil(t, request.ReasoningEffort)
+		assert.Equal(t, tc.expected, *request.ReasoningEffort, tc.maxTokens)
+	}
+
+	// openrouter takes the reasoning object as it is
+	adaptor = &Adaptor{ChannelType: channeltype.OpenRouter}
+	converted, err = adaptor.ConvertRequest(nil, relaymode.ChatCompletions, newRequest())
+	require.NoError(t, err)
+	request = converted.(*model.GeneralOpenAIRequest)
+	require.NotNil(t, request.Reasoning)
+	assert.Nil(t, request.ReasoningEffort)
+}
@@ -0,0 +1,73 @@
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/alibailian"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+type RerankRequest struct {
+	Model           string   `json:"model"`
+	Query           string   `json:"query"`
+	Documents       []string `json:"documents"`
+	TopN            int      `json:"top_n,omitempty"`
+	ReturnDocuments *bool    `json:"return_documents,omitempty"`
+}
+
+// RerankResponse covers the jina style rerank api, siliconflow reports usage as tokens
+//
+// https://jina.ai/reranker/
+// https://docs.siliconflow.cn/api-reference/rerank/create-rerank
+type RerankResponse struct {
+	Id      string               `json:"id"`
+	Model   string               `json:"model"`
+	Results []model.RerankResult `json:"results"`
+	Usage   *model.Usage         `json:"usage"`
+	Tokens  *struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"tokens"`
+}
+
+func (a *Adaptor) ConvertRerankRequest(meta *meta.Meta, request *model.RerankRequest) (any, error) {
+	switch meta.ChannelType {
+	case channeltype.OpenAI, channeltype.Azure:
+		return nil, fmt.Errorf("channel type %d does not support rerank", meta.ChannelType)
+	case channeltype.AliBailian:
+		return alibailian.ConvertRerankRequest(*request), nil
+	}
+	return &RerankRequest{
+		Model:           request.Model,
+		Query:           request.Query,
+		Documents:       request.GetDocuments(),
+		TopN:            request.TopN,
+		ReturnDocuments: request.ReturnDocuments,
+	}, nil
+}
+
+func (a *Adaptor) ConvertRerankResponse(meta *meta.Meta, responseBody []byte) (*model.RerankResponse, error) {
+	if meta.ChannelType == channeltype.AliBailian {
+		return alibailian.ConvertRerankResponse(responseBody)
+	}
+	var rerankResponse RerankResponse
+	if err := json.Unmarshal(responseBody, &rerankResponse); err != nil {
+		return nil, err
+	}
+	response := model.RerankResponse{
+		Id:      rerankResponse.Id,
+		Model:   rerankResponse.Model,
+		Results: rerankResponse.Results,
+	}
+	if rerankResponse.Usage != nil {
+		response.Usage.PromptTokens = rerankResponse.Usage.TotalTokens
+		response.Usage.TotalTokens = rerankResponse.Usage.TotalTokens
+	} else if rerankResponse.Tokens != nil {
+		response.Usage.PromptTokens = rerankResponse.Tokens.InputTokens
+		response.Usage.TotalTokens = rerankResponse.Tokens.InputTokens + rerankResponse.Tokens.OutputTokens
+	}
+	return &response, nil
+}
@@ -0,0 +1,72 @@
+package openai
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/alibailian"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func newRerankRequest() *model.RerankRequest {
+	returnDocuments := true
+	return &model.RerankRequest{
+		Model:           "bge-reranker-v2-m3",
+		Query:           "q",
+		Documents:       []any{"a", map[string]any{"text": "b"}},
+		TopN:            2,
+		ReturnDocuments: &returnDocuments,
+	}
+}
+
+func TestConvertRerankRequest(t *testing.T) {
+	adaptor := &Adaptor{}
+	converted, err := adaptor.ConvertRerankRequest(&meta.Meta{ChannelType: channeltype.SiliconFlow}, newRerankRequest())
+	require.NoError(t, err)
+	data, err := json.Marshal(converted)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"model":"bge-reranker-v2-m3","query":"q","documents":["a","b"],"top_n":2,"return_documents":true}`, string(data))
+
+	converted, err = adaptor.ConvertRerankRequest(&meta.Meta{ChannelType: channeltype.AliBailian}, newRerankRequest())
+	require.NoError(t, err)
+	require.IsType(t, &alibailian.RerankRequest{}, converted)
+	data, err = json.Marshal(converted)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"model":"bge-reranker-v2-m3","input":{"query":"q","documents":["a","b"]},"parameters":{"return_documents":true,"top_n":2}}`, string(data))
+
+	_, err = adaptor.ConvertRerankRequest(&meta.Meta{ChannelType: channeltype.OpenAI}, newRerankRequest())
+	assert.Error(t, err)
+}
+
+func TestConvertRerankResponse(t *testing.T) {
+	adaptor := &Adaptor{}
+	response, err := adaptor.ConvertRerankResponse(&meta.Meta{ChannelType: channeltype.SiliconFlow},
+		[]byte(`{"id":"r1","results":[{"index":1,"relevance_score":0.9,"document":{"text":"b"}}],"tokens":{"input_tokens":10,"output_tokens":2}}`))
+	require.NoError(t, err)
+	assert.Equal(t, "r1", response.Id)
+	require.Len(t, response.Results, 1)
+	assert.Equal(t, 1, response.Results[0].Index)
+	assert.Equal(t, "b", response.Results[0].Document.Text)
+	assert.Equal(t, model.RerankUsage{PromptTokens: 10, TotalTokens: 12}, response.Usage)
+
+	// jina reports usage like the chat api
+	response, err = adaptor.ConvertRerankResponse(&meta.Meta{ChannelType: channeltype.Custom},
+		[]byte(`{"model":"jina-reranker-v2","results":[{"index":0,"relevance_score":0.5}],"usage":{"total_tokens":7}}`))
+	require.NoError(t, err)
+	assert.Equal(t, model.RerankUsage{PromptTokens: 7, TotalTokens: 7}, response.Usage)
+
+	response, err = adaptor.ConvertRerankResponse(&meta.Meta{ChannelType: channeltype.AliBailian},
+		[]byte(`{"output":{"results":[{"index":0,"relevance_score":0.8}]},"usage":{"total_tokens":5},"request_id":"req"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "req", response.Id)
+	assert.Equal(t, model.RerankUsage{PromptTokens: 5, TotalTokens: 5}, response.Usage)
+
+	_, err = adaptor.ConvertRerankResponse(&meta.Meta{ChannelType: channeltype.AliBailian},
+		[]byte(`{"code":"InvalidParameter","message":"bad documents"}`))
+	assert.EqualError(t, err, "bad documents")
+}
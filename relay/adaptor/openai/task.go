@@ -0,0 +1,29 @@
+package openai
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/doubao"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// OpenAI has no video task api yet, only the compatible channels with one are dispatched
+
+func (a *Adaptor) SubmitTask(meta *meta.Meta, request *model.VideoRequest) (string, *model.ErrorWithStatusCode) {
+	switch meta.ChannelType {
+	case channeltype.Doubao:
+		return doubao.SubmitTask(meta, request)
+	}
+	return "", ErrorWrapper(fmt.Errorf("video generations are not supported by channel type %d", meta.ChannelType), "task_not_supported", http.StatusBadRequest)
+}
+
+func (a *Adaptor) FetchTask(meta *meta.Meta, upstreamId string) (*model.TaskResult, error) {
+	switch meta.ChannelType {
+	case channeltype.Doubao:
+		return doubao.FetchTask(meta, upstreamId)
+	}
+	return nil, fmt.Errorf("video generations are not supported by channel type %d", meta.ChannelType)
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/songquanpeng/one-api/common/logger"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/tokenizer"
 )
 
 // tokenEncoderMap won't grow after initialization
@@ -31,6 +32,7 @@ func InitTokenEncoders() {
 	if err != nil {
 		logger.FatalLog(fmt.Sprintf("failed to get gpt-4o token encoder: %s", err.Error()))
 	}
+	tokenizer.Init(gpt35TokenEncoder, gpt4oTokenEncoder)
 	gpt4TokenEncoder, err := tiktoken.EncodingForModel("gpt-4")
 	if err != nil {
 		logger.FatalLog(fmt.Sprintf("failed to get gpt-4 token encoder: %s", err.Error()))
@@ -66,15 +68,36 @@ func getTokenEncoder(model string) *tiktoken.Tiktoken {
 	return defaultTokenEncoder
 }
 
-func getTokenNum(tokenEncoder *tiktoken.Tiktoken, text string) int {
+func getEncodingName(model string) string {
+	if name, ok := tiktoken.MODEL_TO_ENCODING[model]; ok {
+		return name
+	}
+	for prefix, name := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		if strings.HasPrefix(model, prefix) {
+			return name
+		}
+	}
+	// same as the default encoder
+	return tiktoken.MODEL_CL100K_BASE
+}
+
+// GetTokenizer returns the tokenizer of the model family, openai and unknown models use tiktoken
+func GetTokenizer(model string) tokenizer.Tokenizer {
+	if t := tokenizer.Get(model); t != nil {
+		return t
+	}
+	return tokenizer.NewTiktoken(getEncodingName(model), getTokenEncoder(model))
+}
+
+func getTokenNum(t tokenizer.Tokenizer, text string) int {
 	if config.ApproximateTokenEnabled {
 		return int(float64(len(text)) * 0.38)
 	}
-	return len(tokenEncoder.Encode(text, nil, nil))
+	return t.Count(text)
 }
 
 func CountTokenMessages(messages []model.Message, model string) int {
-	tokenEncoder := getTokenEncoder(model)
+	tokenEncoder := GetTokenizer(model)
 	// Reference:
 	// https://github.com/openai/openai-cookbook/blob/main/examples/How_to_count_tokens_with_tiktoken.ipynb
 	// https://github.com/pkoukk/tiktoken-go/issues/6
@@ -226,7 +249,7 @@ func CountTokenInput(input any, model string) int {
 }
 
 func CountTokenText(text string, model string) int {
-	tokenEncoder := getTokenEncoder(model)
+	tokenEncoder := GetTokenizer(model)
 	return getTokenNum(tokenEncoder, text)
 }
 
@@ -10,6 +10,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
+	"github.com/songquanpeng/one-api/common/image"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
@@ -23,7 +24,13 @@ type Adaptor struct {
 }
 
 // ConvertImageRequest implements adaptor.Adaptor.
-func (*Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
+func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
+	switch a.meta.Mode {
+	case relaymode.ImagesEdits:
+		return convertImageEditRequest(request)
+	case relaymode.ImagesVariations:
+		return convertImageVariationRequest(request)
+	}
 	return DrawImageRequest{
 		Input: ImageInput{
 			Steps:           25,
@@ -39,6 +46,54 @@ func (*Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
 	}, nil
 }
 
+// convertImageEditRequest inpaints the image with flux fill
+func convertImageEditRequest(request *model.ImageRequest) (any, error) {
+	if !strings.Contains(request.Model, "flux-fill") {
+		return nil, fmt.Errorf("image edits are %w by model %s", adaptor.ErrUnsupportedRequest, request.Model)
+	}
+	img, err := image.GetImageDataURLFromFileHeader(request.Image)
+	if err != nil {
+		return nil, errors.Wrap(err, "read image")
+	}
+	var mask string
+	if request.Mask != nil {
+		if mask, err = image.GetImageDataURLFromFileHeader(request.Mask); err != nil {
+			return nil, errors.Wrap(err, "read mask")
+		}
+	}
+	return InpaintingImageByFlusReplicateRequest{
+		Input: FluxInpaintingInput{
+			Mask:            mask,
+			Image:           img,
+			Seed:            int(time.Now().UnixNano()),
+			Steps:           50,
+			Prompt:          request.Prompt,
+			Guidance:        3,
+			OutputFormat:    "png",
+			SafetyTolerance: 5,
+		},
+	}, nil
+}
+
+// convertImageVariationRequest makes a variation of the image with flux redux
+func convertImageVariationRequest(request *model.ImageRequest) (any, error) {
+	if !strings.Contains(request.Model, "flux-redux") {
+		return nil, fmt.Errorf("image variations are %w by model %s", adaptor.ErrUnsupportedRequest, request.Model)
+	}
+	img, err := image.GetImageDataURLFromFileHeader(request.Image)
+	if err != nil {
+		return nil, errors.Wrap(err, "read image")
+	}
+	return ReduxImageRequest{
+		Input: ReduxImageInput{
+			ReduxImage:   img,
+			AspectRatio:  "1:1",
+			NumOutputs:   1, // replicate will always return 1 image
+			OutputFormat: "png",
+		},
+	}, nil
+}
+
 func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.GeneralOpenAIRequest) (any, error) {
 	if !request.Stream {
 		// TODO: support non-stream mode
@@ -106,6 +161,10 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) error {
 	adaptor.SetupCommonRequestHeader(c, req, meta)
 	req.Header.Set("Authorization", "Bearer "+meta.APIKey)
+	if meta.Mode == relaymode.ImagesEdits || meta.Mode == relaymode.ImagesVariations {
+		// the client sent multipart, the converted request is json
+		req.Header.Set("Content-Type", "application/json")
+	}
 	return nil
 }
 
@@ -116,7 +175,9 @@ func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Read
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
 	switch meta.Mode {
-	case relaymode.ImagesGenerations:
+	case relaymode.ImagesGenerations,
+		relaymode.ImagesEdits,
+		relaymode.ImagesVariations:
 		err, usage = ImageHandler(c, resp)
 	case relaymode.ChatCompletions:
 		err, usage = ChatHandler(c, resp)
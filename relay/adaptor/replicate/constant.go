@@ -54,5 +54,9 @@ var ModelList = []string{
 	// -------------------------------------
 	// video model
 	// -------------------------------------
-	// "minimax/video-01",  // TODO: implement the adaptor
+	"minimax/video-01",
+	"minimax/hailuo-02",
+	"kwaivgi/kling-v2.1",
+	"wan-video/wan-2.1-t2v-480p",
+	"wan-video/wan-2.1-i2v-480p",
 }
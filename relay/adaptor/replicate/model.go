@@ -41,7 +41,7 @@ type InpaintingImageByFlusReplicateRequest struct {
 //
 // https://replicate.com/black-forest-labs/flux-fill-pro/api/schema
 type FluxInpaintingInput struct {
-	Mask             string `json:"mask" binding:"required"`
+	Mask             string `json:"mask,omitempty"`
 	Image            string `json:"image" binding:"required"`
 	Seed             int    `json:"seed"`
 	Steps            int    `json:"steps" binding:"required,min=1"`
@@ -52,6 +52,21 @@ type FluxInpaintingInput struct {
 	PromptUnsampling bool   `json:"prompt_unsampling"`
 }
 
+// ReduxImageRequest is request to make variations of an image by flux redux
+//
+// https://replicate.com/black-forest-labs/flux-redux-dev/api/schema
+type ReduxImageRequest struct {
+	Input ReduxImageInput `json:"input"`
+}
+
+// ReduxImageInput is input of ReduxImageRequest
+type ReduxImageInput struct {
+	ReduxImage   string `json:"redux_image" binding:"required"`
+	AspectRatio  string `json:"aspect_ratio"`
+	NumOutputs   int    `json:"num_outputs"`
+	OutputFormat string `json:"output_format"`
+}
+
 // ImageResponse is response of DrawImageByFluxProRequest
 //
 // https://replicate.com/black-forest-labs/flux-pro?prediction=kg1krwsdf9rg80ch1sgsrgq7h8&output=json
@@ -157,3 +172,21 @@ type ChatResponseUrl struct {
 	Get    string `json:"get"`
 	Cancel string `json:"cancel"`
 }
+
+// VideoInput is the input of the video models, the image goes under the key the model reads
+type VideoInput map[string]any
+
+type VideoRequest struct {
+	Input VideoInput `json:"input"`
+}
+
+// VideoResponse is the prediction of a video model
+//
+// https://replicate.com/docs/reference/http#predictions.get
+type VideoResponse struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  any    `json:"error"`
+	// Output could be `string` or `[]string`
+	Output any `json:"output"`
+}
@@ -0,0 +1,81 @@
+package replicate
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// videoImageKey is the input the video models read the first frame from
+func videoImageKey(modelName string) string {
+	switch {
+	case strings.HasPrefix(modelName, "minimax/"):
+		return "first_frame_image"
+	case strings.HasPrefix(modelName, "kwaivgi/"):
+		return "start_image"
+	}
+	return "image"
+}
+
+func (a *Adaptor) SubmitTask(meta *meta.Meta, request *model.VideoRequest) (string, *model.ErrorWithStatusCode) {
+	input := VideoInput{"prompt": request.Prompt}
+	if request.Image != "" {
+		input[videoImageKey(meta.ActualModelName)] = request.Image
+	}
+	if request.Duration > 0 {
+		input["duration"] = request.Duration
+	}
+	if request.NegativePrompt != "" {
+		input["negative_prompt"] = request.NegativePrompt
+	}
+	if request.Seed != nil {
+		input["seed"] = *request.Seed
+	}
+	var replicateResponse VideoResponse
+	err := adaptor.DoJSONRequest(http.MethodPost,
+		fmt.Sprintf("https://api.replicate.com/v1/models/%s/predictions", meta.ActualModelName),
+		map[string]string{"Authorization": "Bearer " + meta.APIKey}, VideoRequest{Input: input}, &replicateResponse)
+	if err != nil {
+		return "", adaptor.UpstreamErrorWrapper(err, "replicate_submit_task_failed")
+	}
+	if replicateResponse.ID == "" {
+		return "", adaptor.UpstreamErrorWrapper(errors.New("no prediction id in the response"), "replicate_submit_task_failed")
+	}
+	return replicateResponse.ID, nil
+}
+
+func (a *Adaptor) FetchTask(meta *meta.Meta, upstreamId string) (*model.TaskResult, error) {
+	var replicateResponse VideoResponse
+	err := adaptor.DoJSONRequest(http.MethodGet, fmt.Sprintf("https://api.replicate.com/v1/predictions/%s", upstreamId),
+		map[string]string{"Authorization": "Bearer " + meta.APIKey}, nil, &replicateResponse)
+	if err != nil {
+		return nil, err
+	}
+	result := &model.TaskResult{}
+	switch replicateResponse.Status {
+	case "starting":
+		result.Status = model.TaskStatusQueued
+	case "processing":
+		result.Status = model.TaskStatusInProgress
+	case "succeeded":
+		result.Status = model.TaskStatusSucceeded
+		result.Outputs, err = (&ImageResponse{Output: replicateResponse.Output}).GetOutput()
+		if err != nil {
+			return nil, errors.Wrap(err, "get output")
+		}
+	case "failed", "canceled":
+		result.Status = model.TaskStatusFailed
+		result.Error = "prediction " + replicateResponse.Status
+		if replicateResponse.Error != nil {
+			result.Error = fmt.Sprint(replicateResponse.Error)
+		}
+	default:
+		return nil, errors.Errorf("unknown prediction status %q", replicateResponse.Status)
+	}
+	return result, nil
+}
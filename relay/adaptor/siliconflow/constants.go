@@ -22,6 +22,8 @@ var ModelList = []string{
 	"internlm/internlm2_5-7b-chat",
 	"BAAI/bge-large-en-v1.5",
 	"BAAI/bge-large-zh-v1.5",
+	"BAAI/bge-reranker-v2-m3",
+	"netease-youdao/bce-reranker-base_v1",
 	"Pro/Qwen/Qwen2-7B-Instruct",
 	"Pro/Qwen/Qwen2-1.5B-Instruct",
 	"Pro/Qwen/Qwen1.5-7B-Chat",
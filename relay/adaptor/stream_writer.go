@@ -0,0 +1,207 @@
+package adaptor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+var finishReasons = map[string]string{
+	"stop":                 "stop",
+	"end_turn":             "stop",
+	"stop_sequence":        "stop",
+	"complete":             "stop",
+	"finish":               "stop",
+	"normal":               "stop",
+	"eos":                  "stop",
+	"finish_reason_stop":   "stop",
+	"length":               "length",
+	"max_tokens":           "length",
+	"model_length":         "length",
+	"tool_calls":           "tool_calls",
+	"tool_use":             "tool_calls",
+	"function_call":        "function_call",
+	"content_filter":       "content_filter",
+	"safety":               "content_filter",
+	"recitation":           "content_filter",
+	"blocklist":            "content_filter",
+	"prohibited_content":   "content_filter",
+	"spii":                 "content_filter",
+	"sensitive":            "content_filter",
+	"content_filtered":     "content_filter",
+	"guardrail_intervened": "content_filter",
+}
+
+// MapFinishReason turns the stop reasons of the providers into the finish reasons of openai, unknown ones are "stop"
+func MapFinishReason(reason string) string {
+	if mapped, ok := finishReasons[strings.ToLower(reason)]; ok {
+		return mapped
+	}
+	return "stop"
+}
+
+// StreamWriter is put in front of the stream handlers of the adaptors, so that chat completion streams have the
+// same shape whichever channel serves them. Every chunk gets the same id, created, model and system_fingerprint,
+// finish reasons are mapped to the ones of openai, and the usage is sent in a final chunk only when the client
+// asked for it with stream_options.include_usage.
+type StreamWriter struct {
+	gin.ResponseWriter
+	meta        *meta.Meta
+	line        bytes.Buffer
+	id          string
+	created     int64
+	model       string
+	fingerprint string
+	usage       *model.Usage
+	started     bool
+}
+
+// NewStreamWriter installs the writer on the context until Finish is called
+func NewStreamWriter(c *gin.Context, meta *meta.Meta) *StreamWriter {
+	hash := fnv.New32a()
+	_, _ = fmt.Fprintf(hash, "%d/%s", meta.ChannelId, meta.ActualModelName)
+	w := &StreamWriter{
+		ResponseWriter: c.Writer,
+		meta:           meta,
+		created:        meta.StartTime.Unix(),
+		fingerprint:    fmt.Sprintf("fp_%08x", hash.Sum32()),
+	}
+	c.Writer = w
+	return w
+}
+
+func (w *StreamWriter) Write(data []byte) (int, error) {
+	w.line.Write(data)
+	for {
+		i := bytes.IndexByte(w.line.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		if err := w.writeLine(strings.TrimRight(string(w.line.Next(i+1)), "\r\n")); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *StreamWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *StreamWriter) writeLine(line string) error {
+	if line == "" {
+		// events are terminated when they are written
+		return nil
+	}
+	if !strings.HasPrefix(line, "data:") {
+		_, err := w.ResponseWriter.WriteString(line + "\n")
+		return err
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if data == "[DONE]" {
+		// sent by Finish, after the usage
+		return nil
+	}
+	var chunk map[string]any
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return w.writeEvent(data)
+	}
+	if _, ok := chunk["error"]; ok {
+		return w.writeEvent(data)
+	}
+	if usage, ok := chunk["usage"]; ok && usage != nil {
+		var u model.Usage
+		if usageJSON, err := json.Marshal(usage); err == nil && json.Unmarshal(usageJSON, &u) == nil {
+			w.usage = &u
+		}
+		delete(chunk, "usage")
+	}
+	choices, _ := chunk["choices"].([]any)
+	if len(choices) == 0 {
+		// the usage chunk of the upstream, the final one is sent by Finish
+		return nil
+	}
+	for _, choice := range choices {
+		choiceMap, _ := choice.(map[string]any)
+		if reason, ok := choiceMap["finish_reason"].(string); ok {
+			if reason == "" {
+				choiceMap["finish_reason"] = nil
+			} else {
+				choiceMap["finish_reason"] = MapFinishReason(reason)
+			}
+		}
+	}
+	w.normalize(chunk)
+	normalized, err := json.Marshal(chunk)
+	if err != nil {
+		return w.writeEvent(data)
+	}
+	return w.writeEvent(string(normalized))
+}
+
+// normalize keeps the first id, model and fingerprint given by the upstream for the whole stream
+func (w *StreamWriter) normalize(chunk map[string]any) {
+	if w.id == "" {
+		w.id, _ = chunk["id"].(string)
+		if w.id == "" {
+			w.id = "chatcmpl-" + random.GetUUID()
+		}
+	}
+	if w.model == "" {
+		w.model, _ = chunk["model"].(string)
+		if w.model == "" {
+			w.model = w.meta.ActualModelName
+		}
+	}
+	if fingerprint, _ := chunk["system_fingerprint"].(string); fingerprint != "" && !w.started {
+		w.fingerprint = fingerprint
+	}
+	chunk["id"] = w.id
+	chunk["object"] = "chat.completion.chunk"
+	chunk["created"] = w.created
+	chunk["model"] = w.model
+	chunk["system_fingerprint"] = w.fingerprint
+}
+
+func (w *StreamWriter) writeEvent(data string) error {
+	w.started = true
+	_, err := w.ResponseWriter.WriteString("data: " + data + "\n\n")
+	return err
+}
+
+// Finish puts back the original writer and ends the stream: with an error event if the handler failed, else with
+// the usage chunk when it was asked for, then [DONE]. It returns false when nothing was sent, in which case the
+// error can still be sent as a normal response.
+func (w *StreamWriter) Finish(c *gin.Context, usage *model.Usage, err *model.ErrorWithStatusCode) bool {
+	c.Writer = w.ResponseWriter
+	if w.line.Len() > 0 {
+		_ = w.writeLine(w.line.String())
+		w.line.Reset()
+	}
+	if !w.started && !w.Written() {
+		return false
+	}
+	if err != nil {
+		event, _ := json.Marshal(map[string]any{"error": err.Error})
+		_ = w.writeEvent(string(event))
+	} else if w.meta.IncludeUsage {
+		if usage == nil {
+			usage = w.usage
+		}
+		chunk := map[string]any{"choices": []any{}, "usage": usage}
+		w.normalize(chunk)
+		event, _ := json.Marshal(chunk)
+		_ = w.writeEvent(string(event))
+	}
+	_ = w.writeEvent("[DONE]")
+	w.Flush()
+	return true
+}
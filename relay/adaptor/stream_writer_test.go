@@ -0,0 +1,170 @@
+package adaptor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func newStreamWriterTest(includeUsage bool) (*gin.Context, *httptest.ResponseRecorder, *StreamWriter) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	relayMeta := &meta.Meta{
+		ChannelId:       1,
+		ActualModelName: "claude-3-5-haiku",
+		StartTime:       time.Unix(1700000000, 0),
+		IncludeUsage:    includeUsage,
+	}
+	return c, w, NewStreamWriter(c, relayMeta)
+}
+
+// events parses the data of the events written to the client, [DONE] is kept as is
+func events(t *testing.T, body string) []map[string]any {
+	var result []map[string]any
+	for _, event := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		data := strings.TrimPrefix(event, "data: ")
+		if data == "[DONE]" {
+			result = append(result, map[string]any{"done": true})
+			continue
+		}
+		var chunk map[string]any
+		require.NoError(t, json.Unmarshal([]byte(data), &chunk), event)
+		result = append(result, chunk)
+	}
+	return result
+}
+
+func TestMapFinishReason(t *testing.T) {
+	for reason, expected := range map[string]string{
+		"stop":           "stop",
+		"end_turn":       "stop",
+		"STOP":           "stop",
+		"max_tokens":     "length",
+		"MAX_TOKENS":     "length",
+		"tool_use":       "tool_calls",
+		"function_call":  "function_call",
+		"SAFETY":         "content_filter",
+		"content_filter": "content_filter",
+		"something_new":  "stop",
+		"":               "stop",
+	} {
+		assert.Equal(t, expected, MapFinishReason(reason), reason)
+	}
+}
+
+func TestStreamWriterWriteLine(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		line     string
+		expected string
+		usage    *model.Usage
+	}{
+		{"empty", "", "", nil},
+		{"other field", "event: ping", "event: ping\n", nil},
+		{"done", "data: [DONE]", "", nil},
+		{"not json", "data: not json", "data: not json\n\n", nil},
+		{"error", `data: {"error": {"message": "overloaded"}}`, `data: {"error": {"message": "overloaded"}}` + "\n\n", nil},
+		{"usage", `data: {"id": "msg_1", "choices": [], "usage": {"prompt_tokens": 3, "completion_tokens": 2, "total_tokens": 5}}`, "", &model.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5}},
+		{
+			"content",
+			`data: {"id": "msg_1", "model": "claude-3-5-haiku-20241022", "choices": [{"index": 0, "delta": {"content": "Hi"}, "finish_reason": "end_turn"}]}`,
+			`data: {"choices":[{"delta":{"content":"Hi"},"finish_reason":"stop","index":0}],"created":1700000000,"id":"msg_1",` +
+				`"model":"claude-3-5-haiku-20241022","object":"chat.completion.chunk","system_fingerprint":"FP"}` + "\n\n",
+			nil,
+		},
+		{
+			"empty finish reason",
+			`data: {"choices": [{"index": 0, "delta": {"content": "Hi"}, "finish_reason": ""}]}`,
+			`data: {"choices":[{"delta":{"content":"Hi"},"finish_reason":null,"index":0}],"created":1700000000,"id":"ID",` +
+				`"model":"claude-3-5-haiku","object":"chat.completion.chunk","system_fingerprint":"FP"}` + "\n\n",
+			nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, w, writer := newStreamWriterTest(false)
+			require.NoError(t, writer.writeLine(tc.line))
+			expected := strings.ReplaceAll(tc.expected, "FP", writer.fingerprint)
+			expected = strings.ReplaceAll(expected, `"ID"`, `"`+writer.id+`"`)
+			assert.Equal(t, expected, w.Body.String())
+			assert.Equal(t, tc.usage, writer.usage)
+		})
+	}
+}
+
+func TestStreamWriterFinish(t *testing.T) {
+	content := "data: " + `{"id": "msg_1", "choices": [{"index": 0, "delta": {"content": "Hi"}}]}` + "\n\n"
+	finish := "data: " + `{"id": "msg_1", "choices": [{"index": 0, "delta": {}, "finish_reason": "end_turn"}]}` + "\n\n"
+	usage := "data: " + `{"id": "msg_1", "choices": [], "usage": {"prompt_tokens": 3, "completion_tokens": 2, "total_tokens": 5}}` + "\n\n"
+	done := "data: [DONE]\n\n"
+	for _, tc := range []struct {
+		name         string
+		includeUsage bool
+		stream       string
+		usage        *model.Usage
+		err          *model.ErrorWithStatusCode
+		// expected lists the events, "usage" stands for the usage chunk and "error" for the error event
+		expected []string
+	}{
+		{"done is sent once", false, content + finish + usage + done, nil, nil, []string{"Hi", "stop", "done"}},
+		{"usage of the upstream", true, content + finish + usage + done, nil, nil, []string{"Hi", "stop", "usage:5", "done"}},
+		{"usage of the handler", true, content + finish, &model.Usage{TotalTokens: 9}, nil, []string{"Hi", "stop", "usage:9", "done"}},
+		{"last line without newline", false, content + strings.TrimSuffix(finish, "\n\n"), nil, nil, []string{"Hi", "stop", "done"}},
+		{
+			"error as last event", true, content + usage, nil,
+			&model.ErrorWithStatusCode{Error: model.Error{Message: "upstream closed", Type: "upstream_error"}, StatusCode: http.StatusBadGateway},
+			[]string{"Hi", "error:upstream closed", "done"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, w, writer := newStreamWriterTest(tc.includeUsage)
+			_, err := c.Writer.WriteString(tc.stream)
+			require.NoError(t, err)
+			require.True(t, writer.Finish(c, tc.usage, tc.err))
+			assert.Same(t, writer.ResponseWriter, c.Writer)
+
+			var got []string
+			for _, event := range events(t, w.Body.String()) {
+				switch {
+				case event["done"] == true:
+					got = append(got, "done")
+				case event["error"] != nil:
+					got = append(got, "error:"+event["error"].(map[string]any)["message"].(string))
+				case event["usage"] != nil:
+					got = append(got, "usage:"+jsonNumber(event["usage"].(map[string]any)["total_tokens"]))
+					assert.Equal(t, "msg_1", event["id"])
+				default:
+					choice := event["choices"].([]any)[0].(map[string]any)
+					if reason, ok := choice["finish_reason"].(string); ok {
+						got = append(got, reason)
+					} else {
+						got = append(got, choice["delta"].(map[string]any)["content"].(string))
+					}
+				}
+			}
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+
+	// nothing was sent, the error can still be a normal response
+	c, w, writer := newStreamWriterTest(true)
+	assert.False(t, writer.Finish(c, nil, &model.ErrorWithStatusCode{StatusCode: http.StatusBadGateway}))
+	assert.Same(t, writer.ResponseWriter, c.Writer)
+	assert.Empty(t, w.Body.String())
+}
+
+func jsonNumber(value any) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
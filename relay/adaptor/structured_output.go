@@ -0,0 +1,39 @@
+package adaptor
+
+import (
+	"strings"
+
+	"github.com/songquanpeng/one-api/relay/apitype"
+)
+
+// levels of response_format support of the upstream providers
+const (
+	// StructuredOutputNone means the provider drops response_format, the schema is enforced by instructions only
+	StructuredOutputNone = iota
+	// StructuredOutputJSONMode means the provider can be forced to answer with JSON, but not with a given schema
+	StructuredOutputJSONMode
+	// StructuredOutputNative means the provider accepts a json schema
+	StructuredOutputNative
+)
+
+// GetStructuredOutputSupport is the capability matrix of structured outputs per adaptor
+func GetStructuredOutputSupport(apiType int, modelName string) int {
+	switch apiType {
+	case apitype.OpenAI, apitype.Gemini, apitype.Ollama, apitype.Cohere:
+		return StructuredOutputNative
+	case apitype.VertexAI:
+		if strings.HasPrefix(modelName, "claude") {
+			return StructuredOutputNone
+		}
+		return StructuredOutputNative
+	case apitype.Ali, apitype.Baidu:
+		return StructuredOutputJSONMode
+	case apitype.Zhipu:
+		// only the v4 api is openai compatible
+		if strings.HasPrefix(modelName, "glm-") {
+			return StructuredOutputJSONMode
+		}
+		return StructuredOutputNone
+	}
+	return StructuredOutputNone
+}
@@ -31,7 +31,10 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 		return nil, errors.New("request is nil")
 	}
 
-	claudeReq := anthropic.ConvertRequest(*request)
+	claudeReq, err := anthropic.ConvertRequest(*request)
+	if err != nil {
+		return nil, err
+	}
 	req := Request{
 		AnthropicVersion: anthropicVersion,
 		// Model:            claudeReq.Model,
@@ -43,6 +46,10 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 		TopK:        claudeReq.TopK,
 		Stream:      claudeReq.Stream,
 		Tools:       claudeReq.Tools,
+		ToolChoice:  claudeReq.ToolChoice,
+		Thinking:    claudeReq.Thinking,
+		// the beta headers are not forwarded to claude by vertex ai
+		AnthropicBeta: meta.GetByContext(c).Config.AnthropicBeta,
 	}
 
 	c.Set(ctxkey.RequestModel, request.Model)
@@ -6,14 +6,17 @@ type Request struct {
 	// AnthropicVersion must be "vertex-2023-10-16"
 	AnthropicVersion string `json:"anthropic_version"`
 	// Model            string              `json:"model"`
-	Messages      []anthropic.Message `json:"messages"`
-	System        string              `json:"system,omitempty"`
-	MaxTokens     int                 `json:"max_tokens,omitempty"`
-	StopSequences []string            `json:"stop_sequences,omitempty"`
-	Stream        bool                `json:"stream,omitempty"`
-	Temperature   *float64            `json:"temperature,omitempty"`
-	TopP          *float64            `json:"top_p,omitempty"`
-	TopK          int                 `json:"top_k,omitempty"`
-	Tools         []anthropic.Tool    `json:"tools,omitempty"`
-	ToolChoice    any                 `json:"tool_choice,omitempty"`
+	Messages      []anthropic.Message   `json:"messages"`
+	System        []anthropic.Content   `json:"system,omitempty"`
+	MaxTokens     int                   `json:"max_tokens,omitempty"`
+	StopSequences []string              `json:"stop_sequences,omitempty"`
+	Stream        bool                  `json:"stream,omitempty"`
+	Temperature   *float64              `json:"temperature,omitempty"`
+	TopP          *float64              `json:"top_p,omitempty"`
+	TopK          int                   `json:"top_k,omitempty"`
+	Tools         []anthropic.Tool      `json:"tools,omitempty"`
+	ToolChoice    *anthropic.ToolChoice `json:"tool_choice,omitempty"`
+	Thinking      *anthropic.Thinking   `json:"thinking,omitempty"`
+	// AnthropicBeta is how vertex ai takes the anthropic-beta header
+	AnthropicBeta []string `json:"anthropic_beta,omitempty"`
 }
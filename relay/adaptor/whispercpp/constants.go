@@ -0,0 +1,6 @@
+package whispercpp
+
+// the server runs a single model, whisper-1 lets the clients of openai use it unchanged
+var ModelList = []string{
+	"whisper-1",
+}
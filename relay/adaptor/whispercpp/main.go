@@ -0,0 +1,100 @@
+package whispercpp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://github.com/ggml-org/whisper.cpp/tree/master/examples/server
+
+func (a *Adaptor) CreateSpeech(meta *meta.Meta, request *model.SpeechRequest) (*model.SpeechResult, *model.ErrorWithStatusCode) {
+	return nil, openai.ErrorWrapper(errNotSupported, "speech_not_supported", http.StatusBadRequest)
+}
+
+func (a *Adaptor) CreateTranscription(meta *meta.Meta, request *model.TranscriptionRequest) (*model.TranscriptionResult, *model.ErrorWithStatusCode) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", request.Filename)
+	if err == nil {
+		_, err = part.Write(request.Audio)
+	}
+	fields := map[string]string{
+		"response_format": "verbose_json",
+		"temperature":     fmt.Sprint(request.Temperature),
+	}
+	if request.Language != "" {
+		fields["language"] = request.Language
+	}
+	if request.Prompt != "" {
+		fields["prompt"] = request.Prompt
+	}
+	if request.Translate {
+		fields["translate"] = "true"
+	}
+	for name, value := range fields {
+		if err == nil {
+			err = writer.WriteField(name, value)
+		}
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "build_form_failed", http.StatusInternalServerError)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(meta.BaseURL, "/")+"/inference", &body)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	// the server has no authentication, the key is for the proxies in front of it
+	if meta.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+meta.APIKey)
+	}
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, adaptor.UpstreamErrorWrapper(&adaptor.UpstreamError{StatusCode: resp.StatusCode, Body: string(responseBody)}, "whisper_cpp_failed")
+	}
+	var inferenceResponse InferenceResponse
+	if err = json.Unmarshal(responseBody, &inferenceResponse); err != nil {
+		return nil, openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+	if inferenceResponse.Error != "" {
+		return nil, openai.ErrorWrapper(errors.New(inferenceResponse.Error), "whisper_cpp_failed", http.StatusInternalServerError)
+	}
+
+	result := &model.TranscriptionResult{
+		Text:     strings.TrimSpace(inferenceResponse.Text),
+		Language: inferenceResponse.Language,
+		Duration: inferenceResponse.Duration,
+	}
+	for _, segment := range inferenceResponse.Segments {
+		result.Segments = append(result.Segments, model.TranscriptionSegment{
+			Start: segment.Start,
+			End:   segment.End,
+			Text:  strings.TrimSpace(segment.Text),
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,16 @@
+package whispercpp
+
+type Segment struct {
+	Id    int     `json:"id"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+type InferenceResponse struct {
+	Text     string    `json:"text"`
+	Language string    `json:"language"`
+	Duration float64   `json:"duration"`
+	Segments []Segment `json:"segments"`
+	Error    string    `json:"error,omitempty"`
+}
@@ -84,6 +84,10 @@ func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error)
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
+	if request.Image != nil {
+		// cogview only generates images from text
+		return nil, fmt.Errorf("image edits and variations are %w by zhipu", adaptor.ErrUnsupportedRequest)
+	}
 	newRequest := ImageRequest{
 		Model:  request.Model,
 		Prompt: request.Prompt,
@@ -0,0 +1,49 @@
+package ratio
+
+import "strings"
+
+// AudioPromptRatio is the price of audio input tokens relative to text input tokens
+// https://openai.com/api/pricing/
+var AudioPromptRatio = map[string]float64{
+	"gpt-4o-realtime-preview":      8,          // $40 / 1M audio tokens
+	"gpt-4o-mini-realtime-preview": 10.0 / 0.6, // $10 / 1M audio tokens
+}
+
+// AudioCompletionRatio is the price of audio output tokens relative to text output tokens
+var AudioCompletionRatio = map[string]float64{
+	"gpt-4o-realtime-preview":      4,          // $80 / 1M audio tokens
+	"gpt-4o-mini-realtime-preview": 20.0 / 2.4, // $20 / 1M audio tokens
+}
+
+// getAudioRatio matches dated snapshots like gpt-4o-realtime-preview-2024-12-17 by prefix
+func getAudioRatio(ratios map[string]float64, name string) float64 {
+	if ratio, ok := ratios[name]; ok {
+		return ratio
+	}
+	for model, ratio := range ratios {
+		if strings.HasPrefix(name, model+"-") {
+			return ratio
+		}
+	}
+	return 1
+}
+
+func GetAudioPromptRatio(name string) float64 {
+	return getAudioRatio(AudioPromptRatio, name)
+}
+
+func GetAudioCompletionRatio(name string) float64 {
+	return getAudioRatio(AudioCompletionRatio, name)
+}
+
+// SecondBilledAudioModels are the transcription models priced by the second of audio,
+// their model ratio is the price of one second: 1 === $0.002 / second
+var SecondBilledAudioModels = map[string]bool{
+	"paraformer-realtime-v2":    true,
+	"paraformer-realtime-8k-v2": true,
+	"azure-stt":                 true,
+}
+
+func IsSecondBilledAudioModel(name string) bool {
+	return SecondBilledAudioModels[name]
+}
@@ -0,0 +1,32 @@
+package ratio
+
+import "strings"
+
+// CacheReadRatio is the price of the prompt tokens read from the cache relative to the other prompt tokens,
+// the models are matched by their family so that the names of bedrock and vertex ai are covered too
+// https://docs.anthropic.com/en/docs/build-with-claude/prompt-caching#pricing
+var CacheReadRatio = map[string]float64{
+	"claude": 0.1,
+}
+
+// CacheWriteRatio is the price of the prompt tokens written into the cache relative to the other prompt tokens
+var CacheWriteRatio = map[string]float64{
+	"claude": 1.25,
+}
+
+func getCacheRatio(ratios map[string]float64, name string) float64 {
+	for family, ratio := range ratios {
+		if strings.Contains(name, family) {
+			return ratio
+		}
+	}
+	return 1
+}
+
+func GetCacheReadRatio(name string) float64 {
+	return getCacheRatio(CacheReadRatio, name)
+}
+
+func GetCacheWriteRatio(name string) float64 {
+	return getCacheRatio(CacheWriteRatio, name)
+}
@@ -87,6 +87,12 @@ var ModelRatio = map[string]float64{
 	"text-moderation-latest":  0.1,
 	"dall-e-2":                0.02 * USD, // $0.016 - $0.020 / image
 	"dall-e-3":                0.04 * USD, // $0.040 - $0.120 / image
+	// text tokens of the realtime models, audio tokens are priced by AudioPromptRatio
+	"gpt-4o-realtime-preview":                 2.5, // $0.005 / 1K tokens
+	"gpt-4o-realtime-preview-2024-10-01":      2.5,
+	"gpt-4o-realtime-preview-2024-12-17":      2.5,
+	"gpt-4o-mini-realtime-preview":            0.3, // $0.0006 / 1K tokens
+	"gpt-4o-mini-realtime-preview-2024-12-17": 0.3,
 	// https://docs.anthropic.com/en/docs/about-claude/models
 	"claude-instant-1.2":         0.8 / 1000 * USD,
 	"claude-2.0":                 8.0 / 1000 * USD,
@@ -98,6 +104,8 @@ var ModelRatio = map[string]float64{
 	"claude-3-5-sonnet-20240620": 3.0 / 1000 * USD,
 	"claude-3-5-sonnet-20241022": 3.0 / 1000 * USD,
 	"claude-3-5-sonnet-latest":   3.0 / 1000 * USD,
+	"claude-3-7-sonnet-20250219": 3.0 / 1000 * USD,
+	"claude-3-7-sonnet-latest":   3.0 / 1000 * USD,
 	"claude-3-opus-20240229":     15.0 / 1000 * USD,
 	// https://cloud.baidu.com/doc/WENXINWORKSHOP/s/hlrk4akp7
 	"ERNIE-4.0-8K":       0.120 * RMB,
@@ -240,6 +248,8 @@ var ModelRatio = map[string]float64{
 	"ali-stable-diffusion-xl":       8.00,
 	"ali-stable-diffusion-v1.5":     8.00,
 	"wanx-v1":                       8.00,
+	"wanx2.1-imageedit":             7.00,
+	"gte-rerank":                    0.0008 * RMB,
 	"deepseek-r1":                   0.002 * RMB,
 	"deepseek-v3":                   0.001 * RMB,
 	"deepseek-r1-distill-qwen-1.5b": 0.001 * RMB,
@@ -334,6 +344,16 @@ var ModelRatio = map[string]float64{
 	"command-light-nightly": 0.5,
 	"command-r":             0.5 / 1000 * USD,
 	"command-r-plus":        3.0 / 1000 * USD,
+	// rerank models are billed per search unit
+	"rerank-v3.5":              2.0 / 1000 * USD, // $2 / 1K searches
+	"rerank-english-v3.0":      2.0 / 1000 * USD,
+	"rerank-multilingual-v3.0": 2.0 / 1000 * USD,
+	// https://jina.ai/reranker/
+	"jina-reranker-v2-base-multilingual": 0.02 * MILLI_USD,
+	"jina-reranker-m0":                   0.02 * MILLI_USD,
+	// https://siliconflow.cn/pricing
+	"BAAI/bge-reranker-v2-m3":             0,
+	"netease-youdao/bce-reranker-base_v1": 0,
 	// https://platform.deepseek.com/api-docs/pricing/
 	"deepseek-chat":     0.14 * MILLI_USD,
 	"deepseek-reasoner": 0.55 * MILLI_USD,
@@ -387,6 +407,37 @@ var ModelRatio = map[string]float64{
 	"mistralai/mistral-7b-instruct-v0.2":        0.050 * USD,
 	"mistralai/mistral-7b-v0.1":                 0.050 * USD,
 	"mistralai/mixtral-8x7b-instruct-v0.1":      0.300 * USD,
+	// video models are charged per second of the generated video
+	// https://replicate.com/pricing
+	"minimax/video-01":           0.5 / 6 * USD,
+	"minimax/hailuo-02":          0.045 * USD,
+	"kwaivgi/kling-v2.1":         0.05 * USD,
+	"wan-video/wan-2.1-t2v-480p": 0.07 * USD,
+	"wan-video/wan-2.1-i2v-480p": 0.09 * USD,
+	// https://help.aliyun.com/zh/model-studio/models
+	"wanx2.1-t2v-turbo": 0.24 * RMB,
+	"wanx2.1-t2v-plus":  0.70 * RMB,
+	"wanx2.1-i2v-turbo": 0.24 * RMB,
+	"wanx2.1-i2v-plus":  0.70 * RMB,
+	// https://www.volcengine.com/docs/82379/1544106
+	"doubao-seedance-1-0-pro-250528":      0.75 * RMB,
+	"doubao-seedance-1-0-lite-t2v-250428": 0.50 * RMB,
+	"doubao-seedance-1-0-lite-i2v-250428": 0.50 * RMB,
+	// speech synthesis is charged per 1k characters, the transcriptions of SecondBilledAudioModels per second of audio
+	// https://help.aliyun.com/zh/model-studio/models
+	"cosyvoice-v1":              0.2 * RMB,
+	"cosyvoice-v2":              0.2 * RMB,
+	"paraformer-realtime-v2":    0.00024 * RMB,
+	"paraformer-realtime-8k-v2": 0.00024 * RMB,
+	// https://azure.microsoft.com/en-us/pricing/details/cognitive-services/speech-services/
+	"azure-tts": 0.016 * USD,  // $16 / 1M characters
+	"azure-stt": 0.0001 * USD, // $0.36 / hour
+	// https://klingai.com/global/dev/pricing
+	"kling-v1":          0.028 * USD,
+	"kling-v1-6":        0.056 * USD,
+	"kling-v2-master":   0.28 * USD,
+	"kling-v2-1":        0.056 * USD,
+	"kling-v2-1-master": 0.28 * USD,
 	//https://openrouter.ai/models
 	"01-ai/yi-large":                                  1.5,
 	"aetherwiing/mn-starcannon-12b":                   0.6,
@@ -53,5 +53,9 @@ const (
 	AliBailian
 	OpenAICompatible
 	GeminiOpenAICompatible
+	Kling
+	AzureSpeech
+	WhisperCpp
+	Dify
 	Dummy
 )
@@ -41,6 +41,14 @@ func ToAPIType(channelType int) int {
 		apiType = apitype.Replicate
 	case Proxy:
 		apiType = apitype.Proxy
+	case Kling:
+		apiType = apitype.Kling
+	case AzureSpeech:
+		apiType = apitype.AzureSpeech
+	case WhisperCpp:
+		apiType = apitype.WhisperCpp
+	case Dify:
+		apiType = apitype.Dify
 	}
 
 	return apiType
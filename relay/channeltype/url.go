@@ -54,6 +54,10 @@ var ChannelBaseURLs = []string{
 	"",                                          // 50
 
 	"https://generativelanguage.googleapis.com/v1beta/openai/", // 51
+	"https://api-singapore.klingai.com",                        // 52
+	"",                                                         // 53
+	"http://127.0.0.1:8080",                                    // 54
+	"https://api.dify.ai",                                      // 55
 }
 
 func init() {
@@ -1,5 +1,6 @@
 package finishreason
 
 const (
-	Stop = "stop"
+	Stop          = "stop"
+	ContentFilter = "content_filter"
 )
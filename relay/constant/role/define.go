@@ -3,4 +3,5 @@ package role
 const (
 	System    = "system"
 	Assistant = "assistant"
+	User      = "user"
 )
@@ -8,29 +8,87 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common"
-	"github.com/songquanpeng/one-api/common/client"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
 	"github.com/songquanpeng/one-api/relay/billing"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
-	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
+func getSpeechRequest(c *gin.Context) (*relaymodel.SpeechRequest, error) {
+	speechRequest := &relaymodel.SpeechRequest{}
+	err := common.UnmarshalBodyReusable(c, speechRequest)
+	if err != nil {
+		return nil, err
+	}
+	// Check if text is too long 4096
+	if utf8.RuneCountInString(speechRequest.Input) > 4096 {
+		return nil, errors.New("input is too long (over 4096 characters)")
+	}
+	return speechRequest, nil
+}
+
+// getTranscriptionRequest reads the multipart form, it is parsed already when the model is read from it
+func getTranscriptionRequest(c *gin.Context, relayMode int) (*relaymodel.TranscriptionRequest, error) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return nil, fmt.Errorf("file is required: %w", err)
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	audio, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	transcriptionRequest := &relaymodel.TranscriptionRequest{
+		Model:          c.PostForm("model"),
+		Audio:          audio,
+		Filename:       fileHeader.Filename,
+		Language:       c.PostForm("language"),
+		Prompt:         c.PostForm("prompt"),
+		ResponseFormat: c.DefaultPostForm("response_format", "json"),
+		Translate:      relayMode == relaymode.AudioTranslation,
+	}
+	if temperature := c.PostForm("temperature"); temperature != "" {
+		transcriptionRequest.Temperature, err = strconv.ParseFloat(temperature, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid temperature: %w", err)
+		}
+	}
+	switch transcriptionRequest.ResponseFormat {
+	case "json", "text", "srt", "verbose_json", "vtt":
+	default:
+		return nil, fmt.Errorf("unknown response_format %s", transcriptionRequest.ResponseFormat)
+	}
+	return transcriptionRequest, nil
+}
+
 func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatusCode {
 	ctx := c.Request.Context()
 	meta := meta.GetByContext(c)
-	audioModel := "whisper-1"
+	audioModel := meta.OriginModelName
+	if audioModel == "" {
+		audioModel = "whisper-1"
+	}
 
 	tokenId := c.GetInt(ctxkey.TokenId)
 	channelType := c.GetInt(ctxkey.Channel)
@@ -39,19 +97,17 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	group := c.GetString(ctxkey.Group)
 	tokenName := c.GetString(ctxkey.TokenName)
 
-	var ttsRequest openai.TextToSpeechRequest
+	var speechRequest *relaymodel.SpeechRequest
 	if relayMode == relaymode.AudioSpeech {
-		// Read JSON
-		err := common.UnmarshalBodyReusable(c, &ttsRequest)
-		// Check if JSON is valid
+		var err error
+		speechRequest, err = getSpeechRequest(c)
 		if err != nil {
-			return openai.ErrorWrapper(err, "invalid_json", http.StatusBadRequest)
-		}
-		audioModel = ttsRequest.Model
-		// Check if text is too long 4096
-		if len(ttsRequest.Input) > 4096 {
-			return openai.ErrorWrapper(errors.New("input is too long (over 4096 characters)"), "text_too_long", http.StatusBadRequest)
+			return openai.ErrorWrapper(err, "invalid_speech_request", http.StatusBadRequest)
 		}
+		audioModel = speechRequest.Model
+	}
+	if bizErr := filterAudioRequest(c, meta, relayMode, speechRequest); bizErr != nil {
+		return bizErr
 	}
 
 	modelRatio := billingratio.GetModelRatio(audioModel, channelType)
@@ -61,7 +117,7 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	var preConsumedQuota int64
 	switch relayMode {
 	case relaymode.AudioSpeech:
-		preConsumedQuota = int64(float64(len(ttsRequest.Input)) * ratio)
+		preConsumedQuota = getSpeechQuota(speechRequest.Input, ratio)
 		quota = preConsumedQuota
 	default:
 		preConsumedQuota = int64(float64(config.PreConsumedQuota) * ratio)
@@ -110,82 +166,212 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	}()
 
 	// map model name
-	modelMapping := c.GetStringMapString(ctxkey.ModelMapping)
-	if modelMapping != nil && modelMapping[audioModel] != "" {
-		audioModel = modelMapping[audioModel]
-	}
+	meta.OriginModelName = audioModel
+	audioModel, _ = getMappedModelName(audioModel, meta.ModelMapping)
+	meta.ActualModelName = audioModel
 
-	baseURL := channeltype.ChannelBaseURLs[channelType]
-	requestURL := c.Request.URL.String()
-	if c.GetString(ctxkey.BaseURL) != "" {
-		baseURL = c.GetString(ctxkey.BaseURL)
+	channelAdaptor := relay.GetAdaptor(meta.APIType)
+	if channelAdaptor == nil {
+		return openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
 	}
+	channelAdaptor.Init(meta)
 
-	fullRequestURL := openai.GetFullRequestURL(baseURL, requestURL, channelType)
-	if channelType == channeltype.Azure {
-		apiVersion := meta.Config.APIVersion
-		if relayMode == relaymode.AudioTranscription {
-			// https://learn.microsoft.com/en-us/azure/ai-services/openai/whisper-quickstart?tabs=command-line#rest-api
-			fullRequestURL = fmt.Sprintf("%s/openai/deployments/%s/audio/transcriptions?api-version=%s", baseURL, audioModel, apiVersion)
-		} else if relayMode == relaymode.AudioSpeech {
-			// https://learn.microsoft.com/en-us/azure/ai-services/openai/text-to-speech-quickstart?tabs=command-line#rest-api
-			fullRequestURL = fmt.Sprintf("%s/openai/deployments/%s/audio/speech?api-version=%s", baseURL, audioModel, apiVersion)
+	var bizErr *relaymodel.ErrorWithStatusCode
+	if audioAdaptor, ok := channelAdaptor.(adaptor.AudioAdaptor); ok {
+		if relayMode == relaymode.AudioSpeech {
+			bizErr = relaySpeech(c, audioAdaptor, meta, speechRequest)
+		} else {
+			quota, bizErr = relayTranscription(c, audioAdaptor, meta, relayMode, modelRatio, groupRatio)
+		}
+	} else if meta.APIType == apitype.OpenAI {
+		// the openai shaped channels take the request as it is
+		var transcriptionQuota int64
+		transcriptionQuota, bizErr = relayOpenAIAudio(c, channelAdaptor, meta, relayMode)
+		if relayMode != relaymode.AudioSpeech {
+			quota = transcriptionQuota
 		}
+	} else {
+		bizErr = openai.ErrorWrapper(fmt.Errorf("channel type %d does not support audio", meta.ChannelType), "audio_not_supported", http.StatusBadRequest)
+	}
+	if bizErr != nil {
+		return bizErr
 	}
 
-	requestBody := &bytes.Buffer{}
-	_, err = io.Copy(requestBody, c.Request.Body)
+	succeed = true
+	quotaDelta := quota - preConsumedQuota
+	defer func(ctx context.Context) {
+		go billing.PostConsumeQuota(ctx, tokenId, quotaDelta, quota, userId, channelId, modelRatio, groupRatio, audioModel, tokenName)
+	}(c.Request.Context())
+	return nil
+}
+
+// filterAudioRequest applies the guardrails to the input of a speech or the prompt of a transcription, the body
+// which the openai channels take as it is gets the filtered text too
+func filterAudioRequest(c *gin.Context, meta *meta.Meta, relayMode int, speechRequest *relaymodel.SpeechRequest) *relaymodel.ErrorWithStatusCode {
+	if relayMode == relaymode.AudioSpeech {
+		if _, bizErr := filterRequest(c, meta, rewriteTexts(&speechRequest.Input)); bizErr != nil || !meta.RequestRewritten {
+			return bizErr
+		}
+		requestBody, err := common.GetRequestBody(c)
+		if err != nil {
+			return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusInternalServerError)
+		}
+		var request map[string]any
+		if err = json.Unmarshal(requestBody, &request); err != nil {
+			return openai.ErrorWrapper(err, "invalid_speech_request", http.StatusBadRequest)
+		}
+		request["input"] = speechRequest.Input
+		requestBody, err = json.Marshal(request)
+		if err != nil {
+			return openai.ErrorWrapper(err, "marshal_speech_request_failed", http.StatusInternalServerError)
+		}
+		c.Set(ctxkey.KeyRequestBody, requestBody)
+		return nil
+	}
+	prompt := c.PostForm("prompt")
+	if _, bizErr := filterRequest(c, meta, rewriteTexts(&prompt)); bizErr != nil || !meta.RequestRewritten {
+		return bizErr
+	}
+	requestBody, err := rebuildMultipartForm(c, map[string]string{"prompt": prompt})
 	if err != nil {
-		return openai.ErrorWrapper(err, "new_request_body_failed", http.StatusInternalServerError)
+		return openai.ErrorWrapper(err, "build_transcription_request_failed", http.StatusInternalServerError)
 	}
-	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody.Bytes()))
-	responseFormat := c.DefaultPostForm("response_format", "json")
+	c.Request.PostForm.Set("prompt", prompt)
+	c.Request.MultipartForm.Value["prompt"] = []string{prompt}
+	c.Set(ctxkey.KeyRequestBody, requestBody.Bytes())
+	return nil
+}
 
-	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
+func relaySpeech(c *gin.Context, audioAdaptor adaptor.AudioAdaptor, meta *meta.Meta, speechRequest *relaymodel.SpeechRequest) *relaymodel.ErrorWithStatusCode {
+	speechRequest.Model = meta.ActualModelName
+	result, bizErr := audioAdaptor.CreateSpeech(meta, speechRequest)
+	if bizErr != nil {
+		return bizErr
+	}
+	c.Data(http.StatusOK, result.ContentType, result.Audio)
+	return nil
+}
+
+func relayTranscription(c *gin.Context, audioAdaptor adaptor.AudioAdaptor, meta *meta.Meta, relayMode int, modelRatio float64, groupRatio float64) (int64, *relaymodel.ErrorWithStatusCode) {
+	transcriptionRequest, err := getTranscriptionRequest(c, relayMode)
 	if err != nil {
-		return openai.ErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+		return 0, openai.ErrorWrapper(err, "invalid_transcription_request", http.StatusBadRequest)
+	}
+	transcriptionRequest.Model = meta.ActualModelName
+	result, bizErr := audioAdaptor.CreateTranscription(meta, transcriptionRequest)
+	if bizErr != nil {
+		return 0, bizErr
 	}
+	contentType, body, err := formatTranscription(result, transcriptionRequest)
+	if err != nil {
+		return 0, openai.ErrorWrapper(err, "format_transcription_failed", http.StatusInternalServerError)
+	}
+	c.Data(http.StatusOK, contentType, body)
+	return getTranscriptionQuota(result, meta, modelRatio, groupRatio), nil
+}
 
-	if (relayMode == relaymode.AudioTranscription || relayMode == relaymode.AudioSpeech) && channelType == channeltype.Azure {
-		// https://learn.microsoft.com/en-us/azure/ai-services/openai/whisper-quickstart?tabs=command-line#rest-api
-		apiKey := c.Request.Header.Get("Authorization")
-		apiKey = strings.TrimPrefix(apiKey, "Bearer ")
-		req.Header.Set("api-key", apiKey)
-		req.ContentLength = c.Request.ContentLength
-	} else {
-		req.Header.Set("Authorization", c.Request.Header.Get("Authorization"))
+// getSpeechQuota bills speech by the characters of the input, a started unit of quota is charged in full
+func getSpeechQuota(input string, ratio float64) int64 {
+	return int64(math.Ceil(float64(utf8.RuneCountInString(input)) * ratio))
+}
+
+// getTranscriptionQuota bills by the tokens or the seconds when the upstream reports them, otherwise like whisper-1 by the tokens of the text
+func getTranscriptionQuota(result *relaymodel.TranscriptionResult, meta *meta.Meta, modelRatio float64, groupRatio float64) int64 {
+	ratio := modelRatio * groupRatio
+	switch {
+	case result.Usage != nil:
+		completionRatio := billingratio.GetCompletionRatio(meta.ActualModelName, meta.ChannelType)
+		return int64(math.Ceil((float64(result.Usage.PromptTokens) + float64(result.Usage.CompletionTokens)*completionRatio) * ratio))
+	case billingratio.IsSecondBilledAudioModel(meta.ActualModelName) && result.Duration > 0:
+		return int64(math.Ceil(ratio * 1000 * math.Ceil(result.Duration)))
+	default:
+		return int64(openai.CountTokenText(result.Text, meta.ActualModelName))
 	}
-	req.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
-	req.Header.Set("Accept", c.Request.Header.Get("Accept"))
+}
 
-	resp, err := client.HTTPClient.Do(req)
-	if err != nil {
-		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+// formatTranscription writes the result in the response_format of openai
+func formatTranscription(result *relaymodel.TranscriptionResult, request *relaymodel.TranscriptionRequest) (string, []byte, error) {
+	segments := result.Segments
+	if len(segments) == 0 && result.Text != "" {
+		segments = []relaymodel.TranscriptionSegment{{Start: 0, End: result.Duration, Text: result.Text}}
+	}
+	switch request.ResponseFormat {
+	case "text":
+		return "text/plain; charset=utf-8", []byte(result.Text + "\n"), nil
+	case "srt", "vtt":
+		var builder strings.Builder
+		if request.ResponseFormat == "vtt" {
+			builder.WriteString("WEBVTT\n\n")
+		}
+		for i, segment := range segments {
+			if request.ResponseFormat == "srt" {
+				builder.WriteString(fmt.Sprintf("%d\n", i+1))
+			}
+			builder.WriteString(fmt.Sprintf("%s --> %s\n%s\n\n",
+				formatTimestamp(segment.Start, request.ResponseFormat), formatTimestamp(segment.End, request.ResponseFormat), strings.TrimSpace(segment.Text)))
+		}
+		return "text/plain; charset=utf-8", []byte(builder.String()), nil
+	case "verbose_json":
+		response := openai.WhisperVerboseJSONResponse{
+			Task:     "transcribe",
+			Language: result.Language,
+			Duration: result.Duration,
+			Text:     result.Text,
+		}
+		if request.Translate {
+			response.Task = "translate"
+		}
+		for i, segment := range segments {
+			response.Segments = append(response.Segments, openai.Segment{Id: i, Start: segment.Start, End: segment.End, Text: segment.Text})
+		}
+		body, err := json.Marshal(response)
+		return "application/json", body, err
+	default:
+		body, err := json.Marshal(openai.WhisperJSONResponse{Text: result.Text})
+		return "application/json", body, err
 	}
+}
 
-	err = req.Body.Close()
+// formatTimestamp writes the seconds as 00:00:01,500 for srt and 00:00:01.500 for vtt
+func formatTimestamp(seconds float64, format string) string {
+	milliseconds := int64(math.Round(seconds * 1000))
+	separator := ","
+	if format == "vtt" {
+		separator = "."
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", milliseconds/3600000, milliseconds/60000%60, milliseconds/1000%60, separator, milliseconds%1000)
+}
+
+// relayOpenAIAudio sends the request body to the upstream unchanged, the transcriptions are billed by the tokens of the text
+func relayOpenAIAudio(c *gin.Context, channelAdaptor adaptor.Adaptor, meta *meta.Meta, relayMode int) (int64, *relaymodel.ErrorWithStatusCode) {
+	requestBody, err := common.GetRequestBody(c)
 	if err != nil {
-		return openai.ErrorWrapper(err, "close_request_body_failed", http.StatusInternalServerError)
+		return 0, openai.ErrorWrapper(err, "read_request_body_failed", http.StatusInternalServerError)
 	}
-	err = c.Request.Body.Close()
+	responseFormat := c.DefaultPostForm("response_format", "json")
+	resp, err := channelAdaptor.DoRequest(c, meta, bytes.NewReader(requestBody))
 	if err != nil {
-		return openai.ErrorWrapper(err, "close_request_body_failed", http.StatusInternalServerError)
+		return 0, openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, RelayErrorHandler(resp)
 	}
 
+	var quota int64
 	if relayMode != relaymode.AudioSpeech {
 		responseBody, err := io.ReadAll(resp.Body)
 		if err != nil {
-			return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+			return 0, openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
 		}
 		err = resp.Body.Close()
 		if err != nil {
-			return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
+			return 0, openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
 		}
 
 		var openAIErr openai.SlimTextResponse
 		if err = json.Unmarshal(responseBody, &openAIErr); err == nil {
 			if openAIErr.Error.Message != "" {
-				return openai.ErrorWrapper(fmt.Errorf("type %s, code %v, message %s", openAIErr.Error.Type, openAIErr.Error.Code, openAIErr.Error.Message), "request_error", http.StatusInternalServerError)
+				return 0, openai.ErrorWrapper(fmt.Errorf("type %s, code %v, message %s", openAIErr.Error.Type, openAIErr.Error.Code, openAIErr.Error.Message), "request_error", http.StatusInternalServerError)
 			}
 		}
 
@@ -202,22 +388,14 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		case "vtt":
 			text, err = getTextFromVTT(responseBody)
 		default:
-			return openai.ErrorWrapper(errors.New("unexpected_response_format"), "unexpected_response_format", http.StatusInternalServerError)
+			return 0, openai.ErrorWrapper(errors.New("unexpected_response_format"), "unexpected_response_format", http.StatusInternalServerError)
 		}
 		if err != nil {
-			return openai.ErrorWrapper(err, "get_text_from_body_err", http.StatusInternalServerError)
+			return 0, openai.ErrorWrapper(err, "get_text_from_body_err", http.StatusInternalServerError)
 		}
-		quota = int64(openai.CountTokenText(text, audioModel))
+		quota = int64(openai.CountTokenText(text, meta.ActualModelName))
 		resp.Body = io.NopCloser(bytes.NewBuffer(responseBody))
 	}
-	if resp.StatusCode != http.StatusOK {
-		return RelayErrorHandler(resp)
-	}
-	succeed = true
-	quotaDelta := quota - preConsumedQuota
-	defer func(ctx context.Context) {
-		go billing.PostConsumeQuota(ctx, tokenId, quotaDelta, quota, userId, channelId, modelRatio, groupRatio, audioModel, tokenName)
-	}(c.Request.Context())
 
 	for k, v := range resp.Header {
 		c.Writer.Header().Set(k, v[0])
@@ -226,13 +404,13 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 
 	_, err = io.Copy(c.Writer, resp.Body)
 	if err != nil {
-		return openai.ErrorWrapper(err, "copy_response_body_failed", http.StatusInternalServerError)
+		return 0, openai.ErrorWrapper(err, "copy_response_body_failed", http.StatusInternalServerError)
 	}
 	err = resp.Body.Close()
 	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
+		return 0, openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
 	}
-	return nil
+	return quota, nil
 }
 
 func getTextFromVTT(body []byte) (string, error) {
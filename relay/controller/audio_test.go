@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestFormatTranscription(t *testing.T) {
+	result := &relaymodel.TranscriptionResult{
+		Text:     "hello world",
+		Language: "en",
+		Duration: 3723.5,
+		Segments: []relaymodel.TranscriptionSegment{
+			{Start: 0, End: 1.25, Text: " hello"},
+			{Start: 3722, End: 3723.5, Text: "world"},
+		},
+	}
+	contentType, body, err := formatTranscription(result, &relaymodel.TranscriptionRequest{ResponseFormat: "srt"})
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", contentType)
+	assert.Equal(t, "1\n00:00:00,000 --> 00:00:01,250\nhello\n\n2\n01:02:02,000 --> 01:02:03,500\nworld\n\n", string(body))
+	text, err := getTextFromSRT(body)
+	require.NoError(t, err)
+	assert.Equal(t, "helloworld", text)
+
+	_, body, err = formatTranscription(result, &relaymodel.TranscriptionRequest{ResponseFormat: "vtt"})
+	require.NoError(t, err)
+	assert.Equal(t, "WEBVTT\n\n00:00:00.000 --> 00:00:01.250\nhello\n\n01:02:02.000 --> 01:02:03.500\nworld\n\n", string(body))
+
+	contentType, body, err = formatTranscription(result, &relaymodel.TranscriptionRequest{ResponseFormat: "verbose_json", Translate: true})
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", contentType)
+	assert.JSONEq(t, `{"task":"translate","language":"en","duration":3723.5,"text":"hello world","segments":[
+		{"id":0,"seek":0,"start":0,"end":1.25,"text":" hello","tokens":null,"temperature":0,"avg_logprob":0,"compression_ratio":0,"no_speech_prob":0},
+		{"id":1,"seek":0,"start":3722,"end":3723.5,"text":"world","tokens":null,"temperature":0,"avg_logprob":0,"compression_ratio":0,"no_speech_prob":0}]}`, string(body))
+
+	_, body, err = formatTranscription(&relaymodel.TranscriptionResult{Text: "hi", Duration: 2}, &relaymodel.TranscriptionRequest{ResponseFormat: "srt"})
+	require.NoError(t, err)
+	assert.Equal(t, "1\n00:00:00,000 --> 00:00:02,000\nhi\n\n", string(body))
+
+	_, body, err = formatTranscription(result, &relaymodel.TranscriptionRequest{ResponseFormat: "json"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"text":"hello world"}`, string(body))
+}
+
+func TestGetTranscriptionQuota(t *testing.T) {
+	// paraformer is billed by the second, 0.00024 RMB per second
+	quota := getTranscriptionQuota(&relaymodel.TranscriptionResult{Text: "你好", Duration: 9.2},
+		&meta.Meta{ActualModelName: "paraformer-realtime-v2"}, 0.00024*500/7, 1)
+	assert.Equal(t, int64(172), quota)
+
+	// the ratio is not truncated before it is multiplied by the seconds
+	quota = getTranscriptionQuota(&relaymodel.TranscriptionResult{Text: "你好", Duration: 9.2},
+		&meta.Meta{ActualModelName: "paraformer-realtime-v2"}, 0.00024*500/7, 0.05)
+	assert.Equal(t, int64(9), quota)
+
+	quota = getTranscriptionQuota(&relaymodel.TranscriptionResult{Text: "hello", Usage: &relaymodel.Usage{PromptTokens: 100, CompletionTokens: 10}},
+		&meta.Meta{ActualModelName: "unknown-audio-model"}, 2, 1)
+	assert.Equal(t, int64(2*(100+10*1)), quota)
+}
+
+func TestGetSpeechQuota(t *testing.T) {
+	assert.Equal(t, int64(15), getSpeechQuota("hello world, 你好", 1))
+	// a short input isn't free
+	assert.Equal(t, int64(1), getSpeechQuota("hi", 0.015))
+}
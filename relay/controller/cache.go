@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/guardrail"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// ResponseCacheHeader enables or disables the cache on a request, and tells whether a response was served from it
+const ResponseCacheHeader = "X-OneAPI-Cache"
+
+const responseCacheKeyPrefix = "response_cache:"
+
+type cachedResponse struct {
+	StatusCode  int              `json:"status_code"`
+	ContentType string           `json:"content_type"`
+	Chunks      []responseChunk  `json:"chunks"`
+	Usage       relaymodel.Usage `json:"usage"`
+}
+
+var (
+	responseCacheLRU     *expirable.LRU[string, *cachedResponse]
+	responseCacheLRUOnce sync.Once
+)
+
+func getResponseCacheLRU() *expirable.LRU[string, *cachedResponse] {
+	responseCacheLRUOnce.Do(func() {
+		responseCacheLRU = expirable.NewLRU[string, *cachedResponse](config.ResponseCacheLRUSize, nil, time.Duration(config.ResponseCacheTTL)*time.Second)
+	})
+	return responseCacheLRU
+}
+
+// isResponseCacheEnabled follows the request header, falling back to the setting of the token
+func isResponseCacheEnabled(c *gin.Context) bool {
+	switch strings.ToLower(c.Request.Header.Get(ResponseCacheHeader)) {
+	case "true", "1", "on":
+		return true
+	case "false", "0", "off", "no-cache":
+		return false
+	}
+	return c.GetBool(ctxkey.ResponseCache)
+}
+
+// getResponseCacheKey hashes the normalized request, fields which don't change the response are left out.
+// Keys are scoped to the user so that cached responses are never shared across users, and to the guardrail
+// policies so that a response filtered by other policies is never served.
+func getResponseCacheKey(meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest, policies []*guardrail.Policy) string {
+	normalized := *textRequest
+	normalized.User = ""
+	normalized.Store = nil
+	normalized.Metadata = nil
+	policyNames := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		policyNames = append(policyNames, policy.Name())
+	}
+	data, _ := json.Marshal(struct {
+		UserId     int                              `json:"user_id"`
+		Mode       int                              `json:"mode"`
+		Guardrails []string                         `json:"guardrails"`
+		Request    *relaymodel.GeneralOpenAIRequest `json:"request"`
+	}{
+		UserId:     meta.UserId,
+		Mode:       meta.Mode,
+		Guardrails: policyNames,
+		Request:    &normalized,
+	})
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func getCachedResponse(ctx context.Context, key string) *cachedResponse {
+	if !common.RedisEnabled {
+		response, _ := getResponseCacheLRU().Get(key)
+		return response
+	}
+	data, err := common.RedisGet(responseCacheKeyPrefix + key)
+	if err != nil {
+		if err != redis.Nil {
+			logger.Errorf(ctx, "failed to get cached response: %s", err.Error())
+		}
+		return nil
+	}
+	response := &cachedResponse{}
+	if err = json.Unmarshal([]byte(data), response); err != nil {
+		logger.Errorf(ctx, "failed to parse cached response: %s", err.Error())
+		return nil
+	}
+	return response
+}
+
+func setCachedResponse(ctx context.Context, key string, response *cachedResponse) {
+	if !common.RedisEnabled {
+		getResponseCacheLRU().Add(key, response)
+		return
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		logger.Errorf(ctx, "failed to marshal cached response: %s", err.Error())
+		return
+	}
+	err = common.RedisSet(responseCacheKeyPrefix+key, string(data), time.Duration(config.ResponseCacheTTL)*time.Second)
+	if err != nil {
+		logger.Errorf(ctx, "failed to cache response: %s", err.Error())
+	}
+}
+
+// replayCachedResponse writes a cached response, streams keep their original timing if configured
+func replayCachedResponse(c *gin.Context, meta *meta.Meta, response *cachedResponse) {
+	c.Header("Content-Type", response.ContentType)
+	c.Header(ResponseCacheHeader, "HIT")
+	c.Status(response.StatusCode)
+	var offset int64
+	for _, chunk := range response.Chunks {
+		if meta.IsStream && config.ResponseCacheReplayTiming && chunk.Offset > offset {
+			time.Sleep(time.Duration(chunk.Offset-offset) * time.Millisecond)
+			offset = chunk.Offset
+		}
+		_, err := c.Writer.Write(chunk.Data)
+		if err != nil {
+			return
+		}
+		if meta.IsStream {
+			c.Writer.Flush()
+		}
+	}
+}
+
+// isCompleteStream tells whether a recorded stream reached a finish reason and [DONE], the streams cut short
+// by the upstream end with [DONE] too but without a finish reason
+func isCompleteStream(body []byte) bool {
+	finished := false
+	done := false
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var chunk struct {
+			Choices []struct {
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+			Error any `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			continue
+		}
+		if chunk.Error != nil {
+			return false
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != nil && *choice.FinishReason != "" {
+				finished = true
+			}
+		}
+	}
+	return finished && done
+}
+
+func newCachedResponse(c *gin.Context, meta *meta.Meta, recorder *responseRecorder, usage *relaymodel.Usage) *cachedResponse {
+	if usage == nil || c.Writer.Status() != http.StatusOK {
+		return nil
+	}
+	if meta.IsStream && !isCompleteStream(recorder.Body()) {
+		return nil
+	}
+	return &cachedResponse{
+		StatusCode:  c.Writer.Status(),
+		ContentType: c.Writer.Header().Get("Content-Type"),
+		Chunks:      recorder.chunks,
+		Usage:       *usage,
+	}
+}
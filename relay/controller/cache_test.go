@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestNewCachedResponse(t *testing.T) {
+	chunk := func(data string) string {
+		return "data: " + data + "\n\n"
+	}
+	content := chunk(`{"id": "chatcmpl-1", "choices": [{"index": 0, "delta": {"content": "Hi"}, "finish_reason": null}]}`)
+	finish := chunk(`{"id": "chatcmpl-1", "choices": [{"index": 0, "delta": {}, "finish_reason": "stop"}]}`)
+	usage := &relaymodel.Usage{PromptTokens: 5, CompletionTokens: 1, TotalTokens: 6}
+	for _, tc := range []struct {
+		name   string
+		body   string
+		cached bool
+	}{
+		{"complete", content + finish + chunk(`[DONE]`), true},
+		{"cut short", content + chunk(`[DONE]`), false},
+		{"no done", content + finish, false},
+		{"error", content + chunk(`{"error": {"message": "upstream failed"}}`) + chunk(`[DONE]`), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			recorder := recordResponse(c)
+			c.Status(http.StatusOK)
+			_, err := c.Writer.WriteString(tc.body)
+			require.NoError(t, err)
+			relayMeta := &meta.Meta{Mode: relaymode.ChatCompletions, IsStream: true, StartTime: time.Now()}
+			cached := newCachedResponse(c, relayMeta, recorder, usage)
+			if tc.cached {
+				require.NotNil(t, cached)
+				assert.Equal(t, tc.body, string(recorder.Body()))
+			} else {
+				assert.Nil(t, cached)
+			}
+		})
+	}
+
+	// the other responses are cached whole when they succeeded
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	recorder := recordResponse(c)
+	c.Status(http.StatusOK)
+	_, err := c.Writer.WriteString(`{"id": "chatcmpl-2", "choices": [{"index": 0, "message": {"content": "Hi"}, "finish_reason": "stop"}]}`)
+	require.NoError(t, err)
+	relayMeta := &meta.Meta{Mode: relaymode.ChatCompletions}
+	assert.NotNil(t, newCachedResponse(c, relayMeta, recorder, usage))
+	assert.Nil(t, newCachedResponse(c, relayMeta, recorder, nil))
+}
+
+func TestStoreReplayedResponse(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.StoredCompletion{}))
+	model.DB = db
+	t.Cleanup(func() { model.DB = nil })
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	relayMeta := &meta.Meta{Mode: relaymode.ChatCompletions, UserId: 1, OriginModelName: "gpt-4o"}
+	cached := &cachedResponse{
+		StatusCode:  http.StatusOK,
+		ContentType: "application/json",
+		Chunks:      []responseChunk{{Data: []byte(`{"id": "chatcmpl-2", "choices": [{"index": 0, `)}, {Data: []byte(`"message": {"role": "assistant", "content": "Hi"}, "finish_reason": "stop"}]}`)}},
+	}
+	// a cache hit with store=true is recorded like an upstream response
+	recorder := recordResponse(c)
+	replayCachedResponse(c, relayMeta, cached)
+	storeCompletion(context.Background(), relayMeta, []byte(`{"model": "gpt-4o", "store": true}`), recorder.Body(), nil)
+
+	completions, err := model.GetUserStoredCompletions(1, "", nil, "", "asc", 10)
+	require.NoError(t, err)
+	require.Len(t, completions, 1)
+	assert.Equal(t, "chatcmpl-2", completions[0].UpstreamId)
+	assert.Contains(t, completions[0].Response, `"content":"Hi"`)
+}
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/constant/role"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+const middleOutTransform = "middle-out"
+
+func getContextLength(meta *meta.Meta) int {
+	if contextLength := dbmodel.GetModelContextLength(meta.ActualModelName); contextLength > 0 {
+		return contextLength
+	}
+	return dbmodel.GetModelContextLength(meta.OriginModelName)
+}
+
+func hasTransform(textRequest *model.GeneralOpenAIRequest, transform string) bool {
+	for _, t := range textRequest.Transforms {
+		if t == transform {
+			return true
+		}
+	}
+	return false
+}
+
+func getMaxTokens(textRequest *model.GeneralOpenAIRequest) int {
+	if textRequest.MaxCompletionTokens != nil {
+		return *textRequest.MaxCompletionTokens
+	}
+	return textRequest.MaxTokens
+}
+
+func setMaxTokens(textRequest *model.GeneralOpenAIRequest, maxTokens int) {
+	if textRequest.MaxCompletionTokens != nil {
+		textRequest.MaxCompletionTokens = &maxTokens
+	} else {
+		textRequest.MaxTokens = maxTokens
+	}
+}
+
+// middleOut removes messages from the middle of the conversation until it fits in budget tokens.
+// The leading system messages and the last message are kept, an assistant message is removed along with the
+// results of its tool calls, and the kept conversation doesn't start with a reply.
+func middleOut(messages []model.Message, modelName string, budget int) ([]model.Message, int) {
+	total := openai.CountTokenMessages(messages, modelName)
+	// every message costs its own tokens plus a fixed overhead, which is counted once per request
+	overhead := openai.CountTokenMessages(nil, modelName)
+	start := 0
+	for start < len(messages) && messages[start].Role == role.System {
+		start++
+	}
+	// units are the removable groups of messages, [from, to)
+	type unit struct{ from, to int }
+	var units []unit
+	for i := start; i < len(messages)-1; {
+		j := i + 1
+		if messages[i].Role == role.Assistant && len(messages[i].ToolCalls) > 0 {
+			for j < len(messages)-1 && messages[j].Role == "tool" {
+				j++
+			}
+		}
+		units = append(units, unit{i, j})
+		i = j
+	}
+	removed := make([]bool, len(messages))
+	cost := func(u unit) int {
+		tokens := 0
+		for i := u.from; i < u.to; i++ {
+			tokens += openai.CountTokenMessages(messages[i:i+1], modelName) - overhead
+		}
+		return tokens
+	}
+	trimmed := false
+	for total > budget && len(units) > 0 {
+		trimmed = true
+		middle := len(units) / 2
+		u := units[middle]
+		units = append(units[:middle], units[middle+1:]...)
+		total -= cost(u)
+		for i := u.from; i < u.to; i++ {
+			removed[i] = true
+		}
+	}
+	// the first kept message after the system prompt should come from the user
+	for trimmed && len(units) > 0 && messages[units[0].from].Role != role.User {
+		u := units[0]
+		units = units[1:]
+		total -= cost(u)
+		for i := u.from; i < u.to; i++ {
+			removed[i] = true
+		}
+	}
+	kept := make([]model.Message, 0, len(messages))
+	for i, message := range messages {
+		if !removed[i] {
+			kept = append(kept, message)
+		}
+	}
+	return kept, total
+}
+
+// fitContextWindow checks the prompt against the context length of the model, set in the model pricing.
+// max_tokens is clamped to the room left by the prompt, and a prompt which doesn't fit is either trimmed with the
+// middle-out transform or rejected. It returns the prompt tokens, which change when messages are removed.
+func fitContextWindow(ctx context.Context, meta *meta.Meta, textRequest *model.GeneralOpenAIRequest, promptTokens int) (int, *model.ErrorWithStatusCode) {
+	contextLength := getContextLength(meta)
+	if contextLength <= 0 {
+		return promptTokens, nil
+	}
+	maxTokens := getMaxTokens(textRequest)
+	if promptTokens >= contextLength && meta.Mode == relaymode.ChatCompletions && hasTransform(textRequest, middleOutTransform) {
+		reserved := maxTokens
+		if reserved > contextLength/2 {
+			reserved = contextLength / 2
+		}
+		count := len(textRequest.Messages)
+		textRequest.Messages, promptTokens = middleOut(textRequest.Messages, textRequest.Model, contextLength-reserved)
+		meta.RequestRewritten = true
+		logger.Infof(ctx, "middle-out removed %d messages, %d prompt tokens left", count-len(textRequest.Messages), promptTokens)
+	}
+	if promptTokens >= contextLength {
+		return promptTokens, openai.ErrorWrapper(
+			fmt.Errorf("this model's maximum context length is %d tokens, however the prompt has %d tokens", contextLength, promptTokens),
+			"context_length_exceeded", http.StatusBadRequest)
+	}
+	if maxTokens > 0 && promptTokens+maxTokens > contextLength {
+		setMaxTokens(textRequest, contextLength-promptTokens)
+		meta.RequestRewritten = true
+		logger.Infof(ctx, "max tokens clamped from %d to %d", maxTokens, contextLength-promptTokens)
+	}
+	return promptTokens, nil
+}
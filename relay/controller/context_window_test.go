@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestMiddleOut(t *testing.T) {
+	config.ApproximateTokenEnabled = true
+	const modelName = "gpt-4o"
+	system := model.Message{Role: "system", Content: "You are a helpful assistant."}
+	user := func(content string) model.Message {
+		return model.Message{Role: "user", Content: content}
+	}
+	assistant := func(content string) model.Message {
+		return model.Message{Role: "assistant", Content: content}
+	}
+	toolCall := model.Message{Role: "assistant", ToolCalls: []model.Tool{{Id: "call_1", Type: "function", Function: model.Function{Name: "search", Arguments: `{"q": "weather"}`}}}}
+	toolResult := model.Message{Role: "tool", Content: "It is sunny in Paris today.", ToolCallId: "call_1"}
+	messages := []model.Message{
+		system,
+		user("What is the weather like in Paris?"),
+		toolCall,
+		toolResult,
+		user("And what about tomorrow, will it rain?"),
+		assistant("Tomorrow should be cloudy with some rain in the evening."),
+		user("Thanks, what should I wear then?"),
+	}
+	total := openai.CountTokenMessages(messages, modelName)
+
+	// a conversation which fits is kept as it is
+	kept, tokens := middleOut(messages, modelName, total)
+	assert.Equal(t, messages, kept)
+	assert.Equal(t, total, tokens)
+
+	// the middle message goes first
+	kept, tokens = middleOut(messages, modelName, total-1)
+	assert.Equal(t, []model.Message{messages[0], messages[1], toolCall, toolResult, messages[5], messages[6]}, kept)
+	assert.Equal(t, openai.CountTokenMessages(kept, modelName), tokens)
+
+	// a tool call is removed along with its result
+	kept, tokens = middleOut(messages, modelName, openai.CountTokenMessages(kept, modelName)-1)
+	assert.Equal(t, []model.Message{messages[0], messages[1], messages[5], messages[6]}, kept)
+	assert.Equal(t, openai.CountTokenMessages(kept, modelName), tokens)
+
+	// the system prompt and the last message are always kept, even when they don't fit
+	kept, tokens = middleOut(messages, modelName, 0)
+	assert.Equal(t, []model.Message{system, messages[6]}, kept)
+	assert.Equal(t, openai.CountTokenMessages(kept, modelName), tokens)
+
+	// the kept conversation doesn't start with a reply
+	messages = []model.Message{system, assistant("Hello, how can I help?"), user("Hi"), assistant("Hello again!"), user("Tell me a joke.")}
+	total = openai.CountTokenMessages(messages, modelName)
+	kept, _ = middleOut(messages, modelName, total-1)
+	assert.Equal(t, []model.Message{system, messages[4]}, kept)
+}
@@ -0,0 +1,562 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/constant/finishreason"
+	"github.com/songquanpeng/one-api/relay/guardrail"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// GuardrailBlockedErrorCode is the code of requests blocked by a guardrail, which never reach the channel
+const GuardrailBlockedErrorCode = "guardrail_blocked"
+
+// rewriteRequestText passes every text of the request through rewrite: the contents and the tool call arguments of
+// the messages, the prompt and the input
+func rewriteRequestText(textRequest *model.GeneralOpenAIRequest, rewrite func(string) string) {
+	rewriteAny := func(value any) any {
+		switch v := value.(type) {
+		case string:
+			return rewrite(v)
+		case []any:
+			for i, item := range v {
+				switch part := item.(type) {
+				case string:
+					v[i] = rewrite(part)
+				case map[string]any:
+					if text, ok := part["text"].(string); ok {
+						part["text"] = rewrite(text)
+					}
+				}
+			}
+		}
+		return value
+	}
+	for i := range textRequest.Messages {
+		message := &textRequest.Messages[i]
+		message.Content = rewriteAny(message.Content)
+		// the arguments of the tool calls of the history are sent back to the model too
+		for j := range message.ToolCalls {
+			if arguments := getArguments(message.ToolCalls[j].Function.Arguments); arguments != "" {
+				message.ToolCalls[j].Function.Arguments = rewrite(arguments)
+			}
+		}
+	}
+	textRequest.Prompt = rewriteAny(textRequest.Prompt)
+	textRequest.Input = rewriteAny(textRequest.Input)
+}
+
+func mergeHits(hits []guardrail.Hit, more []guardrail.Hit) []guardrail.Hit {
+	for _, hit := range more {
+		merged := false
+		for i := range hits {
+			if hits[i].Rule == hit.Rule && hits[i].Action == hit.Action {
+				hits[i].Count += hit.Count
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			hits = append(hits, hit)
+		}
+	}
+	return hits
+}
+
+// recordGuardrailHits logs the hits of a policy, the matched text itself is never logged
+func recordGuardrailHits(ctx context.Context, meta *meta.Meta, policy *guardrail.Policy, stage string, hits []guardrail.Hit) {
+	if len(hits) == 0 {
+		return
+	}
+	var parts []string
+	for _, hit := range hits {
+		parts = append(parts, fmt.Sprintf("%s %s × %d", hit.Rule, hit.Action, hit.Count))
+	}
+	stageName := "请求"
+	if stage == guardrail.StageResponse {
+		stageName = "响应"
+	}
+	content := fmt.Sprintf("安全策略 %s 在%s中命中：%s", policy.Name(), stageName, strings.Join(parts, "，"))
+	logger.Warnf(ctx, "guardrail policy %s hit in %s: %s", policy.Name(), stage, strings.Join(parts, ", "))
+	go dbmodel.RecordGuardrailLog(ctx, &dbmodel.Log{
+		UserId:    meta.UserId,
+		Content:   content,
+		TokenName: meta.TokenName,
+		ModelName: meta.OriginModelName,
+		ChannelId: meta.ChannelId,
+		IsStream:  meta.IsStream,
+	})
+}
+
+func guardrailBlocked(policy *guardrail.Policy, stage string) *model.ErrorWithStatusCode {
+	return openai.ErrorWrapper(fmt.Errorf("the %s was blocked by the guardrail policy %s", stage, policy.Name()), GuardrailBlockedErrorCode, http.StatusBadRequest)
+}
+
+type moderationResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+}
+
+// moderate calls /v1/moderations on a channel of the group serving the moderation model, it returns the flagged
+// categories. Moderation calls aren't billed, as they are free on openai. Only the channels with an openai api are
+// used, the other providers don't have the endpoint or authenticate differently.
+func moderate(ctx context.Context, group string, modelName string, input string) (bool, []string, error) {
+	channel, err := dbmodel.CacheGetRandomSatisfiedChannel(group, modelName, false)
+	if err != nil {
+		return false, nil, err
+	}
+	if !supportsModeration(channel.Type) {
+		return false, nil, fmt.Errorf("channel #%d serving the moderation model %s has no openai moderation api", channel.Id, modelName)
+	}
+	apiKey := channel.Key
+	if channel.KeyCount > 0 {
+		cfg, _ := channel.LoadConfig()
+		key, err := dbmodel.SelectChannelKey(channel.Id, cfg.KeySelection)
+		if err != nil {
+			return false, nil, fmt.Errorf("no key of channel #%d is available: %w", channel.Id, err)
+		}
+		apiKey = key.Key
+	}
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" {
+		baseURL = channeltype.ChannelBaseURLs[channel.Type]
+	}
+	body, err := json.Marshal(map[string]any{"model": modelName, "input": input})
+	if err != nil {
+		return false, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/v1/moderations", bytes.NewReader(body))
+	if err != nil {
+		return false, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return false, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, nil, fmt.Errorf("moderation returned status %d", resp.StatusCode)
+	}
+	var moderation moderationResponse
+	if err = json.NewDecoder(resp.Body).Decode(&moderation); err != nil {
+		return false, nil, err
+	}
+	flagged := false
+	var categories []string
+	for _, result := range moderation.Results {
+		if !result.Flagged {
+			continue
+		}
+		flagged = true
+		for category, ok := range result.Categories {
+			if ok {
+				categories = append(categories, category)
+			}
+		}
+	}
+	return flagged, categories, nil
+}
+
+// supportsModeration tells if the channel serves the openai moderation api with a bearer key
+func supportsModeration(channelType int) bool {
+	switch channelType {
+	case channeltype.OpenAI, channeltype.OpenAICompatible, channeltype.Custom:
+		return true
+	}
+	return false
+}
+
+// rewriteTexts passes the texts which are set through rewrite, for requests holding their text in a few fields
+func rewriteTexts(texts ...*string) func(rewrite func(string) string) {
+	return func(rewrite func(string) string) {
+		for _, text := range texts {
+			if *text != "" {
+				*text = rewrite(*text)
+			}
+		}
+	}
+}
+
+// getGuardrailPolicies returns the policies of the group and the token, the request is refused when one of them
+// is missing rather than sent unfiltered
+func getGuardrailPolicies(c *gin.Context, meta *meta.Meta) ([]*guardrail.Policy, *model.ErrorWithStatusCode) {
+	policies, err := guardrail.GetPolicies(meta.Group, c.GetString(ctxkey.GuardrailPolicy))
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "failed to get the guardrail policies: %s", err.Error())
+		return nil, openai.ErrorWrapper(err, GuardrailBlockedErrorCode, http.StatusForbidden)
+	}
+	return policies, nil
+}
+
+// filterRequest is the guardrail step of every relay mode: visit passes each text of the request through the
+// rewrite it is given. The policies are returned for the response.
+func filterRequest(c *gin.Context, meta *meta.Meta, visit func(rewrite func(string) string)) ([]*guardrail.Policy, *model.ErrorWithStatusCode) {
+	policies, bizErr := getGuardrailPolicies(c, meta)
+	if bizErr != nil {
+		return nil, bizErr
+	}
+	return policies, applyRequestGuardrails(c.Request.Context(), meta, policies, visit)
+}
+
+// applyRequestGuardrails filters the request with the policies before it is sent, the matches are rewritten in
+// place. An error is returned when a policy blocks the request.
+func applyRequestGuardrails(ctx context.Context, meta *meta.Meta, policies []*guardrail.Policy, visit func(rewrite func(string) string)) *model.ErrorWithStatusCode {
+	for _, policy := range policies {
+		if !policy.HasStage(guardrail.StageRequest) {
+			continue
+		}
+		var hits []guardrail.Hit
+		blocked := false
+		visit(func(text string) string {
+			filtered, textHits, textBlocked := policy.Apply(text)
+			hits = mergeHits(hits, textHits)
+			blocked = blocked || textBlocked
+			return filtered
+		})
+		if len(hits) > 0 {
+			meta.RequestRewritten = true
+		}
+		if !blocked && policy.ModerationModel != "" {
+			var input []string
+			visit(func(text string) string {
+				input = append(input, text)
+				return text
+			})
+			flagged, categories, err := moderate(ctx, meta.Group, policy.ModerationModel, strings.Join(input, "\n"))
+			if err != nil {
+				// an unavailable moderation doesn't stop the traffic, the other rules still apply
+				logger.Errorf(ctx, "moderation with %s failed: %s", policy.ModerationModel, err.Error())
+			} else if flagged {
+				logger.Warnf(ctx, "request flagged by moderation: %s", strings.Join(categories, ", "))
+				hits = append(hits, guardrail.Hit{Rule: "moderation", Action: guardrail.ActionBlock, Count: 1})
+				blocked = true
+			}
+		}
+		recordGuardrailHits(ctx, meta, policy, guardrail.StageRequest, hits)
+		if blocked {
+			return guardrailBlocked(policy, guardrail.StageRequest)
+		}
+	}
+	return nil
+}
+
+func hasResponseGuardrails(policies []*guardrail.Policy) bool {
+	for _, policy := range policies {
+		if policy.HasStage(guardrail.StageResponse) {
+			return true
+		}
+	}
+	return false
+}
+
+// responseGuardrails filters the text of the choices of a response with the policies of the response stage
+type responseGuardrails struct {
+	policies []*guardrail.Policy
+	hits     map[*guardrail.Policy][]guardrail.Hit
+}
+
+func newResponseGuardrails(policies []*guardrail.Policy) *responseGuardrails {
+	g := &responseGuardrails{hits: map[*guardrail.Policy][]guardrail.Hit{}}
+	for _, policy := range policies {
+		if policy.HasStage(guardrail.StageResponse) {
+			g.policies = append(g.policies, policy)
+		}
+	}
+	return g
+}
+
+func (g *responseGuardrails) apply(text string) (string, bool) {
+	blocked := false
+	for _, policy := range g.policies {
+		filtered, hits, policyBlocked := policy.Apply(text)
+		g.hits[policy] = mergeHits(g.hits[policy], hits)
+		blocked = blocked || policyBlocked
+		text = filtered
+	}
+	return text, blocked
+}
+
+func (g *responseGuardrails) record(ctx context.Context, meta *meta.Meta) {
+	for _, policy := range g.policies {
+		recordGuardrailHits(ctx, meta, policy, guardrail.StageResponse, g.hits[policy])
+	}
+}
+
+// choiceText is where a choice holds its text: the message of chat completions, the delta of streams, or the
+// choice itself for completions
+func choiceText(choice map[string]any) (map[string]any, string) {
+	for _, key := range []string{"message", "delta"} {
+		if holder, ok := choice[key].(map[string]any); ok {
+			return holder, "content"
+		}
+	}
+	return choice, "text"
+}
+
+// toolCallArguments returns the function of every tool call of a message or delta, with its arguments
+func toolCallArguments(holder map[string]any) []map[string]any {
+	var functions []map[string]any
+	toolCalls, _ := holder["tool_calls"].([]any)
+	for _, toolCall := range toolCalls {
+		toolCallMap, _ := toolCall.(map[string]any)
+		if function, ok := toolCallMap["function"].(map[string]any); ok {
+			functions = append(functions, function)
+		}
+	}
+	return functions
+}
+
+// convertResponse filters the choices of a complete response, the text and the arguments of the tool calls. A
+// blocked choice loses them and finishes with content_filter like the content filter of openai.
+func (g *responseGuardrails) convertResponse(body []byte) []byte {
+	var response map[string]any
+	if err := json.Unmarshal(body, &response); err != nil {
+		return body
+	}
+	choices, _ := response["choices"].([]any)
+	for _, choice := range choices {
+		choiceMap, _ := choice.(map[string]any)
+		holder, key := choiceText(choiceMap)
+		blocked := false
+		if text, ok := holder[key].(string); ok {
+			holder[key], blocked = g.apply(text)
+		}
+		for _, function := range toolCallArguments(holder) {
+			if arguments, ok := function["arguments"].(string); ok {
+				filtered, argumentsBlocked := g.apply(arguments)
+				function["arguments"] = filtered
+				blocked = blocked || argumentsBlocked
+			}
+		}
+		if blocked {
+			holder[key] = nil
+			delete(holder, "tool_calls")
+			choiceMap["finish_reason"] = finishreason.ContentFilter
+		}
+	}
+	rewritten, err := json.Marshal(response)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
+
+// streamText is a text of a stream filtered on its own: the text of a choice, or the arguments of one of its tool
+// calls
+type streamText struct {
+	choice int
+	// toolCall is the index of the tool call, -1 for the text of the choice
+	toolCall int
+}
+
+// guardrailStreamConverter filters the chunks of a stream, every text has its own filters holding back its last
+// bytes. A choice is blocked as a whole.
+type guardrailStreamConverter struct {
+	*responseGuardrails
+	filters map[streamText][]*guardrail.StreamFilter
+	blocked map[int]bool
+	last    map[string]any
+}
+
+func newGuardrailStreamConverter(guardrails *responseGuardrails) *guardrailStreamConverter {
+	return &guardrailStreamConverter{
+		responseGuardrails: guardrails,
+		filters:            map[streamText][]*guardrail.StreamFilter{},
+		blocked:            map[int]bool{},
+	}
+}
+
+func (g *guardrailStreamConverter) feed(key streamText, text string, flush bool) (string, bool) {
+	filters, ok := g.filters[key]
+	if !ok {
+		for _, policy := range g.policies {
+			filters = append(filters, policy.NewStreamFilter(config.GuardrailStreamLookbehind))
+		}
+		g.filters[key] = filters
+	}
+	blocked := false
+	for _, filter := range filters {
+		filtered, hits, filterBlocked := filter.Feed(text)
+		if flush {
+			rest, restHits, restBlocked := filter.Flush()
+			filtered += rest
+			hits = mergeHits(hits, restHits)
+			filterBlocked = filterBlocked || restBlocked
+		}
+		g.hits[filter.Policy()] = mergeHits(g.hits[filter.Policy()], hits)
+		blocked = blocked || filterBlocked
+		text = filtered
+	}
+	return text, blocked
+}
+
+// pending returns the texts of a stream which have filters, in order, all of them when choice is -1
+func (g *guardrailStreamConverter) pending(choice int) []streamText {
+	var keys []streamText
+	for key := range g.filters {
+		if choice < 0 || key.choice == choice {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].choice != keys[j].choice {
+			return keys[i].choice < keys[j].choice
+		}
+		return keys[i].toolCall < keys[j].toolCall
+	})
+	return keys
+}
+
+func (g *guardrailStreamConverter) convertLine(line string) string {
+	chunk, ok := parseStreamChunk(line)
+	if !ok {
+		if strings.HasPrefix(line, "data: [DONE]") {
+			return g.flushAll() + line
+		}
+		return line
+	}
+	g.last = chunk
+	choices, _ := chunk["choices"].([]any)
+	for _, choice := range choices {
+		choiceMap, _ := choice.(map[string]any)
+		indexValue, _ := choiceMap["index"].(float64)
+		index := int(indexValue)
+		holder, key := choiceText(choiceMap)
+		if g.blocked[index] {
+			if _, ok := holder[key]; ok {
+				holder[key] = ""
+			}
+			delete(holder, "tool_calls")
+			delete(choiceMap, "finish_reason")
+			continue
+		}
+		finished := choiceMap["finish_reason"] != nil
+		text, _ := holder[key].(string)
+		filtered, blocked := g.feed(streamText{choice: index, toolCall: -1}, text, finished)
+		fed := map[int]bool{}
+		toolCalls, _ := holder["tool_calls"].([]any)
+		for _, toolCall := range toolCalls {
+			toolCallMap, _ := toolCall.(map[string]any)
+			function, _ := toolCallMap["function"].(map[string]any)
+			toolCallIndex, _ := toolCallMap["index"].(float64)
+			fed[int(toolCallIndex)] = true
+			arguments, _ := function["arguments"].(string)
+			filteredArguments, argumentsBlocked := g.feed(streamText{choice: index, toolCall: int(toolCallIndex)}, arguments, finished)
+			blocked = blocked || argumentsBlocked
+			if _, ok := function["arguments"]; ok || filteredArguments != "" {
+				if function == nil {
+					function = map[string]any{}
+					toolCallMap["function"] = function
+				}
+				function["arguments"] = filteredArguments
+			}
+		}
+		if finished {
+			// the arguments held back for the tool calls which are not in the last chunk
+			for _, pending := range g.pending(index) {
+				if pending.toolCall < 0 || fed[pending.toolCall] {
+					continue
+				}
+				rest, restBlocked := g.feed(pending, "", true)
+				blocked = blocked || restBlocked
+				if rest != "" {
+					toolCalls = append(toolCalls, map[string]any{"index": pending.toolCall, "function": map[string]any{"arguments": rest}})
+				}
+			}
+			if len(toolCalls) > 0 {
+				holder["tool_calls"] = toolCalls
+			}
+		}
+		if blocked {
+			g.blocked[index] = true
+			holder[key] = ""
+			delete(holder, "tool_calls")
+			choiceMap["finish_reason"] = finishreason.ContentFilter
+			continue
+		}
+		if _, ok := holder[key]; ok || filtered != "" {
+			holder[key] = filtered
+		}
+	}
+	return formatStreamChunk(chunk, line)
+}
+
+// flushAll sends the texts still held back when the stream ends without a finish_reason
+func (g *guardrailStreamConverter) flushAll() string {
+	var lines strings.Builder
+	for _, key := range g.pending(-1) {
+		if g.blocked[key.choice] {
+			continue
+		}
+		text, blocked := g.feed(key, "", true)
+		if text == "" && !blocked {
+			continue
+		}
+		delta := map[string]any{"content": text}
+		if key.toolCall >= 0 {
+			delta = map[string]any{"tool_calls": []any{map[string]any{"index": key.toolCall, "function": map[string]any{"arguments": text}}}}
+		}
+		choice := map[string]any{"index": key.choice, "delta": delta}
+		if blocked {
+			g.blocked[key.choice] = true
+			choice = map[string]any{"index": key.choice, "delta": map[string]any{"content": ""}, "finish_reason": finishreason.ContentFilter}
+		}
+		chunk := map[string]any{"choices": []any{choice}}
+		for _, key := range []string{"id", "object", "created", "model"} {
+			if value, ok := g.last[key]; ok {
+				chunk[key] = value
+			}
+		}
+		lines.WriteString(formatStreamChunk(chunk, "") + "\n")
+	}
+	return lines.String()
+}
+
+// guardrailAdaptor wraps the adaptor of a request with guardrail policies on responses, the text of the answer is
+// filtered before it reaches the client
+type guardrailAdaptor struct {
+	adaptor.Adaptor
+	policies []*guardrail.Policy
+}
+
+func (a *guardrailAdaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	guardrails := newResponseGuardrails(a.policies)
+	defer guardrails.record(c.Request.Context(), meta)
+	if meta.IsStream {
+		converter := newGuardrailStreamConverter(guardrails)
+		writer := &sseLineWriter{ResponseWriter: c.Writer, convert: converter.convertLine}
+		c.Writer = writer
+		usage, err = a.Adaptor.DoResponse(c, resp, meta)
+		c.Writer = writer.ResponseWriter
+		return usage, err
+	}
+	buffer := bufferResponse(c)
+	usage, err = a.Adaptor.DoResponse(c, resp, meta)
+	if err != nil {
+		c.Writer = buffer.ResponseWriter
+		return usage, err
+	}
+	buffer.release(c, guardrails.convertResponse(buffer.body.Bytes()))
+	return usage, nil
+}
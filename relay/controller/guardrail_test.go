@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/guardrail"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func setupGuardrailPolicies(t *testing.T, policies string) {
+	// the hits are logged in the background, so the database is left in place after the test
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Log{}))
+	model.DB = db
+	model.LOG_DB = db
+
+	lookbehind := config.GuardrailStreamLookbehind
+	config.GuardrailStreamLookbehind = 16
+	t.Cleanup(func() {
+		config.GuardrailStreamLookbehind = lookbehind
+		require.NoError(t, guardrail.UpdatePoliciesByJSONString(`{}`))
+	})
+	require.NoError(t, guardrail.UpdatePoliciesByJSONString(policies))
+}
+
+func getTestPolicies(t *testing.T, name string) []*guardrail.Policy {
+	policies, err := guardrail.GetPolicies("", name)
+	require.NoError(t, err)
+	return policies
+}
+
+// streamChunk is a chunk with the delta of the first choice
+func streamChunk(delta string, finishReason string) string {
+	reason := "null"
+	if finishReason != "" {
+		reason = `"` + finishReason + `"`
+	}
+	return `data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":` + delta + `,"finish_reason":` + reason + `}]}` + "\n"
+}
+
+// mergeConvertedStream runs the lines through the converter and puts the content, the tool call arguments and the
+// finish reason of the first choice back together
+func mergeConvertedStream(t *testing.T, converter *guardrailStreamConverter, lines []string) (string, string, string) {
+	var body strings.Builder
+	for _, line := range lines {
+		body.WriteString(converter.convertLine(line))
+	}
+	response := mergeStreamResponse([]byte(body.String()))
+	require.Len(t, response.Choices, 1)
+	message := response.Choices[0].Message
+	arguments := ""
+	if len(message.ToolCalls) > 0 {
+		arguments = getArguments(message.ToolCalls[0].Function.Arguments)
+	}
+	return message.StringContent(), arguments, response.Choices[0].FinishReason
+}
+
+func TestGuardrailStreamConverter(t *testing.T) {
+	setupGuardrailPolicies(t, `{"pii": {"detectors": {"email": "redact"}, "keywords": ["project falcon"]}}`)
+	policies := getTestPolicies(t, "pii")
+	newConverter := func() *guardrailStreamConverter {
+		return newGuardrailStreamConverter(newResponseGuardrails(policies))
+	}
+
+	// a match split over chunks is found, the text held back comes with the finish reason
+	content, _, finishReason := mergeConvertedStream(t, newConverter(), []string{
+		streamChunk(`{"role":"assistant","content":"write to jane.d"}`, ""),
+		streamChunk(`{"content":"oe@example.com for the details"}`, ""),
+		streamChunk(`{}`, "stop"),
+		"data: [DONE]\n",
+	})
+	assert.Equal(t, "write to [REDACTED_EMAIL] for the details", content)
+	assert.Equal(t, "stop", finishReason)
+
+	// the arguments of the tool calls are filtered the same
+	_, arguments, finishReason := mergeConvertedStream(t, newConverter(), []string{
+		streamChunk(`{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"send","arguments":"{\"to\": \"jane."}}]}`, ""),
+		streamChunk(`{"tool_calls":[{"index":0,"function":{"arguments":"doe@example.com\"}"}}]}`, ""),
+		streamChunk(`{}`, "tool_calls"),
+		"data: [DONE]\n",
+	})
+	assert.Equal(t, `{"to": "[REDACTED_EMAIL]"}`, arguments)
+	assert.Equal(t, "tool_calls", finishReason)
+
+	// a blocked choice stops there
+	content, _, finishReason = mergeConvertedStream(t, newConverter(), []string{
+		streamChunk(`{"role":"assistant","content":"the status of project fal"}`, ""),
+		streamChunk(`{"content":"con is"}`, ""),
+		streamChunk(`{"content":" on track"}`, ""),
+		streamChunk(`{}`, "stop"),
+		"data: [DONE]\n",
+	})
+	assert.NotContains(t, content, "falcon")
+	assert.NotContains(t, content, "on track")
+	assert.Equal(t, "content_filter", finishReason)
+
+	// what is held back is sent before [DONE] when the stream has no finish reason
+	content, _, _ = mergeConvertedStream(t, newConverter(), []string{
+		streamChunk(`{"role":"assistant","content":"mail jane.doe@example.com"}`, ""),
+		"data: [DONE]\n",
+	})
+	assert.Equal(t, "mail [REDACTED_EMAIL]", content)
+}
+
+func TestGuardrailConvertResponse(t *testing.T) {
+	setupGuardrailPolicies(t, `{"pii": {"detectors": {"email": "redact"}, "keywords": ["project falcon"]}}`)
+	guardrails := newResponseGuardrails(getTestPolicies(t, "pii"))
+
+	body := guardrails.convertResponse([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":null,
+		"tool_calls":[{"id":"call_1","type":"function","function":{"name":"send","arguments":"{\"to\": \"jane.doe@example.com\"}"}}]},"finish_reason":"tool_calls"}]}`))
+	assert.JSONEq(t, `{"choices":[{"index":0,"message":{"role":"assistant","content":null,
+		"tool_calls":[{"id":"call_1","type":"function","function":{"name":"send","arguments":"{\"to\": \"[REDACTED_EMAIL]\"}"}}]},"finish_reason":"tool_calls"}]}`, string(body))
+
+	body = guardrails.convertResponse([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"ok",
+		"tool_calls":[{"id":"call_1","type":"function","function":{"name":"search","arguments":"{\"q\": \"project falcon\"}"}}]},"finish_reason":"tool_calls"}]}`))
+	assert.JSONEq(t, `{"choices":[{"index":0,"message":{"role":"assistant","content":null},"finish_reason":"content_filter"}]}`, string(body))
+}
+
+func TestFilterRequest(t *testing.T) {
+	setupGuardrailPolicies(t, `{"pii": {"detectors": {"email": "redact"}, "keywords": ["project falcon"]}}`)
+	newContext := func(policy string) *gin.Context {
+		gin.SetMode(gin.TestMode)
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/images/generations", nil)
+		c.Set(ctxkey.GuardrailPolicy, policy)
+		return c
+	}
+
+	prompt := "a portrait of jane.doe@example.com"
+	relayMeta := &meta.Meta{}
+	_, bizErr := filterRequest(newContext("pii"), relayMeta, rewriteTexts(&prompt))
+	require.Nil(t, bizErr)
+	assert.Equal(t, "a portrait of [REDACTED_EMAIL]", prompt)
+	assert.True(t, relayMeta.RequestRewritten)
+
+	prompt = "the logo of project falcon"
+	_, bizErr = filterRequest(newContext("pii"), &meta.Meta{}, rewriteTexts(&prompt))
+	require.NotNil(t, bizErr)
+	assert.Equal(t, GuardrailBlockedErrorCode, bizErr.Error.Code)
+
+	// the request is refused when the policy is missing
+	_, bizErr = filterRequest(newContext("deleted"), &meta.Meta{}, rewriteTexts(&prompt))
+	require.NotNil(t, bizErr)
+	assert.Equal(t, http.StatusForbidden, bizErr.StatusCode)
+}
+
+func TestRewriteRequestToolCalls(t *testing.T) {
+	var textRequest relaymodel.GeneralOpenAIRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"model": "gpt-4o", "messages": [
+		{"role": "user", "content": "Write to jane"},
+		{"role": "assistant", "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "send", "arguments": "{\"to\": \"jane.doe@example.com\"}"}}]}
+	]}`), &textRequest))
+	rewriteRequestText(&textRequest, strings.ToUpper)
+	assert.Equal(t, "WRITE TO JANE", textRequest.Messages[0].Content)
+	assert.Equal(t, `{"TO": "JANE.DOE@EXAMPLE.COM"}`, textRequest.Messages[1].ToolCalls[0].Function.Arguments)
+}
+
+func TestModerateMultiKeyChannel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk-enabled" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"results": [{"flagged": true, "categories": {"violence": true, "hate": false}}]}`))
+	}))
+	defer server.Close()
+	client.Init()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.Channel{}, &model.ChannelKey{}, &model.Ability{}))
+	model.DB = db
+	memoryCacheEnabled := config.MemoryCacheEnabled
+	config.MemoryCacheEnabled = true
+	t.Cleanup(func() { config.MemoryCacheEnabled = memoryCacheEnabled })
+
+	// the key of the channel is the first one, which is disabled
+	channel := &model.Channel{Type: channeltype.OpenAI, Key: "sk-disabled", KeyCount: 2, BaseURL: &server.URL,
+		Group: "default", Models: "omni-moderation-latest", Status: model.ChannelStatusEnabled}
+	require.NoError(t, db.Create(channel).Error)
+	require.NoError(t, channel.AddAbilities())
+	require.NoError(t, db.Create(&model.ChannelKey{ChannelId: channel.Id, Key: "sk-disabled", Status: model.ChannelStatusManuallyDisabled}).Error)
+	require.NoError(t, db.Create(&model.ChannelKey{ChannelId: channel.Id, Key: "sk-enabled", Status: model.ChannelStatusEnabled}).Error)
+	model.InitChannelCache()
+
+	flagged, categories, err := moderate(context.Background(), "default", "omni-moderation-latest", "a threat")
+	require.NoError(t, err)
+	assert.True(t, flagged)
+	assert.Equal(t, []string{"violence"}, categories)
+}
+
+func TestRewriteRealtimeEvent(t *testing.T) {
+	var event map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{"type":"conversation.item.create","item":{"type":"message","role":"user",
+		"content":[{"type":"input_text","text":"hello"},{"type":"input_audio","audio":"AAAA"}]}}`), &event))
+	rewriteRealtimeEvent(event, strings.ToUpper)
+	data, err := json.Marshal(event)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"conversation.item.create","item":{"type":"message","role":"user",
+		"content":[{"type":"input_text","text":"HELLO"},{"type":"input_audio","audio":"AAAA"}]}}`, string(data))
+
+	event = map[string]any{"type": "session.update", "session": map[string]any{"instructions": "be nice", "voice": "alloy"}}
+	rewriteRealtimeEvent(event, strings.ToUpper)
+	assert.Equal(t, map[string]any{"instructions": "BE NICE", "voice": "alloy"}, event["session"])
+}
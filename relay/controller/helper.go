@@ -94,6 +94,16 @@ func preConsumeQuota(ctx context.Context, textRequest *relaymodel.GeneralOpenAIR
 	return preConsumedQuota, nil
 }
 
+// getBilledPromptTokens prices the prompt tokens read from and written into the cache with their own ratios
+func getBilledPromptTokens(usage *relaymodel.Usage, modelName string) float64 {
+	promptTokens := float64(usage.PromptTokens)
+	if details := usage.PromptTokensDetails; details != nil {
+		promptTokens += float64(details.CachedTokens) * (billingratio.GetCacheReadRatio(modelName) - 1)
+		promptTokens += float64(details.CacheCreationTokens) * (billingratio.GetCacheWriteRatio(modelName) - 1)
+	}
+	return promptTokens
+}
+
 func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest, ratio float64, preConsumedQuota int64, modelRatio float64, groupRatio float64, systemPromptReset bool) {
 	if usage == nil {
 		logger.Error(ctx, "usage is nil, which is unexpected")
@@ -103,7 +113,7 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 	completionRatio := billingratio.GetCompletionRatio(textRequest.Model, meta.ChannelType)
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
-	quota = int64(math.Ceil((float64(promptTokens) + float64(completionTokens)*completionRatio) * ratio))
+	quota = int64(math.Ceil((getBilledPromptTokens(usage, textRequest.Model) + float64(completionTokens)*completionRatio) * ratio))
 	if ratio != 0 && quota <= 0 {
 		quota = 1
 	}
@@ -123,6 +133,24 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 		logger.Error(ctx, "error update user quota cache: "+err.Error())
 	}
 	logContent := fmt.Sprintf("倍率：%.2f × %.2f × %.2f", modelRatio, groupRatio, completionRatio)
+	if details := usage.PromptTokensDetails; details != nil && details.CachedTokens > 0 {
+		logContent += fmt.Sprintf("，缓存读取 %d × %.2f", details.CachedTokens, billingratio.GetCacheReadRatio(textRequest.Model))
+	}
+	if details := usage.PromptTokensDetails; details != nil && details.CacheCreationTokens > 0 {
+		logContent += fmt.Sprintf("，缓存写入 %d × %.2f", details.CacheCreationTokens, billingratio.GetCacheWriteRatio(textRequest.Model))
+	}
+	if meta.BatchId != "" {
+		logContent += fmt.Sprintf("，批处理 %s × %.2f", meta.BatchId, config.BatchRatio)
+	}
+	if meta.CacheHit {
+		logContent += fmt.Sprintf("，缓存命中 × %.2f", config.ResponseCacheHitRatio)
+	}
+	if meta.Preset != "" {
+		logContent += fmt.Sprintf("，预设 %s", meta.Preset)
+	}
+	if meta.MCPHop > 0 {
+		logContent += fmt.Sprintf("，MCP 工具调用第 %d 轮", meta.MCPHop)
+	}
 	model.RecordConsumeLog(ctx, &model.Log{
 		UserId:            meta.UserId,
 		ChannelId:         meta.ChannelId,
@@ -137,7 +165,9 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 		SystemPromptReset: systemPromptReset,
 	})
 	model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
-	model.UpdateChannelUsedQuota(meta.ChannelId, quota)
+	if !meta.CacheHit {
+		model.UpdateChannelUsedQuota(meta.ChannelId, quota)
+	}
 }
 
 func getMappedModelName(modelName string, mapping map[string]string) (string, bool) {
@@ -196,3 +226,15 @@ func setSystemPrompt(ctx context.Context, request *relaymodel.GeneralOpenAIReque
 	logger.Infof(ctx, "add system prompt")
 	return true
 }
+
+// appendSystemPrompt adds prompt to the leading system message, which is created if there is none
+func appendSystemPrompt(messages []relaymodel.Message, prompt string) []relaymodel.Message {
+	if len(messages) > 0 && messages[0].Role == role.System && messages[0].IsStringContent() {
+		messages[0].Content = messages[0].StringContent() + "\n\n" + prompt
+		return messages
+	}
+	return append([]relaymodel.Message{{
+		Role:    role.System,
+		Content: prompt,
+	}}, messages...)
+}
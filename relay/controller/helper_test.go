@@ -0,0 +1,24 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestGetBilledPromptTokens(t *testing.T) {
+	usage := &relaymodel.Usage{
+		PromptTokens: 4020,
+		PromptTokensDetails: &relaymodel.PromptTokensDetails{
+			CachedTokens:        3000,
+			CacheCreationTokens: 1000,
+		},
+	}
+	// 20 input tokens, the reads at 0.1 and the writes at 1.25
+	assert.InDelta(t, 20+300+1250, getBilledPromptTokens(usage, "claude-3-7-sonnet-20250219"), 0.001)
+	// the models without cache ratios are billed as before
+	assert.InDelta(t, 4020, getBilledPromptTokens(usage, "gpt-4o"), 0.001)
+	assert.InDelta(t, 100, getBilledPromptTokens(&relaymodel.Usage{PromptTokens: 100}, "claude-3-7-sonnet-20250219"), 0.001)
+}
@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -16,19 +18,24 @@ import (
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
-func getImageRequest(c *gin.Context, _ int) (*relaymodel.ImageRequest, error) {
+func getImageRequest(c *gin.Context, relayMode int) (*relaymodel.ImageRequest, error) {
 	imageRequest := &relaymodel.ImageRequest{}
 	err := common.UnmarshalBodyReusable(c, imageRequest)
 	if err != nil {
 		return nil, err
 	}
+	if isImageEditMode(relayMode) && imageRequest.Image == nil {
+		return nil, errors.New("image is required")
+	}
 	if imageRequest.N == 0 {
 		imageRequest.N = 1
 	}
@@ -41,6 +48,10 @@ func getImageRequest(c *gin.Context, _ int) (*relaymodel.ImageRequest, error) {
 	return imageRequest, nil
 }
 
+func isImageEditMode(relayMode int) bool {
+	return relayMode == relaymode.ImagesEdits || relayMode == relaymode.ImagesVariations
+}
+
 func isValidImageSize(model string, size string) bool {
 	if model == "cogview-3" || billingratio.ImageSizeRatios[model] == nil {
 		return true
@@ -66,9 +77,9 @@ func getImageSizeRatio(model string, size string) float64 {
 	return 1
 }
 
-func validateImageRequest(imageRequest *relaymodel.ImageRequest, _ *meta.Meta) *relaymodel.ErrorWithStatusCode {
-	// check prompt length
-	if imageRequest.Prompt == "" {
+func validateImageRequest(imageRequest *relaymodel.ImageRequest, meta *meta.Meta) *relaymodel.ErrorWithStatusCode {
+	// check prompt length, variations have no prompt
+	if imageRequest.Prompt == "" && meta.Mode != relaymode.ImagesVariations {
 		return openai.ErrorWrapper(errors.New("prompt is required"), "prompt_missing", http.StatusBadRequest)
 	}
 
@@ -103,6 +114,93 @@ func getImageCostRatio(imageRequest *relaymodel.ImageRequest) (float64, error) {
 	return imageCostRatio, nil
 }
 
+// getImageEditRequestBody rebuilds the multipart form with the mapped model name and the filtered prompt, the other
+// fields are sent as the client did, without the defaults filled in for the billing
+func getImageEditRequestBody(c *gin.Context, imageRequest *relaymodel.ImageRequest) (io.Reader, error) {
+	overrides := map[string]string{
+		"model": imageRequest.Model,
+	}
+	if imageRequest.Prompt != "" {
+		overrides["prompt"] = imageRequest.Prompt
+	}
+	return rebuildMultipartForm(c, overrides)
+}
+
+// rebuildMultipartForm writes the parsed multipart form again with the fields overridden, the original boundary is
+// kept because the Content-Type header is passed through as is
+func rebuildMultipartForm(c *gin.Context, overrides map[string]string) (*bytes.Buffer, error) {
+	_, params, err := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	form := c.Request.MultipartForm
+	if form == nil {
+		return nil, errors.New("multipart form is empty")
+	}
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	if err = writer.SetBoundary(params["boundary"]); err != nil {
+		return nil, err
+	}
+	for key, value := range overrides {
+		if err = writer.WriteField(key, value); err != nil {
+			return nil, err
+		}
+	}
+	for key, values := range form.Value {
+		if _, ok := overrides[key]; ok {
+			continue
+		}
+		for _, value := range values {
+			if err = writer.WriteField(key, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, headers := range form.File {
+		for _, header := range headers {
+			if err = copyFormFile(writer, header); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func copyFormFile(writer *multipart.Writer, header *multipart.FileHeader) error {
+	file, err := header.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	part, err := writer.CreatePart(header.Header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, file)
+	return err
+}
+
+// convertImageRequest is the body of the adaptors which take their own requests, the edits and variations
+// which the channel can't make are refused as bad requests
+func convertImageRequest(a adaptor.Adaptor, imageRequest *relaymodel.ImageRequest) (io.Reader, *relaymodel.ErrorWithStatusCode) {
+	finalRequest, err := a.ConvertImageRequest(imageRequest)
+	if err != nil {
+		if errors.Is(err, adaptor.ErrUnsupportedRequest) {
+			return nil, openai.ErrorWrapper(err, "image_request_not_supported", http.StatusBadRequest)
+		}
+		return nil, openai.ErrorWrapper(err, "convert_image_request_failed", http.StatusInternalServerError)
+	}
+	jsonStr, err := json.Marshal(finalRequest)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "marshal_image_request_failed", http.StatusInternalServerError)
+	}
+	return bytes.NewBuffer(jsonStr), nil
+}
+
 func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatusCode {
 	ctx := c.Request.Context()
 	meta := meta.GetByContext(c)
@@ -123,6 +221,9 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	if bizErr != nil {
 		return bizErr
 	}
+	if _, bizErr = filterRequest(c, meta, rewriteTexts(&imageRequest.Prompt)); bizErr != nil {
+		return bizErr
+	}
 
 	imageCostRatio, err := getImageCostRatio(imageRequest)
 	if err != nil {
@@ -135,7 +236,12 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	c.Set("response_format", imageRequest.ResponseFormat)
 
 	var requestBody io.Reader
-	if isModelMapped || meta.ChannelType == channeltype.Azure { // make Azure channel request body
+	if isImageEditMode(meta.Mode) {
+		requestBody, err = getImageEditRequestBody(c, imageRequest)
+		if err != nil {
+			return openai.ErrorWrapper(err, "build_image_request_failed", http.StatusInternalServerError)
+		}
+	} else if isModelMapped || meta.RequestRewritten || meta.ChannelType == channeltype.Azure { // make Azure channel request body
 		jsonStr, err := json.Marshal(imageRequest)
 		if err != nil {
 			return openai.ErrorWrapper(err, "marshal_image_request_failed", http.StatusInternalServerError)
@@ -157,15 +263,10 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		channeltype.Ali,
 		channeltype.Replicate,
 		channeltype.Baidu:
-		finalRequest, err := adaptor.ConvertImageRequest(imageRequest)
-		if err != nil {
-			return openai.ErrorWrapper(err, "convert_image_request_failed", http.StatusInternalServerError)
+		requestBody, bizErr = convertImageRequest(adaptor, imageRequest)
+		if bizErr != nil {
+			return bizErr
 		}
-		jsonStr, err := json.Marshal(finalRequest)
-		if err != nil {
-			return openai.ErrorWrapper(err, "marshal_image_request_failed", http.StatusInternalServerError)
-		}
-		requestBody = bytes.NewBuffer(jsonStr)
 	}
 
 	modelRatio := billingratio.GetModelRatio(imageModel, meta.ChannelType)
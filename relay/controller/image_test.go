@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/ali"
+	"github.com/songquanpeng/one-api/relay/adaptor/replicate"
+	"github.com/songquanpeng/one-api/relay/adaptor/zhipu"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+// newImageEditContext posts a multipart form with the fields and an image, and a mask when withMask is set
+func newImageEditContext(t *testing.T, path string, fields map[string]string, withImage bool, withMask bool) *gin.Context {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for key, value := range fields {
+		require.NoError(t, writer.WriteField(key, value))
+	}
+	files := map[string]bool{"image": withImage, "mask": withMask}
+	for name, ok := range files {
+		if !ok {
+			continue
+		}
+		part, err := writer.CreateFormFile(name, name+".png")
+		require.NoError(t, err)
+		_, err = part.Write(pngHeader)
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, path, body)
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	return c
+}
+
+func TestGetImageEditRequest(t *testing.T) {
+	c := newImageEditContext(t, "/v1/images/edits", map[string]string{"prompt": "Add a hat", "model": "dall-e-2", "n": "2"}, true, true)
+	imageRequest, err := getImageRequest(c, relaymode.ImagesEdits)
+	require.NoError(t, err)
+	assert.Equal(t, "Add a hat", imageRequest.Prompt)
+	assert.Equal(t, 2, imageRequest.N)
+	assert.Equal(t, "1024x1024", imageRequest.Size)
+	require.NotNil(t, imageRequest.Image)
+	require.NotNil(t, imageRequest.Mask)
+	assert.Nil(t, validateImageRequest(imageRequest, &meta.Meta{Mode: relaymode.ImagesEdits}))
+
+	// the edits need an image and a prompt, the variations only the image
+	c = newImageEditContext(t, "/v1/images/edits", map[string]string{"prompt": "Add a hat"}, false, false)
+	_, err = getImageRequest(c, relaymode.ImagesEdits)
+	assert.Error(t, err)
+	c = newImageEditContext(t, "/v1/images/variations", map[string]string{"model": "dall-e-2"}, true, false)
+	imageRequest, err = getImageRequest(c, relaymode.ImagesVariations)
+	require.NoError(t, err)
+	assert.Nil(t, validateImageRequest(imageRequest, &meta.Meta{Mode: relaymode.ImagesVariations}))
+	bizErr := validateImageRequest(imageRequest, &meta.Meta{Mode: relaymode.ImagesEdits})
+	require.NotNil(t, bizErr)
+	assert.Equal(t, http.StatusBadRequest, bizErr.StatusCode)
+}
+
+func TestGetImageEditRequestBody(t *testing.T) {
+	c := newImageEditContext(t, "/v1/images/edits", map[string]string{"prompt": "Add a hat", "model": "dall-e-2", "user": "alice"}, true, false)
+	imageRequest, err := getImageRequest(c, relaymode.ImagesEdits)
+	require.NoError(t, err)
+	imageRequest.Model = "mapped-dall-e-2"
+
+	requestBody, err := getImageEditRequestBody(c, imageRequest)
+	require.NoError(t, err)
+	// the boundary is kept so that the content type of the client still matches
+	_, params, err := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	form, err := multipart.NewReader(requestBody, params["boundary"]).ReadForm(1 << 20)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mapped-dall-e-2"}, form.Value["model"])
+	// the defaults of n and size are left to the upstream, some models reject an explicit size
+	assert.NotContains(t, form.Value, "n")
+	assert.NotContains(t, form.Value, "size")
+	assert.Equal(t, []string{"Add a hat"}, form.Value["prompt"])
+	assert.Equal(t, []string{"alice"}, form.Value["user"])
+	require.Len(t, form.File["image"], 1)
+	file, err := form.File["image"][0].Open()
+	require.NoError(t, err)
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	require.NoError(t, err)
+	assert.Equal(t, pngHeader, data)
+}
+
+func TestConvertImageRequest(t *testing.T) {
+	imageRequest := func(t *testing.T, mode int, model string) *relaymodel.ImageRequest {
+		c := newImageEditContext(t, "/v1/images/edits", map[string]string{"prompt": "Add a hat", "model": model}, true, false)
+		request, err := getImageRequest(c, mode)
+		require.NoError(t, err)
+		return request
+	}
+	convert := func(a adaptor.Adaptor, mode int, model string) (io.Reader, *relaymodel.ErrorWithStatusCode) {
+		a.Init(&meta.Meta{Mode: mode, ActualModelName: model})
+		return convertImageRequest(a, imageRequest(t, mode, model))
+	}
+
+	requestBody, bizErr := convert(&replicate.Adaptor{}, relaymode.ImagesEdits, "black-forest-labs/flux-fill-pro")
+	require.Nil(t, bizErr)
+	var edit replicate.InpaintingImageByFlusReplicateRequest
+	require.NoError(t, json.NewDecoder(requestBody).Decode(&edit))
+	assert.Equal(t, "Add a hat", edit.Input.Prompt)
+	assert.Equal(t, "data:image/png;base64,iVBORw0KGgo=", edit.Input.Image)
+
+	requestBody, bizErr = convert(&replicate.Adaptor{}, relaymode.ImagesVariations, "black-forest-labs/flux-redux-dev")
+	require.Nil(t, bizErr)
+	var variation replicate.ReduxImageRequest
+	require.NoError(t, json.NewDecoder(requestBody).Decode(&variation))
+	assert.Equal(t, "data:image/png;base64,iVBORw0KGgo=", variation.Input.ReduxImage)
+
+	// the requests the channel can't make are the client's to change
+	for _, tc := range []struct {
+		name    string
+		adaptor adaptor.Adaptor
+		mode    int
+		model   string
+	}{
+		{"replicate edit", &replicate.Adaptor{}, relaymode.ImagesEdits, "black-forest-labs/flux-schnell"},
+		{"replicate variation", &replicate.Adaptor{}, relaymode.ImagesVariations, "black-forest-labs/flux-fill-pro"},
+		{"ali variation", &ali.Adaptor{}, relaymode.ImagesVariations, "wanx-v1"},
+		{"zhipu edit", &zhipu.Adaptor{}, relaymode.ImagesEdits, "cogview-3"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, bizErr := convert(tc.adaptor, tc.mode, tc.model)
+			require.NotNil(t, bizErr)
+			assert.Equal(t, http.StatusBadRequest, bizErr.StatusCode)
+			assert.Equal(t, "image_request_not_supported", bizErr.Code)
+		})
+	}
+}
@@ -0,0 +1,424 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/constant/role"
+	"github.com/songquanpeng/one-api/relay/guardrail"
+	"github.com/songquanpeng/one-api/relay/mcp"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// mcpToolCall is a tool call run by the gateway, sent to the client in the mcp_tool_call field of a stream chunk,
+// or in the mcp_tool_calls field of a complete response
+type mcpToolCall struct {
+	Id        string `json:"id"`
+	Server    string `json:"server"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Result    string `json:"result"`
+	IsError   bool   `json:"is_error,omitempty"`
+}
+
+// addMCPTools adds the tools of the mcp servers of the group and the token to the request,
+// it returns nil when there are none to run
+func addMCPTools(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralOpenAIRequest) *mcp.Toolset {
+	// the answers with several choices can't be continued
+	if meta.Mode != relaymode.ChatCompletions || textRequest.N > 1 || config.MCPMaxIterations < 2 {
+		return nil
+	}
+	if choice, _ := textRequest.ToolChoice.(string); choice == "none" {
+		return nil
+	}
+	servers := mcp.GetServers(meta.Group, strings.Split(c.GetString(ctxkey.MCPServers), ","))
+	if len(servers) == 0 {
+		return nil
+	}
+	toolset := mcp.GetToolset(c.Request.Context(), servers)
+	toolset.Remove(textRequest.Tools)
+	if len(toolset.Tools) == 0 {
+		return nil
+	}
+	textRequest.Tools = append(textRequest.Tools, toolset.Tools...)
+	meta.RequestRewritten = true
+	return toolset
+}
+
+func getArguments(arguments any) string {
+	switch arguments := arguments.(type) {
+	case nil:
+		return ""
+	case string:
+		return arguments
+	default:
+		data, _ := json.Marshal(arguments)
+		return string(data)
+	}
+}
+
+// splitToolCalls returns the calls of the gateway tools, and whether the client has calls of its own to run
+func splitToolCalls(toolset *mcp.Toolset, calls []model.Tool) ([]model.Tool, bool) {
+	var gatewayCalls []model.Tool
+	clientCalls := false
+	for _, call := range calls {
+		if toolset.Has(call.Function.Name) {
+			gatewayCalls = append(gatewayCalls, call)
+		} else {
+			clientCalls = true
+		}
+	}
+	return gatewayCalls, clientCalls
+}
+
+// mcpStreamConverter holds back the tool calls of the gateway tools from a stream, the text goes on to the client
+type mcpStreamConverter struct {
+	toolset     *mcp.Toolset
+	content     strings.Builder
+	calls       map[int]*model.Tool
+	arguments   map[int]*strings.Builder
+	order       []int
+	clientCalls map[int]bool
+}
+
+func newMCPStreamConverter(toolset *mcp.Toolset) *mcpStreamConverter {
+	return &mcpStreamConverter{
+		toolset:     toolset,
+		calls:       map[int]*model.Tool{},
+		arguments:   map[int]*strings.Builder{},
+		clientCalls: map[int]bool{},
+	}
+}
+
+// filterToolCalls keeps the deltas of the tool calls of the client, the ones of the gateway tools are collected
+func (s *mcpStreamConverter) filterToolCalls(toolCalls []any) []any {
+	var kept []any
+	for i, toolCall := range toolCalls {
+		toolCallMap, _ := toolCall.(map[string]any)
+		index := i
+		if value, ok := toolCallMap["index"].(float64); ok {
+			index = int(value)
+		}
+		function, _ := toolCallMap["function"].(map[string]any)
+		name, _ := function["name"].(string)
+		call, ok := s.calls[index]
+		if !ok && !s.clientCalls[index] && name != "" {
+			if !s.toolset.Has(name) {
+				s.clientCalls[index] = true
+			} else {
+				call = &model.Tool{Type: "function", Function: model.Function{Name: name}}
+				s.calls[index] = call
+				s.arguments[index] = &strings.Builder{}
+				s.order = append(s.order, index)
+			}
+		}
+		if call == nil {
+			kept = append(kept, toolCall)
+			continue
+		}
+		if id, _ := toolCallMap["id"].(string); id != "" {
+			call.Id = id
+		}
+		s.arguments[index].WriteString(getArguments(function["arguments"]))
+	}
+	return kept
+}
+
+func (s *mcpStreamConverter) convertLine(line string) string {
+	chunk, ok := parseStreamChunk(line)
+	if !ok {
+		return line
+	}
+	choices, _ := chunk["choices"].([]any)
+	if len(choices) == 0 {
+		return line
+	}
+	choice, _ := choices[0].(map[string]any)
+	delta, _ := choice["delta"].(map[string]any)
+	if content, ok := delta["content"].(string); ok {
+		s.content.WriteString(content)
+	}
+	if toolCalls, ok := delta["tool_calls"].([]any); ok {
+		if kept := s.filterToolCalls(toolCalls); len(kept) > 0 {
+			delta["tool_calls"] = kept
+		} else {
+			delete(delta, "tool_calls")
+		}
+	}
+	if reason, _ := choice["finish_reason"].(string); reason != "" && len(s.calls) > 0 && len(s.clientCalls) == 0 {
+		// the answer goes on once the tools are run
+		choice["finish_reason"] = nil
+	}
+	if len(delta) == 0 && choice["finish_reason"] == nil && chunk["usage"] == nil {
+		return ""
+	}
+	return formatStreamChunk(chunk, line)
+}
+
+// result returns the assistant message with the calls of the gateway tools, and whether the client has calls too
+func (s *mcpStreamConverter) result() (*model.Message, bool) {
+	message := &model.Message{Role: role.Assistant}
+	if content := s.content.String(); content != "" {
+		message.Content = content
+	}
+	for _, index := range s.order {
+		call := *s.calls[index]
+		call.Function.Arguments = s.arguments[index].String()
+		message.ToolCalls = append(message.ToolCalls, call)
+	}
+	return message, len(s.clientCalls) > 0
+}
+
+// mcpAdaptor wraps the adaptor of a request with gateway tools. The tool calls of the model are run against the
+// mcp servers and the model is called again with their results, until it answers, calls the tools of the client
+// or reaches MCP_MAX_ITERATIONS. The calls of the model and of the tools all run within MCP_TIMEOUT.
+// Every call of the model is billed, the usage of the last one is returned.
+type mcpAdaptor struct {
+	adaptor.Adaptor
+	request *model.GeneralOpenAIRequest
+	toolset *mcp.Toolset
+	// policies filter the results of the tools, which are sent to the model like the rest of the request
+	policies []*guardrail.Policy
+	// bill is called with the usage of the calls of the model which ended with tool calls
+	bill func(usage *model.Usage)
+	// stop ends the timeout of the request and gives it back its context, it is nil until the first call
+	stop func()
+}
+
+// start bounds the request by MCP_TIMEOUT from its first call of the model
+func (a *mcpAdaptor) start(c *gin.Context) context.Context {
+	if a.stop == nil {
+		parent := c.Request.Context()
+		ctx, cancel := context.WithTimeout(parent, time.Duration(config.MCPTimeout)*time.Second)
+		c.Request = c.Request.WithContext(ctx)
+		a.stop = func() {
+			cancel()
+			c.Request = c.Request.WithContext(parent)
+			a.stop = nil
+		}
+	}
+	return c.Request.Context()
+}
+
+func (a *mcpAdaptor) finish() {
+	if a.stop != nil {
+		a.stop()
+	}
+}
+
+func (a *mcpAdaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Reader) (*http.Response, error) {
+	a.start(c)
+	resp, err := a.Adaptor.DoRequest(c, meta, requestBody)
+	if err != nil {
+		a.finish()
+	}
+	return resp, err
+}
+
+func (a *mcpAdaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (*model.Usage, *model.ErrorWithStatusCode) {
+	ctx := a.start(c)
+	defer a.finish()
+	var toolCalls []mcpToolCall
+	for hop := 1; ; hop++ {
+		meta.MCPHop = hop
+		last := a.request.ToolChoice == "none"
+		var message *model.Message
+		var usage *model.Usage
+		var respErr *model.ErrorWithStatusCode
+		if meta.IsStream {
+			message, usage, respErr = a.doStreamResponse(c, resp, meta, last)
+		} else {
+			message, usage, respErr = a.doTextResponse(c, resp, meta, toolCalls, last)
+		}
+		if respErr != nil || message == nil {
+			if hop == 1 {
+				// no tool was run, it is a normal request
+				meta.MCPHop = 0
+			}
+			return usage, respErr
+		}
+		if usage != nil {
+			a.bill(usage)
+		}
+
+		for i := range message.ToolCalls {
+			if message.ToolCalls[i].Id == "" {
+				message.ToolCalls[i].Id = fmt.Sprintf("call_%s", random.GetUUID())
+			}
+		}
+		a.request.Messages = append(a.request.Messages, *message)
+		for _, call := range message.ToolCalls {
+			toolCall := a.callTool(ctx, call)
+			a.filterToolResult(ctx, meta, toolCall)
+			toolCalls = append(toolCalls, *toolCall)
+			a.request.Messages = append(a.request.Messages, model.Message{
+				Role:       "tool",
+				Content:    toolCall.Result,
+				ToolCallId: toolCall.Id,
+			})
+			if meta.IsStream {
+				writeMCPToolCall(c, toolCall)
+			}
+		}
+		if ctx.Err() != nil {
+			return &model.Usage{}, openai.ErrorWrapper(fmt.Errorf("the tools were not answered within %d seconds", config.MCPTimeout), "mcp_timeout", http.StatusGatewayTimeout)
+		}
+		if a.request.ToolChoice != nil {
+			// a forced tool would be called again on every call
+			a.request.ToolChoice = "auto"
+		}
+		if hop+1 >= config.MCPMaxIterations {
+			// the model has to answer with what it has
+			a.request.ToolChoice = "none"
+		}
+
+		requestBody, err := convertRequestBody(c, meta, a.request, a.Adaptor)
+		if err != nil {
+			return &model.Usage{}, openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+		}
+		resp, err = a.Adaptor.DoRequest(c, meta, requestBody)
+		if err != nil {
+			logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+			return &model.Usage{}, openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+		}
+		if isErrorHappened(meta, resp) {
+			return &model.Usage{}, RelayErrorHandler(resp)
+		}
+	}
+}
+
+func (a *mcpAdaptor) callTool(ctx context.Context, call model.Tool) *mcpToolCall {
+	toolCall := &mcpToolCall{
+		Id:        call.Id,
+		Name:      call.Function.Name,
+		Arguments: getArguments(call.Function.Arguments),
+	}
+	var result *mcp.Result
+	if ctx.Err() != nil {
+		result = &mcp.Result{Content: "the time for running tools is over", IsError: true}
+	} else {
+		result = a.toolset.Call(ctx, call.Function.Name, toolCall.Arguments)
+	}
+	toolCall.Server = result.Server
+	toolCall.Result = result.Content
+	toolCall.IsError = result.IsError
+	return toolCall
+}
+
+// filterToolResult applies the request policies to the result of a tool, a blocked result is replaced by an error
+func (a *mcpAdaptor) filterToolResult(ctx context.Context, meta *meta.Meta, toolCall *mcpToolCall) {
+	if bizErr := applyRequestGuardrails(ctx, meta, a.policies, rewriteTexts(&toolCall.Result)); bizErr != nil {
+		toolCall.Result = bizErr.Error.Message
+		toolCall.IsError = true
+	}
+}
+
+// doStreamResponse relays a stream, the returned message is nil when the stream is the answer
+func (a *mcpAdaptor) doStreamResponse(c *gin.Context, resp *http.Response, meta *meta.Meta, last bool) (*model.Message, *model.Usage, *model.ErrorWithStatusCode) {
+	if last {
+		usage, respErr := a.Adaptor.DoResponse(c, resp, meta)
+		return nil, usage, respErr
+	}
+	converter := newMCPStreamConverter(a.toolset)
+	writer := &sseLineWriter{ResponseWriter: c.Writer, convert: converter.convertLine}
+	c.Writer = writer
+	usage, respErr := a.Adaptor.DoResponse(c, resp, meta)
+	c.Writer = writer.ResponseWriter
+	if respErr != nil {
+		return nil, usage, respErr
+	}
+	message, clientCalls := converter.result()
+	if len(message.ToolCalls) == 0 {
+		return nil, usage, nil
+	}
+	if clientCalls {
+		logger.Warnf(c.Request.Context(), "the calls of gateway tools made along with the ones of the client are dropped")
+		return nil, usage, nil
+	}
+	return message, usage, nil
+}
+
+// doTextResponse relays a complete response, the returned message is nil when the response is the answer,
+// which is then sent with the tool calls run before it
+func (a *mcpAdaptor) doTextResponse(c *gin.Context, resp *http.Response, meta *meta.Meta, toolCalls []mcpToolCall, last bool) (*model.Message, *model.Usage, *model.ErrorWithStatusCode) {
+	buffer := bufferResponse(c)
+	usage, respErr := a.Adaptor.DoResponse(c, resp, meta)
+	if respErr != nil {
+		c.Writer = buffer.ResponseWriter
+		return nil, usage, respErr
+	}
+	var response map[string]any
+	if err := json.Unmarshal(buffer.body.Bytes(), &response); err != nil {
+		buffer.release(c, buffer.body.Bytes())
+		return nil, usage, nil
+	}
+	choices, _ := response["choices"].([]any)
+	var message model.Message
+	if len(choices) > 0 {
+		choice, _ := choices[0].(map[string]any)
+		if data, err := json.Marshal(choice["message"]); err == nil {
+			_ = json.Unmarshal(data, &message)
+		}
+	}
+	gatewayCalls, clientCalls := splitToolCalls(a.toolset, message.ToolCalls)
+	if !last && len(gatewayCalls) > 0 && !clientCalls {
+		c.Writer = buffer.ResponseWriter
+		message.ToolCalls = gatewayCalls
+		message.Role = role.Assistant
+		return &message, usage, nil
+	}
+	if len(gatewayCalls) > 0 {
+		// the client can't run them, it only gets its own calls
+		logger.Warnf(c.Request.Context(), "the calls of gateway tools made along with the ones of the client are dropped")
+		choice, _ := choices[0].(map[string]any)
+		choiceMessage, _ := choice["message"].(map[string]any)
+		var kept []any
+		calls, _ := choiceMessage["tool_calls"].([]any)
+		for _, call := range calls {
+			callMap, _ := call.(map[string]any)
+			function, _ := callMap["function"].(map[string]any)
+			if name, _ := function["name"].(string); !a.toolset.Has(name) {
+				kept = append(kept, call)
+			}
+		}
+		choiceMessage["tool_calls"] = kept
+	}
+	if len(toolCalls) > 0 {
+		response["mcp_tool_calls"] = toolCalls
+	}
+	body, err := json.Marshal(response)
+	if err != nil {
+		body = buffer.body.Bytes()
+	}
+	buffer.release(c, body)
+	return nil, usage, nil
+}
+
+// writeMCPToolCall sends a tool call run by the gateway as a chunk without content
+func writeMCPToolCall(c *gin.Context, toolCall *mcpToolCall) {
+	chunk := map[string]any{
+		"choices":       []any{map[string]any{"index": 0, "delta": map[string]any{}, "finish_reason": nil}},
+		"mcp_tool_call": toolCall,
+	}
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return
+	}
+	_, _ = c.Writer.WriteString("data: " + string(data) + "\n\n")
+	c.Writer.Flush()
+}
@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/mcp"
+	"github.com/songquanpeng/one-api/relay/mcp/mcptest"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestMain(m *testing.M) {
+	mcptest.Run()
+	os.Exit(m.Run())
+}
+
+// mcpUpstream answers the calls of the model with the given bodies, in order
+type mcpUpstream struct {
+	openai.Adaptor
+	responses []string
+	requests  []relaymodel.GeneralOpenAIRequest
+}
+
+func (a *mcpUpstream) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Reader) (*http.Response, error) {
+	var request relaymodel.GeneralOpenAIRequest
+	if err := json.NewDecoder(requestBody).Decode(&request); err != nil {
+		return nil, err
+	}
+	a.requests = append(a.requests, request)
+	body := a.responses[0]
+	a.responses = a.responses[1:]
+	header := http.Header{"Content-Type": {"application/json"}}
+	if request.Stream {
+		header.Set("Content-Type", "text/event-stream")
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+func newMCPTest(t *testing.T, stream bool) (*gin.Context, *httptest.ResponseRecorder, *meta.Meta, *relaymodel.GeneralOpenAIRequest, *mcp.Toolset) {
+	servers, err := json.Marshal(map[string]any{"stub": mcptest.Server()})
+	require.NoError(t, err)
+	require.NoError(t, mcp.UpdateServersByJSONString(string(servers)))
+	maxIterations := config.MCPMaxIterations
+	timeout := config.MCPTimeout
+	t.Cleanup(func() {
+		_ = mcp.UpdateServersByJSONString("{}")
+		config.MCPMaxIterations = maxIterations
+		config.MCPTimeout = timeout
+	})
+	config.ApproximateTokenEnabled = true
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	c.Set(ctxkey.MCPServers, "stub")
+	relayMeta := &meta.Meta{
+		Mode:            relaymode.ChatCompletions,
+		ChannelType:     channeltype.OpenAI,
+		APIType:         apitype.OpenAI,
+		ActualModelName: "gpt-4o",
+		IsStream:        stream,
+		StartTime:       time.Now(),
+	}
+	request := &relaymodel.GeneralOpenAIRequest{
+		Model:    "gpt-4o",
+		Stream:   stream,
+		Messages: []relaymodel.Message{{Role: "user", Content: "What is 1 + 2?"}},
+	}
+	toolset := addMCPTools(c, relayMeta, request)
+	require.NotNil(t, toolset)
+	return c, w, relayMeta, request, toolset
+}
+
+func TestMCPAdaptor(t *testing.T) {
+	c, w, relayMeta, request, toolset := newMCPTest(t, false)
+	require.Len(t, request.Tools, 2)
+	assert.Equal(t, "add", request.Tools[0].Function.Name)
+	assert.True(t, relayMeta.RequestRewritten)
+
+	upstream := &mcpUpstream{responses: []string{
+		`{"id": "chatcmpl-1", "object": "chat.completion", "choices": [{"index": 0, "finish_reason": "tool_calls", "message": {"role": "assistant", "content": null,
+			"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "add", "arguments": "{\"a\": 1, \"b\": 2}"}}]}}],
+			"usage": {"prompt_tokens": 50, "completion_tokens": 10, "total_tokens": 60}}`,
+		`{"id": "chatcmpl-2", "object": "chat.completion", "choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "It is 3."}}],
+			"usage": {"prompt_tokens": 80, "completion_tokens": 5, "total_tokens": 85}}`,
+	}}
+	var billed []*relaymodel.Usage
+	adaptor := &mcpAdaptor{Adaptor: upstream, request: request, toolset: toolset, bill: func(usage *relaymodel.Usage) {
+		billed = append(billed, usage)
+	}}
+	adaptor.Init(relayMeta)
+	config.MCPMaxIterations = 2
+
+	resp, err := upstream.DoRequest(c, relayMeta, strings.NewReader(`{"model": "gpt-4o"}`))
+	require.NoError(t, err)
+	usage, respErr := adaptor.DoResponse(c, resp, relayMeta)
+	require.Nil(t, respErr)
+	assert.Equal(t, 85, usage.TotalTokens)
+	require.Len(t, billed, 1)
+	assert.Equal(t, 60, billed[0].TotalTokens)
+	assert.Equal(t, 2, relayMeta.MCPHop)
+
+	// the model got the result of the tool, and can't call the tools anymore
+	require.Len(t, upstream.requests, 2)
+	messages := upstream.requests[1].Messages
+	require.Len(t, messages, 3)
+	assert.Equal(t, "add", messages[1].ToolCalls[0].Function.Name)
+	assert.Equal(t, relaymodel.Message{Role: "tool", Content: "3", ToolCallId: "call_1"}, messages[2])
+	assert.Equal(t, "none", upstream.requests[1].ToolChoice)
+
+	var response struct {
+		Choices []struct {
+			Message relaymodel.Message `json:"message"`
+		} `json:"choices"`
+		MCPToolCalls []mcpToolCall `json:"mcp_tool_calls"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "It is 3.", response.Choices[0].Message.Content)
+	assert.Equal(t, []mcpToolCall{{Id: "call_1", Server: "stub", Name: "add", Arguments: `{"a": 1, "b": 2}`, Result: "3"}}, response.MCPToolCalls)
+}
+
+func TestMCPAdaptorStream(t *testing.T) {
+	c, w, relayMeta, request, toolset := newMCPTest(t, true)
+	relayMeta.IncludeUsage = true
+	chunk := func(data string) string {
+		return "data: " + data + "\n\n"
+	}
+	upstream := &mcpUpstream{responses: []string{
+		chunk(`{"id": "chatcmpl-1", "choices": [{"index": 0, "delta": {"role": "assistant", "content": "Let me add."}}]}`) +
+			chunk(`{"id": "chatcmpl-1", "choices": [{"index": 0, "delta": {"tool_calls": [{"index": 0, "id": "call_1", "type": "function", "function": {"name": "add", "arguments": "{\"a\": 1,"}}]}}]}`) +
+			chunk(`{"id": "chatcmpl-1", "choices": [{"index": 0, "delta": {"tool_calls": [{"index": 0, "function": {"arguments": " \"b\": 2}"}}]}}]}`) +
+			chunk(`{"id": "chatcmpl-1", "choices": [{"index": 0, "delta": {}, "finish_reason": "tool_calls"}]}`) +
+			chunk(`{"id": "chatcmpl-1", "choices": [], "usage": {"prompt_tokens": 50, "completion_tokens": 10, "total_tokens": 60}}`) +
+			chunk(`[DONE]`),
+		chunk(`{"id": "chatcmpl-2", "choices": [{"index": 0, "delta": {"role": "assistant", "content": "It is 3."}}]}`) +
+			chunk(`{"id": "chatcmpl-2", "choices": [{"index": 0, "delta": {}, "finish_reason": "stop"}]}`) +
+			chunk(`{"id": "chatcmpl-2", "choices": [], "usage": {"prompt_tokens": 80, "completion_tokens": 5, "total_tokens": 85}}`) +
+			chunk(`[DONE]`),
+	}}
+	var billed []*relaymodel.Usage
+	adaptor := &mcpAdaptor{Adaptor: upstream, request: request, toolset: toolset, bill: func(usage *relaymodel.Usage) {
+		billed = append(billed, usage)
+	}}
+	adaptor.Init(relayMeta)
+	config.MCPMaxIterations = 5
+	request.ToolChoice = "required"
+
+	streamWriter := normalizeStream(c, relayMeta)
+	resp, err := upstream.DoRequest(c, relayMeta, strings.NewReader(`{"model": "gpt-4o", "stream": true}`))
+	require.NoError(t, err)
+	usage, respErr := adaptor.DoResponse(c, resp, relayMeta)
+	require.Nil(t, respErr)
+	require.True(t, streamWriter.Finish(c, usage, respErr))
+	require.Len(t, billed, 1)
+	assert.Equal(t, 60, billed[0].TotalTokens)
+	assert.Equal(t, 85, usage.TotalTokens)
+	// the tool isn't forced again once it was called
+	assert.Equal(t, "auto", upstream.requests[1].ToolChoice)
+	assert.Equal(t, `{"a": 1, "b": 2}`, upstream.requests[1].Messages[1].ToolCalls[0].Function.Arguments)
+
+	body := w.Body.String()
+	assert.Contains(t, body, `"content":"Let me add."`)
+	assert.Contains(t, body, `"content":"It is 3."`)
+	assert.NotContains(t, body, `"tool_calls"`)
+	assert.Contains(t, body, `"mcp_tool_call":{"arguments":"{\"a\": 1, \"b\": 2}","id":"call_1","name":"add","result":"3","server":"stub"}`)
+	assert.Equal(t, 1, strings.Count(body, `"finish_reason":"stop"`))
+	assert.Equal(t, 1, strings.Count(body, "[DONE]"))
+	// every chunk has the id of the stream
+	assert.NotContains(t, body, "chatcmpl-2")
+}
+
+func TestMCPAdaptorTimeout(t *testing.T) {
+	c, _, relayMeta, request, toolset := newMCPTest(t, false)
+	upstream := &mcpUpstream{responses: []string{
+		`{"id": "chatcmpl-1", "object": "chat.completion", "choices": [{"index": 0, "finish_reason": "tool_calls", "message": {"role": "assistant", "content": null,
+			"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "add", "arguments": "{\"a\": 1, \"b\": 2}"}}]}}],
+			"usage": {"prompt_tokens": 50, "completion_tokens": 10, "total_tokens": 60}}`,
+	}}
+	adaptor := &mcpAdaptor{Adaptor: upstream, request: request, toolset: toolset, bill: func(usage *relaymodel.Usage) {}}
+	adaptor.Init(relayMeta)
+	config.MCPMaxIterations = 5
+	config.MCPTimeout = 0
+
+	resp, err := adaptor.DoRequest(c, relayMeta, strings.NewReader(`{"model": "gpt-4o"}`))
+	require.NoError(t, err)
+	_, respErr := adaptor.DoResponse(c, resp, relayMeta)
+	require.NotNil(t, respErr)
+	assert.Equal(t, "mcp_timeout", respErr.Error.Code)
+	// the model isn't called again once the time is over
+	assert.Len(t, upstream.requests, 1)
+	assert.NoError(t, c.Request.Context().Err())
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/media"
+	"github.com/songquanpeng/one-api/common/storage"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// getUploadedFile reads a file uploaded to the files api of the gateway
+func getUploadedFile(ctx context.Context, userId int, fileId string) (*media.Media, error) {
+	file, err := dbmodel.GetFileByIds(fileId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("file %s not found", fileId)
+	}
+	if file.Bytes > int64(config.MediaMaxSizeMB)<<20 {
+		return nil, fmt.Errorf("file %s is larger than %d MB", fileId, config.MediaMaxSizeMB)
+	}
+	reader, err := storage.GetStorage().Get(ctx, file.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return media.New(data, ""), nil
+}
+
+// documentText is what is sent in place of a file part to the providers which can't read documents
+func documentText(file *model.File, document *media.Media) (string, error) {
+	var text string
+	switch {
+	case document.IsPDF():
+		var err error
+		if text, err = media.ExtractPDFText(document.Data); err != nil {
+			return "", err
+		}
+	case document.IsText():
+		text = string(document.Data)
+	default:
+		return "", fmt.Errorf("files of type %s are not supported by this channel", document.MimeType)
+	}
+	if file.Filename != "" {
+		text = file.Filename + ":\n" + text
+	}
+	return text, nil
+}
+
+// normalizeMedia resolves the image, file and audio parts of the messages before the request is converted. Uploaded
+// files are inlined, documents are replaced by their text for the providers which can't read them, and the media
+// the adaptor is going to inline are fetched, so that invalid ones are reported to the client.
+func normalizeMedia(ctx context.Context, meta *meta.Meta, textRequest *model.GeneralOpenAIRequest) *model.ErrorWithStatusCode {
+	for i := range textRequest.Messages {
+		parts, ok := textRequest.Messages[i].Content.([]any)
+		if !ok {
+			continue
+		}
+		for j, item := range parts {
+			part, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			switch part["type"] {
+			case model.ContentTypeImageURL:
+				imageURL, _ := part["image_url"].(map[string]any)
+				url, _ := imageURL["url"].(string)
+				if url == "" {
+					return openai.ErrorWrapper(fmt.Errorf("image_url.url is required"), "invalid_media", http.StatusBadRequest)
+				}
+				// openai fetches the images itself, the others get them inlined
+				var err error
+				if meta.APIType == apitype.OpenAI {
+					err = media.ValidateURL(url)
+				} else {
+					_, err = media.Fetch(url)
+				}
+				if err != nil {
+					logger.Warnf(ctx, "failed to get the image of a message: %s", err.Error())
+					return openai.ErrorWrapper(err, "invalid_media", http.StatusBadRequest)
+				}
+			case model.ContentTypeInputAudio:
+				if !adaptor.SupportsAudioInput(meta.APIType) {
+					return openai.ErrorWrapper(fmt.Errorf("audio input is not supported by this channel"), "invalid_media", http.StatusBadRequest)
+				}
+			case model.ContentTypeFile:
+				content := model.Message{Content: []any{part}}.ParseContent()
+				if len(content) == 0 {
+					continue
+				}
+				file := content[0].File
+				var document *media.Media
+				var err error
+				if file.FileData == "" && file.FileId != "" {
+					// the upstream doesn't know the files of the gateway
+					document, err = getUploadedFile(ctx, meta.UserId, file.FileId)
+					if err == nil {
+						part["file"] = map[string]any{"filename": file.Filename, "file_data": document.DataURL()}
+						meta.RequestRewritten = true
+					}
+				} else if meta.APIType != apitype.OpenAI {
+					document, err = media.Fetch(file.URL())
+				}
+				if err != nil {
+					logger.Warnf(ctx, "failed to get the file of a message: %s", err.Error())
+					return openai.ErrorWrapper(err, "invalid_media", http.StatusBadRequest)
+				}
+				if document == nil || adaptor.SupportsFileInput(meta.APIType) {
+					continue
+				}
+				text, err := documentText(file, document)
+				if err != nil {
+					return openai.ErrorWrapper(err, "invalid_media", http.StatusBadRequest)
+				}
+				parts[j] = map[string]any{"type": model.ContentTypeText, "text": text}
+				meta.RequestRewritten = true
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+const testPNG = "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAQAAAC1HAwCAAAAC0lEQVR42mNkYAAAAAYAAjCB0C8AAAAASUVORK5CYII="
+
+func TestNormalizeMediaImages(t *testing.T) {
+	cases := []struct {
+		apiType int
+		url     string
+		valid   bool
+	}{
+		{apitype.OpenAI, "https://example.com/cat.png", true},
+		{apitype.OpenAI, testPNG, true},
+		{apitype.OpenAI, "file:///etc/passwd", false},
+		{apitype.OpenAI, "", false},
+		{apitype.Anthropic, testPNG, true},
+		{apitype.Anthropic, "http://127.0.0.1/cat.png", false},
+		{apitype.Anthropic, "data:image/png;base64,%%%", false},
+	}
+	for _, c := range cases {
+		var textRequest model.GeneralOpenAIRequest
+		require.NoError(t, json.Unmarshal([]byte(`{"messages": [{"role": "user", "content": [
+			{"type": "text", "text": "what is this?"},
+			{"type": "image_url", "image_url": {"url": "`+c.url+`"}}
+		]}]}`), &textRequest))
+		bizErr := normalizeMedia(context.Background(), &meta.Meta{APIType: c.apiType}, &textRequest)
+		if c.valid {
+			assert.Nil(t, bizErr, c.url)
+		} else if assert.NotNil(t, bizErr, c.url) {
+			assert.Equal(t, http.StatusBadRequest, bizErr.StatusCode)
+		}
+	}
+}
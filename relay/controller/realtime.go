@@ -0,0 +1,352 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/guardrail"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+var realtimeUpgrader = websocket.Upgrader{
+	// the token is the credential, so cross origin browser clients are allowed
+	CheckOrigin:  func(r *http.Request) bool { return true },
+	Subprotocols: []string{"realtime"},
+}
+
+var realtimeDialer = websocket.Dialer{
+	Proxy:            http.ProxyFromEnvironment,
+	HandshakeTimeout: 30 * time.Second,
+}
+
+type realtimeSession struct {
+	ctx      context.Context
+	meta     *meta.Meta
+	client   *websocket.Conn
+	upstream *websocket.Conn
+
+	modelRatio           float64
+	groupRatio           float64
+	completionRatio      float64
+	audioPromptRatio     float64
+	audioCompletionRatio float64
+	// policies filter the texts sent by the client
+	policies []*guardrail.Policy
+
+	// clientLock serializes the writes to the client, which come from both pumps
+	clientLock sync.Mutex
+	closeOnce  sync.Once
+}
+
+// RelayRealtimeHelper proxies a realtime api websocket session to an OpenAI or Azure channel,
+// usage is billed on every response.done event
+func RelayRealtimeHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		return openai.ErrorWrapper(errors.New("realtime api requires a websocket connection"), "websocket_required", http.StatusBadRequest)
+	}
+	if meta.ChannelType != channeltype.OpenAI && meta.ChannelType != channeltype.Azure {
+		return openai.ErrorWrapper(fmt.Errorf("channel type %d does not support the realtime api", meta.ChannelType), "realtime_not_supported", http.StatusBadRequest)
+	}
+	meta.IsStream = true
+	meta.ActualModelName, _ = getMappedModelName(meta.OriginModelName, meta.ModelMapping)
+	policies, bizErr := getGuardrailPolicies(c, meta)
+	if bizErr != nil {
+		return bizErr
+	}
+
+	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	if err != nil {
+		return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
+	}
+	if userQuota <= 0 {
+		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	}
+
+	fullRequestURL, header, err := openai.GetRealtimeRequest(c, meta)
+	if err != nil {
+		return openai.ErrorWrapper(err, "get_upstream_credential_failed", http.StatusInternalServerError)
+	}
+	upstream, resp, err := realtimeDialer.DialContext(ctx, fullRequestURL, header)
+	if err != nil {
+		statusCode := http.StatusBadGateway
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+		return openai.ErrorWrapper(err, "dial_upstream_failed", statusCode)
+	}
+	client, err := realtimeUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// the upgrader has already replied with an http error
+		logger.Errorf(ctx, "upgrade realtime connection failed: %s", err.Error())
+		_ = upstream.Close()
+		return nil
+	}
+
+	session := &realtimeSession{
+		// the request context is cancelled once the handler returns, billing must not depend on it
+		ctx:                  helper.SetRequestID(context.Background(), helper.GetRequestID(ctx)),
+		meta:                 meta,
+		client:               client,
+		upstream:             upstream,
+		modelRatio:           billingratio.GetModelRatio(meta.ActualModelName, meta.ChannelType),
+		groupRatio:           billingratio.GetGroupRatio(meta.Group),
+		completionRatio:      billingratio.GetCompletionRatio(meta.ActualModelName, meta.ChannelType),
+		audioPromptRatio:     billingratio.GetAudioPromptRatio(meta.ActualModelName),
+		audioCompletionRatio: billingratio.GetAudioCompletionRatio(meta.ActualModelName),
+		policies:             policies,
+	}
+	session.run()
+	return nil
+}
+
+func (s *realtimeSession) run() {
+	logger.Infof(s.ctx, "realtime session started, model %s, channel #%d", s.meta.ActualModelName, s.meta.ChannelId)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.pumpClient()
+	}()
+	s.pumpUpstream()
+	<-done
+	logger.Infof(s.ctx, "realtime session closed, elapsed %dms", helper.CalcElapsedTime(s.meta.StartTime))
+}
+
+// pumpClient forwards client events to the upstream
+func (s *realtimeSession) pumpClient() {
+	for {
+		messageType, data, err := s.client.ReadMessage()
+		if err != nil {
+			s.close(closeCodeOf(err), "")
+			return
+		}
+		if messageType == websocket.TextMessage {
+			if data = s.filterClientEvent(data); data == nil {
+				continue
+			}
+		}
+		if err = s.upstream.WriteMessage(messageType, data); err != nil {
+			s.close(websocket.CloseInternalServerErr, "upstream write failed")
+			return
+		}
+	}
+}
+
+// rewriteRealtimeItem passes the text parts and the function output of a conversation item through rewrite
+func rewriteRealtimeItem(item map[string]any, rewrite func(string) string) {
+	contents, _ := item["content"].([]any)
+	for _, content := range contents {
+		part, _ := content.(map[string]any)
+		if text, ok := part["text"].(string); ok {
+			part["text"] = rewrite(text)
+		}
+	}
+	if output, ok := item["output"].(string); ok {
+		item["output"] = rewrite(output)
+	}
+}
+
+// rewriteRealtimeEvent passes the texts of a client event through rewrite: the instructions of the session and of
+// the responses, and the conversation items
+func rewriteRealtimeEvent(event map[string]any, rewrite func(string) string) {
+	for _, key := range []string{"session", "response"} {
+		holder, ok := event[key].(map[string]any)
+		if !ok {
+			continue
+		}
+		if instructions, ok := holder["instructions"].(string); ok {
+			holder["instructions"] = rewrite(instructions)
+		}
+		inputs, _ := holder["input"].([]any)
+		for _, input := range inputs {
+			if item, ok := input.(map[string]any); ok {
+				rewriteRealtimeItem(item, rewrite)
+			}
+		}
+	}
+	if item, ok := event["item"].(map[string]any); ok {
+		rewriteRealtimeItem(item, rewrite)
+	}
+}
+
+// filterClientEvent applies the request policies to a client event, it returns the event to forward, or nil when
+// a policy blocks it and the client got an error event instead
+func (s *realtimeSession) filterClientEvent(data []byte) []byte {
+	if len(s.policies) == 0 {
+		return data
+	}
+	var event map[string]any
+	if err := json.Unmarshal(data, &event); err != nil {
+		return data
+	}
+	rewritten := false
+	bizErr := applyRequestGuardrails(s.ctx, s.meta, s.policies, func(rewrite func(string) string) {
+		rewriteRealtimeEvent(event, func(text string) string {
+			filtered := rewrite(text)
+			rewritten = rewritten || filtered != text
+			return filtered
+		})
+	})
+	if bizErr != nil {
+		eventId, _ := event["event_id"].(string)
+		s.sendError(bizErr.Error.Type, GuardrailBlockedErrorCode, bizErr.Error.Message, eventId)
+		return nil
+	}
+	if !rewritten {
+		return data
+	}
+	filtered, err := json.Marshal(event)
+	if err != nil {
+		return data
+	}
+	return filtered
+}
+
+// sendError sends an error event to the client, eventId is the one of the client event which caused it
+func (s *realtimeSession) sendError(errorType string, code string, message string, eventId string) {
+	data, _ := json.Marshal(openai.RealtimeEvent{
+		Type:    "error",
+		EventId: "event_" + random.GetUUID(),
+		Error: &openai.RealtimeError{
+			Type:    errorType,
+			Code:    code,
+			Message: message,
+			EventId: eventId,
+		},
+	})
+	_ = s.writeClient(websocket.TextMessage, data)
+}
+
+func (s *realtimeSession) writeClient(messageType int, data []byte) error {
+	s.clientLock.Lock()
+	defer s.clientLock.Unlock()
+	return s.client.WriteMessage(messageType, data)
+}
+
+// pumpUpstream forwards upstream events to the client and bills every finished response
+func (s *realtimeSession) pumpUpstream() {
+	for {
+		messageType, data, err := s.upstream.ReadMessage()
+		if err != nil {
+			s.close(closeCodeOf(err), "")
+			return
+		}
+		if err = s.writeClient(messageType, data); err != nil {
+			s.close(websocket.CloseGoingAway, "")
+			return
+		}
+		if messageType != websocket.TextMessage || !bytes.Contains(data, []byte(`"response.done"`)) {
+			continue
+		}
+		var event openai.RealtimeEvent
+		if err = json.Unmarshal(data, &event); err != nil || event.Type != "response.done" {
+			continue
+		}
+		if event.Response == nil || event.Response.Usage == nil {
+			continue
+		}
+		if !s.bill(event.Response.Usage) {
+			s.quotaExceeded()
+			return
+		}
+	}
+}
+
+// bill consumes the quota of one response, it returns false once the user or token runs out of quota
+func (s *realtimeSession) bill(usage *openai.RealtimeUsage) bool {
+	ctx := s.ctx
+	meta := s.meta
+	ratio := s.modelRatio * s.groupRatio
+	inputTokens := float64(usage.InputTokenDetails.TextTokens) + float64(usage.InputTokenDetails.AudioTokens)*s.audioPromptRatio
+	outputTokens := float64(usage.OutputTokenDetails.TextTokens) + float64(usage.OutputTokenDetails.AudioTokens)*s.audioCompletionRatio
+	quota := int64(math.Ceil((inputTokens + outputTokens*s.completionRatio) * ratio))
+	if ratio != 0 && quota <= 0 && usage.TotalTokens > 0 {
+		quota = 1
+	}
+	if quota > 0 {
+		err := model.PostConsumeTokenQuota(meta.TokenId, quota)
+		if err != nil {
+			logger.Error(ctx, "error consuming token remain quota: "+err.Error())
+		}
+		err = model.CacheUpdateUserQuota(ctx, meta.UserId)
+		if err != nil {
+			logger.Error(ctx, "error update user quota cache: "+err.Error())
+		}
+		logContent := fmt.Sprintf("倍率：%.2f × %.2f × %.2f，音频倍率：%.2f / %.2f", s.modelRatio, s.groupRatio, s.completionRatio, s.audioPromptRatio, s.audioCompletionRatio)
+		model.RecordConsumeLog(ctx, &model.Log{
+			UserId:           meta.UserId,
+			ChannelId:        meta.ChannelId,
+			PromptTokens:     usage.InputTokens,
+			CompletionTokens: usage.OutputTokens,
+			ModelName:        meta.ActualModelName,
+			TokenName:        meta.TokenName,
+			Quota:            int(quota),
+			Content:          logContent,
+			IsStream:         true,
+			ElapsedTime:      helper.CalcElapsedTime(meta.StartTime),
+		})
+		model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
+		model.UpdateChannelUsedQuota(meta.ChannelId, quota)
+	}
+
+	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	if err == nil && userQuota <= 0 {
+		return false
+	}
+	token, err := model.GetTokenById(meta.TokenId)
+	if err == nil && !token.UnlimitedQuota && token.RemainQuota <= 0 {
+		return false
+	}
+	return true
+}
+
+// quotaExceeded tells the client why the session ends before closing it
+func (s *realtimeSession) quotaExceeded() {
+	logger.Infof(s.ctx, "realtime session closed, user #%d is out of quota", s.meta.UserId)
+	s.sendError("one_api_error", "insufficient_user_quota", "user quota is not enough", "")
+	s.close(websocket.ClosePolicyViolation, "insufficient quota")
+}
+
+// close sends close frames both ways, which ends both pumps
+func (s *realtimeSession) close(code int, reason string) {
+	s.closeOnce.Do(func() {
+		message := websocket.FormatCloseMessage(code, reason)
+		deadline := time.Now().Add(time.Second)
+		_ = s.client.WriteControl(websocket.CloseMessage, message, deadline)
+		_ = s.upstream.WriteControl(websocket.CloseMessage, message, deadline)
+		_ = s.client.Close()
+		_ = s.upstream.Close()
+	})
+}
+
+func closeCodeOf(err error) int {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		switch closeErr.Code {
+		// these codes must not be sent in a close frame
+		case websocket.CloseNoStatusReceived, websocket.CloseAbnormalClosure, websocket.CloseTLSHandshake:
+		default:
+			return closeErr.Code
+		}
+	}
+	return websocket.CloseNormalClosure
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/meta"
+)
+
+const (
+	// 100 text tokens in, 50 text tokens out: 100 + 50 × 2 = 200
+	textResponseDone = `{"type": "response.done", "response": {"usage": {"total_tokens": 150, "input_tokens": 100, "output_tokens": 50,
+		"input_token_details": {"text_tokens": 100}, "output_token_details": {"text_tokens": 50}}}}`
+	// 10 audio tokens in, 20 audio tokens out: 10 × 8 + 20 × 2 × 2 = 160
+	audioResponseDone = `{"type": "response.done", "response": {"usage": {"total_tokens": 30, "input_tokens": 10, "output_tokens": 20,
+		"input_token_details": {"audio_tokens": 10}, "output_token_details": {"audio_tokens": 20}}}}`
+)
+
+func setupRealtimeDB(t *testing.T, quota int64) (*model.User, *model.Token) {
+	common.RedisEnabled = false
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Token{}, &model.Channel{}, &model.Log{}))
+	model.DB = db
+	model.LOG_DB = db
+	t.Cleanup(func() { model.DB, model.LOG_DB = nil, nil })
+
+	user := &model.User{Username: "realtime", Password: "password", Quota: quota}
+	require.NoError(t, db.Create(user).Error)
+	token := &model.Token{UserId: user.Id, Key: "realtime-token", Name: "realtime", RemainQuota: quota}
+	require.NoError(t, db.Create(token).Error)
+	return user, token
+}
+
+// startRealtimeSession runs a session between a fake upstream, which sends the events and then waits,
+// and a websocket client, which is returned
+func startRealtimeSession(t *testing.T, user *model.User, token *model.Token, events []string) (*websocket.Conn, chan struct{}) {
+	upgrader := websocket.Upgrader{}
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for _, event := range events {
+			if conn.WriteMessage(websocket.TextMessage, []byte(event)) != nil {
+				return
+			}
+		}
+		for {
+			if _, _, err = conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	gatewayConns := make(chan *websocket.Conn, 1)
+	gatewayServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		gatewayConns <- conn
+	}))
+	t.Cleanup(gatewayServer.Close)
+
+	clientConn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(gatewayServer.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = clientConn.Close() })
+	upstreamConn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(upstreamServer.URL, "http"), nil)
+	require.NoError(t, err)
+
+	session := &realtimeSession{
+		ctx: context.Background(),
+		meta: &meta.Meta{
+			UserId:          user.Id,
+			TokenId:         token.Id,
+			TokenName:       token.Name,
+			ChannelId:       1,
+			ActualModelName: "gpt-4o-realtime-preview",
+			StartTime:       time.Now(),
+		},
+		client:               <-gatewayConns,
+		upstream:             upstreamConn,
+		modelRatio:           1,
+		groupRatio:           1,
+		completionRatio:      2,
+		audioPromptRatio:     8,
+		audioCompletionRatio: 2,
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		session.run()
+	}()
+	return clientConn, done
+}
+
+func waitForSession(t *testing.T, done chan struct{}) {
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("realtime session did not end")
+	}
+}
+
+func TestRealtimeBillsEveryResponse(t *testing.T) {
+	user, token := setupRealtimeDB(t, 100000)
+	clientConn, done := startRealtimeSession(t, user, token, []string{
+		`{"type": "session.created"}`,
+		textResponseDone,
+		audioResponseDone,
+	})
+
+	for _, eventType := range []string{"session.created", "response.done", "response.done"} {
+		_, data, err := clientConn.ReadMessage()
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"type": "`+eventType+`"`)
+	}
+	require.NoError(t, clientConn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")))
+	waitForSession(t, done)
+
+	require.NoError(t, model.DB.First(token, token.Id).Error)
+	assert.EqualValues(t, 100000-360, token.RemainQuota)
+	require.NoError(t, model.DB.First(user, user.Id).Error)
+	assert.EqualValues(t, 100000-360, user.Quota)
+	assert.EqualValues(t, 360, user.UsedQuota)
+	var logs []model.Log
+	require.NoError(t, model.LOG_DB.Order("id").Find(&logs).Error)
+	require.Len(t, logs, 2)
+	assert.Equal(t, 200, logs[0].Quota)
+	assert.Equal(t, 160, logs[1].Quota)
+	assert.Equal(t, 100, logs[0].PromptTokens)
+	assert.Equal(t, 20, logs[1].CompletionTokens)
+}
+
+func TestRealtimeClosesWhenQuotaRunsOut(t *testing.T) {
+	user, token := setupRealtimeDB(t, 150)
+	clientConn, done := startRealtimeSession(t, user, token, []string{textResponseDone, audioResponseDone})
+
+	// the response which exhausts the quota is still delivered and billed
+	_, data, err := clientConn.ReadMessage()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"type": "response.done"`)
+	_, data, err = clientConn.ReadMessage()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"code":"insufficient_user_quota"`)
+	_, _, err = clientConn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "unexpected error %v", err)
+	waitForSession(t, done)
+
+	// the next response is neither forwarded nor billed
+	require.NoError(t, model.DB.First(token, token.Id).Error)
+	assert.EqualValues(t, 150-200, token.RemainQuota)
+	var count int64
+	require.NoError(t, model.LOG_DB.Model(&model.Log{}).Count(&count).Error)
+	assert.EqualValues(t, 1, count)
+}
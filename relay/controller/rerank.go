@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func getRerankRequest(c *gin.Context) (*relaymodel.RerankRequest, error) {
+	rerankRequest := &relaymodel.RerankRequest{}
+	err := common.UnmarshalBodyReusable(c, rerankRequest)
+	if err != nil {
+		return nil, err
+	}
+	if rerankRequest.Query == "" {
+		return nil, errors.New("query is required")
+	}
+	if len(rerankRequest.Documents) == 0 {
+		return nil, errors.New("documents is required")
+	}
+	if err := rerankRequest.ValidateDocuments(); err != nil {
+		return nil, err
+	}
+	if rerankRequest.TopN < 0 {
+		return nil, errors.New("top_n must not be negative")
+	}
+	return rerankRequest, nil
+}
+
+// rewriteRerankRequest passes the query and the text of every document through rewrite
+func rewriteRerankRequest(rerankRequest *relaymodel.RerankRequest, rewrite func(string) string) {
+	rerankRequest.Query = rewrite(rerankRequest.Query)
+	for i, document := range rerankRequest.Documents {
+		switch v := document.(type) {
+		case string:
+			rerankRequest.Documents[i] = rewrite(v)
+		case map[string]any:
+			if text, ok := v["text"].(string); ok {
+				v["text"] = rewrite(text)
+			}
+		}
+	}
+}
+
+// getRerankQuota bills per search unit when the upstream reports them, otherwise per token
+func getRerankQuota(usage *relaymodel.RerankUsage, ratio float64) int64 {
+	if usage.SearchUnits > 0 {
+		return int64(math.Ceil(ratio * 1000 * float64(usage.SearchUnits)))
+	}
+	quota := int64(math.Ceil(float64(usage.TotalTokens) * ratio))
+	if ratio != 0 && quota <= 0 {
+		quota = 1
+	}
+	return quota
+}
+
+func RelayRerankHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	rerankRequest, err := getRerankRequest(c)
+	if err != nil {
+		logger.Errorf(ctx, "getRerankRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "invalid_rerank_request", http.StatusBadRequest)
+	}
+
+	// map model name
+	meta.OriginModelName = rerankRequest.Model
+	rerankRequest.Model, _ = getMappedModelName(rerankRequest.Model, meta.ModelMapping)
+	meta.ActualModelName = rerankRequest.Model
+
+	if _, bizErr := filterRequest(c, meta, func(rewrite func(string) string) {
+		rewriteRerankRequest(rerankRequest, rewrite)
+	}); bizErr != nil {
+		return bizErr
+	}
+
+	rerankAdaptor, ok := relay.GetAdaptor(meta.APIType).(adaptor.RerankAdaptor)
+	if !ok {
+		return openai.ErrorWrapper(fmt.Errorf("channel type %d does not support rerank", meta.ChannelType), "rerank_not_supported", http.StatusBadRequest)
+	}
+	rerankAdaptor.Init(meta)
+
+	modelRatio := billingratio.GetModelRatio(rerankRequest.Model, meta.ChannelType)
+	groupRatio := billingratio.GetGroupRatio(meta.Group)
+	ratio := modelRatio * groupRatio
+	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	if err != nil {
+		return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
+	}
+	if userQuota <= 0 {
+		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	}
+
+	convertedRequest, err := rerankAdaptor.ConvertRerankRequest(meta, rerankRequest)
+	if err != nil {
+		return openai.ErrorWrapper(err, "convert_request_failed", http.StatusBadRequest)
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return openai.ErrorWrapper(err, "json_marshal_failed", http.StatusInternalServerError)
+	}
+	logger.Debugf(ctx, "converted request: \n%s", string(jsonData))
+
+	// do request
+	resp, err := rerankAdaptor.DoRequest(c, meta, bytes.NewBuffer(jsonData))
+	if err != nil {
+		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if isErrorHappened(meta, resp) {
+		return RelayErrorHandler(resp)
+	}
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	_ = resp.Body.Close()
+	rerankResponse, err := rerankAdaptor.ConvertRerankResponse(meta, responseBody)
+	if err != nil {
+		return openai.ErrorWrapper(err, "convert_response_failed", http.StatusInternalServerError)
+	}
+
+	// some upstreams report no usage at all
+	if rerankResponse.Usage.TotalTokens == 0 && rerankResponse.Usage.SearchUnits == 0 {
+		text := rerankRequest.Query + "\n" + strings.Join(rerankRequest.GetDocuments(), "\n")
+		rerankResponse.Usage.PromptTokens = openai.CountTokenText(text, rerankRequest.Model)
+		rerankResponse.Usage.TotalTokens = rerankResponse.Usage.PromptTokens
+	}
+	if rerankResponse.Id == "" {
+		rerankResponse.Id = fmt.Sprintf("rerank-%s", c.GetString(helper.RequestIdKey))
+	}
+	rerankResponse.Model = meta.OriginModelName
+	c.JSON(http.StatusOK, rerankResponse)
+
+	quota := getRerankQuota(&rerankResponse.Usage, ratio)
+	go postConsumeRerankQuota(ctx, meta, &rerankResponse.Usage, quota, modelRatio, groupRatio)
+	return nil
+}
+
+func postConsumeRerankQuota(ctx context.Context, meta *meta.Meta, usage *relaymodel.RerankUsage, quota int64, modelRatio float64, groupRatio float64) {
+	err := model.PostConsumeTokenQuota(meta.TokenId, quota)
+	if err != nil {
+		logger.Error(ctx, "error consuming token remain quota: "+err.Error())
+	}
+	err = model.CacheUpdateUserQuota(ctx, meta.UserId)
+	if err != nil {
+		logger.Error(ctx, "error update user quota cache: "+err.Error())
+	}
+	logContent := fmt.Sprintf("倍率：%.2f × %.2f", modelRatio, groupRatio)
+	if usage.SearchUnits > 0 {
+		logContent += fmt.Sprintf("，搜索单元 %d", usage.SearchUnits)
+	}
+	model.RecordConsumeLog(ctx, &model.Log{
+		UserId:       meta.UserId,
+		ChannelId:    meta.ChannelId,
+		PromptTokens: usage.PromptTokens,
+		ModelName:    meta.ActualModelName,
+		TokenName:    meta.TokenName,
+		Quota:        int(quota),
+		Content:      logContent,
+		ElapsedTime:  helper.CalcElapsedTime(meta.StartTime),
+	})
+	model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
+	model.UpdateChannelUsedQuota(meta.ChannelId, quota)
+}
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func newRerankContext(body string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/rerank", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	return c
+}
+
+func TestGetRerankRequest(t *testing.T) {
+	request, err := getRerankRequest(newRerankContext(`{"model":"rerank-v3.5","query":"q","documents":["a",{"text":"b"}],"top_n":1}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, request.GetDocuments())
+	assert.Equal(t, 1, request.TopN)
+
+	for _, body := range []string{
+		`{"model":"rerank-v3.5","documents":["a"]}`,
+		`{"model":"rerank-v3.5","query":"q","documents":[]}`,
+		`{"model":"rerank-v3.5","query":"q","documents":["a"],"top_n":-1}`,
+		// a dropped document would shift the indexes of every result after it
+		`{"model":"rerank-v3.5","query":"q","documents":["a",1,"b"]}`,
+		`{"model":"rerank-v3.5","query":"q","documents":["a",{"title":"b"}]}`,
+	} {
+		_, err = getRerankRequest(newRerankContext(body))
+		assert.Error(t, err, body)
+	}
+}
+
+func TestGetRerankQuota(t *testing.T) {
+	// search units are billed as 1k tokens each
+	assert.Equal(t, int64(2000), getRerankQuota(&relaymodel.RerankUsage{TotalTokens: 100, SearchUnits: 2}, 1))
+	// a fractional ratio per unit isn't truncated to 0
+	assert.Equal(t, int64(2), getRerankQuota(&relaymodel.RerankUsage{SearchUnits: 3}, 0.0005))
+	assert.Equal(t, int64(150), getRerankQuota(&relaymodel.RerankUsage{TotalTokens: 100}, 1.5))
+	// a tiny request still costs something
+	assert.Equal(t, int64(1), getRerankQuota(&relaymodel.RerankUsage{TotalTokens: 1}, 0.001))
+	assert.Equal(t, int64(0), getRerankQuota(&relaymodel.RerankUsage{TotalTokens: 100}, 0))
+}
@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+type responseChunk struct {
+	// Offset is the time since the response started, in milliseconds
+	Offset int64  `json:"offset"`
+	Data   []byte `json:"data"`
+}
+
+// responseRecorder keeps a copy of everything written to the client, along with when it was written
+type responseRecorder struct {
+	gin.ResponseWriter
+	start  time.Time
+	chunks []responseChunk
+}
+
+func (r *responseRecorder) record(data []byte) {
+	r.chunks = append(r.chunks, responseChunk{
+		Offset: time.Since(r.start).Milliseconds(),
+		Data:   bytes.Clone(data),
+	})
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.record(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.record([]byte(s))
+	return r.ResponseWriter.WriteString(s)
+}
+
+func (r *responseRecorder) Body() []byte {
+	var body bytes.Buffer
+	for _, chunk := range r.chunks {
+		body.Write(chunk.Data)
+	}
+	return body.Bytes()
+}
+
+func recordResponse(c *gin.Context) *responseRecorder {
+	recorder := &responseRecorder{ResponseWriter: c.Writer, start: time.Now()}
+	c.Writer = recorder
+	return recorder
+}
+
+// shouldStoreCompletion follows the store parameter of the request, falling back to the default of the token
+func shouldStoreCompletion(c *gin.Context, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest) bool {
+	if meta.Mode != relaymode.ChatCompletions {
+		return false
+	}
+	if textRequest.Store != nil {
+		return *textRequest.Store
+	}
+	return c.GetBool(ctxkey.StoreCompletions)
+}
+
+// mergeStreamResponse rebuilds a chat completion object from the recorded stream
+func mergeStreamResponse(body []byte) *openai.TextResponse {
+	response := &openai.TextResponse{Object: "chat.completion"}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		data := scanner.Text()
+		if !strings.HasPrefix(data, "data:") {
+			continue
+		}
+		data = strings.TrimSpace(strings.TrimPrefix(data, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+		var chunk openai.ChatCompletionsStreamResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			continue
+		}
+		if chunk.Id != "" {
+			response.Id = chunk.Id
+		}
+		if chunk.Model != "" {
+			response.Model = chunk.Model
+		}
+		if chunk.Created != 0 {
+			response.Created = chunk.Created
+		}
+		if chunk.Usage != nil {
+			response.Usage = *chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			for len(response.Choices) <= choice.Index {
+				response.Choices = append(response.Choices, openai.TextResponseChoice{Index: len(response.Choices)})
+			}
+			mergeStreamDelta(&response.Choices[choice.Index], &choice)
+		}
+	}
+	for i := range response.Choices {
+		if response.Choices[i].Role == "" {
+			response.Choices[i].Role = "assistant"
+		}
+	}
+	return response
+}
+
+func mergeStreamDelta(choice *openai.TextResponseChoice, delta *openai.ChatCompletionsStreamResponseChoice) {
+	if delta.Delta.Role != "" {
+		choice.Role = delta.Delta.Role
+	}
+	if content := delta.Delta.StringContent(); content != "" {
+		previous, _ := choice.Content.(string)
+		choice.Content = previous + content
+	}
+	if reasoning, ok := delta.Delta.ReasoningContent.(string); ok && reasoning != "" {
+		previous, _ := choice.ReasoningContent.(string)
+		choice.ReasoningContent = previous + reasoning
+	}
+	for _, tool := range delta.Delta.ToolCalls {
+		// only the first delta of a tool call carries its id, the following ones extend the arguments
+		if tool.Id != "" || len(choice.ToolCalls) == 0 {
+			if tool.Type == "" {
+				tool.Type = "function"
+			}
+			choice.ToolCalls = append(choice.ToolCalls, tool)
+			continue
+		}
+		last := &choice.ToolCalls[len(choice.ToolCalls)-1]
+		previous, _ := last.Function.Arguments.(string)
+		arguments, _ := tool.Function.Arguments.(string)
+		last.Function.Arguments = previous + arguments
+	}
+	if delta.FinishReason != nil {
+		choice.FinishReason = *delta.FinishReason
+	}
+}
+
+// storeCompletion saves the request and the recorded response of a chat completion made with store=true
+func storeCompletion(ctx context.Context, meta *meta.Meta, requestBody []byte, responseBody []byte, metadata any) {
+	var response *openai.TextResponse
+	if meta.IsStream {
+		response = mergeStreamResponse(responseBody)
+	} else {
+		response = &openai.TextResponse{}
+		if err := json.Unmarshal(responseBody, response); err != nil {
+			logger.Errorf(ctx, "failed to parse the completion to store: %s", err.Error())
+			return
+		}
+	}
+	if response.Id == "" {
+		response.Id = "chatcmpl-" + helper.GetRequestID(ctx)
+	}
+	if response.Created == 0 {
+		response.Created = helper.GetTimestamp()
+	}
+	response.Model = meta.OriginModelName
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		logger.Errorf(ctx, "failed to marshal the completion to store: %s", err.Error())
+		return
+	}
+	var metadataJSON []byte
+	if metadata != nil {
+		metadataJSON, _ = json.Marshal(metadata)
+	}
+	completion := &model.StoredCompletion{
+		Id:         "chatcmpl-" + random.GetUUID(),
+		UpstreamId: response.Id,
+		UserId:     meta.UserId,
+		TokenId:    meta.TokenId,
+		Model:      meta.OriginModelName,
+		Request:    string(requestBody),
+		Response:   string(responseJSON),
+		Metadata:   string(metadataJSON),
+		CreatedAt:  helper.GetTimestamp(),
+	}
+	if err = completion.Insert(); err != nil {
+		logger.Errorf(ctx, "failed to store completion %s: %s", completion.Id, err.Error())
+	}
+}
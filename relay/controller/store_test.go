@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeStreamResponse(t *testing.T) {
+	events := []string{
+		`data: {"id": "chatcmpl-1", "created": 1700000000, "model": "gpt-4o", "choices": [{"index": 0, "delta": {"role": "assistant", "reasoning_content": "Think"}}]}`,
+		`data: {"id": "chatcmpl-1", "choices": [{"index": 0, "delta": {"reasoning_content": "ing."}}]}`,
+		`data: {"id": "chatcmpl-1", "choices": [{"index": 0, "delta": {"content": "Let me "}}, {"index": 1, "delta": {"content": "Other"}}]}`,
+		`data: {"id": "chatcmpl-1", "choices": [{"index": 0, "delta": {"content": "check."}}]}`,
+		`data: {"id": "chatcmpl-1", "choices": [{"index": 0, "delta": {"tool_calls": [{"index": 0, "id": "call_1", "function": {"name": "weather", "arguments": "{\"city\":"}}]}}]}`,
+		`data: {"id": "chatcmpl-1", "choices": [{"index": 0, "delta": {"tool_calls": [{"index": 0, "function": {"arguments": " \"Paris\"}"}}]}}]}`,
+		`data: {"id": "chatcmpl-1", "choices": [{"index": 0, "delta": {"tool_calls": [{"index": 1, "id": "call_2", "type": "function", "function": {"name": "time", "arguments": "{}"}}]}}]}`,
+		`data: {"id": "chatcmpl-1", "choices": [{"index": 0, "delta": {}, "finish_reason": "tool_calls"}, {"index": 1, "delta": {}, "finish_reason": "stop"}]}`,
+		`data: {"id": "chatcmpl-1", "choices": [], "usage": {"prompt_tokens": 10, "completion_tokens": 20, "total_tokens": 30}}`,
+		`data: [DONE]`,
+		`data: {"id": "chatcmpl-ignored", "choices": [{"index": 0, "delta": {"content": "after done"}}]}`,
+	}
+	response := mergeStreamResponse([]byte(strings.Join(events, "\n\n") + "\n\n"))
+	assert.Equal(t, "chatcmpl-1", response.Id)
+	assert.Equal(t, "chat.completion", response.Object)
+	assert.Equal(t, "gpt-4o", response.Model)
+	assert.EqualValues(t, 1700000000, response.Created)
+	assert.Equal(t, 30, response.Usage.TotalTokens)
+	require.Len(t, response.Choices, 2)
+
+	choice := response.Choices[0]
+	assert.Equal(t, "assistant", choice.Role)
+	assert.Equal(t, "Let me check.", choice.Content)
+	assert.Equal(t, "Thinking.", choice.ReasoningContent)
+	assert.Equal(t, "tool_calls", choice.FinishReason)
+	require.Len(t, choice.ToolCalls, 2)
+	assert.Equal(t, "call_1", choice.ToolCalls[0].Id)
+	assert.Equal(t, "function", choice.ToolCalls[0].Type)
+	assert.Equal(t, "weather", choice.ToolCalls[0].Function.Name)
+	assert.Equal(t, `{"city": "Paris"}`, choice.ToolCalls[0].Function.Arguments)
+	assert.Equal(t, "time", choice.ToolCalls[1].Function.Name)
+
+	// the role is filled in for the choices which never got one
+	assert.Equal(t, 1, response.Choices[1].Index)
+	assert.Equal(t, "assistant", response.Choices[1].Role)
+	assert.Equal(t, "Other", response.Choices[1].Content)
+	assert.Equal(t, "stop", response.Choices[1].FinishReason)
+
+	assert.Empty(t, mergeStreamResponse(nil).Choices)
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// normalizeStream puts the stream writer in front of the adaptor for chat streams, so that they have the same shape
+// whichever adaptor writes them. It returns nil for other responses.
+func normalizeStream(c *gin.Context, meta *meta.Meta) *adaptor.StreamWriter {
+	if !meta.IsStream || meta.Mode != relaymode.ChatCompletions {
+		return nil
+	}
+	return adaptor.NewStreamWriter(c, meta)
+}
+
+// sseLineWriter passes every complete line of a server-sent event stream through convert before writing it
+type sseLineWriter struct {
+	gin.ResponseWriter
+	line    bytes.Buffer
+	convert func(line string) string
+}
+
+func (w *sseLineWriter) Write(data []byte) (int, error) {
+	w.line.Write(data)
+	for {
+		i := bytes.IndexByte(w.line.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := w.convert(string(w.line.Next(i + 1)))
+		if _, err := w.ResponseWriter.WriteString(line); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *sseLineWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// parseStreamChunk decodes the json of a data line, false for other lines and [DONE]
+func parseStreamChunk(line string) (map[string]any, bool) {
+	if !strings.HasPrefix(line, "data:") {
+		return nil, false
+	}
+	var chunk map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &chunk); err != nil {
+		return nil, false
+	}
+	return chunk, true
+}
+
+// formatStreamChunk encodes a rewritten chunk as a data line, the original line is kept if it can't be encoded
+func formatStreamChunk(chunk map[string]any, line string) string {
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return line
+	}
+	return "data: " + string(data) + "\n"
+}
@@ -0,0 +1,289 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/jsonschema"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/constant/role"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+const structuredOutputPrompt = "Respond only with a JSON value that conforms to the following JSON Schema, without any explanation or markdown code fences.\nJSON Schema: %s"
+
+const structuredOutputRetryPrompt = "Your previous response does not conform to the JSON Schema: %s. Respond again only with the corrected JSON value."
+
+// structuredOutput is the json_schema requested with response_format
+type structuredOutput struct {
+	schema map[string]any
+	strict bool
+}
+
+func getStructuredOutput(meta *meta.Meta, textRequest *model.GeneralOpenAIRequest) *structuredOutput {
+	if meta.Mode != relaymode.ChatCompletions || textRequest.ResponseFormat == nil {
+		return nil
+	}
+	format := textRequest.ResponseFormat
+	if format.Type != "json_schema" || format.JsonSchema == nil || format.JsonSchema.Schema == nil {
+		return nil
+	}
+	return &structuredOutput{
+		schema: format.JsonSchema.Schema,
+		strict: format.JsonSchema.Strict != nil && *format.JsonSchema.Strict,
+	}
+}
+
+// emulateStructuredOutput puts the schema into the system prompt for providers without json_schema support,
+// falling back to the json mode of the provider if it has one
+func emulateStructuredOutput(textRequest *model.GeneralOpenAIRequest, support int) {
+	if support == adaptor.StructuredOutputNative {
+		return
+	}
+	schema, _ := json.Marshal(textRequest.ResponseFormat.JsonSchema.Schema)
+	prompt := fmt.Sprintf(structuredOutputPrompt, schema)
+	textRequest.Messages = appendSystemPrompt(textRequest.Messages, prompt)
+	if support == adaptor.StructuredOutputJSONMode {
+		textRequest.ResponseFormat = &model.ResponseFormat{Type: "json_object"}
+	} else {
+		textRequest.ResponseFormat = nil
+	}
+}
+
+// extractJSON repairs the usual mistakes of models asked for json: code fences and text around the value
+func extractJSON(content string) string {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "```") {
+		content = strings.TrimPrefix(content, "```json")
+		content = strings.TrimPrefix(content, "```")
+		content = strings.TrimSuffix(strings.TrimSpace(content), "```")
+		content = strings.TrimSpace(content)
+	}
+	start := strings.IndexAny(content, "{[")
+	if start < 0 {
+		return content
+	}
+	closing := "}"
+	if content[start] == '[' {
+		closing = "]"
+	}
+	end := strings.LastIndex(content, closing)
+	if end < start {
+		return content
+	}
+	return content[start : end+1]
+}
+
+func (o *structuredOutput) validate(content string) (string, error) {
+	var value any
+	if err := json.Unmarshal([]byte(content), &value); err != nil {
+		repaired := extractJSON(content)
+		if err = json.Unmarshal([]byte(repaired), &value); err != nil {
+			return content, fmt.Errorf("invalid json: %w", err)
+		}
+		content = repaired
+	}
+	return content, jsonschema.Validate(o.schema, value)
+}
+
+// check validates every choice of a chat completion, repaired contents are written back into the returned body.
+// On failure the first invalid content is returned along with the error.
+func (o *structuredOutput) check(body []byte) ([]byte, string, error) {
+	var response map[string]any
+	if err := json.Unmarshal(body, &response); err != nil {
+		return body, "", nil
+	}
+	choices, _ := response["choices"].([]any)
+	repaired := false
+	for _, choice := range choices {
+		choiceMap, _ := choice.(map[string]any)
+		message, _ := choiceMap["message"].(map[string]any)
+		if message == nil {
+			continue
+		}
+		content, ok := message["content"].(string)
+		if !ok {
+			// answers made of tool calls have no content to check
+			if toolCalls, _ := message["tool_calls"].([]any); len(toolCalls) > 0 {
+				continue
+			}
+		}
+		fixed, err := o.validate(content)
+		if err != nil {
+			return body, content, err
+		}
+		if fixed != content {
+			message["content"] = fixed
+			repaired = true
+		}
+	}
+	if !repaired {
+		return body, "", nil
+	}
+	rewritten, err := json.Marshal(response)
+	if err != nil {
+		return body, "", nil
+	}
+	return rewritten, "", nil
+}
+
+// checkStream validates every choice of a recorded chat completion stream. The stream can't be rewritten,
+// so a content that needs to be repaired doesn't pass.
+func (o *structuredOutput) checkStream(body []byte) ([]byte, string, error) {
+	response := mergeStreamResponse(body)
+	for _, choice := range response.Choices {
+		if len(choice.Message.ToolCalls) > 0 {
+			continue
+		}
+		content := choice.Message.StringContent()
+		fixed, err := o.validate(content)
+		if err != nil {
+			return body, content, err
+		}
+		if fixed != content {
+			return body, content, errors.New("the json value must be the whole response")
+		}
+	}
+	return body, "", nil
+}
+
+// responseBuffer holds back the response so that it can be checked, and replaced by a retry, before being sent
+type responseBuffer struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *responseBuffer) WriteHeader(code int) {
+	b.status = code
+}
+
+func (b *responseBuffer) WriteHeaderNow() {}
+
+func (b *responseBuffer) Write(data []byte) (int, error) {
+	return b.body.Write(data)
+}
+
+func (b *responseBuffer) WriteString(s string) (int, error) {
+	return b.body.WriteString(s)
+}
+
+func (b *responseBuffer) Status() int {
+	return b.status
+}
+
+func (b *responseBuffer) Size() int {
+	return b.body.Len()
+}
+
+func (b *responseBuffer) Written() bool {
+	return b.body.Len() > 0
+}
+
+func (b *responseBuffer) Flush() {}
+
+func bufferResponse(c *gin.Context) *responseBuffer {
+	buffer := &responseBuffer{ResponseWriter: c.Writer, status: http.StatusOK}
+	c.Writer = buffer
+	return buffer
+}
+
+// discard puts back the original writer, dropping what was buffered
+func (b *responseBuffer) discard(c *gin.Context) {
+	c.Writer = b.ResponseWriter
+	c.Writer.Header().Del("Content-Length")
+	c.Writer.Header().Del("Content-Type")
+}
+
+// release puts back the original writer and sends body with the buffered status
+func (b *responseBuffer) release(c *gin.Context, body []byte) {
+	c.Writer = b.ResponseWriter
+	c.Writer.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	c.Writer.WriteHeader(b.status)
+	_, _ = c.Writer.Write(body)
+}
+
+func addUsage(usage *model.Usage, other *model.Usage) *model.Usage {
+	if other == nil {
+		return usage
+	}
+	if usage == nil {
+		return other
+	}
+	usage.PromptTokens += other.PromptTokens
+	usage.CompletionTokens += other.CompletionTokens
+	usage.TotalTokens += other.TotalTokens
+	return usage
+}
+
+// enforceStructuredOutput validates the buffered response against the json_schema, retrying the request with the
+// validation error up to StructuredOutputMaxRetries times. The usage of every attempt is returned, and an error
+// if the output still doesn't match while strict mode is requested.
+func enforceStructuredOutput(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralOpenAIRequest, a adaptor.Adaptor,
+	output *structuredOutput, buffer *responseBuffer, usage *model.Usage) (*model.Usage, *model.ErrorWithStatusCode) {
+	ctx := c.Request.Context()
+	check := output.check
+	if meta.IsStream {
+		check = output.checkStream
+	}
+	status := buffer.status
+	body, content, err := check(bytes.Clone(buffer.body.Bytes()))
+	for retry := 0; err != nil && retry < config.StructuredOutputMaxRetries; retry++ {
+		logger.Warnf(ctx, "output doesn't match the json_schema, retrying: %s", err.Error())
+		textRequest.Messages = append(textRequest.Messages, model.Message{
+			Role:    role.Assistant,
+			Content: content,
+		}, model.Message{
+			Role:    role.User,
+			Content: fmt.Sprintf(structuredOutputRetryPrompt, err.Error()),
+		})
+		requestBody, convertErr := convertRequestBody(c, meta, textRequest, a)
+		if convertErr != nil {
+			break
+		}
+		resp, requestErr := a.DoRequest(c, meta, requestBody)
+		if requestErr != nil {
+			logger.Errorf(ctx, "retry of structured output failed: %s", requestErr.Error())
+			break
+		}
+		if isErrorHappened(meta, resp) {
+			_ = resp.Body.Close()
+			break
+		}
+		buffer.body.Reset()
+		streamWriter := normalizeStream(c, meta)
+		retryUsage, respErr := a.DoResponse(c, resp, meta)
+		if streamWriter != nil {
+			streamWriter.Finish(c, retryUsage, respErr)
+		}
+		if respErr != nil {
+			logger.Errorf(ctx, "retry of structured output failed: %+v", respErr)
+			break
+		}
+		usage = addUsage(usage, retryUsage)
+		status = buffer.status
+		body, content, err = check(bytes.Clone(buffer.body.Bytes()))
+	}
+	if err != nil && output.strict {
+		buffer.discard(c)
+		return usage, openai.ErrorWrapper(fmt.Errorf("output doesn't match the json_schema: %w", err), "structured_output_validation_failed", http.StatusUnprocessableEntity)
+	}
+	if err != nil {
+		logger.Warnf(ctx, "output doesn't match the json_schema: %s", err.Error())
+	}
+	buffer.status = status
+	buffer.release(c, body)
+	return usage, nil
+}
@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckStream(t *testing.T) {
+	output := &structuredOutput{
+		schema: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"answer": map[string]any{"type": "integer"}},
+			"required":   []any{"answer"},
+		},
+		strict: true,
+	}
+	stream := func(parts ...string) []byte {
+		body := ""
+		for _, part := range parts {
+			body += `data: {"choices": [{"index": 0, "delta": {"content": "` + part + `"}}]}` + "\n\n"
+		}
+		return []byte(body + `data: {"choices": [{"index": 0, "delta": {}, "finish_reason": "stop"}]}` + "\n\ndata: [DONE]\n\n")
+	}
+
+	// the content is checked once the chunks are put together
+	body := stream(`{\"ans`, `wer\": 4`, `}`)
+	checked, content, err := output.checkStream(body)
+	require.NoError(t, err)
+	assert.Empty(t, content)
+	assert.Equal(t, body, checked)
+
+	_, content, err = output.checkStream(stream(`{\"answer\": `, `\"four\"}`))
+	assert.Error(t, err)
+	assert.Equal(t, `{"answer": "four"}`, content)
+
+	// what was streamed can't be repaired
+	_, content, err = output.checkStream(stream("```json\\n", `{\"answer\": 4}`, "\\n```"))
+	assert.Error(t, err)
+	assert.Equal(t, "```json\n{\"answer\": 4}\n```", content)
+
+	_, _, err = output.checkStream([]byte(`data: {"choices": [{"index": 0, "delta": {"tool_calls": [{"index": 0, "id": "call_1", "type": "function", "function": {"name": "f", "arguments": "{}"}}]}}]}` + "\n\ndata: [DONE]\n\n"))
+	assert.NoError(t, err)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/relay"
 	"github.com/songquanpeng/one-api/relay/adaptor"
@@ -32,19 +33,54 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 		return openai.ErrorWrapper(err, "invalid_text_request", http.StatusBadRequest)
 	}
 	meta.IsStream = textRequest.Stream
+	meta.IncludeUsage = textRequest.StreamOptions != nil && textRequest.StreamOptions.IncludeUsage
+	c.Set(ctxkey.ExcludeReasoning, textRequest.IsReasoningExcluded())
 
 	// map model name
 	meta.OriginModelName = textRequest.Model
 	textRequest.Model, _ = getMappedModelName(textRequest.Model, meta.ModelMapping)
 	meta.ActualModelName = textRequest.Model
+	if bizErr := normalizeMedia(ctx, meta, textRequest); bizErr != nil {
+		return bizErr
+	}
+	// filter the request with the guardrail policies of the group and the token, after the media was normalized
+	// so the policies check what is sent upstream
+	policies, bizErr := filterRequest(c, meta, func(rewrite func(string) string) {
+		rewriteRequestText(textRequest, rewrite)
+	})
+	if bizErr != nil {
+		return bizErr
+	}
+	// the stored request is the filtered one, before the gateway adds its own prompt and tools
+	storeEnabled := shouldStoreCompletion(c, meta, textRequest)
+	var storedRequest []byte
+	if storeEnabled {
+		filteredRequest := *textRequest
+		filteredRequest.Model = meta.OriginModelName
+		storedRequest, _ = json.Marshal(&filteredRequest)
+	}
 	// set system prompt if not empty
 	systemPromptReset := setSystemPrompt(ctx, textRequest, meta.ForcedSystemPrompt)
+	// add the tools of the mcp servers, they are run by the gateway
+	toolset := addMCPTools(c, meta, textRequest)
+	// enforce response_format json_schema, emulated for providers without native support
+	structured := getStructuredOutput(meta, textRequest)
+	if structured != nil {
+		emulateStructuredOutput(textRequest, adaptor.GetStructuredOutputSupport(meta.APIType, textRequest.Model))
+	}
 	// get model ratio & group ratio
 	modelRatio := billingratio.GetModelRatio(textRequest.Model, meta.ChannelType)
 	groupRatio := billingratio.GetGroupRatio(meta.Group)
 	ratio := modelRatio * groupRatio
+	if meta.BatchId != "" {
+		ratio *= config.BatchRatio
+	}
+	// fit the prompt into the context window of the model
+	promptTokens, bizErr := fitContextWindow(ctx, meta, textRequest, getPromptTokens(textRequest, meta.Mode))
+	if bizErr != nil {
+		return bizErr
+	}
 	// pre-consume quota
-	promptTokens := getPromptTokens(textRequest, meta.Mode)
 	meta.PromptTokens = promptTokens
 	preConsumedQuota, bizErr := preConsumeQuota(ctx, textRequest, promptTokens, ratio, meta)
 	if bizErr != nil {
@@ -52,10 +88,42 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 		return bizErr
 	}
 
+	// serve from the response cache
+	var cacheKey string
+	if isResponseCacheEnabled(c) {
+		cacheKey = getResponseCacheKey(meta, textRequest, policies)
+		if cached := getCachedResponse(ctx, cacheKey); cached != nil {
+			meta.CacheHit = true
+			if storeEnabled {
+				// a hit is a completion of its own for the client, so it is stored too
+				recorder := recordResponse(c)
+				replayCachedResponse(c, meta, cached)
+				go storeCompletion(ctx, meta, storedRequest, recorder.Body(), textRequest.Metadata)
+			} else {
+				replayCachedResponse(c, meta, cached)
+			}
+			go postConsumeQuota(ctx, &cached.Usage, meta, textRequest, ratio*config.ResponseCacheHitRatio, preConsumedQuota, modelRatio, groupRatio, systemPromptReset)
+			return nil
+		}
+		c.Header(ResponseCacheHeader, "MISS")
+	}
+
 	adaptor := relay.GetAdaptor(meta.APIType)
 	if adaptor == nil {
 		return openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
 	}
+	if isToolEmulationEnabled(meta, textRequest) {
+		adaptor = &toolEmulationAdaptor{Adaptor: adaptor}
+	}
+	if hasResponseGuardrails(policies) {
+		adaptor = &guardrailAdaptor{Adaptor: adaptor, policies: policies}
+	}
+	if toolset != nil {
+		adaptor = &mcpAdaptor{Adaptor: adaptor, request: textRequest, toolset: toolset, policies: policies, bill: func(usage *model.Usage) {
+			hopMeta := *meta
+			go postConsumeQuota(ctx, usage, &hopMeta, textRequest, ratio, 0, modelRatio, groupRatio, systemPromptReset)
+		}}
+	}
 	adaptor.Init(meta)
 
 	// get request body
@@ -76,12 +144,48 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 	}
 
 	// do response
+	var recorder *responseRecorder
+	if storeEnabled || cacheKey != "" {
+		recorder = recordResponse(c)
+	}
+	// streams are sent as they come and left unchecked, unless strict mode holds them back to be checked whole
+	var buffer *responseBuffer
+	if structured != nil && (!meta.IsStream || structured.strict) {
+		buffer = bufferResponse(c)
+	}
+	streamWriter := normalizeStream(c, meta)
 	usage, respErr := adaptor.DoResponse(c, resp, meta)
+	if streamWriter != nil && streamWriter.Finish(c, usage, respErr) && respErr != nil && buffer == nil {
+		// the error was sent as the last event of the stream, what was streamed before is billed
+		logger.Errorf(ctx, "stream failed: %+v", respErr)
+		go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, systemPromptReset)
+		return respErr
+	}
 	if respErr != nil {
 		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
+		if buffer != nil {
+			// nothing was sent yet, the error is returned instead of the held back stream
+			buffer.discard(c)
+		}
 		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
 		return respErr
 	}
+	if buffer != nil {
+		usage, respErr = enforceStructuredOutput(c, meta, textRequest, adaptor, structured, buffer, usage)
+		if respErr != nil {
+			// the upstream did answer, every attempt is billed
+			go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, systemPromptReset)
+			return respErr
+		}
+	}
+	if storeEnabled {
+		go storeCompletion(ctx, meta, storedRequest, recorder.Body(), textRequest.Metadata)
+	}
+	if cacheKey != "" {
+		if cached := newCachedResponse(c, meta, recorder, usage); cached != nil {
+			go setCachedResponse(ctx, cacheKey, cached)
+		}
+	}
 	// post-consume quota
 	go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, systemPromptReset)
 	return nil
@@ -92,12 +196,46 @@ func getRequestBody(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralO
 		meta.APIType == apitype.OpenAI &&
 		meta.OriginModelName == meta.ActualModelName &&
 		meta.ChannelType != channeltype.Baichuan &&
-		meta.ForcedSystemPrompt == "" {
+		meta.ForcedSystemPrompt == "" &&
+		textRequest.Reasoning == nil &&
+		len(textRequest.Transforms) == 0 &&
+		len(textRequest.SafetySettings) == 0 &&
+		textRequest.Inputs == nil &&
+		!meta.RequestRewritten &&
+		!hasCacheControl(textRequest) &&
+		!isToolEmulationEnabled(meta, textRequest) {
 		// no need to convert request for openai
 		return c.Request.Body, nil
 	}
+	return convertRequestBody(c, meta, textRequest, adaptor)
+}
 
-	// get request body
+// hasCacheControl tells whether the request marks claude cache breakpoints, the adaptor strips them
+func hasCacheControl(textRequest *model.GeneralOpenAIRequest) bool {
+	for _, tool := range textRequest.Tools {
+		if tool.CacheControl != nil {
+			return true
+		}
+	}
+	for _, message := range textRequest.Messages {
+		for _, toolCall := range message.ToolCalls {
+			if toolCall.CacheControl != nil {
+				return true
+			}
+		}
+		if _, ok := message.Content.(string); ok {
+			continue
+		}
+		for _, part := range message.ParseContent() {
+			if part.CacheControl != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func convertRequestBody(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralOpenAIRequest, adaptor adaptor.Adaptor) (io.Reader, error) {
 	var requestBody io.Reader
 	convertedRequest, err := adaptor.ConvertRequest(c, meta.Mode, textRequest)
 	if err != nil {
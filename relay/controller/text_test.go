@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestGetRequestBody(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		body        string
+		passthrough bool
+		absent      string
+	}{
+		{
+			name:        "plain",
+			body:        `{"model": "gpt-4o", "messages": [{"role": "user", "content": "Hi"}]}`,
+			passthrough: true,
+		},
+		{
+			name: "tool cache control",
+			body: `{"model": "gpt-4o", "messages": [{"role": "user", "content": "Hi"}],
+				"tools": [{"type": "function", "function": {"name": "lookup"}, "cache_control": {"type": "ephemeral"}}]}`,
+			absent: "cache_control",
+		},
+		{
+			name: "content cache control",
+			body: `{"model": "gpt-4o", "messages": [{"role": "user", "content": [
+				{"type": "text", "text": "Hi", "cache_control": {"type": "ephemeral"}}]}]}`,
+			absent: "cache_control",
+		},
+		{
+			name:   "safety settings",
+			body:   `{"model": "gpt-4o", "messages": [{"role": "user", "content": "Hi"}], "safety_settings": [{"category": "HARM_CATEGORY_HARASSMENT", "threshold": "BLOCK_NONE"}]}`,
+			absent: "safety_settings",
+		},
+		{
+			name:   "inputs",
+			body:   `{"model": "gpt-4o", "messages": [{"role": "user", "content": "Hi"}], "inputs": {"language": "en"}}`,
+			absent: "inputs",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(test.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			textRequest, err := getAndValidateTextRequest(c, relaymode.ChatCompletions)
+			require.NoError(t, err)
+			relayMeta := &meta.Meta{
+				Mode:            relaymode.ChatCompletions,
+				APIType:         apitype.OpenAI,
+				ChannelType:     channeltype.OpenAI,
+				OriginModelName: textRequest.Model,
+				ActualModelName: textRequest.Model,
+			}
+			adaptor := &openai.Adaptor{}
+			adaptor.Init(relayMeta)
+
+			requestBody, err := getRequestBody(c, relayMeta, textRequest, adaptor)
+			require.NoError(t, err)
+			body, err := io.ReadAll(requestBody)
+			require.NoError(t, err)
+			if test.passthrough {
+				assert.Equal(t, test.body, string(body))
+				return
+			}
+			assert.NotEqual(t, test.body, string(body))
+			assert.NotContains(t, string(body), test.absent)
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/constant/role"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+const (
+	toolCallStart = "<tool_call>"
+	toolCallEnd   = "</tool_call>"
+)
+
+const toolEmulationPrompt = `You can call the following tools, each one is given with its name, description and the JSON Schema of its arguments:
+<tools>
+%s
+</tools>
+To call a tool, answer with one or more blocks like the following and nothing after them:
+<tool_call>
+{"name": "<tool name>", "arguments": <arguments as a JSON object>}
+</tool_call>
+The results of the calls are given back in <tool_result> blocks.`
+
+// isToolEmulationEnabled tells if the tools of the request are described in the prompt instead of being sent,
+// which is configured per channel, for all of its models or the listed ones
+func isToolEmulationEnabled(meta *meta.Meta, textRequest *model.GeneralOpenAIRequest) bool {
+	if len(textRequest.Tools) == 0 {
+		return false
+	}
+	if meta.Config.ToolEmulation {
+		return true
+	}
+	for _, modelName := range meta.Config.ToolEmulationModels {
+		if modelName == meta.OriginModelName || modelName == meta.ActualModelName {
+			return true
+		}
+	}
+	return false
+}
+
+func getToolEmulationPrompt(tools []model.Tool, toolChoice any) string {
+	var descriptions []string
+	for _, tool := range tools {
+		description, _ := json.Marshal(map[string]any{
+			"name":        tool.Function.Name,
+			"description": tool.Function.Description,
+			"parameters":  tool.Function.Parameters,
+		})
+		descriptions = append(descriptions, string(description))
+	}
+	prompt := fmt.Sprintf(toolEmulationPrompt, strings.Join(descriptions, "\n"))
+	switch choice := toolChoice.(type) {
+	case string:
+		if choice == "required" {
+			prompt += "\nYou must call at least one tool."
+		}
+	case map[string]any:
+		if function, ok := choice["function"].(map[string]any); ok {
+			prompt += fmt.Sprintf("\nYou must call the %v tool.", function["name"])
+		}
+	}
+	return prompt
+}
+
+func formatToolCall(tool model.Tool) string {
+	arguments, _ := tool.Function.Arguments.(string)
+	if !json.Valid([]byte(arguments)) {
+		arguments = "{}"
+	}
+	name, _ := json.Marshal(tool.Function.Name)
+	return fmt.Sprintf("%s\n{\"name\": %s, \"arguments\": %s}\n%s", toolCallStart, name, arguments, toolCallEnd)
+}
+
+// emulateTools returns a copy of the request with the tools described in the system prompt,
+// tool calls and results of the history are turned into plain text
+func emulateTools(request *model.GeneralOpenAIRequest) *model.GeneralOpenAIRequest {
+	emulated := *request
+	emulated.Tools = nil
+	emulated.ToolChoice = nil
+	emulated.Messages = make([]model.Message, 0, len(request.Messages)+1)
+	for _, message := range request.Messages {
+		switch {
+		case message.Role == role.Assistant && len(message.ToolCalls) > 0:
+			parts := []string{}
+			if content := message.StringContent(); content != "" {
+				parts = append(parts, content)
+			}
+			for _, tool := range message.ToolCalls {
+				parts = append(parts, formatToolCall(tool))
+			}
+			emulated.Messages = append(emulated.Messages, model.Message{
+				Role:    role.Assistant,
+				Content: strings.Join(parts, "\n"),
+			})
+		case message.Role == "tool":
+			result := fmt.Sprintf("<tool_result tool_call_id=%q>\n%s\n</tool_result>", message.ToolCallId, message.StringContent())
+			// results of parallel calls are merged into a single message
+			if last := len(emulated.Messages) - 1; last >= 0 && emulated.Messages[last].Role == role.User &&
+				strings.HasPrefix(emulated.Messages[last].StringContent(), "<tool_result") {
+				emulated.Messages[last].Content = emulated.Messages[last].StringContent() + "\n" + result
+				continue
+			}
+			emulated.Messages = append(emulated.Messages, model.Message{
+				Role:    role.User,
+				Content: result,
+			})
+		default:
+			emulated.Messages = append(emulated.Messages, message)
+		}
+	}
+	if choice, _ := request.ToolChoice.(string); choice != "none" {
+		emulated.Messages = appendSystemPrompt(emulated.Messages, getToolEmulationPrompt(request.Tools, request.ToolChoice))
+	}
+	return &emulated
+}
+
+// toolCallParser extracts the tool call blocks from a text which may come in pieces
+type toolCallParser struct {
+	pending string
+	inCall  bool
+	count   int
+}
+
+func parseToolCall(block string) (model.Tool, bool) {
+	var call struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(block)), &call); err != nil || call.Name == "" {
+		return model.Tool{}, false
+	}
+	arguments := string(call.Arguments)
+	var s string
+	if json.Unmarshal(call.Arguments, &s) == nil {
+		// some models give the arguments as a json string
+		arguments = s
+	}
+	if arguments == "" || arguments == "null" {
+		arguments = "{}"
+	}
+	return model.Tool{
+		Id:   fmt.Sprintf("call_%s", random.GetUUID()),
+		Type: "function",
+		Function: model.Function{
+			Name:      call.Name,
+			Arguments: arguments,
+		},
+	}, true
+}
+
+// partialPrefix is the length of the longest suffix of s which could be the beginning of tag
+func partialPrefix(s string, tag string) int {
+	for n := len(tag) - 1; n > 0; n-- {
+		if strings.HasSuffix(s, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// feed returns the text which is known not to belong to a tool call, along with the completed tool calls
+func (p *toolCallParser) feed(text string) (string, []model.Tool) {
+	p.pending += text
+	var out strings.Builder
+	var calls []model.Tool
+	for {
+		if !p.inCall {
+			if i := strings.Index(p.pending, toolCallStart); i >= 0 {
+				out.WriteString(p.pending[:i])
+				p.pending = p.pending[i+len(toolCallStart):]
+				p.inCall = true
+				continue
+			}
+			keep := partialPrefix(p.pending, toolCallStart)
+			out.WriteString(p.pending[:len(p.pending)-keep])
+			p.pending = p.pending[len(p.pending)-keep:]
+			break
+		}
+		i := strings.Index(p.pending, toolCallEnd)
+		if i < 0 {
+			break
+		}
+		block := p.pending[:i]
+		p.pending = p.pending[i+len(toolCallEnd):]
+		p.inCall = false
+		if call, ok := parseToolCall(block); ok {
+			calls = append(calls, call)
+			p.count++
+		} else {
+			out.WriteString(toolCallStart + block + toolCallEnd)
+		}
+	}
+	return out.String(), calls
+}
+
+// flush returns what is left once the text is complete, an unterminated tool call is kept as text
+func (p *toolCallParser) flush() string {
+	rest := p.pending
+	if p.inCall {
+		rest = toolCallStart + rest
+	}
+	p.pending = ""
+	p.inCall = false
+	return rest
+}
+
+// convertToolCallResponse turns the tool call blocks of a chat completion into tool_calls
+func convertToolCallResponse(body []byte) []byte {
+	var response map[string]any
+	if err := json.Unmarshal(body, &response); err != nil {
+		return body
+	}
+	choices, _ := response["choices"].([]any)
+	converted := false
+	for _, choice := range choices {
+		choiceMap, _ := choice.(map[string]any)
+		message, _ := choiceMap["message"].(map[string]any)
+		content, ok := message["content"].(string)
+		if !ok {
+			continue
+		}
+		parser := &toolCallParser{}
+		text, calls := parser.feed(content)
+		text = strings.TrimSpace(text + parser.flush())
+		if len(calls) == 0 {
+			continue
+		}
+		converted = true
+		message["tool_calls"] = calls
+		if text == "" {
+			message["content"] = nil
+		} else {
+			message["content"] = text
+		}
+		choiceMap["finish_reason"] = "tool_calls"
+	}
+	if !converted {
+		return body
+	}
+	rewritten, err := json.Marshal(response)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
+
+// toolCallStreamConverter rewrites the chunks of a chat completion stream, holding back the text of tool calls
+// until they are complete and sending them as tool_calls deltas
+type toolCallStreamConverter struct {
+	parsers map[int]*toolCallParser
+}
+
+func (w *toolCallStreamConverter) convertLine(line string) string {
+	chunk, ok := parseStreamChunk(line)
+	if !ok {
+		return line
+	}
+	choices, _ := chunk["choices"].([]any)
+	for _, choice := range choices {
+		choiceMap, _ := choice.(map[string]any)
+		delta, _ := choiceMap["delta"].(map[string]any)
+		if delta == nil {
+			continue
+		}
+		index, _ := choiceMap["index"].(float64)
+		parser, ok := w.parsers[int(index)]
+		if !ok {
+			parser = &toolCallParser{}
+			w.parsers[int(index)] = parser
+		}
+		content, _ := delta["content"].(string)
+		callIndex := parser.count
+		text, calls := parser.feed(content)
+		finished := choiceMap["finish_reason"] != nil
+		if finished {
+			text += parser.flush()
+			if parser.count > 0 {
+				choiceMap["finish_reason"] = "tool_calls"
+			}
+		}
+		if _, ok := delta["content"]; ok || text != "" {
+			delta["content"] = text
+		}
+		if len(calls) > 0 {
+			toolCalls := make([]map[string]any, 0, len(calls))
+			for i, call := range calls {
+				toolCalls = append(toolCalls, map[string]any{
+					"index":    callIndex + i,
+					"id":       call.Id,
+					"type":     call.Type,
+					"function": call.Function,
+				})
+			}
+			delta["tool_calls"] = toolCalls
+		}
+	}
+	return formatStreamChunk(chunk, line)
+}
+
+// toolEmulationAdaptor wraps the adaptor of a channel without tool support, tools are described in the prompt
+// and the tool call blocks of the answer are parsed into tool_calls
+type toolEmulationAdaptor struct {
+	adaptor.Adaptor
+}
+
+func (a *toolEmulationAdaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.GeneralOpenAIRequest) (any, error) {
+	if request == nil {
+		return a.Adaptor.ConvertRequest(c, relayMode, request)
+	}
+	return a.Adaptor.ConvertRequest(c, relayMode, emulateTools(request))
+}
+
+func (a *toolEmulationAdaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if meta.IsStream {
+		converter := &toolCallStreamConverter{parsers: map[int]*toolCallParser{}}
+		writer := &sseLineWriter{ResponseWriter: c.Writer, convert: converter.convertLine}
+		c.Writer = writer
+		usage, err = a.Adaptor.DoResponse(c, resp, meta)
+		c.Writer = writer.ResponseWriter
+		return usage, err
+	}
+	buffer := bufferResponse(c)
+	usage, err = a.Adaptor.DoResponse(c, resp, meta)
+	if err != nil {
+		c.Writer = buffer.ResponseWriter
+		return usage, err
+	}
+	buffer.release(c, convertToolCallResponse(buffer.body.Bytes()))
+	return usage, nil
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// feedAll feeds the chunks in order and returns all the text given back, the flushed rest included
+func feedAll(parser *toolCallParser, chunks ...string) (string, []model.Tool) {
+	var text string
+	var calls []model.Tool
+	for _, chunk := range chunks {
+		out, completed := parser.feed(chunk)
+		text += out
+		calls = append(calls, completed...)
+	}
+	return text + parser.flush(), calls
+}
+
+func TestToolCallParser(t *testing.T) {
+	// the tags are split across the chunks
+	parser := &toolCallParser{}
+	out, calls := parser.feed("Let me check.<tool")
+	assert.Equal(t, "Let me check.", out)
+	assert.Empty(t, calls)
+	out, calls = parser.feed(`_call>{"name": "weather", "arguments": {"city": "Par`)
+	assert.Empty(t, out)
+	assert.Empty(t, calls)
+	out, calls = parser.feed(`is"}}</tool_`)
+	assert.Empty(t, out)
+	assert.Empty(t, calls)
+	out, calls = parser.feed("call> Done.")
+	assert.Equal(t, " Done.", out)
+	require.Len(t, calls, 1)
+	assert.Equal(t, "weather", calls[0].Function.Name)
+	assert.Equal(t, `{"city": "Paris"}`, calls[0].Function.Arguments)
+	assert.Equal(t, "function", calls[0].Type)
+	assert.NotEmpty(t, calls[0].Id)
+	assert.Empty(t, parser.flush())
+
+	// a text looking like the start of a tag is given back once it is known not to be one
+	parser = &toolCallParser{}
+	out, calls = parser.feed("a <to")
+	assert.Equal(t, "a ", out)
+	assert.Empty(t, calls)
+	out, _ = parser.feed("ol> b <tool_")
+	assert.Equal(t, "<tool> b ", out)
+	assert.Equal(t, "<tool_", parser.flush())
+
+	// an unterminated call is kept as text at the end
+	text, calls := feedAll(&toolCallParser{}, "Sure.", `<tool_call>{"name": "weather", `, `"arguments": {}`)
+	assert.Equal(t, `Sure.<tool_call>{"name": "weather", "arguments": {}`, text)
+	assert.Empty(t, calls)
+
+	// so is a block which is not a call, while the calls around it are taken
+	text, calls = feedAll(&toolCallParser{},
+		`<tool_call>{"name": "a", "arguments": "{\"x\": 1}"}</tool_call>`,
+		`<tool_call>not json</tool_call>`,
+		`<tool_call>{"name": "b"}</tool_call>`,
+	)
+	assert.Equal(t, `<tool_call>not json</tool_call>`, text)
+	require.Len(t, calls, 2)
+	assert.Equal(t, `{"x": 1}`, calls[0].Function.Arguments)
+	assert.Equal(t, "{}", calls[1].Function.Arguments)
+}
@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/network"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+const defaultVideoDuration = 5
+
+func getVideoRequest(c *gin.Context) (*relaymodel.VideoRequest, error) {
+	videoRequest := &relaymodel.VideoRequest{}
+	err := common.UnmarshalBodyReusable(c, videoRequest)
+	if err != nil {
+		return nil, err
+	}
+	if videoRequest.Model == "" {
+		return nil, errors.New("model is required")
+	}
+	if videoRequest.Prompt == "" && videoRequest.Image == "" {
+		return nil, errors.New("prompt or image is required")
+	}
+	if videoRequest.Duration < 0 || videoRequest.Duration > 60 {
+		return nil, errors.New("duration must be between 1 and 60 seconds")
+	}
+	if videoRequest.Duration == 0 {
+		videoRequest.Duration = defaultVideoDuration
+	}
+	if videoRequest.CallbackURL != "" {
+		if err = ValidateCallbackURL(videoRequest.CallbackURL); err != nil {
+			return nil, err
+		}
+	}
+	return videoRequest, nil
+}
+
+// ValidateCallbackURL refuses the urls the gateway should not call, the addresses are checked again when the callback is sent
+func ValidateCallbackURL(callbackURL string) error {
+	u, err := url.Parse(callbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("callback_url must be an http or https url")
+	}
+	if config.TaskCallbackAllowPrivateNetwork {
+		return nil
+	}
+	ips, err := net.LookupIP(u.Hostname())
+	if err != nil {
+		return fmt.Errorf("failed to resolve callback_url: %w", err)
+	}
+	for _, ip := range ips {
+		if network.IsPrivateIP(ip) {
+			return errors.New("callback_url must not point to a private address")
+		}
+	}
+	return nil
+}
+
+// GetTaskResponse converts a task to the object returned to the clients
+func GetTaskResponse(task *model.Task) *relaymodel.Task {
+	response := &relaymodel.Task{
+		Id:         task.Id,
+		Object:     "task",
+		Model:      task.Model,
+		Status:     task.Status,
+		CreatedAt:  task.CreatedAt,
+		FinishedAt: task.FinishedAt,
+	}
+	var outputs []string
+	if task.Outputs != "" {
+		_ = json.Unmarshal([]byte(task.Outputs), &outputs)
+	}
+	for _, output := range outputs {
+		response.Outputs = append(response.Outputs, relaymodel.TaskOutput{URL: output})
+	}
+	if task.FailReason != "" {
+		response.Error = &relaymodel.TaskError{Message: task.FailReason}
+	}
+	return response
+}
+
+func RelayVideoHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	videoRequest, err := getVideoRequest(c)
+	if err != nil {
+		logger.Errorf(ctx, "getVideoRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "invalid_video_request", http.StatusBadRequest)
+	}
+
+	// map model name
+	meta.OriginModelName = videoRequest.Model
+	videoRequest.Model, _ = getMappedModelName(videoRequest.Model, meta.ModelMapping)
+	meta.ActualModelName = videoRequest.Model
+
+	if _, bizErr := filterRequest(c, meta, rewriteTexts(&videoRequest.Prompt, &videoRequest.NegativePrompt)); bizErr != nil {
+		return bizErr
+	}
+
+	taskAdaptor, ok := relay.GetAdaptor(meta.APIType).(adaptor.TaskAdaptor)
+	if !ok {
+		return openai.ErrorWrapper(fmt.Errorf("channel type %d does not support video generations", meta.ChannelType), "task_not_supported", http.StatusBadRequest)
+	}
+	taskAdaptor.Init(meta)
+
+	// the quota of the whole video is reserved now, it is refunded if the task fails
+	modelRatio := billingratio.GetModelRatio(videoRequest.Model, meta.ChannelType)
+	groupRatio := billingratio.GetGroupRatio(meta.Group)
+	quota := int64(math.Ceil(modelRatio * groupRatio * 1000 * float64(videoRequest.Duration)))
+	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	if err != nil {
+		return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
+	}
+	if userQuota < quota {
+		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	}
+	err = model.PreConsumeTokenQuota(meta.TokenId, quota)
+	if err != nil {
+		return openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
+	}
+
+	upstreamId, bizErr := taskAdaptor.SubmitTask(meta, videoRequest)
+	if bizErr != nil {
+		RefundTaskQuota(ctx, meta.TokenId, meta.UserId, quota)
+		return bizErr
+	}
+
+	requestJSON, _ := json.Marshal(videoRequest)
+	task := &model.Task{
+		Id:            "task_" + random.GetUUID(),
+		UserId:        meta.UserId,
+		TokenId:       meta.TokenId,
+		TokenName:     meta.TokenName,
+		ChannelId:     meta.ChannelId,
+		KeyId:         c.GetInt(ctxkey.ChannelKeyId),
+		Model:         meta.OriginModelName,
+		UpstreamModel: meta.ActualModelName,
+		UpstreamId:    upstreamId,
+		Status:        relaymodel.TaskStatusQueued,
+		Quota:         quota,
+		Duration:      videoRequest.Duration,
+		CallbackURL:   videoRequest.CallbackURL,
+		Request:       string(requestJSON),
+		CreatedAt:     helper.GetTimestamp(),
+	}
+	if err = task.Insert(); err != nil {
+		RefundTaskQuota(ctx, meta.TokenId, meta.UserId, quota)
+		return openai.ErrorWrapper(err, "insert_task_failed", http.StatusInternalServerError)
+	}
+	logger.Infof(ctx, "task %s submitted to channel #%d as %s", task.Id, meta.ChannelId, upstreamId)
+	c.JSON(http.StatusOK, GetTaskResponse(task))
+	return nil
+}
+
+// RefundTaskQuota gives back the quota reserved for a task that failed
+func RefundTaskQuota(ctx context.Context, tokenId int, userId int, quota int64) {
+	if quota == 0 {
+		return
+	}
+	err := model.PostConsumeTokenQuota(tokenId, -quota)
+	if err != nil {
+		logger.Error(ctx, "error refunding task quota: "+err.Error())
+	}
+	err = model.CacheUpdateUserQuota(ctx, userId)
+	if err != nil {
+		logger.Error(ctx, "error update user quota cache: "+err.Error())
+	}
+}
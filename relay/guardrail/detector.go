@@ -0,0 +1,68 @@
+package guardrail
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	DetectorEmail      = "email"
+	DetectorPhone      = "phone"
+	DetectorCreditCard = "credit_card"
+	DetectorAPIKey     = "api_key"
+)
+
+type detector struct {
+	re *regexp.Regexp
+	// valid filters out the matches which only look like the data, nil accepts all of them
+	valid func(match string) bool
+}
+
+var detectorOrder = []string{DetectorAPIKey, DetectorEmail, DetectorCreditCard, DetectorPhone}
+
+var detectors = map[string]detector{
+	DetectorEmail: {
+		re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+	},
+	DetectorPhone: {
+		re:    regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{2,4}\)|\b\d{2,4})[\s.-]?\d{3,4}[\s.-]?\d{3,5}\b`),
+		valid: func(match string) bool { n := countDigits(match); return n >= 8 && n <= 15 },
+	},
+	DetectorCreditCard: {
+		re:    regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		valid: luhn,
+	},
+	// the prefixed keys of openai, anthropic, aws, github, slack, google and gitlab
+	DetectorAPIKey: {
+		re: regexp.MustCompile(`\b(?:sk-[A-Za-z0-9_-]{20,}|AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|xox[abprs]-[A-Za-z0-9-]{10,}|AIza[0-9A-Za-z_-]{35}|glpat-[A-Za-z0-9_-]{20,})`),
+	},
+}
+
+func countDigits(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+// luhn checks the digits of a card number against their check digit
+func luhn(number string) bool {
+	number = strings.NewReplacer(" ", "", "-", "").Replace(number)
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,172 @@
+package guardrail
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+type rule struct {
+	name   string
+	re     *regexp.Regexp
+	valid  func(match string) bool
+	action string
+}
+
+// Hit counts the matches of a rule
+type Hit struct {
+	Rule   string
+	Action string
+	Count  int
+}
+
+type match struct {
+	start, end int
+	rule       int
+}
+
+func (p *Policy) matches(text string) []match {
+	var matches []match
+	for i, r := range p.rules {
+		for _, loc := range r.re.FindAllStringIndex(text, -1) {
+			if loc[0] == loc[1] || (r.valid != nil && !r.valid(text[loc[0]:loc[1]])) {
+				continue
+			}
+			matches = append(matches, match{start: loc[0], end: loc[1], rule: i})
+		}
+	}
+	// the longest of overlapping matches wins, then the first rule
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].start != matches[j].start {
+			return matches[i].start < matches[j].start
+		}
+		if matches[i].end != matches[j].end {
+			return matches[i].end > matches[j].end
+		}
+		return matches[i].rule < matches[j].rule
+	})
+	kept := matches[:0]
+	end := 0
+	for _, m := range matches {
+		if m.start < end {
+			continue
+		}
+		kept = append(kept, m)
+		end = m.end
+	}
+	return kept
+}
+
+func redact(name string) string {
+	if name == "keyword" || name == "pattern" {
+		return "[REDACTED]"
+	}
+	return fmt.Sprintf("[REDACTED_%s]", strings.ToUpper(name))
+}
+
+// mask hides all the characters but the last four, all of them for short values
+func mask(value string) string {
+	n := utf8.RuneCountInString(value)
+	keep := 0
+	if n > 8 {
+		keep = 4
+	}
+	var b strings.Builder
+	for i, r := range []rune(value) {
+		if i < n-keep && r != ' ' && r != '-' && r != '@' && r != '.' {
+			b.WriteByte('*')
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Apply rewrites the matches of the policy in text. It returns the rewritten text, the hits of every rule, and
+// whether a match asks for the text to be blocked.
+func (p *Policy) Apply(text string) (string, []Hit, bool) {
+	matches := p.matches(text)
+	if len(matches) == 0 {
+		return text, nil, false
+	}
+	var b strings.Builder
+	var hits []Hit
+	// patterns share the name of their rule, their hits are counted together
+	index := map[string]int{}
+	blocked := false
+	last := 0
+	for _, m := range matches {
+		r := p.rules[m.rule]
+		key := r.name + "/" + r.action
+		i, ok := index[key]
+		if !ok {
+			i = len(hits)
+			index[key] = i
+			hits = append(hits, Hit{Rule: r.name, Action: r.action})
+		}
+		hits[i].Count++
+		b.WriteString(text[last:m.start])
+		switch r.action {
+		case ActionRedact:
+			b.WriteString(redact(r.name))
+		case ActionMask:
+			b.WriteString(mask(text[m.start:m.end]))
+		default:
+			blocked = true
+			b.WriteString(redact(r.name))
+		}
+		last = m.end
+	}
+	b.WriteString(text[last:])
+	return b.String(), hits, blocked
+}
+
+// StreamFilter applies a policy to a text coming in pieces. The last bytes are held back until more text comes,
+// so that a match split over two pieces is still found.
+type StreamFilter struct {
+	policy     *Policy
+	lookbehind int
+	pending    string
+}
+
+func (p *Policy) NewStreamFilter(lookbehind int) *StreamFilter {
+	return &StreamFilter{policy: p, lookbehind: lookbehind}
+}
+
+// Feed returns the filtered text which is safe to send
+func (f *StreamFilter) Feed(text string) (string, []Hit, bool) {
+	f.pending += text
+	return f.process(len(f.pending) - f.lookbehind)
+}
+
+// Flush returns what is left once the text is complete
+func (f *StreamFilter) Flush() (string, []Hit, bool) {
+	return f.process(len(f.pending))
+}
+
+func (f *StreamFilter) process(cut int) (string, []Hit, bool) {
+	if cut <= 0 {
+		return "", nil, false
+	}
+	if cut < len(f.pending) {
+		// a match running over the cut may not be complete yet
+		for _, m := range f.policy.matches(f.pending) {
+			if m.start < cut && m.end > cut {
+				cut = m.start
+				break
+			}
+		}
+		for cut > 0 && !utf8.RuneStart(f.pending[cut]) {
+			cut--
+		}
+	}
+	text := f.pending[:cut]
+	f.pending = f.pending[cut:]
+	return f.policy.Apply(text)
+}
+
+func (f *StreamFilter) Policy() *Policy {
+	return f.policy
+}
@@ -0,0 +1,88 @@
+package guardrail
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPolicy(t *testing.T, policy *Policy) *Policy {
+	require.NoError(t, policy.compile())
+	return policy
+}
+
+func TestApplyDetectors(t *testing.T) {
+	policy := newPolicy(t, &Policy{Detectors: map[string]string{
+		DetectorEmail:      ActionRedact,
+		DetectorPhone:      ActionRedact,
+		DetectorCreditCard: ActionMask,
+		DetectorAPIKey:     ActionRedact,
+	}})
+	text, hits, blocked := policy.Apply("mail jane.doe@example.com or call +1 415-555-0132, card 4111 1111 1111 1111, key sk-abcdefghijklmnopqrstuvwxyz123456")
+	assert.False(t, blocked)
+	assert.Equal(t, "mail [REDACTED_EMAIL] or call [REDACTED_PHONE], card **** **** **** 1111, key [REDACTED_API_KEY]", text)
+	assert.Len(t, hits, 4)
+}
+
+func TestApplyIgnoresInvalidCards(t *testing.T) {
+	policy := newPolicy(t, &Policy{Detectors: map[string]string{DetectorCreditCard: ActionBlock}})
+	text, hits, blocked := policy.Apply("order 1234 5678 9012 3456")
+	assert.False(t, blocked)
+	assert.Empty(t, hits)
+	assert.Equal(t, "order 1234 5678 9012 3456", text)
+}
+
+func TestApplyBlocklist(t *testing.T) {
+	policy := newPolicy(t, &Policy{Keywords: []string{"Project Falcon"}, Patterns: []string{`INV-\d+`}})
+	_, hits, blocked := policy.Apply("what is the status of project falcon and INV-42, INV-43?")
+	assert.True(t, blocked)
+	assert.Equal(t, []Hit{{Rule: "keyword", Action: ActionBlock, Count: 1}, {Rule: "pattern", Action: ActionBlock, Count: 2}}, hits)
+}
+
+func TestInvalidPolicy(t *testing.T) {
+	assert.Error(t, UpdatePoliciesByJSONString(`{"p": {"detectors": {"ssn": "redact"}}}`))
+	assert.Error(t, UpdatePoliciesByJSONString(`{"p": {"detectors": {"email": "drop"}}}`))
+	assert.Error(t, UpdatePoliciesByJSONString(`{"p": {"patterns": ["("]}}`))
+}
+
+func TestGetPolicies(t *testing.T) {
+	t.Cleanup(func() {
+		Policies = map[string]*Policy{}
+		GroupPolicy = map[string]string{}
+	})
+	require.NoError(t, UpdatePoliciesByJSONString(`{"strict": {"keywords": ["falcon"]}, "pii": {"detectors": {"email": "redact"}}}`))
+
+	// the group policy must name existing policies
+	assert.Error(t, UpdateGroupPolicyByJSONString(`{"default": "missing"}`))
+	require.NoError(t, UpdateGroupPolicyByJSONString(`{"default": "strict"}`))
+	// and the policies used by a group can't be removed
+	assert.Error(t, UpdatePoliciesByJSONString(`{"pii": {"detectors": {"email": "redact"}}}`))
+
+	policies, err := GetPolicies("default", "pii")
+	require.NoError(t, err)
+	require.Len(t, policies, 2)
+	assert.Equal(t, "strict", policies[0].Name())
+	assert.Equal(t, "pii", policies[1].Name())
+	policies, err = GetPolicies("vip", "")
+	require.NoError(t, err)
+	assert.Empty(t, policies)
+
+	// a missing policy fails closed
+	_, err = GetPolicies("default", "deleted")
+	assert.Error(t, err)
+}
+
+func TestStreamFilter(t *testing.T) {
+	policy := newPolicy(t, &Policy{Detectors: map[string]string{DetectorEmail: ActionRedact}})
+	filter := policy.NewStreamFilter(16)
+	var out strings.Builder
+	for _, piece := range []string{"write to jane", ".doe@exam", "ple.com for the ", "details, thanks"} {
+		text, _, _ := filter.Feed(piece)
+		out.WriteString(text)
+	}
+	text, _, _ := filter.Flush()
+	out.WriteString(text)
+	assert.Equal(t, "write to [REDACTED_EMAIL] for the details, thanks", out.String())
+}
@@ -0,0 +1,204 @@
+// Package guardrail filters the text of requests and responses against the configured policies: keyword and
+// regex blocklists, and detectors of personal data and secrets. Every match is redacted, masked or blocked.
+package guardrail
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+const (
+	ActionRedact = "redact"
+	ActionMask   = "mask"
+	ActionBlock  = "block"
+)
+
+const (
+	StageRequest  = "request"
+	StageResponse = "response"
+)
+
+type Policy struct {
+	// Keywords are matched case-insensitively
+	Keywords []string `json:"keywords,omitempty"`
+	// Patterns are regular expressions in the syntax of the regexp package
+	Patterns []string `json:"patterns,omitempty"`
+	// BlocklistAction is applied to the matches of keywords and patterns, block by default
+	BlocklistAction string `json:"blocklist_action,omitempty"`
+	// Detectors maps the name of a detector, email, phone, credit_card or api_key, to its action
+	Detectors map[string]string `json:"detectors,omitempty"`
+	// ModerationModel is called through /v1/moderations before the request is sent, a flagged request is blocked
+	ModerationModel string `json:"moderation_model,omitempty"`
+	// Stages are request and response, both when empty
+	Stages []string `json:"stages,omitempty"`
+
+	name  string
+	rules []rule
+}
+
+var policiesLock sync.RWMutex
+var Policies = map[string]*Policy{}
+
+// GroupPolicy is the policy of the tokens of a group, a token may add its own
+var GroupPolicy = map[string]string{}
+
+func isValidAction(action string) bool {
+	return action == ActionRedact || action == ActionMask || action == ActionBlock
+}
+
+func (p *Policy) compile() error {
+	p.rules = nil
+	blocklistAction := p.BlocklistAction
+	if blocklistAction == "" {
+		blocklistAction = ActionBlock
+	}
+	if !isValidAction(blocklistAction) {
+		return fmt.Errorf("invalid blocklist action: %s", blocklistAction)
+	}
+	for name, action := range p.Detectors {
+		if _, ok := detectors[name]; !ok {
+			return fmt.Errorf("unknown detector: %s", name)
+		}
+		if !isValidAction(action) {
+			return fmt.Errorf("invalid action of detector %s: %s", name, action)
+		}
+	}
+	// detectors come first, in a fixed order since a match overlapping another one of the same length is dropped
+	for _, name := range detectorOrder {
+		if action, ok := p.Detectors[name]; ok {
+			p.rules = append(p.rules, rule{name: name, re: detectors[name].re, valid: detectors[name].valid, action: action})
+		}
+	}
+	var keywords []string
+	for _, keyword := range p.Keywords {
+		if keyword != "" {
+			keywords = append(keywords, regexp.QuoteMeta(keyword))
+		}
+	}
+	if len(keywords) > 0 {
+		p.rules = append(p.rules, rule{name: "keyword", re: regexp.MustCompile("(?i)" + strings.Join(keywords, "|")), action: blocklistAction})
+	}
+	for _, pattern := range p.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+		p.rules = append(p.rules, rule{name: "pattern", re: re, action: blocklistAction})
+	}
+	for _, stage := range p.Stages {
+		if stage != StageRequest && stage != StageResponse {
+			return fmt.Errorf("invalid stage: %s", stage)
+		}
+	}
+	return nil
+}
+
+// HasStage tells if the policy filters the given stage
+func (p *Policy) HasStage(stage string) bool {
+	if len(p.Stages) == 0 {
+		return true
+	}
+	for _, s := range p.Stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+func Policies2JSONString() string {
+	policiesLock.RLock()
+	defer policiesLock.RUnlock()
+	jsonBytes, err := json.Marshal(Policies)
+	if err != nil {
+		logger.SysError("error marshalling guardrail policies: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdatePoliciesByJSONString(jsonStr string) error {
+	policies := make(map[string]*Policy)
+	if err := json.Unmarshal([]byte(jsonStr), &policies); err != nil {
+		return err
+	}
+	for name, policy := range policies {
+		if policy == nil {
+			return fmt.Errorf("guardrail policy %s is empty", name)
+		}
+		policy.name = name
+		if err := policy.compile(); err != nil {
+			return fmt.Errorf("guardrail policy %s: %w", name, err)
+		}
+	}
+	policiesLock.Lock()
+	defer policiesLock.Unlock()
+	for group, name := range GroupPolicy {
+		if _, ok := policies[name]; !ok {
+			return fmt.Errorf("guardrail policy %s is used by group %s", name, group)
+		}
+	}
+	Policies = policies
+	return nil
+}
+
+func GroupPolicy2JSONString() string {
+	policiesLock.RLock()
+	defer policiesLock.RUnlock()
+	jsonBytes, err := json.Marshal(GroupPolicy)
+	if err != nil {
+		logger.SysError("error marshalling group guardrail policy: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateGroupPolicyByJSONString(jsonStr string) error {
+	groupPolicy := make(map[string]string)
+	if err := json.Unmarshal([]byte(jsonStr), &groupPolicy); err != nil {
+		return err
+	}
+	policiesLock.Lock()
+	defer policiesLock.Unlock()
+	for group, name := range groupPolicy {
+		if _, ok := Policies[name]; !ok {
+			return fmt.Errorf("guardrail policy %s of group %s not found", name, group)
+		}
+	}
+	GroupPolicy = groupPolicy
+	return nil
+}
+
+func (p *Policy) Name() string {
+	return p.name
+}
+
+func PolicyExists(name string) bool {
+	policiesLock.RLock()
+	defer policiesLock.RUnlock()
+	_, ok := Policies[name]
+	return ok
+}
+
+// GetPolicies returns the policies applying to a token, the one of its group then the one set on the token.
+// The policy of the token comes on top of the one of the group, it can't loosen it. A policy that is not found is
+// an error, the request must not go through unfiltered.
+func GetPolicies(group string, tokenPolicy string) ([]*Policy, error) {
+	policiesLock.RLock()
+	defer policiesLock.RUnlock()
+	var policies []*Policy
+	for _, name := range []string{GroupPolicy[group], tokenPolicy} {
+		if name == "" || (len(policies) > 0 && policies[0].name == name) {
+			continue
+		}
+		policy, ok := Policies[name]
+		if !ok {
+			return nil, fmt.Errorf("guardrail policy %s not found", name)
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
@@ -0,0 +1,294 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// ProtocolVersion is the version of the protocol asked for in the initialize request
+const ProtocolVersion = "2025-03-26"
+
+// message is a JSON-RPC 2.0 request, notification or response
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  any             `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+// isResponse tells if the message answers a request, servers may send requests and notifications too
+func (m *message) isResponse() bool {
+	return m.Method == "" && len(m.Id) > 0
+}
+
+type Tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"inputSchema,omitempty"`
+}
+
+type Content struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	Resource *struct {
+		URI  string `json:"uri"`
+		Text string `json:"text,omitempty"`
+	} `json:"resource,omitempty"`
+}
+
+type CallResult struct {
+	Content           []Content `json:"content"`
+	StructuredContent any       `json:"structuredContent,omitempty"`
+	IsError           bool      `json:"isError,omitempty"`
+}
+
+// Text is the result as given back to the model, the contents which are not text are only described
+func (r *CallResult) Text() string {
+	var parts []string
+	for _, content := range r.Content {
+		switch content.Type {
+		case "text":
+			parts = append(parts, content.Text)
+		case "resource":
+			if content.Resource != nil && content.Resource.Text != "" {
+				parts = append(parts, content.Resource.Text)
+			} else if content.Resource != nil {
+				parts = append(parts, fmt.Sprintf("[resource %s]", content.Resource.URI))
+			}
+		default:
+			parts = append(parts, fmt.Sprintf("[%s %s]", content.Type, content.MimeType))
+		}
+	}
+	if len(parts) == 0 && r.StructuredContent != nil {
+		data, _ := json.Marshal(r.StructuredContent)
+		return string(data)
+	}
+	return strings.Join(parts, "\n")
+}
+
+type transport interface {
+	call(ctx context.Context, method string, params any) (json.RawMessage, error)
+	notify(ctx context.Context, method string, params any) error
+	// alive is false once the transport can't be used anymore, like when the process of the server exited
+	alive() bool
+	close()
+	// handle sets the function called with the method of the notifications sent by the server
+	handle(notified func(method string))
+}
+
+// Client is a connection to a server, initialized and shared by the requests
+type Client struct {
+	server    *Server
+	transport transport
+
+	// the tools are listed once and kept until the server says they changed, or for MCP_TOOLS_CACHE_SECONDS
+	toolsLock sync.Mutex
+	tools     []Tool
+	toolsTime time.Time
+}
+
+var clientsLock sync.Mutex
+var clients = map[string]*Client{}
+
+// starting makes the requests needing a server being started wait for it, without blocking the other servers
+var starting singleflight.Group
+
+func newClient(ctx context.Context, server *Server) (*Client, error) {
+	var t transport
+	var err error
+	switch server.Type {
+	case TypeHTTP:
+		t = newHTTPTransport(server)
+	default:
+		t, err = startStdioTransport(server)
+		if err != nil {
+			return nil, err
+		}
+	}
+	client := &Client{server: server, transport: t}
+	t.handle(client.notified)
+	_, err = t.call(ctx, "initialize", map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "one-api", "version": "1.0.0"},
+	})
+	if err == nil {
+		err = t.notify(ctx, "notifications/initialized", nil)
+	}
+	if err != nil {
+		t.close()
+		return nil, fmt.Errorf("failed to initialize mcp server %s: %w", server.name, err)
+	}
+	return client, nil
+}
+
+// getAliveClient returns the client of the server if it can still be used
+func getAliveClient(name string) *Client {
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+	client, ok := clients[name]
+	if !ok {
+		return nil
+	}
+	if client.transport.alive() {
+		return client
+	}
+	client.transport.close()
+	delete(clients, name)
+	return nil
+}
+
+// GetClient returns the client of a server, the server is started or connected to on first use. The server is
+// started once for the requests asking for it at the same time, and outside the lock of the clients.
+func GetClient(ctx context.Context, server *Server) (*Client, error) {
+	if client := getAliveClient(server.name); client != nil {
+		return client, nil
+	}
+	result, err, _ := starting.Do(server.name, func() (any, error) {
+		if client := getAliveClient(server.name); client != nil {
+			return client, nil
+		}
+		// the requests waiting for the server don't depend on the one which started it
+		startCtx, cancel := context.WithTimeout(context.Background(), server.timeout())
+		defer cancel()
+		client, err := newClient(startCtx, server)
+		if err != nil {
+			return nil, err
+		}
+		serversLock.RLock()
+		defer serversLock.RUnlock()
+		if current, ok := Servers[server.name]; !ok || !reflect.DeepEqual(*current, *server) {
+			client.transport.close()
+			return nil, fmt.Errorf("mcp server %s changed while it was started", server.name)
+		}
+		clientsLock.Lock()
+		clients[server.name] = client
+		clientsLock.Unlock()
+		return client, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*Client), nil
+}
+
+// notified handles the notifications of the server, the tools are listed again once they changed
+func (c *Client) notified(method string) {
+	if method != "notifications/tools/list_changed" {
+		return
+	}
+	c.toolsLock.Lock()
+	c.tools = nil
+	c.toolsLock.Unlock()
+}
+
+func closeStaleClients(servers map[string]*Server) {
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+	for name, client := range clients {
+		server, ok := servers[name]
+		if ok && reflect.DeepEqual(*server, *client.server) {
+			client.server = server
+			continue
+		}
+		logger.SysLog("mcp server changed, closing its client: " + name)
+		client.transport.close()
+		delete(clients, name)
+	}
+}
+
+// ListTools returns the tools of the server which are given to the models
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	c.toolsLock.Lock()
+	defer c.toolsLock.Unlock()
+	if c.tools != nil && time.Since(c.toolsTime) < time.Duration(config.MCPToolsCacheSeconds)*time.Second {
+		return c.tools, nil
+	}
+	tools, err := c.listTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.tools = tools
+	c.toolsTime = time.Now()
+	return tools, nil
+}
+
+func (c *Client) listTools(ctx context.Context) ([]Tool, error) {
+	tools := []Tool{}
+	cursor := ""
+	for {
+		var params any
+		if cursor != "" {
+			params = map[string]any{"cursor": cursor}
+		}
+		result, err := c.transport.call(ctx, "tools/list", params)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		if err = json.Unmarshal(result, &page); err != nil {
+			return nil, err
+		}
+		for _, tool := range page.Tools {
+			if c.server.allowsTool(tool.Name) {
+				tools = append(tools, tool)
+			}
+		}
+		if page.NextCursor == "" || page.NextCursor == cursor {
+			return tools, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// CallTool runs a tool with the arguments given by the model as a json object
+func (c *Client) CallTool(ctx context.Context, name string, arguments string) (*CallResult, error) {
+	if !c.server.allowsTool(name) {
+		return nil, fmt.Errorf("tool %s is not allowed", name)
+	}
+	params := map[string]any{"name": name}
+	if strings.TrimSpace(arguments) != "" {
+		var args map[string]any
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %w", err)
+		}
+		params["arguments"] = args
+	}
+	result, err := c.transport.call(ctx, "tools/call", params)
+	if err != nil {
+		return nil, err
+	}
+	var callResult CallResult
+	if err = json.Unmarshal(result, &callResult); err != nil {
+		return nil, err
+	}
+	return &callResult, nil
+}
+
+var errClosed = errors.New("mcp connection is closed")
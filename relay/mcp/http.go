@@ -0,0 +1,179 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/songquanpeng/one-api/common/client"
+)
+
+const sessionIdHeader = "Mcp-Session-Id"
+
+// httpTransport talks to a server over the streamable HTTP transport, every message is posted to the endpoint
+// which answers with json or with a stream of events
+type httpTransport struct {
+	server  *Server
+	nextId  atomic.Int64
+	lock    sync.Mutex
+	session string
+	expired atomic.Bool
+	// notified is set before the first call
+	notified func(method string)
+}
+
+func newHTTPTransport(server *Server) *httpTransport {
+	return &httpTransport{server: server}
+}
+
+func (t *httpTransport) newRequest(ctx context.Context, method string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.server.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range t.server.Headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	t.lock.Lock()
+	if t.session != "" {
+		req.Header.Set(sessionIdHeader, t.session)
+	}
+	t.lock.Unlock()
+	return req, nil
+}
+
+func (t *httpTransport) post(ctx context.Context, msg *message) (*http.Response, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := t.newRequest(ctx, http.MethodPost, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if session := resp.Header.Get(sessionIdHeader); session != "" {
+		t.lock.Lock()
+		t.session = session
+		t.lock.Unlock()
+	}
+	if resp.StatusCode == http.StatusNotFound && req.Header.Get(sessionIdHeader) != "" {
+		// the session is gone, the client is made again with a new one
+		_ = resp.Body.Close()
+		t.expired.Store(true)
+		return nil, fmt.Errorf("mcp session of server %s expired", t.server.name)
+	}
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("mcp server %s returned status %d: %s", t.server.name, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+func (t *httpTransport) call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	id := strconv.FormatInt(t.nextId.Add(1), 10)
+	resp, err := t.post(ctx, &message{JSONRPC: "2.0", Id: json.RawMessage(id), Method: method, Params: params})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var response *message
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		response, err = readEventStream(resp.Body, id, t.notified)
+	} else {
+		response = &message{}
+		err = json.NewDecoder(resp.Body).Decode(response)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		return nil, response.Error
+	}
+	return response.Result, nil
+}
+
+// readEventStream reads the events until the response to the request, the notifications sent before it are passed
+// to notified
+func readEventStream(body io.Reader, id string, notified func(method string)) (*message, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data:") {
+			data.WriteString(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+		var msg message
+		err := json.Unmarshal([]byte(data.String()), &msg)
+		data.Reset()
+		if err == nil && msg.isResponse() && string(msg.Id) == id {
+			return &msg, nil
+		}
+		if err == nil && msg.Method != "" && len(msg.Id) == 0 && notified != nil {
+			notified(msg.Method)
+		}
+	}
+	if data.Len() > 0 {
+		var msg message
+		if err := json.Unmarshal([]byte(data.String()), &msg); err == nil && msg.isResponse() && string(msg.Id) == id {
+			return &msg, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("mcp stream ended without a response")
+}
+
+func (t *httpTransport) notify(ctx context.Context, method string, params any) error {
+	resp, err := t.post(ctx, &message{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (t *httpTransport) handle(notified func(method string)) {
+	t.notified = notified
+}
+
+func (t *httpTransport) alive() bool {
+	return !t.expired.Load()
+}
+
+// close ends the session, the servers without sessions have nothing to close
+func (t *httpTransport) close() {
+	t.lock.Lock()
+	session := t.session
+	t.lock.Unlock()
+	if session == "" {
+		return
+	}
+	req, err := t.newRequest(context.Background(), http.MethodDelete, nil)
+	if err != nil {
+		return
+	}
+	resp, err := client.HTTPClient.Do(req)
+	if err == nil {
+		_ = resp.Body.Close()
+	}
+}
@@ -0,0 +1,150 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/mcp/mcptest"
+)
+
+func TestMain(m *testing.M) {
+	mcptest.Run()
+	os.Exit(m.Run())
+}
+
+func setServers(t *testing.T, servers map[string]any) {
+	data, err := json.Marshal(servers)
+	require.NoError(t, err)
+	require.NoError(t, UpdateServersByJSONString(string(data)))
+}
+
+func TestUpdateServers(t *testing.T) {
+	assert.Error(t, UpdateServersByJSONString(`{"a": {}}`))
+	assert.Error(t, UpdateServersByJSONString(`{"a": {"type": "sse", "url": "http://localhost"}}`))
+	require.NoError(t, UpdateServersByJSONString(`{"a": {"url": "http://localhost/mcp"}, "b": {"command": "b"}}`))
+	assert.Equal(t, TypeHTTP, Servers["a"].Type)
+	assert.Equal(t, TypeStdio, Servers["b"].Type)
+
+	require.NoError(t, UpdateGroupServersByJSONString(`{"default": ["a", "missing"]}`))
+	servers := GetServers("default", []string{"b", "a", ""})
+	require.Len(t, servers, 2)
+	assert.Equal(t, "a", servers[0].Name())
+	assert.Equal(t, "b", servers[1].Name())
+	assert.Empty(t, GetServers("vip", nil))
+}
+
+func TestGetStdioEnv(t *testing.T) {
+	t.Setenv("PATH", "/usr/bin")
+	t.Setenv("SQL_DSN", "root:secret@tcp(localhost:3306)/oneapi")
+	env := getStdioEnv(&Server{Env: map[string]string{"API_KEY": "key"}})
+	assert.Contains(t, env, "PATH=/usr/bin")
+	assert.Contains(t, env, "API_KEY=key")
+	for _, variable := range env {
+		assert.NotContains(t, variable, "SQL_DSN")
+	}
+}
+
+func TestToolset(t *testing.T) {
+	stub := mcptest.Server()
+	limited := mcptest.Server()
+	limited["tools"] = []string{"fail"}
+	setServers(t, map[string]any{"stub": stub, "limited": limited})
+	t.Cleanup(func() {
+		setServers(t, map[string]any{})
+	})
+
+	ctx := context.Background()
+	toolset := GetToolset(ctx, GetServers("", []string{"limited", "stub"}))
+	var names []string
+	for _, tool := range toolset.Tools {
+		names = append(names, tool.Function.Name)
+	}
+	// the listing has two pages, and the first server keeps fail
+	assert.Equal(t, []string{"fail", "add"}, names)
+	assert.Equal(t, "Adds two numbers", toolset.Tools[1].Function.Description)
+
+	result := toolset.Call(ctx, "add", `{"a": 1, "b": 2.5}`)
+	assert.Equal(t, &Result{Server: "stub", Content: "3.5"}, result)
+	result = toolset.Call(ctx, "fail", `{}`)
+	assert.Equal(t, &Result{Server: "limited", Content: "failed on purpose", IsError: true}, result)
+	result = toolset.Call(ctx, "add", `{"a": `)
+	assert.True(t, result.IsError)
+	assert.Contains(t, result.Content, "invalid arguments")
+	assert.True(t, toolset.Call(ctx, "missing", `{}`).IsError)
+
+	// the process is kept between requests, and started again once it exited
+	client, err := GetClient(ctx, Servers["stub"])
+	require.NoError(t, err)
+	again, err := GetClient(ctx, Servers["stub"])
+	require.NoError(t, err)
+	assert.Same(t, client, again)
+	client.transport.close()
+	<-client.transport.(*stdioTransport).done
+	again, err = GetClient(ctx, Servers["stub"])
+	require.NoError(t, err)
+	assert.NotSame(t, client, again)
+	tools, err := again.ListTools(ctx)
+	require.NoError(t, err)
+	assert.Len(t, tools, 2)
+}
+
+func TestClientCache(t *testing.T) {
+	setServers(t, map[string]any{"stub": mcptest.Server()})
+	t.Cleanup(func() {
+		setServers(t, map[string]any{})
+	})
+	ctx := context.Background()
+
+	// the requests asking for the server at the same time share one process
+	var wg sync.WaitGroup
+	started := make([]*Client, 5)
+	for i := range started {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client, err := GetClient(ctx, Servers["stub"])
+			assert.NoError(t, err)
+			started[i] = client
+		}(i)
+	}
+	wg.Wait()
+	client := started[0]
+	require.NotNil(t, client)
+	for _, other := range started[1:] {
+		assert.Same(t, client, other)
+	}
+
+	// the tools are listed once, the list is kept even when the server went away
+	tools, err := client.ListTools(ctx)
+	require.NoError(t, err)
+	require.Len(t, tools, 2)
+	client.transport.close()
+	<-client.transport.(*stdioTransport).done
+	tools, err = client.ListTools(ctx)
+	require.NoError(t, err)
+	assert.Len(t, tools, 2)
+
+	// until the server says they changed
+	client.notified("notifications/tools/list_changed")
+	_, err = client.ListTools(ctx)
+	assert.Error(t, err)
+}
+
+func TestCallResultText(t *testing.T) {
+	var result CallResult
+	require.NoError(t, json.Unmarshal([]byte(`{"content": [
+		{"type": "text", "text": "first"},
+		{"type": "image", "data": "iVBORw0KGgo=", "mimeType": "image/png"},
+		{"type": "resource", "resource": {"uri": "file:///a.txt", "text": "second"}}
+	]}`), &result))
+	assert.Equal(t, "first\n[image image/png]\nsecond", result.Text())
+
+	require.NoError(t, json.Unmarshal([]byte(`{"content": [], "structuredContent": {"a": 1}}`), &result))
+	assert.Equal(t, `{"a":1}`, result.Text())
+}
@@ -0,0 +1,105 @@
+// Package mcptest is a small stdio mcp server for the tests, served by the test binary itself:
+// TestMain calls Run, which only serves when the binary was started as the server.
+package mcptest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+const envStub = "ONE_API_MCP_STUB"
+
+// Run serves the stub and exits when the test binary was started by Server, else it returns at once
+func Run() {
+	if os.Getenv(envStub) != "1" {
+		return
+	}
+	serve(os.Stdin, os.Stdout)
+	os.Exit(0)
+}
+
+// Server is the config of an mcp server running the stub, as given in the MCPServers option
+func Server() map[string]any {
+	return map[string]any{
+		"command": os.Args[0],
+		"args":    []string{"-test.run=^$"},
+		"env":     map[string]string{envStub: "1"},
+	}
+}
+
+type request struct {
+	Id     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params struct {
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+		Cursor    string         `json:"cursor"`
+	} `json:"params"`
+}
+
+var tools = []map[string]any{
+	{
+		"name":        "add",
+		"description": "Adds two numbers",
+		"inputSchema": map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"a": map[string]any{"type": "number"}, "b": map[string]any{"type": "number"}},
+			"required":   []string{"a", "b"},
+		},
+	},
+	{
+		"name":        "fail",
+		"description": "Always fails",
+		"inputSchema": map[string]any{"type": "object"},
+	},
+}
+
+// serve answers the requests on in, the tools are listed in two pages to exercise the cursor
+func serve(in io.Reader, out io.Writer) {
+	scanner := bufio.NewScanner(in)
+	encoder := json.NewEncoder(out)
+	for scanner.Scan() {
+		var req request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil || len(req.Id) == 0 {
+			continue
+		}
+		response := map[string]any{"jsonrpc": "2.0", "id": req.Id}
+		switch req.Method {
+		case "initialize":
+			response["result"] = map[string]any{
+				"protocolVersion": "2025-03-26",
+				"capabilities":    map[string]any{"tools": map[string]any{}},
+				"serverInfo":      map[string]any{"name": "stub", "version": "1.0.0"},
+			}
+		case "tools/list":
+			if req.Params.Cursor == "" {
+				response["result"] = map[string]any{"tools": tools[:1], "nextCursor": "2"}
+			} else {
+				response["result"] = map[string]any{"tools": tools[1:]}
+			}
+		case "tools/call":
+			response["result"] = call(req.Params.Name, req.Params.Arguments)
+		default:
+			response["error"] = map[string]any{"code": -32601, "message": "method not found"}
+		}
+		_ = encoder.Encode(response)
+	}
+}
+
+func call(name string, arguments map[string]any) map[string]any {
+	text := func(s string) []any {
+		return []any{map[string]any{"type": "text", "text": s}}
+	}
+	switch name {
+	case "add":
+		a, _ := arguments["a"].(float64)
+		b, _ := arguments["b"].(float64)
+		return map[string]any{"content": text(fmt.Sprint(a + b))}
+	case "fail":
+		return map[string]any{"content": text("failed on purpose"), "isError": true}
+	}
+	return map[string]any{"content": text("unknown tool: " + name), "isError": true}
+}
@@ -0,0 +1,164 @@
+// Package mcp runs the tools of Model Context Protocol servers on behalf of the models. The servers are registered
+// by the admin, either as a command talking over stdio or as a streamable HTTP endpoint, and given to the tokens of
+// a group or to single tokens.
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+const (
+	TypeStdio = "stdio"
+	TypeHTTP  = "http"
+)
+
+type Server struct {
+	// Type is stdio or http, guessed from the command or the url when empty
+	Type string `json:"type,omitempty"`
+	// Command is started with Args and Env for the stdio servers, it is kept running between requests
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	// URL is the endpoint of the streamable HTTP servers, Headers are sent with every request, like Authorization
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Tools limits the tools of the server given to the models, all of them when empty
+	Tools []string `json:"tools,omitempty"`
+	// Timeout of a tool call in seconds, MCP_TOOL_TIMEOUT when 0
+	Timeout int `json:"timeout,omitempty"`
+
+	name string
+}
+
+var serversLock sync.RWMutex
+var Servers = map[string]*Server{}
+
+// GroupServers are the servers of the tokens of a group, a token may add its own
+var GroupServers = map[string][]string{}
+
+func (s *Server) Name() string {
+	return s.name
+}
+
+func (s *Server) check() error {
+	if s.Type == "" {
+		s.Type = TypeStdio
+		if s.URL != "" {
+			s.Type = TypeHTTP
+		}
+	}
+	switch s.Type {
+	case TypeStdio:
+		if s.Command == "" {
+			return fmt.Errorf("command is empty")
+		}
+	case TypeHTTP:
+		if s.URL == "" {
+			return fmt.Errorf("url is empty")
+		}
+	default:
+		return fmt.Errorf("invalid type: %s", s.Type)
+	}
+	if s.Timeout < 0 {
+		return fmt.Errorf("invalid timeout: %d", s.Timeout)
+	}
+	return nil
+}
+
+// allowsTool tells if the tool of the server is given to the models
+func (s *Server) allowsTool(name string) bool {
+	if len(s.Tools) == 0 {
+		return true
+	}
+	for _, tool := range s.Tools {
+		if tool == name {
+			return true
+		}
+	}
+	return false
+}
+
+func Servers2JSONString() string {
+	serversLock.RLock()
+	defer serversLock.RUnlock()
+	jsonBytes, err := json.Marshal(Servers)
+	if err != nil {
+		logger.SysError("error marshalling mcp servers: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateServersByJSONString(jsonStr string) error {
+	servers := make(map[string]*Server)
+	if err := json.Unmarshal([]byte(jsonStr), &servers); err != nil {
+		return err
+	}
+	for name, server := range servers {
+		if server == nil {
+			return fmt.Errorf("mcp server %s is empty", name)
+		}
+		server.name = name
+		if err := server.check(); err != nil {
+			return fmt.Errorf("mcp server %s: %w", name, err)
+		}
+	}
+	serversLock.Lock()
+	defer serversLock.Unlock()
+	Servers = servers
+	// the clients of removed or changed servers are stopped, they are started again on their next use
+	closeStaleClients(servers)
+	return nil
+}
+
+func GroupServers2JSONString() string {
+	serversLock.RLock()
+	defer serversLock.RUnlock()
+	jsonBytes, err := json.Marshal(GroupServers)
+	if err != nil {
+		logger.SysError("error marshalling group mcp servers: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateGroupServersByJSONString(jsonStr string) error {
+	groupServers := make(map[string][]string)
+	if err := json.Unmarshal([]byte(jsonStr), &groupServers); err != nil {
+		return err
+	}
+	serversLock.Lock()
+	defer serversLock.Unlock()
+	GroupServers = groupServers
+	return nil
+}
+
+func ServerExists(name string) bool {
+	serversLock.RLock()
+	defer serversLock.RUnlock()
+	_, ok := Servers[name]
+	return ok
+}
+
+// GetServers returns the servers of a token, the ones of its group then the ones set on the token
+func GetServers(group string, tokenServers []string) []*Server {
+	serversLock.RLock()
+	defer serversLock.RUnlock()
+	var servers []*Server
+	seen := map[string]bool{}
+	for _, name := range append(append([]string{}, GroupServers[group]...), tokenServers...) {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		server, ok := Servers[name]
+		if !ok {
+			logger.SysError("mcp server not found: " + name)
+			continue
+		}
+		servers = append(servers, server)
+	}
+	return servers
+}
@@ -0,0 +1,201 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// inheritedEnv are the variables of the gateway passed to the stdio servers, the others are set by Env
+var inheritedEnv = []string{"PATH", "HOME", "USER", "LANG", "TMPDIR", "TZ"}
+
+// stdioTransport talks to a server started as a child process, the messages are lines of json on its stdin and stdout
+type stdioTransport struct {
+	name      string
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	writeLock sync.Mutex
+
+	lock     sync.Mutex
+	nextId   int64
+	pending  map[string]chan *message
+	done     chan struct{}
+	err      error
+	notified func(method string)
+}
+
+// getStdioEnv is the environment of a server, it doesn't get the one of the gateway which holds its secrets
+func getStdioEnv(server *Server) []string {
+	var env []string
+	for _, key := range inheritedEnv {
+		if value, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+value)
+		}
+	}
+	for key, value := range server.Env {
+		env = append(env, key+"="+value)
+	}
+	return env
+}
+
+func startStdioTransport(server *Server) (*stdioTransport, error) {
+	cmd := exec.Command(server.Command, server.Args...)
+	cmd.Env = getStdioEnv(server)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start mcp server %s: %w", server.name, err)
+	}
+	t := &stdioTransport{
+		name:    server.name,
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: map[string]chan *message{},
+		done:    make(chan struct{}),
+	}
+	go t.read(stdout)
+	return t, nil
+}
+
+func (t *stdioTransport) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			logger.SysError(fmt.Sprintf("invalid message from mcp server %s: %s", t.name, err.Error()))
+			continue
+		}
+		if msg.isResponse() {
+			t.lock.Lock()
+			ch, ok := t.pending[string(msg.Id)]
+			delete(t.pending, string(msg.Id))
+			t.lock.Unlock()
+			if ok {
+				ch <- &msg
+			}
+			continue
+		}
+		if msg.Method != "" && len(msg.Id) > 0 {
+			t.answer(&msg)
+			continue
+		}
+		t.lock.Lock()
+		notified := t.notified
+		t.lock.Unlock()
+		if msg.Method != "" && notified != nil {
+			notified(msg.Method)
+		}
+	}
+	err := scanner.Err()
+	if err == nil {
+		err = errClosed
+	}
+	t.lock.Lock()
+	t.err = err
+	close(t.done)
+	t.lock.Unlock()
+	_ = t.cmd.Wait()
+}
+
+// answer replies to the requests of the server, only ping is supported
+func (t *stdioTransport) answer(request *message) {
+	response := message{JSONRPC: "2.0", Id: request.Id}
+	if request.Method == "ping" {
+		response.Result = json.RawMessage("{}")
+	} else {
+		response.Error = &RPCError{Code: -32601, Message: "method not found: " + request.Method}
+	}
+	if err := t.write(&response); err != nil {
+		logger.SysError(fmt.Sprintf("failed to answer mcp server %s: %s", t.name, err.Error()))
+	}
+}
+
+func (t *stdioTransport) write(msg *message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+	_, err = t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (t *stdioTransport) call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	t.lock.Lock()
+	select {
+	case <-t.done:
+		t.lock.Unlock()
+		return nil, t.err
+	default:
+	}
+	t.nextId++
+	id := t.nextId
+	key := strconv.FormatInt(id, 10)
+	ch := make(chan *message, 1)
+	t.pending[key] = ch
+	t.lock.Unlock()
+	defer func() {
+		t.lock.Lock()
+		delete(t.pending, key)
+		t.lock.Unlock()
+	}()
+
+	if err := t.write(&message{JSONRPC: "2.0", Id: json.RawMessage(key), Method: method, Params: params}); err != nil {
+		return nil, err
+	}
+	select {
+	case response := <-ch:
+		if response.Error != nil {
+			return nil, response.Error
+		}
+		return response.Result, nil
+	case <-t.done:
+		return nil, t.err
+	case <-ctx.Done():
+		// the server is told to stop working on it
+		_ = t.notify(context.Background(), "notifications/cancelled", map[string]any{"requestId": id, "reason": ctx.Err().Error()})
+		return nil, ctx.Err()
+	}
+}
+
+func (t *stdioTransport) notify(ctx context.Context, method string, params any) error {
+	return t.write(&message{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (t *stdioTransport) handle(notified func(method string)) {
+	t.lock.Lock()
+	t.notified = notified
+	t.lock.Unlock()
+}
+
+func (t *stdioTransport) alive() bool {
+	select {
+	case <-t.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (t *stdioTransport) close() {
+	_ = t.stdin.Close()
+	if t.cmd.Process != nil {
+		_ = t.cmd.Process.Kill()
+	}
+}
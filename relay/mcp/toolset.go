@@ -0,0 +1,130 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// Toolset is the tools of the servers of a request, by the name given to the model
+type Toolset struct {
+	Tools   []model.Tool
+	clients map[string]*Client
+}
+
+// Result is the outcome of a tool call, the errors are given back to the model as the result
+type Result struct {
+	Server  string `json:"server"`
+	Content string `json:"content"`
+	IsError bool   `json:"is_error,omitempty"`
+}
+
+// GetToolset lists the tools of the servers, a server which can't be reached is left out.
+// When two servers have a tool of the same name the first one keeps it.
+func GetToolset(ctx context.Context, servers []*Server) *Toolset {
+	toolset := &Toolset{clients: map[string]*Client{}}
+	for _, server := range servers {
+		listCtx, cancel := context.WithTimeout(ctx, server.timeout())
+		tools, err := listTools(listCtx, server)
+		cancel()
+		if err != nil {
+			logger.Errorf(ctx, "failed to list the tools of mcp server %s: %s", server.name, err.Error())
+			continue
+		}
+		for _, tool := range tools {
+			if client, ok := toolset.clients[tool.Name]; ok {
+				logger.Warnf(ctx, "tool %s of mcp server %s is hidden by the one of %s", tool.Name, server.name, client.server.name)
+				continue
+			}
+			toolset.clients[tool.Name] = tool.client
+			parameters := tool.InputSchema
+			if parameters == nil {
+				parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			toolset.Tools = append(toolset.Tools, model.Tool{
+				Type: "function",
+				Function: model.Function{
+					Name:        tool.Name,
+					Description: tool.Description,
+					Parameters:  parameters,
+				},
+			})
+		}
+	}
+	return toolset
+}
+
+type clientTool struct {
+	Tool
+	client *Client
+}
+
+func listTools(ctx context.Context, server *Server) ([]clientTool, error) {
+	client, err := GetClient(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	clientTools := make([]clientTool, 0, len(tools))
+	for _, tool := range tools {
+		clientTools = append(clientTools, clientTool{Tool: tool, client: client})
+	}
+	return clientTools, nil
+}
+
+func (s *Server) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return time.Duration(s.Timeout) * time.Second
+	}
+	return time.Duration(config.MCPToolTimeout) * time.Second
+}
+
+// Has tells if the tool is run by the gateway, the other tools are the ones of the client
+func (t *Toolset) Has(name string) bool {
+	_, ok := t.clients[name]
+	return ok
+}
+
+// Remove drops the tools the request already has, the tools of the client take precedence
+func (t *Toolset) Remove(tools []model.Tool) {
+	for _, tool := range tools {
+		if !t.Has(tool.Function.Name) {
+			continue
+		}
+		delete(t.clients, tool.Function.Name)
+		for i := range t.Tools {
+			if t.Tools[i].Function.Name == tool.Function.Name {
+				t.Tools = append(t.Tools[:i], t.Tools[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Call runs a tool with the arguments given by the model
+func (t *Toolset) Call(ctx context.Context, name string, arguments string) *Result {
+	client, ok := t.clients[name]
+	if !ok {
+		return &Result{Content: fmt.Sprintf("unknown tool: %s", name), IsError: true}
+	}
+	result := &Result{Server: client.server.name}
+	ctx, cancel := context.WithTimeout(ctx, client.server.timeout())
+	defer cancel()
+	callResult, err := client.CallTool(ctx, name, arguments)
+	if err != nil {
+		logger.Warnf(ctx, "mcp tool %s of server %s failed: %s", name, client.server.name, err.Error())
+		result.Content = err.Error()
+		result.IsError = true
+		return result
+	}
+	result.Content = callResult.Text()
+	result.IsError = callResult.IsError
+	return result
+}
@@ -27,6 +27,8 @@ type Meta struct {
 	APIType  int
 	Config   model.ChannelConfig
 	IsStream bool
+	// IncludeUsage is set when the client asked for the usage chunk at the end of the stream
+	IncludeUsage bool
 	// OriginModelName is the model name from the raw user request
 	OriginModelName string
 	// ActualModelName is the model name after mapping
@@ -35,6 +37,17 @@ type Meta struct {
 	PromptTokens       int // only for DoResponse
 	ForcedSystemPrompt string
 	StartTime          time.Time
+	// BatchId is set when the request is executed as part of a local batch
+	BatchId string
+	// CacheHit is set when the response is served from the response cache
+	CacheHit bool
+	// RequestRewritten is set when the messages or max_tokens were changed by the gateway, to fit the context window
+	// or by a guardrail, so the request can't be passed through as is
+	RequestRewritten bool
+	// Preset is the name@version of the preset merged into the request
+	Preset string
+	// MCPHop is the number of the call of the model when it runs gateway tools, 0 without them
+	MCPHop int
 }
 
 func GetByContext(c *gin.Context) *Meta {
@@ -53,6 +66,8 @@ func GetByContext(c *gin.Context) *Meta {
 		RequestURLPath:     c.Request.URL.String(),
 		ForcedSystemPrompt: c.GetString(ctxkey.SystemPrompt),
 		StartTime:          time.Now(),
+		BatchId:            c.GetString(ctxkey.BatchId),
+		Preset:             c.GetString(ctxkey.Preset),
 	}
 	cfg, ok := c.Get(ctxkey.Config)
 	if ok {
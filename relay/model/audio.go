@@ -0,0 +1,48 @@
+package model
+
+// SpeechRequest is the request of /v1/audio/speech
+type SpeechRequest struct {
+	Model          string  `json:"model" binding:"required"`
+	Input          string  `json:"input" binding:"required"`
+	Voice          string  `json:"voice" binding:"required"`
+	Instructions   string  `json:"instructions,omitempty"`
+	Speed          float64 `json:"speed,omitempty"`
+	ResponseFormat string  `json:"response_format,omitempty"`
+}
+
+// SpeechResult is the audio synthesized by an upstream
+type SpeechResult struct {
+	Audio       []byte
+	ContentType string
+}
+
+// TranscriptionRequest is the multipart form of /v1/audio/transcriptions and /v1/audio/translations, with the file read
+type TranscriptionRequest struct {
+	Model          string
+	Audio          []byte
+	Filename       string
+	Language       string
+	Prompt         string
+	ResponseFormat string
+	Temperature    float64
+	// Translate is set for the translations, the text is translated to english
+	Translate bool
+}
+
+type TranscriptionSegment struct {
+	// Start and End are in seconds
+	Start float64
+	End   float64
+	Text  string
+}
+
+// TranscriptionResult is the text recognized by an upstream
+type TranscriptionResult struct {
+	Text     string
+	Language string
+	// Duration is the length of the audio in seconds, the upstreams billing by the second report it
+	Duration float64
+	Segments []TranscriptionSegment
+	// Usage is reported by the upstreams billing by tokens
+	Usage *Usage
+}
@@ -17,6 +17,23 @@ type Audio struct {
 	Format string `json:"format,omitempty"`
 }
 
+// Reasoning is the OpenRouter style reasoning config, either Effort or MaxTokens is set
+//
+// https://openrouter.ai/docs/use-cases/reasoning-tokens
+type Reasoning struct {
+	Effort    *string `json:"effort,omitempty"`
+	MaxTokens *int    `json:"max_tokens,omitempty"`
+	Exclude   bool    `json:"exclude,omitempty"`
+}
+
+// SafetySetting is a safety threshold of gemini for a harm category
+//
+// https://ai.google.dev/gemini-api/docs/safety-settings
+type SafetySetting struct {
+	Category  string `json:"category"`
+	Threshold string `json:"threshold"`
+}
+
 type StreamOptions struct {
 	IncludeUsage bool `json:"include_usage,omitempty"`
 }
@@ -27,6 +44,7 @@ type GeneralOpenAIRequest struct {
 	Model               string          `json:"model,omitempty"`
 	Store               *bool           `json:"store,omitempty"`
 	ReasoningEffort     *string         `json:"reasoning_effort,omitempty"`
+	Reasoning           *Reasoning      `json:"reasoning,omitempty"`
 	Metadata            any             `json:"metadata,omitempty"`
 	FrequencyPenalty    *float64        `json:"frequency_penalty,omitempty"`
 	LogitBias           any             `json:"logit_bias,omitempty"`
@@ -54,6 +72,7 @@ type GeneralOpenAIRequest struct {
 	User                string          `json:"user,omitempty"`
 	FunctionCall        any             `json:"function_call,omitempty"`
 	Functions           any             `json:"functions,omitempty"`
+	WebSearchOptions    any             `json:"web_search_options,omitempty"`
 	// https://platform.openai.com/docs/api-reference/embeddings/create
 	Input          any    `json:"input,omitempty"`
 	EncodingFormat string `json:"encoding_format,omitempty"`
@@ -66,6 +85,14 @@ type GeneralOpenAIRequest struct {
 	// Others
 	Instruction string `json:"instruction,omitempty"`
 	NumCtx      int    `json:"num_ctx,omitempty"`
+	// Transforms are the OpenRouter prompt transforms, only "middle-out" is supported
+	//
+	// https://openrouter.ai/docs/features/message-transforms
+	Transforms []string `json:"transforms,omitempty"`
+	// SafetySettings override the gemini safety settings of the channel for the listed categories
+	SafetySettings []SafetySetting `json:"safety_settings,omitempty"`
+	// Inputs are the variables of the agent apps, like the inputs of dify
+	Inputs map[string]any `json:"inputs,omitempty"`
 }
 
 func (r GeneralOpenAIRequest) ParseInput() []string {
@@ -86,3 +113,69 @@ func (r GeneralOpenAIRequest) ParseInput() []string {
 	}
 	return input
 }
+
+// reasoningEffortRatios are the shares of the max tokens spent on reasoning, same as OpenRouter
+var reasoningEffortRatios = map[string]float64{
+	"minimal": 0.1,
+	"low":     0.2,
+	"medium":  0.5,
+	"high":    0.8,
+}
+
+// GetReasoningEffort returns the requested effort, reasoning.effort takes precedence over reasoning_effort
+func (r GeneralOpenAIRequest) GetReasoningEffort() string {
+	if r.Reasoning != nil && r.Reasoning.Effort != nil {
+		return *r.Reasoning.Effort
+	}
+	if r.ReasoningEffort != nil {
+		return *r.ReasoningEffort
+	}
+	return ""
+}
+
+// GetReasoningBudget converts the request into a thinking budget for providers that take one,
+// ok is false when the request does not ask for reasoning
+func (r GeneralOpenAIRequest) GetReasoningBudget(maxTokens int) (budget int, ok bool) {
+	if r.Reasoning != nil && r.Reasoning.MaxTokens != nil {
+		return *r.Reasoning.MaxTokens, true
+	}
+	ratio, ok := reasoningEffortRatios[r.GetReasoningEffort()]
+	if !ok {
+		return 0, false
+	}
+	return int(float64(maxTokens) * ratio), true
+}
+
+// GetReasoningEffortByBudget maps reasoning.max_tokens to the closest effort for providers that only take
+// reasoning_effort, by its share of the max tokens, or by its size when the request sets no max tokens
+func (r GeneralOpenAIRequest) GetReasoningEffortByBudget() string {
+	if r.Reasoning == nil || r.Reasoning.MaxTokens == nil || *r.Reasoning.MaxTokens <= 0 {
+		return ""
+	}
+	budget := *r.Reasoning.MaxTokens
+	maxTokens := r.MaxTokens
+	if r.MaxCompletionTokens != nil {
+		maxTokens = *r.MaxCompletionTokens
+	}
+	if maxTokens <= 0 {
+		switch {
+		case budget < 2048:
+			return "low"
+		case budget < 8192:
+			return "medium"
+		}
+		return "high"
+	}
+	ratio := float64(budget) / float64(maxTokens)
+	switch {
+	case ratio < (reasoningEffortRatios["low"]+reasoningEffortRatios["medium"])/2:
+		return "low"
+	case ratio < (reasoningEffortRatios["medium"]+reasoningEffortRatios["high"])/2:
+		return "medium"
+	}
+	return "high"
+}
+
+func (r GeneralOpenAIRequest) IsReasoningExcluded() bool {
+	return r.Reasoning != nil && r.Reasoning.Exclude
+}
@@ -1,12 +1,17 @@
 package model
 
+import "mime/multipart"
+
 type ImageRequest struct {
-	Model          string `json:"model"`
-	Prompt         string `json:"prompt" binding:"required"`
-	N              int    `json:"n,omitempty"`
-	Size           string `json:"size,omitempty"`
-	Quality        string `json:"quality,omitempty"`
-	ResponseFormat string `json:"response_format,omitempty"`
-	Style          string `json:"style,omitempty"`
-	User           string `json:"user,omitempty"`
+	Model          string `json:"model" form:"model"`
+	Prompt         string `json:"prompt" form:"prompt"`
+	N              int    `json:"n,omitempty" form:"n"`
+	Size           string `json:"size,omitempty" form:"size"`
+	Quality        string `json:"quality,omitempty" form:"quality"`
+	ResponseFormat string `json:"response_format,omitempty" form:"response_format"`
+	Style          string `json:"style,omitempty" form:"style"`
+	User           string `json:"user,omitempty" form:"user"`
+	// Image & Mask are only used by edits and variations, which are multipart requests
+	Image *multipart.FileHeader `json:"-" form:"image"`
+	Mask  *multipart.FileHeader `json:"-" form:"mask"`
 }
@@ -1,5 +1,7 @@
 package model
 
+import "strings"
+
 type Message struct {
 	Role             string  `json:"role,omitempty"`
 	Content          any     `json:"content,omitempty"`
@@ -7,6 +9,26 @@ type Message struct {
 	Name             *string `json:"name,omitempty"`
 	ToolCalls        []Tool  `json:"tool_calls,omitempty"`
 	ToolCallId       string  `json:"tool_call_id,omitempty"`
+	// ReasoningSignature is the signature of claude thinking blocks, it has to be sent back with the reasoning
+	ReasoningSignature string `json:"reasoning_signature,omitempty"`
+	// Reasoning is how openrouter and some others name the reasoning content, it is normalized into ReasoningContent
+	Reasoning *string `json:"reasoning,omitempty"`
+	// Annotations are the citations of the web sources used by the answer
+	Annotations []Annotation `json:"annotations,omitempty"`
+}
+
+// Annotation is a citation in the format of the openai web search
+// https://platform.openai.com/docs/guides/tools-web-search?api-mode=chat
+type Annotation struct {
+	Type        string       `json:"type"`
+	URLCitation *URLCitation `json:"url_citation,omitempty"`
+}
+
+type URLCitation struct {
+	URL        string `json:"url"`
+	Title      string `json:"title,omitempty"`
+	StartIndex int    `json:"start_index"`
+	EndIndex   int    `json:"end_index"`
 }
 
 func (m Message) IsStringContent() bool {
@@ -55,6 +77,7 @@ func (m Message) ParseContent() []MessageContent {
 			if !ok {
 				continue
 			}
+			count := len(contentList)
 			switch contentMap["type"] {
 			case ContentTypeText:
 				if subStr, ok := contentMap["text"].(string); ok {
@@ -72,6 +95,30 @@ func (m Message) ParseContent() []MessageContent {
 						},
 					})
 				}
+			case ContentTypeFile:
+				if subObj, ok := contentMap["file"].(map[string]any); ok {
+					file := &File{}
+					file.FileData, _ = subObj["file_data"].(string)
+					file.FileId, _ = subObj["file_id"].(string)
+					file.Filename, _ = subObj["filename"].(string)
+					contentList = append(contentList, MessageContent{
+						Type: ContentTypeFile,
+						File: file,
+					})
+				}
+			case ContentTypeInputAudio:
+				if subObj, ok := contentMap["input_audio"].(map[string]any); ok {
+					inputAudio := &InputAudio{}
+					inputAudio.Data, _ = subObj["data"].(string)
+					inputAudio.Format, _ = subObj["format"].(string)
+					contentList = append(contentList, MessageContent{
+						Type:       ContentTypeInputAudio,
+						InputAudio: inputAudio,
+					})
+				}
+			}
+			if len(contentList) > count {
+				contentList[count].CacheControl = parseCacheControl(contentMap)
 			}
 		}
 		return contentList
@@ -84,8 +131,58 @@ type ImageURL struct {
 	Detail string `json:"detail,omitempty"`
 }
 
+// File is a document given inline, FileData being a data url, base64 content or a http url
+type File struct {
+	FileData string `json:"file_data,omitempty"`
+	FileId   string `json:"file_id,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+// URL is FileData as a data url or a http url
+func (f *File) URL() string {
+	if f.FileData == "" || strings.HasPrefix(f.FileData, "data:") || strings.HasPrefix(f.FileData, "http://") || strings.HasPrefix(f.FileData, "https://") {
+		return f.FileData
+	}
+	return "data:;base64," + f.FileData
+}
+
+type InputAudio struct {
+	Data   string `json:"data"`
+	Format string `json:"format"`
+}
+
+// MimeType of the format, "wav" or "mp3"
+func (a *InputAudio) MimeType() string {
+	if a.Format == "mp3" {
+		return "audio/mpeg"
+	}
+	return "audio/" + a.Format
+}
+
 type MessageContent struct {
-	Type     string    `json:"type,omitempty"`
-	Text     string    `json:"text"`
-	ImageURL *ImageURL `json:"image_url,omitempty"`
+	Type       string      `json:"type,omitempty"`
+	Text       string      `json:"text"`
+	ImageURL   *ImageURL   `json:"image_url,omitempty"`
+	File       *File       `json:"file,omitempty"`
+	InputAudio *InputAudio `json:"input_audio,omitempty"`
+	// CacheControl marks the end of a cached prefix for claude
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+}
+
+// CacheControl is a prompt caching breakpoint
+// https://docs.anthropic.com/en/docs/build-with-claude/prompt-caching
+type CacheControl struct {
+	Type string `json:"type"`
+	TTL  string `json:"ttl,omitempty"`
+}
+
+func parseCacheControl(contentMap map[string]any) *CacheControl {
+	cacheControl, ok := contentMap["cache_control"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	result := &CacheControl{}
+	result.Type, _ = cacheControl["type"].(string)
+	result.TTL, _ = cacheControl["ttl"].(string)
+	return result
 }
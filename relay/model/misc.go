@@ -5,9 +5,17 @@ type Usage struct {
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
 
+	PromptTokensDetails     *PromptTokensDetails     `json:"prompt_tokens_details,omitempty"`
 	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
 }
 
+// PromptTokensDetails tells how many of the prompt tokens were read from or written into the prompt cache
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+	// CacheCreationTokens is not part of the openai api, claude bills the writes into the cache
+	CacheCreationTokens int `json:"cache_creation_tokens,omitempty"`
+}
+
 type CompletionTokensDetails struct {
 	ReasoningTokens          int `json:"reasoning_tokens"`
 	AcceptedPredictionTokens int `json:"accepted_prediction_tokens"`
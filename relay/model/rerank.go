@@ -0,0 +1,73 @@
+package model
+
+import "fmt"
+
+// RerankRequest is the unified rerank request, compatible with cohere & jina
+type RerankRequest struct {
+	Model string `json:"model"`
+	Query string `json:"query"`
+	// Documents are either strings or objects with a text field
+	Documents       []any `json:"documents"`
+	TopN            int   `json:"top_n,omitempty"`
+	ReturnDocuments *bool `json:"return_documents,omitempty"`
+}
+
+// ValidateDocuments makes sure every document is a string or an object with a text field,
+// so the result indexes of the upstream match the documents of the request
+func (r RerankRequest) ValidateDocuments() error {
+	for i, document := range r.Documents {
+		switch v := document.(type) {
+		case string:
+			continue
+		case map[string]any:
+			if _, ok := v["text"].(string); ok {
+				continue
+			}
+		}
+		return fmt.Errorf("documents[%d] must be a string or an object with a text field", i)
+	}
+	return nil
+}
+
+// GetDocuments returns the text of every document, call ValidateDocuments first
+func (r RerankRequest) GetDocuments() []string {
+	documents := make([]string, 0, len(r.Documents))
+	for _, document := range r.Documents {
+		switch v := document.(type) {
+		case string:
+			documents = append(documents, v)
+		case map[string]any:
+			text, _ := v["text"].(string)
+			documents = append(documents, text)
+		}
+	}
+	return documents
+}
+
+func (r RerankRequest) IsReturnDocuments() bool {
+	return r.ReturnDocuments != nil && *r.ReturnDocuments
+}
+
+type RerankDocument struct {
+	Text string `json:"text"`
+}
+
+type RerankResult struct {
+	Index          int             `json:"index"`
+	RelevanceScore float64         `json:"relevance_score"`
+	Document       *RerankDocument `json:"document,omitempty"`
+}
+
+type RerankUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+	// SearchUnits is set by upstreams billing per search, like cohere
+	SearchUnits int `json:"search_units,omitempty"`
+}
+
+type RerankResponse struct {
+	Id      string         `json:"id"`
+	Model   string         `json:"model"`
+	Results []RerankResult `json:"results"`
+	Usage   RerankUsage    `json:"usage"`
+}
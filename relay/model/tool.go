@@ -1,9 +1,13 @@
 package model
 
 type Tool struct {
+	// Index of the tool call in stream deltas
+	Index    *int     `json:"index,omitempty"`
 	Id       string   `json:"id,omitempty"`
 	Type     string   `json:"type,omitempty"` // when splicing claude tools stream messages, it is empty
 	Function Function `json:"function"`
+	// CacheControl marks the end of a cached prefix for claude, the tools come first in its prompt
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
 }
 
 type Function struct {
@@ -0,0 +1,58 @@
+package model
+
+// the statuses of the tasks, the ones of the upstreams are mapped to these
+const (
+	TaskStatusQueued     = "queued"
+	TaskStatusInProgress = "in_progress"
+	TaskStatusSucceeded  = "succeeded"
+	TaskStatusFailed     = "failed"
+)
+
+type VideoRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+	// Image is the first frame of the video, as an url or a data url
+	Image string `json:"image,omitempty"`
+	// Duration is in seconds
+	Duration int `json:"duration,omitempty"`
+	// Size is like 1280x720
+	Size           string `json:"size,omitempty"`
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+	Seed           *int   `json:"seed,omitempty"`
+	// CallbackURL gets the task when it is finished, it is called by the gateway and never sent to the upstream
+	CallbackURL string `json:"callback_url,omitempty"`
+}
+
+// TaskResult is the state of a task at the upstream
+type TaskResult struct {
+	Status string
+	// Outputs are the urls of the generated files
+	Outputs []string
+	Error   string
+	// Duration is the seconds of video generated as reported by the upstream, 0 when it doesn't report it
+	Duration float64
+}
+
+func (result *TaskResult) IsFinished() bool {
+	return result.Status == TaskStatusSucceeded || result.Status == TaskStatusFailed
+}
+
+type TaskOutput struct {
+	URL string `json:"url"`
+}
+
+type TaskError struct {
+	Message string `json:"message"`
+}
+
+// Task is the task object returned to the clients and sent to the callback urls
+type Task struct {
+	Id         string       `json:"id"`
+	Object     string       `json:"object"`
+	Model      string       `json:"model"`
+	Status     string       `json:"status"`
+	CreatedAt  int64        `json:"created_at"`
+	FinishedAt int64        `json:"finished_at,omitempty"`
+	Outputs    []TaskOutput `json:"outputs,omitempty"`
+	Error      *TaskError   `json:"error,omitempty"`
+}
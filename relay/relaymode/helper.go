@@ -16,6 +16,10 @@ func GetByPath(path string) int {
 		relayMode = Moderations
 	} else if strings.HasPrefix(path, "/v1/images/generations") {
 		relayMode = ImagesGenerations
+	} else if strings.HasPrefix(path, "/v1/images/edits") {
+		relayMode = ImagesEdits
+	} else if strings.HasPrefix(path, "/v1/images/variations") {
+		relayMode = ImagesVariations
 	} else if strings.HasPrefix(path, "/v1/edits") {
 		relayMode = Edits
 	} else if strings.HasPrefix(path, "/v1/audio/speech") {
@@ -24,6 +28,12 @@ func GetByPath(path string) int {
 		relayMode = AudioTranscription
 	} else if strings.HasPrefix(path, "/v1/audio/translations") {
 		relayMode = AudioTranslation
+	} else if strings.HasPrefix(path, "/v1/rerank") {
+		relayMode = Rerank
+	} else if strings.HasPrefix(path, "/v1/video/generations") {
+		relayMode = VideoGenerations
+	} else if strings.HasPrefix(path, "/v1/realtime") {
+		relayMode = Realtime
 	} else if strings.HasPrefix(path, "/v1/oneapi/proxy") {
 		relayMode = Proxy
 	}
@@ -0,0 +1,150 @@
+package tokenizer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkoukk/tiktoken-go"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// vocabulary is a tiktoken style bpe file published along with open-weight models
+type vocabulary struct {
+	name string
+	// file is looked up in TOKENIZER_VOCAB_DIR
+	file          string
+	pattern       string
+	specialTokens map[string]int
+}
+
+// llama3.tiktoken is the tokenizer.model of https://github.com/meta-llama/llama3, the pattern and the special
+// tokens are the ones of https://github.com/meta-llama/llama3/blob/main/llama/tokenizer.py
+var llama3Vocabulary = vocabulary{
+	name:    "llama3",
+	file:    "llama3.tiktoken",
+	pattern: `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`,
+	specialTokens: map[string]int{
+		"<|begin_of_text|>":   128000,
+		"<|end_of_text|>":     128001,
+		"<|start_header_id|>": 128006,
+		"<|end_header_id|>":   128007,
+		"<|eot_id|>":          128009,
+	},
+}
+
+// qwen.tiktoken is published at https://huggingface.co/Qwen/Qwen-7B/blob/main/qwen.tiktoken, the pattern and the
+// special tokens are the ones of https://github.com/QwenLM/Qwen/blob/main/tokenization_note.md
+var qwenVocabulary = vocabulary{
+	name:    "qwen",
+	file:    "qwen.tiktoken",
+	pattern: `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`,
+	specialTokens: map[string]int{
+		"<|endoftext|>": 151643,
+		"<|im_start|>":  151644,
+		"<|im_end|>":    151645,
+	},
+}
+
+// read returns the content of the vocabulary file from TOKENIZER_VOCAB_DIR
+func (v *vocabulary) read() ([]byte, error) {
+	if config.TokenizerVocabDir == "" {
+		return nil, errors.New("TOKENIZER_VOCAB_DIR is not set")
+	}
+	return os.ReadFile(filepath.Join(config.TokenizerVocabDir, v.file))
+}
+
+// parseRanks reads the lines of a tiktoken file, a base64 token and its rank
+func parseRanks(data []byte) (map[string]int, error) {
+	ranks := make(map[string]int)
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		fields := bytes.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid line: %q", line)
+		}
+		token, err := base64.StdEncoding.DecodeString(string(fields[0]))
+		if err != nil {
+			return nil, err
+		}
+		rank, err := strconv.Atoi(string(fields[1]))
+		if err != nil {
+			return nil, err
+		}
+		ranks[string(token)] = rank
+	}
+	return ranks, nil
+}
+
+func (v *vocabulary) load() (Tokenizer, error) {
+	data, err := v.read()
+	if err != nil {
+		return nil, err
+	}
+	ranks, err := parseRanks(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", v.file, err)
+	}
+	bpe, err := tiktoken.NewCoreBPE(ranks, v.specialTokens, v.pattern)
+	if err != nil {
+		return nil, err
+	}
+	specialTokensSet := map[string]any{}
+	for token := range v.specialTokens {
+		specialTokensSet[token] = true
+	}
+	encoding := &tiktoken.Encoding{
+		Name:           v.name,
+		PatStr:         v.pattern,
+		MergeableRanks: ranks,
+		SpecialTokens:  v.specialTokens,
+	}
+	return NewTiktoken(v.name, tiktoken.NewTiktoken(bpe, encoding, specialTokensSet)), nil
+}
+
+// vocabularyOrEstimate uses the vocabulary if it can be loaded, the estimator otherwise
+func vocabularyOrEstimate(v vocabulary, fallback *estimator) func() Tokenizer {
+	return func() Tokenizer {
+		tokenizer, err := v.load()
+		if err != nil {
+			logger.SysLog(fmt.Sprintf("%s vocabulary not loaded, token counts are estimated: %s", v.name, err.Error()))
+			return fallback
+		}
+		logger.SysLog(fmt.Sprintf("%s vocabulary loaded", v.name))
+		return tokenizer
+	}
+}
+
+func estimate(name string, base *tiktoken.Tiktoken, ratio float64) func() Tokenizer {
+	return func() Tokenizer {
+		return &estimator{name: name, base: base, ratio: ratio}
+	}
+}
+
+// Init registers the tokenizers of the known model families, the openai encodings are the base of estimates.
+// The ratios are rough approximations of each family over the base encoding, meant to keep the pre-consumed
+// quota close to the billed one; the count_tokens apis of the providers give the exact counts.
+func Init(cl100k *tiktoken.Tiktoken, o200k *tiktoken.Tiktoken) {
+	// claude 3 and later have no public tokenizer, the count is rounded up so that requests are not under-billed
+	Register([]string{"claude"}, estimate("claude-estimate", cl100k, 1.2))
+	// gemma publishes a 256k sentencepiece vocabulary shared with gemini, close in size to o200k
+	Register([]string{"gemini", "gemma"}, estimate("gemini-estimate", o200k, 1.05))
+	// mistral models use a 32k sentencepiece vocabulary (tekken for the latest ones), smaller than cl100k
+	Register([]string{"mistral", "mixtral", "codestral", "pixtral"}, estimate("mistral-estimate", cl100k, 1.15))
+	// the deepseek v2/v3 vocabulary is a 100k+ byte level bpe like cl100k
+	Register([]string{"deepseek"}, estimate("deepseek-estimate", cl100k, 1.0))
+	// llama 3 extends cl100k with 28k tokens, it's slightly more compact
+	Register([]string{"llama"}, vocabularyOrEstimate(llama3Vocabulary, &estimator{name: "llama3-estimate", base: cl100k, ratio: 0.97}))
+	// llama 2 uses a 32k sentencepiece vocabulary
+	Register([]string{"llama-2", "llama2", "codellama"}, estimate("llama2-estimate", cl100k, 1.25))
+	// the 151k qwen vocabulary extends cl100k, mostly with chinese tokens
+	Register([]string{"qwen", "qwq"}, vocabularyOrEstimate(qwenVocabulary, &estimator{name: "qwen-estimate", base: cl100k, ratio: 0.95}))
+}
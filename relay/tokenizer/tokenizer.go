@@ -0,0 +1,117 @@
+// Package tokenizer counts tokens the way each model family does. Families with a published tiktoken style
+// vocabulary are encoded exactly once the vocabulary is available, the others are estimated from the openai
+// encodings with a calibrated ratio.
+package tokenizer
+
+import (
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+type Tokenizer interface {
+	// Name is the name of the vocabulary, or of the encoding an estimate is based on
+	Name() string
+	// Exact tells if the tokens are the actual ones of the model, Encode returns nil for estimates
+	Exact() bool
+	Encode(text string) []int
+	Count(text string) int
+}
+
+type tiktokenTokenizer struct {
+	name    string
+	encoder *tiktoken.Tiktoken
+}
+
+// NewTiktoken wraps a tiktoken encoder
+func NewTiktoken(name string, encoder *tiktoken.Tiktoken) Tokenizer {
+	return &tiktokenTokenizer{name: name, encoder: encoder}
+}
+
+func (t *tiktokenTokenizer) Name() string {
+	return t.name
+}
+
+func (t *tiktokenTokenizer) Exact() bool {
+	return true
+}
+
+func (t *tiktokenTokenizer) Encode(text string) []int {
+	return t.encoder.Encode(text, nil, nil)
+}
+
+func (t *tiktokenTokenizer) Count(text string) int {
+	return len(t.Encode(text))
+}
+
+// estimator scales the count of a base encoding by the approximate ratio between the two tokenizers
+type estimator struct {
+	name  string
+	base  *tiktoken.Tiktoken
+	ratio float64
+}
+
+func (e *estimator) Name() string {
+	return e.name
+}
+
+func (e *estimator) Exact() bool {
+	return false
+}
+
+func (e *estimator) Encode(text string) []int {
+	return nil
+}
+
+func (e *estimator) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	return int(math.Ceil(float64(len(e.base.Encode(text, nil, nil))) * e.ratio))
+}
+
+// family is a group of models sharing a tokenizer, matched by keywords of their names
+type family struct {
+	keywords  []string
+	tokenizer func() Tokenizer
+}
+
+var (
+	families   []family
+	familiesMu sync.RWMutex
+)
+
+// Register adds the tokenizer of the models whose names contain one of the keywords, the families registered
+// last take precedence. The tokenizer is created on first use.
+func Register(keywords []string, tokenizer func() Tokenizer) {
+	var once sync.Once
+	var instance Tokenizer
+	familiesMu.Lock()
+	defer familiesMu.Unlock()
+	families = append([]family{{
+		keywords: keywords,
+		tokenizer: func() Tokenizer {
+			once.Do(func() {
+				instance = tokenizer()
+			})
+			return instance
+		},
+	}}, families...)
+}
+
+// Get returns the tokenizer of the model family, nil for models of openai and unknown models
+func Get(model string) Tokenizer {
+	model = strings.ToLower(model)
+	familiesMu.RLock()
+	defer familiesMu.RUnlock()
+	for _, f := range families {
+		for _, keyword := range f.keywords {
+			if strings.Contains(model, keyword) {
+				return f.tokenizer()
+			}
+		}
+	}
+	return nil
+}
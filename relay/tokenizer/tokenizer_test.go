@@ -0,0 +1,85 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+type namedTokenizer struct {
+	estimator
+}
+
+func named(name string) func() Tokenizer {
+	return func() Tokenizer {
+		return &namedTokenizer{estimator{name: name}}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	saved := families
+	families = nil
+	t.Cleanup(func() { families = saved })
+
+	Register([]string{"llama"}, named("llama3"))
+	Register([]string{"llama-2", "codellama"}, named("llama2"))
+	assert.Equal(t, "llama3", Get("Meta-Llama-3.1-8B-Instruct").Name())
+	// the families registered last take precedence
+	assert.Equal(t, "llama2", Get("llama-2-13b-chat").Name())
+	assert.Equal(t, "llama2", Get("codellama-34b").Name())
+	Register([]string{"llama"}, named("override"))
+	assert.Equal(t, "override", Get("llama-2-13b-chat").Name())
+	assert.Nil(t, Get("gpt-4o"))
+
+	// the tokenizer is created once
+	created := 0
+	Register([]string{"qwen"}, func() Tokenizer {
+		created++
+		return &namedTokenizer{estimator{name: "qwen"}}
+	})
+	assert.Same(t, Get("qwen2.5-72b"), Get("qwen-max"))
+	assert.Equal(t, 1, created)
+}
+
+// writeVocabulary writes a tiktoken file with the single bytes and the merges given, in rank order
+func writeVocabulary(t *testing.T, dir string, file string, merges ...string) {
+	var lines []string
+	for i := 0; i < 256; i++ {
+		lines = append(lines, fmt.Sprintf("%s %d", base64.StdEncoding.EncodeToString([]byte{byte(i)}), i))
+	}
+	for i, merge := range merges {
+		lines = append(lines, fmt.Sprintf("%s %d", base64.StdEncoding.EncodeToString([]byte(merge)), 256+i))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, file), []byte(strings.Join(lines, "\n")+"\n"), 0o644))
+}
+
+func TestVocabularyOrEstimate(t *testing.T) {
+	vocabDir := config.TokenizerVocabDir
+	config.TokenizerVocabDir = t.TempDir()
+	t.Cleanup(func() { config.TokenizerVocabDir = vocabDir })
+	v := vocabulary{name: "test", file: "test.tiktoken", pattern: `\S+|\s+`, specialTokens: map[string]int{"<|end|>": 300}}
+	fallback := &estimator{name: "test-estimate"}
+
+	// without the file the estimator is used
+	assert.Same(t, fallback, vocabularyOrEstimate(v, fallback)())
+
+	// an invalid file too
+	require.NoError(t, os.WriteFile(filepath.Join(config.TokenizerVocabDir, v.file), []byte("not a vocabulary\n"), 0o644))
+	assert.Same(t, fallback, vocabularyOrEstimate(v, fallback)())
+
+	writeVocabulary(t, config.TokenizerVocabDir, v.file, "ab", "abc")
+	tokenizer := vocabularyOrEstimate(v, fallback)()
+	require.NotSame(t, fallback, tokenizer)
+	assert.True(t, tokenizer.Exact())
+	assert.Equal(t, "test", tokenizer.Name())
+	assert.Equal(t, []int{257, 32, int('d')}, tokenizer.Encode("abc d"))
+	assert.Equal(t, 2, tokenizer.Count("abab"))
+}
@@ -48,6 +48,8 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.GET("/aff", controller.GetAffCode)
 				selfRoute.POST("/topup", controller.TopUp)
 				selfRoute.GET("/available_models", controller.GetUserAvailableModels)
+				selfRoute.GET("/preferences", controller.GetPreferences)
+				selfRoute.PUT("/preferences", controller.UpdatePreferences)
 			}
 
 			adminRoute := userRoute.Group("/")
@@ -83,6 +85,13 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.PUT("/", controller.UpdateChannel)
 			channelRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
 			channelRoute.DELETE("/:id", controller.DeleteChannel)
+			channelRoute.POST("/models/sync", controller.SyncModels)
+			channelRoute.GET("/:id/models/sync", controller.SyncChannelModels)
+			channelRoute.POST("/:id/models/sync", controller.SyncChannelModels)
+			channelRoute.GET("/:id/keys", controller.GetChannelKeys)
+			channelRoute.POST("/:id/keys", controller.AddChannelKeys)
+			channelRoute.PUT("/:id/keys/:key_id", controller.UpdateChannelKeyStatus)
+			channelRoute.DELETE("/:id/keys/:key_id", controller.DeleteChannelKey)
 		}
 		tokenRoute := apiRouter.Group("/token")
 		tokenRoute.Use(middleware.UserAuth())
@@ -94,6 +103,14 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.PUT("/", controller.UpdateToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
 		}
+		presetRoute := apiRouter.Group("/preset")
+		presetRoute.Use(middleware.UserAuth())
+		{
+			presetRoute.GET("/", controller.GetPresets)
+			presetRoute.GET("/:name", controller.GetPresetVersions)
+			presetRoute.POST("/", controller.SavePreset)
+			presetRoute.DELETE("/:name", controller.DeletePreset)
+		}
 		redemptionRoute := apiRouter.Group("/redemption")
 		redemptionRoute.Use(middleware.AdminAuth())
 		{
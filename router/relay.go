@@ -18,6 +18,28 @@ func SetRelayRouter(router *gin.Engine) {
 		modelsRouter.GET("", controller.ListModels)
 		modelsRouter.GET("/:model", controller.RetrieveModel)
 	}
+	// files, batches, stored completions & token counting don't need a channel, so they skip the distributor
+	filesRouter := router.Group("/v1")
+	filesRouter.Use(middleware.RelayPanicRecover(), middleware.TokenAuth())
+	{
+		filesRouter.GET("/files", controller.ListFiles)
+		filesRouter.POST("/files", controller.UploadFile)
+		filesRouter.DELETE("/files/:id", controller.DeleteFile)
+		filesRouter.GET("/files/:id", controller.RetrieveFile)
+		filesRouter.GET("/files/:id/content", controller.RetrieveFileContent)
+		filesRouter.POST("/batches", controller.CreateBatch)
+		filesRouter.GET("/batches", controller.ListBatches)
+		filesRouter.GET("/batches/:id", controller.RetrieveBatch)
+		filesRouter.POST("/batches/:id/cancel", controller.CancelBatch)
+		filesRouter.GET("/chat/completions", controller.ListChatCompletions)
+		filesRouter.GET("/chat/completions/:id", controller.RetrieveChatCompletion)
+		filesRouter.GET("/chat/completions/:id/messages", controller.ListChatCompletionMessages)
+		filesRouter.DELETE("/chat/completions/:id", controller.DeleteChatCompletion)
+		filesRouter.POST("/tokenize", controller.Tokenize)
+		filesRouter.POST("/count_tokens", controller.CountTokens)
+		filesRouter.GET("/tasks/:id", controller.RetrieveTask)
+		filesRouter.GET("/video/generations/:id", controller.RetrieveTask)
+	}
 	relayV1Router := router.Group("/v1")
 	routerEngine := smartRouter.GetGlobalEngine()
 	if routerEngine != nil {
@@ -31,18 +53,13 @@ func SetRelayRouter(router *gin.Engine) {
 		relayV1Router.POST("/chat/completions", controller.Relay)
 		relayV1Router.POST("/edits", controller.Relay)
 		relayV1Router.POST("/images/generations", controller.Relay)
-		relayV1Router.POST("/images/edits", controller.RelayNotImplemented)
-		relayV1Router.POST("/images/variations", controller.RelayNotImplemented)
+		relayV1Router.POST("/images/edits", controller.Relay)
+		relayV1Router.POST("/images/variations", controller.Relay)
 		relayV1Router.POST("/embeddings", controller.Relay)
 		relayV1Router.POST("/engines/:model/embeddings", controller.Relay)
 		relayV1Router.POST("/audio/transcriptions", controller.Relay)
 		relayV1Router.POST("/audio/translations", controller.Relay)
 		relayV1Router.POST("/audio/speech", controller.Relay)
-		relayV1Router.GET("/files", controller.RelayNotImplemented)
-		relayV1Router.POST("/files", controller.RelayNotImplemented)
-		relayV1Router.DELETE("/files/:id", controller.RelayNotImplemented)
-		relayV1Router.GET("/files/:id", controller.RelayNotImplemented)
-		relayV1Router.GET("/files/:id/content", controller.RelayNotImplemented)
 		relayV1Router.POST("/fine_tuning/jobs", controller.RelayNotImplemented)
 		relayV1Router.GET("/fine_tuning/jobs", controller.RelayNotImplemented)
 		relayV1Router.GET("/fine_tuning/jobs/:id", controller.RelayNotImplemented)
@@ -50,6 +67,9 @@ func SetRelayRouter(router *gin.Engine) {
 		relayV1Router.GET("/fine_tuning/jobs/:id/events", controller.RelayNotImplemented)
 		relayV1Router.DELETE("/models/:model", controller.RelayNotImplemented)
 		relayV1Router.POST("/moderations", controller.Relay)
+		relayV1Router.POST("/rerank", controller.Relay)
+		relayV1Router.POST("/video/generations", controller.Relay)
+		relayV1Router.GET("/realtime", controller.Relay)
 		relayV1Router.POST("/assistants", controller.RelayNotImplemented)
 		relayV1Router.GET("/assistants/:id", controller.RelayNotImplemented)
 		relayV1Router.POST("/assistants/:id", controller.RelayNotImplemented)
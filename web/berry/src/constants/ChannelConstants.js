@@ -191,6 +191,30 @@ export const CHANNEL_OPTIONS = {
     value: 46,
     color: 'primary'
   },
+  52: {
+    key: 52,
+    text: '可灵 Kling',
+    value: 52,
+    color: 'primary'
+  },
+  53: {
+    key: 53,
+    text: 'Azure Speech',
+    value: 53,
+    color: 'primary'
+  },
+  54: {
+    key: 54,
+    text: 'whisper.cpp',
+    value: 54,
+    color: 'primary'
+  },
+  55: {
+    key: 55,
+    text: 'Dify',
+    value: 55,
+    color: 'primary'
+  },
   41: {
     key: 41,
     text: 'Novita',
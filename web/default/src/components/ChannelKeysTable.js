@@ -0,0 +1,236 @@
+import React, { useEffect, useState } from 'react';
+import { useTranslation } from 'react-i18next';
+import { Button, Form, Label, Popup, Table } from 'semantic-ui-react';
+import { API, showError, showSuccess, timestamp2string } from '../helpers';
+
+function renderStatus(key, t) {
+  const now = Date.now() / 1000;
+  switch (key.status) {
+    case 1:
+      if (key.cooldown_until > now) {
+        return (
+          <Popup
+            trigger={
+              <Label basic color='yellow'>
+                {t('channel.keys.status.cooldown')}
+              </Label>
+            }
+            content={timestamp2string(key.cooldown_until)}
+            basic
+          />
+        );
+      }
+      return (
+        <Label basic color='green'>
+          {t('channel.keys.status.enabled')}
+        </Label>
+      );
+    case 2:
+      return (
+        <Label basic color='red'>
+          {t('channel.keys.status.disabled')}
+        </Label>
+      );
+    case 3:
+      return (
+        <Label basic color='yellow'>
+          {t('channel.keys.status.auto_disabled')}
+        </Label>
+      );
+    default:
+      return (
+        <Label basic color='grey'>
+          {t('channel.keys.status.unknown')}
+        </Label>
+      );
+  }
+}
+
+const ChannelKeysTable = ({ channelId, onChange }) => {
+  const { t } = useTranslation();
+  const [keys, setKeys] = useState([]);
+  const [newKeys, setNewKeys] = useState('');
+  const [loading, setLoading] = useState(false);
+
+  const loadKeys = async () => {
+    const res = await API.get(`/api/channel/${channelId}/keys`);
+    const { success, message, data } = res.data;
+    if (success) {
+      setKeys(data || []);
+    } else {
+      showError(message);
+    }
+  };
+
+  useEffect(() => {
+    loadKeys().then();
+  }, [channelId]);
+
+  const afterChange = async () => {
+    await loadKeys();
+    if (onChange) {
+      onChange();
+    }
+  };
+
+  const addKeys = async () => {
+    if (newKeys.trim() === '') {
+      return;
+    }
+    setLoading(true);
+    const res = await API.post(`/api/channel/${channelId}/keys`, {
+      keys: newKeys,
+    });
+    const { success, message, data } = res.data;
+    if (success) {
+      showSuccess(t('channel.keys.messages.added', { count: data }));
+      setNewKeys('');
+      await afterChange();
+    } else {
+      showError(message);
+    }
+    setLoading(false);
+  };
+
+  const manageKey = async (id, action) => {
+    let res;
+    switch (action) {
+      case 'enable':
+        res = await API.put(`/api/channel/${channelId}/keys/${id}`, {
+          status: 1,
+        });
+        break;
+      case 'disable':
+        res = await API.put(`/api/channel/${channelId}/keys/${id}`, {
+          status: 2,
+        });
+        break;
+      case 'delete':
+        res = await API.delete(`/api/channel/${channelId}/keys/${id}`);
+        break;
+      default:
+        return;
+    }
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess(t('channel.keys.messages.operation_success'));
+      await afterChange();
+    } else {
+      showError(message);
+    }
+  };
+
+  return (
+    <>
+      {keys.length > 0 && (
+        <Table basic compact size='small'>
+          <Table.Header>
+            <Table.Row>
+              <Table.HeaderCell>{t('channel.keys.table.key')}</Table.HeaderCell>
+              <Table.HeaderCell>
+                {t('channel.keys.table.status')}
+              </Table.HeaderCell>
+              <Table.HeaderCell>
+                {t('channel.keys.table.used_count')}
+              </Table.HeaderCell>
+              <Table.HeaderCell>
+                {t('channel.keys.table.failure_count')}
+              </Table.HeaderCell>
+              <Table.HeaderCell>
+                {t('channel.keys.table.last_used_time')}
+              </Table.HeaderCell>
+              <Table.HeaderCell>
+                {t('channel.keys.table.actions')}
+              </Table.HeaderCell>
+            </Table.Row>
+          </Table.Header>
+          <Table.Body>
+            {keys.map((key) => (
+              <Table.Row key={key.id}>
+                <Table.Cell style={{ fontFamily: 'JetBrains Mono, Consolas' }}>
+                  {key.key}
+                </Table.Cell>
+                <Table.Cell>
+                  {key.last_error ? (
+                    <Popup
+                      trigger={renderStatus(key, t)}
+                      content={key.last_error}
+                      basic
+                    />
+                  ) : (
+                    renderStatus(key, t)
+                  )}
+                </Table.Cell>
+                <Table.Cell>{key.used_count}</Table.Cell>
+                <Table.Cell>{key.failure_count}</Table.Cell>
+                <Table.Cell>
+                  {key.last_used_time
+                    ? timestamp2string(key.last_used_time)
+                    : '-'}
+                </Table.Cell>
+                <Table.Cell>
+                  <div>
+                    <Button
+                      type='button'
+                      size='tiny'
+                      onClick={() =>
+                        manageKey(
+                          key.id,
+                          key.status === 1 ? 'disable' : 'enable'
+                        )
+                      }
+                    >
+                      {key.status === 1
+                        ? t('channel.keys.buttons.disable')
+                        : t('channel.keys.buttons.enable')}
+                    </Button>
+                    <Popup
+                      trigger={
+                        <Button type='button' size='tiny' negative>
+                          {t('channel.keys.buttons.delete')}
+                        </Button>
+                      }
+                      on='click'
+                      flowing
+                      hoverable
+                    >
+                      <Button
+                        type='button'
+                        negative
+                        onClick={() => manageKey(key.id, 'delete')}
+                      >
+                        {t('channel.keys.buttons.confirm_delete')}
+                      </Button>
+                    </Popup>
+                  </div>
+                </Table.Cell>
+              </Table.Row>
+            ))}
+          </Table.Body>
+        </Table>
+      )}
+      <Form.Field>
+        <Form.TextArea
+          label={
+            keys.length > 0
+              ? t('channel.keys.add')
+              : t('channel.keys.enable_multi_key')
+          }
+          placeholder={t('channel.edit.batch_placeholder')}
+          onChange={(e, { value }) => setNewKeys(value)}
+          value={newKeys}
+          style={{
+            minHeight: 100,
+            fontFamily: 'JetBrains Mono, Consolas',
+          }}
+          autoComplete='new-password'
+        />
+      </Form.Field>
+      <Button type='button' loading={loading} onClick={addKeys}>
+        {t('channel.keys.buttons.add')}
+      </Button>
+    </>
+  );
+};
+
+export default ChannelKeysTable;
@@ -85,6 +85,34 @@ export const CHANNEL_OPTIONS = [
   { key: 44, text: 'SiliconFlow', value: 44, color: 'blue' },
   { key: 45, text: 'xAI', value: 45, color: 'blue' },
   { key: 46, text: 'Replicate', value: 46, color: 'blue' },
+  {
+    key: 52,
+    text: '可灵 Kling',
+    value: 52,
+    color: 'blue',
+    description: '视频生成，密钥格式为 AccessKey|SecretKey',
+  },
+  {
+    key: 53,
+    text: 'Azure Speech',
+    value: 53,
+    color: 'olive',
+    description: '语音合成与识别，密钥格式为 Region|Key',
+  },
+  {
+    key: 54,
+    text: 'whisper.cpp',
+    value: 54,
+    color: 'grey',
+    description: '本地语音识别服务',
+  },
+  {
+    key: 55,
+    text: 'Dify',
+    value: 55,
+    color: 'blue',
+    description: 'Dify 应用及兼容其接口的智能体服务，密钥为应用的 API 密钥',
+  },
   {
     key: 8,
     text: '自定义渠道',
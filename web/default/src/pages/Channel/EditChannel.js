@@ -5,6 +5,7 @@ import {useNavigate, useParams} from 'react-router-dom';
 import {API, copy, getChannelModels, showError, showInfo, showSuccess, verifyJSON,} from '../../helpers';
 import {CHANNEL_OPTIONS} from '../../constants';
 import {renderChannelTip} from '../../helpers/render';
+import ChannelKeysTable from '../../components/ChannelKeysTable';
 
 const MODEL_MAPPING_EXAMPLE = {
   'gpt-3.5-turbo-0301': 'gpt-3.5-turbo',
@@ -64,6 +65,14 @@ const EditChannel = () => {
     user_id: '',
     vertex_ai_project_id: '',
     vertex_ai_adc: '',
+    azure_auth_type: 'api_key',
+    azure_tenant_id: '',
+    azure_client_id: '',
+    azure_deployments: '',
+    anthropic_beta: '',
+    gemini_safety_settings: '',
+    dify_app_type: 'chat',
+    dify_inputs: '',
   });
   const handleInputChange = (e, { name, value }) => {
     setInputs((inputs) => ({ ...inputs, [name]: value }));
@@ -103,7 +112,32 @@ const EditChannel = () => {
       }
       setInputs(data);
       if (data.config !== '') {
-        setConfig(JSON.parse(data.config));
+        let localConfig = JSON.parse(data.config);
+        if (localConfig.azure_deployments) {
+          localConfig.azure_deployments = JSON.stringify(
+            localConfig.azure_deployments,
+            null,
+            2
+          );
+        }
+        if (localConfig.anthropic_beta) {
+          localConfig.anthropic_beta = localConfig.anthropic_beta.join(',');
+        }
+        if (localConfig.dify_inputs) {
+          localConfig.dify_inputs = JSON.stringify(
+            localConfig.dify_inputs,
+            null,
+            2
+          );
+        }
+        if (localConfig.gemini_safety_settings) {
+          localConfig.gemini_safety_settings = JSON.stringify(
+            localConfig.gemini_safety_settings,
+            null,
+            2
+          );
+        }
+        setConfig((config) => ({ ...config, ...localConfig }));
       }
       setBasicModels(getChannelModels(data.type));
     } else {
@@ -112,6 +146,14 @@ const EditChannel = () => {
     setLoading(false);
   };
 
+  const refreshKeyCount = async () => {
+    let res = await API.get(`/api/channel/${channelId}`);
+    const { success, data } = res.data;
+    if (success) {
+      setInputs((inputs) => ({ ...inputs, key_count: data.key_count }));
+    }
+  };
+
   const fetchModels = async () => {
     try {
       let res = await API.get(`/api/channel/models`);
@@ -179,6 +221,14 @@ const EditChannel = () => {
         inputs.key = `${config.region}|${config.vertex_ai_project_id}|${config.vertex_ai_adc}`;
       }
     }
+    if (
+      inputs.type === 3 &&
+      inputs.key === '' &&
+      config.azure_auth_type === 'managed_identity'
+    ) {
+      // the identity of the host signs in, the key is not used
+      inputs.key = 'managed_identity';
+    }
     if (!isEdit && (inputs.name === '' || inputs.key === '')) {
       showInfo(t('channel.edit.messages.name_required'));
       return;
@@ -195,6 +245,10 @@ const EditChannel = () => {
     if (localInputs.key === 'undefined|undefined|undefined') {
       localInputs.key = ''; // prevent potential bug
     }
+    if (localInputs.key_count > 0) {
+      // the keys of a multi-key channel are managed one by one
+      delete localInputs.key;
+    }
     if (localInputs.base_url && localInputs.base_url.endsWith('/')) {
       localInputs.base_url = localInputs.base_url.slice(
         0,
@@ -207,7 +261,45 @@ const EditChannel = () => {
     let res;
     localInputs.models = localInputs.models.join(',');
     localInputs.group = localInputs.groups.join(',');
-    localInputs.config = JSON.stringify(config);
+    let localConfig = { ...config };
+    if (localConfig.azure_deployments === '') {
+      delete localConfig.azure_deployments;
+    } else if (localConfig.azure_deployments) {
+      if (!verifyJSON(localConfig.azure_deployments)) {
+        showInfo('部署映射必须是合法的 JSON 格式！');
+        return;
+      }
+      localConfig.azure_deployments = JSON.parse(localConfig.azure_deployments);
+    }
+    if (localConfig.dify_inputs === '') {
+      delete localConfig.dify_inputs;
+    } else if (localConfig.dify_inputs) {
+      if (!verifyJSON(localConfig.dify_inputs)) {
+        showInfo('默认输入必须是合法的 JSON 格式！');
+        return;
+      }
+      localConfig.dify_inputs = JSON.parse(localConfig.dify_inputs);
+    }
+    if (localConfig.gemini_safety_settings === '') {
+      delete localConfig.gemini_safety_settings;
+    } else if (localConfig.gemini_safety_settings) {
+      if (!verifyJSON(localConfig.gemini_safety_settings)) {
+        showInfo('安全设置必须是合法的 JSON 格式！');
+        return;
+      }
+      localConfig.gemini_safety_settings = JSON.parse(
+        localConfig.gemini_safety_settings
+      );
+    }
+    if (localConfig.anthropic_beta) {
+      localConfig.anthropic_beta = localConfig.anthropic_beta
+        .split(',')
+        .map((beta) => beta.trim())
+        .filter((beta) => beta !== '');
+    } else {
+      delete localConfig.anthropic_beta;
+    }
+    localInputs.config = JSON.stringify(localConfig);
     if (isEdit) {
       res = await API.put(`/api/channel/`, {
         ...localInputs,
@@ -301,7 +393,8 @@ const EditChannel = () => {
             {inputs.type === 3 && (
               <>
                 <Message>
-                  注意，<strong>模型部署名称必须和模型名称保持一致</strong>
+                  注意，未在部署映射中填写的模型，
+                  <strong>模型部署名称必须和模型名称保持一致</strong>
                   ，因为 One API 会把请求体中的 model
                   参数替换为你的部署名称（模型名称中的点会被剔除），
                   <a
@@ -332,6 +425,67 @@ const EditChannel = () => {
                     autoComplete='new-password'
                   />
                 </Form.Field>
+                <Form.Field>
+                  <Form.Select
+                    label='认证方式'
+                    name='azure_auth_type'
+                    options={[
+                      { key: 'api_key', text: 'API Key', value: 'api_key' },
+                      {
+                        key: 'client_credentials',
+                        text: 'Entra ID 客户端凭据（密钥填写客户端密码）',
+                        value: 'client_credentials',
+                      },
+                      {
+                        key: 'managed_identity',
+                        text: 'Entra ID 托管标识（无需密钥）',
+                        value: 'managed_identity',
+                      },
+                    ]}
+                    onChange={handleConfigChange}
+                    value={config.azure_auth_type || 'api_key'}
+                  />
+                </Form.Field>
+                {config.azure_auth_type === 'client_credentials' && (
+                  <Form.Field>
+                    <Form.Input
+                      label='Tenant ID'
+                      name='azure_tenant_id'
+                      required
+                      onChange={handleConfigChange}
+                      value={config.azure_tenant_id}
+                      autoComplete=''
+                    />
+                  </Form.Field>
+                )}
+                {(config.azure_auth_type === 'client_credentials' ||
+                  config.azure_auth_type === 'managed_identity') && (
+                  <Form.Field>
+                    <Form.Input
+                      label='Client ID'
+                      name='azure_client_id'
+                      required={config.azure_auth_type === 'client_credentials'}
+                      placeholder='托管标识留空时使用系统分配的标识'
+                      onChange={handleConfigChange}
+                      value={config.azure_client_id}
+                      autoComplete=''
+                    />
+                  </Form.Field>
+                )}
+                <Form.Field>
+                  <Form.TextArea
+                    label='部署映射'
+                    name='azure_deployments'
+                    placeholder={'可选，模型名称到部署名称的映射，为空时部署名称为去掉点的模型名称，同步模型时会自动填写，例如：\n{"gpt-4o": "my-gpt-4o"}'}
+                    onChange={handleConfigChange}
+                    value={config.azure_deployments}
+                    style={{
+                      minHeight: 100,
+                      fontFamily: 'JetBrains Mono, Consolas',
+                    }}
+                    autoComplete='new-password'
+                  />
+                </Form.Field>
               </>
             )}
 
@@ -583,6 +737,74 @@ const EditChannel = () => {
                 />
               </Form.Field>
             )}
+            {(inputs.type === 24 || inputs.type === 42) && (
+              <Form.Field>
+                <Form.TextArea
+                  label='Gemini 安全设置'
+                  name='gemini_safety_settings'
+                  placeholder={
+                    '可选，危害类别到阈值的映射，未设置的类别使用 GEMINI_SAFETY_SETTING，例如：\n{"HARM_CATEGORY_DANGEROUS_CONTENT": "BLOCK_ONLY_HIGH"}'
+                  }
+                  onChange={handleConfigChange}
+                  value={config.gemini_safety_settings}
+                  style={{
+                    minHeight: 100,
+                    fontFamily: 'JetBrains Mono, Consolas',
+                  }}
+                  autoComplete='new-password'
+                />
+              </Form.Field>
+            )}
+            {(inputs.type === 14 || inputs.type === 33 || inputs.type === 42) && (
+              <Form.Field>
+                <Form.Input
+                  label='Anthropic Beta'
+                  name='anthropic_beta'
+                  placeholder={
+                    '可选，Claude 模型启用的 beta 功能，多个以逗号分隔，例如：prompt-caching-2024-07-31,output-128k-2025-02-19'
+                  }
+                  onChange={handleConfigChange}
+                  value={config.anthropic_beta}
+                  autoComplete=''
+                />
+              </Form.Field>
+            )}
+            {inputs.type === 55 && (
+              <>
+                <Form.Field>
+                  <Form.Select
+                    label='应用类型'
+                    name='dify_app_type'
+                    options={[
+                      {
+                        key: 'chat',
+                        text: '聊天助手 / Agent / Chatflow',
+                        value: 'chat',
+                      },
+                      { key: 'workflow', text: '工作流', value: 'workflow' },
+                    ]}
+                    onChange={handleConfigChange}
+                    value={config.dify_app_type || 'chat'}
+                  />
+                </Form.Field>
+                <Form.Field>
+                  <Form.TextArea
+                    label='默认输入'
+                    name='dify_inputs'
+                    placeholder={
+                      '可选，应用的输入变量，请求的 inputs 字段会覆盖同名变量，工作流的 query 变量默认为最后一条用户消息，例如：\n{"language": "zh"}'
+                    }
+                    onChange={handleConfigChange}
+                    value={config.dify_inputs}
+                    style={{
+                      minHeight: 100,
+                      fontFamily: 'JetBrains Mono, Consolas',
+                    }}
+                    autoComplete='new-password'
+                  />
+                </Form.Field>
+              </>
+            )}
             {inputs.type === 34 && (
               <Form.Input
                 label={t('channel.edit.user_id')}
@@ -594,8 +816,43 @@ const EditChannel = () => {
                 autoComplete=''
               />
             )}
+            {isEdit && inputs.key_count > 0 && (
+              <>
+                <Form.Field>
+                  <label>{t('channel.keys.title')}</label>
+                  <ChannelKeysTable
+                    channelId={channelId}
+                    onChange={refreshKeyCount}
+                  />
+                </Form.Field>
+                <Form.Select
+                  label={t('channel.keys.selection')}
+                  name='key_selection'
+                  options={[
+                    {
+                      key: 'round_robin',
+                      text: t('channel.keys.selections.round_robin'),
+                      value: 'round_robin',
+                    },
+                    {
+                      key: 'random',
+                      text: t('channel.keys.selections.random'),
+                      value: 'random',
+                    },
+                    {
+                      key: 'least_used',
+                      text: t('channel.keys.selections.least_used'),
+                      value: 'least_used',
+                    },
+                  ]}
+                  value={config.key_selection || 'round_robin'}
+                  onChange={handleConfigChange}
+                />
+              </>
+            )}
             {inputs.type !== 33 &&
               inputs.type !== 42 &&
+              !(isEdit && inputs.key_count > 0) &&
               (batch ? (
                 <Form.Field>
                   <Form.TextArea
@@ -640,6 +897,14 @@ const EditChannel = () => {
                 />
               </Form.Field>
             )}
+            {isEdit && !inputs.key_count && inputs.type !== 33 && (
+              <Form.Field>
+                <ChannelKeysTable
+                  channelId={channelId}
+                  onChange={refreshKeyCount}
+                />
+              </Form.Field>
+            )}
             {inputs.type !== 33 && !isEdit && (
               <Form.Checkbox
                 checked={batch}